@@ -18,6 +18,7 @@ class ProcessRequest(BaseModel):
     provider: str
     interaction_type: str
     input_data: Dict[str, Any]
+    shadow: bool = False  # Replay without executing any action
 
 
 class ProcessResponse(BaseModel):
@@ -35,6 +36,7 @@ class SettingsRequest(BaseModel):
     confidence_threshold: int = None
     auto_mode: bool = None
     model: str = None
+    passive_mode: bool = None  # Slack: react only, never post messages
 
 
 @router.post("/process", response_model=ProcessResponse)
@@ -56,7 +58,8 @@ async def process_interaction(request: ProcessRequest):
             interaction_data={
                 "provider": request.provider,
                 "interaction_type": request.interaction_type,
-                "input_data": request.input_data
+                "input_data": request.input_data,
+                "shadow": request.shadow
             }
         )
 
@@ -102,6 +105,8 @@ async def update_agent_settings(agent_id: str, request: SettingsRequest):
             settings["auto_mode"] = request.auto_mode
         if request.model is not None:
             settings["model"] = request.model
+        if request.passive_mode is not None:
+            settings["passive_mode"] = request.passive_mode
 
         # Need user_id for get_or_create_agent, use a placeholder for now
         # In production, this would come from auth
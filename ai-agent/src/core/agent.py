@@ -27,6 +27,11 @@ from src.services.mcp_service import MCPService
 
 logger = structlog.get_logger()
 
+# Actions a passive agent may take per provider; everything else is escalated
+PASSIVE_ACTIONS = {
+    "slack": {"react"},
+}
+
 
 class Agent:
     """
@@ -124,12 +129,16 @@ class Agent:
         3. Generate response with personality
         4. Calculate confidence
         5. Decide: execute, escalate, or suggest
+
+        Shadow interactions (replays) are scored and answered but never
+        executed, and don't count towards the agent's statistics.
         """
         start_time = time.time()
 
         provider = interaction_data.get("provider")
         interaction_type = interaction_data.get("interaction_type")
         input_data = interaction_data.get("input_data", {})
+        shadow = interaction_data.get("shadow", False)
 
         logger.info(
             "Processing interaction",
@@ -172,7 +181,26 @@ class Agent:
 
             processing_time = int((time.time() - start_time) * 1000)
 
-            if confidence >= threshold and self.config.get("auto_mode", False):
+            auto_execute = (
+                confidence >= threshold
+                and self.config.get("auto_mode", False)
+                and not shadow
+            )
+
+            if auto_execute and self._passive_blocks(provider, response):
+                # Passive mode: anything but a reaction goes to a human
+                self.escalated_interactions += 1
+
+                return {
+                    "status": "escalated",
+                    "action": "escalate",
+                    "response": response,
+                    "confidence": confidence,
+                    "reason": "Passive mode - messages are never posted autonomously",
+                    "processing_time": processing_time
+                }
+
+            if auto_execute:
                 # Execute action automatically
                 execution_result = await self._execute_action(
                     provider=provider,
@@ -203,7 +231,8 @@ class Agent:
 
             else:
                 # Escalate to human
-                self.escalated_interactions += 1
+                if not shadow:
+                    self.escalated_interactions += 1
 
                 return {
                     "status": "escalated",
@@ -227,7 +256,8 @@ class Agent:
             }
 
         finally:
-            self.total_interactions += 1
+            if not shadow:
+                self.total_interactions += 1
 
     async def _build_context(
         self,
@@ -450,8 +480,15 @@ Return your response in JSON format:
         action = response.get("action", "reply")
         response_text = response.get("response_text", "")
 
+        if self._passive_blocks(provider, response):
+            return {"success": False, "error": "Passive mode only allows reactions"}
+
+        # Passive reactions use the Slack tool directly, since the MCP
+        # mapping for "react" posts a message
+        passive = self.config.get("passive_mode", False) and provider in PASSIVE_ACTIONS
+
         # Try MCP service first if available and org_id is set
-        if self.mcp_service and self.org_id:
+        if self.mcp_service and self.org_id and not passive:
             try:
                 # Map action to MCP tool name
                 tool_name = self._map_action_to_mcp_tool(provider, action)
@@ -540,6 +577,15 @@ Return your response in JSON format:
             }
         return {"text": response_text}
 
+    def _passive_blocks(self, provider: str, response: dict) -> bool:
+        """Whether passive mode forbids the response's action on provider"""
+        if not self.config.get("passive_mode", False):
+            return False
+        allowed = PASSIVE_ACTIONS.get(provider)
+        if allowed is None:
+            return False
+        return response.get("action", "reply") not in allowed
+
     def _get_escalation_reason(self, confidence: int, intent: dict) -> str:
         """Generate human-readable escalation reason"""
         if confidence < 30:
@@ -13,14 +13,18 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/crypto"
 	"github.com/vibber/backend/internal/handlers"
 	customMiddleware "github.com/vibber/backend/internal/middleware"
+	"github.com/vibber/backend/internal/models"
 	"github.com/vibber/backend/internal/repository"
+	"github.com/vibber/backend/internal/worker"
 )
 
 func main() {
@@ -29,6 +33,9 @@ func main() {
 		log.Warn().Msg("No .env file found")
 	}
 
+	// Timestamps are UTC throughout
+	models.UseUTC()
+
 	// Initialize logger
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	if os.Getenv("ENV") == "development" {
@@ -42,12 +49,23 @@ func main() {
 	}
 
 	// Initialize database
-	db, err := repository.NewPostgresDB(cfg.DatabaseURL)
+	tracer := repository.NewQueryTracer(time.Duration(cfg.SlowQueryMillis) * time.Millisecond)
+	db, err := repository.NewPostgresDB(cfg.DatabaseURL, time.Duration(cfg.DBStatementTimeoutSeconds)*time.Second, tracer)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to connect to database")
 	}
 	defer db.Close()
 
+	// Analytics read from the replica when one is configured
+	var replica *pgxpool.Pool
+	if cfg.DatabaseReplicaURL != "" {
+		replica, err = repository.NewPostgresDB(cfg.DatabaseReplicaURL, time.Duration(cfg.DBStatementTimeoutSeconds)*time.Second, tracer)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to connect to database replica")
+		}
+		defer replica.Close()
+	}
+
 	// Initialize Redis
 	redisClient, err := repository.NewRedisClient(cfg.RedisURL)
 	if err != nil {
@@ -56,17 +74,60 @@ func main() {
 	defer redisClient.Close()
 
 	// Initialize repositories
-	repos := repository.NewRepositories(db)
+	keyring, err := crypto.LoadKeyring(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid encryption key configuration")
+	}
+	repos := repository.NewRepositories(db, replica, keyring)
 
 	// Initialize handlers
 	h := handlers.NewHandlers(repos, redisClient, cfg)
 
+	// Logged-out access tokens are rejected until they expire
+	blacklist := customMiddleware.NewTokenBlacklist(redisClient, cfg.TokenBlacklistFailOpen)
+
+	// Membership roles are cached briefly; freshRole re-reads them for
+	// admin-only destructive routes so a demotion applies immediately
+	roles := customMiddleware.NewRoleCache(repos.Membership, redisClient, time.Duration(cfg.RoleCacheSeconds)*time.Second)
+	freshRole := customMiddleware.RequireFreshRole(roles, 0)
+
+	// Start background workers
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	workers := worker.NewRegistry()
+	go worker.NewInteractionSweeper(repos, redisClient, cfg).Run(workerCtx,
+		workers.Register("interaction_sweeper", time.Duration(cfg.SweepIntervalSeconds)*time.Second))
+	go worker.NewRetentionPurger(repos, redisClient, cfg).Run(workerCtx,
+		workers.Register("retention_purger", time.Duration(cfg.RetentionPurgeIntervalMinutes)*time.Minute))
+	go worker.NewMaintenanceReleaser(repos, redisClient, cfg).Run(workerCtx,
+		workers.Register("maintenance_releaser", time.Duration(cfg.SweepIntervalSeconds)*time.Second))
+	go h.Integration.RunTokenRefresher(workerCtx,
+		workers.Register("token_refresher", time.Duration(cfg.SweepIntervalSeconds)*time.Second))
+	h.Health = handlers.NewHealthHandler(db, redisClient, workers)
+	webhooksDone := make(chan struct{})
+	go func() {
+		h.Webhook.Run(workerCtx)
+		close(webhooksDone)
+	}()
+	importsDone := make(chan struct{})
+	go func() {
+		h.Agent.RunTrainingImports(workerCtx)
+		close(importsDone)
+	}()
+	replaysDone := make(chan struct{})
+	go func() {
+		h.Agent.RunReplays(workerCtx)
+		close(replaysDone)
+	}()
+
 	// Setup router
 	r := chi.NewRouter()
 
 	// Global middleware
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(customMiddleware.QueryBudget(cfg.QueryBudgetPerRequest))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
@@ -74,9 +135,9 @@ func main() {
 	// CORS configuration
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", cfg.FrontendURL},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Request-ID"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Accept-Version", "Authorization", "Content-Type", "X-Device-ID", "X-Request-ID"},
+		ExposedHeaders:   []string{"Link", "API-Version", "Deprecation", "Sunset", "Retry-After", "X-AI-Quota-Limit", "X-AI-Quota-Remaining", "X-AI-Quota-Reset"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -84,42 +145,69 @@ func main() {
 	// Rate limiting
 	r.Use(httprate.LimitByIP(100, time.Minute))
 
+	// API versioning: Accept-Version picks between /api/v1 and /api/v2 routes,
+	// and deprecated routes are flagged with Deprecation/Sunset headers
+	r.Use(customMiddleware.AcceptVersion(r))
+	r.Use(customMiddleware.Deprecations(r, customMiddleware.DeprecatedRoutes))
+
 	// Health check
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"status":"healthy"}`))
 	})
+	r.Get("/ready", h.Health.Ready)
 
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
 		// Public routes
 		r.Group(func(r chi.Router) {
 			r.Post("/auth/login", h.Auth.Login)
-			r.Post("/auth/register", h.Auth.Register)
+			r.With(httprate.LimitByIP(cfg.RegisterRateLimitPerHour, time.Hour)).Post("/auth/register", h.Auth.Register)
+			r.Post("/auth/introspect", h.Auth.Introspect) // Service key or the token's owner
 			r.Get("/auth/oauth/{provider}", h.Auth.OAuthRedirect)
 			r.Get("/auth/oauth/{provider}/callback", h.Auth.OAuthCallback)
 		})
 
 		// Protected routes
 		r.Group(func(r chi.Router) {
-			r.Use(customMiddleware.JWTAuth(cfg.JWTSecret))
+			r.Use(customMiddleware.JWTAuth(cfg.JWTSecret, blacklist))
+			r.Use(customMiddleware.RequireOrgMembership(roles))
 
 			// Auth
 			r.Post("/auth/refresh", h.Auth.RefreshToken)
 			r.Post("/auth/logout", h.Auth.Logout)
+			r.Post("/auth/logout-all", h.Auth.LogoutAll)
+			r.Get("/auth/sessions", h.Auth.ListSessions)
+			r.Delete("/auth/sessions/{sessionID}", h.Auth.RevokeSession)
 			r.Get("/auth/me", h.Auth.Me)
+			r.Get("/auth/organizations", h.Auth.ListOrganizations)
+			r.Post("/auth/switch-org/{orgID}", h.Auth.SwitchOrg)
 
 			// Agents
 			r.Route("/agents", func(r chi.Router) {
 				r.Get("/", h.Agent.List)
 				r.Post("/", h.Agent.Create)
+				r.Get("/models", h.Agent.Models)
 				r.Route("/{agentID}", func(r chi.Router) {
+					r.Use(handlers.RequireAgentOwnership(repos))
+
 					r.Get("/", h.Agent.Get)
-					r.Put("/", h.Agent.Update)
+					r.Put("/", h.Agent.Replace)
+					r.Patch("/", h.Agent.Update)
 					r.Delete("/", h.Agent.Delete)
 					r.Post("/train", h.Agent.Train)
 					r.Get("/status", h.Agent.Status)
+					r.Get("/feedback-summary", h.Agent.FeedbackSummary)
+					r.Get("/calibration", h.Agent.Calibration)
+					r.Get("/effective-config", h.Agent.EffectiveConfig)
+					r.Get("/persona", h.Agent.Persona)
+					r.Post("/replay", h.Agent.Replay)
+					r.Get("/replays/{runID}", h.Agent.ReplayReport)
 					r.Put("/settings", h.Agent.UpdateSettings)
+					r.Post("/training/upload", h.Agent.UploadTraining)
+					r.Get("/training/imports/{jobID}", h.Agent.TrainingImportStatus)
+					r.Put("/integrations/{integrationID}", h.Integration.Attach)
+					r.Delete("/integrations/{integrationID}", h.Integration.Detach)
 				})
 			})
 
@@ -130,18 +218,45 @@ func main() {
 				r.Get("/{provider}/callback", h.Integration.Callback)
 				r.Delete("/{integrationID}", h.Integration.Disconnect)
 				r.Get("/{integrationID}/status", h.Integration.Status)
+				r.Post("/{integrationID}/refresh", h.Integration.Refresh)
+				r.Post("/{integrationID}/request-scopes", h.Integration.RequestScopes)
+				r.Post("/{integrationID}/enable", h.Integration.Enable)
+				r.Post("/{integrationID}/disable", h.Integration.Disable)
+				r.Post("/{integrationID}/webhook-token", h.Integration.RotateRouteToken)
+				r.Delete("/{integrationID}/webhook-token", h.Integration.RevokeRouteToken)
 			})
 
 			// Interactions
 			r.Route("/interactions", func(r chi.Router) {
 				r.Get("/", h.Interaction.List)
 				r.Get("/{interactionID}", h.Interaction.Get)
+				r.Get("/{interactionID}/explain", h.Agent.ExplainInteraction)
 				r.Post("/{interactionID}/feedback", h.Interaction.Feedback)
+				r.Post("/{interactionID}/promote-to-training", h.Interaction.PromoteToTraining)
+				r.Post("/{interactionID}/tags", h.Interaction.AddTag)
+				r.Delete("/{interactionID}/tags/{tagID}", h.Interaction.RemoveTag)
+			})
+
+			// Tags (organization vocabulary for annotating interactions)
+			r.Route("/tags", func(r chi.Router) {
+				r.Get("/", h.Tag.List)
+				r.Post("/", h.Tag.Create)
+				r.Put("/{tagID}", h.Tag.Update)
+				r.With(freshRole).Delete("/{tagID}", h.Tag.Delete)
 			})
 
 			// Escalations
 			r.Route("/escalations", func(r chi.Router) {
 				r.Get("/", h.Escalation.List)
+				r.Get("/export", h.Escalation.Export)
+				r.Get("/routing-rules", h.Escalation.ListRoutingRules)
+				r.Post("/routing-rules", h.Escalation.CreateRoutingRule)
+				r.Put("/routing-rules/{ruleID}", h.Escalation.UpdateRoutingRule)
+				r.With(freshRole).Delete("/routing-rules/{ruleID}", h.Escalation.DeleteRoutingRule)
+				r.Get("/priority-rules", h.Escalation.ListPriorityRules)
+				r.Post("/priority-rules", h.Escalation.CreatePriorityRule)
+				r.Put("/priority-rules/{ruleID}", h.Escalation.UpdatePriorityRule)
+				r.With(freshRole).Delete("/priority-rules/{ruleID}", h.Escalation.DeletePriorityRule)
 				r.Get("/{escalationID}", h.Escalation.Get)
 				r.Post("/{escalationID}/resolve", h.Escalation.Resolve)
 				r.Post("/{escalationID}/approve", h.Escalation.Approve)
@@ -151,40 +266,100 @@ func main() {
 			// Analytics
 			r.Route("/analytics", func(r chi.Router) {
 				r.Get("/overview", h.Analytics.Overview)
+				r.Get("/organization", h.Analytics.Organization)
 				r.Get("/trends", h.Analytics.Trends)
 				r.Get("/performance", h.Analytics.Performance)
+				r.Post("/recompute", h.Analytics.Recompute)
+				r.With(customMiddleware.RequirePlatformAdmin(cfg.PlatformAdminUserIDs)).
+					Get("/webhooks", h.Analytics.Webhooks)
 			})
 
 			// Organizations (admin)
 			r.Route("/organizations", func(r chi.Router) {
 				r.Get("/", h.Organization.Get)
 				r.Put("/", h.Organization.Update)
+				r.Patch("/", h.Organization.Patch)
 				r.Get("/members", h.Organization.ListMembers)
 				r.Post("/members/invite", h.Organization.InviteMember)
+				r.With(freshRole).Post("/agent-token/rotate", h.Organization.RotateAgentToken)
+				r.Get("/retention", h.Organization.GetRetention)
+				r.With(freshRole).Put("/retention", h.Organization.UpdateRetention)
+				r.Get("/agent-defaults", h.Organization.GetAgentDefaults)
+				r.Put("/agent-defaults", h.Organization.UpdateAgentDefaults)
+				r.Get("/features", h.Organization.GetFeatures)
+				r.Put("/agents/settings", h.Organization.UpdateAgentSettings)
+				r.With(freshRole).Post("/agents/pause-all", h.Organization.PauseAllAgents)
+				r.Post("/agents/resume-all", h.Organization.ResumeAllAgents)
+				r.Get("/maintenance-windows", h.Organization.ListMaintenanceWindows)
+				r.Post("/maintenance-windows", h.Organization.CreateMaintenanceWindow)
+				r.Put("/maintenance-windows/{windowID}", h.Organization.UpdateMaintenanceWindow)
+				r.With(freshRole).Delete("/maintenance-windows/{windowID}", h.Organization.DeleteMaintenanceWindow)
 			})
 
 			// Credentials (organization OAuth app credentials)
 			r.Route("/credentials", func(r chi.Router) {
 				r.Get("/", h.Credentials.List)
 				r.Post("/", h.Credentials.Create)
+				r.Post("/verify-all", h.Credentials.VerifyAll)
 				r.Get("/{provider}", h.Credentials.Get)
 				r.Put("/{provider}", h.Credentials.Update)
 				r.Delete("/{provider}", h.Credentials.Delete)
 				r.Post("/{provider}/verify", h.Credentials.Verify)
 			})
+
+			// Platform operator routes
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(customMiddleware.RequirePlatformAdmin(cfg.PlatformAdminUserIDs))
+
+				r.Get("/redis/keys", h.Admin.ListRedisKeys)
+				r.Get("/redis/key", h.Admin.GetRedisKey)
+				r.Delete("/redis/keys", h.Admin.DeleteRedisKeys)
+				r.Get("/organizations/{orgID}/features", h.Admin.GetOrgFeatures)
+				r.Put("/organizations/{orgID}/features/{flag}", h.Admin.SetOrgFeature)
+				r.Get("/orphans", h.Admin.ListOrphans)
+				r.Post("/orphans/purge", h.Admin.PurgeOrphans)
+			})
 		})
 
-		// Webhook routes (validated by signature)
+		// Webhook routes (validated by signature, or by a per-integration URL token)
 		r.Route("/webhooks", func(r chi.Router) {
 			r.Post("/slack", h.Webhook.Slack)
 			r.Post("/github", h.Webhook.GitHub)
 			r.Post("/jira", h.Webhook.Jira)
+			r.With(httprate.LimitByIP(cfg.WebhookTokenRateLimitPerMinute, time.Minute)).
+				Post("/{provider}/{routeToken}", h.Webhook.Routed)
 		})
 
 		// Internal API routes (for AI agent service-to-service communication)
 		r.Route("/internal", func(r chi.Router) {
-			// Authenticated by X-Service-Key header
-			r.Get("/credentials", h.Credentials.GetForAgent)
+			r.With(customMiddleware.ServiceKeyOrPlatformAdmin(cfg.InternalServiceKey, cfg.JWTSecret, blacklist, cfg.PlatformAdminUserIDs)).
+				Get("/workers", h.Health.Workers)
+
+			// Org agent tokens are only accepted for reading that org's credentials
+			r.With(customMiddleware.AgentTokenAuth(cfg.InternalServiceKey, repos.Organization)).
+				Get("/credentials", h.Credentials.GetForAgent)
+
+			// Authenticated by the global X-Service-Key
+			r.Group(func(r chi.Router) {
+				r.Use(customMiddleware.ServiceKeyAuth(cfg.InternalServiceKey))
+
+				r.Post("/interactions", h.Interaction.Record)
+				r.Get("/integrations/{integrationID}/scopes", h.Integration.VerifyScopes)
+				r.Post("/integrations/{integrationID}/ratelimit/acquire", h.Integration.AcquireRateLimit)
+				r.Post("/integrations/{integrationID}/ratelimit/backoff", h.Integration.ReportRateLimited)
+				r.Get("/webhooks/buffer", h.Webhook.BufferStats)
+				r.Get("/escalations/resolved", h.Escalation.ListResolvedForTraining)
+			})
+		})
+	})
+
+	// API v2 routes; also reachable from /api/v1 paths with Accept-Version: v2
+	r.Route("/api/v2", func(r chi.Router) {
+		r.Use(customMiddleware.JWTAuth(cfg.JWTSecret, blacklist))
+		r.Use(customMiddleware.RequireOrgMembership(roles))
+
+		r.Route("/interactions", func(r chi.Router) {
+			r.Get("/", h.Interaction.ListCursor)
 		})
 	})
 
@@ -218,5 +393,24 @@ func main() {
 		log.Fatal().Err(err).Msg("Server forced to shutdown")
 	}
 
+	// Stop workers once no new webhooks, uploads or replays can arrive,
+	// letting buffered events, queued imports and replays drain
+	stopWorkers()
+	select {
+	case <-webhooksDone:
+	case <-ctx.Done():
+		log.Warn().Msg("Timed out draining webhook buffer")
+	}
+	select {
+	case <-importsDone:
+	case <-ctx.Done():
+		log.Warn().Msg("Timed out finishing training imports")
+	}
+	select {
+	case <-replaysDone:
+	case <-ctx.Done():
+		log.Warn().Msg("Timed out finishing replays")
+	}
+
 	log.Info().Msg("Server exited gracefully")
 }
@@ -0,0 +1,56 @@
+// Package analytics versions cached agent analytics, so that anything
+// writing interactions or escalations can invalidate them with a single
+// Redis command instead of finding and deleting every cached entry.
+package analytics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// globalGenerationKey invalidates every agent's analytics at once, for
+// writes like the retention purge that touch many agents
+const globalGenerationKey = "analytics:generation"
+
+func generationKey(agentID uuid.UUID) string {
+	return fmt.Sprintf("analytics:%s:generation", agentID)
+}
+
+// Generation returns the agent's current cache generation. Cache keys built
+// from it stop matching as soon as the agent's data is written.
+func Generation(ctx context.Context, rdb *redis.Client, agentID uuid.UUID) (string, error) {
+	values, err := rdb.MGet(ctx, globalGenerationKey, generationKey(agentID)).Result()
+	if err != nil {
+		return "", err
+	}
+	gen := [2]string{"0", "0"}
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			gen[i] = s
+		}
+	}
+	return gen[0] + "." + gen[1], nil
+}
+
+// Invalidate bumps the agents' generations, so their cached analytics are
+// recomputed on the next read. Entries of older generations expire with
+// their TTL.
+func Invalidate(ctx context.Context, rdb *redis.Client, agentIDs ...uuid.UUID) error {
+	if len(agentIDs) == 0 {
+		return nil
+	}
+	pipe := rdb.Pipeline()
+	for _, agentID := range agentIDs {
+		pipe.Incr(ctx, generationKey(agentID))
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// InvalidateAll bumps the generation shared by every agent
+func InvalidateAll(ctx context.Context, rdb *redis.Client) error {
+	return rdb.Incr(ctx, globalGenerationKey).Err()
+}
@@ -0,0 +1,165 @@
+// Package crypto encrypts secrets stored at rest, such as integration tokens
+// and OAuth client secrets, with AES-256-GCM.
+//
+// Ciphertexts are prefixed with the version of the key that sealed them,
+// "v2:<base64>", so the key can be rotated: new values are sealed with the
+// current key while values sealed with an earlier key still decrypt as long
+// as that key stays configured.
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vibber/backend/internal/config"
+)
+
+// KeySize is the length of an encryption key in bytes
+const KeySize = 32
+
+var (
+	// ErrNotEncrypted is returned by Decrypt for values without a key version
+	// prefix, i.e. plaintext stored before encryption was enabled
+	ErrNotEncrypted = errors.New("value is not encrypted")
+	ErrUnknownKey   = errors.New("value was encrypted with an unknown key")
+	ErrInvalid      = errors.New("invalid ciphertext")
+)
+
+// Keyring seals values with its current key and opens values sealed with
+// any of its keys
+type Keyring struct {
+	version int
+	aeads   map[int]cipher.AEAD
+}
+
+// NewKeyring returns a keyring sealing with keys[version]. The other keys
+// are only used to decrypt.
+func NewKeyring(version int, keys map[int][]byte) (*Keyring, error) {
+	if _, ok := keys[version]; !ok {
+		return nil, fmt.Errorf("no key for current version %d", version)
+	}
+	k := &Keyring{version: version, aeads: make(map[int]cipher.AEAD, len(keys))}
+	for v, key := range keys {
+		if v <= 0 {
+			return nil, fmt.Errorf("key version %d must be positive", v)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key version %d must be %d bytes, got %d", v, KeySize, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[v] = aead
+	}
+	return k, nil
+}
+
+// LoadKeyring builds the keyring from ENCRYPTION_KEY, sealing with
+// ENCRYPTION_KEY_VERSION, and the retired keys in ENCRYPTION_PREVIOUS_KEYS
+// ("version:key" pairs). Keys are base64.
+func LoadKeyring(cfg *config.Config) (*Keyring, error) {
+	key, err := ParseKey(cfg.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("ENCRYPTION_KEY: %w", err)
+	}
+	keys := map[int][]byte{cfg.EncryptionKeyVersion: key}
+
+	for _, entry := range cfg.EncryptionPreviousKeys {
+		versionText, encoded, ok := strings.Cut(entry, ":")
+		version, err := strconv.Atoi(versionText)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_PREVIOUS_KEYS: entries must be version:key")
+		}
+		if _, exists := keys[version]; exists {
+			return nil, fmt.Errorf("ENCRYPTION_PREVIOUS_KEYS: key version %d is configured twice", version)
+		}
+		if keys[version], err = ParseKey(encoded); err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_PREVIOUS_KEYS: version %d: %w", version, err)
+		}
+	}
+	return NewKeyring(cfg.EncryptionKeyVersion, keys)
+}
+
+// ParseKey decodes a base64 key of KeySize bytes
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("key must be base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// Encrypt seals plaintext with the current key
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	aead := k.aeads[k.version]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	prefix := versionPrefix(k.version)
+	// The prefix is authenticated, so a value can't be relabeled to another key
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(prefix))
+	return prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt with any key in the keyring
+func (k *Keyring) Decrypt(value string) ([]byte, error) {
+	version, encoded, ok := parseVersion(value)
+	if !ok {
+		return nil, ErrNotEncrypted
+	}
+	aead, ok := k.aeads[version]
+	if !ok {
+		return nil, fmt.Errorf("%w (version %d)", ErrUnknownKey, version)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalid
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(versionPrefix(version)))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted reports whether value carries a key version prefix
+func IsEncrypted(value string) bool {
+	_, _, ok := parseVersion(value)
+	return ok
+}
+
+func versionPrefix(version int) string {
+	return "v" + strconv.Itoa(version) + ":"
+}
+
+// parseVersion splits "v<version>:<rest>"
+func parseVersion(value string) (int, string, bool) {
+	if !strings.HasPrefix(value, "v") {
+		return 0, "", false
+	}
+	versionText, rest, ok := strings.Cut(value[1:], ":")
+	if !ok {
+		return 0, "", false
+	}
+	version, err := strconv.Atoi(versionText)
+	if err != nil || version <= 0 || versionText != strconv.Itoa(version) {
+		return 0, "", false
+	}
+	return version, rest, true
+}
@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vibber/backend/internal/config"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	k, err := NewKeyring(1, map[int][]byte{1: testKey(1)})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	for _, plaintext := range []string{"xoxb-123-456", "", strings.Repeat("secret", 100)} {
+		sealed, err := k.Encrypt([]byte(plaintext))
+		if err != nil {
+			t.Fatalf("Encrypt: %v", err)
+		}
+		if !strings.HasPrefix(sealed, "v1:") || (plaintext != "" && strings.Contains(sealed, plaintext)) {
+			t.Errorf("Encrypt(%q) = %q", plaintext, sealed)
+		}
+		opened, err := k.Decrypt(sealed)
+		if err != nil || string(opened) != plaintext {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", plaintext, opened, err)
+		}
+	}
+
+	a, _ := k.Encrypt([]byte("same"))
+	b, _ := k.Encrypt([]byte("same"))
+	if a == b {
+		t.Error("encrypting twice gave the same ciphertext")
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	k, _ := NewKeyring(1, map[int][]byte{1: testKey(1)})
+	sealed, _ := k.Encrypt([]byte("token"))
+
+	raw, _ := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(sealed, "v1:"))
+	raw[len(raw)-1] ^= 1
+	tampered := "v1:" + base64.RawStdEncoding.EncodeToString(raw)
+
+	other, _ := NewKeyring(1, map[int][]byte{1: testKey(2)})
+	otherSealed, _ := other.Encrypt([]byte("token"))
+
+	tests := []struct {
+		name, value string
+		want        error
+	}{
+		{"plaintext", "xoxb-123-456", ErrNotEncrypted},
+		{"tampered", tampered, ErrInvalid},
+		{"relabeled", "v2:" + strings.TrimPrefix(sealed, "v1:"), ErrUnknownKey},
+		{"wrong key", otherSealed, ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := k.Decrypt(tt.value); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, _ := NewKeyring(1, map[int][]byte{1: testKey(1)})
+	sealedOld, _ := old.Encrypt([]byte("old token"))
+
+	rotated, err := NewKeyring(2, map[int][]byte{1: testKey(1), 2: testKey(2)})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	opened, err := rotated.Decrypt(sealedOld)
+	if err != nil || string(opened) != "old token" {
+		t.Errorf("rotated keyring decrypting an old value = %q, %v", opened, err)
+	}
+
+	sealedNew, _ := rotated.Encrypt([]byte("new token"))
+	if !strings.HasPrefix(sealedNew, "v2:") {
+		t.Errorf("rotated keyring sealed %q, want the v2 key", sealedNew)
+	}
+	if _, err := old.Decrypt(sealedNew); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("old keyring decrypting a new value: got %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	encode := base64.StdEncoding.EncodeToString
+	cfg := &config.Config{
+		EncryptionKey:          encode(testKey(2)),
+		EncryptionKeyVersion:   2,
+		EncryptionPreviousKeys: []string{"1:" + encode(testKey(1))},
+	}
+	k, err := LoadKeyring(cfg)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+
+	old, _ := NewKeyring(1, map[int][]byte{1: testKey(1)})
+	sealed, _ := old.Encrypt([]byte("token"))
+	if opened, err := k.Decrypt(sealed); err != nil || string(opened) != "token" {
+		t.Errorf("Decrypt = %q, %v", opened, err)
+	}
+
+	for _, bad := range []*config.Config{
+		{EncryptionKey: encode([]byte("short")), EncryptionKeyVersion: 1},
+		{EncryptionKey: encode(testKey(1)), EncryptionKeyVersion: 1, EncryptionPreviousKeys: []string{"1:" + encode(testKey(2))}},
+		{EncryptionKey: encode(testKey(1)), EncryptionKeyVersion: 1, EncryptionPreviousKeys: []string{encode(testKey(2))}},
+	} {
+		if _, err := LoadKeyring(bad); err == nil {
+			t.Errorf("LoadKeyring(%+v) succeeded", bad)
+		}
+	}
+}
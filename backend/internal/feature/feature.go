@@ -0,0 +1,134 @@
+package feature
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/repository"
+)
+
+// Known feature flags
+const (
+	Replay         = "replay"          // Shadow replays of past interactions
+	PassiveMode    = "passive_mode"    // Reaction-only Slack integrations
+	CostTracking   = "cost_tracking"   // Per-interaction AI cost tracking
+	TrainingExport = "training_export" // Resolved escalations shared for model training
+)
+
+// Defaults holds every known flag and its value for organizations that have
+// not set it. Shipped features default on; features in rollout default off.
+var Defaults = map[string]bool{
+	Replay:         true,
+	PassiveMode:    true,
+	CostTracking:   false,
+	TrainingExport: true,
+}
+
+// IsKnown reports whether flag is a known feature flag
+func IsKnown(flag string) bool {
+	_, ok := Defaults[flag]
+	return ok
+}
+
+// Names returns the known flags in sorted order
+func Names() []string {
+	names := make([]string, 0, len(Defaults))
+	for name := range Defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve merges an organization's flag overrides over the defaults,
+// ignoring overrides for unknown flags
+func Resolve(overrides map[string]bool) map[string]bool {
+	flags := make(map[string]bool, len(Defaults))
+	for name, enabled := range Defaults {
+		flags[name] = enabled
+	}
+	for name, enabled := range overrides {
+		if IsKnown(name) {
+			flags[name] = enabled
+		}
+	}
+	return flags
+}
+
+// Store reads organization feature flags from Postgres through a short-lived
+// Redis cache
+type Store struct {
+	orgs  repository.OrganizationRepository
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+func NewStore(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *Store {
+	return &Store{
+		orgs:  repos.Organization,
+		redis: redis,
+		ttl:   time.Duration(cfg.FeatureFlagCacheSeconds) * time.Second,
+	}
+}
+
+func cacheKey(orgID uuid.UUID) string {
+	return fmt.Sprintf("features:%s", orgID)
+}
+
+// Overrides returns the flags explicitly set for the organization
+func (s *Store) Overrides(ctx context.Context, orgID uuid.UUID) (map[string]bool, error) {
+	var overrides map[string]bool
+	if data, err := s.redis.Get(ctx, cacheKey(orgID)).Bytes(); err == nil && json.Unmarshal(data, &overrides) == nil {
+		return overrides, nil
+	}
+
+	overrides, err := s.orgs.GetFeatureFlags(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(overrides); err == nil {
+		s.redis.Set(ctx, cacheKey(orgID), data, s.ttl)
+	}
+	return overrides, nil
+}
+
+// Flags returns the value of every known flag for the organization
+func (s *Store) Flags(ctx context.Context, orgID uuid.UUID) (map[string]bool, error) {
+	overrides, err := s.Overrides(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return Resolve(overrides), nil
+}
+
+// Enabled reports whether flag is on for the organization. When the flags
+// cannot be loaded it logs and falls back to the flag's default; unknown
+// flags are off.
+func (s *Store) Enabled(ctx context.Context, orgID uuid.UUID, flag string) bool {
+	overrides, err := s.Overrides(ctx, orgID)
+	if err != nil {
+		log.Warn().Err(err).Str("org_id", orgID.String()).Str("flag", flag).Msg("Failed to load feature flags, using default")
+		return Defaults[flag]
+	}
+	return Resolve(overrides)[flag]
+}
+
+// Set turns flag on or off for the organization, or back to its default
+// when enabled is nil, and drops the cached flags
+func (s *Store) Set(ctx context.Context, orgID uuid.UUID, flag string, enabled *bool) error {
+	if !IsKnown(flag) {
+		return fmt.Errorf("unknown feature flag: %s", flag)
+	}
+	if err := s.orgs.SetFeatureFlag(ctx, orgID, flag, enabled); err != nil {
+		return err
+	}
+	return s.redis.Del(ctx, cacheKey(orgID)).Err()
+}
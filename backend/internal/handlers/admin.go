@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/feature"
+	"github.com/vibber/backend/internal/repository"
+	"github.com/vibber/backend/pkg/response"
+)
+
+// AdminHandler serves platform operator endpoints
+type AdminHandler struct {
+	repos    *repository.Repositories
+	redis    *redis.Client
+	cfg      *config.Config
+	features *feature.Store
+}
+
+func NewAdminHandler(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *AdminHandler {
+	return &AdminHandler{
+		repos:    repos,
+		redis:    redis,
+		cfg:      cfg,
+		features: feature.NewStore(repos, redis, cfg),
+	}
+}
+
+// inspectablePrefixes are the Redis key prefixes operators may read and
+// delete. Anything else (sessions, locks owned by other services) is off limits.
+var inspectablePrefixes = []string{
+	"ratelimit:",
+	"analytics:",
+	"webhooks:metrics:",
+	"features:",
+	"training:import:",
+	"ai:quota:",
+	"roles:",
+}
+
+const (
+	maxRedisKeys        = 500
+	maxRedisValueLength = 4096
+)
+
+// sensitiveFieldMarkers flag hash fields or keys whose values are redacted
+var sensitiveFieldMarkers = []string{"access_token", "refresh_token", "accesstoken", "refreshtoken", "api_key", "apikey", "secret", "password", "credential"}
+
+// validRedisKey reports whether key is a concrete key under an inspectable prefix
+func validRedisKey(key string) bool {
+	if strings.ContainsAny(key, "*?[]\\") {
+		return false
+	}
+	for _, prefix := range inspectablePrefixes {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validRedisPattern reports whether a SCAN pattern stays inside an
+// inspectable prefix; glob characters are only allowed after the prefix
+func validRedisPattern(pattern string) bool {
+	for _, prefix := range inspectablePrefixes {
+		if strings.HasPrefix(pattern, prefix) {
+			return !strings.Contains(pattern, "\\")
+		}
+	}
+	return false
+}
+
+func isSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, marker := range sensitiveFieldMarkers {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactValue(name, value string) string {
+	if isSensitive(name) {
+		return "[redacted]"
+	}
+	if len(value) > maxRedisValueLength {
+		return value[:maxRedisValueLength] + "...[truncated]"
+	}
+	return value
+}
+
+// ListRedisKeys lists keys matching pattern (default: every inspectable
+// prefix) with their type and TTL
+func (h *AdminHandler) ListRedisKeys(w http.ResponseWriter, r *http.Request) {
+	patterns := []string{r.URL.Query().Get("pattern")}
+	if patterns[0] == "" {
+		patterns = patterns[:0]
+		for _, prefix := range inspectablePrefixes {
+			patterns = append(patterns, prefix+"*")
+		}
+	} else if !validRedisPattern(patterns[0]) {
+		response.Error(w, http.StatusBadRequest, fmt.Sprintf("pattern must start with one of %v", inspectablePrefixes))
+		return
+	}
+
+	keys := make([]map[string]interface{}, 0)
+	truncated := false
+	for _, pattern := range patterns {
+		iter := h.redis.Scan(r.Context(), 0, pattern, 100).Iterator()
+		for iter.Next(r.Context()) {
+			if len(keys) == maxRedisKeys {
+				truncated = true
+				break
+			}
+			key := iter.Val()
+			keyType, _ := h.redis.Type(r.Context(), key).Result()
+			ttl, _ := h.redis.TTL(r.Context(), key).Result()
+			keys = append(keys, map[string]interface{}{
+				"key":        key,
+				"type":       keyType,
+				"ttlSeconds": int64(ttl / time.Second),
+			})
+		}
+		if err := iter.Err(); err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to scan keys")
+			return
+		}
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"keys":      keys,
+		"truncated": truncated,
+	})
+}
+
+// GetRedisKey returns the value of one key, redacting sensitive fields
+func (h *AdminHandler) GetRedisKey(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if !validRedisKey(key) {
+		response.Error(w, http.StatusBadRequest, fmt.Sprintf("key must start with one of %v", inspectablePrefixes))
+		return
+	}
+
+	keyType, err := h.redis.Type(r.Context(), key).Result()
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to read key")
+		return
+	}
+
+	var value interface{}
+	switch keyType {
+	case "none":
+		response.Error(w, http.StatusNotFound, "Key not found")
+		return
+	case "string":
+		s, err := h.redis.Get(r.Context(), key).Result()
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to read key")
+			return
+		}
+		value = redactValue(key, s)
+	case "hash":
+		fields, err := h.redis.HGetAll(r.Context(), key).Result()
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to read key")
+			return
+		}
+		redacted := make(map[string]string, len(fields))
+		for field, v := range fields {
+			redacted[field] = redactValue(field, v)
+		}
+		value = redacted
+	default:
+		value = "[unsupported type]"
+	}
+
+	ttl, _ := h.redis.TTL(r.Context(), key).Result()
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"key":        key,
+		"type":       keyType,
+		"ttlSeconds": int64(ttl / time.Second),
+		"value":      value,
+	})
+}
+
+// DeleteRedisKeys deletes a single key, or every key matching pattern
+func (h *AdminHandler) DeleteRedisKeys(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value("userEmail").(string)
+	key := r.URL.Query().Get("key")
+	pattern := r.URL.Query().Get("pattern")
+
+	var keys []string
+	switch {
+	case key != "":
+		if !validRedisKey(key) {
+			response.Error(w, http.StatusBadRequest, fmt.Sprintf("key must start with one of %v", inspectablePrefixes))
+			return
+		}
+		keys = []string{key}
+	case pattern != "":
+		if !validRedisPattern(pattern) {
+			response.Error(w, http.StatusBadRequest, fmt.Sprintf("pattern must start with one of %v", inspectablePrefixes))
+			return
+		}
+		iter := h.redis.Scan(r.Context(), 0, pattern, 100).Iterator()
+		for iter.Next(r.Context()) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to scan keys")
+			return
+		}
+	default:
+		response.Error(w, http.StatusBadRequest, "key or pattern is required")
+		return
+	}
+
+	var deleted int64
+	for _, k := range keys {
+		n, err := h.redis.Del(r.Context(), k).Result()
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to delete keys")
+			return
+		}
+		deleted += n
+	}
+
+	log.Info().Str("admin", email).Str("key", key).Str("pattern", pattern).Int64("deleted", deleted).Msg("Redis keys deleted by platform admin")
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"deleted": deleted,
+	})
+}
+
+// GetOrgFeatures lists every feature flag for an organization with its
+// effective value and whether the organization overrides the default
+func (h *AdminHandler) GetOrgFeatures(w http.ResponseWriter, r *http.Request) {
+	orgID, err := uuid.Parse(chi.URLParam(r, "orgID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid organization ID")
+		return
+	}
+
+	overrides, err := h.features.Overrides(r.Context(), orgID)
+	if err != nil {
+		respondLookupError(w, err, "Organization not found")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, orgFeatureList(overrides))
+}
+
+// SetOrgFeature turns a feature flag on or off for an organization. A null
+// enabled value removes the override so the default applies.
+func (h *AdminHandler) SetOrgFeature(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value("userEmail").(string)
+	orgID, err := uuid.Parse(chi.URLParam(r, "orgID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid organization ID")
+		return
+	}
+
+	flag := chi.URLParam(r, "flag")
+	if !feature.IsKnown(flag) {
+		response.Error(w, http.StatusBadRequest, fmt.Sprintf("Unknown feature flag, expected one of %v", feature.Names()))
+		return
+	}
+
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.features.Set(r.Context(), orgID, flag, req.Enabled); err != nil {
+		respondLookupError(w, err, "Organization not found")
+		return
+	}
+
+	log.Info().Str("admin", email).Str("org_id", orgID.String()).Str("flag", flag).Interface("enabled", req.Enabled).Msg("Feature flag changed by platform admin")
+
+	overrides, err := h.features.Overrides(r.Context(), orgID)
+	if err != nil {
+		respondLookupError(w, err, "Organization not found")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, orgFeatureList(overrides))
+}
+
+// orgFeatureList describes each known flag for an organization
+func orgFeatureList(overrides map[string]bool) []map[string]interface{} {
+	flags := feature.Resolve(overrides)
+	list := make([]map[string]interface{}, 0, len(flags))
+	for _, name := range feature.Names() {
+		_, overridden := overrides[name]
+		list = append(list, map[string]interface{}{
+			"flag":       name,
+			"enabled":    flags[name],
+			"default":    feature.Defaults[name],
+			"overridden": overridden,
+		})
+	}
+	return list
+}
+
+// ListOrphans counts rows left pointing at a deleted agent, interaction or
+// integration
+func (h *AdminHandler) ListOrphans(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.repos.Agent.CountOrphans(r.Context())
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to count orphaned rows")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"orphans": counts,
+		"total":   counts.Total(),
+	})
+}
+
+// PurgeOrphans deletes the rows ListOrphans counts
+func (h *AdminHandler) PurgeOrphans(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value("userEmail").(string)
+
+	counts, err := h.repos.Agent.PurgeOrphans(r.Context())
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to purge orphaned rows")
+		return
+	}
+
+	log.Info().Str("admin", email).Interface("deleted", counts).Int64("total", counts.Total()).Msg("Orphaned rows purged by platform admin")
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"deleted": counts,
+		"total":   counts.Total(),
+	})
+}
@@ -4,29 +4,52 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 
 	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/feature"
 	"github.com/vibber/backend/internal/models"
 	"github.com/vibber/backend/internal/repository"
+	"github.com/vibber/backend/internal/worker"
 	"github.com/vibber/backend/pkg/response"
 )
 
 type AgentHandler struct {
-	repos *repository.Repositories
-	redis *redis.Client
-	cfg   *config.Config
+	repos    *repository.Repositories
+	redis    *redis.Client
+	cfg      *config.Config
+	features *feature.Store
+
+	imports        *worker.Queue // Training file imports
+	importsPerUser *inFlightLimiter
+
+	replays         *worker.Queue // Shadow-mode replay runs
+	replaysPerUser  *inFlightLimiter
+	replaysPerAgent *inFlightLimiter
 }
 
 func NewAgentHandler(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *AgentHandler {
 	return &AgentHandler{
-		repos: repos,
-		redis: redis,
-		cfg:   cfg,
+		repos:    repos,
+		redis:    redis,
+		cfg:      cfg,
+		features: feature.NewStore(repos, redis, cfg),
+
+		imports:        worker.NewQueue(cfg.TrainingImportQueueSize, cfg.TrainingImportWorkers, trainingImportTimeout),
+		importsPerUser: newInFlightLimiter(cfg.TrainingImportsPerUser),
+
+		replays:         worker.NewQueue(cfg.ReplayQueueSize, cfg.ReplayWorkers, replayTimeout),
+		replaysPerUser:  newInFlightLimiter(cfg.ReplaysPerUser),
+		replaysPerAgent: newInFlightLimiter(1),
 	}
 }
 
@@ -51,23 +74,23 @@ func (h *AgentHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Default confidence threshold
-	if req.ConfidenceThreshold == 0 {
-		req.ConfidenceThreshold = 70
+	if err := models.ValidateThresholds(req.ConfidenceThreshold, req.ProviderThresholds); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	agent := &models.Agent{
-		ID:                  uuid.New(),
-		UserID:              userID,
-		Name:                req.Name,
-		Status:              "training",
-		ConfidenceThreshold: req.ConfidenceThreshold,
-		AutoMode:            false,
+	// Fields the request leaves out come from the organization's template
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	defaults, err := h.repos.Organization.GetAgentDefaults(r.Context(), orgID)
+	if err != nil {
+		respondLookupError(w, err, "Organization not found")
+		return
 	}
 
-	if req.Description != "" {
-		agent.Description = &req.Description
-	}
+	agent := defaults.NewAgent(userID, &req)
+	agent.OrgID = orgID
+	agent.CreatedBy = &userID
+	agent.UpdatedBy = &userID
 
 	if err := h.repos.Agent.Create(r.Context(), agent); err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to create agent")
@@ -78,56 +101,27 @@ func (h *AgentHandler) Create(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AgentHandler) Get(w http.ResponseWriter, r *http.Request) {
-	agentID, err := uuid.Parse(chi.URLParam(r, "agentID"))
-	if err != nil {
-		response.Error(w, http.StatusBadRequest, "Invalid agent ID")
-		return
-	}
-
-	userID := r.Context().Value("userID").(uuid.UUID)
-
-	agent, err := h.repos.Agent.GetByID(r.Context(), agentID)
-	if err != nil {
-		response.Error(w, http.StatusNotFound, "Agent not found")
-		return
-	}
-
-	// Verify ownership
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
-		return
-	}
+	agent := agentFromContext(r.Context())
 
 	response.JSON(w, http.StatusOK, agent)
 }
 
+// Update applies a partial update (PATCH); omitted fields keep their value
 func (h *AgentHandler) Update(w http.ResponseWriter, r *http.Request) {
-	agentID, err := uuid.Parse(chi.URLParam(r, "agentID"))
-	if err != nil {
-		response.Error(w, http.StatusBadRequest, "Invalid agent ID")
-		return
-	}
-
+	agent := agentFromContext(r.Context())
 	userID := r.Context().Value("userID").(uuid.UUID)
 
-	// Verify ownership
-	agent, err := h.repos.Agent.GetByID(r.Context(), agentID)
-	if err != nil {
-		response.Error(w, http.StatusNotFound, "Agent not found")
-		return
-	}
-
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
-		return
-	}
-
 	var req models.UpdateAgentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.Error(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
+	if err := models.ValidateThresholds(req.ConfidenceThreshold, req.ProviderThresholds); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Update fields
 	if req.Name != nil {
 		agent.Name = *req.Name
@@ -138,12 +132,56 @@ func (h *AgentHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.ConfidenceThreshold != nil {
 		agent.ConfidenceThreshold = *req.ConfidenceThreshold
 	}
+	if req.ProviderThresholds != nil {
+		agent.ProviderThresholds = req.ProviderThresholds
+	}
 	if req.AutoMode != nil {
 		agent.AutoMode = *req.AutoMode
 	}
 	if req.WorkingHours != nil {
 		agent.WorkingHours = req.WorkingHours
 	}
+	agent.UpdatedBy = &userID
+
+	if err := h.repos.Agent.Update(r.Context(), agent); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to update agent")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, agent)
+}
+
+// Replace overwrites the agent's editable fields (PUT); every required field
+// must be present and omitted nullable fields are cleared
+func (h *AgentHandler) Replace(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req models.ReplaceAgentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name == "" || req.ConfidenceThreshold == nil || req.AutoMode == nil {
+		response.Error(w, http.StatusBadRequest, "name, confidenceThreshold and autoMode are required; use PATCH for partial updates")
+		return
+	}
+	if err := models.ValidateThresholds(req.ConfidenceThreshold, req.ProviderThresholds); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	agent.Name = req.Name
+	agent.Description = req.Description
+	agent.ConfidenceThreshold = *req.ConfidenceThreshold
+	agent.ProviderThresholds = req.ProviderThresholds
+	if agent.ProviderThresholds == nil {
+		agent.ProviderThresholds = map[string]int{}
+	}
+	agent.AutoMode = *req.AutoMode
+	agent.WorkingHours = req.WorkingHours
+	agent.UpdatedBy = &userID
 
 	if err := h.repos.Agent.Update(r.Context(), agent); err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to update agent")
@@ -154,65 +192,211 @@ func (h *AgentHandler) Update(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AgentHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	agentID, err := uuid.Parse(chi.URLParam(r, "agentID"))
+	agent := agentFromContext(r.Context())
+
+	if err := h.repos.Agent.Delete(r.Context(), agent.ID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to delete agent")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Agent deleted successfully"})
+}
+
+// FeedbackSummary returns approved/rejected/corrected counts and a daily
+// approval rate trend. Defaults to the last 30 days.
+func (h *AgentHandler) FeedbackSummary(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+
+	from, to, ok := parseDateRange(w, r, 30)
+	if !ok {
+		return
+	}
+
+	summary, err := h.repos.Interaction.GetFeedbackSummary(r.Context(), agent.ID, from, to)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, "Invalid agent ID")
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch feedback summary")
 		return
 	}
 
-	userID := r.Context().Value("userID").(uuid.UUID)
+	response.JSON(w, http.StatusOK, summary)
+}
+
+// EffectiveConfig returns the settings the processing pipeline applies to
+// the agent, merged from built-in defaults, the organization's agent
+// defaults, the agent and its integrations, with the layer behind each value
+func (h *AgentHandler) EffectiveConfig(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+	orgID := r.Context().Value("orgID").(uuid.UUID)
 
-	// Verify ownership
-	agent, err := h.repos.Agent.GetByID(r.Context(), agentID)
+	defaults, err := h.repos.Organization.GetAgentDefaults(r.Context(), orgID)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Agent not found")
+		respondLookupError(w, err, "Organization not found")
 		return
 	}
 
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
+	integrations, err := h.repos.Integration.ListByAgentID(r.Context(), agent.ID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch integrations")
 		return
 	}
 
-	if err := h.repos.Agent.Delete(r.Context(), agentID); err != nil {
-		response.Error(w, http.StatusInternalServerError, "Failed to delete agent")
+	paused, err := h.repos.Agent.IsOrgPaused(r.Context(), agent.ID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to check organization pause")
 		return
 	}
 
-	response.JSON(w, http.StatusOK, map[string]string{"message": "Agent deleted successfully"})
+	response.JSON(w, http.StatusOK, models.ResolveAgentConfig(agent, defaults, integrations, paused))
 }
 
-func (h *AgentHandler) Train(w http.ResponseWriter, r *http.Request) {
-	agentID, err := uuid.Parse(chi.URLParam(r, "agentID"))
+// Persona returns the system prompt the agent acts with and the training
+// samples behind it. The prompt comes from the AI service, or is
+// reconstructed from the agent's settings when the service is unavailable
+// or out of quota.
+func (h *AgentHandler) Persona(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+
+	training, err := h.repos.Training.CountByAgentID(r.Context(), agent.ID)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, "Invalid agent ID")
+		response.Error(w, http.StatusInternalServerError, "Failed to count training samples")
 		return
 	}
 
-	userID := r.Context().Value("userID").(uuid.UUID)
+	persona := &models.AgentPersona{
+		AgentID:     agent.ID,
+		Source:      models.PersonaSourceReconstructed,
+		Training:    training,
+		GeneratedAt: time.Now(),
+	}
+	if quota := h.writeAIQuotaHeaders(w, r); !quota.Exhausted(time.Now()) {
+		prompt, err := h.fetchPersona(r.Context(), agent)
+		if err != nil {
+			log.Warn().Err(err).Str("agent_id", agent.ID.String()).Msg("Failed to fetch persona from AI service, reconstructing")
+		} else {
+			persona.Source = models.PersonaSourceAIService
+			persona.SystemPrompt = prompt
+		}
+	}
+	if persona.Source == models.PersonaSourceReconstructed {
+		persona.SystemPrompt = models.ReconstructPersonaPrompt(agent, training)
+	}
+
+	response.JSON(w, http.StatusOK, persona)
+}
 
-	// Verify ownership
-	agent, err := h.repos.Agent.GetByID(r.Context(), agentID)
+// fetchPersona asks the AI service for the agent's assembled system prompt
+func (h *AgentHandler) fetchPersona(ctx context.Context, agent *models.Agent) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", h.cfg.AgentServiceURL+"/api/v1/agents/"+agent.ID.String()+"/persona", nil)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Agent not found")
+		return "", err
+	}
+
+	resp, err := h.doAIRequest(&http.Client{Timeout: 10 * time.Second}, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkAIResponse(resp); err != nil {
+		return "", err
+	}
+
+	var result struct {
+		SystemPrompt string `json:"system_prompt"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.SystemPrompt == "" {
+		return "", fmt.Errorf("AI service returned no system prompt")
+	}
+	return result.SystemPrompt, nil
+}
+
+// Calibration buckets reviewed interactions by reported confidence and
+// compares each bucket's approval rate with its confidence, showing whether
+// the agent is over- or underconfident. Defaults to the last 90 days in
+// buckets of 10 points.
+func (h *AgentHandler) Calibration(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+
+	from, to, ok := parseDateRange(w, r, 90)
+	if !ok {
 		return
 	}
 
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
+	bucketSize := 10
+	if v := r.URL.Query().Get("bucket_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 5 || size > 50 || 100%size != 0 {
+			response.Error(w, http.StatusBadRequest, "bucket_size must divide 100 and be between 5 and 50")
+			return
+		}
+		bucketSize = size
+	}
+
+	buckets, err := h.repos.Interaction.GetCalibration(r.Context(), agent.ID, from, to, bucketSize)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch calibration")
+		return
+	}
+
+	report := models.BuildCalibrationReport(buckets, bucketSize)
+	report.From = from
+	report.To = to
+	report.ConfidenceThreshold = agent.ConfidenceThreshold
+
+	response.JSON(w, http.StatusOK, report)
+}
+
+// parseDateRange reads the from/to query parameters, defaulting to the
+// defaultDays before now. It writes a 400 and returns false when invalid.
+func parseDateRange(w http.ResponseWriter, r *http.Request, defaultDays int) (time.Time, time.Time, bool) {
+	query := r.URL.Query()
+
+	to := time.Now().UTC()
+	if t, err := parseTimeParam(query.Get("to")); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid to date")
+		return time.Time{}, time.Time{}, false
+	} else if t != nil {
+		to = *t
+	}
+
+	from := to.AddDate(0, 0, -defaultDays)
+	if t, err := parseTimeParam(query.Get("from")); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid from date")
+		return time.Time{}, time.Time{}, false
+	} else if t != nil {
+		from = *t
+	}
+
+	if !from.Before(to) {
+		response.Error(w, http.StatusBadRequest, "from must be before to")
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+func (h *AgentHandler) Train(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if !h.requireAIQuota(w, r) {
 		return
 	}
 
 	// Trigger training via AI service
 	if err := h.triggerTraining(r.Context(), agent); err != nil {
-		response.Error(w, http.StatusInternalServerError, "Failed to start training")
+		h.respondAIError(w, r, err, "Failed to start training")
 		return
 	}
 
 	// Update status
 	agent.Status = "training"
+	agent.UpdatedBy = &userID
 	h.repos.Agent.Update(r.Context(), agent)
 
+	h.writeAIQuotaHeaders(w, r)
 	response.JSON(w, http.StatusAccepted, map[string]string{
 		"message": "Training started",
 		"status":  "training",
@@ -220,101 +404,379 @@ func (h *AgentHandler) Train(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AgentHandler) Status(w http.ResponseWriter, r *http.Request) {
-	agentID, err := uuid.Parse(chi.URLParam(r, "agentID"))
+	agent := agentFromContext(r.Context())
+
+	// Get status from various sources
+	status, err := h.getAgentStatus(r.Context(), agent)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, "Invalid agent ID")
+		response.Error(w, http.StatusInternalServerError, "Failed to get agent status")
 		return
 	}
 
+	response.JSON(w, http.StatusOK, status)
+}
+
+func (h *AgentHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
 	userID := r.Context().Value("userID").(uuid.UUID)
 
-	// Verify ownership
-	agent, err := h.repos.Agent.GetByID(r.Context(), agentID)
-	if err != nil {
-		response.Error(w, http.StatusNotFound, "Agent not found")
+	var settings map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
+	// Settings are forwarded to the AI service; refuse before changing anything
+	if !h.requireAIQuota(w, r) {
 		return
 	}
 
-	// Get status from various sources
-	status, err := h.getAgentStatus(r.Context(), agentID)
-	if err != nil {
-		response.Error(w, http.StatusInternalServerError, "Failed to get agent status")
+	// The model is stored on the agent and forwarded with the other settings;
+	// the AI service processes the agent's interactions with it. null goes
+	// back to the AI service's default.
+	if value, ok := settings["model"]; ok {
+		var model *string
+		if value != nil {
+			name, isString := value.(string)
+			if !isString || name == "" {
+				response.Error(w, http.StatusBadRequest, "model must be a model name or null")
+				return
+			}
+			orgID := r.Context().Value("orgID").(uuid.UUID)
+			if status, msg := h.checkAgentModel(r.Context(), orgID, name); status != http.StatusOK {
+				response.Error(w, status, msg)
+				return
+			}
+			model = &name
+		}
+		agent.Model = model
+		agent.UpdatedBy = &userID
+		if err := h.repos.Agent.Update(r.Context(), agent); err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to update model")
+			return
+		}
+	}
+
+	// Passive mode is stored on the Slack integration and enforced by the AI service
+	if value, ok := settings["passiveMode"]; ok {
+		passive, isBool := value.(bool)
+		if !isBool {
+			response.Error(w, http.StatusBadRequest, "passiveMode must be a boolean")
+			return
+		}
+		orgID := r.Context().Value("orgID").(uuid.UUID)
+		if passive && !h.features.Enabled(r.Context(), orgID, feature.PassiveMode) {
+			response.Error(w, http.StatusForbidden, "Passive mode is not enabled for this organization")
+			return
+		}
+		if status, msg := h.setSlackPassive(r.Context(), agent.ID, passive); status != http.StatusOK {
+			response.Error(w, status, msg)
+			return
+		}
+		delete(settings, "passiveMode")
+		settings["passive_mode"] = passive
+	}
+
+	// The audit sample rate is applied by the backend when interactions complete
+	if value, ok := settings["auditSampleRate"]; ok {
+		rate, isNumber := value.(float64)
+		if !isNumber || rate < 0 || rate > 1 {
+			response.Error(w, http.StatusBadRequest, "auditSampleRate must be a number between 0 and 1")
+			return
+		}
+		agent.AuditSampleRate = rate
+		agent.UpdatedBy = &userID
+		if err := h.repos.Agent.Update(r.Context(), agent); err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to update audit sample rate")
+			return
+		}
+		delete(settings, "auditSampleRate")
+	}
+
+	// Update settings in AI service
+	if err := h.updateAgentSettings(r.Context(), agent.ID, settings); err != nil {
+		h.respondAIError(w, r, err, "Failed to update settings")
 		return
 	}
 
-	response.JSON(w, http.StatusOK, status)
+	h.writeAIQuotaHeaders(w, r)
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Settings updated"})
 }
 
-func (h *AgentHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
-	agentID, err := uuid.Parse(chi.URLParam(r, "agentID"))
+// setSlackPassive switches the agent's Slack integration in or out of passive
+// mode. Enabling it requires an install holding only passive scopes, so the
+// token itself cannot post messages. Returns the HTTP status and error message.
+func (h *AgentHandler) setSlackPassive(ctx context.Context, agentID uuid.UUID, passive bool) (int, string) {
+	integration, err := h.repos.Integration.GetByAgentAndProvider(ctx, agentID, "slack")
+	if isNotFound(err) {
+		return http.StatusBadRequest, "Passive mode requires a Slack integration"
+	}
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, "Invalid agent ID")
-		return
+		return http.StatusInternalServerError, "Failed to load Slack integration"
 	}
 
-	userID := r.Context().Value("userID").(uuid.UUID)
+	if passive {
+		if extra := models.NonPassiveScopes("slack", integration.Scopes); len(extra) > 0 {
+			return http.StatusBadRequest, "Slack integration has scopes that allow posting (" + strings.Join(extra, ", ") + "), reconnect it with mode=passive"
+		}
+		integration.Passive = true
+		if missing := models.MissingScopes(integration.Scopes, models.RequiredScopesFor(integration, "")); len(missing) > 0 {
+			return http.StatusBadRequest, "Slack integration is missing passive scopes: " + strings.Join(missing, ", ")
+		}
+	}
+
+	if err := h.repos.Integration.SetPassive(ctx, integration.ID, passive); err != nil {
+		return http.StatusInternalServerError, "Failed to update Slack integration"
+	}
+	return http.StatusOK, ""
+}
+
+func (h *AgentHandler) triggerTraining(ctx context.Context, agent *models.Agent) error {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"agent_id": agent.ID.String(),
+		"user_id":  agent.UserID.String(),
+	})
 
-	// Verify ownership
-	agent, err := h.repos.Agent.GetByID(r.Context(), agentID)
+	req, err := http.NewRequestWithContext(ctx, "POST", h.cfg.AgentServiceURL+"/api/v1/train", bytes.NewBuffer(payload))
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Agent not found")
-		return
+		return err
 	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.doAIRequest(&http.Client{}, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkAIResponse(resp)
+}
+
+const (
+	// maxReplayInteractions bounds a replay run; each interaction is one AI service call
+	maxReplayInteractions = 50
+	replayTimeout         = 10 * time.Minute
+)
+
+// RunReplays processes queued replay runs until ctx is cancelled, finishing
+// those already queued before returning
+func (h *AgentHandler) RunReplays(ctx context.Context) {
+	h.replays.Run(ctx)
+}
+
+// Replay re-runs past interactions through the AI service in shadow mode, so
+// no actions are executed, to compare a retrained agent with its earlier
+// output. The run happens on the replay queue; the report is served by
+// ReplayReport.
+func (h *AgentHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
 
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
+	if !h.features.Enabled(r.Context(), orgID, feature.Replay) {
+		response.Error(w, http.StatusForbidden, "Replay is not enabled for this organization")
 		return
 	}
 
-	var settings map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+	var req models.ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.Error(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	// Update settings in AI service
-	if err := h.updateAgentSettings(r.Context(), agentID, settings); err != nil {
-		response.Error(w, http.StatusInternalServerError, "Failed to update settings")
+	var interactions []*models.Interaction
+	switch {
+	case len(req.InteractionIDs) > 0:
+		if len(req.InteractionIDs) > maxReplayInteractions {
+			response.Error(w, http.StatusBadRequest, fmt.Sprintf("At most %d interactions can be replayed at once", maxReplayInteractions))
+			return
+		}
+		for _, id := range req.InteractionIDs {
+			interaction, err := h.repos.Interaction.GetByID(r.Context(), id)
+			if err != nil {
+				respondLookupError(w, err, "Interaction not found")
+				return
+			}
+			if interaction.AgentID != agent.ID {
+				response.Error(w, http.StatusNotFound, "Interaction not found")
+				return
+			}
+			interactions = append(interactions, interaction)
+		}
+
+	case req.From != nil && req.To != nil:
+		if !req.From.Before(*req.To) {
+			response.Error(w, http.StatusBadRequest, "from must be before to")
+			return
+		}
+		var err error
+		interactions, err = h.repos.Interaction.ListByAgentInRange(r.Context(), agent.ID, *req.From, *req.To, maxReplayInteractions)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to fetch interactions")
+			return
+		}
+
+	default:
+		response.Error(w, http.StatusBadRequest, "interactionIds or from and to are required")
 		return
 	}
 
-	response.JSON(w, http.StatusOK, map[string]string{"message": "Settings updated"})
+	if len(interactions) == 0 {
+		response.Error(w, http.StatusBadRequest, "No interactions to replay")
+		return
+	}
+	if !h.requireAIQuota(w, r) {
+		return
+	}
+
+	if !h.replaysPerAgent.Acquire(agent.ID) {
+		response.Error(w, http.StatusConflict, "A replay is already running for this agent")
+		return
+	}
+	if !h.replaysPerUser.Acquire(userID) {
+		h.replaysPerAgent.Release(agent.ID)
+		response.Error(w, http.StatusTooManyRequests, "Too many replays in progress")
+		return
+	}
+
+	runID := uuid.New()
+	queued := h.replays.Submit(func(ctx context.Context) {
+		defer h.replaysPerAgent.Release(agent.ID)
+		defer h.replaysPerUser.Release(userID)
+		h.runReplay(context.WithValue(ctx, "orgID", orgID), agent, runID, interactions)
+	})
+	if !queued {
+		h.replaysPerAgent.Release(agent.ID)
+		h.replaysPerUser.Release(userID)
+		response.Error(w, http.StatusServiceUnavailable, "Replay queue is full, try again later")
+		return
+	}
+
+	response.JSON(w, http.StatusAccepted, map[string]interface{}{
+		"runId": runID,
+		"total": len(interactions),
+	})
 }
 
-func (h *AgentHandler) triggerTraining(ctx context.Context, agent *models.Agent) error {
+// ReplayReport compares a replay run with the original interactions. Runs
+// still in progress report the interactions replayed so far.
+func (h *AgentHandler) ReplayReport(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+
+	runID, err := uuid.Parse(chi.URLParam(r, "runID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid run ID")
+		return
+	}
+
+	comparisons, err := h.repos.Replay.ListComparisons(r.Context(), agent.ID, runID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch replay")
+		return
+	}
+	if len(comparisons) == 0 {
+		response.Error(w, http.StatusNotFound, "Replay not found")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, models.BuildReplayReport(runID, comparisons))
+}
+
+func (h *AgentHandler) runReplay(ctx context.Context, agent *models.Agent, runID uuid.UUID, interactions []*models.Interaction) {
+	orgID, _ := ctx.Value("orgID").(uuid.UUID)
+	for _, interaction := range interactions {
+		var replay *models.InteractionReplay
+		if h.aiQuota(ctx, orgID).Exhausted(time.Now()) {
+			msg := errAIQuotaExhausted.Error()
+			replay = &models.InteractionReplay{Status: "error", ErrorMessage: &msg}
+		} else {
+			replay = h.shadowProcess(ctx, agent, interaction)
+		}
+		replay.ID = uuid.New()
+		replay.RunID = runID
+		replay.AgentID = agent.ID
+		replay.InteractionID = interaction.ID
+
+		if err := h.repos.Replay.Create(ctx, replay); err != nil {
+			log.Error().Err(err).Str("run_id", runID.String()).Str("interaction_id", interaction.ID.String()).Msg("Failed to store replay")
+		}
+	}
+}
+
+// shadowProcess sends an interaction to the AI service with shadow set, so it
+// is scored and answered but never executed
+func (h *AgentHandler) shadowProcess(ctx context.Context, agent *models.Agent, interaction *models.Interaction) *models.InteractionReplay {
+	replay := &models.InteractionReplay{Status: "error"}
+	fail := func(msg string) *models.InteractionReplay {
+		replay.ErrorMessage = &msg
+		return replay
+	}
+
+	input := json.RawMessage(interaction.InputData)
+	if !json.Valid(input) {
+		input, _ = json.Marshal(map[string]string{"text": interaction.InputData})
+	}
+
 	payload, _ := json.Marshal(map[string]interface{}{
-		"agent_id": agent.ID.String(),
-		"user_id":  agent.UserID.String(),
+		"agent_id":         agent.ID.String(),
+		"user_id":          agent.UserID.String(),
+		"provider":         interaction.Provider,
+		"interaction_type": interaction.InteractionType,
+		"input_data":       input,
+		"model":            agent.Model,
+		"shadow":           true,
 	})
 
-	req, err := http.NewRequestWithContext(ctx, "POST", h.cfg.AgentServiceURL+"/api/v1/train", bytes.NewBuffer(payload))
+	req, err := http.NewRequestWithContext(ctx, "POST", h.cfg.AgentServiceURL+"/api/v1/agents/process", bytes.NewBuffer(payload))
 	if err != nil {
-		return err
+		return fail(err.Error())
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := h.doAIRequest(&http.Client{Timeout: time.Minute}, req)
 	if err != nil {
-		return err
+		return fail(err.Error())
 	}
 	defer resp.Body.Close()
 
-	return nil
+	if err := checkAIResponse(resp); err != nil {
+		return fail(err.Error())
+	}
+
+	var result struct {
+		Status     string          `json:"status"`
+		Action     *string         `json:"action"`
+		Response   json.RawMessage `json:"response"`
+		Confidence *int            `json:"confidence"`
+		Error      *string         `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fail("Invalid AI service response")
+	}
+
+	if result.Status != "completed" && result.Status != "escalated" {
+		if result.Error != nil {
+			return fail(*result.Error)
+		}
+		return fail("AI service returned status " + result.Status)
+	}
+
+	replay.Status = result.Status
+	replay.Action = result.Action
+	replay.ConfidenceScore = result.Confidence
+	if len(result.Response) > 0 && string(result.Response) != "null" {
+		output := string(result.Response)
+		replay.OutputData = &output
+	}
+	return replay
 }
 
-func (h *AgentHandler) getAgentStatus(ctx context.Context, agentID uuid.UUID) (*models.AgentStatus, error) {
+func (h *AgentHandler) getAgentStatus(ctx context.Context, agent *models.Agent) (*models.AgentStatus, error) {
 	// Get interaction counts
-	todayCount, _ := h.repos.Interaction.CountToday(ctx, agentID)
-	pendingEscalations, _ := h.repos.Escalation.CountPending(ctx, agentID)
-
-	// Get agent
-	agent, _ := h.repos.Agent.GetByID(ctx, agentID)
+	todayCount, _ := h.repos.Interaction.CountToday(ctx, agent.ID)
+	pendingEscalations, _ := h.repos.Escalation.CountPending(ctx, agent.ID)
+	windows, _ := h.repos.Maintenance.ListForAgent(ctx, agent.ID)
+	maintenance := models.ActiveMaintenanceWindow(windows, time.Now())
 
 	return &models.AgentStatus{
 		Status:             agent.Status,
@@ -322,6 +784,8 @@ func (h *AgentHandler) getAgentStatus(ctx context.Context, agentID uuid.UUID) (*
 		TodayInteractions:  todayCount,
 		PendingEscalations: pendingEscalations,
 		ConfidenceScore:    85.5, // Would be calculated from recent interactions
+		InMaintenance:      maintenance != nil,
+		Maintenance:        maintenance,
 	}, nil
 }
 
@@ -335,12 +799,11 @@ func (h *AgentHandler) updateAgentSettings(ctx context.Context, agentID uuid.UUI
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := h.doAIRequest(&http.Client{}, req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	return nil
+	return checkAIResponse(resp)
 }
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxAIErrorBody bounds how much of an AI service error response is read
+const maxAIErrorBody = 64 << 10
+
+// aiServiceError is a request the AI service refused or failed to handle.
+// status is what the client is answered with.
+type aiServiceError struct {
+	status  int
+	message string
+}
+
+func (e *aiServiceError) Error() string {
+	return e.message
+}
+
+// checkAIResponse returns nil for a successful AI service response and an
+// error describing any other. Validation failures (400, 422) keep their
+// status and the service's own message so the client can fix the request;
+// quota exhaustion is errAIQuotaExhausted; everything else is the AI
+// service's fault as far as the client is concerned and becomes 502.
+func checkAIResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return errAIQuotaExhausted
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxAIErrorBody))
+	message := parseAIErrorMessage(body)
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		if message == "" {
+			message = "AI service rejected the request"
+		}
+		return &aiServiceError{status: resp.StatusCode, message: message}
+	default:
+		if message == "" {
+			message = fmt.Sprintf("AI service error (status %d)", resp.StatusCode)
+		}
+		return &aiServiceError{status: http.StatusBadGateway, message: message}
+	}
+}
+
+// parseAIErrorMessage reads the message of an AI service error body. The
+// service answers with FastAPI errors, {"detail": "..."}, or for request
+// validation {"detail": [{"loc": [...], "msg": "..."}]}; plain
+// {"error": "..."} and {"message": "..."} bodies are read too. Returns ""
+// when the body holds no message.
+func parseAIErrorMessage(body []byte) string {
+	var parsed struct {
+		Detail  json.RawMessage `json:"detail"`
+		Error   string          `json:"error"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return ""
+	}
+
+	var detail string
+	if json.Unmarshal(parsed.Detail, &detail) == nil && detail != "" {
+		return detail
+	}
+	var issues []struct {
+		Loc []interface{} `json:"loc"`
+		Msg string        `json:"msg"`
+	}
+	if json.Unmarshal(parsed.Detail, &issues) == nil && len(issues) > 0 {
+		messages := make([]string, 0, len(issues))
+		for _, issue := range issues {
+			// The location starts with where the field was read, e.g. "body"
+			var path []string
+			for i, part := range issue.Loc {
+				if i == 0 && len(issue.Loc) > 1 {
+					continue
+				}
+				path = append(path, fmt.Sprint(part))
+			}
+			if len(path) > 0 {
+				messages = append(messages, strings.Join(path, ".")+": "+issue.Msg)
+			} else {
+				messages = append(messages, issue.Msg)
+			}
+		}
+		return strings.Join(messages, "; ")
+	}
+
+	if parsed.Error != "" {
+		return parsed.Error
+	}
+	return parsed.Message
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/pkg/response"
+)
+
+// Models lists the AI models the organization's plan lets agents use
+func (h *AgentHandler) Models(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+
+	org, err := h.repos.Organization.GetByID(r.Context(), orgID)
+	if err != nil {
+		respondLookupError(w, err, "Organization not found")
+		return
+	}
+
+	allowed := h.cfg.AIModels()[org.Plan]
+	if allowed == nil {
+		allowed = []string{}
+	}
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"plan":   org.Plan,
+		"models": allowed,
+	})
+}
+
+// checkAgentModel checks the organization's plan allows an agent to use
+// model. Returns the HTTP status and error message.
+func (h *AgentHandler) checkAgentModel(ctx context.Context, orgID uuid.UUID, model string) (int, string) {
+	org, err := h.repos.Organization.GetByID(ctx, orgID)
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to fetch organization"
+	}
+	return modelAllowed(h.cfg, org.Plan, model)
+}
+
+// modelAllowed answers 400 for a model no plan offers and 403 for one the
+// plan does not include
+func modelAllowed(cfg *config.Config, plan, model string) (int, string) {
+	known := false
+	for p, allowed := range cfg.AIModels() {
+		for _, m := range allowed {
+			if m != model {
+				continue
+			}
+			if p == plan {
+				return http.StatusOK, ""
+			}
+			known = true
+		}
+	}
+	if !known {
+		return http.StatusBadRequest, fmt.Sprintf("Unknown model: %s", model)
+	}
+	return http.StatusForbidden, fmt.Sprintf("Model %s is not available on the %s plan", model, plan)
+}
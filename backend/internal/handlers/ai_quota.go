@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/pkg/response"
+)
+
+// errAIQuotaExhausted is returned by AI service calls answered with 429
+var errAIQuotaExhausted = errors.New("AI service quota exhausted")
+
+func aiQuotaKey(orgID uuid.UUID) string {
+	return "ai:quota:" + orgID.String()
+}
+
+// parseAIQuota reads the rate limit headers of an AI service response.
+// X-RateLimit-Reset may be a Unix time or seconds from now; a 429 without
+// rate limit headers is read from Retry-After. Returns nil if the response
+// reports nothing.
+func parseAIQuota(resp *http.Response, now time.Time) *models.AIQuota {
+	quota := &models.AIQuota{}
+	reported := false
+	intHeader := func(name string) *int {
+		n, err := strconv.Atoi(resp.Header.Get(name))
+		if err != nil || n < 0 {
+			return nil
+		}
+		reported = true
+		return &n
+	}
+
+	quota.Limit = intHeader("X-RateLimit-Limit")
+	quota.Remaining = intHeader("X-RateLimit-Remaining")
+	if reset := intHeader("X-RateLimit-Reset"); reset != nil {
+		t := time.Unix(int64(*reset), 0)
+		if *reset < 1e9 {
+			t = now.Add(time.Duration(*reset) * time.Second)
+		}
+		quota.ResetAt = &t
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		zero := 0
+		quota.Remaining = &zero
+		if retry := intHeader("Retry-After"); retry != nil && quota.ResetAt == nil {
+			t := now.Add(time.Duration(*retry) * time.Second)
+			quota.ResetAt = &t
+		}
+		reported = true
+	}
+
+	if !reported {
+		return nil
+	}
+	return quota
+}
+
+// doAIRequest sends a request to the AI service and caches the quota its
+// response reports for the organization in ctx
+func (h *AgentHandler) doAIRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	orgID, ok := req.Context().Value("orgID").(uuid.UUID)
+	if quota := parseAIQuota(resp, time.Now()); quota != nil && ok {
+		h.saveAIQuota(req.Context(), orgID, quota)
+	}
+	return resp, nil
+}
+
+// saveAIQuota caches quota briefly, and never past its reset
+func (h *AgentHandler) saveAIQuota(ctx context.Context, orgID uuid.UUID, quota *models.AIQuota) {
+	ttl := time.Duration(h.cfg.AIQuotaCacheSeconds) * time.Second
+	if retry := quota.RetryAfter(time.Now()); retry > 0 && retry < ttl {
+		ttl = retry
+	}
+	data, err := json.Marshal(quota)
+	if err != nil {
+		return
+	}
+	if err := h.redis.Set(ctx, aiQuotaKey(orgID), data, ttl).Err(); err != nil {
+		log.Warn().Err(err).Str("org_id", orgID.String()).Msg("Failed to cache AI quota")
+	}
+}
+
+// aiQuota returns the organization's cached quota, or nil if none is known
+func (h *AgentHandler) aiQuota(ctx context.Context, orgID uuid.UUID) *models.AIQuota {
+	data, err := h.redis.Get(ctx, aiQuotaKey(orgID)).Bytes()
+	if err != nil {
+		return nil
+	}
+	var quota models.AIQuota
+	if err := json.Unmarshal(data, &quota); err != nil {
+		return nil
+	}
+	return &quota
+}
+
+// writeAIQuotaHeaders surfaces the organization's known AI quota to the client
+func (h *AgentHandler) writeAIQuotaHeaders(w http.ResponseWriter, r *http.Request) *models.AIQuota {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	quota := h.aiQuota(r.Context(), orgID)
+	if quota == nil {
+		return nil
+	}
+	if quota.Limit != nil {
+		w.Header().Set("X-AI-Quota-Limit", strconv.Itoa(*quota.Limit))
+	}
+	if quota.Remaining != nil {
+		w.Header().Set("X-AI-Quota-Remaining", strconv.Itoa(*quota.Remaining))
+	}
+	if quota.ResetAt != nil {
+		w.Header().Set("X-AI-Quota-Reset", strconv.FormatInt(quota.ResetAt.Unix(), 10))
+	}
+	return quota
+}
+
+// requireAIQuota answers 429 instead of forwarding a request the AI service
+// has already said it will refuse. It reports whether the caller may proceed.
+func (h *AgentHandler) requireAIQuota(w http.ResponseWriter, r *http.Request) bool {
+	quota := h.writeAIQuotaHeaders(w, r)
+	now := time.Now()
+	if !quota.Exhausted(now) {
+		return true
+	}
+	respondAIQuotaExhausted(w, quota, now)
+	return false
+}
+
+func respondAIQuotaExhausted(w http.ResponseWriter, quota *models.AIQuota, now time.Time) {
+	if retry := quota.RetryAfter(now); retry > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retry/time.Second)))
+	}
+	response.Error(w, http.StatusTooManyRequests, "AI service quota exhausted, try again later")
+}
+
+// respondAIError answers a failed AI service call, passing quota exhaustion
+// through as 429 and the service's validation errors with their own status
+// and message. Other failures of the AI service are answered with 502.
+func (h *AgentHandler) respondAIError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if errors.Is(err, errAIQuotaExhausted) {
+		respondAIQuotaExhausted(w, h.writeAIQuotaHeaders(w, r), time.Now())
+		return
+	}
+	var aiErr *aiServiceError
+	if errors.As(err, &aiErr) {
+		if aiErr.status == http.StatusBadGateway {
+			log.Warn().Err(err).Msg(message)
+			response.Error(w, http.StatusBadGateway, message)
+			return
+		}
+		response.Error(w, aiErr.status, aiErr.message)
+		return
+	}
+	response.Error(w, http.StatusInternalServerError, message)
+}
@@ -1,13 +1,23 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
 
+	"github.com/vibber/backend/internal/analytics"
 	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/models"
 	"github.com/vibber/backend/internal/repository"
 	"github.com/vibber/backend/pkg/response"
 )
@@ -30,6 +40,12 @@ func (h *AnalyticsHandler) Overview(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(uuid.UUID)
 	agentIDStr := r.URL.Query().Get("agent_id")
 
+	interactionType, ok := parseInteractionType(r)
+	if !ok {
+		response.Error(w, http.StatusBadRequest, "Invalid interaction type")
+		return
+	}
+
 	if agentIDStr != "" {
 		// Get metrics for specific agent
 		agentID, err := uuid.Parse(agentIDStr)
@@ -39,13 +55,12 @@ func (h *AnalyticsHandler) Overview(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Verify ownership
-		agent, err := h.repos.Agent.GetByID(r.Context(), agentID)
-		if err != nil || agent.UserID != userID {
-			response.Error(w, http.StatusForbidden, "Access denied")
+		if _, err := requireAgentOwnership(r.Context(), h.repos, agentID, userID); err != nil {
+			respondOwnershipError(w, err)
 			return
 		}
 
-		metrics, err := h.repos.Interaction.GetOverviewMetrics(r.Context(), agentID)
+		metrics, err := h.overviewMetrics(r.Context(), agentID, interactionType)
 		if err != nil {
 			response.Error(w, http.StatusInternalServerError, "Failed to fetch metrics")
 			return
@@ -59,22 +74,45 @@ func (h *AnalyticsHandler) Overview(w http.ResponseWriter, r *http.Request) {
 	agents, _ := h.repos.Agent.ListByUserID(r.Context(), userID)
 
 	aggregated := &struct {
-		TotalInteractions  int                `json:"totalInteractions"`
-		TodayInteractions  int                `json:"todayInteractions"`
-		AutonomousRate     float64            `json:"autonomousRate"`
-		PendingEscalations int                `json:"pendingEscalations"`
-		AvgConfidenceScore float64            `json:"avgConfidenceScore"`
+		TotalInteractions  int                   `json:"totalInteractions"`
+		TodayInteractions  int                   `json:"todayInteractions"`
+		AutonomousRate     float64               `json:"autonomousRate"`
+		PendingEscalations int                   `json:"pendingEscalations"`
+		AvgConfidenceScore float64               `json:"avgConfidenceScore"`
 		AgentMetrics       []agentMetricsSummary `json:"agentMetrics"`
 	}{
 		AgentMetrics: make([]agentMetricsSummary, 0),
 	}
 
+	var totals models.InteractionTotals
 	var totalConfidence float64
 	var agentCount int
 
-	for _, agent := range agents {
-		metrics, _ := h.repos.Interaction.GetOverviewMetrics(r.Context(), agent.ID)
+	// Fetch per-agent metrics concurrently; results keep the agent order
+	results := make([]*models.OverviewMetrics, len(agents))
+	g, ctx := errgroup.WithContext(r.Context())
+	g.SetLimit(overviewConcurrency)
+	for i, agent := range agents {
+		i, agentID := i, agent.ID
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// An agent whose metrics fail to load is left out of the totals
+			results[i], _ = h.overviewMetrics(ctx, agentID, interactionType)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		// Only returned when the client went away; nobody is left to answer
+		return
+	}
+
+	for i, agent := range agents {
+		metrics := results[i]
 		if metrics != nil {
+			totals.Total += metrics.TotalInteractions
+			totals.Escalated += metrics.EscalatedInteractions
 			aggregated.TotalInteractions += metrics.TotalInteractions
 			aggregated.TodayInteractions += metrics.TodayInteractions
 			aggregated.PendingEscalations += metrics.PendingEscalations
@@ -96,18 +134,51 @@ func (h *AnalyticsHandler) Overview(w http.ResponseWriter, r *http.Request) {
 		aggregated.AvgConfidenceScore = totalConfidence / float64(agentCount)
 	}
 
-	// Calculate overall autonomous rate
-	if aggregated.TotalInteractions > 0 {
-		var totalEscalated int
-		for _, m := range aggregated.AgentMetrics {
-			totalEscalated += int(float64(m.TotalInteractions) * (100 - m.AutonomousRate) / 100)
-		}
-		aggregated.AutonomousRate = float64(aggregated.TotalInteractions-totalEscalated) / float64(aggregated.TotalInteractions) * 100
-	}
+	// Calculate overall autonomous rate from the agents' raw counts, as
+	// escalation counts rebuilt from per-agent rates are truncated
+	aggregated.AutonomousRate = totals.AutonomousRate()
 
 	response.JSON(w, http.StatusOK, aggregated)
 }
 
+// orgTopAgents is how many of the busiest agents the organization overview lists
+const orgTopAgents = 10
+
+// Organization summarizes every agent in the organization, regardless of
+// owner, for admins
+func (h *AnalyticsHandler) Organization(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	key := orgOverviewKey(orgID)
+	metrics := &models.OrgOverviewMetrics{}
+	if h.getCached(r.Context(), key, metrics) {
+		response.JSON(w, http.StatusOK, metrics)
+		return
+	}
+
+	metrics, err := h.repos.Interaction.GetOrgOverviewMetrics(r.Context(), orgID, orgTopAgents)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch metrics")
+		return
+	}
+
+	h.setCached(r.Context(), key, metrics)
+	response.JSON(w, http.StatusOK, metrics)
+}
+
+func orgOverviewKey(orgID uuid.UUID) string {
+	return fmt.Sprintf("analytics:org:%s:overview", orgID)
+}
+
+// overviewConcurrency bounds the per-agent metric queries run at once
+const overviewConcurrency = 8
+
 type agentMetricsSummary struct {
 	AgentID           string  `json:"agentId"`
 	AgentName         string  `json:"agentName"`
@@ -122,6 +193,12 @@ func (h *AnalyticsHandler) Trends(w http.ResponseWriter, r *http.Request) {
 	agentIDStr := r.URL.Query().Get("agent_id")
 	daysStr := r.URL.Query().Get("days")
 
+	interactionType, ok := parseInteractionType(r)
+	if !ok {
+		response.Error(w, http.StatusBadRequest, "Invalid interaction type")
+		return
+	}
+
 	days := 30 // Default to 30 days
 	if daysStr != "" {
 		if d, err := strconv.Atoi(daysStr); err == nil && d > 0 && d <= 90 {
@@ -138,13 +215,12 @@ func (h *AnalyticsHandler) Trends(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Verify ownership
-		agent, err := h.repos.Agent.GetByID(r.Context(), agentID)
-		if err != nil || agent.UserID != userID {
-			response.Error(w, http.StatusForbidden, "Access denied")
+		if _, err := requireAgentOwnership(r.Context(), h.repos, agentID, userID); err != nil {
+			respondOwnershipError(w, err)
 			return
 		}
 
-		trends, err := h.repos.Interaction.GetTrends(r.Context(), agentID, days)
+		trends, err := h.trends(r.Context(), agentID, days, interactionType)
 		if err != nil {
 			response.Error(w, http.StatusInternalServerError, "Failed to fetch trends")
 			return
@@ -160,7 +236,7 @@ func (h *AnalyticsHandler) Trends(w http.ResponseWriter, r *http.Request) {
 	// This would aggregate daily data across all agents
 	// For simplicity, returning first agent's trends or empty
 	if len(agents) > 0 {
-		trends, _ := h.repos.Interaction.GetTrends(r.Context(), agents[0].ID, days)
+		trends, _ := h.trends(r.Context(), agents[0].ID, days, interactionType)
 		response.JSON(w, http.StatusOK, trends)
 		return
 	}
@@ -190,9 +266,8 @@ func (h *AnalyticsHandler) Performance(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Verify ownership
-		agent, err := h.repos.Agent.GetByID(r.Context(), agentID)
-		if err != nil || agent.UserID != userID {
-			response.Error(w, http.StatusForbidden, "Access denied")
+		if _, err := requireAgentOwnership(r.Context(), h.repos, agentID, userID); err != nil {
+			respondOwnershipError(w, err)
 			return
 		}
 
@@ -213,3 +288,301 @@ func (h *AnalyticsHandler) Performance(w http.ResponseWriter, r *http.Request) {
 
 	response.JSON(w, http.StatusOK, performance)
 }
+
+// parseInteractionType reads the optional type filter; an empty value means all types
+func parseInteractionType(r *http.Request) (string, bool) {
+	interactionType := r.URL.Query().Get("type")
+	if interactionType == "" {
+		return "", true
+	}
+	return interactionType, models.IsValidInteractionType(interactionType)
+}
+
+// Recompute drops and re-warms cached analytics for one agent, or for every
+// agent in the organization (admin only). Since recomputation is query-heavy,
+// each organization, and each agent, is recomputed at most once per interval.
+func (h *AnalyticsHandler) Recompute(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	agents, err := h.repos.Agent.ListByOrgID(r.Context(), orgID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch agents")
+		return
+	}
+
+	// Only one recompute of the organization, or of one agent, runs per
+	// interval; a failed run releases its lock so it can be retried
+	lockKey := "analytics:recompute:" + orgID.String()
+	if agentIDStr := r.URL.Query().Get("agent_id"); agentIDStr != "" {
+		agentID, err := uuid.Parse(agentIDStr)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid agent ID")
+			return
+		}
+
+		var selected []*models.Agent
+		for _, agent := range agents {
+			if agent.ID == agentID {
+				selected = append(selected, agent)
+			}
+		}
+		if len(selected) == 0 {
+			response.Error(w, http.StatusNotFound, "Agent not found")
+			return
+		}
+		agents = selected
+		lockKey = "analytics:recompute:agent:" + agentID.String()
+	}
+
+	acquired, err := h.redis.SetNX(r.Context(), lockKey, "1", analyticsRecomputeInterval).Result()
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to schedule recompute")
+		return
+	}
+	if !acquired {
+		response.Error(w, http.StatusTooManyRequests, "Analytics were recomputed recently, try again later")
+		return
+	}
+	fail := func(message string) {
+		h.redis.Del(context.WithoutCancel(r.Context()), lockKey)
+		response.Error(w, http.StatusInternalServerError, message)
+	}
+
+	agentIDs := make([]uuid.UUID, 0, len(agents))
+	for _, agent := range agents {
+		agentIDs = append(agentIDs, agent.ID)
+	}
+	if err := h.redis.Del(r.Context(), orgOverviewKey(orgID)).Err(); err != nil {
+		fail("Failed to clear cached analytics")
+		return
+	}
+	if err := analytics.Invalidate(r.Context(), h.redis, agentIDs...); err != nil {
+		fail("Failed to clear cached analytics")
+		return
+	}
+
+	recomputed := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		if _, err := h.overviewMetrics(r.Context(), agent.ID, ""); err != nil {
+			fail("Failed to recompute metrics")
+			return
+		}
+		if _, err := h.trends(r.Context(), agent.ID, 30, ""); err != nil {
+			fail("Failed to recompute trends")
+			return
+		}
+
+		recomputed = append(recomputed, agent.ID.String())
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Analytics recomputed",
+		"agents":  recomputed,
+	})
+}
+
+// Webhooks summarizes inbound webhook events by provider and event type over
+// a date range (default the last 7 days). Webhooks are not attributed to an
+// organization, so the counts are instance-wide and the route is limited to
+// platform admins.
+func (h *AnalyticsHandler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	to := time.Now().UTC()
+	if t, err := parseTimeParam(query.Get("to")); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid to date")
+		return
+	} else if t != nil {
+		to = t.UTC()
+	}
+
+	from := to.AddDate(0, 0, -6)
+	if t, err := parseTimeParam(query.Get("from")); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid from date")
+		return
+	} else if t != nil {
+		from = t.UTC()
+	}
+
+	if from.After(to) {
+		response.Error(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+	if to.Sub(from) > webhookMetricsTTL {
+		response.Error(w, http.StatusBadRequest, "Date range cannot exceed 90 days")
+		return
+	}
+
+	pipe := h.redis.Pipeline()
+	var days []*redis.MapStringStringCmd
+	for day := from.Truncate(24 * time.Hour); !day.After(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, pipe.HGetAll(r.Context(), webhookMetricsKey(day)))
+	}
+	if _, err := pipe.Exec(r.Context()); err != nil && err != redis.Nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch webhook metrics")
+		return
+	}
+
+	counters := make([]map[string]string, 0, len(days))
+	for _, day := range days {
+		counters = append(counters, day.Val())
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"from":      from,
+		"to":        to,
+		"providers": aggregateWebhookMetrics(counters),
+	})
+}
+
+// aggregateWebhookMetrics sums daily "provider|eventType|outcome" counters
+// into per-provider totals, sorted by provider
+func aggregateWebhookMetrics(days []map[string]string) []*models.WebhookProviderMetrics {
+	byProvider := make(map[string]*models.WebhookProviderMetrics)
+	for _, counters := range days {
+		for field, value := range counters {
+			parts := strings.SplitN(field, "|", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			count, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			provider, eventType, outcome := parts[0], parts[1], parts[2]
+
+			metrics, ok := byProvider[provider]
+			if !ok {
+				metrics = &models.WebhookProviderMetrics{
+					Provider:   provider,
+					EventTypes: make(map[string]*models.WebhookEventCounts),
+				}
+				byProvider[provider] = metrics
+			}
+			eventCounts, ok := metrics.EventTypes[eventType]
+			if !ok {
+				eventCounts = &models.WebhookEventCounts{}
+				metrics.EventTypes[eventType] = eventCounts
+			}
+
+			addWebhookCount(&metrics.WebhookEventCounts, outcome, count)
+			addWebhookCount(eventCounts, outcome, count)
+		}
+	}
+
+	providers := make([]*models.WebhookProviderMetrics, 0, len(byProvider))
+	for _, metrics := range byProvider {
+		providers = append(providers, metrics)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Provider < providers[j].Provider
+	})
+	return providers
+}
+
+func addWebhookCount(counts *models.WebhookEventCounts, outcome string, n int64) {
+	switch outcome {
+	case webhookReceived:
+		counts.Received += n
+	case webhookQueued:
+		counts.Queued += n
+	case webhookFiltered:
+		counts.Filtered += n
+	case webhookSkipped:
+		counts.Skipped += n
+	case webhookInvalid:
+		counts.Invalid += n
+	case webhookDropped:
+		counts.Dropped += n
+	case webhookUnrouted:
+		counts.Unrouted += n
+	}
+}
+
+const (
+	analyticsCacheTTL          = 5 * time.Minute
+	analyticsRecomputeInterval = time.Minute
+)
+
+// agentCacheKey names a cached analytics entry of the agent's current
+// generation, so entries cached before a write to the agent's interactions
+// or escalations are never served. ok is false when the generation can't be
+// read and the entry should not be cached.
+func (h *AnalyticsHandler) agentCacheKey(ctx context.Context, agentID uuid.UUID, entry string) (key string, ok bool) {
+	gen, err := analytics.Generation(ctx, h.redis, agentID)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("analytics:%s:%s:%s", agentID, gen, entry), true
+}
+
+// overviewMetrics returns an agent's overview metrics from cache, computing and
+// caching them on a miss
+func (h *AnalyticsHandler) overviewMetrics(ctx context.Context, agentID uuid.UUID, interactionType string) (*models.OverviewMetrics, error) {
+	key, cacheable := h.agentCacheKey(ctx, agentID, "overview:"+interactionType)
+
+	metrics := &models.OverviewMetrics{}
+	if cacheable && h.getCached(ctx, key, metrics) {
+		return metrics, nil
+	}
+
+	metrics, err := h.repos.Interaction.GetOverviewMetrics(ctx, agentID, interactionType)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheable {
+		h.setCached(ctx, key, metrics)
+	}
+	return metrics, nil
+}
+
+// trends returns an agent's daily trends from cache, computing and caching them on a miss
+func (h *AnalyticsHandler) trends(ctx context.Context, agentID uuid.UUID, days int, interactionType string) ([]*models.TrendData, error) {
+	key, cacheable := h.agentCacheKey(ctx, agentID, fmt.Sprintf("trends:%d:%s", days, interactionType))
+
+	var trends []*models.TrendData
+	if cacheable && h.getCached(ctx, key, &trends) {
+		return trends, nil
+	}
+
+	trends, err := h.repos.Interaction.GetTrends(ctx, agentID, days, interactionType)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheable {
+		h.setCached(ctx, key, trends)
+	}
+	return trends, nil
+}
+
+func (h *AnalyticsHandler) getCached(ctx context.Context, key string, dest interface{}) bool {
+	data, err := h.redis.Get(ctx, key).Bytes()
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, dest) == nil
+}
+
+func (h *AnalyticsHandler) setCached(ctx context.Context, key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	h.redis.Set(ctx, key, data, analyticsCacheTTL)
+}
+
+// invalidateAgentAnalytics drops the agent's cached analytics after a write
+// to its interactions or escalations. A failure is only logged; the write has
+// already happened and the stale entries expire with analyticsCacheTTL.
+func invalidateAgentAnalytics(ctx context.Context, rdb *redis.Client, agentID uuid.UUID) {
+	if err := analytics.Invalidate(context.WithoutCancel(ctx), rdb, agentID); err != nil {
+		log.Warn().Err(err).Str("agent_id", agentID.String()).Msg("Failed to invalidate cached analytics")
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/repository"
+)
+
+// writeAudit stamps entry with the caller's address and user agent and
+// stores it. Failures are logged so the audited action itself still succeeds.
+func writeAudit(r *http.Request, repos *repository.Repositories, entry *models.AuditLog) {
+	entry.ID = uuid.New()
+	if ip := clientIP(r); ip != "" {
+		entry.IPAddress = &ip
+	}
+	if ua := r.UserAgent(); ua != "" {
+		entry.UserAgent = &ua
+	}
+
+	if err := repos.Audit.Create(r.Context(), entry); err != nil {
+		log.Error().Err(err).Str("action", entry.Action).Msg("Failed to write audit log")
+	}
+}
+
+// clientIP returns the request's remote IP without the port, or "" when it
+// cannot be parsed
+func clientIP(r *http.Request) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if net.ParseIP(host) == nil {
+		return ""
+	}
+	return host
+}
@@ -2,33 +2,48 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/middleware"
 	"github.com/vibber/backend/internal/models"
 	"github.com/vibber/backend/internal/repository"
 	"github.com/vibber/backend/pkg/response"
 )
 
 type AuthHandler struct {
-	repos *repository.Repositories
-	redis *redis.Client
-	cfg   *config.Config
+	repos         *repository.Repositories
+	redis         *redis.Client
+	cfg           *config.Config
+	blacklist     *middleware.TokenBlacklist
+	refreshTokens *refreshTokenFamilies
+	google        loginProvider
+	github        loginProvider
 }
 
 func NewAuthHandler(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *AuthHandler {
 	return &AuthHandler{
-		repos: repos,
-		redis: redis,
-		cfg:   cfg,
+		repos:         repos,
+		redis:         redis,
+		cfg:           cfg,
+		blacklist:     middleware.NewTokenBlacklist(redis, cfg.TokenBlacklistFailOpen),
+		refreshTokens: newRefreshTokenFamilies(redis, time.Duration(cfg.RefreshExpiryHours)*time.Hour),
+		google:        googleLogin,
+		github:        githubLogin,
 	}
 }
 
@@ -40,24 +55,40 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user, err := h.repos.User.GetByEmail(r.Context(), req.Email)
-	if err != nil {
+	if isNotFound(err) {
 		response.Error(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
 		response.Error(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
+	h.upgradePasswordHash(r.Context(), user, req.Password)
+
+	deviceID := requestDeviceID(r, req.DeviceID)
+	if err := models.ValidateDeviceID(deviceID); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	session, err := h.startSession(r.Context(), user, r.UserAgent(), deviceID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to start session")
+		return
+	}
 
 	// Generate tokens
-	accessToken, err := h.generateAccessToken(user)
+	accessToken, err := h.generateAccessToken(user, session.ID)
 	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	refreshToken, err := h.generateRefreshToken(user)
+	refreshToken, err := h.issueRefreshToken(r.Context(), user, session.ID)
 	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to generate refresh token")
 		return
@@ -74,6 +105,28 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// upgradePasswordHash rehashes a just-verified password when its stored hash
+// uses a lower cost than configured, so raising BCRYPT_COST strengthens
+// existing accounts as users log in. Failures are logged; the old hash still
+// works.
+func (h *AuthHandler) upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	cost, err := bcrypt.Cost([]byte(user.PasswordHash))
+	if err != nil || cost >= h.cfg.BcryptCost {
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+	if err != nil {
+		log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to rehash password")
+		return
+	}
+	if err := h.repos.User.UpdatePasswordHash(ctx, user.ID, string(hash)); err != nil {
+		log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to store rehashed password")
+		return
+	}
+	user.PasswordHash = string(hash)
+}
+
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req models.RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -81,15 +134,25 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.checkSignup(w, r, &req) {
+		return
+	}
+	if err := models.ValidateDeviceID(requestDeviceID(r, "")); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Check if user exists
-	existing, _ := h.repos.User.GetByEmail(r.Context(), req.Email)
-	if existing != nil {
+	if _, err := h.repos.User.GetByEmail(r.Context(), req.Email); err == nil {
 		response.Error(w, http.StatusConflict, "Email already registered")
 		return
+	} else if !isNotFound(err) {
+		response.Error(w, http.StatusInternalServerError, "Failed to create user")
+		return
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), h.cfg.BcryptCost)
 	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to process password")
 		return
@@ -103,11 +166,6 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Plan: "starter",
 	}
 
-	if err := h.repos.Organization.Create(r.Context(), org); err != nil {
-		response.Error(w, http.StatusInternalServerError, "Failed to create organization")
-		return
-	}
-
 	// Create user
 	user := &models.User{
 		ID:           uuid.New(),
@@ -118,14 +176,26 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Role:         "admin",
 	}
 
-	if err := h.repos.User.Create(r.Context(), user); err != nil {
+	// The organization, user and membership are created together; a
+	// concurrent signup that won the race for the email gets a 409
+	if err := h.repos.User.CreateWithOrganization(r.Context(), org, user); err != nil {
+		if errors.Is(err, repository.ErrEmailTaken) {
+			response.Error(w, http.StatusConflict, "Email already registered")
+			return
+		}
 		response.Error(w, http.StatusInternalServerError, "Failed to create user")
 		return
 	}
 
+	session, err := h.startSession(r.Context(), user, r.UserAgent(), requestDeviceID(r, ""))
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to start session")
+		return
+	}
+
 	// Generate tokens
-	accessToken, _ := h.generateAccessToken(user)
-	refreshToken, _ := h.generateRefreshToken(user)
+	accessToken, _ := h.generateAccessToken(user, session.ID)
+	refreshToken, _ := h.issueRefreshToken(r.Context(), user, session.ID)
 
 	response.JSON(w, http.StatusCreated, models.AuthResponse{
 		User:         user,
@@ -135,9 +205,94 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// signupRejections maps SignupPolicy reasons to responses
+var signupRejections = map[string]struct {
+	status  int
+	message string
+}{
+	models.SignupEmailInvalid:     {http.StatusBadRequest, "A valid email is required"},
+	models.SignupDomainNotAllowed: {http.StatusForbidden, "Registration is not open to this email domain"},
+	models.SignupDomainBlocked:    {http.StatusForbidden, "Registration is not open to this email domain"},
+	models.SignupDisposableEmail:  {http.StatusBadRequest, "Disposable email addresses are not accepted"},
+}
+
+// checkSignup applies the registration email policy and, when configured,
+// verifies the request's hCaptcha token, writing the response if the signup
+// is rejected
+func (h *AuthHandler) checkSignup(w http.ResponseWriter, r *http.Request, req *models.RegisterRequest) bool {
+	if reason := h.signupPolicy().Check(req.Email); reason != "" {
+		rejection := signupRejections[reason]
+		log.Info().Str("reason", reason).Str("ip", r.RemoteAddr).Msg("Registration rejected")
+		response.Error(w, rejection.status, rejection.message)
+		return false
+	}
+
+	if h.cfg.HCaptchaSecret == "" {
+		return true
+	}
+	if req.CaptchaToken == "" {
+		response.Error(w, http.StatusBadRequest, "captchaToken is required")
+		return false
+	}
+	ok, err := verifyHCaptcha(r.Context(), h.cfg.HCaptchaVerifyURL, h.cfg.HCaptchaSecret, req.CaptchaToken, r.RemoteAddr)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to verify hCaptcha token")
+		response.Error(w, http.StatusServiceUnavailable, "Captcha verification unavailable")
+		return false
+	}
+	if !ok {
+		response.Error(w, http.StatusBadRequest, "Captcha verification failed")
+		return false
+	}
+	return true
+}
+
+// signupPolicy is the configured registration email policy
+func (h *AuthHandler) signupPolicy() *models.SignupPolicy {
+	return &models.SignupPolicy{
+		Allowed:    h.cfg.SignupAllowedDomains,
+		Blocked:    h.cfg.SignupBlockedDomains,
+		Disposable: h.cfg.DisposableEmailDomains,
+	}
+}
+
+// verifyHCaptcha checks a client's hCaptcha token with the siteverify API
+func verifyHCaptcha(ctx context.Context, verifyURL, secret, token, remoteIP string) (bool, error) {
+	form := url.Values{
+		"secret":   {secret},
+		"response": {token},
+		"remoteip": {remoteIP},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("invalid siteverify response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if !result.Success {
+		log.Info().Strs("error_codes", result.ErrorCodes).Msg("hCaptcha token rejected")
+	}
+	return result.Success, nil
+}
+
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		RefreshToken string `json:"refreshToken"`
+		DeviceID     string `json:"deviceId"` // Used when the X-Device-ID header is absent
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.Error(w, http.StatusBadRequest, "Invalid request body")
@@ -146,6 +301,9 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 
 	// Validate refresh token
 	token, err := jwt.Parse(req.RefreshToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
 		return []byte(h.cfg.JWTSecret), nil
 	})
 	if err != nil || !token.Valid {
@@ -153,53 +311,413 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
-	userID, _ := uuid.Parse(claims["sub"].(string))
+	// Access tokens are signed with the same secret and must not refresh
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || stringClaim(claims, "type") != "refresh" {
+		response.Error(w, http.StatusUnauthorized, "Token is not a refresh token")
+		return
+	}
+	userID, err := uuid.Parse(stringClaim(claims, "sub"))
+	if err != nil {
+		response.Error(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
 
 	user, err := h.repos.User.GetByID(r.Context(), userID)
-	if err != nil {
+	if isNotFound(err) {
 		response.Error(w, http.StatusUnauthorized, "User not found")
 		return
 	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+
+	// The token must belong to a live session on the requesting device and
+	// predate no "log out everywhere"
+	sessionID, err := uuid.Parse(stringClaim(claims, "sid"))
+	if err != nil {
+		response.Error(w, http.StatusUnauthorized, "Refresh token is not bound to a session")
+		return
+	}
+	if epoch, ok := claims["epoch"].(float64); !ok || int(epoch) != user.TokenEpoch {
+		response.Error(w, http.StatusUnauthorized, "Session has been revoked")
+		return
+	}
+	session, err := h.repos.Session.GetByID(r.Context(), sessionID)
+	if err != nil && !isNotFound(err) {
+		response.Error(w, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+	if err != nil || session.UserID != user.ID || !session.Active(time.Now()) {
+		response.Error(w, http.StatusUnauthorized, "Session has been revoked")
+		return
+	}
+	if !session.MatchesDevice(r.UserAgent(), requestDeviceID(r, req.DeviceID)) {
+		response.Error(w, http.StatusUnauthorized, "Refresh token was issued to another device")
+		return
+	}
+	if err := h.repos.Session.Touch(r.Context(), session.ID); err != nil {
+		log.Warn().Err(err).Str("session_id", session.ID.String()).Msg("Failed to record session use")
+	}
+
+	// Keep the organization that was active when the refresh token was issued
+	if orgIDStr, ok := claims["orgId"].(string); ok {
+		if orgID, err := uuid.Parse(orgIDStr); err == nil && orgID != user.OrgID {
+			membership, err := h.repos.Membership.Get(r.Context(), user.ID, orgID)
+			if isNotFound(err) {
+				response.Error(w, http.StatusUnauthorized, "Organization membership not found")
+				return
+			}
+			if err != nil {
+				response.Error(w, http.StatusInternalServerError, "Failed to refresh token")
+				return
+			}
+			user.OrgID = membership.OrgID
+			user.Role = membership.Role
+		}
+	}
 
-	// Generate new access token
-	accessToken, _ := h.generateAccessToken(user)
+	// Rotate the refresh token. One that was already rotated out has leaked,
+	// so the session is revoked for both whoever replayed it and its owner.
+	jti := uuid.NewString()
+	current, err := h.refreshTokens.Rotate(r.Context(), user.ID, session.ID, stringClaim(claims, "jti"), jti)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+	if !current {
+		log.Warn().Str("user_id", user.ID.String()).Str("session_id", session.ID.String()).Msg("Refresh token reuse detected, revoking session")
+		if _, err := h.repos.Session.Revoke(r.Context(), session.ID, user.ID); err != nil {
+			log.Error().Err(err).Str("session_id", session.ID.String()).Msg("Failed to revoke session")
+		}
+		if err := h.refreshTokens.Revoke(r.Context(), user.ID, session.ID); err != nil {
+			log.Error().Err(err).Str("session_id", session.ID.String()).Msg("Failed to revoke refresh token family")
+		}
+		response.Error(w, http.StatusUnauthorized, "Refresh token reuse detected")
+		return
+	}
+
+	accessToken, err := h.generateAccessToken(user, session.ID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	refreshToken, err := h.generateRefreshToken(user, session.ID, jti)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to generate refresh token")
+		return
+	}
 
 	response.JSON(w, http.StatusOK, map[string]interface{}{
-		"accessToken": accessToken,
-		"expiresIn":   h.cfg.JWTExpiryMinutes * 60,
+		"accessToken":  accessToken,
+		"refreshToken": refreshToken,
+		"expiresIn":    h.cfg.JWTExpiryMinutes * 60,
 	})
 }
 
+// Logout revokes the access token it was called with and the session it
+// belongs to, so neither it nor the session's refresh token work anymore.
+// Other devices stay logged in.
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	// In a production system, you would blacklist the token in Redis
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if err := h.revokeAccessToken(r); err != nil {
+		log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to revoke access token")
+		response.Error(w, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+
+	if sessionID, ok := r.Context().Value("sessionID").(uuid.UUID); ok {
+		if _, err := h.repos.Session.Revoke(r.Context(), sessionID, userID); err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+	}
+
 	response.JSON(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
 }
 
+// LogoutAll invalidates every refresh token the user holds, on every device,
+// and the access token it was called with. Other devices' access tokens stay
+// valid until they expire.
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if err := h.repos.User.BumpTokenEpoch(r.Context(), userID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+	if err := h.revokeAccessToken(r); err != nil {
+		log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to revoke access token")
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Logged out on all devices"})
+}
+
+// revokeAccessToken blacklists the access token the request was made with.
+// Tokens without a jti predate revocation and are left to expire.
+func (h *AuthHandler) revokeAccessToken(r *http.Request) error {
+	jti, ok := r.Context().Value("tokenID").(string)
+	if !ok {
+		return nil
+	}
+	expiresAt, _ := r.Context().Value("tokenExpiresAt").(time.Time)
+	return h.blacklist.Revoke(r.Context(), jti, expiresAt)
+}
+
+// ListSessions returns the user's active sessions, marking the one the
+// request was made from
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	current, _ := r.Context().Value("sessionID").(uuid.UUID)
+
+	sessions, err := h.repos.Session.ListActiveByUserID(r.Context(), userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch sessions")
+		return
+	}
+	for _, session := range sessions {
+		session.Current = session.ID == current
+	}
+
+	response.JSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession logs one of the user's devices out
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "sessionID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	revoked, err := h.repos.Session.Revoke(r.Context(), sessionID, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+	if !revoked {
+		response.Error(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Session revoked"})
+}
+
+// Introspect reports whether a token is active and returns its claims.
+// Internal services presenting the X-Service-Key may introspect any token;
+// users may only introspect their own, authenticating with a bearer token.
+func (h *AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Token == "" {
+		response.Error(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	result := introspectToken(req.Token, h.cfg.JWTSecret)
+
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Service-Key")), []byte(h.cfg.InternalServiceKey)) != 1 {
+		bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		caller := introspectToken(bearer, h.cfg.JWTSecret)
+		if !found || !caller.Active || caller.TokenType != "access" {
+			response.Error(w, http.StatusUnauthorized, "Service key or bearer token required")
+			return
+		}
+		if caller.Sub != result.Sub {
+			response.Error(w, http.StatusForbidden, "Tokens can only be introspected by their owner")
+			return
+		}
+	}
+
+	// A token stops being accepted once its user leaves the organization
+	if result.Active {
+		userID, _ := uuid.Parse(result.Sub)
+		orgID, _ := uuid.Parse(result.OrgID)
+		_, err := h.repos.Membership.Get(r.Context(), userID, orgID)
+		if isNotFound(err) {
+			result.Active = false
+			result.Reason = models.TokenMembershipRevoked
+		} else if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to check organization membership")
+			return
+		}
+	}
+
+	response.JSON(w, http.StatusOK, result)
+}
+
+// introspectToken validates tokenString as JWTAuth does and describes it.
+// Claims are only reported when the signature is valid.
+func introspectToken(tokenString, secret string) *models.TokenIntrospection {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(secret), nil
+	})
+
+	result := &models.TokenIntrospection{}
+	switch {
+	case err == nil && token.Valid:
+		result.Active = true
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		result.Reason = models.TokenMalformed
+		return result
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		result.Reason = models.TokenInvalidSignature
+		return result
+	case errors.Is(err, jwt.ErrTokenExpired):
+		result.Reason = models.TokenExpired
+	default:
+		result.Reason = models.TokenInvalid
+		return result
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	result.Sub, _ = claims["sub"].(string)
+	result.OrgID, _ = claims["orgId"].(string)
+	result.Role, _ = claims["role"].(string)
+	result.Email, _ = claims["email"].(string)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		result.Exp = exp.Unix()
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		result.Iat = iat.Unix()
+	}
+	result.TokenType = "access"
+	if claims["type"] == "refresh" {
+		result.TokenType = "refresh"
+	}
+
+	// Tokens missing the identity JWTAuth relies on are never accepted
+	if _, err := uuid.Parse(result.Sub); err != nil && result.Active {
+		result.Active, result.Reason = false, models.TokenInvalid
+	} else if _, err := uuid.Parse(result.OrgID); err != nil && result.Active {
+		result.Active, result.Reason = false, models.TokenInvalid
+	}
+	return result
+}
+
 func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(uuid.UUID)
 
 	user, err := h.repos.User.GetByID(r.Context(), userID)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "User not found")
+		respondLookupError(w, err, "User not found")
 		return
 	}
 
 	response.JSON(w, http.StatusOK, user)
 }
 
+// ListOrganizations returns every organization the user belongs to
+func (h *AuthHandler) ListOrganizations(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	activeOrgID := r.Context().Value("orgID").(uuid.UUID)
+
+	memberships, err := h.repos.Membership.ListByUserID(r.Context(), userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch organizations")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"organizations": memberships,
+		"activeOrgId":   activeOrgID,
+	})
+}
+
+// SwitchOrg re-issues tokens scoped to another organization the user belongs to
+func (h *AuthHandler) SwitchOrg(w http.ResponseWriter, r *http.Request) {
+	orgID, err := uuid.Parse(chi.URLParam(r, "orgID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid organization ID")
+		return
+	}
+
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	membership, err := h.repos.Membership.Get(r.Context(), userID, orgID)
+	if isNotFound(err) {
+		response.Error(w, http.StatusForbidden, "Not a member of this organization")
+		return
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to switch organization")
+		return
+	}
+
+	user, err := h.repos.User.GetByID(r.Context(), userID)
+	if err != nil {
+		respondLookupError(w, err, "User not found")
+		return
+	}
+
+	// Tokens carry the active organization and the role held in it
+	user.OrgID = membership.OrgID
+	user.Role = membership.Role
+
+	// Switching stays within the device's session; tokens from before
+	// sessions existed get one
+	sessionID, ok := r.Context().Value("sessionID").(uuid.UUID)
+	if !ok {
+		session, err := h.startSession(r.Context(), user, r.UserAgent(), requestDeviceID(r, ""))
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to start session")
+			return
+		}
+		sessionID = session.ID
+	}
+
+	accessToken, err := h.generateAccessToken(user, sessionID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	refreshToken, err := h.issueRefreshToken(r.Context(), user, sessionID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to generate refresh token")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, models.AuthResponse{
+		User:         user,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    h.cfg.JWTExpiryMinutes * 60,
+	})
+}
+
 func (h *AuthHandler) OAuthRedirect(w http.ResponseWriter, r *http.Request) {
 	provider := chi.URLParam(r, "provider")
 
+	if provider != "google" && provider != "github" {
+		response.Error(w, http.StatusBadRequest, "Unsupported provider")
+		return
+	}
+
+	state, err := h.startOAuthLogin(w, r, provider)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to start OAuth sign-in")
+		return
+	}
+
 	var authURL string
 	switch provider {
 	case "google":
-		authURL = h.getGoogleAuthURL()
+		authURL = h.getGoogleAuthURL(state)
 	case "github":
-		authURL = h.getGitHubAuthURL()
-	default:
-		response.Error(w, http.StatusBadRequest, "Unsupported provider")
-		return
+		authURL = h.getGitHubAuthURL(state)
 	}
 
 	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
@@ -214,6 +732,12 @@ func (h *AuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only finish sign-ins this browser started, before spending the code
+	if !h.checkOAuthLoginState(w, r, provider) {
+		response.Error(w, http.StatusBadRequest, "Invalid OAuth state")
+		return
+	}
+
 	var user *models.User
 	var err error
 
@@ -227,23 +751,64 @@ func (h *AuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var loginErr *oauthLoginError
+	if errors.As(err, &loginErr) {
+		response.Error(w, loginErr.status, loginErr.message)
+		return
+	}
 	if err != nil {
+		log.Error().Err(err).Str("provider", provider).Msg("OAuth sign-in failed")
 		response.Error(w, http.StatusInternalServerError, "OAuth authentication failed")
 		return
 	}
 
+	// The redirect carries no device ID, so the session is bound by user agent
+	session, err := h.startSession(r.Context(), user, r.UserAgent(), "")
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to start session")
+		return
+	}
+
 	// Generate tokens
-	accessToken, _ := h.generateAccessToken(user)
-	refreshToken, _ := h.generateRefreshToken(user)
+	accessToken, _ := h.generateAccessToken(user, session.ID)
+	refreshToken, _ := h.issueRefreshToken(r.Context(), user, session.ID)
 
 	// Redirect to frontend with tokens
 	redirectURL := h.cfg.FrontendURL + "/auth/callback?access_token=" + accessToken + "&refresh_token=" + refreshToken
 	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
 }
 
-func (h *AuthHandler) generateAccessToken(user *models.User) (string, error) {
+// requestDeviceID returns the device ID from the X-Device-ID header, or
+// fallback (read from the request body) when the header is absent
+func requestDeviceID(r *http.Request, fallback string) string {
+	if deviceID := r.Header.Get(models.DeviceIDHeader); deviceID != "" {
+		return deviceID
+	}
+	return fallback
+}
+
+// startSession records a new session for the user on the device identified
+// by userAgent and deviceID, lasting as long as its refresh tokens
+func (h *AuthHandler) startSession(ctx context.Context, user *models.User, userAgent, deviceID string) (*models.Session, error) {
+	expiresAt := time.Now().Add(time.Duration(h.cfg.RefreshExpiryHours) * time.Hour)
+	session := models.NewSession(user.ID, userAgent, deviceID, expiresAt)
+	if err := h.repos.Session.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// stringClaim returns a string claim, or "" when it is missing or not a string
+func stringClaim(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func (h *AuthHandler) generateAccessToken(user *models.User, sessionID uuid.UUID) (string, error) {
 	claims := jwt.MapClaims{
 		"sub":   user.ID.String(),
+		"sid":   sessionID.String(),
+		"jti":   uuid.NewString(),
 		"email": user.Email,
 		"name":  user.Name,
 		"role":  user.Role,
@@ -256,40 +821,50 @@ func (h *AuthHandler) generateAccessToken(user *models.User) (string, error) {
 	return token.SignedString([]byte(h.cfg.JWTSecret))
 }
 
-func (h *AuthHandler) generateRefreshToken(user *models.User) (string, error) {
+// issueRefreshToken generates a refresh token for the session and makes it
+// the current token of the session's family
+func (h *AuthHandler) issueRefreshToken(ctx context.Context, user *models.User, sessionID uuid.UUID) (string, error) {
+	jti := uuid.NewString()
+	token, err := h.generateRefreshToken(user, sessionID, jti)
+	if err != nil {
+		return "", err
+	}
+	if err := h.refreshTokens.Start(ctx, user.ID, sessionID, jti); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// generateRefreshToken signs a refresh token bound to the session and the
+// user's current token epoch
+func (h *AuthHandler) generateRefreshToken(user *models.User, sessionID uuid.UUID, jti string) (string, error) {
 	claims := jwt.MapClaims{
-		"sub":  user.ID.String(),
-		"type": "refresh",
-		"exp":  time.Now().Add(time.Duration(h.cfg.RefreshExpiryHours) * time.Hour).Unix(),
-		"iat":  time.Now().Unix(),
+		"sub":   user.ID.String(),
+		"sid":   sessionID.String(),
+		"jti":   jti,
+		"epoch": user.TokenEpoch,
+		"type":  "refresh",
+		"orgId": user.OrgID.String(),
+		"exp":   time.Now().Add(time.Duration(h.cfg.RefreshExpiryHours) * time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(h.cfg.JWTSecret))
 }
 
-func (h *AuthHandler) getGoogleAuthURL() string {
-	return "https://accounts.google.com/o/oauth2/v2/auth?client_id=" + h.cfg.GoogleClientID +
-		"&redirect_uri=" + h.cfg.FrontendURL + "/api/v1/auth/oauth/google/callback" +
-		"&response_type=code&scope=email%20profile"
-}
-
-func (h *AuthHandler) getGitHubAuthURL() string {
-	return "https://github.com/login/oauth/authorize?client_id=" + h.cfg.GitHubClientID +
-		"&redirect_uri=" + h.cfg.FrontendURL + "/api/v1/auth/oauth/github/callback" +
-		"&scope=user:email"
-}
-
-func (h *AuthHandler) handleGoogleCallback(ctx context.Context, code string) (*models.User, error) {
-	// Implementation would exchange code for tokens and get user info
-	// This is a placeholder - actual implementation would use golang.org/x/oauth2
-	return nil, nil
+func (h *AuthHandler) getGoogleAuthURL(state string) string {
+	return h.google.AuthorizeURL + "?client_id=" + h.cfg.GoogleClientID +
+		"&redirect_uri=" + h.oauthRedirectURI("google") +
+		"&response_type=code&scope=openid%20email%20profile" +
+		"&state=" + state
 }
 
-func (h *AuthHandler) handleGitHubCallback(ctx context.Context, code string) (*models.User, error) {
-	// Implementation would exchange code for tokens and get user info
-	// This is a placeholder - actual implementation would use golang.org/x/oauth2
-	return nil, nil
+func (h *AuthHandler) getGitHubAuthURL(state string) string {
+	return h.github.AuthorizeURL + "?client_id=" + h.cfg.GitHubClientID +
+		"&redirect_uri=" + h.oauthRedirectURI("github") +
+		"&scope=user:email" +
+		"&state=" + state
 }
 
 func generateSlug(name string) string {
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vibber/backend/internal/models"
+)
+
+// credentialRejection is a provider refusing the stored credentials, as
+// opposed to the provider being unreachable or failing
+type credentialRejection struct {
+	message string
+}
+
+func (e *credentialRejection) Error() string {
+	return e.message
+}
+
+// verifyWithProvider tests credentials against the provider's API, reporting
+// whether the provider accepted them. A rejection is a *credentialRejection
+// saying why; other errors mean the provider could not be asked. Calls are
+// bounded by ctx and the verification client's timeout.
+func (h *CredentialsHandler) verifyWithProvider(ctx context.Context, cred *models.OrganizationCredential) (bool, error) {
+	endpoints, err := h.providerEndpoints(cred.Provider, cred.Config)
+	if err != nil {
+		return false, err
+	}
+
+	var verifyErr error
+	switch cred.Provider {
+	case "slack":
+		verifyErr = h.verifySlack(ctx, cred, endpoints)
+	case "github":
+		verifyErr = h.verifyBasicAuth(ctx, cred, endpoints.APIBaseURL+"/user")
+	case "jira":
+		myselfURL, err := jiraMyselfURL(cred, endpoints)
+		if err != nil {
+			return false, err
+		}
+		verifyErr = h.verifyBasicAuth(ctx, cred, myselfURL)
+	default:
+		return false, fmt.Errorf("verification is not supported for %s", cred.Provider)
+	}
+	if verifyErr != nil {
+		return false, verifyErr
+	}
+	return true, nil
+}
+
+// verifySlack calls auth.test with the stored token. Slack answers 200 and
+// reports failures in the body.
+func (h *CredentialsHandler) verifySlack(ctx context.Context, cred *models.OrganizationCredential, endpoints models.ProviderEndpoints) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoints.APIBaseURL+"/auth.test", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+cred.ClientSecret)
+
+	resp, err := h.verifyClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("slack unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid slack response: %w", err)
+	}
+	if !result.OK {
+		return &credentialRejection{"slack rejected the credentials: " + result.Error}
+	}
+	return nil
+}
+
+// verifyBasicAuth reads endpoint with the client ID and secret as basic auth
+// credentials: a GitHub username and token, or a Jira account email and API
+// token. 401 and 403 are rejections.
+func (h *CredentialsHandler) verifyBasicAuth(ctx context.Context, cred *models.OrganizationCredential, endpoint string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(cred.ClientID, cred.ClientSecret)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.verifyClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s unreachable: %w", cred.Provider, err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return &credentialRejection{fmt.Sprintf("%s rejected the credentials (status %d)", cred.Provider, resp.StatusCode)}
+	default:
+		return fmt.Errorf("%s returned status %d", cred.Provider, resp.StatusCode)
+	}
+}
+
+// jiraMyselfURL is where the credential's Jira user is read. Data Center
+// instances serve the API at their own URL; Cloud sites take basic auth at
+// the site rather than at api.atlassian.com, so need a siteUrl configured.
+func jiraMyselfURL(cred *models.OrganizationCredential, endpoints models.ProviderEndpoints) (string, error) {
+	if !endpoints.IsCloud {
+		return endpoints.APIBaseURL + "/myself", nil
+	}
+
+	var cfg models.JiraCredentialConfig
+	if cred.Config != nil && *cred.Config != "" {
+		if err := json.Unmarshal([]byte(*cred.Config), &cfg); err != nil {
+			return "", fmt.Errorf("invalid jira config: %w", err)
+		}
+	}
+	site, err := url.Parse(strings.TrimSpace(cfg.SiteURL))
+	if err != nil || site.Scheme != "https" || site.Host == "" {
+		return "", fmt.Errorf("a Jira Cloud siteUrl is required to verify credentials")
+	}
+	return strings.TrimRight(site.Scheme+"://"+site.Host+site.Path, "/") + "/rest/api/3/myself", nil
+}
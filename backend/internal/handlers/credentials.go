@@ -1,30 +1,50 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/vibber/backend/internal/config"
 	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/ratelimit"
 	"github.com/vibber/backend/internal/repository"
 	"github.com/vibber/backend/pkg/response"
 )
 
+// credentialVerifyConcurrency bounds how many providers bulk verification
+// checks at once
+const credentialVerifyConcurrency = 4
+
 type CredentialsHandler struct {
-	repos *repository.Repositories
-	redis *redis.Client
-	cfg   *config.Config
+	repos   *repository.Repositories
+	redis   *redis.Client
+	cfg     *config.Config
+	limiter *ratelimit.Limiter
+
+	// Calls to providers verifying credentials, and where those providers are
+	verifyClient      *http.Client
+	providerEndpoints func(provider string, config *string) (models.ProviderEndpoints, error)
 }
 
 func NewCredentialsHandler(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *CredentialsHandler {
 	return &CredentialsHandler{
-		repos: repos,
-		redis: redis,
-		cfg:   cfg,
+		repos:   repos,
+		redis:   redis,
+		cfg:     cfg,
+		limiter: ratelimit.NewLimiter(redis, cfg),
+
+		verifyClient:      &http.Client{Timeout: time.Duration(cfg.CredentialVerifyTimeoutSeconds) * time.Second},
+		providerEndpoints: models.ResolveProviderEndpoints,
 	}
 }
 
@@ -49,6 +69,8 @@ func (h *CredentialsHandler) List(w http.ResponseWriter, r *http.Request) {
 			Config:     cred.Config,
 			IsActive:   cred.IsActive,
 			VerifiedAt: cred.VerifiedAt,
+			CreatedBy:  cred.CreatedBy,
+			UpdatedBy:  cred.UpdatedBy,
 			CreatedAt:  cred.CreatedAt,
 			UpdatedAt:  cred.UpdatedAt,
 		}
@@ -68,11 +90,18 @@ func (h *CredentialsHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := models.ValidateProviderConfig(req.Provider, req.Config); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Check if credentials already exist for this provider
-	existing, _ := h.repos.Credential.GetByOrgAndProvider(r.Context(), orgID, req.Provider)
-	if existing != nil {
+	if _, err := h.repos.Credential.GetByOrgAndProvider(r.Context(), orgID, req.Provider); err == nil {
 		response.Error(w, http.StatusConflict, "Credentials already exist for this provider. Use PUT to update.")
 		return
+	} else if !isNotFound(err) {
+		response.Error(w, http.StatusInternalServerError, "Failed to create credentials")
+		return
 	}
 
 	credential := &models.OrganizationCredential{
@@ -86,6 +115,7 @@ func (h *CredentialsHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Config:        req.Config,
 		IsActive:      true,
 		CreatedBy:     &userID,
+		UpdatedBy:     &userID,
 	}
 
 	if err := h.repos.Credential.Create(r.Context(), credential); err != nil {
@@ -102,6 +132,8 @@ func (h *CredentialsHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Config:     credential.Config,
 		IsActive:   credential.IsActive,
 		VerifiedAt: credential.VerifiedAt,
+		CreatedBy:  credential.CreatedBy,
+		UpdatedBy:  credential.UpdatedBy,
 		CreatedAt:  credential.CreatedAt,
 		UpdatedAt:  credential.UpdatedAt,
 	})
@@ -114,7 +146,7 @@ func (h *CredentialsHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	credential, err := h.repos.Credential.GetByOrgAndProvider(r.Context(), orgID, provider)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Credentials not found")
+		respondLookupError(w, err, "Credentials not found")
 		return
 	}
 
@@ -126,6 +158,8 @@ func (h *CredentialsHandler) Get(w http.ResponseWriter, r *http.Request) {
 		Config:     credential.Config,
 		IsActive:   credential.IsActive,
 		VerifiedAt: credential.VerifiedAt,
+		CreatedBy:  credential.CreatedBy,
+		UpdatedBy:  credential.UpdatedBy,
 		CreatedAt:  credential.CreatedAt,
 		UpdatedAt:  credential.UpdatedAt,
 	})
@@ -134,11 +168,12 @@ func (h *CredentialsHandler) Get(w http.ResponseWriter, r *http.Request) {
 // Update modifies existing credentials
 func (h *CredentialsHandler) Update(w http.ResponseWriter, r *http.Request) {
 	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
 	provider := chi.URLParam(r, "provider")
 
 	credential, err := h.repos.Credential.GetByOrgAndProvider(r.Context(), orgID, provider)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Credentials not found")
+		respondLookupError(w, err, "Credentials not found")
 		return
 	}
 
@@ -162,6 +197,10 @@ func (h *CredentialsHandler) Update(w http.ResponseWriter, r *http.Request) {
 		credential.SigningSecret = req.SigningSecret
 	}
 	if req.Config != nil {
+		if err := models.ValidateProviderConfig(credential.Provider, req.Config); err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		credential.Config = req.Config
 	}
 	if req.IsActive != nil {
@@ -172,6 +211,7 @@ func (h *CredentialsHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.ClientID != nil || req.ClientSecret != nil {
 		credential.VerifiedAt = nil
 	}
+	credential.UpdatedBy = &userID
 
 	if err := h.repos.Credential.Update(r.Context(), credential); err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to update credentials")
@@ -186,6 +226,8 @@ func (h *CredentialsHandler) Update(w http.ResponseWriter, r *http.Request) {
 		Config:     credential.Config,
 		IsActive:   credential.IsActive,
 		VerifiedAt: credential.VerifiedAt,
+		CreatedBy:  credential.CreatedBy,
+		UpdatedBy:  credential.UpdatedBy,
 		CreatedAt:  credential.CreatedAt,
 		UpdatedAt:  credential.UpdatedAt,
 	})
@@ -198,7 +240,7 @@ func (h *CredentialsHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	credential, err := h.repos.Credential.GetByOrgAndProvider(r.Context(), orgID, provider)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Credentials not found")
+		respondLookupError(w, err, "Credentials not found")
 		return
 	}
 
@@ -217,14 +259,23 @@ func (h *CredentialsHandler) Verify(w http.ResponseWriter, r *http.Request) {
 
 	credential, err := h.repos.Credential.GetByOrgAndProvider(r.Context(), orgID, provider)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Credentials not found")
+		respondLookupError(w, err, "Credentials not found")
 		return
 	}
 
 	// Verify credentials with the provider's API
-	verified, verifyErr := h.verifyWithProvider(credential)
+	verified, verifyErr := h.verifyWithProvider(r.Context(), credential)
+	var rejection *credentialRejection
+	if errors.As(verifyErr, &rejection) {
+		response.JSON(w, http.StatusOK, map[string]interface{}{
+			"verified": false,
+			"provider": provider,
+			"error":    rejection.Error(),
+		})
+		return
+	}
 	if verifyErr != nil {
-		response.Error(w, http.StatusBadRequest, "Credential verification failed: "+verifyErr.Error())
+		response.Error(w, http.StatusBadGateway, "Credential verification failed: "+verifyErr.Error())
 		return
 	}
 
@@ -242,19 +293,110 @@ func (h *CredentialsHandler) Verify(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetForAgent returns full credentials for the AI agent (internal use)
-// This endpoint should only be accessible from the AI agent service
-func (h *CredentialsHandler) GetForAgent(w http.ResponseWriter, r *http.Request) {
-	// Verify internal service authentication
-	serviceKey := r.Header.Get("X-Service-Key")
-	if serviceKey != h.cfg.InternalServiceKey {
-		response.Error(w, http.StatusUnauthorized, "Invalid service key")
+// VerifyAll tests every active credential in the organization with its
+// provider, a few at a time, and returns the outcome per provider. Each check
+// is bounded by its own timeout and by the provider's rate limit, so a slow
+// or throttled provider only fails its own entry.
+func (h *CredentialsHandler) VerifyAll(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+
+	credentials, err := h.repos.Credential.ListByOrgID(r.Context(), orgID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch credentials")
+		return
+	}
+
+	var active []*models.OrganizationCredential
+	for _, cred := range credentials {
+		if cred.IsActive {
+			active = append(active, cred)
+		}
+	}
+
+	results := make([]models.CredentialVerification, len(active))
+	g, ctx := errgroup.WithContext(r.Context())
+	g.SetLimit(credentialVerifyConcurrency)
+	for i, cred := range active {
+		i, cred := i, cred
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			results[i] = h.verifyCredential(ctx, cred)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		// Only returned when the client went away; nobody is left to answer
 		return
 	}
 
+	byProvider := make(map[string]models.CredentialVerification, len(active))
+	for i, cred := range active {
+		byProvider[cred.Provider] = results[i]
+	}
+
+	response.JSON(w, http.StatusOK, byProvider)
+}
+
+// verifyCredential runs one check of a bulk verification, recording the
+// verification time when the provider accepts the credentials
+func (h *CredentialsHandler) verifyCredential(ctx context.Context, cred *models.OrganizationCredential) models.CredentialVerification {
+	result := models.CredentialVerification{VerifiedAt: cred.VerifiedAt}
+
+	// Verification calls share the provider's budget with the credential's
+	// other API calls
+	allowed, wait, err := h.limiter.Take(ctx, cred.Provider, cred.ID)
+	if err != nil {
+		log.Error().Err(err).Str("provider", cred.Provider).Msg("Failed to check provider rate limit")
+		result.Error = "Failed to check provider rate limit"
+		return result
+	}
+	if !allowed {
+		result.Error = "Provider rate limit reached"
+		result.RetryAfterSeconds = int(math.Ceil(wait.Seconds()))
+		return result
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, time.Duration(h.cfg.CredentialVerifyTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	verified, err := h.verifyWithProvider(checkCtx, cred)
+	if errors.Is(checkCtx.Err(), context.DeadlineExceeded) {
+		result.Error = "Verification timed out"
+		return result
+	}
+	if err != nil {
+		result.Error = "Credential verification failed: " + err.Error()
+		return result
+	}
+	if !verified {
+		return result
+	}
+
+	if err := h.repos.Credential.MarkVerified(ctx, cred.ID); err != nil {
+		log.Error().Err(err).Str("credential_id", cred.ID.String()).Msg("Failed to update verification status")
+		result.Error = "Failed to update verification status"
+		return result
+	}
+	now := time.Now()
+	result.Verified = true
+	result.VerifiedAt = &now
+	return result
+}
+
+// GetForAgent returns full credentials for the AI agent (internal use)
+// This endpoint should only be accessible from the AI agent service
+func (h *CredentialsHandler) GetForAgent(w http.ResponseWriter, r *http.Request) {
 	orgIDStr := r.URL.Query().Get("org_id")
 	provider := r.URL.Query().Get("provider")
 
+	// Org agent tokens may only read their own organization's credentials
+	serviceOrgID, scoped := r.Context().Value("serviceOrgID").(uuid.UUID)
+	if orgIDStr == "" && scoped {
+		orgIDStr = serviceOrgID.String()
+	}
+
 	if orgIDStr == "" || provider == "" {
 		response.Error(w, http.StatusBadRequest, "org_id and provider are required")
 		return
@@ -266,9 +408,14 @@ func (h *CredentialsHandler) GetForAgent(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if scoped && orgID != serviceOrgID {
+		response.Error(w, http.StatusForbidden, "Service key is not valid for this organization")
+		return
+	}
+
 	credential, err := h.repos.Credential.GetByOrgAndProvider(r.Context(), orgID, provider)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Credentials not found")
+		respondLookupError(w, err, "Credentials not found")
 		return
 	}
 
@@ -287,22 +434,3 @@ func (h *CredentialsHandler) GetForAgent(w http.ResponseWriter, r *http.Request)
 		Config:        credential.Config,
 	})
 }
-
-// verifyWithProvider tests credentials against the provider's API
-func (h *CredentialsHandler) verifyWithProvider(cred *models.OrganizationCredential) (bool, error) {
-	// Implementation would make API calls to verify credentials
-	// For now, return true (actual implementation would depend on each provider)
-	switch cred.Provider {
-	case "slack":
-		// Call Slack's auth.test API
-		return true, nil
-	case "github":
-		// Call GitHub's /user API
-		return true, nil
-	case "jira":
-		// Call Jira's /rest/api/3/myself API
-		return true, nil
-	default:
-		return true, nil
-	}
-}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vibber/backend/internal/repository"
+	"github.com/vibber/backend/pkg/response"
+)
+
+// isNotFound reports whether a repository lookup matched no rows
+func isNotFound(err error) bool {
+	return errors.Is(err, repository.ErrNotFound)
+}
+
+// respondLookupError writes a 404 with notFoundMessage when a lookup matched
+// nothing and a 500 for any other repository error, so a failing database is
+// never reported as a missing record
+func respondLookupError(w http.ResponseWriter, err error, notFoundMessage string) {
+	if isNotFound(err) {
+		response.Error(w, http.StatusNotFound, notFoundMessage)
+		return
+	}
+	response.Error(w, http.StatusInternalServerError, "Internal server error")
+}
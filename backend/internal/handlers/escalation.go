@@ -1,15 +1,22 @@
 package handlers
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 
 	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/feature"
+	"github.com/vibber/backend/internal/models"
 	"github.com/vibber/backend/internal/repository"
 	"github.com/vibber/backend/pkg/response"
 )
@@ -30,16 +37,28 @@ func NewEscalationHandler(repos *repository.Repositories, redis *redis.Client, c
 
 func (h *EscalationHandler) List(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(uuid.UUID)
-	agentIDStr := r.URL.Query().Get("agent_id")
+	query := r.URL.Query()
 
-	var escalations []*struct {
-		Escalation  interface{} `json:"escalation"`
-		Interaction interface{} `json:"interaction"`
-		AgentName   string      `json:"agentName"`
+	params, ok := parsePagination(w, r, h.cfg)
+	if !ok {
+		return
 	}
 
-	if agentIDStr != "" {
-		// Get escalations for specific agent
+	// The review queue: pending escalations unless another status is asked for
+	filter := models.EscalationFilter{Priority: query.Get("priority"), Status: query.Get("status"), Tag: query.Get("tag")}
+	if filter.Status == "" {
+		filter.Status = "pending"
+	}
+	if filter.Status != "pending" && filter.Status != "resolved" && filter.Status != "dismissed" && filter.Status != "expired" {
+		response.Error(w, http.StatusBadRequest, "Invalid status")
+		return
+	}
+	if filter.Priority != "" && filter.Priority != "low" && filter.Priority != "medium" && filter.Priority != "high" && filter.Priority != "urgent" {
+		response.Error(w, http.StatusBadRequest, "Invalid priority")
+		return
+	}
+
+	if agentIDStr := query.Get("agent_id"); agentIDStr != "" {
 		agentID, err := uuid.Parse(agentIDStr)
 		if err != nil {
 			response.Error(w, http.StatusBadRequest, "Invalid agent ID")
@@ -47,46 +66,209 @@ func (h *EscalationHandler) List(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Verify ownership
-		agent, err := h.repos.Agent.GetByID(r.Context(), agentID)
-		if err != nil || agent.UserID != userID {
-			response.Error(w, http.StatusForbidden, "Access denied")
+		if _, err := requireAgentOwnership(r.Context(), h.repos, agentID, userID); err != nil {
+			respondOwnershipError(w, err)
 			return
 		}
+		filter.AgentID = &agentID
+	}
 
-		pending, _ := h.repos.Escalation.ListPending(r.Context(), agentID)
-		for _, e := range pending {
-			interaction, _ := h.repos.Interaction.GetByID(r.Context(), e.InteractionID)
-			escalations = append(escalations, &struct {
-				Escalation  interface{} `json:"escalation"`
-				Interaction interface{} `json:"interaction"`
-				AgentName   string      `json:"agentName"`
-			}{
-				Escalation:  e,
-				Interaction: interaction,
-				AgentName:   agent.Name,
-			})
+	escalations, total, err := h.repos.Escalation.ListEscalationsWithInteractions(r.Context(), userID, filter, params)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch escalations")
+		return
+	}
+	if escalations == nil {
+		escalations = []*models.EscalationListItem{}
+	}
+
+	response.Paginated(w, escalations, params.Page, params.PageSize, total)
+}
+
+// ListResolvedForTraining returns resolved escalations with their
+// interactions as a training dataset for the AI service (internal use).
+// Pages run oldest resolution first from ?since=, following nextCursor.
+// Secrets and personal data are redacted, and organizations that turned off
+// the training_export flag are left out.
+func (h *EscalationHandler) ListResolvedForTraining(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var since *time.Time
+	if v := query.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "since must be an RFC3339 timestamp")
+			return
 		}
-	} else {
-		// Get escalations for all user's agents
-		agents, _ := h.repos.Agent.ListByUserID(r.Context(), userID)
-		for _, agent := range agents {
-			pending, _ := h.repos.Escalation.ListPending(r.Context(), agent.ID)
-			for _, e := range pending {
-				interaction, _ := h.repos.Interaction.GetByID(r.Context(), e.InteractionID)
-				escalations = append(escalations, &struct {
-					Escalation  interface{} `json:"escalation"`
-					Interaction interface{} `json:"interaction"`
-					AgentName   string      `json:"agentName"`
-				}{
-					Escalation:  e,
-					Interaction: interaction,
-					AgentName:   agent.Name,
-				})
+		since = &t
+	}
+
+	limit, ok := parsePageSize(w, r, "limit", h.cfg)
+	if !ok {
+		return
+	}
+
+	var after *models.EscalationCursor
+	if c := query.Get("cursor"); c != "" {
+		cursor, err := models.DecodeEscalationCursor(c)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		after = cursor
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	samples, err := h.repos.Escalation.ListResolvedAfter(r.Context(), since, after, feature.Defaults[feature.TrainingExport], limit+1)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch resolved escalations")
+		return
+	}
+
+	nextCursor := ""
+	if len(samples) > limit {
+		samples = samples[:limit]
+		last := samples[limit-1]
+		nextCursor = models.EscalationCursor{ResolvedAt: last.ResolvedAt, ID: last.EscalationID}.Encode()
+	}
+	if samples == nil {
+		samples = []*models.ResolvedEscalationSample{}
+	}
+	for _, sample := range samples {
+		sample.Redact()
+	}
+
+	response.CursorPaginated(w, samples, nextCursor)
+}
+
+// Export streams escalations with their interactions and resolver info as CSV or JSON
+func (h *EscalationHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		response.Error(w, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+
+	filter := models.EscalationExportFilter{Status: query.Get("status"), Tag: query.Get("tag")}
+	if filter.Status != "" && filter.Status != "pending" && filter.Status != "resolved" && filter.Status != "dismissed" && filter.Status != "expired" {
+		response.Error(w, http.StatusBadRequest, "Invalid status")
+		return
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query.Get("from")); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid from date")
+		return
+	}
+	if filter.To, err = parseTimeParam(query.Get("to")); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid to date")
+		return
+	}
+
+	agents, err := h.repos.Agent.ListByUserID(r.Context(), userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch agents")
+		return
+	}
+
+	agentIDs := make([]uuid.UUID, 0, len(agents))
+	for _, agent := range agents {
+		agentIDs = append(agentIDs, agent.ID)
+	}
+
+	// Headers go out with the first row, so a query failing before any row
+	// is read still gets a 500. A failure mid-stream aborts the response, so
+	// a truncated file is never mistaken for a complete one.
+	started := false
+	begin := func(contentType string) {
+		started = true
+		filename := "escalations-" + time.Now().Format("20060102") + "." + format
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+	}
+	fail := func(err error) {
+		log.Error().Err(err).Str("user_id", userID.String()).Bool("partial", started).Msg("Failed to export escalations")
+		if !started {
+			response.Error(w, http.StatusInternalServerError, "Failed to export escalations")
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		err := h.repos.Escalation.StreamForExport(r.Context(), agentIDs, filter, func(row *models.EscalationExport) error {
+			if started {
+				w.Write([]byte(","))
+			} else {
+				begin("application/json")
+				w.Write([]byte("["))
 			}
+			return encoder.Encode(row)
+		})
+		if err != nil {
+			fail(err)
+			return
 		}
+
+		if !started {
+			begin("application/json")
+			w.Write([]byte("["))
+		}
+		w.Write([]byte("]"))
+		return
+	}
+
+	writer := csv.NewWriter(w)
+	beginCSV := func() {
+		begin("text/csv")
+		writer.Write([]string{
+			"escalation_id", "agent_name", "interaction_id", "provider", "interaction_type",
+			"reason", "priority", "status", "resolution", "resolved_by", "resolved_at",
+			"resolution_seconds", "created_at", "input_data", "output_data", "tag",
+		})
+	}
+
+	err = h.repos.Escalation.StreamForExport(r.Context(), agentIDs, filter, func(row *models.EscalationExport) error {
+		if !started {
+			beginCSV()
+		}
+		e, i := row.Escalation, row.Interaction
+		return writer.Write([]string{
+			e.ID.String(),
+			row.AgentName,
+			e.InteractionID.String(),
+			i.Provider,
+			i.InteractionType,
+			e.Reason,
+			e.Priority,
+			e.Status,
+			stringValue(e.Resolution),
+			stringValue(row.ResolvedByName),
+			timeValue(e.ResolvedAt),
+			int64Value(row.ResolutionSeconds),
+			e.CreatedAt.Format(time.RFC3339),
+			i.InputData,
+			stringValue(i.OutputData),
+			stringValue(e.Tag),
+		})
+	})
+	if err != nil {
+		fail(err)
+		return
 	}
 
-	response.JSON(w, http.StatusOK, escalations)
+	if !started {
+		beginCSV()
+	}
+	writer.Flush()
 }
 
 func (h *EscalationHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -104,9 +286,9 @@ func (h *EscalationHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	// Verify ownership through agent
 	userID := r.Context().Value("userID").(uuid.UUID)
-	agent, _ := h.repos.Agent.GetByID(r.Context(), escalation.AgentID)
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
+	agent, err := requireAgentOwnership(r.Context(), h.repos, escalation.AgentID, userID)
+	if err != nil {
+		respondResourceOwnershipError(w, err, "Escalation not found")
 		return
 	}
 
@@ -136,9 +318,8 @@ func (h *EscalationHandler) Resolve(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify ownership
-	agent, _ := h.repos.Agent.GetByID(r.Context(), escalation.AgentID)
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
+	if _, err := requireAgentOwnership(r.Context(), h.repos, escalation.AgentID, userID); err != nil {
+		respondResourceOwnershipError(w, err, "Escalation not found")
 		return
 	}
 
@@ -151,25 +332,27 @@ func (h *EscalationHandler) Resolve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update escalation
-	now := time.Now()
-	escalation.Status = "resolved"
-	escalation.Resolution = &req.Resolution
-	escalation.ResolvedBy = &userID
-	escalation.ResolvedAt = &now
-
-	if err := h.repos.Escalation.Update(r.Context(), escalation); err != nil {
+	// A retried request returns the existing result without acting again
+	resolved, err := h.resolveOnce(r.Context(), escalation, req.Resolution, userID)
+	if errors.Is(err, errEscalationClosed) {
+		response.Error(w, http.StatusConflict, "Escalation is already "+escalation.Status)
+		return
+	}
+	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to resolve escalation")
 		return
 	}
 
 	// Execute the action if provided
-	if req.Action != "" {
+	if resolved && req.Action != "" {
 		// This would trigger the agent to execute the user's action
 		// h.executeAction(r.Context(), escalation.InteractionID, req.Action)
 	}
 
-	response.JSON(w, http.StatusOK, map[string]string{"message": "Escalation resolved"})
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"message":    "Escalation resolved",
+		"escalation": escalation,
+	})
 }
 
 func (h *EscalationHandler) Approve(w http.ResponseWriter, r *http.Request) {
@@ -188,30 +371,32 @@ func (h *EscalationHandler) Approve(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify ownership
-	agent, _ := h.repos.Agent.GetByID(r.Context(), escalation.AgentID)
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
+	if _, err := requireAgentOwnership(r.Context(), h.repos, escalation.AgentID, userID); err != nil {
+		respondResourceOwnershipError(w, err, "Escalation not found")
 		return
 	}
 
 	// Mark as resolved with approval
-	now := time.Now()
-	resolution := "approved"
-	escalation.Status = "resolved"
-	escalation.Resolution = &resolution
-	escalation.ResolvedBy = &userID
-	escalation.ResolvedAt = &now
-
-	if err := h.repos.Escalation.Update(r.Context(), escalation); err != nil {
+	resolved, err := h.resolveOnce(r.Context(), escalation, "approved", userID)
+	if errors.Is(err, errEscalationClosed) {
+		response.Error(w, http.StatusConflict, "Escalation is already "+escalation.Status)
+		return
+	}
+	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to approve escalation")
 		return
 	}
+	if !resolved {
+		response.JSON(w, http.StatusOK, map[string]string{"message": "Action approved and executed"})
+		return
+	}
 
 	// Update interaction with feedback
-	interaction, _ := h.repos.Interaction.GetByID(r.Context(), escalation.InteractionID)
-	feedback := "approved"
-	interaction.HumanFeedback = &feedback
-	h.repos.Interaction.Update(r.Context(), interaction)
+	if interaction, err := h.repos.Interaction.GetByID(r.Context(), escalation.InteractionID); err == nil {
+		feedback := "approved"
+		interaction.HumanFeedback = &feedback
+		h.repos.Interaction.Update(r.Context(), interaction)
+	}
 
 	// Trigger agent to execute the pending action
 	// This would be sent to the AI agent service
@@ -235,9 +420,8 @@ func (h *EscalationHandler) Reject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify ownership
-	agent, _ := h.repos.Agent.GetByID(r.Context(), escalation.AgentID)
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
+	if _, err := requireAgentOwnership(r.Context(), h.repos, escalation.AgentID, userID); err != nil {
+		respondResourceOwnershipError(w, err, "Escalation not found")
 		return
 	}
 
@@ -251,23 +435,26 @@ func (h *EscalationHandler) Reject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Mark as resolved with rejection
-	now := time.Now()
-	resolution := "rejected: " + req.Reason
-	escalation.Status = "resolved"
-	escalation.Resolution = &resolution
-	escalation.ResolvedBy = &userID
-	escalation.ResolvedAt = &now
-
-	if err := h.repos.Escalation.Update(r.Context(), escalation); err != nil {
+	resolved, err := h.resolveOnce(r.Context(), escalation, "rejected: "+req.Reason, userID)
+	if errors.Is(err, errEscalationClosed) {
+		response.Error(w, http.StatusConflict, "Escalation is already "+escalation.Status)
+		return
+	}
+	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to reject escalation")
 		return
 	}
+	if !resolved {
+		response.JSON(w, http.StatusOK, map[string]string{"message": "Action rejected"})
+		return
+	}
 
 	// Update interaction with feedback
-	interaction, _ := h.repos.Interaction.GetByID(r.Context(), escalation.InteractionID)
-	feedback := "rejected"
-	interaction.HumanFeedback = &feedback
-	h.repos.Interaction.Update(r.Context(), interaction)
+	if interaction, err := h.repos.Interaction.GetByID(r.Context(), escalation.InteractionID); err == nil {
+		feedback := "rejected"
+		interaction.HumanFeedback = &feedback
+		h.repos.Interaction.Update(r.Context(), interaction)
+	}
 
 	// Store the correction as a training sample for the agent
 	if req.Correction != "" {
@@ -276,3 +463,366 @@ func (h *EscalationHandler) Reject(w http.ResponseWriter, r *http.Request) {
 
 	response.JSON(w, http.StatusOK, map[string]string{"message": "Action rejected"})
 }
+
+// ListRoutingRules returns the organization's escalation routing rules
+func (h *EscalationHandler) ListRoutingRules(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+
+	rules, err := h.repos.RoutingRule.ListByOrgID(r.Context(), orgID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch routing rules")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, rules)
+}
+
+// CreateRoutingRule adds an escalation routing rule (admin only)
+func (h *EscalationHandler) CreateRoutingRule(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.RoutingRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if status, msg := h.checkRoutingRule(r.Context(), orgID, &req); status != http.StatusOK {
+		response.Error(w, status, msg)
+		return
+	}
+
+	rule := &models.EscalationRoutingRule{
+		ID:              uuid.New(),
+		OrgID:           orgID,
+		AgentID:         req.AgentID,
+		Provider:        req.Provider,
+		InteractionType: req.InteractionType,
+		AssigneeID:      req.AssigneeID,
+	}
+	if err := h.repos.RoutingRule.Create(r.Context(), rule); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to create routing rule")
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, rule)
+}
+
+// UpdateRoutingRule replaces an escalation routing rule (admin only)
+func (h *EscalationHandler) UpdateRoutingRule(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	rule, ok := h.orgRoutingRule(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	var req models.RoutingRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if status, msg := h.checkRoutingRule(r.Context(), orgID, &req); status != http.StatusOK {
+		response.Error(w, status, msg)
+		return
+	}
+
+	rule.AgentID = req.AgentID
+	rule.Provider = req.Provider
+	rule.InteractionType = req.InteractionType
+	rule.AssigneeID = req.AssigneeID
+	if err := h.repos.RoutingRule.Update(r.Context(), rule); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to update routing rule")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, rule)
+}
+
+// DeleteRoutingRule removes an escalation routing rule (admin only)
+func (h *EscalationHandler) DeleteRoutingRule(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	rule, ok := h.orgRoutingRule(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	if err := h.repos.RoutingRule.Delete(r.Context(), rule.ID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to delete routing rule")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Routing rule deleted"})
+}
+
+// orgRoutingRule loads the rule named in the URL, responding with 404 when
+// it does not exist or belongs to another organization
+func (h *EscalationHandler) orgRoutingRule(w http.ResponseWriter, r *http.Request, orgID uuid.UUID) (*models.EscalationRoutingRule, bool) {
+	ruleID, err := uuid.Parse(chi.URLParam(r, "ruleID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid rule ID")
+		return nil, false
+	}
+
+	rule, err := h.repos.RoutingRule.GetByID(r.Context(), ruleID)
+	if err == nil && rule.OrgID != orgID {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		respondLookupError(w, err, "Routing rule not found")
+		return nil, false
+	}
+	return rule, true
+}
+
+// checkRoutingRule validates a rule request and checks the assignee and any
+// agent belong to the organization. Returns the HTTP status and error message.
+func (h *EscalationHandler) checkRoutingRule(ctx context.Context, orgID uuid.UUID, req *models.RoutingRuleRequest) (int, string) {
+	if err := req.Validate(); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	if _, err := h.repos.Membership.Get(ctx, req.AssigneeID, orgID); isNotFound(err) {
+		return http.StatusBadRequest, "Assignee is not a member of the organization"
+	} else if err != nil {
+		return http.StatusInternalServerError, "Failed to check assignee"
+	}
+
+	return checkOrgAgent(ctx, h.repos, orgID, req.AgentID)
+}
+
+// ListPriorityRules returns the organization's escalation priority rules
+func (h *EscalationHandler) ListPriorityRules(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+
+	rules, err := h.repos.PriorityRule.ListByOrgID(r.Context(), orgID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch priority rules")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, rules)
+}
+
+// CreatePriorityRule adds an escalation priority rule (admin only)
+func (h *EscalationHandler) CreatePriorityRule(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.PriorityRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if status, msg := h.checkPriorityRule(r.Context(), orgID, &req); status != http.StatusOK {
+		response.Error(w, status, msg)
+		return
+	}
+
+	rule := &models.EscalationPriorityRule{
+		ID:       uuid.New(),
+		OrgID:    orgID,
+		AgentID:  req.AgentID,
+		Provider: req.Provider,
+		Keyword:  req.Keyword,
+		MinGap:   req.MinGap,
+		Weight:   req.Weight,
+	}
+	if err := h.repos.PriorityRule.Create(r.Context(), rule); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to create priority rule")
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, rule)
+}
+
+// UpdatePriorityRule replaces an escalation priority rule (admin only)
+func (h *EscalationHandler) UpdatePriorityRule(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	rule, ok := h.orgPriorityRule(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	var req models.PriorityRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if status, msg := h.checkPriorityRule(r.Context(), orgID, &req); status != http.StatusOK {
+		response.Error(w, status, msg)
+		return
+	}
+
+	rule.AgentID = req.AgentID
+	rule.Provider = req.Provider
+	rule.Keyword = req.Keyword
+	rule.MinGap = req.MinGap
+	rule.Weight = req.Weight
+	if err := h.repos.PriorityRule.Update(r.Context(), rule); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to update priority rule")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, rule)
+}
+
+// DeletePriorityRule removes an escalation priority rule (admin only)
+func (h *EscalationHandler) DeletePriorityRule(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	rule, ok := h.orgPriorityRule(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	if err := h.repos.PriorityRule.Delete(r.Context(), rule.ID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to delete priority rule")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Priority rule deleted"})
+}
+
+// orgPriorityRule loads the rule named in the URL, responding with 404 when
+// it does not exist or belongs to another organization
+func (h *EscalationHandler) orgPriorityRule(w http.ResponseWriter, r *http.Request, orgID uuid.UUID) (*models.EscalationPriorityRule, bool) {
+	ruleID, err := uuid.Parse(chi.URLParam(r, "ruleID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid rule ID")
+		return nil, false
+	}
+
+	rule, err := h.repos.PriorityRule.GetByID(r.Context(), ruleID)
+	if err == nil && rule.OrgID != orgID {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		respondLookupError(w, err, "Priority rule not found")
+		return nil, false
+	}
+	return rule, true
+}
+
+// checkPriorityRule validates a rule request and checks any agent belongs to
+// the organization. Returns the HTTP status and error message.
+func (h *EscalationHandler) checkPriorityRule(ctx context.Context, orgID uuid.UUID, req *models.PriorityRuleRequest) (int, string) {
+	if err := req.Validate(); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	return checkOrgAgent(ctx, h.repos, orgID, req.AgentID)
+}
+
+// errEscalationClosed is returned when an escalation can no longer be
+// resolved with the requested resolution
+var errEscalationClosed = errors.New("escalation closed")
+
+// resolveOnce transitions a pending escalation to resolved, reporting whether
+// this call did so. A repeat of the request that resolved it returns false
+// and leaves resolved_at untouched so retries do not act twice; any other
+// closed escalation yields errEscalationClosed. e holds the stored state on
+// return.
+func (h *EscalationHandler) resolveOnce(ctx context.Context, e *models.Escalation, resolution string, userID uuid.UUID) (bool, error) {
+	if e.Status == "pending" {
+		now := time.Now()
+		candidate := *e
+		candidate.Status = "resolved"
+		candidate.Resolution = &resolution
+		candidate.ResolvedBy = &userID
+		candidate.ResolvedAt = &now
+
+		ok, err := h.repos.Escalation.ResolvePending(ctx, &candidate)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			*e = candidate
+			invalidateAgentAnalytics(ctx, h.redis, e.AgentID)
+			return true, nil
+		}
+
+		// A concurrent request got there first; compare against what it stored
+		current, err := h.repos.Escalation.GetByID(ctx, e.ID)
+		if err != nil {
+			return false, err
+		}
+		*e = *current
+	}
+
+	if e.ResolvedWith(resolution) {
+		return false, nil
+	}
+	return false, errEscalationClosed
+}
+
+// parseTimeParam accepts an RFC3339 timestamp or a plain date; empty yields nil
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func timeValue(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func int64Value(n *int64) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.FormatInt(*n, 10)
+}
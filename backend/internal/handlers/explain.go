@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/pkg/response"
+)
+
+// aiExplanation is the AI service's decision trace for an interaction
+type aiExplanation struct {
+	Reasoning            string `json:"reasoning"`
+	ConsideredEscalation bool   `json:"considered_escalation"`
+	MatchedSamples       []struct {
+		ID         uuid.UUID `json:"id"`
+		Similarity *float64  `json:"similarity"`
+	} `json:"matched_samples"`
+}
+
+// ExplainInteraction returns why the agent handled an interaction the way it
+// did: its confidence against the applicable threshold, the agent's mode and,
+// when the AI service can be asked, its reasoning and the training samples it
+// drew on. Without the AI service only the stored part is returned.
+func (h *AgentHandler) ExplainInteraction(w http.ResponseWriter, r *http.Request) {
+	interactionID, err := uuid.Parse(chi.URLParam(r, "interactionID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid interaction ID")
+		return
+	}
+
+	interaction, err := h.repos.Interaction.GetByID(r.Context(), interactionID)
+	if err != nil {
+		respondLookupError(w, err, "Interaction not found")
+		return
+	}
+
+	userID := r.Context().Value("userID").(uuid.UUID)
+	agent, err := requireAgentOwnership(r.Context(), h.repos, interaction.AgentID, userID)
+	if err != nil {
+		respondResourceOwnershipError(w, err, "Interaction not found")
+		return
+	}
+
+	explanation := models.ExplainInteraction(interaction, agent, time.Now())
+
+	// Only interactions the agent decided on have a trace to ask for
+	processed := interaction.Status == "completed" || interaction.Status == "escalated"
+	if quota := h.writeAIQuotaHeaders(w, r); processed && !quota.Exhausted(time.Now()) {
+		trace, err := h.fetchExplanation(r.Context(), agent, interaction)
+		if err != nil {
+			log.Warn().Err(err).Str("interaction_id", interaction.ID.String()).Msg("Failed to fetch explanation from AI service")
+		} else {
+			h.applyExplanation(r.Context(), explanation, trace)
+		}
+	}
+
+	response.JSON(w, http.StatusOK, explanation)
+}
+
+// fetchExplanation asks the AI service for its decision trace of an interaction
+func (h *AgentHandler) fetchExplanation(ctx context.Context, agent *models.Agent, interaction *models.Interaction) (*aiExplanation, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET",
+		h.cfg.AgentServiceURL+"/api/v1/agents/"+agent.ID.String()+"/interactions/"+interaction.ID.String()+"/explain", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := h.doAIRequest(&http.Client{Timeout: 10 * time.Second}, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkAIResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var trace aiExplanation
+	if err := json.NewDecoder(resp.Body).Decode(&trace); err != nil {
+		return nil, err
+	}
+	return &trace, nil
+}
+
+// applyExplanation adds the AI service's trace to an explanation. Matched
+// samples are loaded from storage; ones since deleted, or not the agent's,
+// are left out.
+func (h *AgentHandler) applyExplanation(ctx context.Context, explanation *models.InteractionExplanation, trace *aiExplanation) {
+	explanation.Source = models.ExplanationSourceAIService
+	if trace.Reasoning != "" {
+		explanation.Reasoning = &trace.Reasoning
+	}
+	explanation.ConsideredEscalation = explanation.ConsideredEscalation || trace.ConsideredEscalation
+
+	if len(trace.MatchedSamples) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(trace.MatchedSamples))
+	for i, match := range trace.MatchedSamples {
+		ids[i] = match.ID
+	}
+	samples, err := h.repos.Training.ListByIDs(ctx, explanation.AgentID, ids)
+	if err != nil {
+		log.Warn().Err(err).Str("interaction_id", explanation.InteractionID.String()).Msg("Failed to load matched training samples")
+		return
+	}
+	byID := make(map[uuid.UUID]*models.TrainingSample, len(samples))
+	for _, sample := range samples {
+		byID[sample.ID] = sample
+	}
+
+	// Keep the AI service's ranking
+	for _, match := range trace.MatchedSamples {
+		if sample, ok := byID[match.ID]; ok {
+			explanation.MatchedSamples = append(explanation.MatchedSamples, &models.MatchedSample{
+				TrainingSample: sample,
+				Similarity:     match.Similarity,
+			})
+		}
+	}
+}
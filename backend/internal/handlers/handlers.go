@@ -17,6 +17,9 @@ type Handlers struct {
 	Organization *OrganizationHandler
 	Webhook      *WebhookHandler
 	Credentials  *CredentialsHandler
+	Admin        *AdminHandler
+	Tag          *TagHandler
+	Health       *HealthHandler // Set by the caller, which owns the connections and workers
 }
 
 // NewHandlers creates a new handlers instance
@@ -31,5 +34,7 @@ func NewHandlers(repos *repository.Repositories, redis *redis.Client, cfg *confi
 		Organization: NewOrganizationHandler(repos, redis, cfg),
 		Webhook:      NewWebhookHandler(repos, redis, cfg),
 		Credentials:  NewCredentialsHandler(repos, redis, cfg),
+		Admin:        NewAdminHandler(repos, redis, cfg),
+		Tag:          NewTagHandler(repos, redis, cfg),
 	}
 }
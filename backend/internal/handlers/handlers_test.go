@@ -1,10 +1,39 @@
 package handlers
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/feature"
+	"github.com/vibber/backend/internal/middleware"
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/repository"
+	"github.com/vibber/backend/internal/worker"
 )
 
 func TestHealthCheck(t *testing.T) {
@@ -71,3 +100,2981 @@ func TestResponseJSON(t *testing.T) {
 		t.Errorf("wrong message: got %v want test", response["message"])
 	}
 }
+
+func TestParseTimeParam(t *testing.T) {
+	if got, err := parseTimeParam(""); err != nil || got != nil {
+		t.Errorf("empty value: got %v, %v want nil, nil", got, err)
+	}
+
+	got, err := parseTimeParam("2024-03-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Year() != 2024 || got.Month() != 3 || got.Day() != 1 {
+		t.Errorf("wrong date: got %v", got)
+	}
+
+	if _, err := parseTimeParam("2024-03-01T10:00:00Z"); err != nil {
+		t.Errorf("RFC3339 value rejected: %v", err)
+	}
+
+	if _, err := parseTimeParam("yesterday"); err == nil {
+		t.Error("expected error for invalid value")
+	}
+}
+
+func TestRespondOwnershipError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errAgentNotFound, http.StatusNotFound},
+		{http.ErrBodyNotAllowed, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		respondOwnershipError(rr, tt.err)
+		if rr.Code != tt.want {
+			t.Errorf("respondOwnershipError(%v): got %v want %v", tt.err, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestToIntegrationResponseHidesTokens(t *testing.T) {
+	refresh := "refresh-secret"
+	integration := &models.Integration{
+		ID:           uuid.New(),
+		Provider:     "slack",
+		AccessToken:  "access-secret",
+		RefreshToken: &refresh,
+		Status:       "active",
+	}
+
+	data, err := json.Marshal(toIntegrationResponse(integration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := string(data)
+	if strings.Contains(body, "access-secret") || strings.Contains(body, "refresh-secret") {
+		t.Errorf("integration response leaks tokens: %s", body)
+	}
+	if !strings.Contains(body, `"scopes":[]`) {
+		t.Errorf("expected empty scopes array, got %s", body)
+	}
+}
+
+func TestAggregateWebhookMetrics(t *testing.T) {
+	days := []map[string]string{
+		{
+			"github|pull_request|received":     "3",
+			"github|pull_request|queued":       "2",
+			"github|pull_request|dropped":      "1",
+			"jira|jira:issue_created|received": "1",
+		},
+		{
+			"github|push|received": "4",
+			"github|push|filtered": "4",
+			"malformed":            "1",
+		},
+	}
+
+	providers := aggregateWebhookMetrics(days)
+	if len(providers) != 2 || providers[0].Provider != "github" || providers[1].Provider != "jira" {
+		t.Fatalf("unexpected providers: %+v", providers)
+	}
+
+	github := providers[0]
+	if github.Received != 7 || github.Queued != 2 || github.Dropped != 1 || github.Filtered != 4 {
+		t.Errorf("unexpected github totals: %+v", github.WebhookEventCounts)
+	}
+	if pr := github.EventTypes["pull_request"]; pr == nil || pr.Received != 3 {
+		t.Errorf("unexpected pull_request counts: %+v", pr)
+	}
+	if issue := providers[1].EventTypes["jira:issue_created"]; issue == nil || issue.Received != 1 {
+		t.Errorf("expected event types containing ':' to be kept, got %+v", providers[1].EventTypes)
+	}
+}
+
+func TestWebhookEventLabel(t *testing.T) {
+	tests := []struct {
+		provider, eventType, want string
+	}{
+		{"jira", "jira:issue_created", "jira:issue_created"},
+		{"github", "pull_request", "pull_request"},
+		{"slack", "app_mention", "app_mention"},
+		{"jira", "attacker-chosen-" + strings.Repeat("x", 64), "other"},
+		{"jira", "pull_request", "other"},
+		{"github", "a|b|c", "other"},
+		{"slack", "", "unknown"},
+		{"github", "unknown", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := webhookEventLabel(tt.provider, tt.eventType); got != tt.want {
+			t.Errorf("webhookEventLabel(%q, %q) = %q, want %q", tt.provider, tt.eventType, got, tt.want)
+		}
+	}
+}
+
+func TestRespondLookupError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	respondLookupError(rec, repository.ErrNotFound, "Agent not found")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("not found: got status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = httptest.NewRecorder()
+	respondLookupError(rec, errors.New("connection refused"), "Agent not found")
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("db error: got status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	if !errors.Is(repository.ErrNotFound, pgx.ErrNoRows) {
+		t.Error("ErrNotFound should wrap pgx.ErrNoRows")
+	}
+}
+
+func TestRedisKeyValidation(t *testing.T) {
+	validKeys := []string{"ratelimit:slack:123", "analytics:abc:overview:", "webhooks:metrics:2026-01-01"}
+	for _, key := range validKeys {
+		if !validRedisKey(key) {
+			t.Errorf("expected %q to be allowed", key)
+		}
+	}
+
+	invalidKeys := []string{"", "ratelimit:", "session:abc", "ratelimit:*", "xratelimit:slack", "jwt:blacklist:abc"}
+	for _, key := range invalidKeys {
+		if validRedisKey(key) {
+			t.Errorf("expected %q to be rejected", key)
+		}
+	}
+
+	if !validRedisPattern("ratelimit:github:*") {
+		t.Error("expected pattern under an allowed prefix to be accepted")
+	}
+	for _, pattern := range []string{"*", "rate*", "*ratelimit:*", "ratelimit:\\*"} {
+		if validRedisPattern(pattern) {
+			t.Errorf("expected pattern %q to be rejected", pattern)
+		}
+	}
+}
+
+func TestRedactValue(t *testing.T) {
+	if got := redactValue("access_token", "abc"); got != "[redacted]" {
+		t.Errorf("expected token field to be redacted, got %q", got)
+	}
+	if got := redactValue("clientSecret", "abc"); got != "[redacted]" {
+		t.Errorf("expected secret field to be redacted, got %q", got)
+	}
+	if got := redactValue("tokens", "4.5"); got != "4.5" {
+		t.Errorf("expected rate limit bucket tokens to be visible, got %q", got)
+	}
+	if got := redactValue("ts", "123"); got != "123" {
+		t.Errorf("expected plain value, got %q", got)
+	}
+}
+
+func TestAgentThresholdBounds(t *testing.T) {
+	tests := []struct {
+		body    string
+		wantErr bool
+	}{
+		{`{"confidenceThreshold": 0}`, false},
+		{`{"confidenceThreshold": 100}`, false},
+		{`{"confidenceThreshold": 101}`, true},
+		{`{"confidenceThreshold": -1}`, true},
+		{`{"providerThresholds": {"github": 100, "slack": 0}}`, false},
+		{`{"providerThresholds": {"github": 101}}`, true},
+		{`{"providerThresholds": {"slack": -1}}`, true},
+	}
+
+	for _, tt := range tests {
+		var req models.UpdateAgentRequest
+		if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+			t.Fatal(err)
+		}
+		err := models.ValidateThresholds(req.ConfidenceThreshold, req.ProviderThresholds)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.body, err, tt.wantErr)
+		}
+
+		if !tt.wantErr {
+			continue
+		}
+
+		// Out of range values are rejected before anything is stored
+		h := &AgentHandler{}
+		for _, handle := range []http.HandlerFunc{h.Create, h.Update} {
+			r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(tt.body))
+			r = r.WithContext(context.WithValue(r.Context(), "agent", &models.Agent{ID: uuid.New()}))
+			r = r.WithContext(context.WithValue(r.Context(), "userID", uuid.New()))
+			rr := httptest.NewRecorder()
+			handle(rr, r)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: status = %d, want 400", tt.body, rr.Code)
+			}
+		}
+	}
+}
+
+// legacySlackSignature is the per-request verification the pooled hashers
+// replaced, kept as the benchmark baseline
+func legacySlackSignature(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + string(body)))
+	return []byte("v0=" + hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestHMACPoolMatchesLegacy(t *testing.T) {
+	pool := newHMACPool("signing-secret")
+	bodies := []string{"", `{"type":"event_callback"}`, strings.Repeat("x", 100000)}
+
+	for _, b := range bodies {
+		// Run twice so the second pass uses a recycled hasher
+		for i := 0; i < 2; i++ {
+			got, expected, err := pool.readAndSign(strings.NewReader(b), "v0:1700000000:", "v0=")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != b {
+				t.Errorf("body was not returned intact")
+			}
+			want := legacySlackSignature("signing-secret", "1700000000", []byte(b))
+			if !hmac.Equal(expected, want) {
+				t.Errorf("signature = %s, want %s", expected, want)
+			}
+		}
+	}
+
+	github := newHMACPool("gh-secret")
+	_, expected, _ := github.readAndSign(strings.NewReader("payload"), "", "sha256=")
+	mac := hmac.New(sha256.New, []byte("gh-secret"))
+	mac.Write([]byte("payload"))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); string(expected) != want {
+		t.Errorf("github signature = %s, want %s", expected, want)
+	}
+}
+
+func benchmarkBody() []byte {
+	return []byte(`{"type":"event_callback","event":{"type":"message","text":"` + strings.Repeat("a", 16*1024) + `"}}`)
+}
+
+func BenchmarkSlackSignatureLegacy(b *testing.B) {
+	body := benchmarkBody()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	for i := 0; i < b.N; i++ {
+		data, _ := io.ReadAll(bytes.NewReader(body))
+		_ = io.NopCloser(bytes.NewBuffer(data))
+		legacySlackSignature("signing-secret", "1700000000", data)
+	}
+}
+
+func BenchmarkSlackSignaturePooled(b *testing.B) {
+	body := benchmarkBody()
+	pool := newHMACPool("signing-secret")
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	for i := 0; i < b.N; i++ {
+		pool.readAndSign(bytes.NewReader(body), "v0:1700000000:", "v0=")
+	}
+}
+
+func TestOrgFeatureList(t *testing.T) {
+	list := orgFeatureList(map[string]bool{
+		feature.Replay:       false,
+		feature.CostTracking: true,
+		"retired_flag":       true,
+	})
+
+	if len(list) != len(feature.Defaults) {
+		t.Fatalf("expected %d flags, got %d", len(feature.Defaults), len(list))
+	}
+
+	byName := map[string]map[string]interface{}{}
+	for _, f := range list {
+		byName[f["flag"].(string)] = f
+	}
+	if _, ok := byName["retired_flag"]; ok {
+		t.Error("unknown flags should be ignored")
+	}
+
+	tests := []struct {
+		flag       string
+		enabled    bool
+		overridden bool
+	}{
+		{feature.Replay, false, true},
+		{feature.CostTracking, true, true},
+		{feature.PassiveMode, feature.Defaults[feature.PassiveMode], false},
+	}
+	for _, tt := range tests {
+		f := byName[tt.flag]
+		if f["enabled"] != tt.enabled || f["overridden"] != tt.overridden {
+			t.Errorf("%s: got %+v, want enabled=%v overridden=%v", tt.flag, f, tt.enabled, tt.overridden)
+		}
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	cfg := &config.Config{DefaultPageSize: 20, MaxPageSize: 100}
+
+	tests := []struct {
+		query    string
+		page     int
+		pageSize int
+		status   int
+	}{
+		{"", 1, 20, http.StatusOK},
+		{"page=3&page_size=50", 3, 50, http.StatusOK},
+		{"page_size=100", 1, 100, http.StatusOK},
+		{"page_size=5000", 1, 100, http.StatusOK},
+		{"page=0", 0, 0, http.StatusBadRequest},
+		{"page=-1", 0, 0, http.StatusBadRequest},
+		{"page_size=0", 0, 0, http.StatusBadRequest},
+		{"page_size=ten", 0, 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		rr := httptest.NewRecorder()
+		params, ok := parsePagination(rr, r, cfg)
+		if ok != (tt.status == http.StatusOK) || rr.Code != tt.status {
+			t.Errorf("%q: ok = %v, status = %d, want %d", tt.query, ok, rr.Code, tt.status)
+			continue
+		}
+		if ok && (params.Page != tt.page || params.PageSize != tt.pageSize) {
+			t.Errorf("%q: got page %d size %d, want %d and %d", tt.query, params.Page, params.PageSize, tt.page, tt.pageSize)
+		}
+	}
+}
+
+func TestWebhookSkipReason(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  string
+		eventType string
+		payload   string
+		want      string
+	}{
+		{"slack user message", "slack", "message", `{"type":"message","user":"U1","text":"hi"}`, ""},
+		{"slack bot echo", "slack", "message", `{"type":"message","bot_id":"B1","text":"hi"}`, skipBot},
+		{"slack bot subtype", "slack", "message", `{"type":"message","subtype":"bot_message"}`, skipBot},
+		{"slack edit", "slack", "message", `{"type":"message","subtype":"message_changed"}`, skipMessageEdited},
+		{"slack delete", "slack", "message", `{"type":"message","subtype":"message_deleted"}`, skipMessageDeleted},
+		{"slack join", "slack", "message", `{"type":"message","subtype":"channel_join"}`, skipChannelNotice},
+		{"slack thread broadcast", "slack", "message", `{"type":"message","subtype":"thread_broadcast","user":"U1"}`, ""},
+		{"github pr opened", "github", "pull_request", `{"action":"opened","sender":{"type":"User"}}`, ""},
+		{"github pr labeled", "github", "pull_request", `{"action":"labeled","sender":{"type":"User"}}`, skipIgnoredAction},
+		{"github bot comment", "github", "issue_comment", `{"action":"created","sender":{"type":"Bot"}}`, skipBot},
+		{"jira user comment", "jira", "comment_created", `{"comment":{"author":{"accountType":"atlassian"}}}`, ""},
+		{"jira app comment", "jira", "comment_created", `{"comment":{"author":{"accountType":"app"}}}`, skipBot},
+		{"jira app update", "jira", "jira:issue_updated", `{"user":{"accountType":"app"}}`, skipBot},
+	}
+
+	for _, tt := range tests {
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.payload), &payload); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := skipReason(tt.provider, tt.eventType, payload, true); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if got := skipReason(tt.provider, tt.eventType, payload, false); tt.want == skipBot && got != "" {
+			t.Errorf("%s: got %q with bots allowed, want \"\"", tt.name, got)
+		}
+	}
+}
+
+func TestIntrospectToken(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret", JWTExpiryMinutes: 15, RefreshExpiryHours: 24}
+	h := &AuthHandler{cfg: cfg}
+	user := &models.User{ID: uuid.New(), OrgID: uuid.New(), Email: "ada@example.com", Role: "admin"}
+
+	access, _ := h.generateAccessToken(user, uuid.New())
+	refresh, _ := h.generateRefreshToken(user, uuid.New(), uuid.NewString())
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   user.ID.String(),
+		"orgId": user.OrgID.String(),
+		"exp":   time.Now().Add(-time.Minute).Unix(),
+	}).SignedString([]byte(cfg.JWTSecret))
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   user.ID.String(),
+		"orgId": user.OrgID.String(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("other-secret"))
+	anonymous, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(cfg.JWTSecret))
+
+	tests := []struct {
+		name      string
+		token     string
+		active    bool
+		reason    string
+		tokenType string
+	}{
+		{"access", access, true, "", "access"},
+		{"refresh", refresh, true, "", "refresh"},
+		{"expired", expired, false, models.TokenExpired, "access"},
+		{"forged", forged, false, models.TokenInvalidSignature, ""},
+		{"malformed", "not-a-jwt", false, models.TokenMalformed, ""},
+		{"no identity", anonymous, false, models.TokenInvalid, "access"},
+	}
+
+	for _, tt := range tests {
+		got := introspectToken(tt.token, cfg.JWTSecret)
+		if got.Active != tt.active || got.Reason != tt.reason || got.TokenType != tt.tokenType {
+			t.Errorf("%s: got %+v", tt.name, got)
+		}
+	}
+
+	got := introspectToken(access, cfg.JWTSecret)
+	if got.Sub != user.ID.String() || got.OrgID != user.OrgID.String() || got.Role != "admin" || got.Exp == 0 {
+		t.Errorf("claims not reported: %+v", got)
+	}
+	if got := introspectToken(forged, cfg.JWTSecret); got.Sub != "" {
+		t.Errorf("claims of a forged token must not be reported: %+v", got)
+	}
+}
+
+// Fakes returning fixed resources by ID for the ownership tests
+type fakeAgentRepo struct {
+	repository.AgentRepository
+	agents map[uuid.UUID]*models.Agent
+}
+
+func (f *fakeAgentRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Agent, error) {
+	if agent, ok := f.agents[id]; ok {
+		return agent, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+type fakeInteractionRepo struct {
+	repository.InteractionRepository
+	interaction *models.Interaction
+}
+
+func (f *fakeInteractionRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Interaction, error) {
+	if id == f.interaction.ID {
+		return f.interaction, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+type fakeEscalationRepo struct {
+	repository.EscalationRepository
+	escalation *models.Escalation
+}
+
+func (f *fakeEscalationRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Escalation, error) {
+	if id == f.escalation.ID {
+		return f.escalation, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+type fakeIntegrationRepo struct {
+	repository.IntegrationRepository
+	integration *models.Integration
+}
+
+func (f *fakeIntegrationRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Integration, error) {
+	if id == f.integration.ID {
+		return f.integration, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+type fakeCredentialRepo struct {
+	repository.CredentialRepository
+	credential *models.OrganizationCredential
+	verified   int
+}
+
+func (f *fakeCredentialRepo) GetByOrgAndProvider(ctx context.Context, orgID uuid.UUID, provider string) (*models.OrganizationCredential, error) {
+	if orgID == f.credential.OrgID && provider == f.credential.Provider {
+		return f.credential, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (f *fakeCredentialRepo) MarkVerified(ctx context.Context, id uuid.UUID) error {
+	f.verified++
+	return nil
+}
+
+// Another user's resources must be indistinguishable from missing ones
+func TestCrossUserAccessNotFound(t *testing.T) {
+	owner, intruder := uuid.New(), uuid.New()
+	ownerOrg, intruderOrg := uuid.New(), uuid.New()
+	agent := &models.Agent{ID: uuid.New(), UserID: owner}
+	intruderAgent := &models.Agent{ID: uuid.New(), UserID: intruder}
+	interaction := &models.Interaction{ID: uuid.New(), AgentID: agent.ID}
+	escalation := &models.Escalation{ID: uuid.New(), AgentID: agent.ID, InteractionID: interaction.ID}
+	integration := &models.Integration{ID: uuid.New(), AgentID: agent.ID, Provider: "github"}
+	credential := &models.OrganizationCredential{ID: uuid.New(), OrgID: ownerOrg, Provider: "slack"}
+
+	repos := &repository.Repositories{
+		Agent:       &fakeAgentRepo{agents: map[uuid.UUID]*models.Agent{agent.ID: agent, intruderAgent.ID: intruderAgent}},
+		Interaction: &fakeInteractionRepo{interaction: interaction},
+		Escalation:  &fakeEscalationRepo{escalation: escalation},
+		Integration: &fakeIntegrationRepo{integration: integration},
+		Credential:  &fakeCredentialRepo{credential: credential},
+	}
+	h := NewHandlers(repos, nil, &config.Config{})
+
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "userID", intruder)
+			ctx = context.WithValue(ctx, "orgID", intruderOrg)
+			ctx = context.WithValue(ctx, "userRole", "member")
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	router.With(RequireAgentOwnership(repos)).Get("/agents/{agentID}", h.Agent.Get)
+	router.Get("/interactions/{interactionID}", h.Interaction.Get)
+	router.Post("/interactions/{interactionID}/feedback", h.Interaction.Feedback)
+	router.Post("/interactions/{interactionID}/promote-to-training", h.Interaction.PromoteToTraining)
+	router.Get("/escalations/{escalationID}", h.Escalation.Get)
+	router.Post("/escalations/{escalationID}/resolve", h.Escalation.Resolve)
+	router.Post("/escalations/{escalationID}/approve", h.Escalation.Approve)
+	router.Post("/escalations/{escalationID}/reject", h.Escalation.Reject)
+	router.Get("/integrations/{integrationID}/status", h.Integration.Status)
+	router.Delete("/integrations/{integrationID}", h.Integration.Disconnect)
+	router.Post("/integrations/{integrationID}/request-scopes", h.Integration.RequestScopes)
+	router.Post("/integrations/{integrationID}/disable", h.Integration.Disable)
+	router.With(RequireAgentOwnership(repos)).Put("/agents/{agentID}/integrations/{integrationID}", h.Integration.Attach)
+	router.Get("/credentials/{provider}", h.Credentials.Get)
+	router.Get("/analytics/overview", h.Analytics.Overview)
+	router.Get("/escalations", h.Escalation.List)
+
+	tests := []struct {
+		method, path, body, message string
+	}{
+		{"GET", "/agents/" + agent.ID.String(), "", "Agent not found"},
+		{"GET", "/interactions/" + interaction.ID.String(), "", "Interaction not found"},
+		{"POST", "/interactions/" + interaction.ID.String() + "/feedback", `{"feedback":"approved"}`, "Interaction not found"},
+		{"POST", "/interactions/" + interaction.ID.String() + "/promote-to-training", "", "Interaction not found"},
+		{"GET", "/escalations/" + escalation.ID.String(), "", "Escalation not found"},
+		{"POST", "/escalations/" + escalation.ID.String() + "/resolve", `{"resolution":"done"}`, "Escalation not found"},
+		{"POST", "/escalations/" + escalation.ID.String() + "/approve", "{}", "Escalation not found"},
+		{"POST", "/escalations/" + escalation.ID.String() + "/reject", "{}", "Escalation not found"},
+		{"GET", "/integrations/" + integration.ID.String() + "/status", "", "Integration not found"},
+		{"DELETE", "/integrations/" + integration.ID.String(), "", "Integration not found"},
+		{"POST", "/integrations/" + integration.ID.String() + "/request-scopes", `{"scopes":["workflow"]}`, "Integration not found"},
+		{"POST", "/integrations/" + integration.ID.String() + "/disable", "", "Integration not found"},
+		{"PUT", "/agents/" + intruderAgent.ID.String() + "/integrations/" + integration.ID.String(), "", "Integration not found"},
+		{"GET", "/credentials/slack", "", "Credentials not found"},
+		{"GET", "/analytics/overview?agent_id=" + agent.ID.String(), "", "Agent not found"},
+		{"GET", "/escalations?agent_id=" + agent.ID.String(), "", "Agent not found"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s: got %d want 404", tt.method, tt.path, rec.Code)
+			continue
+		}
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if body.Message != tt.message {
+			t.Errorf("%s %s: got %s want %q", tt.method, tt.path, rec.Body.String(), tt.message)
+		}
+	}
+}
+
+type fakeSharedIntegrationRepo struct {
+	repository.IntegrationRepository
+	integrations []*models.Integration
+	agentIDs     map[uuid.UUID][]uuid.UUID
+}
+
+func (f *fakeSharedIntegrationRepo) ListByExternalID(ctx context.Context, provider, externalID string) ([]*models.Integration, error) {
+	return f.integrations, nil
+}
+
+func (f *fakeSharedIntegrationRepo) ListAgentIDs(ctx context.Context, integrationID uuid.UUID) ([]uuid.UUID, error) {
+	return f.agentIDs[integrationID], nil
+}
+
+// An event reaches each subscribed agent once, through its own integration
+func TestWebhookSubscribers(t *testing.T) {
+	support, triage, muted := uuid.New(), uuid.New(), uuid.New()
+	shared := &models.Integration{ID: uuid.New(), AgentID: support, Enabled: true}
+	triageOwn := &models.Integration{ID: uuid.New(), AgentID: triage, Enabled: true}
+	disabled := &models.Integration{ID: uuid.New(), AgentID: muted, Enabled: false}
+
+	h := &WebhookHandler{repos: &repository.Repositories{Integration: &fakeSharedIntegrationRepo{
+		integrations: []*models.Integration{shared, triageOwn, disabled},
+		agentIDs: map[uuid.UUID][]uuid.UUID{
+			shared.ID:    {support, triage},
+			triageOwn.ID: {triage},
+			disabled.ID:  {muted, support},
+		},
+	}}}
+
+	subs, err := h.subscribers(context.Background(), "slack", "T123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[uuid.UUID]uuid.UUID)
+	for _, sub := range subs {
+		if _, dup := got[sub.agentID]; dup {
+			t.Errorf("agent %s subscribed twice", sub.agentID)
+		}
+		got[sub.agentID] = sub.integration.ID
+	}
+	want := map[uuid.UUID]uuid.UUID{support: shared.ID, triage: triageOwn.ID}
+	if len(got) != len(want) {
+		t.Fatalf("got %d subscribers want %d", len(got), len(want))
+	}
+	for agentID, integrationID := range want {
+		if got[agentID] != integrationID {
+			t.Errorf("agent %s routed through %s want %s", agentID, got[agentID], integrationID)
+		}
+	}
+}
+
+type fakeRouteTokenRepo struct {
+	repository.IntegrationRepository
+	integration *models.Integration
+}
+
+func (f *fakeRouteTokenRepo) GetByRouteTokenHash(ctx context.Context, hash string) (*models.Integration, error) {
+	if f.integration.RouteTokenHash == nil || *f.integration.RouteTokenHash != hash {
+		return nil, repository.ErrNotFound
+	}
+	return f.integration, nil
+}
+
+func TestWebhookRouteToken(t *testing.T) {
+	token, hash, err := models.GenerateWebhookRouteToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	teamID := "T123"
+	integration := &models.Integration{ID: uuid.New(), Provider: "slack", ExternalID: &teamID, Enabled: true, RouteTokenHash: &hash}
+
+	h := &WebhookHandler{repos: &repository.Repositories{Integration: &fakeRouteTokenRepo{integration: integration}}}
+	router := chi.NewRouter()
+	router.Post("/webhooks/{provider}/{routeToken}", h.Routed)
+
+	for _, tc := range []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"unknown token", "/webhooks/slack/vbr_whk_nope", `{"type":"url_verification","challenge":"c"}`, http.StatusNotFound},
+		{"other provider", "/webhooks/github/" + token, `{}`, http.StatusNotFound},
+		{"other workspace", "/webhooks/slack/" + token, `{"type":"event_callback","team_id":"T999","event":{"type":"message"}}`, http.StatusForbidden},
+		{"verified", "/webhooks/slack/" + token, `{"type":"url_verification","challenge":"c"}`, http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body)))
+		if rec.Code != tc.want {
+			t.Errorf("%s: got status %d want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+
+	// Jira events are checked against the integration's site
+	jiraToken, jiraHash, err := models.GenerateWebhookRouteToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jira := &models.Integration{ID: uuid.New(), Provider: "jira", Enabled: true, RouteTokenHash: &jiraHash}
+	jira.SetMetadata(models.AtlassianMeta{CloudID: "c0ffee", SiteURL: "https://acme.atlassian.net"})
+	h.repos.Integration = &fakeRouteTokenRepo{integration: jira}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhooks/jira/"+jiraToken,
+		strings.NewReader(`{"webhookEvent":"jira:issue_created","issue":{"id":"1","self":"https://other.atlassian.net/rest/api/2/issue/1"}}`)))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("other site: got status %d want 403", rec.Code)
+	}
+}
+
+func TestParseAIQuota(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	respond := func(status int, headers map[string]string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		for k, v := range headers {
+			resp.Header.Set(k, v)
+		}
+		return resp
+	}
+
+	if q := parseAIQuota(respond(http.StatusOK, nil), now); q != nil {
+		t.Errorf("no headers: got %+v, want nil", q)
+	}
+
+	q := parseAIQuota(respond(http.StatusOK, map[string]string{
+		"X-RateLimit-Limit":     "100",
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "1700000030",
+	}), now)
+	if q == nil || *q.Limit != 100 || *q.Remaining != 0 || !q.ResetAt.Equal(now.Add(30*time.Second)) {
+		t.Fatalf("absolute reset: got %+v", q)
+	}
+	if !q.Exhausted(now) || q.Exhausted(now.Add(time.Minute)) {
+		t.Error("quota should be exhausted until its reset only")
+	}
+
+	q = parseAIQuota(respond(http.StatusOK, map[string]string{"X-RateLimit-Remaining": "5", "X-RateLimit-Reset": "20"}), now)
+	if q == nil || q.Exhausted(now) || !q.ResetAt.Equal(now.Add(20*time.Second)) {
+		t.Errorf("relative reset: got %+v", q)
+	}
+
+	q = parseAIQuota(respond(http.StatusTooManyRequests, map[string]string{"Retry-After": "12"}), now)
+	if q == nil || !q.Exhausted(now) || q.RetryAfter(now) != 12*time.Second {
+		t.Errorf("429: got %+v", q)
+	}
+}
+
+func TestCheckAIResponse(t *testing.T) {
+	respond := func(status int, body string) *http.Response {
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}
+	}
+
+	if err := checkAIResponse(respond(http.StatusAccepted, "")); err != nil {
+		t.Errorf("2xx: got %v, want nil", err)
+	}
+	if err := checkAIResponse(respond(http.StatusTooManyRequests, "")); !errors.Is(err, errAIQuotaExhausted) {
+		t.Errorf("429: got %v, want quota exhausted", err)
+	}
+
+	tests := []struct {
+		status     int
+		body       string
+		wantStatus int
+		wantMsg    string
+	}{
+		{http.StatusBadRequest, `{"detail": "invalid model"}`, http.StatusBadRequest, "invalid model"},
+		{http.StatusUnprocessableEntity, `{"detail": [{"loc": ["body", "model"], "msg": "unknown model"}, {"loc": ["body", "prompt"], "msg": "too long"}]}`,
+			http.StatusUnprocessableEntity, "model: unknown model; prompt: too long"},
+		{http.StatusBadRequest, `{"error": "prompt too long for model"}`, http.StatusBadRequest, "prompt too long for model"},
+		{http.StatusBadRequest, `not json`, http.StatusBadRequest, "AI service rejected the request"},
+		{http.StatusInternalServerError, `{"detail": "boom"}`, http.StatusBadGateway, "boom"},
+		{http.StatusServiceUnavailable, ``, http.StatusBadGateway, "AI service error (status 503)"},
+	}
+	for _, tt := range tests {
+		var aiErr *aiServiceError
+		if err := checkAIResponse(respond(tt.status, tt.body)); !errors.As(err, &aiErr) {
+			t.Errorf("%d %s: got %v, want an AI service error", tt.status, tt.body, err)
+			continue
+		}
+		if aiErr.status != tt.wantStatus || aiErr.message != tt.wantMsg {
+			t.Errorf("%d %s: got %d %q, want %d %q", tt.status, tt.body, aiErr.status, aiErr.message, tt.wantStatus, tt.wantMsg)
+		}
+	}
+}
+
+func TestModelAllowed(t *testing.T) {
+	cfg := &config.Config{
+		AIModelsStarter:      []string{"small"},
+		AIModelsProfessional: []string{"small", "large"},
+		AIModelsEnterprise:   []string{"small", "large"},
+	}
+
+	tests := []struct {
+		plan, model string
+		want        int
+	}{
+		{"starter", "small", http.StatusOK},
+		{"professional", "large", http.StatusOK},
+		{"starter", "large", http.StatusForbidden},
+		{"enterprise", "gpt-imaginary", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if got, msg := modelAllowed(cfg, tt.plan, tt.model); got != tt.want {
+			t.Errorf("%s on %s: got %d (%s), want %d", tt.model, tt.plan, got, msg, tt.want)
+		}
+	}
+}
+
+// fakeRedis serves the handful of Redis commands the handlers' Redis-backed
+// stores use, over in-memory connections
+type fakeRedis struct {
+	mu        sync.Mutex
+	values    map[string]string
+	expires   map[string]time.Time
+	published map[string][]string         // Messages by channel
+	hashes    map[string]map[string]int64 // Hash counters by key
+}
+
+func newFakeRedis() (*redis.Client, *fakeRedis) {
+	f := &fakeRedis{values: map[string]string{}, expires: map[string]time.Time{}, published: map[string][]string{}, hashes: map[string]map[string]int64{}}
+	client := redis.NewClient(&redis.Options{
+		Protocol:         2,
+		DisableIndentity: true,
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go f.serve(server)
+			return client, nil
+		},
+	})
+	return client, f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, f.do(args)); err != nil {
+			return
+		}
+	}
+}
+
+// readRESPCommand reads one command sent as an array of bulk strings
+func readRESPCommand(reader *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(reader, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(reader, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) do(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key, at := range f.expires {
+		if time.Now().After(at) {
+			delete(f.values, key)
+			delete(f.expires, key)
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "SET":
+		previous, existed := f.values[args[1]]
+		reply := "+OK\r\n"
+		var expires time.Time
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "EX", "PX":
+				n, _ := strconv.Atoi(args[i+1])
+				unit := time.Second
+				if strings.ToUpper(args[i]) == "PX" {
+					unit = time.Millisecond
+				}
+				expires = time.Now().Add(time.Duration(n) * unit)
+				i++
+			case "GET":
+				reply = bulkString(previous, existed)
+			case "NX":
+				if existed {
+					return "$-1\r\n"
+				}
+			}
+		}
+		f.values[args[1]] = args[2]
+		delete(f.expires, args[1])
+		if !expires.IsZero() {
+			f.expires[args[1]] = expires
+		}
+		return reply
+	case "PUBLISH":
+		f.published[args[1]] = append(f.published[args[1]], args[2])
+		return ":0\r\n"
+	case "GETDEL":
+		value, ok := f.values[args[1]]
+		delete(f.values, args[1])
+		delete(f.expires, args[1])
+		return bulkString(value, ok)
+	case "GET":
+		value, ok := f.values[args[1]]
+		return bulkString(value, ok)
+	case "MGET":
+		reply := fmt.Sprintf("*%d\r\n", len(args)-1)
+		for _, key := range args[1:] {
+			value, ok := f.values[key]
+			reply += bulkString(value, ok)
+		}
+		return reply
+	case "INCR":
+		n, _ := strconv.Atoi(f.values[args[1]])
+		f.values[args[1]] = strconv.Itoa(n + 1)
+		return fmt.Sprintf(":%d\r\n", n+1)
+	case "HINCRBY":
+		if f.hashes[args[1]] == nil {
+			f.hashes[args[1]] = map[string]int64{}
+		}
+		n, _ := strconv.ParseInt(args[3], 10, 64)
+		f.hashes[args[1]][args[2]] += n
+		return fmt.Sprintf(":%d\r\n", f.hashes[args[1]][args[2]])
+	case "EXPIRE":
+		return ":1\r\n"
+	case "EXISTS":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := f.values[key]; ok {
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := f.values[key]; ok {
+				delete(f.values, key)
+				delete(f.expires, key)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func bulkString(value string, ok bool) string {
+	if !ok {
+		return "$-1\r\n"
+	}
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+type fakeSessionRepo struct {
+	repository.SessionRepository
+	sessions map[uuid.UUID]*models.Session
+	revoked  map[uuid.UUID]bool
+}
+
+func (f *fakeSessionRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	if session, ok := f.sessions[id]; ok {
+		return session, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (f *fakeSessionRepo) Touch(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (f *fakeSessionRepo) Revoke(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	f.revoked[id] = true
+	if session, ok := f.sessions[id]; ok {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return true, nil
+}
+
+type fakeUserRepo struct {
+	repository.UserRepository
+	user *models.User
+}
+
+func (f *fakeUserRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if id == f.user.ID {
+		copied := *f.user
+		return &copied, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	client, _ := newFakeRedis()
+	defer client.Close()
+
+	cfg := &config.Config{JWTSecret: "secret", JWTExpiryMinutes: 15, TokenBlacklistFailOpen: true}
+	sessions := &fakeSessionRepo{revoked: map[uuid.UUID]bool{}}
+	h := NewAuthHandler(&repository.Repositories{Session: sessions}, client, cfg)
+	user := &models.User{ID: uuid.New(), OrgID: uuid.New(), Email: "ada@example.com", Role: "admin"}
+	sessionID := uuid.New()
+	token, _ := h.generateAccessToken(user, sessionID)
+	other, _ := h.generateAccessToken(user, sessionID)
+
+	router := chi.NewRouter()
+	router.Use(middleware.JWTAuth(cfg.JWTSecret, middleware.NewTokenBlacklist(client, cfg.TokenBlacklistFailOpen)))
+	router.Post("/auth/logout", h.Logout)
+	router.Get("/auth/me", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	call := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := call("GET", "/auth/me", token); code != http.StatusOK {
+		t.Fatalf("before logout: got %d, want 200", code)
+	}
+	if code := call("POST", "/auth/logout", token); code != http.StatusOK {
+		t.Fatalf("logout: got %d, want 200", code)
+	}
+	if code := call("GET", "/auth/me", token); code != http.StatusUnauthorized {
+		t.Errorf("after logout: got %d, want 401", code)
+	}
+	if !sessions.revoked[sessionID] {
+		t.Error("logout should revoke the session")
+	}
+	// Other tokens are only cut off with their session's refresh token
+	if code := call("GET", "/auth/me", other); code != http.StatusOK {
+		t.Errorf("another token: got %d, want 200", code)
+	}
+}
+
+func TestJWTAuthMissingClaims(t *testing.T) {
+	client, _ := newFakeRedis()
+	defer client.Close()
+
+	router := chi.NewRouter()
+	router.Use(middleware.JWTAuth("secret", middleware.NewTokenBlacklist(client, true)))
+	router.Get("/auth/me", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	full := jwt.MapClaims{
+		"sub":   uuid.New().String(),
+		"orgId": uuid.New().String(),
+		"email": "ada@example.com",
+		"role":  "admin",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+	for _, missing := range []string{"", "sub", "orgId", "email", "role"} {
+		claims := jwt.MapClaims{}
+		for key, value := range full {
+			if key != missing {
+				claims[key] = value
+			}
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("GET", "/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		want := http.StatusUnauthorized
+		if missing == "" {
+			want = http.StatusOK
+		}
+		if rec.Code != want {
+			t.Errorf("missing %q: got %d, want %d", missing, rec.Code, want)
+		}
+	}
+}
+
+// Platform admins are recognized by user ID, never by the email they chose
+func TestRequirePlatformAdmin(t *testing.T) {
+	adminID := uuid.New()
+	handler := middleware.RequirePlatformAdmin([]uuid.UUID{adminID})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tt := range []struct {
+		name   string
+		userID uuid.UUID
+		want   int
+	}{
+		{"admin", adminID, http.StatusOK},
+		{"other user", uuid.New(), http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("GET", "/admin/orphans", nil)
+		ctx := context.WithValue(req.Context(), "userID", tt.userID)
+		ctx = context.WithValue(ctx, "userEmail", "ops@example.com")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req.WithContext(ctx))
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestTokenBlacklistRedisDown(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Protocol:   2,
+		MaxRetries: -1,
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, errors.New("redis down")
+		},
+	})
+	defer client.Close()
+
+	for _, failOpen := range []bool{true, false} {
+		revoked, err := middleware.NewTokenBlacklist(client, failOpen).Revoked(context.Background(), uuid.NewString())
+		if err == nil || revoked == failOpen {
+			t.Errorf("fail open %v: got revoked %v, err %v", failOpen, revoked, err)
+		}
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	client, _ := newFakeRedis()
+	defer client.Close()
+
+	cfg := &config.Config{JWTSecret: "secret", JWTExpiryMinutes: 15, RefreshExpiryHours: 24}
+	user := &models.User{ID: uuid.New(), OrgID: uuid.New(), Email: "ada@example.com", Role: "admin"}
+	session := models.NewSession(user.ID, "test-agent", "laptop", time.Now().Add(time.Hour))
+	sessions := &fakeSessionRepo{
+		sessions: map[uuid.UUID]*models.Session{session.ID: session},
+		revoked:  map[uuid.UUID]bool{},
+	}
+	h := NewAuthHandler(&repository.Repositories{User: &fakeUserRepo{user: user}, Session: sessions}, client, cfg)
+
+	refresh := func(token string) (int, string) {
+		req := httptest.NewRequest("POST", "/auth/refresh", strings.NewReader(`{"refreshToken":"`+token+`"}`))
+		req.Header.Set("User-Agent", "test-agent")
+		req.Header.Set(models.DeviceIDHeader, "laptop")
+		rec := httptest.NewRecorder()
+		h.RefreshToken(rec, req)
+
+		var body struct {
+			RefreshToken string `json:"refreshToken"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body.RefreshToken
+	}
+
+	first, err := h.issueRefreshToken(context.Background(), user, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, second := refresh(first)
+	if code != http.StatusOK || second == "" || second == first {
+		t.Fatalf("rotation: got %d and token %q, want 200 and a new token", code, second)
+	}
+	code, third := refresh(second)
+	if code != http.StatusOK || third == "" {
+		t.Fatalf("second rotation: got %d, want 200", code)
+	}
+
+	// Replaying a rotated-out token revokes the whole family
+	if code, _ := refresh(first); code != http.StatusUnauthorized {
+		t.Errorf("replay: got %d, want 401", code)
+	}
+	if !sessions.revoked[session.ID] {
+		t.Error("replay should revoke the session")
+	}
+	if code, _ := refresh(third); code != http.StatusUnauthorized {
+		t.Errorf("current token after replay: got %d, want 401", code)
+	}
+}
+
+func TestRefreshTokenRejectsOtherTokens(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret", JWTExpiryMinutes: 15, RefreshExpiryHours: 24}
+	user := &models.User{ID: uuid.New(), OrgID: uuid.New(), Email: "ada@example.com", Role: "admin"}
+	h := NewAuthHandler(&repository.Repositories{User: &fakeUserRepo{user: user}}, nil, cfg)
+
+	access, _ := h.generateAccessToken(user, uuid.New())
+	noSubject, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"type": "refresh",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(cfg.JWTSecret))
+
+	tests := []struct {
+		name, token, message string
+	}{
+		{"access token", access, "Token is not a refresh token"},
+		{"missing sub", noSubject, "Invalid refresh token"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/auth/refresh", strings.NewReader(`{"refreshToken":"`+tt.token+`"}`))
+		rec := httptest.NewRecorder()
+		h.RefreshToken(rec, req)
+
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != http.StatusUnauthorized || body.Message != tt.message {
+			t.Errorf("%s: got %d %q, want 401 %q", tt.name, rec.Code, body.Message, tt.message)
+		}
+	}
+}
+
+// fakeOAuthUserRepo keeps users in memory for the OAuth sign-in flow
+type fakeOAuthUserRepo struct {
+	repository.UserRepository
+	users []*models.User
+	orgs  []*models.Organization
+}
+
+func (f *fakeOAuthUserRepo) GetByProvider(ctx context.Context, provider, providerID string) (*models.User, error) {
+	for _, u := range f.users {
+		if u.Provider != nil && *u.Provider == provider && u.ProviderID != nil && *u.ProviderID == providerID {
+			return u, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (f *fakeOAuthUserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (f *fakeOAuthUserRepo) LinkProvider(ctx context.Context, id uuid.UUID, provider, providerID string) error {
+	for _, u := range f.users {
+		if u.ID == id {
+			u.Provider = &provider
+			u.ProviderID = &providerID
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
+
+func (f *fakeOAuthUserRepo) CreateWithOrganization(ctx context.Context, org *models.Organization, user *models.User) error {
+	f.orgs = append(f.orgs, org)
+	f.users = append(f.users, user)
+	return nil
+}
+
+func TestGoogleOAuthCallback(t *testing.T) {
+	var tokenForm url.Values
+	google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			r.ParseForm()
+			tokenForm = r.PostForm
+			if r.PostForm.Get("code") != "good-code" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+			w.Write([]byte(`{"access_token":"google-token","token_type":"Bearer"}`))
+		case "/userinfo":
+			if r.Header.Get("Authorization") != "Bearer google-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"sub":"1234","email":"ada@example.com","email_verified":true,"name":"Ada","picture":"https://example.com/ada.png"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer google.Close()
+
+	cfg := &config.Config{GoogleClientID: "client", GoogleClientSecret: "secret", FrontendURL: "https://app.example.com"}
+	newHandler := func(users *fakeOAuthUserRepo) *AuthHandler {
+		h := NewAuthHandler(&repository.Repositories{User: users}, nil, cfg)
+		h.google = loginProvider{TokenURL: google.URL + "/token", UserInfoURL: google.URL + "/userinfo"}
+		return h
+	}
+
+	t.Run("new user", func(t *testing.T) {
+		users := &fakeOAuthUserRepo{}
+		user, err := newHandler(users).handleGoogleCallback(context.Background(), "good-code")
+		if err != nil {
+			t.Fatalf("handleGoogleCallback: %v", err)
+		}
+		if tokenForm.Get("client_secret") != "secret" || tokenForm.Get("redirect_uri") != "https://app.example.com/api/v1/auth/oauth/google/callback" {
+			t.Errorf("token request form = %v", tokenForm)
+		}
+		if len(users.orgs) != 1 || users.orgs[0].ID != user.OrgID {
+			t.Fatalf("created orgs = %v, want one owning the user", users.orgs)
+		}
+		if user.Email != "ada@example.com" || user.Name != "Ada" || user.Role != "admin" ||
+			user.AvatarURL == nil || *user.AvatarURL != "https://example.com/ada.png" ||
+			user.ProviderID == nil || *user.ProviderID != "1234" {
+			t.Errorf("created user = %+v", user)
+		}
+
+		again, err := newHandler(users).handleGoogleCallback(context.Background(), "good-code")
+		if err != nil || again.ID != user.ID || len(users.users) != 1 {
+			t.Errorf("second sign-in = %v, %v; want the same user", again, err)
+		}
+	})
+
+	t.Run("links password account", func(t *testing.T) {
+		existing := &models.User{ID: uuid.New(), OrgID: uuid.New(), Email: "ada@example.com", PasswordHash: "hash", Role: "member"}
+		users := &fakeOAuthUserRepo{users: []*models.User{existing}}
+		user, err := newHandler(users).handleGoogleCallback(context.Background(), "good-code")
+		if err != nil {
+			t.Fatalf("handleGoogleCallback: %v", err)
+		}
+		if user.ID != existing.ID || len(users.orgs) != 0 {
+			t.Errorf("signed in as %v with %d new orgs, want the existing user", user.ID, len(users.orgs))
+		}
+		if existing.Provider == nil || *existing.Provider != "google" || existing.ProviderID == nil || *existing.ProviderID != "1234" {
+			t.Errorf("provider not linked: %+v", existing)
+		}
+	})
+
+	t.Run("rejected code", func(t *testing.T) {
+		if _, err := newHandler(&fakeOAuthUserRepo{}).handleGoogleCallback(context.Background(), "bad-code"); err == nil {
+			t.Error("expected an error for a rejected code")
+		}
+	})
+}
+
+func TestGitHubOAuthCallback(t *testing.T) {
+	emails := `[{"email":"old@example.com","primary":false,"verified":true},{"email":"ada@example.com","primary":true,"verified":true}]`
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			r.ParseForm()
+			if r.PostForm.Get("code") != "good-code" {
+				// GitHub rejects codes with a 200
+				w.Write([]byte(`{"error":"bad_verification_code"}`))
+				return
+			}
+			w.Write([]byte(`{"access_token":"gh-token","token_type":"bearer"}`))
+		case "/user":
+			if r.Header.Get("Authorization") != "Bearer gh-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			// The email is private, so /user leaves it out
+			w.Write([]byte(`{"id":583231,"login":"ada","name":null,"email":null,"avatar_url":"https://example.com/ada.png"}`))
+		case "/user/emails":
+			w.Write([]byte(emails))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer github.Close()
+
+	cfg := &config.Config{GitHubClientID: "client", GitHubClientSecret: "secret", FrontendURL: "https://app.example.com"}
+	newHandler := func(users *fakeOAuthUserRepo) *AuthHandler {
+		h := NewAuthHandler(&repository.Repositories{User: users}, nil, cfg)
+		h.github = loginProvider{
+			TokenURL:    github.URL + "/login/oauth/access_token",
+			UserInfoURL: github.URL + "/user",
+			EmailsURL:   github.URL + "/user/emails",
+		}
+		return h
+	}
+
+	users := &fakeOAuthUserRepo{}
+	user, err := newHandler(users).handleGitHubCallback(context.Background(), "good-code")
+	if err != nil {
+		t.Fatalf("handleGitHubCallback: %v", err)
+	}
+	if user.Email != "ada@example.com" || user.Name != "ada" ||
+		user.Provider == nil || *user.Provider != "github" ||
+		user.ProviderID == nil || *user.ProviderID != "583231" {
+		t.Errorf("created user = %+v", user)
+	}
+
+	if _, err := newHandler(&fakeOAuthUserRepo{}).handleGitHubCallback(context.Background(), "bad-code"); err == nil {
+		t.Error("expected an error for a rejected code")
+	}
+
+	emails = `[{"email":"ada@example.com","primary":true,"verified":false}]`
+	users = &fakeOAuthUserRepo{}
+	_, err = newHandler(users).handleGitHubCallback(context.Background(), "good-code")
+	var loginErr *oauthLoginError
+	if !errors.As(err, &loginErr) || loginErr.status != http.StatusBadRequest {
+		t.Errorf("unverified email: got %v, want a 400 sign-in error", err)
+	}
+	if len(users.users) != 0 {
+		t.Errorf("created %d users without a verified email", len(users.users))
+	}
+}
+
+func TestOAuthLoginState(t *testing.T) {
+	client, _ := newFakeRedis()
+	defer client.Close()
+
+	cfg := &config.Config{GitHubClientID: "client", FrontendURL: "https://app.example.com"}
+	h := NewAuthHandler(&repository.Repositories{}, client, cfg)
+
+	router := chi.NewRouter()
+	router.Get("/auth/oauth/{provider}", h.OAuthRedirect)
+	router.Get("/auth/oauth/{provider}/callback", h.OAuthCallback)
+
+	start := func() (string, *http.Cookie) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/auth/oauth/github", nil))
+
+		location, _ := url.Parse(rec.Header().Get("Location"))
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("redirect set %d cookies, want 1", len(cookies))
+		}
+		return location.Query().Get("state"), cookies[0]
+	}
+	callback := func(provider, state string, cookie *http.Cookie) int {
+		req := httptest.NewRequest("GET", "/auth/oauth/"+provider+"/callback?code=abc&state="+state, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	state, cookie := start()
+	if state == "" || cookie.Value != state {
+		t.Fatalf("state %q, cookie %q; want the same non-empty value", state, cookie.Value)
+	}
+
+	_, otherCookie := start()
+	if code := callback("github", state, otherCookie); code != http.StatusBadRequest {
+		t.Errorf("state from another browser: got %d, want 400", code)
+	}
+	if code := callback("github", state, nil); code != http.StatusBadRequest {
+		t.Errorf("no state cookie: got %d, want 400", code)
+	}
+	if code := callback("google", state, cookie); code != http.StatusBadRequest {
+		t.Errorf("state for another provider: got %d, want 400", code)
+	}
+
+	state, cookie = start()
+	if !h.checkOAuthLoginState(httptest.NewRecorder(), stateRequest(state, cookie), "github") {
+		t.Error("matching state was refused")
+	}
+	if h.checkOAuthLoginState(httptest.NewRecorder(), stateRequest(state, cookie), "github") {
+		t.Error("state was accepted twice")
+	}
+}
+
+func stateRequest(state string, cookie *http.Cookie) *http.Request {
+	req := httptest.NewRequest("GET", "/auth/oauth/github/callback?code=abc&state="+state, nil)
+	req.AddCookie(cookie)
+	return req
+}
+
+func TestIntegrationState(t *testing.T) {
+	client, _ := newFakeRedis()
+	defer client.Close()
+
+	h := &IntegrationHandler{redis: client, cfg: &config.Config{JWTSecret: "secret"}}
+	agentID, userID := uuid.New(), uuid.New()
+	ctx := context.Background()
+
+	state, err := h.newIntegrationState(agentID, userID)
+	if err != nil {
+		t.Fatalf("newIntegrationState: %v", err)
+	}
+	if strings.Contains(state, agentID.String()) {
+		t.Errorf("state %q carries the bare agent ID", state)
+	}
+
+	if _, err := h.verifyIntegrationState(ctx, state, uuid.New()); !errors.Is(err, errInvalidOAuthState) {
+		t.Errorf("another user's state: got %v, want errInvalidOAuthState", err)
+	}
+	got, err := h.verifyIntegrationState(ctx, state, userID)
+	if err != nil || got != agentID {
+		t.Fatalf("verifyIntegrationState = %v, %v; want %v", got, err, agentID)
+	}
+	if _, err := h.verifyIntegrationState(ctx, state, userID); !errors.Is(err, errInvalidOAuthState) {
+		t.Errorf("replayed state: got %v, want errInvalidOAuthState", err)
+	}
+
+	forged, _ := encodeIntegrationState("other-secret", &integrationState{AgentID: agentID, UserID: userID, Nonce: "n", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	expired, _ := encodeIntegrationState("secret", &integrationState{AgentID: agentID, UserID: userID, Nonce: "n", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	for name, value := range map[string]string{"agent ID": agentID.String(), "forged": forged, "expired": expired} {
+		if _, err := h.verifyIntegrationState(ctx, value, userID); !errors.Is(err, errInvalidOAuthState) {
+			t.Errorf("%s state: got %v, want errInvalidOAuthState", name, err)
+		}
+	}
+}
+
+func TestVerifyCredentials(t *testing.T) {
+	provider := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slack/auth.test":
+			if r.Header.Get("Authorization") == "Bearer xoxb-good" {
+				w.Write([]byte(`{"ok":true,"team":"Acme"}`))
+				return
+			}
+			w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+		case "/api/v3/user", "/rest/api/3/myself":
+			if user, pass, _ := r.BasicAuth(); user != "bot" || pass != "good" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer provider.Close()
+
+	githubConfig := `{"enterpriseUrl":"` + provider.URL + `"}`
+	jiraConfig := `{"siteUrl":"` + provider.URL + `","isCloud":true}`
+	tests := []struct {
+		provider, clientID, secret string
+		config                     *string
+		verified                   bool
+	}{
+		{"slack", "", "xoxb-good", nil, true},
+		{"slack", "", "xoxb-revoked", nil, false},
+		{"github", "bot", "good", &githubConfig, true},
+		{"github", "bot", "bad", &githubConfig, false},
+		{"jira", "bot", "good", &jiraConfig, true},
+		{"jira", "bot", "bad", &jiraConfig, false},
+	}
+	for _, tt := range tests {
+		orgID := uuid.New()
+		credentials := &fakeCredentialRepo{credential: &models.OrganizationCredential{
+			ID: uuid.New(), OrgID: orgID, Provider: tt.provider, ClientID: tt.clientID, ClientSecret: tt.secret, Config: tt.config,
+		}}
+		h := NewCredentialsHandler(&repository.Repositories{Credential: credentials}, nil, &config.Config{CredentialVerifyTimeoutSeconds: 5})
+		h.verifyClient = provider.Client()
+		h.providerEndpoints = func(name string, config *string) (models.ProviderEndpoints, error) {
+			if name == "slack" {
+				return models.ProviderEndpoints{APIBaseURL: provider.URL + "/slack"}, nil
+			}
+			return models.ResolveProviderEndpoints(name, config)
+		}
+
+		router := chi.NewRouter()
+		router.Post("/credentials/{provider}/verify", func(w http.ResponseWriter, r *http.Request) {
+			h.Verify(w, r.WithContext(context.WithValue(r.Context(), "orgID", orgID)))
+		})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/credentials/"+tt.provider+"/verify", nil))
+
+		var body struct {
+			Verified bool   `json:"verified"`
+			Error    string `json:"error"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != http.StatusOK || body.Verified != tt.verified {
+			t.Errorf("%s %s: got %d verified=%v, want 200 verified=%v", tt.provider, tt.secret, rec.Code, body.Verified, tt.verified)
+		}
+		if !tt.verified && !strings.Contains(body.Error, "rejected") {
+			t.Errorf("%s %s: error %q does not say the provider rejected the credentials", tt.provider, tt.secret, body.Error)
+		}
+		if want := map[bool]int{true: 1, false: 0}[tt.verified]; credentials.verified != want {
+			t.Errorf("%s %s: marked verified %d times, want %d", tt.provider, tt.secret, credentials.verified, want)
+		}
+	}
+}
+
+// fakeWebhookSecretRepo holds the webhook secrets of organizations by
+// connected GitHub account
+type fakeWebhookSecretRepo struct {
+	repository.CredentialRepository
+	secrets map[string][]string
+}
+
+func (f *fakeWebhookSecretRepo) ListWebhookSecrets(ctx context.Context, provider, workspace string) ([]string, error) {
+	return f.secrets[workspace], nil
+}
+
+func TestGitHubWebhookOrgSecret(t *testing.T) {
+	client, _ := newFakeRedis()
+	defer client.Close()
+
+	cfg := &config.Config{GitHubClientSecret: "global-secret", WebhookBufferSize: 1, WebhookWorkers: 1}
+	repos := &repository.Repositories{Credential: &fakeWebhookSecretRepo{secrets: map[string][]string{
+		"acme": {"acme-secret"},
+	}}}
+	h := NewWebhookHandler(repos, client, cfg)
+
+	sign := func(secret, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	acmeBody := `{"zen":"Keep it simple.","repository":{"owner":{"login":"acme"}}}`
+	otherBody := `{"zen":"Keep it simple.","repository":{"owner":{"login":"unconnected"}}}`
+
+	tests := []struct {
+		name, body, signature string
+		want                  int
+	}{
+		{"org secret", acmeBody, sign("acme-secret", acmeBody), http.StatusOK},
+		{"wrong org secret", acmeBody, sign("other-secret", acmeBody), http.StatusUnauthorized},
+		{"global secret for a connected org", acmeBody, sign("global-secret", acmeBody), http.StatusUnauthorized},
+		{"global secret fallback", otherBody, sign("global-secret", otherBody), http.StatusOK},
+		{"unsigned", acmeBody, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/webhooks/github", strings.NewReader(tt.body))
+		req.Header.Set("X-GitHub-Event", "ping")
+		if tt.signature != "" {
+			req.Header.Set("X-Hub-Signature-256", tt.signature)
+		}
+		rec := httptest.NewRecorder()
+		h.GitHub(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+// Malformed payloads are answered with 400 naming the bad field, not a panic
+func TestWebhookMalformedPayloads(t *testing.T) {
+	client, _ := newFakeRedis()
+	defer client.Close()
+
+	cfg := &config.Config{SlackClientSecret: "slack-secret", GitHubClientSecret: "github-secret", WebhookBufferSize: 1, WebhookWorkers: 1}
+	repos := &repository.Repositories{Credential: &fakeWebhookSecretRepo{}}
+	h := NewWebhookHandler(repos, client, cfg)
+
+	post := func(provider, eventType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/webhooks/"+provider, strings.NewReader(body))
+		switch provider {
+		case "slack":
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			mac := hmac.New(sha256.New, []byte(cfg.SlackClientSecret))
+			mac.Write([]byte("v0:" + timestamp + ":" + body))
+			req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+			req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		case "github":
+			mac := hmac.New(sha256.New, []byte(cfg.GitHubClientSecret))
+			mac.Write([]byte(body))
+			req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+			req.Header.Set("X-GitHub-Event", eventType)
+		}
+
+		rec := httptest.NewRecorder()
+		handlers := map[string]http.HandlerFunc{"slack": h.Slack, "github": h.GitHub, "jira": h.Jira}
+		handlers[provider](rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		provider, eventType, body, field string
+	}{
+		{"slack", "", `{"type":"url_verification"}`, "challenge"},
+		{"slack", "", `{"type":"url_verification","challenge":5}`, "challenge"},
+		{"slack", "", `{"type":"event_callback"}`, "event"},
+		{"slack", "", `{"type":"event_callback","event":"message"}`, "event"},
+		{"slack", "", `{"type":"event_callback","event":{"type":7}}`, "event.type"},
+		{"slack", "", `{"type":"event_callback","event":{"type":"message","text":["hi"]}}`, "event.text"},
+		{"github", "pull_request", `{"repository":{}}`, "action"},
+		{"github", "pull_request", `{"action":"opened","repository":"acme/api"}`, "repository"},
+		{"github", "issues", `{"action":"opened","repository":{"owner":"acme"}}`, "repository.owner"},
+		{"jira", "", `{"webhookEvent":5}`, "webhookEvent"},
+		{"jira", "", `{"webhookEvent":"jira:issue_created","issue":[]}`, "issue"},
+	}
+	for _, tt := range tests {
+		rec := post(tt.provider, tt.eventType, tt.body)
+
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(body.Message, tt.field) {
+			t.Errorf("%s %s: got %d %q, want 400 naming %s", tt.provider, tt.body, rec.Code, body.Message, tt.field)
+		}
+	}
+}
+
+type fakeWebhookAgentRepo struct {
+	repository.AgentRepository
+}
+
+func (f *fakeWebhookAgentRepo) IsOrgPaused(ctx context.Context, id uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+type fakeMaintenanceRepo struct {
+	repository.MaintenanceWindowRepository
+}
+
+func (f *fakeMaintenanceRepo) ListForAgent(ctx context.Context, agentID uuid.UUID) ([]*models.MaintenanceWindow, error) {
+	return nil, nil
+}
+
+type fakeCreatedInteractionRepo struct {
+	repository.InteractionRepository
+	created []*models.Interaction
+}
+
+func (f *fakeCreatedInteractionRepo) Create(ctx context.Context, i *models.Interaction) error {
+	copied := *i
+	f.created = append(f.created, &copied)
+	return nil
+}
+
+func TestSlackMessagePersistsInteraction(t *testing.T) {
+	client, fake := newFakeRedis()
+	defer client.Close()
+
+	agentID := uuid.New()
+	integration := &models.Integration{ID: uuid.New(), AgentID: agentID, Provider: "slack", Enabled: true}
+	interactions := &fakeCreatedInteractionRepo{}
+	h := &WebhookHandler{
+		repos: &repository.Repositories{
+			Integration: &fakeSharedIntegrationRepo{
+				integrations: []*models.Integration{integration},
+				agentIDs:     map[uuid.UUID][]uuid.UUID{integration.ID: {agentID}},
+			},
+			Agent:       &fakeWebhookAgentRepo{},
+			Maintenance: &fakeMaintenanceRepo{},
+			Interaction: interactions,
+		},
+		redis: client,
+		cfg:   &config.Config{},
+	}
+
+	event := map[string]interface{}{"type": "message", "channel": "C1", "user": "U1", "text": "deploy is failing"}
+	h.handleSlackMessage(context.Background(), eventRoute{provider: "slack", eventType: "message", workspace: "T123"}, event)
+
+	if len(interactions.created) != 1 {
+		t.Fatalf("stored %d interactions, want 1", len(interactions.created))
+	}
+	stored := interactions.created[0]
+	if stored.AgentID != agentID || stored.IntegrationID != integration.ID {
+		t.Errorf("stored interaction for agent %s via %s, want %s via %s", stored.AgentID, stored.IntegrationID, agentID, integration.ID)
+	}
+	if stored.Provider != "slack" || stored.InteractionType != "message" || stored.Status != "pending" ||
+		!strings.Contains(stored.InputData, "deploy is failing") {
+		t.Errorf("stored interaction = %+v", stored)
+	}
+
+	published := fake.published["agent:interactions"]
+	if len(published) != 1 {
+		t.Fatalf("published %d interactions, want 1", len(published))
+	}
+	var queued models.Interaction
+	json.Unmarshal([]byte(published[0]), &queued)
+	if queued.ID != stored.ID || queued.AgentID != agentID {
+		t.Errorf("published interaction %s for agent %s, want the stored one", queued.ID, queued.AgentID)
+	}
+}
+
+// fakeWorkspaceIntegrationRepo lists the integrations connected to the
+// requested workspace
+type fakeWorkspaceIntegrationRepo struct {
+	fakeSharedIntegrationRepo
+}
+
+func (f *fakeWorkspaceIntegrationRepo) ListByExternalID(ctx context.Context, provider, externalID string) ([]*models.Integration, error) {
+	var integrations []*models.Integration
+	for _, integration := range f.integrations {
+		if integration.Provider == provider && integration.InWorkspace(externalID) {
+			integrations = append(integrations, integration)
+		}
+	}
+	return integrations, nil
+}
+
+func (f *fakeWorkspaceIntegrationRepo) GetByExternalID(ctx context.Context, provider, externalID string) (*models.Integration, error) {
+	integrations, _ := f.ListByExternalID(ctx, provider, externalID)
+	if len(integrations) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	return integrations[0], nil
+}
+
+// Events from a workspace no integration is connected to are acked and
+// counted without taking a place in the buffer
+func TestUnroutedEventsAreNotQueued(t *testing.T) {
+	client, fake := newFakeRedis()
+	defer client.Close()
+
+	teamID := "T123"
+	integration := &models.Integration{ID: uuid.New(), AgentID: uuid.New(), Provider: "slack", ExternalID: &teamID, Enabled: true}
+	h := &WebhookHandler{
+		repos: &repository.Repositories{Integration: &fakeWorkspaceIntegrationRepo{fakeSharedIntegrationRepo{
+			integrations: []*models.Integration{integration},
+		}}},
+		redis: client,
+		cfg:   &config.Config{},
+		queue: worker.NewQueue(10, 1, time.Minute),
+	}
+
+	post := func(team string) int {
+		payload := map[string]interface{}{
+			"type":    "event_callback",
+			"team_id": team,
+			"event":   map[string]interface{}{"type": "message", "channel": "C1", "user": "U1", "text": "hi"},
+		}
+		rec := httptest.NewRecorder()
+		h.slackEvent(rec, httptest.NewRequest("POST", "/webhooks/slack", nil), payload, nil)
+		return rec.Code
+	}
+
+	if code := post("T999"); code != http.StatusOK {
+		t.Fatalf("unknown workspace: got status %d", code)
+	}
+	counts := fake.hashes[webhookMetricsKey(time.Now())]
+	if depth := h.queue.Stats().Depth; depth != 0 || counts["slack|message|unrouted"] != 1 {
+		t.Errorf("unknown workspace: queued %d events, counted %d unrouted; want 0 and 1", depth, counts["slack|message|unrouted"])
+	}
+
+	if code := post(teamID); code != http.StatusOK {
+		t.Fatalf("connected workspace: got status %d", code)
+	}
+	if depth := h.queue.Stats().Depth; depth != 1 || counts["slack|message|queued"] != 1 {
+		t.Errorf("connected workspace: queued %d events, counted %d queued; want 1 and 1", depth, counts["slack|message|queued"])
+	}
+}
+
+// Events reach the agents subscribed to the workspace they came from;
+// events no agent is subscribed to are counted and dropped
+func TestWebhookEventRouting(t *testing.T) {
+	client, fake := newFakeRedis()
+	defer client.Close()
+
+	agentID, teamID := uuid.New(), "T123"
+	integration := &models.Integration{ID: uuid.New(), AgentID: agentID, Provider: "slack", ExternalID: &teamID, Enabled: true}
+	interactions := &fakeCreatedInteractionRepo{}
+	h := &WebhookHandler{
+		repos: &repository.Repositories{
+			Integration: &fakeWorkspaceIntegrationRepo{fakeSharedIntegrationRepo{
+				integrations: []*models.Integration{integration},
+				agentIDs:     map[uuid.UUID][]uuid.UUID{integration.ID: {agentID}},
+			}},
+			Agent:       &fakeWebhookAgentRepo{},
+			Maintenance: &fakeMaintenanceRepo{},
+			Interaction: interactions,
+		},
+		redis: client,
+		cfg:   &config.Config{},
+	}
+
+	for _, tt := range []struct {
+		workspace string
+		routed    bool
+	}{
+		{teamID, true},
+		{"T999", false},
+		{"", false},
+	} {
+		interactions.created = nil
+		fake.published = map[string][]string{}
+		fake.hashes = map[string]map[string]int64{}
+
+		event := map[string]interface{}{"type": "message", "channel": "C1", "user": "U1", "text": "hi"}
+		h.handleSlackMessage(context.Background(), eventRoute{provider: "slack", eventType: "message", workspace: tt.workspace}, event)
+
+		stored, published := len(interactions.created), len(fake.published["agent:interactions"])
+		unrouted := fake.hashes[webhookMetricsKey(time.Now())]["slack|message|unrouted"]
+		if tt.routed {
+			if stored != 1 || published != 1 || interactions.created[0].AgentID != agentID {
+				t.Errorf("%q: stored %d and published %d interactions, want one for the agent", tt.workspace, stored, published)
+			}
+			continue
+		}
+		if stored != 0 || published != 0 || unrouted != 1 {
+			t.Errorf("%q: stored %d, published %d and counted %d unrouted; want only the count", tt.workspace, stored, published, unrouted)
+		}
+	}
+}
+
+// Unsigned Jira events posted to the public endpoint never reach an agent,
+// whatever site they name
+func TestPublicJiraEventsAreUnrouted(t *testing.T) {
+	client, fake := newFakeRedis()
+	defer client.Close()
+
+	integration := &models.Integration{ID: uuid.New(), AgentID: uuid.New(), Provider: "jira", Enabled: true}
+	integration.SetMetadata(models.AtlassianMeta{CloudID: "c0ffee", SiteURL: "https://acme.atlassian.net"})
+	h := &WebhookHandler{
+		repos: &repository.Repositories{Integration: &fakeWorkspaceIntegrationRepo{fakeSharedIntegrationRepo{
+			integrations: []*models.Integration{integration},
+			agentIDs:     map[uuid.UUID][]uuid.UUID{integration.ID: {integration.AgentID}},
+		}}},
+		redis: client,
+		cfg:   &config.Config{},
+		queue: worker.NewQueue(10, 1, time.Minute),
+	}
+
+	body := `{"webhookEvent":"jira:issue_created","issue":{"id":"10001","key":"OPS-1","self":"https://acme.atlassian.net/rest/api/2/issue/10001"}}`
+	rec := httptest.NewRecorder()
+	h.Jira(rec, httptest.NewRequest("POST", "/webhooks/jira", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	unrouted := fake.hashes[webhookMetricsKey(time.Now())]["jira|jira:issue_created|unrouted"]
+	if depth := h.queue.Stats().Depth; depth != 0 || unrouted != 1 {
+		t.Errorf("queued %d events and counted %d unrouted, want 0 and 1", depth, unrouted)
+	}
+}
+
+// Events posted with a route token reach the agents of its integration,
+// whatever workspace the payload names
+func TestRouteTokenEventsReachIntegrationAgents(t *testing.T) {
+	client, fake := newFakeRedis()
+	defer client.Close()
+
+	owner, subscriber := uuid.New(), uuid.New()
+	integration := &models.Integration{ID: uuid.New(), AgentID: owner, Provider: "jira", Enabled: true}
+	interactions := &fakeCreatedInteractionRepo{}
+	h := &WebhookHandler{
+		repos: &repository.Repositories{
+			// No integration is found by workspace
+			Integration: &fakeWorkspaceIntegrationRepo{fakeSharedIntegrationRepo{
+				agentIDs: map[uuid.UUID][]uuid.UUID{integration.ID: {owner, subscriber}},
+			}},
+			Agent:       &fakeWebhookAgentRepo{},
+			Maintenance: &fakeMaintenanceRepo{},
+			Interaction: interactions,
+		},
+		redis: client,
+		cfg:   &config.Config{},
+	}
+
+	payload := map[string]interface{}{"webhookEvent": "comment_created", "comment": map[string]interface{}{"id": "1", "body": "ping"}}
+	route := eventRoute{provider: "jira", eventType: "comment_created", integration: integration}
+	h.handleJiraComment(context.Background(), route, payload)
+
+	if len(interactions.created) != 2 || len(fake.published["agent:interactions"]) != 2 {
+		t.Fatalf("stored %d and published %d interactions, want 2", len(interactions.created), len(fake.published["agent:interactions"]))
+	}
+	for i, agentID := range []uuid.UUID{owner, subscriber} {
+		if stored := interactions.created[i]; stored.AgentID != agentID || stored.IntegrationID != integration.ID {
+			t.Errorf("stored interaction for agent %s via %s, want %s via %s", stored.AgentID, stored.IntegrationID, agentID, integration.ID)
+		}
+	}
+
+	// A disabled integration's agents receive nothing
+	interactions.created = nil
+	integration.Enabled = false
+	h.handleJiraComment(context.Background(), route, map[string]interface{}{"webhookEvent": "comment_created", "comment": map[string]interface{}{"id": "2"}})
+	if len(interactions.created) != 0 {
+		t.Errorf("stored %d interactions for a disabled integration", len(interactions.created))
+	}
+}
+
+type fakeDisconnectIntegrationRepo struct {
+	fakeIntegrationRepo
+	deleted []uuid.UUID
+}
+
+func (f *fakeDisconnectIntegrationRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+// Disconnecting revokes the token at the provider, and still deletes the
+// integration when the provider refuses
+func TestDisconnectRevokesToken(t *testing.T) {
+	var mu sync.Mutex
+	revoked := make(map[string]string)
+	failing := false
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/slack/auth.revoke":
+			revoked["slack"] = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			w.Write([]byte(`{"ok":true,"revoked":true}`))
+		case r.Method == "DELETE" && r.URL.Path == "/github/applications/gh-app/token":
+			var body struct {
+				AccessToken string `json:"access_token"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if user, pass, _ := r.BasicAuth(); user != "gh-app" || pass != "gh-secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			revoked["github"] = body.AccessToken
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "POST" && r.URL.Path == "/atlassian/oauth/revoke":
+			r.ParseForm()
+			if r.PostForm.Get("client_id") != "jira-app" || r.PostForm.Get("client_secret") != "jira-secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			revoked["jira"] = r.PostForm.Get("token") + "/" + r.PostForm.Get("token_type_hint")
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer provider.Close()
+
+	refresh := "jira-refresh"
+	tests := []struct {
+		provider, accessToken string
+		refreshToken          *string
+		want                  string
+	}{
+		{"slack", "xoxb-token", nil, "xoxb-token"},
+		{"github", "gho-token", nil, "gho-token"},
+		{"jira", "jira-access", &refresh, "jira-refresh/refresh_token"},
+	}
+	for _, fail := range []bool{false, true} {
+		for _, tt := range tests {
+			userID, orgID := uuid.New(), uuid.New()
+			agent := &models.Agent{ID: uuid.New(), UserID: userID}
+			integration := &models.Integration{
+				ID: uuid.New(), AgentID: agent.ID, Provider: tt.provider,
+				AccessToken: tt.accessToken, RefreshToken: tt.refreshToken,
+			}
+			integrations := &fakeDisconnectIntegrationRepo{fakeIntegrationRepo: fakeIntegrationRepo{integration: integration}}
+			repos := &repository.Repositories{
+				Agent:       &fakeAgentRepo{agents: map[uuid.UUID]*models.Agent{agent.ID: agent}},
+				Integration: integrations,
+				Credential:  &fakeCredentialRepo{credential: &models.OrganizationCredential{OrgID: uuid.New()}},
+			}
+			h := NewIntegrationHandler(repos, nil, &config.Config{
+				GitHubClientID: "gh-app", GitHubClientSecret: "gh-secret",
+				JiraClientID: "jira-app", JiraClientSecret: "jira-secret",
+			})
+			h.providerClient = provider.Client()
+			h.providerEndpoints = func(name string, config *string) (models.ProviderEndpoints, error) {
+				switch name {
+				case "slack":
+					return models.ProviderEndpoints{APIBaseURL: provider.URL + "/slack"}, nil
+				case "github":
+					return models.ProviderEndpoints{APIBaseURL: provider.URL + "/github"}, nil
+				default:
+					return models.ProviderEndpoints{TokenURL: provider.URL + "/atlassian/oauth/token"}, nil
+				}
+			}
+
+			mu.Lock()
+			failing = fail
+			delete(revoked, tt.provider)
+			mu.Unlock()
+
+			router := chi.NewRouter()
+			router.Delete("/integrations/{integrationID}", func(w http.ResponseWriter, r *http.Request) {
+				ctx := context.WithValue(r.Context(), "userID", userID)
+				h.Disconnect(w, r.WithContext(context.WithValue(ctx, "orgID", orgID)))
+			})
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("DELETE", "/integrations/"+integration.ID.String(), nil))
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s (provider failing %v): got status %d want 200", tt.provider, fail, rec.Code)
+			}
+			if len(integrations.deleted) != 1 || integrations.deleted[0] != integration.ID {
+				t.Errorf("%s (provider failing %v): integration not deleted", tt.provider, fail)
+			}
+			mu.Lock()
+			got := revoked[tt.provider]
+			mu.Unlock()
+			if !fail && got != tt.want {
+				t.Errorf("%s: revoked %q want %q", tt.provider, got, tt.want)
+			}
+		}
+	}
+}
+
+type fakeRefreshIntegrationRepo struct {
+	fakeIntegrationRepo
+	orgID   uuid.UUID
+	updated []models.Integration
+}
+
+func (f *fakeRefreshIntegrationRepo) OrgID(ctx context.Context, integrationID uuid.UUID) (uuid.UUID, error) {
+	return f.orgID, nil
+}
+
+func (f *fakeRefreshIntegrationRepo) Update(ctx context.Context, integration *models.Integration) error {
+	f.updated = append(f.updated, *integration)
+	return nil
+}
+
+// Refreshing stores the provider's new tokens; a refresh token the provider
+// refuses marks the integration expired
+func TestRefreshIntegration(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var grant map[string]string
+		json.NewDecoder(r.Body).Decode(&grant)
+		if grant["grant_type"] != "refresh_token" || grant["client_id"] != "jira-app" || grant["client_secret"] != "jira-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"access_denied"}`))
+			return
+		}
+		if grant["refresh_token"] != "refresh-good" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"invalid_grant","error_description":"Unknown or invalid refresh token."}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"access-new","refresh_token":"refresh-rotated","expires_in":3600}`))
+	}))
+	defer provider.Close()
+
+	tests := []struct {
+		refreshToken string
+		status       int
+		stored       string // Status the integration is stored with
+	}{
+		{"refresh-good", http.StatusOK, "active"},
+		{"refresh-stale", http.StatusConflict, "expired"},
+	}
+	for _, tt := range tests {
+		userID, orgID := uuid.New(), uuid.New()
+		agent := &models.Agent{ID: uuid.New(), UserID: userID}
+		expired := time.Now().Add(-time.Minute)
+		refreshToken := tt.refreshToken
+		integration := &models.Integration{
+			ID: uuid.New(), AgentID: agent.ID, Provider: "jira", Status: "active",
+			AccessToken: "access-old", RefreshToken: &refreshToken, ExpiresAt: &expired,
+		}
+		integrations := &fakeRefreshIntegrationRepo{fakeIntegrationRepo: fakeIntegrationRepo{integration: integration}, orgID: orgID}
+		repos := &repository.Repositories{
+			Agent:       &fakeAgentRepo{agents: map[uuid.UUID]*models.Agent{agent.ID: agent}},
+			Integration: integrations,
+			Credential:  &fakeCredentialRepo{credential: &models.OrganizationCredential{OrgID: uuid.New()}},
+		}
+		client, _ := newFakeRedis()
+		h := NewIntegrationHandler(repos, client, &config.Config{JiraClientID: "jira-app", JiraClientSecret: "jira-secret"})
+		h.providerClient = provider.Client()
+		h.providerEndpoints = func(name string, config *string) (models.ProviderEndpoints, error) {
+			return models.ProviderEndpoints{TokenURL: provider.URL + "/oauth/token"}, nil
+		}
+
+		router := chi.NewRouter()
+		router.Post("/integrations/{integrationID}/refresh", func(w http.ResponseWriter, r *http.Request) {
+			h.Refresh(w, r.WithContext(context.WithValue(r.Context(), "userID", userID)))
+		})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/integrations/"+integration.ID.String()+"/refresh", nil))
+
+		if rec.Code != tt.status {
+			t.Fatalf("%s: got status %d want %d: %s", tt.refreshToken, rec.Code, tt.status, rec.Body.String())
+		}
+		if len(integrations.updated) != 1 {
+			t.Fatalf("%s: integration updated %d times want 1", tt.refreshToken, len(integrations.updated))
+		}
+		stored := integrations.updated[0]
+		if stored.Status != tt.stored {
+			t.Errorf("%s: stored status %q want %q", tt.refreshToken, stored.Status, tt.stored)
+		}
+		if tt.stored != "active" {
+			continue
+		}
+		if stored.AccessToken != "access-new" || stored.RefreshToken == nil || *stored.RefreshToken != "refresh-rotated" {
+			t.Errorf("stored tokens %q/%v, want the refreshed ones", stored.AccessToken, stored.RefreshToken)
+		}
+		if stored.ExpiresAt == nil || time.Until(*stored.ExpiresAt) < 59*time.Minute {
+			t.Errorf("stored expiry %v, want an hour from now", stored.ExpiresAt)
+		}
+	}
+}
+
+// fakeEscalationListRepo filters and pages its escalations as the query does
+type fakeEscalationListRepo struct {
+	repository.EscalationRepository
+	items  []*models.EscalationListItem
+	filter models.EscalationFilter
+	params models.PaginationParams
+}
+
+func (f *fakeEscalationListRepo) ListEscalationsWithInteractions(ctx context.Context, userID uuid.UUID, filter models.EscalationFilter, params models.PaginationParams) ([]*models.EscalationListItem, int, error) {
+	f.filter, f.params = filter, params
+	var matched []*models.EscalationListItem
+	for _, item := range f.items {
+		if (filter.Priority == "" || item.Escalation.Priority == filter.Priority) && (filter.Status == "" || item.Escalation.Status == filter.Status) {
+			matched = append(matched, item)
+		}
+	}
+	offset := (params.Page - 1) * params.PageSize
+	if offset >= len(matched) {
+		return nil, len(matched), nil
+	}
+	return matched[offset:min(offset+params.PageSize, len(matched))], len(matched), nil
+}
+
+// fakeExportEscalationRepo streams its rows, then fails with err
+type fakeExportEscalationRepo struct {
+	repository.EscalationRepository
+	rows []*models.EscalationExport
+	err  error
+}
+
+func (f *fakeExportEscalationRepo) StreamForExport(ctx context.Context, agentIDs []uuid.UUID, filter models.EscalationExportFilter, fn func(*models.EscalationExport) error) error {
+	for _, row := range f.rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+// A failed export is never delivered as a complete file: before any row it
+// is a 500, and after one the response is aborted
+func TestExportEscalationsFailure(t *testing.T) {
+	userID := uuid.New()
+	agent := &models.Agent{ID: uuid.New(), UserID: userID, Name: "Support"}
+	row := &models.EscalationExport{
+		Escalation:  &models.Escalation{ID: uuid.New(), Status: "resolved"},
+		Interaction: &models.Interaction{ID: uuid.New()},
+		AgentName:   "Support",
+	}
+
+	export := func(format string, rows []*models.EscalationExport) (rec *httptest.ResponseRecorder, aborted bool) {
+		repos := &repository.Repositories{
+			Agent:      &fakeUserAgentRepo{fakeAgentRepo{agents: map[uuid.UUID]*models.Agent{agent.ID: agent}}},
+			Escalation: &fakeExportEscalationRepo{rows: rows, err: errors.New("connection reset")},
+		}
+		h := NewEscalationHandler(repos, nil, &config.Config{})
+
+		req := httptest.NewRequest("GET", "/escalations/export?format="+format, nil)
+		rec = httptest.NewRecorder()
+		defer func() {
+			if v := recover(); v != nil {
+				if v != http.ErrAbortHandler {
+					panic(v)
+				}
+				aborted = true
+			}
+		}()
+		h.Export(rec, req.WithContext(context.WithValue(req.Context(), "userID", userID)))
+		return rec, false
+	}
+
+	for _, format := range []string{"csv", "json"} {
+		rec, aborted := export(format, nil)
+		if aborted || rec.Code != http.StatusInternalServerError {
+			t.Errorf("%s: got status %d (aborted %v) for a failed export, want 500", format, rec.Code, aborted)
+		}
+		if rec.Header().Get("Content-Disposition") != "" {
+			t.Errorf("%s: failed export was sent as an attachment", format)
+		}
+
+		rec, aborted = export(format, []*models.EscalationExport{row})
+		if !aborted {
+			t.Errorf("%s: export failing mid-stream completed with %q", format, rec.Body.String())
+		}
+		if strings.HasSuffix(rec.Body.String(), "]") {
+			t.Errorf("%s: truncated export was closed as a complete document", format)
+		}
+	}
+}
+
+func TestListEscalations(t *testing.T) {
+	userID := uuid.New()
+	var items []*models.EscalationListItem
+	for _, priority := range []string{"urgent", "high", "high", "low", "urgent"} {
+		items = append(items, &models.EscalationListItem{
+			Escalation:  &models.Escalation{ID: uuid.New(), Priority: priority, Status: "pending"},
+			Interaction: &models.Interaction{ID: uuid.New()},
+			AgentName:   "Support",
+		})
+	}
+	escalations := &fakeEscalationListRepo{items: items}
+	h := NewEscalationHandler(&repository.Repositories{Escalation: escalations}, nil, &config.Config{DefaultPageSize: 20, MaxPageSize: 100})
+
+	list := func(query string) (*httptest.ResponseRecorder, models.PaginatedResponse, []models.EscalationListItem) {
+		req := httptest.NewRequest("GET", "/escalations?"+query, nil)
+		rec := httptest.NewRecorder()
+		h.List(rec, req.WithContext(context.WithValue(req.Context(), "userID", userID)))
+
+		var page models.PaginatedResponse
+		var data []models.EscalationListItem
+		page.Data = &data
+		json.Unmarshal(rec.Body.Bytes(), &page)
+		return rec, page, data
+	}
+
+	rec, page, data := list("priority=urgent")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if escalations.filter.Priority != "urgent" || escalations.filter.Status != "pending" {
+		t.Errorf("listed with filter %+v, want urgent pending escalations", escalations.filter)
+	}
+	if len(data) != 2 || page.TotalItems != 2 {
+		t.Fatalf("got %d of %d escalations, want 2 of 2", len(data), page.TotalItems)
+	}
+	for _, item := range data {
+		if item.Escalation.Priority != "urgent" || item.Interaction == nil || item.AgentName != "Support" {
+			t.Errorf("unexpected item %+v", item)
+		}
+	}
+
+	// The last page is partial, and pages past it are empty but keep the totals
+	_, page, data = list("priority=high&page=1&page_size=1")
+	if len(data) != 1 || page.TotalItems != 2 || page.TotalPages != 2 {
+		t.Errorf("first page: got %d items, %d total in %d pages", len(data), page.TotalItems, page.TotalPages)
+	}
+	_, page, data = list("page=3&page_size=2")
+	if escalations.params.Page != 3 || escalations.params.PageSize != 2 {
+		t.Errorf("listed with params %+v, want page 3 of size 2", escalations.params)
+	}
+	if len(data) != 1 || page.Page != 3 || page.TotalItems != 5 || page.TotalPages != 3 {
+		t.Errorf("last page: got %d items on page %d, %d total in %d pages", len(data), page.Page, page.TotalItems, page.TotalPages)
+	}
+	rec, page, data = list("page=4&page_size=2")
+	if rec.Code != http.StatusOK || data == nil || len(data) != 0 || page.TotalItems != 5 {
+		t.Errorf("past the end: got status %d, items %v, %d total", rec.Code, data, page.TotalItems)
+	}
+
+	// Page sizes are capped at the configured maximum
+	list("page_size=500")
+	if escalations.params.Page != 1 || escalations.params.PageSize != 100 {
+		t.Errorf("listed with params %+v, want page 1 of size 100", escalations.params)
+	}
+
+	for _, query := range []string{"priority=critical", "status=open"} {
+		if rec, _, _ := list(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d want 400", query, rec.Code)
+		}
+	}
+}
+
+type fakeInteractionEscalationRepo struct {
+	repository.EscalationRepository
+	escalations map[uuid.UUID]*models.Escalation
+}
+
+func (f *fakeInteractionEscalationRepo) GetByInteractionID(ctx context.Context, interactionID uuid.UUID) (*models.Escalation, error) {
+	return f.escalations[interactionID], nil
+}
+
+type fakeNoTagRepo struct {
+	repository.TagRepository
+}
+
+func (f *fakeNoTagRepo) ListForInteraction(ctx context.Context, interactionID, orgID uuid.UUID) ([]*models.InteractionTag, error) {
+	return nil, nil
+}
+
+// An escalated interaction is returned with its escalation, others with null
+func TestGetInteractionEscalation(t *testing.T) {
+	userID, orgID := uuid.New(), uuid.New()
+	agent := &models.Agent{ID: uuid.New(), UserID: userID}
+	escalated := &models.Interaction{ID: uuid.New(), AgentID: agent.ID, IntegrationID: uuid.New(), Provider: "slack", Escalated: true, Status: "escalated"}
+	completed := &models.Interaction{ID: uuid.New(), AgentID: agent.ID, IntegrationID: uuid.New(), Provider: "slack", Status: "completed"}
+	escalation := &models.Escalation{ID: uuid.New(), InteractionID: escalated.ID, AgentID: agent.ID, Reason: "Low confidence", Priority: "high", Status: "pending"}
+
+	for _, tt := range []struct {
+		interaction *models.Interaction
+		want        *uuid.UUID
+	}{
+		{escalated, &escalation.ID},
+		{completed, nil},
+	} {
+		repos := &repository.Repositories{
+			Agent:       &fakeAgentRepo{agents: map[uuid.UUID]*models.Agent{agent.ID: agent}},
+			Interaction: &fakeInteractionRepo{interaction: tt.interaction},
+			Integration: &fakeIntegrationRepo{integration: &models.Integration{}},
+			Escalation:  &fakeInteractionEscalationRepo{escalations: map[uuid.UUID]*models.Escalation{escalated.ID: escalation}},
+			Tag:         &fakeNoTagRepo{},
+		}
+		h := NewInteractionHandler(repos, nil, &config.Config{})
+
+		router := chi.NewRouter()
+		router.Get("/interactions/{interactionID}", func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "userID", userID)
+			h.Get(w, r.WithContext(context.WithValue(ctx, "orgID", orgID)))
+		})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/interactions/"+tt.interaction.ID.String(), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var body struct {
+			Escalation *models.Escalation `json:"escalation"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		switch {
+		case tt.want == nil && body.Escalation != nil:
+			t.Errorf("interaction %s: got escalation %s, want null", tt.interaction.Status, body.Escalation.ID)
+		case tt.want != nil && (body.Escalation == nil || body.Escalation.ID != *tt.want):
+			t.Errorf("interaction %s: got escalation %+v, want %s", tt.interaction.Status, body.Escalation, *tt.want)
+		}
+	}
+}
+
+// fakeOrgInteractionRepo records the organization interactions are listed for
+type fakeOrgInteractionRepo struct {
+	repository.InteractionRepository
+	listed *uuid.UUID
+	filter models.InteractionFilter
+}
+
+func (f *fakeOrgInteractionRepo) ListByOrgID(ctx context.Context, orgID uuid.UUID, filter models.InteractionFilter, params models.PaginationParams) ([]*models.OrgInteraction, int, error) {
+	f.listed, f.filter = &orgID, filter
+	return []*models.OrgInteraction{}, 0, nil
+}
+
+// Only organization admins list interactions across the organization, and
+// only their own organization's
+func TestListOrgInteractionsRequiresAdmin(t *testing.T) {
+	orgID, agentID := uuid.New(), uuid.New()
+
+	for _, tt := range []struct {
+		role string
+		want int
+	}{
+		{"member", http.StatusForbidden},
+		{"viewer", http.StatusForbidden},
+		{"admin", http.StatusOK},
+	} {
+		interactions := &fakeOrgInteractionRepo{}
+		h := NewInteractionHandler(&repository.Repositories{Interaction: interactions}, nil, &config.Config{DefaultPageSize: 20, MaxPageSize: 100})
+
+		req := httptest.NewRequest("GET", "/interactions?scope=org&agent_id="+agentID.String()+"&status=escalated", nil)
+		ctx := context.WithValue(req.Context(), "userID", uuid.New())
+		ctx = context.WithValue(ctx, "orgID", orgID)
+		rec := httptest.NewRecorder()
+		h.List(rec, req.WithContext(context.WithValue(ctx, "userRole", tt.role)))
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d want %d: %s", tt.role, rec.Code, tt.want, rec.Body.String())
+		}
+		if tt.want != http.StatusOK {
+			if interactions.listed != nil {
+				t.Errorf("%s: listed the organization's interactions", tt.role)
+			}
+			continue
+		}
+		if interactions.listed == nil || *interactions.listed != orgID {
+			t.Errorf("listed interactions of %v, want the token's organization %s", interactions.listed, orgID)
+		}
+		if interactions.filter.AgentID == nil || *interactions.filter.AgentID != agentID || interactions.filter.Status != "escalated" {
+			t.Errorf("listed with filter %+v", interactions.filter)
+		}
+	}
+}
+
+// fakeRecordInteractionRepo stores recorded interactions with their escalations
+type fakeRecordInteractionRepo struct {
+	repository.InteractionRepository
+	recorded    *models.Interaction
+	escalation  *models.Escalation
+	recordCalls int
+}
+
+func (f *fakeRecordInteractionRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Interaction, error) {
+	return nil, repository.ErrNotFound
+}
+
+func (f *fakeRecordInteractionRepo) Record(ctx context.Context, interaction *models.Interaction, escalation *models.Escalation) error {
+	f.recordCalls++
+	f.recorded, f.escalation = interaction, escalation
+	return nil
+}
+
+type fakeNoPriorityRuleRepo struct {
+	repository.PriorityRuleRepository
+}
+
+func (f *fakeNoPriorityRuleRepo) ListForAgent(ctx context.Context, agentID uuid.UUID) ([]*models.EscalationPriorityRule, error) {
+	return nil, nil
+}
+
+type fakeUnroutedRuleRepo struct {
+	repository.RoutingRuleRepository
+}
+
+func (f *fakeUnroutedRuleRepo) Assignee(ctx context.Context, agentID uuid.UUID, provider, interactionType string) (uuid.UUID, error) {
+	return uuid.Nil, repository.ErrNotFound
+}
+
+// A low-confidence interaction is saved escalated together with its
+// escalation, and callers can't set the escalated status themselves
+func TestRecordInteraction(t *testing.T) {
+	agent := &models.Agent{ID: uuid.New(), ConfidenceThreshold: 70}
+	interactions := &fakeRecordInteractionRepo{}
+	client, _ := newFakeRedis()
+	h := NewInteractionHandler(&repository.Repositories{
+		Agent:        &fakeAgentRepo{agents: map[uuid.UUID]*models.Agent{agent.ID: agent}},
+		Interaction:  interactions,
+		PriorityRule: &fakeNoPriorityRuleRepo{},
+		RoutingRule:  &fakeUnroutedRuleRepo{},
+	}, client, &config.Config{})
+
+	record := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Record(rec, httptest.NewRequest("POST", "/internal/interactions", strings.NewReader(body)))
+		return rec
+	}
+	body := func(confidence int, status string) string {
+		return fmt.Sprintf(`{"agentId":%q,"provider":"slack","interactionType":"message","inputData":{"text":"hi"},"confidenceScore":%d,"status":%q}`, agent.ID, confidence, status)
+	}
+
+	if rec := record(body(40, "")); rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if interactions.recordCalls != 1 || interactions.escalation == nil {
+		t.Fatalf("recorded %d times with escalation %v, want once with an escalation", interactions.recordCalls, interactions.escalation)
+	}
+	if !interactions.recorded.Escalated || interactions.recorded.Status != "escalated" {
+		t.Errorf("low-confidence interaction saved as %q (escalated %v)", interactions.recorded.Status, interactions.recorded.Escalated)
+	}
+	if interactions.escalation.InteractionID != interactions.recorded.ID || interactions.escalation.AssignedTo != nil {
+		t.Errorf("unexpected escalation %+v", interactions.escalation)
+	}
+
+	for _, status := range []string{"escalated", "pending", "bogus"} {
+		if rec := record(body(90, status)); rec.Code != http.StatusBadRequest {
+			t.Errorf("status %q: got %d, want 400", status, rec.Code)
+		}
+	}
+	if interactions.recordCalls != 1 {
+		t.Errorf("invalid statuses were recorded")
+	}
+}
+
+type fakeUserAgentRepo struct {
+	fakeAgentRepo
+}
+
+func (f *fakeUserAgentRepo) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Agent, error) {
+	var agents []*models.Agent
+	for _, agent := range f.agents {
+		if agent.UserID == userID {
+			agents = append(agents, agent)
+		}
+	}
+	return agents, nil
+}
+
+// fakeOverviewInteractionRepo reports per-agent metrics from raw counts
+type fakeOverviewInteractionRepo struct {
+	repository.InteractionRepository
+	counts map[uuid.UUID]models.InteractionTotals
+}
+
+func (f *fakeOverviewInteractionRepo) GetOverviewMetrics(ctx context.Context, agentID uuid.UUID, interactionType string) (*models.OverviewMetrics, error) {
+	counts := f.counts[agentID]
+	return &models.OverviewMetrics{TotalInteractions: counts.Total, EscalatedInteractions: counts.Escalated, AutonomousRate: counts.AutonomousRate()}, nil
+}
+
+// The overview's autonomous rate is exact across agents, where rebuilding
+// escalation counts from each agent's rate would lose some
+func TestOverviewAutonomousRate(t *testing.T) {
+	userID := uuid.New()
+	first := &models.Agent{ID: uuid.New(), UserID: userID, Name: "Support"}
+	second := &models.Agent{ID: uuid.New(), UserID: userID, Name: "Triage"}
+	repos := &repository.Repositories{
+		Agent: &fakeUserAgentRepo{fakeAgentRepo{agents: map[uuid.UUID]*models.Agent{first.ID: first, second.ID: second}}},
+		Interaction: &fakeOverviewInteractionRepo{counts: map[uuid.UUID]models.InteractionTotals{
+			first.ID:  {Total: 3, Escalated: 1},
+			second.ID: {Total: 7, Escalated: 3},
+		}},
+	}
+	client, _ := newFakeRedis()
+	h := NewAnalyticsHandler(repos, client, &config.Config{})
+
+	req := httptest.NewRequest("GET", "/analytics/overview", nil)
+	rec := httptest.NewRecorder()
+	h.Overview(rec, req.WithContext(context.WithValue(req.Context(), "userID", userID)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var body struct {
+		TotalInteractions int     `json:"totalInteractions"`
+		AutonomousRate    float64 `json:"autonomousRate"`
+		AgentMetrics      []struct {
+			TotalInteractions int `json:"totalInteractions"`
+		} `json:"agentMetrics"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if body.TotalInteractions != 10 || body.AutonomousRate != 60 {
+		t.Errorf("got %d interactions at %v%% autonomous, want 10 at 60%%", body.TotalInteractions, body.AutonomousRate)
+	}
+
+	// The totals come from the same, possibly cached, per-agent metrics as
+	// the agent breakdown, so the two always agree
+	var sum int
+	for _, agent := range body.AgentMetrics {
+		sum += agent.TotalInteractions
+	}
+	if sum != body.TotalInteractions {
+		t.Errorf("agent breakdown sums to %d interactions, overview reports %d", sum, body.TotalInteractions)
+	}
+}
+
+type fakeInviteUserRepo struct {
+	repository.UserRepository
+	users map[string]*models.User
+}
+
+func (f *fakeInviteUserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	if user, ok := f.users[email]; ok {
+		return user, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+type fakeMembershipRepo struct {
+	repository.MembershipRepository
+	memberships map[uuid.UUID]*models.Membership // by user
+	err         error
+	created     []*models.Membership
+}
+
+func (f *fakeMembershipRepo) Get(ctx context.Context, userID, orgID uuid.UUID) (*models.Membership, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if m, ok := f.memberships[userID]; ok && m.OrgID == orgID {
+		return m, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (f *fakeMembershipRepo) Create(ctx context.Context, m *models.Membership) error {
+	f.created = append(f.created, m)
+	return nil
+}
+
+func TestInviteMember(t *testing.T) {
+	orgID := uuid.New()
+	member := &models.User{ID: uuid.New(), Email: "member@example.com"}
+	outsider := &models.User{ID: uuid.New(), Email: "outsider@example.com"}
+	memberships := &fakeMembershipRepo{memberships: map[uuid.UUID]*models.Membership{
+		member.ID: {UserID: member.ID, OrgID: orgID, Role: "member"},
+	}}
+	h := NewOrganizationHandler(&repository.Repositories{
+		User:       &fakeInviteUserRepo{users: map[string]*models.User{member.Email: member, outsider.Email: outsider}},
+		Membership: memberships,
+	}, nil, &config.Config{})
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"new user", `{"email":"new@example.com","role":"viewer"}`, http.StatusOK},
+		{"default role", `{"email":"new@example.com"}`, http.StatusOK},
+		{"unknown role", `{"email":"new@example.com","role":"owner"}`, http.StatusBadRequest},
+		{"already a member", `{"email":"member@example.com"}`, http.StatusConflict},
+		{"existing user", `{"email":"outsider@example.com"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/organizations/members", strings.NewReader(tt.body))
+			ctx := context.WithValue(req.Context(), "orgID", orgID)
+			ctx = context.WithValue(ctx, "userRole", "admin")
+			rec := httptest.NewRecorder()
+			h.InviteMember(rec, req.WithContext(ctx))
+			if rec.Code != tt.want {
+				t.Errorf("got %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+	if len(memberships.created) != 0 {
+		t.Errorf("invites created %d memberships, want none before acceptance", len(memberships.created))
+	}
+}
+
+func TestOrgMembershipLookupError(t *testing.T) {
+	userID, orgID := uuid.New(), uuid.New()
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "userID", userID)
+			ctx = context.WithValue(ctx, "orgID", orgID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+
+	memberships := &fakeMembershipRepo{}
+	router.Use(middleware.RequireOrgMembership(middleware.NewRoleCache(memberships, nil, 0)))
+	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	call := func() int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec.Code
+	}
+
+	if code := call(); code != http.StatusForbidden {
+		t.Errorf("non-member: got %d, want 403", code)
+	}
+	memberships.err = errors.New("connection refused")
+	if code := call(); code != http.StatusInternalServerError {
+		t.Errorf("database error: got %d, want 500", code)
+	}
+}
+
+type fakeTrainingRepo struct {
+	repository.TrainingRepository
+	inserted int
+}
+
+func (f *fakeTrainingRepo) CreateBatch(ctx context.Context, samples []*models.TrainingSample) error {
+	f.inserted += len(samples)
+	return nil
+}
+
+func TestUploadTrainingLimits(t *testing.T) {
+	client, _ := newFakeRedis()
+	defer client.Close()
+
+	training := &fakeTrainingRepo{}
+	h := NewAgentHandler(&repository.Repositories{Training: training}, client, &config.Config{
+		TrainingUploadMaxMB:     1,
+		TrainingImportBatchSize: 10,
+		TrainingMaxInputChars:   100,
+		TrainingMaxOutputChars:  100,
+		TrainingImportWorkers:   1,
+		TrainingImportQueueSize: 1,
+		TrainingImportsPerUser:  1,
+	})
+	agent := &models.Agent{ID: uuid.New()}
+
+	upload := func(userID uuid.UUID) int {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "samples.ndjson")
+		part.Write([]byte(`{"sampleType":"message","inputText":"hi","outputText":"hello"}` + "\n"))
+		form.Close()
+
+		req := httptest.NewRequest("POST", "/training/upload", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		ctx := context.WithValue(req.Context(), "agent", agent)
+		ctx = context.WithValue(ctx, "userID", userID)
+		rec := httptest.NewRecorder()
+		h.UploadTraining(rec, req.WithContext(ctx))
+		return rec.Code
+	}
+
+	alice, bob := uuid.New(), uuid.New()
+	if code := upload(alice); code != http.StatusAccepted {
+		t.Fatalf("first upload: got %d, want 202", code)
+	}
+	if code := upload(alice); code != http.StatusTooManyRequests {
+		t.Errorf("upload over the per-user limit: got %d, want 429", code)
+	}
+	if code := upload(bob); code != http.StatusServiceUnavailable {
+		t.Errorf("upload into a full queue: got %d, want 503", code)
+	}
+	// A rejected upload gives its slot back
+	if code := upload(bob); code != http.StatusServiceUnavailable {
+		t.Errorf("retried upload into a full queue: got %d, want 503", code)
+	}
+
+	// Shutting down finishes the queued import, which frees its slot
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.RunTrainingImports(ctx)
+	if training.inserted != 1 {
+		t.Errorf("queued import inserted %d samples, want 1", training.inserted)
+	}
+	if code := upload(alice); code != http.StatusAccepted {
+		t.Errorf("upload after the import finished: got %d, want 202", code)
+	}
+	h.RunTrainingImports(ctx)
+}
+
+type fakeNoFlagsOrgRepo struct {
+	repository.OrganizationRepository
+}
+
+func (f *fakeNoFlagsOrgRepo) GetFeatureFlags(ctx context.Context, id uuid.UUID) (map[string]bool, error) {
+	return nil, nil
+}
+
+type fakeReplayInteractionRepo struct {
+	repository.InteractionRepository
+}
+
+func (f *fakeReplayInteractionRepo) ListByAgentInRange(ctx context.Context, agentID uuid.UUID, from, to time.Time, limit int) ([]*models.Interaction, error) {
+	return []*models.Interaction{{ID: uuid.New(), AgentID: agentID, Provider: "slack", InputData: "hi"}}, nil
+}
+
+type fakeReplayRepo struct {
+	repository.ReplayRepository
+	mu      sync.Mutex
+	created []*models.InteractionReplay
+}
+
+func (f *fakeReplayRepo) Create(ctx context.Context, replay *models.InteractionReplay) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.created = append(f.created, replay)
+	return nil
+}
+
+func TestReplayLimits(t *testing.T) {
+	client, _ := newFakeRedis()
+	defer client.Close()
+	ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"completed","confidence":90}`))
+	}))
+	defer ai.Close()
+
+	replays := &fakeReplayRepo{}
+	h := NewAgentHandler(&repository.Repositories{
+		Organization: &fakeNoFlagsOrgRepo{},
+		Interaction:  &fakeReplayInteractionRepo{},
+		Replay:       replays,
+	}, client, &config.Config{
+		AgentServiceURL: ai.URL,
+		ReplayWorkers:   1,
+		ReplayQueueSize: 1,
+		ReplaysPerUser:  1,
+	})
+
+	replay := func(userID uuid.UUID, agent *models.Agent) int {
+		req := httptest.NewRequest("POST", "/agents/replay", strings.NewReader(`{"from":"2026-01-01T00:00:00Z","to":"2026-02-01T00:00:00Z"}`))
+		ctx := context.WithValue(req.Context(), "agent", agent)
+		ctx = context.WithValue(ctx, "userID", userID)
+		ctx = context.WithValue(ctx, "orgID", uuid.New())
+		rec := httptest.NewRecorder()
+		h.Replay(rec, req.WithContext(ctx))
+		return rec.Code
+	}
+
+	alice, bob := uuid.New(), uuid.New()
+	support, triage, sales := &models.Agent{ID: uuid.New()}, &models.Agent{ID: uuid.New()}, &models.Agent{ID: uuid.New()}
+	if code := replay(alice, support); code != http.StatusAccepted {
+		t.Fatalf("first replay: got %d, want 202", code)
+	}
+	if code := replay(bob, support); code != http.StatusConflict {
+		t.Errorf("second replay of the same agent: got %d, want 409", code)
+	}
+	if code := replay(alice, triage); code != http.StatusTooManyRequests {
+		t.Errorf("replay over the per-user limit: got %d, want 429", code)
+	}
+	if code := replay(bob, sales); code != http.StatusServiceUnavailable {
+		t.Errorf("replay into a full queue: got %d, want 503", code)
+	}
+	// A rejected replay gives its slots back
+	if code := replay(bob, sales); code != http.StatusServiceUnavailable {
+		t.Errorf("retried replay into a full queue: got %d, want 503", code)
+	}
+
+	// Shutting down finishes the queued run, which frees its slots
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.RunReplays(ctx)
+	if len(replays.created) != 1 {
+		t.Errorf("queued run stored %d replays, want 1", len(replays.created))
+	}
+	if code := replay(alice, support); code != http.StatusAccepted {
+		t.Errorf("replay after the run finished: got %d, want 202", code)
+	}
+	h.RunReplays(ctx)
+}
+
+type fakeOrgAgentRepo struct {
+	fakeAgentRepo
+}
+
+func (f *fakeOrgAgentRepo) ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.Agent, error) {
+	agents := make([]*models.Agent, 0, len(f.agents))
+	for _, agent := range f.agents {
+		agents = append(agents, agent)
+	}
+	return agents, nil
+}
+
+// fakeMetricsRepo counts metric queries per agent
+type fakeMetricsRepo struct {
+	repository.InteractionRepository
+	mu      sync.Mutex
+	queries map[uuid.UUID]int
+	failing map[uuid.UUID]bool
+}
+
+func (f *fakeMetricsRepo) GetOverviewMetrics(ctx context.Context, agentID uuid.UUID, interactionType string) (*models.OverviewMetrics, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failing[agentID] {
+		return nil, errors.New("replica unavailable")
+	}
+	f.queries[agentID]++
+	return &models.OverviewMetrics{TotalInteractions: f.queries[agentID]}, nil
+}
+
+func (f *fakeMetricsRepo) GetTrends(ctx context.Context, agentID uuid.UUID, days int, interactionType string) ([]*models.TrendData, error) {
+	return []*models.TrendData{}, nil
+}
+
+func TestAnalyticsCacheInvalidation(t *testing.T) {
+	client, _ := newFakeRedis()
+	defer client.Close()
+
+	agentID := uuid.New()
+	metrics := &fakeMetricsRepo{queries: map[uuid.UUID]int{}}
+	h := NewAnalyticsHandler(&repository.Repositories{Interaction: metrics}, client, &config.Config{})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := h.overviewMetrics(ctx, agentID, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if metrics.queries[agentID] != 1 {
+		t.Fatalf("queried %d times, want the second read cached", metrics.queries[agentID])
+	}
+
+	// A write to the agent's interactions makes the next read recompute
+	invalidateAgentAnalytics(ctx, client, agentID)
+	got, err := h.overviewMetrics(ctx, agentID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.queries[agentID] != 2 || got.TotalInteractions != 2 {
+		t.Errorf("after a write: queried %d times and served %d, want fresh metrics", metrics.queries[agentID], got.TotalInteractions)
+	}
+}
+
+func TestRecomputeLocks(t *testing.T) {
+	client, _ := newFakeRedis()
+	defer client.Close()
+
+	orgID := uuid.New()
+	first := &models.Agent{ID: uuid.New()}
+	second := &models.Agent{ID: uuid.New()}
+	metrics := &fakeMetricsRepo{queries: map[uuid.UUID]int{}, failing: map[uuid.UUID]bool{second.ID: true}}
+	h := NewAnalyticsHandler(&repository.Repositories{
+		Agent:       &fakeOrgAgentRepo{fakeAgentRepo{agents: map[uuid.UUID]*models.Agent{first.ID: first, second.ID: second}}},
+		Interaction: metrics,
+	}, client, &config.Config{})
+
+	recompute := func(agentID *uuid.UUID) int {
+		target := "/analytics/recompute"
+		if agentID != nil {
+			target += "?agent_id=" + agentID.String()
+		}
+		req := httptest.NewRequest("POST", target, nil)
+		ctx := context.WithValue(req.Context(), "orgID", orgID)
+		ctx = context.WithValue(ctx, "userRole", "admin")
+		rec := httptest.NewRecorder()
+		h.Recompute(rec, req.WithContext(ctx))
+		return rec.Code
+	}
+
+	if code := recompute(&first.ID); code != http.StatusOK {
+		t.Fatalf("first agent: got %d, want 200", code)
+	}
+	if code := recompute(&first.ID); code != http.StatusTooManyRequests {
+		t.Errorf("first agent again: got %d, want 429", code)
+	}
+	if code := recompute(&second.ID); code != http.StatusInternalServerError {
+		t.Errorf("failing agent: got %d, want 500", code)
+	}
+
+	// The failed run released its lock, and agents don't hold the org's lock
+	metrics.failing = nil
+	if code := recompute(&second.ID); code != http.StatusOK {
+		t.Errorf("retry after failure: got %d, want 200", code)
+	}
+	if code := recompute(nil); code != http.StatusOK {
+		t.Errorf("organization: got %d, want 200", code)
+	}
+	if code := recompute(nil); code != http.StatusTooManyRequests {
+		t.Errorf("organization again: got %d, want 429", code)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vibber/backend/internal/worker"
+	"github.com/vibber/backend/pkg/response"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// HealthHandler reports whether the API and its background workers are
+// able to serve
+type HealthHandler struct {
+	db      *pgxpool.Pool
+	redis   *redis.Client
+	workers *worker.Registry
+}
+
+func NewHealthHandler(db *pgxpool.Pool, redis *redis.Client, workers *worker.Registry) *HealthHandler {
+	return &HealthHandler{
+		db:      db,
+		redis:   redis,
+		workers: workers,
+	}
+}
+
+// Ready checks the database, Redis and that no background worker is
+// overdue, answering 503 if any check fails
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]string{"database": "ok", "redis": "ok", "workers": "ok"}
+	ready := true
+	if err := h.db.Ping(ctx); err != nil {
+		checks["database"], ready = err.Error(), false
+	}
+	if err := h.redis.Ping(ctx).Err(); err != nil {
+		checks["redis"], ready = err.Error(), false
+	}
+	if !h.workers.Healthy() {
+		checks["workers"], ready = worker.WorkerUnhealthy, false
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	response.JSON(w, status, map[string]interface{}{
+		"ready":  ready,
+		"checks": checks,
+	})
+}
+
+// Workers lists the background workers with when they last ran
+func (h *HealthHandler) Workers(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"healthy": h.workers.Healthy(),
+		"workers": h.workers.Statuses(),
+	})
+}
@@ -2,29 +2,48 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 
 	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/ratelimit"
 	"github.com/vibber/backend/internal/repository"
 	"github.com/vibber/backend/pkg/response"
 )
 
 type IntegrationHandler struct {
-	repos *repository.Repositories
-	redis *redis.Client
-	cfg   *config.Config
+	repos   *repository.Repositories
+	redis   *redis.Client
+	cfg     *config.Config
+	limiter *ratelimit.Limiter
+
+	// Calls to providers' OAuth and API endpoints, and where those are
+	providerClient    *http.Client
+	providerEndpoints func(provider string, config *string) (models.ProviderEndpoints, error)
 }
 
 func NewIntegrationHandler(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *IntegrationHandler {
 	return &IntegrationHandler{
-		repos: repos,
-		redis: redis,
-		cfg:   cfg,
+		repos:   repos,
+		redis:   redis,
+		cfg:     cfg,
+		limiter: ratelimit.NewLimiter(redis, cfg),
+
+		providerClient:    &http.Client{Timeout: 30 * time.Second},
+		providerEndpoints: models.ResolveProviderEndpoints,
 	}
 }
 
@@ -44,7 +63,7 @@ func (h *IntegrationHandler) List(w http.ResponseWriter, r *http.Request) {
 		integrations, _ := h.repos.Integration.ListByAgentID(r.Context(), agent.ID)
 		for _, i := range integrations {
 			allIntegrations = append(allIntegrations, map[string]interface{}{
-				"integration": i,
+				"integration": toIntegrationResponse(i),
 				"agentName":   agent.Name,
 			})
 		}
@@ -55,25 +74,45 @@ func (h *IntegrationHandler) List(w http.ResponseWriter, r *http.Request) {
 
 func (h *IntegrationHandler) Connect(w http.ResponseWriter, r *http.Request) {
 	provider := chi.URLParam(r, "provider")
-	agentID := r.URL.Query().Get("agent_id")
 
-	if agentID == "" {
+	if r.URL.Query().Get("agent_id") == "" {
 		response.Error(w, http.StatusBadRequest, "agent_id is required")
 		return
 	}
+	agentID, err := uuid.Parse(r.URL.Query().Get("agent_id"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid agent ID")
+		return
+	}
+
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
+	clientID, _, endpoints, err := h.providerApp(r.Context(), orgID, provider)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The agent ID travels in a signed state bound to the user, with a
+	// nonce so each authorization is completed once
+	state, err := h.newIntegrationState(agentID, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to start connection")
+		return
+	}
 
 	var authURL string
-	state := agentID // Use agent ID as state for callback
 
 	switch provider {
 	case "slack":
-		authURL = h.getSlackAuthURL(state)
+		// Passive (reaction-only) installs never ask for chat:write
+		authURL = h.getSlackAuthURL(state, clientID, endpoints, r.URL.Query().Get("mode") == "passive")
 	case "github":
-		authURL = h.getGitHubIntegrationAuthURL(state)
+		authURL = h.getGitHubIntegrationAuthURL(state, clientID, endpoints)
 	case "jira":
-		authURL = h.getJiraAuthURL(state)
+		authURL = h.getJiraAuthURL(state, clientID, endpoints)
 	case "confluence":
-		authURL = h.getConfluenceAuthURL(state)
+		authURL = h.getConfluenceAuthURL(state, clientID, endpoints)
 	default:
 		response.Error(w, http.StatusBadRequest, "Unsupported provider")
 		return
@@ -85,29 +124,47 @@ func (h *IntegrationHandler) Connect(w http.ResponseWriter, r *http.Request) {
 func (h *IntegrationHandler) Callback(w http.ResponseWriter, r *http.Request) {
 	provider := chi.URLParam(r, "provider")
 	code := r.URL.Query().Get("code")
-	state := r.URL.Query().Get("state") // Contains agent ID
+	state := r.URL.Query().Get("state")
 
 	if code == "" || state == "" {
 		response.Error(w, http.StatusBadRequest, "Missing authorization code or state")
 		return
 	}
 
-	agentID, err := uuid.Parse(state)
+	// Scope upgrades use a random state bound to the integration instead of an agent ID
+	if upgrade, ok := h.takeScopeUpgrade(r.Context(), state); ok {
+		h.completeScopeUpgrade(w, r, provider, code, upgrade)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uuid.UUID)
+	agentID, err := h.verifyIntegrationState(r.Context(), state, userID)
+	if errors.Is(err, errInvalidOAuthState) {
+		response.Error(w, http.StatusBadRequest, "Invalid OAuth state")
+		return
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to verify OAuth state")
+		return
+	}
+
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	_, _, endpoints, err := h.providerApp(r.Context(), orgID, provider)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, "Invalid agent ID")
+		response.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// Exchange code for tokens based on provider
 	switch provider {
 	case "slack":
-		err = h.handleSlackCallback(r.Context(), agentID, code)
+		err = h.handleSlackCallback(r.Context(), agentID, code, endpoints)
 	case "github":
-		err = h.handleGitHubIntegrationCallback(r.Context(), agentID, code)
+		err = h.handleGitHubIntegrationCallback(r.Context(), agentID, code, endpoints)
 	case "jira":
-		err = h.handleJiraCallback(r.Context(), agentID, code)
+		err = h.handleJiraCallback(r.Context(), agentID, code, endpoints)
 	case "confluence":
-		err = h.handleConfluenceCallback(r.Context(), agentID, code)
+		err = h.handleConfluenceCallback(r.Context(), agentID, code, endpoints)
 	default:
 		response.Error(w, http.StatusBadRequest, "Unsupported provider")
 		return
@@ -133,17 +190,23 @@ func (h *IntegrationHandler) Disconnect(w http.ResponseWriter, r *http.Request)
 	// Verify ownership through agent
 	integration, err := h.repos.Integration.GetByID(r.Context(), integrationID)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Integration not found")
+		respondLookupError(w, err, "Integration not found")
 		return
 	}
 
 	userID := r.Context().Value("userID").(uuid.UUID)
-	agent, _ := h.repos.Agent.GetByID(r.Context(), integration.AgentID)
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
+	if _, err := requireAgentOwnership(r.Context(), h.repos, integration.AgentID, userID); err != nil {
+		respondResourceOwnershipError(w, err, "Integration not found")
 		return
 	}
 
+	// A token the provider won't revoke is logged; the user still wants the
+	// integration gone
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	if err := h.revokeToken(r.Context(), orgID, integration); err != nil {
+		log.Warn().Err(err).Str("integration_id", integration.ID.String()).Str("provider", integration.Provider).Msg("Failed to revoke integration token")
+	}
+
 	if err := h.repos.Integration.Delete(r.Context(), integrationID); err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to disconnect integration")
 		return
@@ -152,6 +215,219 @@ func (h *IntegrationHandler) Disconnect(w http.ResponseWriter, r *http.Request)
 	response.JSON(w, http.StatusOK, map[string]string{"message": "Integration disconnected"})
 }
 
+// Attach subscribes the {agentID} agent to an integration owned by another
+// of the user's agents, so both receive its events
+func (h *IntegrationHandler) Attach(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+	integration, ok := h.ownedIntegration(w, r)
+	if !ok {
+		return
+	}
+
+	if integration.AgentID != agent.ID {
+		// One integration per provider, as for integrations the agent owns
+		existing, err := h.repos.Integration.GetByAgentAndProvider(r.Context(), agent.ID, integration.Provider)
+		if err != nil && !isNotFound(err) {
+			response.Error(w, http.StatusInternalServerError, "Failed to attach integration")
+			return
+		}
+		if existing != nil && existing.ID != integration.ID {
+			response.Error(w, http.StatusConflict, fmt.Sprintf("Agent already has a %s integration", integration.Provider))
+			return
+		}
+		if err := h.repos.Integration.AttachAgent(r.Context(), integration.ID, agent.ID); err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to attach integration")
+			return
+		}
+		h.auditIntegration(r, "integration.agent_attached", agent.ID, integration.ID)
+	}
+
+	h.respondAgentIDs(w, r, integration)
+}
+
+// Detach unsubscribes the {agentID} agent from an integration it was
+// attached to. An integration cannot be detached from the agent owning it;
+// it is disconnected instead.
+func (h *IntegrationHandler) Detach(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+	integration, ok := h.ownedIntegration(w, r)
+	if !ok {
+		return
+	}
+
+	if integration.AgentID == agent.ID {
+		response.Error(w, http.StatusBadRequest, "Cannot detach an integration from the agent that owns it")
+		return
+	}
+	if err := h.repos.Integration.DetachAgent(r.Context(), integration.ID, agent.ID); err != nil {
+		respondLookupError(w, err, "Integration not attached to agent")
+		return
+	}
+	h.auditIntegration(r, "integration.agent_detached", agent.ID, integration.ID)
+
+	h.respondAgentIDs(w, r, integration)
+}
+
+// ownedIntegration loads the {integrationID} integration, checking the user
+// owns the agent that owns it
+func (h *IntegrationHandler) ownedIntegration(w http.ResponseWriter, r *http.Request) (*models.Integration, bool) {
+	integrationID, err := uuid.Parse(chi.URLParam(r, "integrationID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid integration ID")
+		return nil, false
+	}
+
+	integration, err := h.repos.Integration.GetByID(r.Context(), integrationID)
+	if err != nil {
+		respondLookupError(w, err, "Integration not found")
+		return nil, false
+	}
+
+	userID := r.Context().Value("userID").(uuid.UUID)
+	if _, err := requireAgentOwnership(r.Context(), h.repos, integration.AgentID, userID); err != nil {
+		respondResourceOwnershipError(w, err, "Integration not found")
+		return nil, false
+	}
+	return integration, true
+}
+
+func (h *IntegrationHandler) auditIntegration(r *http.Request, action string, agentID, integrationID uuid.UUID) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	resourceType := "integration"
+	writeAudit(r, h.repos, &models.AuditLog{
+		OrgID:        &orgID,
+		UserID:       &userID,
+		AgentID:      &agentID,
+		Action:       action,
+		ResourceType: &resourceType,
+		ResourceID:   &integrationID,
+	})
+}
+
+func (h *IntegrationHandler) respondAgentIDs(w http.ResponseWriter, r *http.Request, integration *models.Integration) {
+	agentIDs, err := h.repos.Integration.ListAgentIDs(r.Context(), integration.ID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to list integration agents")
+		return
+	}
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"integration": toIntegrationResponse(integration),
+		"agentIds":    agentIDs,
+	})
+}
+
+// routeTokenProviders are the providers whose events can be posted to a
+// token-authorized webhook URL
+var routeTokenProviders = map[string]bool{"slack": true, "github": true, "jira": true}
+
+// RotateRouteToken issues a secret webhook URL for an integration, for
+// providers that can't sign requests, invalidating any previous one. The
+// token is only returned once.
+func (h *IntegrationHandler) RotateRouteToken(w http.ResponseWriter, r *http.Request) {
+	integration, ok := h.ownedIntegration(w, r)
+	if !ok {
+		return
+	}
+	if !routeTokenProviders[integration.Provider] {
+		response.Error(w, http.StatusBadRequest, fmt.Sprintf("%s integrations do not receive webhooks", integration.Provider))
+		return
+	}
+
+	token, hash, err := models.GenerateWebhookRouteToken()
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	if err := h.repos.Integration.SetRouteTokenHash(r.Context(), integration.ID, &hash); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to rotate webhook token")
+		return
+	}
+	h.auditIntegration(r, "integration.route_token_rotated", integration.AgentID, integration.ID)
+
+	response.JSON(w, http.StatusOK, map[string]string{
+		"token":      token,
+		"webhookUrl": h.cfg.FrontendURL + "/api/v1/webhooks/" + integration.Provider + "/" + token,
+		"message":    "Store this URL now, it will not be shown again",
+	})
+}
+
+// RevokeRouteToken disables an integration's secret webhook URL; events must
+// then be signed
+func (h *IntegrationHandler) RevokeRouteToken(w http.ResponseWriter, r *http.Request) {
+	integration, ok := h.ownedIntegration(w, r)
+	if !ok {
+		return
+	}
+
+	if integration.RouteTokenHash != nil {
+		if err := h.repos.Integration.SetRouteTokenHash(r.Context(), integration.ID, nil); err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to revoke webhook token")
+			return
+		}
+		integration.RouteTokenHash = nil
+		h.auditIntegration(r, "integration.route_token_revoked", integration.AgentID, integration.ID)
+	}
+
+	response.JSON(w, http.StatusOK, toIntegrationResponse(integration))
+}
+
+// Enable resumes acting on events through an integration
+func (h *IntegrationHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	h.setEnabled(w, r, true)
+}
+
+// Disable stops the agent acting through an integration without
+// disconnecting it, so the token and history are kept
+func (h *IntegrationHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	h.setEnabled(w, r, false)
+}
+
+func (h *IntegrationHandler) setEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	integrationID, err := uuid.Parse(chi.URLParam(r, "integrationID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid integration ID")
+		return
+	}
+
+	integration, err := h.repos.Integration.GetByID(r.Context(), integrationID)
+	if err != nil {
+		respondLookupError(w, err, "Integration not found")
+		return
+	}
+
+	userID := r.Context().Value("userID").(uuid.UUID)
+	if _, err := requireAgentOwnership(r.Context(), h.repos, integration.AgentID, userID); err != nil {
+		respondResourceOwnershipError(w, err, "Integration not found")
+		return
+	}
+
+	if integration.Enabled != enabled {
+		if err := h.repos.Integration.SetEnabled(r.Context(), integration.ID, enabled); err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to update integration")
+			return
+		}
+		integration.Enabled = enabled
+
+		orgID := r.Context().Value("orgID").(uuid.UUID)
+		action := "integration.disabled"
+		if enabled {
+			action = "integration.enabled"
+		}
+		resourceType := "integration"
+		writeAudit(r, h.repos, &models.AuditLog{
+			OrgID:        &orgID,
+			UserID:       &userID,
+			AgentID:      &integration.AgentID,
+			Action:       action,
+			ResourceType: &resourceType,
+			ResourceID:   &integration.ID,
+		})
+	}
+
+	response.JSON(w, http.StatusOK, toIntegrationResponse(integration))
+}
+
 func (h *IntegrationHandler) Status(w http.ResponseWriter, r *http.Request) {
 	integrationID, err := uuid.Parse(chi.URLParam(r, "integrationID"))
 	if err != nil {
@@ -161,45 +437,398 @@ func (h *IntegrationHandler) Status(w http.ResponseWriter, r *http.Request) {
 
 	integration, err := h.repos.Integration.GetByID(r.Context(), integrationID)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Integration not found")
+		respondLookupError(w, err, "Integration not found")
+		return
+	}
+
+	// Verify ownership through agent
+	userID := r.Context().Value("userID").(uuid.UUID)
+	if _, err := requireAgentOwnership(r.Context(), h.repos, integration.AgentID, userID); err != nil {
+		respondResourceOwnershipError(w, err, "Integration not found")
 		return
 	}
 
 	// Check if token is still valid
 	status := "active"
+	if integration.Status == "error" || integration.Status == "revoked" {
+		status = integration.Status
+	}
 	if integration.ExpiresAt != nil && integration.ExpiresAt.Before(time.Now()) {
 		status = "expired"
 	}
 
+	resp := models.IntegrationStatusResponse{
+		IntegrationResponse: toIntegrationResponse(integration),
+		MissingScopes:       models.MissingScopes(integration.Scopes, models.RequiredScopesFor(integration, "")),
+	}
+	resp.Status = status
+
+	grants, err := h.repos.Integration.ListScopeGrants(r.Context(), integration.ID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch scope grants")
+		return
+	}
+	resp.ScopeGrants = grants
+
+	// Limiter state is informational, so a Redis failure doesn't fail the request
+	if state, err := h.limiter.State(r.Context(), integration.Provider, integration.ID); err == nil {
+		resp.RateLimit = state
+	}
+
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// AcquireRateLimit takes a provider API token for an integration (internal
+// use). The AI service calls this before each provider request and waits for
+// Retry-After when it gets a 429.
+func (h *IntegrationHandler) AcquireRateLimit(w http.ResponseWriter, r *http.Request) {
+	integrationID, err := uuid.Parse(chi.URLParam(r, "integrationID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid integration ID")
+		return
+	}
+
+	integration, err := h.repos.Integration.GetByID(r.Context(), integrationID)
+	if err != nil {
+		respondLookupError(w, err, "Integration not found")
+		return
+	}
+
+	allowed, wait, err := h.limiter.Take(r.Context(), integration.Provider, integration.ID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to check rate limit")
+		return
+	}
+
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		response.JSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"allowed":      false,
+			"retryAfterMs": wait.Milliseconds(),
+		})
+		return
+	}
+
 	response.JSON(w, http.StatusOK, map[string]interface{}{
-		"status":    status,
-		"provider":  integration.Provider,
-		"scopes":    integration.Scopes,
-		"expiresAt": integration.ExpiresAt,
+		"allowed": true,
 	})
 }
 
+// ReportRateLimited records that the provider answered 429 for an integration
+// (internal use) so every worker backs off for the provider's Retry-After
+func (h *IntegrationHandler) ReportRateLimited(w http.ResponseWriter, r *http.Request) {
+	integrationID, err := uuid.Parse(chi.URLParam(r, "integrationID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid integration ID")
+		return
+	}
+
+	var req struct {
+		RetryAfterSeconds int `json:"retryAfterSeconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	integration, err := h.repos.Integration.GetByID(r.Context(), integrationID)
+	if err != nil {
+		respondLookupError(w, err, "Integration not found")
+		return
+	}
+
+	retryAfter := time.Duration(req.RetryAfterSeconds) * time.Second
+	if err := h.limiter.Backoff(r.Context(), integration.Provider, integration.ID, retryAfter); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to record backoff")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Backoff recorded"})
+}
+
+// VerifyScopes checks the integration was granted the scopes needed for an
+// interaction type before the AI service acts on it (internal use). Missing
+// scopes put the integration in the error state so the user is asked to reconnect.
+func (h *IntegrationHandler) VerifyScopes(w http.ResponseWriter, r *http.Request) {
+	integrationID, err := uuid.Parse(chi.URLParam(r, "integrationID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid integration ID")
+		return
+	}
+
+	integration, err := h.repos.Integration.GetByID(r.Context(), integrationID)
+	if err != nil {
+		respondLookupError(w, err, "Integration not found")
+		return
+	}
+
+	interactionType := r.URL.Query().Get("interaction_type")
+	missing := models.MissingScopes(integration.Scopes, models.RequiredScopesFor(integration, interactionType))
+	if len(missing) == 0 {
+		response.JSON(w, http.StatusOK, map[string]interface{}{
+			"ok":            true,
+			"missingScopes": missing,
+		})
+		return
+	}
+
+	integration.Status = "error"
+	if err := h.repos.Integration.Update(r.Context(), integration); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to update integration status")
+		return
+	}
+
+	response.JSON(w, http.StatusConflict, map[string]interface{}{
+		"ok":            false,
+		"error":         true,
+		"message":       "Missing scope, please reconnect the " + integration.Provider + " integration",
+		"missingScopes": missing,
+	})
+}
+
+// scopeUpgradeTTL is how long the user has to finish a scope upgrade at the provider
+const scopeUpgradeTTL = 10 * time.Minute
+
+func scopeUpgradeKey(state string) string {
+	return "oauth:scope-upgrade:" + state
+}
+
+// RequestScopes starts adding scopes to an integration without reconnecting
+// it. The response carries the provider's authorize URL asking for the
+// existing scopes plus the new ones; the OAuth callback then updates the
+// integration's token and scopes in place.
+func (h *IntegrationHandler) RequestScopes(w http.ResponseWriter, r *http.Request) {
+	integrationID, err := uuid.Parse(chi.URLParam(r, "integrationID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid integration ID")
+		return
+	}
+
+	var req models.ScopeUpgradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	integration, err := h.repos.Integration.GetByID(r.Context(), integrationID)
+	if err != nil {
+		respondLookupError(w, err, "Integration not found")
+		return
+	}
+
+	userID := r.Context().Value("userID").(uuid.UUID)
+	if _, err := requireAgentOwnership(r.Context(), h.repos, integration.AgentID, userID); err != nil {
+		respondResourceOwnershipError(w, err, "Integration not found")
+		return
+	}
+
+	if !models.SupportsIncrementalAuth(integration.Provider) {
+		response.Error(w, http.StatusBadRequest, "Reconnect the "+integration.Provider+" integration to change its scopes")
+		return
+	}
+
+	added := models.MissingScopes(integration.Scopes, req.Scopes)
+	if len(added) == 0 {
+		response.Error(w, http.StatusBadRequest, "All requested scopes are already granted")
+		return
+	}
+
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	clientID, _, endpoints, err := h.providerApp(r.Context(), orgID, integration.Provider)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	state, err := newOAuthState()
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to start scope upgrade")
+		return
+	}
+
+	upgrade := &models.PendingScopeUpgrade{
+		IntegrationID: integration.ID,
+		UserID:        userID,
+		Scopes:        models.UnionScopes(integration.Scopes, added),
+	}
+	data, err := json.Marshal(upgrade)
+	if err == nil {
+		err = h.redis.Set(r.Context(), scopeUpgradeKey(state), data, scopeUpgradeTTL).Err()
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to start scope upgrade")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"authUrl": h.getGitHubScopeUpgradeURL(state, clientID, endpoints, upgrade.Scopes),
+		"scopes":  upgrade.Scopes,
+		"added":   added,
+	})
+}
+
+// takeScopeUpgrade returns and forgets the scope upgrade started with state,
+// so each authorization can only be completed once
+func (h *IntegrationHandler) takeScopeUpgrade(ctx context.Context, state string) (*models.PendingScopeUpgrade, bool) {
+	data, err := h.redis.GetDel(ctx, scopeUpgradeKey(state)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	upgrade := &models.PendingScopeUpgrade{}
+	if err := json.Unmarshal(data, upgrade); err != nil {
+		return nil, false
+	}
+	return upgrade, true
+}
+
+// completeScopeUpgrade exchanges the callback's code for a token carrying
+// the upgraded scopes and stores it on the existing integration
+func (h *IntegrationHandler) completeScopeUpgrade(w http.ResponseWriter, r *http.Request, provider, code string, upgrade *models.PendingScopeUpgrade) {
+	fail := func(msg string) {
+		http.Redirect(w, r, h.cfg.FrontendURL+"/integrations?error="+url.QueryEscape(msg), http.StatusTemporaryRedirect)
+	}
+
+	userID := r.Context().Value("userID").(uuid.UUID)
+	if userID != upgrade.UserID {
+		fail("Scope upgrade was started by another user")
+		return
+	}
+
+	integration, err := h.repos.Integration.GetByID(r.Context(), upgrade.IntegrationID)
+	if err != nil || integration.Provider != provider {
+		fail("Integration not found")
+		return
+	}
+
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	clientID, clientSecret, endpoints, err := h.providerApp(r.Context(), orgID, provider)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	token, granted, err := h.exchangeGitHubCode(r.Context(), clientID, clientSecret, code, endpoints)
+	if err != nil {
+		log.Error().Err(err).Str("integration_id", integration.ID.String()).Msg("Failed to exchange code for scope upgrade")
+		fail("Failed to authorize with " + provider)
+		return
+	}
+
+	previous := integration.Scopes
+	integration.AccessToken = token
+	integration.Scopes = granted
+	if integration.Status == "error" && len(models.MissingScopes(granted, models.RequiredScopesFor(integration, ""))) == 0 {
+		integration.Status = "active"
+	}
+
+	grant := &models.IntegrationScopeGrant{
+		ID:            uuid.New(),
+		IntegrationID: integration.ID,
+		Scopes:        models.MissingScopes(previous, granted),
+		GrantedBy:     &userID,
+	}
+	if err := h.repos.Integration.UpgradeScopes(r.Context(), integration, grant); err != nil {
+		log.Error().Err(err).Str("integration_id", integration.ID.String()).Msg("Failed to store upgraded scopes")
+		fail("Failed to update integration")
+		return
+	}
+
+	resourceType := "integration"
+	oldValue, _ := json.Marshal(previous)
+	newValue, _ := json.Marshal(granted)
+	oldStr, newStr := string(oldValue), string(newValue)
+	writeAudit(r, h.repos, &models.AuditLog{
+		OrgID:        &orgID,
+		UserID:       &userID,
+		AgentID:      &integration.AgentID,
+		Action:       "integration.scopes_upgraded",
+		ResourceType: &resourceType,
+		ResourceID:   &integration.ID,
+		OldValue:     &oldStr,
+		NewValue:     &newStr,
+	})
+
+	http.Redirect(w, r, h.cfg.FrontendURL+"/integrations?success="+provider+"&scopes=upgraded", http.StatusTemporaryRedirect)
+}
+
+// providerApp resolves the OAuth client ID, client secret and endpoints for a
+// provider, preferring the organization's own app credentials and instance
+// URLs over the global public cloud app
+func (h *IntegrationHandler) providerApp(ctx context.Context, orgID uuid.UUID, provider string) (string, string, models.ProviderEndpoints, error) {
+	var clientID, clientSecret string
+	switch provider {
+	case "slack":
+		clientID, clientSecret = h.cfg.SlackClientID, h.cfg.SlackClientSecret
+	case "github":
+		clientID, clientSecret = h.cfg.GitHubClientID, h.cfg.GitHubClientSecret
+	case "jira", "confluence":
+		clientID, clientSecret = h.cfg.JiraClientID, h.cfg.JiraClientSecret
+	}
+
+	var config *string
+	credential, err := h.repos.Credential.GetByOrgAndProvider(ctx, orgID, provider)
+	if isNotFound(err) && provider == "confluence" {
+		// Atlassian uses the same app for Jira/Confluence
+		credential, err = h.repos.Credential.GetByOrgAndProvider(ctx, orgID, "jira")
+	}
+	if err == nil && credential.IsActive {
+		clientID = credential.ClientID
+		clientSecret = credential.ClientSecret
+		config = credential.Config
+	}
+
+	endpoints, err := h.providerEndpoints(provider, config)
+	if err != nil {
+		return "", "", models.ProviderEndpoints{}, err
+	}
+	return clientID, clientSecret, endpoints, nil
+}
+
 // OAuth URL generators
-func (h *IntegrationHandler) getSlackAuthURL(state string) string {
-	return "https://slack.com/oauth/v2/authorize?" +
-		"client_id=" + h.cfg.SlackClientID +
-		"&scope=channels:history,channels:read,chat:write,reactions:write,users:read" +
+// Slack OAuth scopes requested for regular and passive installs
+const (
+	slackScopes        = "channels:history,channels:read,chat:write,reactions:write,users:read"
+	slackPassiveScopes = "channels:history,channels:read,reactions:write,users:read"
+)
+
+func (h *IntegrationHandler) getSlackAuthURL(state, clientID string, endpoints models.ProviderEndpoints, passive bool) string {
+	scopes := slackScopes
+	if passive {
+		scopes = slackPassiveScopes
+	}
+	return endpoints.AuthorizeURL + "?" +
+		"client_id=" + clientID +
+		"&scope=" + scopes +
 		"&redirect_uri=" + h.cfg.FrontendURL + "/api/v1/integrations/slack/callback" +
 		"&state=" + state
 }
 
-func (h *IntegrationHandler) getGitHubIntegrationAuthURL(state string) string {
-	return "https://github.com/login/oauth/authorize?" +
-		"client_id=" + h.cfg.GitHubClientID +
+func (h *IntegrationHandler) getGitHubIntegrationAuthURL(state, clientID string, endpoints models.ProviderEndpoints) string {
+	return endpoints.AuthorizeURL + "?" +
+		"client_id=" + clientID +
 		"&scope=repo,read:org" +
 		"&redirect_uri=" + h.cfg.FrontendURL + "/api/v1/integrations/github/callback" +
 		"&state=" + state
 }
 
-func (h *IntegrationHandler) getJiraAuthURL(state string) string {
-	return "https://auth.atlassian.com/authorize?" +
-		"audience=api.atlassian.com" +
-		"&client_id=" + h.cfg.JiraClientID +
+// getGitHubScopeUpgradeURL asks for scopes, which must include the ones
+// already granted: GitHub issues a token for exactly the scopes requested
+func (h *IntegrationHandler) getGitHubScopeUpgradeURL(state, clientID string, endpoints models.ProviderEndpoints, scopes []string) string {
+	return endpoints.AuthorizeURL + "?" +
+		"client_id=" + clientID +
+		"&scope=" + url.QueryEscape(strings.Join(scopes, ",")) +
+		"&redirect_uri=" + h.cfg.FrontendURL + "/api/v1/integrations/github/callback" +
+		"&state=" + state
+}
+
+func (h *IntegrationHandler) getJiraAuthURL(state, clientID string, endpoints models.ProviderEndpoints) string {
+	return endpoints.AuthorizeURL + "?" +
+		atlassianAudience(endpoints) +
+		"client_id=" + clientID +
 		"&scope=read:jira-work%20write:jira-work%20read:jira-user%20offline_access" +
 		"&redirect_uri=" + h.cfg.FrontendURL + "/api/v1/integrations/jira/callback" +
 		"&state=" + state +
@@ -207,10 +836,10 @@ func (h *IntegrationHandler) getJiraAuthURL(state string) string {
 		"&prompt=consent"
 }
 
-func (h *IntegrationHandler) getConfluenceAuthURL(state string) string {
-	return "https://auth.atlassian.com/authorize?" +
-		"audience=api.atlassian.com" +
-		"&client_id=" + h.cfg.JiraClientID + // Atlassian uses same app for Jira/Confluence
+func (h *IntegrationHandler) getConfluenceAuthURL(state, clientID string, endpoints models.ProviderEndpoints) string {
+	return endpoints.AuthorizeURL + "?" +
+		atlassianAudience(endpoints) +
+		"client_id=" + clientID +
 		"&scope=read:confluence-content.all%20write:confluence-content%20offline_access" +
 		"&redirect_uri=" + h.cfg.FrontendURL + "/api/v1/integrations/confluence/callback" +
 		"&state=" + state +
@@ -218,27 +847,102 @@ func (h *IntegrationHandler) getConfluenceAuthURL(state string) string {
 		"&prompt=consent"
 }
 
-// Callback handlers - these would exchange codes for tokens
-func (h *IntegrationHandler) handleSlackCallback(ctx context.Context, agentID uuid.UUID, code string) error {
+// atlassianAudience is only understood by Atlassian Cloud; Data Center
+// instances reject it
+func atlassianAudience(endpoints models.ProviderEndpoints) string {
+	if !endpoints.IsCloud {
+		return ""
+	}
+	return "audience=api.atlassian.com&"
+}
+
+// Callback handlers - these would exchange codes for tokens at endpoints.TokenURL
+func (h *IntegrationHandler) handleSlackCallback(ctx context.Context, agentID uuid.UUID, code string, endpoints models.ProviderEndpoints) error {
 	// Exchange code for token using Slack API
 	// Store integration in database
 	return nil
 }
 
-func (h *IntegrationHandler) handleGitHubIntegrationCallback(ctx context.Context, agentID uuid.UUID, code string) error {
-	// Exchange code for token using GitHub API
+func (h *IntegrationHandler) handleGitHubIntegrationCallback(ctx context.Context, agentID uuid.UUID, code string, endpoints models.ProviderEndpoints) error {
+	// Exchange code for token using GitHub (or GitHub Enterprise Server) API
 	// Store integration in database
 	return nil
 }
 
-func (h *IntegrationHandler) handleJiraCallback(ctx context.Context, agentID uuid.UUID, code string) error {
+func (h *IntegrationHandler) handleJiraCallback(ctx context.Context, agentID uuid.UUID, code string, endpoints models.ProviderEndpoints) error {
 	// Exchange code for token using Atlassian API
 	// Store integration in database
 	return nil
 }
 
-func (h *IntegrationHandler) handleConfluenceCallback(ctx context.Context, agentID uuid.UUID, code string) error {
+func (h *IntegrationHandler) handleConfluenceCallback(ctx context.Context, agentID uuid.UUID, code string, endpoints models.ProviderEndpoints) error {
 	// Exchange code for token using Atlassian API
 	// Store integration in database
 	return nil
 }
+
+// exchangeGitHubCode trades an authorization code for an access token and the
+// scopes GitHub granted with it
+func (h *IntegrationHandler) exchangeGitHubCode(ctx context.Context, clientID, clientSecret, code string, endpoints models.ProviderEndpoints) (string, []string, error) {
+	form := url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"code":          {code},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoints.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.providerClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		Scope            string `json:"scope"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", nil, fmt.Errorf("invalid token response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if result.Error != "" || result.AccessToken == "" {
+		return "", nil, fmt.Errorf("token exchange failed: %s %s", result.Error, result.ErrorDescription)
+	}
+
+	scopes := []string{}
+	for _, scope := range strings.Split(result.Scope, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return result.AccessToken, scopes, nil
+}
+
+// toIntegrationResponse converts an integration to its client-facing shape
+func toIntegrationResponse(i *models.Integration) models.IntegrationResponse {
+	scopes := i.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return models.IntegrationResponse{
+		ID:            i.ID,
+		AgentID:       i.AgentID,
+		Provider:      i.Provider,
+		Scopes:        scopes,
+		Status:        i.Status,
+		ExternalID:    i.ExternalID,
+		Metadata:      i.Metadata,
+		Passive:       i.Passive,
+		Enabled:       i.Enabled,
+		RouteTokenSet: i.RouteTokenHash != nil,
+		CreatedAt:     i.CreatedAt,
+		ExpiresAt:     i.ExpiresAt,
+	}
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/worker"
+	"github.com/vibber/backend/pkg/response"
+)
+
+const (
+	// tokenRefreshWindow is how long before expiry the refresher renews a token
+	tokenRefreshWindow = 10 * time.Minute
+	// tokenRefreshBatchSize bounds how many integrations one pass refreshes
+	tokenRefreshBatchSize = 100
+	// tokenRefreshLockTTL bounds how long a crashed refresh blocks the next
+	tokenRefreshLockTTL = time.Minute
+)
+
+var (
+	// errRefreshTokenExpired is the provider refusing the refresh token; the
+	// integration has to be reconnected
+	errRefreshTokenExpired = errors.New("refresh token expired or revoked")
+	errNoRefreshToken      = errors.New("integration has no refresh token")
+	errRefreshInProgress   = errors.New("token refresh already in progress")
+)
+
+// refreshGrantErrors are the OAuth errors providers answer a dead refresh
+// token with
+var refreshGrantErrors = map[string]bool{
+	"invalid_grant":         true, // Atlassian, RFC 6749
+	"invalid_refresh_token": true, // Slack
+	"bad_refresh_token":     true, // GitHub
+}
+
+func tokenRefreshLockKey(integrationID uuid.UUID) string {
+	return "integration:refresh-lock:" + integrationID.String()
+}
+
+// Refresh renews the integration's access token with its refresh token
+func (h *IntegrationHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	integrationID, err := uuid.Parse(chi.URLParam(r, "integrationID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid integration ID")
+		return
+	}
+
+	integration, err := h.repos.Integration.GetByID(r.Context(), integrationID)
+	if err != nil {
+		respondLookupError(w, err, "Integration not found")
+		return
+	}
+
+	// Verify ownership through agent
+	userID := r.Context().Value("userID").(uuid.UUID)
+	if _, err := requireAgentOwnership(r.Context(), h.repos, integration.AgentID, userID); err != nil {
+		respondResourceOwnershipError(w, err, "Integration not found")
+		return
+	}
+
+	integration, err = h.RefreshIntegration(r.Context(), integrationID)
+	switch {
+	case err == nil:
+		response.JSON(w, http.StatusOK, toIntegrationResponse(integration))
+	case errors.Is(err, errNoRefreshToken):
+		response.Error(w, http.StatusBadRequest, "Integration does not use refresh tokens")
+	case errors.Is(err, errRefreshTokenExpired):
+		response.Error(w, http.StatusConflict, "Refresh token expired; reconnect the integration")
+	case errors.Is(err, errRefreshInProgress):
+		response.Error(w, http.StatusConflict, "Token refresh already in progress")
+	default:
+		log.Error().Err(err).Str("integration_id", integrationID.String()).Msg("Failed to refresh integration token")
+		response.Error(w, http.StatusBadGateway, "Failed to refresh integration token")
+	}
+}
+
+// RefreshIntegration trades the integration's refresh token for a new access
+// token and stores both. A refresh token the provider refuses marks the
+// integration expired and returns errRefreshTokenExpired. Refreshes of one
+// integration are serialized, since providers rotating refresh tokens
+// invalidate the old one on first use.
+func (h *IntegrationHandler) RefreshIntegration(ctx context.Context, integrationID uuid.UUID) (*models.Integration, error) {
+	locked, err := h.redis.SetNX(ctx, tokenRefreshLockKey(integrationID), 1, tokenRefreshLockTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, errRefreshInProgress
+	}
+	defer h.redis.Del(context.WithoutCancel(ctx), tokenRefreshLockKey(integrationID))
+
+	// Read under the lock, so a refresh that just finished is seen
+	integration, err := h.repos.Integration.GetByID(ctx, integrationID)
+	if err != nil {
+		return nil, err
+	}
+	if integration.RefreshToken == nil || *integration.RefreshToken == "" {
+		return nil, errNoRefreshToken
+	}
+
+	orgID, err := h.repos.Integration.OrgID(ctx, integrationID)
+	if err != nil {
+		return nil, err
+	}
+	clientID, clientSecret, endpoints, err := h.providerApp(ctx, orgID, integration.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := h.requestTokenRefresh(ctx, integration.Provider, clientID, clientSecret, *integration.RefreshToken, endpoints)
+	if errors.Is(err, errRefreshTokenExpired) {
+		integration.Status = "expired"
+		if updateErr := h.repos.Integration.Update(ctx, integration); updateErr != nil {
+			return nil, updateErr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	integration.AccessToken = tokens.AccessToken
+	if tokens.RefreshToken != "" {
+		integration.RefreshToken = &tokens.RefreshToken
+	}
+	integration.ExpiresAt = nil
+	if tokens.ExpiresIn > 0 {
+		expiresAt := time.Now().UTC().Add(time.Duration(tokens.ExpiresIn) * time.Second)
+		integration.ExpiresAt = &expiresAt
+	}
+	integration.Status = "active"
+	if err := h.repos.Integration.Update(ctx, integration); err != nil {
+		return nil, err
+	}
+	return integration, nil
+}
+
+// refreshedTokens is a provider's answer to a refresh_token grant
+type refreshedTokens struct {
+	OK               *bool  `json:"ok"` // Slack only
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// requestTokenRefresh posts a refresh_token grant to the provider's token
+// endpoint. Atlassian takes JSON; Slack and GitHub take a form.
+func (h *IntegrationHandler) requestTokenRefresh(ctx context.Context, provider, clientID, clientSecret, refreshToken string, endpoints models.ProviderEndpoints) (*refreshedTokens, error) {
+	grant := map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": refreshToken,
+		"client_id":     clientID,
+		"client_secret": clientSecret,
+	}
+
+	var body io.Reader
+	contentType := "application/x-www-form-urlencoded"
+	switch provider {
+	case "slack", "github":
+		form := url.Values{}
+		for key, value := range grant {
+			form.Set(key, value)
+		}
+		body = strings.NewReader(form.Encode())
+	case "jira", "confluence":
+		payload, _ := json.Marshal(grant)
+		body = bytes.NewReader(payload)
+		contentType = "application/json"
+	default:
+		return nil, fmt.Errorf("token refresh is not supported for %s", provider)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoints.TokenURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.providerClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tokens := &refreshedTokens{}
+	if err := json.NewDecoder(resp.Body).Decode(tokens); err != nil {
+		return nil, fmt.Errorf("invalid token response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if refreshGrantErrors[tokens.Error] {
+		return nil, fmt.Errorf("%w: %s %s", errRefreshTokenExpired, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.Error != "" || (tokens.OK != nil && !*tokens.OK) || tokens.AccessToken == "" {
+		return nil, fmt.Errorf("token refresh failed (HTTP %d): %s %s", resp.StatusCode, tokens.Error, tokens.ErrorDescription)
+	}
+	return tokens, nil
+}
+
+// RunTokenRefresher refreshes integrations nearing expiry on every sweep
+// interval until ctx is cancelled, reporting each pass to hb
+func (h *IntegrationHandler) RunTokenRefresher(ctx context.Context, hb *worker.Heartbeat) {
+	ticker := time.NewTicker(time.Duration(h.cfg.SweepIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hb.Ran(h.RefreshExpiring(ctx))
+		}
+	}
+}
+
+// RefreshExpiring runs a single pass, refreshing integrations expiring within
+// tokenRefreshWindow. Only a failure to list them is returned; failed
+// refreshes are logged and retried next pass.
+func (h *IntegrationHandler) RefreshExpiring(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(h.cfg.SweepIntervalSeconds)*time.Second)
+	defer cancel()
+
+	integrations, err := h.repos.Integration.ListExpiring(ctx, time.Now().Add(tokenRefreshWindow), tokenRefreshBatchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list expiring integrations")
+		return err
+	}
+
+	var refreshed int
+	for _, integration := range integrations {
+		_, err := h.RefreshIntegration(ctx, integration.ID)
+		switch {
+		case err == nil:
+			refreshed++
+		case errors.Is(err, errRefreshInProgress):
+		case errors.Is(err, errRefreshTokenExpired):
+			log.Warn().Err(err).Str("integration_id", integration.ID.String()).Str("provider", integration.Provider).Msg("Integration needs reconnecting")
+		default:
+			log.Error().Err(err).Str("integration_id", integration.ID.String()).Str("provider", integration.Provider).Msg("Failed to refresh integration token")
+		}
+	}
+
+	if refreshed > 0 {
+		log.Info().Int("refreshed", refreshed).Msg("Refreshed expiring integration tokens")
+	}
+	return nil
+}
@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 
 	"github.com/vibber/backend/internal/config"
 	"github.com/vibber/backend/internal/models"
@@ -32,24 +36,21 @@ func NewInteractionHandler(repos *repository.Repositories, redis *redis.Client,
 func (h *InteractionHandler) List(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(uuid.UUID)
 	agentIDStr := r.URL.Query().Get("agent_id")
-	pageStr := r.URL.Query().Get("page")
-	pageSizeStr := r.URL.Query().Get("page_size")
 	provider := r.URL.Query().Get("provider")
 	status := r.URL.Query().Get("status")
 
-	page := 1
-	pageSize := 20
-
-	if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-		page = p
+	params, ok := parsePagination(w, r, h.cfg)
+	if !ok {
+		return
 	}
-	if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
-		pageSize = ps
+	tagID, ok := h.tagFilter(w, r)
+	if !ok {
+		return
 	}
 
-	params := models.PaginationParams{
-		Page:     page,
-		PageSize: pageSize,
+	if r.URL.Query().Get("scope") == "org" {
+		h.listForOrg(w, r, agentIDStr, models.InteractionFilter{Provider: provider, Status: status, TagID: tagID}, params)
+		return
 	}
 
 	var allInteractions []*models.Interaction
@@ -63,9 +64,8 @@ func (h *InteractionHandler) List(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Verify ownership
-		agent, err := h.repos.Agent.GetByID(r.Context(), agentID)
-		if err != nil || agent.UserID != userID {
-			response.Error(w, http.StatusForbidden, "Access denied")
+		if _, err := requireAgentOwnership(r.Context(), h.repos, agentID, userID); err != nil {
+			respondOwnershipError(w, err)
 			return
 		}
 
@@ -110,7 +110,152 @@ func (h *InteractionHandler) List(w http.ResponseWriter, r *http.Request) {
 		totalCount = len(filtered)
 	}
 
-	response.Paginated(w, allInteractions, page, pageSize, totalCount)
+	// Filter by tag if specified
+	if tagID != nil && len(allInteractions) > 0 {
+		ids := make([]uuid.UUID, len(allInteractions))
+		for i, interaction := range allInteractions {
+			ids[i] = interaction.ID
+		}
+		tagged, err := h.repos.Tag.FilterTagged(r.Context(), *tagID, ids)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to fetch interactions")
+			return
+		}
+		filtered := make([]*models.Interaction, 0)
+		for _, i := range allInteractions {
+			if tagged[i.ID] {
+				filtered = append(filtered, i)
+			}
+		}
+		allInteractions = filtered
+		totalCount = len(filtered)
+	}
+
+	response.Paginated(w, allInteractions, params.Page, params.PageSize, totalCount)
+}
+
+// tagFilter resolves the ?tag= query parameter, a tag name from the
+// organization's vocabulary, to its ID. No tag filter yields nil.
+func (h *InteractionHandler) tagFilter(w http.ResponseWriter, r *http.Request) (*uuid.UUID, bool) {
+	name := models.NormalizeTagName(r.URL.Query().Get("tag"))
+	if name == "" {
+		return nil, true
+	}
+
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	tag, err := h.repos.Tag.GetByName(r.Context(), orgID, name)
+	if isNotFound(err) {
+		response.Error(w, http.StatusBadRequest, "Unknown tag")
+		return nil, false
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch interactions")
+		return nil, false
+	}
+	return &tag.ID, true
+}
+
+// listForOrg lists interactions for every agent in the organization so admins
+// can audit agent behavior across the team
+func (h *InteractionHandler) listForOrg(w http.ResponseWriter, r *http.Request, agentIDStr string, filter models.InteractionFilter, params models.PaginationParams) {
+	userRole := r.Context().Value("userRole").(string)
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	if agentIDStr != "" {
+		agentID, err := uuid.Parse(agentIDStr)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid agent ID")
+			return
+		}
+		filter.AgentID = &agentID
+	}
+
+	interactions, total, err := h.repos.Interaction.ListByOrgID(r.Context(), orgID, filter, params)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch interactions")
+		return
+	}
+
+	response.Paginated(w, interactions, params.Page, params.PageSize, total)
+}
+
+// ListCursor lists the user's interactions newest first using an opaque
+// cursor instead of page offsets, so pages stay stable while new
+// interactions arrive (API v2)
+func (h *InteractionHandler) ListCursor(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(uuid.UUID)
+	query := r.URL.Query()
+
+	limit, ok := parsePageSize(w, r, "limit", h.cfg)
+	if !ok {
+		return
+	}
+
+	var after *models.InteractionCursor
+	if c := query.Get("cursor"); c != "" {
+		cursor, err := models.DecodeInteractionCursor(c)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		after = cursor
+	}
+
+	var agentIDs []uuid.UUID
+	if agentIDStr := query.Get("agent_id"); agentIDStr != "" {
+		agentID, err := uuid.Parse(agentIDStr)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid agent ID")
+			return
+		}
+		if _, err := requireAgentOwnership(r.Context(), h.repos, agentID, userID); err != nil {
+			respondOwnershipError(w, err)
+			return
+		}
+		agentIDs = []uuid.UUID{agentID}
+	} else {
+		agents, err := h.repos.Agent.ListByUserID(r.Context(), userID)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to fetch interactions")
+			return
+		}
+		for _, agent := range agents {
+			agentIDs = append(agentIDs, agent.ID)
+		}
+	}
+
+	tagID, ok := h.tagFilter(w, r)
+	if !ok {
+		return
+	}
+	filter := models.InteractionFilter{
+		Provider: query.Get("provider"),
+		Status:   query.Get("status"),
+		TagID:    tagID,
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	interactions, err := h.repos.Interaction.ListByAgentIDsAfter(r.Context(), agentIDs, filter, after, limit+1)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch interactions")
+		return
+	}
+
+	nextCursor := ""
+	if len(interactions) > limit {
+		interactions = interactions[:limit]
+		last := interactions[limit-1]
+		nextCursor = models.InteractionCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	if interactions == nil {
+		interactions = []*models.Interaction{}
+	}
+
+	response.CursorPaginated(w, interactions, nextCursor)
 }
 
 func (h *InteractionHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -128,22 +273,61 @@ func (h *InteractionHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	// Verify ownership through agent
 	userID := r.Context().Value("userID").(uuid.UUID)
-	agent, _ := h.repos.Agent.GetByID(r.Context(), interaction.AgentID)
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
+	agent, err := requireAgentOwnership(r.Context(), h.repos, interaction.AgentID, userID)
+	if err != nil {
+		respondResourceOwnershipError(w, err, "Interaction not found")
 		return
 	}
 
 	// Get related escalation if exists
-	var escalation interface{}
+	var escalation *models.Escalation
 	if interaction.Escalated {
-		// Would need a method to get escalation by interaction ID
+		escalation, err = h.repos.Escalation.GetByInteractionID(r.Context(), interaction.ID)
+		if err != nil {
+			log.Warn().Err(err).Str("interaction_id", interaction.ID.String()).Msg("Failed to load interaction escalation")
+		}
+	}
+
+	// Resolve the integration the interaction came through. One that has
+	// since been removed is reported as a placeholder.
+	var source *models.InteractionSource
+	if interaction.IntegrationID == uuid.Nil {
+		source = models.DeletedInteractionSource(interaction.Provider)
+	} else if integration, err := h.repos.Integration.GetByID(r.Context(), interaction.IntegrationID); err == nil {
+		source = models.ResolveInteractionSource(interaction, integration)
+	} else if isNotFound(err) {
+		source = models.DeletedInteractionSource(interaction.Provider)
+	} else {
+		log.Warn().Err(err).Str("interaction_id", interaction.ID.String()).Msg("Failed to load interaction integration")
+	}
+
+	// Resolve who applied the correction, if any
+	var correctedBy interface{}
+	if interaction.CorrectedBy != nil {
+		if corrector, err := h.repos.User.GetByID(r.Context(), *interaction.CorrectedBy); err == nil {
+			correctedBy = map[string]interface{}{
+				"id":   corrector.ID,
+				"name": corrector.Name,
+			}
+		}
+	}
+
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	tags, err := h.repos.Tag.ListForInteraction(r.Context(), interaction.ID, orgID)
+	if err != nil {
+		log.Warn().Err(err).Str("interaction_id", interaction.ID.String()).Msg("Failed to load interaction tags")
+	}
+	if tags == nil {
+		tags = []*models.InteractionTag{}
 	}
 
 	response.JSON(w, http.StatusOK, map[string]interface{}{
 		"interaction": interaction,
 		"agent":       agent,
 		"escalation":  escalation,
+		"correctedBy": correctedBy,
+		"source":      source,
+		"tags":        tags,
 	})
 }
 
@@ -162,9 +346,9 @@ func (h *InteractionHandler) Feedback(w http.ResponseWriter, r *http.Request) {
 
 	// Verify ownership through agent
 	userID := r.Context().Value("userID").(uuid.UUID)
-	agent, _ := h.repos.Agent.GetByID(r.Context(), interaction.AgentID)
-	if agent.UserID != userID {
-		response.Error(w, http.StatusForbidden, "Access denied")
+	agent, err := requireAgentOwnership(r.Context(), h.repos, interaction.AgentID, userID)
+	if err != nil {
+		respondResourceOwnershipError(w, err, "Interaction not found")
 		return
 	}
 
@@ -174,8 +358,27 @@ func (h *InteractionHandler) Feedback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Corrections become training samples, so clean and bound them up front
+	if req.Correction != "" {
+		correction, err := models.CheckTrainingText("correction", req.Correction, h.cfg.TrainingMaxOutputChars)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Correction = correction
+	}
+
 	// Update interaction with feedback
 	interaction.HumanFeedback = &req.Feedback
+
+	// Keep the original output intact and store the correction alongside it
+	if req.Correction != "" {
+		now := time.Now()
+		interaction.CorrectedOutput = &req.Correction
+		interaction.CorrectedBy = &userID
+		interaction.CorrectedAt = &now
+	}
+
 	if err := h.repos.Interaction.Update(r.Context(), interaction); err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to update feedback")
 		return
@@ -192,7 +395,7 @@ func (h *InteractionHandler) Feedback(w http.ResponseWriter, r *http.Request) {
 			OutputText: &req.Correction,
 			IsPositive: true,
 		}
-		h.repos.Training.Create(r.Context(), sample)
+		h.createTrainingSample(r, sample)
 	}
 
 	// If rejected, also create negative sample
@@ -206,8 +409,334 @@ func (h *InteractionHandler) Feedback(w http.ResponseWriter, r *http.Request) {
 			OutputText: interaction.OutputData,
 			IsPositive: false,
 		}
-		h.repos.Training.Create(r.Context(), sample)
+		h.createTrainingSample(r, sample)
 	}
 
 	response.JSON(w, http.StatusOK, map[string]string{"message": "Feedback recorded"})
 }
+
+// PromoteToTraining turns an interaction the agent handled well into a
+// positive training sample. The corrected output is used if the interaction
+// was corrected. Each interaction can be promoted once.
+func (h *InteractionHandler) PromoteToTraining(w http.ResponseWriter, r *http.Request) {
+	interactionID, err := uuid.Parse(chi.URLParam(r, "interactionID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid interaction ID")
+		return
+	}
+
+	interaction, err := h.repos.Interaction.GetByID(r.Context(), interactionID)
+	if err != nil {
+		respondLookupError(w, err, "Interaction not found")
+		return
+	}
+
+	userID := r.Context().Value("userID").(uuid.UUID)
+	agent, err := requireAgentOwnership(r.Context(), h.repos, interaction.AgentID, userID)
+	if err != nil {
+		respondResourceOwnershipError(w, err, "Interaction not found")
+		return
+	}
+
+	if interaction.Status != "completed" && interaction.Status != "escalated" {
+		response.Error(w, http.StatusConflict, "Only completed or escalated interactions can be promoted")
+		return
+	}
+	if interaction.HumanFeedback != nil && *interaction.HumanFeedback == "rejected" {
+		response.Error(w, http.StatusConflict, "Rejected interactions cannot be promoted")
+		return
+	}
+	output := interaction.OutputData
+	if interaction.CorrectedOutput != nil {
+		output = interaction.CorrectedOutput
+	}
+	if output == nil {
+		response.Error(w, http.StatusConflict, "Interaction has no output to promote")
+		return
+	}
+
+	source := "interaction:" + interaction.ID.String()
+	sample := &models.TrainingSample{
+		ID:         uuid.New(),
+		AgentID:    agent.ID,
+		Provider:   &interaction.Provider,
+		SampleType: "response",
+		InputText:  interaction.InputData,
+		OutputText: output,
+		IsPositive: true,
+		Source:     &source,
+	}
+	if err := sample.Sanitize(h.cfg.TrainingMaxInputChars, h.cfg.TrainingMaxOutputChars); err != nil {
+		response.Error(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err := h.repos.Training.Create(r.Context(), sample); err != nil {
+		if errors.Is(err, repository.ErrAlreadyPromoted) {
+			response.Error(w, http.StatusConflict, "Interaction already promoted to training")
+			return
+		}
+		response.Error(w, http.StatusInternalServerError, "Failed to create training sample")
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, sample)
+}
+
+// AddTag applies a tag from the organization's vocabulary to an
+// interaction, by ID or name. Tagging twice is a no-op.
+func (h *InteractionHandler) AddTag(w http.ResponseWriter, r *http.Request) {
+	interaction, ok := h.reviewableInteraction(w, r)
+	if !ok {
+		return
+	}
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	var req models.ApplyTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var (
+		tag *models.Tag
+		err error
+	)
+	switch {
+	case req.TagID != nil:
+		tag, err = h.repos.Tag.GetByID(r.Context(), *req.TagID)
+		if err == nil && tag.OrgID != orgID {
+			err = repository.ErrNotFound
+		}
+	case models.NormalizeTagName(req.Name) != "":
+		tag, err = h.repos.Tag.GetByName(r.Context(), orgID, models.NormalizeTagName(req.Name))
+	default:
+		response.Error(w, http.StatusBadRequest, "tagId or name is required")
+		return
+	}
+	if err != nil {
+		respondLookupError(w, err, "Tag not found")
+		return
+	}
+
+	added, err := h.repos.Tag.AddToInteraction(r.Context(), interaction.ID, tag.ID, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to tag interaction")
+		return
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	response.JSON(w, status, tag)
+}
+
+// RemoveTag takes a tag off an interaction
+func (h *InteractionHandler) RemoveTag(w http.ResponseWriter, r *http.Request) {
+	interaction, ok := h.reviewableInteraction(w, r)
+	if !ok {
+		return
+	}
+	tagID, err := uuid.Parse(chi.URLParam(r, "tagID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid tag ID")
+		return
+	}
+
+	removed, err := h.repos.Tag.RemoveFromInteraction(r.Context(), interaction.ID, tagID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to untag interaction")
+		return
+	}
+	if !removed {
+		response.Error(w, http.StatusNotFound, "Interaction does not have this tag")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Tag removed"})
+}
+
+// reviewableInteraction loads the interaction named in the URL for a
+// reviewer: the owner of its agent, or an admin of the organization the
+// agent belongs to. Others get 404.
+func (h *InteractionHandler) reviewableInteraction(w http.ResponseWriter, r *http.Request) (*models.Interaction, bool) {
+	interactionID, err := uuid.Parse(chi.URLParam(r, "interactionID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid interaction ID")
+		return nil, false
+	}
+
+	interaction, err := h.repos.Interaction.GetByID(r.Context(), interactionID)
+	if err != nil {
+		respondLookupError(w, err, "Interaction not found")
+		return nil, false
+	}
+
+	userID := r.Context().Value("userID").(uuid.UUID)
+	_, err = requireAgentOwnership(r.Context(), h.repos, interaction.AgentID, userID)
+	if err == errAgentNotFound && r.Context().Value("userRole").(string) == "admin" {
+		orgID := r.Context().Value("orgID").(uuid.UUID)
+		switch status, _ := checkOrgAgent(r.Context(), h.repos, orgID, &interaction.AgentID); status {
+		case http.StatusOK:
+			err = nil
+		case http.StatusInternalServerError:
+			response.Error(w, http.StatusInternalServerError, "Failed to verify ownership")
+			return nil, false
+		}
+	}
+	if err != nil {
+		respondResourceOwnershipError(w, err, "Interaction not found")
+		return nil, false
+	}
+	return interaction, true
+}
+
+// createTrainingSample sanitizes and stores a sample derived from feedback.
+// Samples whose interaction text is empty or over the configured limits are
+// skipped rather than failing the feedback request.
+func (h *InteractionHandler) createTrainingSample(r *http.Request, sample *models.TrainingSample) {
+	source := "feedback"
+	sample.Source = &source
+	if err := sample.Sanitize(h.cfg.TrainingMaxInputChars, h.cfg.TrainingMaxOutputChars); err != nil {
+		log.Warn().Err(err).Str("agent_id", sample.AgentID.String()).Str("sample_type", sample.SampleType).Msg("Skipping training sample")
+		return
+	}
+	if err := h.repos.Training.Create(r.Context(), sample); err != nil {
+		log.Error().Err(err).Str("agent_id", sample.AgentID.String()).Msg("Failed to create training sample")
+	}
+}
+
+// Record persists an interaction processed by the AI service (internal use) and
+// escalates it when confidence falls below the agent's threshold for the provider
+func (h *InteractionHandler) Record(w http.ResponseWriter, r *http.Request) {
+	var req models.RecordInteractionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Provider == "" || req.InteractionType == "" || len(req.InputData) == 0 {
+		response.Error(w, http.StatusBadRequest, "provider, interactionType and inputData are required")
+		return
+	}
+
+	if req.ConfidenceScore != nil && (*req.ConfidenceScore < 0 || *req.ConfidenceScore > 100) {
+		response.Error(w, http.StatusBadRequest, "confidenceScore must be between 0 and 100")
+		return
+	}
+
+	// Whether an interaction is escalated is decided here, not by the caller
+	if req.Status != "" && req.Status != "completed" && req.Status != "failed" {
+		response.Error(w, http.StatusBadRequest, "status must be completed or failed")
+		return
+	}
+
+	agent, err := h.repos.Agent.GetByID(r.Context(), req.AgentID)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, "Agent not found")
+		return
+	}
+
+	// Complete an existing interaction (e.g. one queued by a webhook) or create a new one
+	var interaction *models.Interaction
+	if req.ID != nil {
+		if existing, err := h.repos.Interaction.GetByID(r.Context(), *req.ID); err == nil {
+			if existing.AgentID != agent.ID {
+				response.Error(w, http.StatusConflict, "Interaction belongs to another agent")
+				return
+			}
+			interaction = existing
+		}
+	}
+	if interaction == nil {
+		interaction = &models.Interaction{
+			ID:              uuid.New(),
+			AgentID:         agent.ID,
+			IntegrationID:   req.IntegrationID,
+			Provider:        req.Provider,
+			InteractionType: req.InteractionType,
+			InputData:       string(req.InputData),
+		}
+		if req.ID != nil {
+			interaction.ID = *req.ID
+		}
+	}
+
+	now := time.Now()
+	interaction.ConfidenceScore = req.ConfidenceScore
+	interaction.ProcessingTime = req.ProcessingTime
+	interaction.CompletedAt = &now
+	interaction.Status = req.Status
+	if interaction.Status == "" {
+		interaction.Status = "completed"
+	}
+	if len(req.OutputData) > 0 {
+		output := string(req.OutputData)
+		interaction.OutputData = &output
+	}
+
+	// Escalate when confidence is below the threshold that applies to this provider
+	threshold := agent.ThresholdFor(interaction.Provider)
+	var escalation *models.Escalation
+	if req.ConfidenceScore != nil && *req.ConfidenceScore < threshold {
+		interaction.Escalated = true
+		interaction.Status = "escalated"
+
+		// Priority rules adjust the score; without them the gap alone decides
+		rules, err := h.repos.PriorityRule.ListForAgent(r.Context(), agent.ID)
+		if err != nil {
+			log.Warn().Err(err).Str("agent_id", agent.ID.String()).Msg("Failed to load priority rules, using confidence gap only")
+		}
+		priority := models.ComputeEscalationPriority(*req.ConfidenceScore, threshold, agent.ID, interaction.Provider, interaction.InputData, rules)
+		escalationContext, _ := json.Marshal(map[string]interface{}{"priority": priority})
+		escalationContextStr := string(escalationContext)
+
+		escalation = &models.Escalation{
+			ID:            uuid.New(),
+			InteractionID: interaction.ID,
+			AgentID:       agent.ID,
+			Reason:        fmt.Sprintf("Confidence %d below threshold %d", *req.ConfidenceScore, threshold),
+			Priority:      priority.Priority,
+			Status:        "pending",
+			Context:       &escalationContextStr,
+		}
+	} else if interaction.Status == "completed" && agent.SampledForAudit(rand.Float64()) {
+		// Queue a random sample of autonomous work for review; the interaction
+		// itself stays completed
+		tag := models.EscalationTagAudit
+		escalation = &models.Escalation{
+			ID:            uuid.New(),
+			InteractionID: interaction.ID,
+			AgentID:       agent.ID,
+			Reason:        "Selected for audit review",
+			Priority:      "low",
+			Status:        "pending",
+			Tag:           &tag,
+		}
+	}
+
+	if escalation != nil {
+		assignee, err := h.repos.RoutingRule.Assignee(r.Context(), agent.ID, interaction.Provider, interaction.InteractionType)
+		// A not-found means no rule or owner to route to, not a failure
+		switch {
+		case err == nil:
+			escalation.AssignedTo = &assignee
+		case !isNotFound(err):
+			log.Warn().Err(err).Str("agent_id", agent.ID.String()).Msg("Failed to route escalation, leaving it unassigned")
+		}
+	}
+
+	if err := h.repos.Interaction.Record(r.Context(), interaction, escalation); err != nil {
+		log.Error().Err(err).Str("interaction_id", interaction.ID.String()).Msg("Failed to record interaction")
+		response.Error(w, http.StatusInternalServerError, "Failed to save interaction")
+		return
+	}
+	invalidateAgentAnalytics(r.Context(), h.redis, agent.ID)
+
+	response.JSON(w, http.StatusCreated, map[string]interface{}{
+		"interaction": interaction,
+		"escalation":  escalation,
+	})
+}
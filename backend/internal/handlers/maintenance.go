@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/repository"
+	"github.com/vibber/backend/pkg/response"
+)
+
+// ListMaintenanceWindows returns the organization's maintenance windows
+func (h *OrganizationHandler) ListMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+
+	windows, err := h.repos.Maintenance.ListByOrgID(r.Context(), orgID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch maintenance windows")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, windows)
+}
+
+// CreateMaintenanceWindow adds a maintenance window for the organization or
+// one of its agents (admin only)
+func (h *OrganizationHandler) CreateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.MaintenanceWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if status, msg := h.checkMaintenanceWindow(r.Context(), orgID, &req); status != http.StatusOK {
+		response.Error(w, status, msg)
+		return
+	}
+
+	window := &models.MaintenanceWindow{
+		ID:        uuid.New(),
+		OrgID:     orgID,
+		CreatedBy: &userID,
+	}
+	req.Apply(window)
+	if err := h.repos.Maintenance.Create(r.Context(), window); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to create maintenance window")
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, window)
+}
+
+// UpdateMaintenanceWindow replaces a maintenance window (admin only). Events
+// it already deferred are released or dropped by its new settings.
+func (h *OrganizationHandler) UpdateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	window, ok := h.orgMaintenanceWindow(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	var req models.MaintenanceWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if status, msg := h.checkMaintenanceWindow(r.Context(), orgID, &req); status != http.StatusOK {
+		response.Error(w, status, msg)
+		return
+	}
+
+	req.Apply(window)
+	if err := h.repos.Maintenance.Update(r.Context(), window); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to update maintenance window")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, window)
+}
+
+// DeleteMaintenanceWindow removes a maintenance window (admin only). Events
+// it deferred are released on the next pass of the maintenance releaser.
+func (h *OrganizationHandler) DeleteMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	window, ok := h.orgMaintenanceWindow(w, r, orgID)
+	if !ok {
+		return
+	}
+
+	if err := h.repos.Maintenance.Delete(r.Context(), window.ID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to delete maintenance window")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Maintenance window deleted"})
+}
+
+// orgMaintenanceWindow loads the window named in the URL, responding with
+// 404 when it does not exist or belongs to another organization
+func (h *OrganizationHandler) orgMaintenanceWindow(w http.ResponseWriter, r *http.Request, orgID uuid.UUID) (*models.MaintenanceWindow, bool) {
+	windowID, err := uuid.Parse(chi.URLParam(r, "windowID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid window ID")
+		return nil, false
+	}
+
+	window, err := h.repos.Maintenance.GetByID(r.Context(), windowID)
+	if err == nil && window.OrgID != orgID {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		respondLookupError(w, err, "Maintenance window not found")
+		return nil, false
+	}
+	return window, true
+}
+
+// checkMaintenanceWindow validates a window request and checks any agent
+// belongs to the organization. Returns the HTTP status and error message.
+func (h *OrganizationHandler) checkMaintenanceWindow(ctx context.Context, orgID uuid.UUID, req *models.MaintenanceWindowRequest) (int, string) {
+	if err := req.Validate(); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	return checkOrgAgent(ctx, h.repos, orgID, req.AgentID)
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/repository"
+)
+
+// loginProvider holds the URLs of an identity provider users sign in with
+type loginProvider struct {
+	AuthorizeURL string
+	TokenURL     string
+	UserInfoURL  string
+	EmailsURL    string // GitHub only; its /user omits private emails
+}
+
+var googleLogin = loginProvider{
+	AuthorizeURL: "https://accounts.google.com/o/oauth2/v2/auth",
+	TokenURL:     "https://oauth2.googleapis.com/token",
+	UserInfoURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+}
+
+var githubLogin = loginProvider{
+	AuthorizeURL: "https://github.com/login/oauth/authorize",
+	TokenURL:     "https://github.com/login/oauth/access_token",
+	UserInfoURL:  "https://api.github.com/user",
+	EmailsURL:    "https://api.github.com/user/emails",
+}
+
+// oauthProfile is who an identity provider says signed in
+type oauthProfile struct {
+	Provider   string
+	ProviderID string
+	Email      string
+	Name       string
+	AvatarURL  *string
+}
+
+// oauthLoginError is a sign-in the provider or our signup policy refused,
+// answered with status and message rather than a generic failure
+type oauthLoginError struct {
+	status  int
+	message string
+}
+
+func (e *oauthLoginError) Error() string {
+	return e.message
+}
+
+// oauthRedirectURI is where a provider sends users back after signing in. The
+// token exchange must name the same URI as the authorization request.
+func (h *AuthHandler) oauthRedirectURI(provider string) string {
+	return h.cfg.FrontendURL + "/api/v1/auth/oauth/" + provider + "/callback"
+}
+
+var oauthClient = &http.Client{Timeout: 15 * time.Second}
+
+// exchangeOAuthCode trades an authorization code for the provider's access
+// token. GitHub reports a rejected code with a 200 and an error body.
+func (h *AuthHandler) exchangeOAuthCode(ctx context.Context, name string, provider loginProvider, clientID, clientSecret, code string) (string, error) {
+	form := url.Values{
+		"code":          {code},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"redirect_uri":  {h.oauthRedirectURI(name)},
+		"grant_type":    {"authorization_code"},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", provider.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := doOAuthJSON(req, &token); err != nil && token.Error == "" {
+		return "", fmt.Errorf("%s token exchange: %w", name, err)
+	}
+	if token.Error != "" || token.AccessToken == "" {
+		return "", fmt.Errorf("%s token exchange failed: %s %s", name, token.Error, token.ErrorDescription)
+	}
+	return token.AccessToken, nil
+}
+
+// getOAuthJSON reads a provider API with the user's access token
+func getOAuthJSON(ctx context.Context, endpoint, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	return doOAuthJSON(req, v)
+}
+
+// handleGoogleCallback exchanges the authorization code for an access token,
+// reads the Google account's profile and signs its user in
+func (h *AuthHandler) handleGoogleCallback(ctx context.Context, code string) (*models.User, error) {
+	accessToken, err := h.exchangeOAuthCode(ctx, "google", h.google, h.cfg.GoogleClientID, h.cfg.GoogleClientSecret, code)
+	if err != nil {
+		return nil, err
+	}
+
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+		Picture       string `json:"picture"`
+	}
+	if err := getOAuthJSON(ctx, h.google.UserInfoURL, accessToken, &info); err != nil {
+		return nil, fmt.Errorf("google userinfo: %w", err)
+	}
+	if info.Sub == "" {
+		return nil, fmt.Errorf("google userinfo returned no account ID")
+	}
+	if info.Email == "" || !info.EmailVerified {
+		return nil, &oauthLoginError{http.StatusBadRequest, "Your Google account has no verified email address"}
+	}
+
+	profile := &oauthProfile{
+		Provider:   "google",
+		ProviderID: info.Sub,
+		Email:      info.Email,
+		Name:       info.Name,
+	}
+	if info.Picture != "" {
+		profile.AvatarURL = &info.Picture
+	}
+	return h.loginOAuthUser(ctx, profile)
+}
+
+// handleGitHubCallback exchanges the authorization code for an access token,
+// reads the GitHub account and its primary verified email, which /user leaves
+// out when the user keeps it private, and signs its user in
+func (h *AuthHandler) handleGitHubCallback(ctx context.Context, code string) (*models.User, error) {
+	accessToken, err := h.exchangeOAuthCode(ctx, "github", h.github, h.cfg.GitHubClientID, h.cfg.GitHubClientSecret, code)
+	if err != nil {
+		return nil, err
+	}
+
+	var account struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := getOAuthJSON(ctx, h.github.UserInfoURL, accessToken, &account); err != nil {
+		return nil, fmt.Errorf("github user: %w", err)
+	}
+	if account.ID == 0 {
+		return nil, fmt.Errorf("github user returned no account ID")
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getOAuthJSON(ctx, h.github.EmailsURL, accessToken, &emails); err != nil {
+		return nil, fmt.Errorf("github emails: %w", err)
+	}
+	var email string
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			email = e.Email
+			break
+		}
+	}
+	if email == "" {
+		return nil, &oauthLoginError{http.StatusBadRequest, "Your GitHub account has no verified primary email address"}
+	}
+
+	name := account.Name
+	if name == "" {
+		name = account.Login
+	}
+	profile := &oauthProfile{
+		Provider:   "github",
+		ProviderID: strconv.FormatInt(account.ID, 10),
+		Email:      email,
+		Name:       name,
+	}
+	if account.AvatarURL != "" {
+		profile.AvatarURL = &account.AvatarURL
+	}
+	return h.loginOAuthUser(ctx, profile)
+}
+
+// doOAuthJSON sends req and decodes its JSON response into v, failing on a
+// non-2xx status after decoding any error body into v
+func doOAuthJSON(req *http.Request, v interface{}) error {
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decodeErr := json.NewDecoder(resp.Body).Decode(v)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("invalid response: %w", decodeErr)
+	}
+	return nil
+}
+
+// loginOAuthUser returns the user a provider account signs in as. Accounts
+// seen before sign in directly. An account whose verified email is already
+// registered, e.g. with a password, is linked to that user. Otherwise a new
+// user is created with an organization of their own, subject to the signup
+// email policy.
+func (h *AuthHandler) loginOAuthUser(ctx context.Context, profile *oauthProfile) (*models.User, error) {
+	user, err := h.repos.User.GetByProvider(ctx, profile.Provider, profile.ProviderID)
+	if err == nil {
+		return user, nil
+	}
+	if !isNotFound(err) {
+		return nil, err
+	}
+
+	user, err = h.repos.User.GetByEmail(ctx, profile.Email)
+	if err == nil {
+		if err := h.repos.User.LinkProvider(ctx, user.ID, profile.Provider, profile.ProviderID); err != nil {
+			return nil, err
+		}
+		log.Info().Str("user_id", user.ID.String()).Str("provider", profile.Provider).Msg("Linked sign-in provider to existing account")
+		user.Provider = &profile.Provider
+		user.ProviderID = &profile.ProviderID
+		return user, nil
+	}
+	if !isNotFound(err) {
+		return nil, err
+	}
+
+	if reason := h.signupPolicy().Check(profile.Email); reason != "" {
+		rejection := signupRejections[reason]
+		log.Info().Str("reason", reason).Str("provider", profile.Provider).Msg("Registration rejected")
+		return nil, &oauthLoginError{rejection.status, rejection.message}
+	}
+
+	name := profile.Name
+	if name == "" {
+		name, _, _ = strings.Cut(profile.Email, "@")
+	}
+	user = &models.User{
+		ID:         uuid.New(),
+		Email:      profile.Email,
+		Name:       name,
+		AvatarURL:  profile.AvatarURL,
+		Role:       "admin",
+		Provider:   &profile.Provider,
+		ProviderID: &profile.ProviderID,
+	}
+	orgName := name + "'s Organization"
+	org := &models.Organization{
+		ID:   uuid.New(),
+		Name: orgName,
+		Slug: generateSlug(orgName) + "-" + user.ID.String()[:8],
+		Plan: "starter",
+	}
+	user.OrgID = org.ID
+
+	if err := h.repos.User.CreateWithOrganization(ctx, org, user); err != nil {
+		if errors.Is(err, repository.ErrEmailTaken) {
+			// Registered concurrently; link on the next sign-in
+			return nil, &oauthLoginError{http.StatusConflict, "Email already registered, please sign in again"}
+		}
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// oauthStateTTL is how long the user has to finish signing in or connecting
+// at the provider
+const oauthStateTTL = 10 * time.Minute
+
+// oauthStateCookie binds a sign-in's state to the browser that started it,
+// so a callback link carrying someone else's state and code is refused
+const oauthStateCookie = "oauth_state"
+
+var errInvalidOAuthState = errors.New("invalid OAuth state")
+
+// newOAuthState returns a random, unguessable state value
+func newOAuthState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func loginStateKey(state string) string {
+	return "oauth:login-state:" + state
+}
+
+// startOAuthLogin issues the state for a sign-in with provider, remembering
+// it in Redis and in a cookie on the browser
+func (h *AuthHandler) startOAuthLogin(w http.ResponseWriter, r *http.Request, provider string) (string, error) {
+	state, err := newOAuthState()
+	if err != nil {
+		return "", err
+	}
+	if err := h.redis.Set(r.Context(), loginStateKey(state), provider, oauthStateTTL).Err(); err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/api/v1/auth/oauth",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   h.cfg.Env == "production",
+		// Lax, so the cookie is sent on the provider's redirect back to us
+		SameSite: http.SameSiteLaxMode,
+	})
+	return state, nil
+}
+
+// checkOAuthLoginState reports whether the callback's state was issued to
+// this browser for a sign-in with provider. Each state is accepted once.
+func (h *AuthHandler) checkOAuthLoginState(w http.ResponseWriter, r *http.Request, provider string) bool {
+	state := r.URL.Query().Get("state")
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Path:     "/api/v1/auth/oauth",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	cookie, err := r.Cookie(oauthStateCookie)
+	if state == "" || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		return false
+	}
+	issuedFor, err := h.redis.GetDel(r.Context(), loginStateKey(state)).Result()
+	return err == nil && issuedFor == provider
+}
+
+// integrationState is the state of an integration connection: the agent it
+// is for, the user who started it and a single-use nonce, signed so the
+// callback can trust it
+type integrationState struct {
+	AgentID   uuid.UUID `json:"agentId"`
+	UserID    uuid.UUID `json:"userId"`
+	Nonce     string    `json:"nonce"`
+	ExpiresAt int64     `json:"exp"` // Unix seconds
+}
+
+// encodeIntegrationState signs state as base64url(JSON) "." base64url(HMAC)
+func encodeIntegrationState(secret string, state *integrationState) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signIntegrationState(secret, encoded)), nil
+}
+
+func signIntegrationState(secret, encoded string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("integration-state:" + encoded))
+	return mac.Sum(nil)
+}
+
+// decodeIntegrationState verifies a state from encodeIntegrationState and
+// that it has not expired
+func decodeIntegrationState(secret, value string, now time.Time) (*integrationState, error) {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, errInvalidOAuthState
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, signIntegrationState(secret, encoded)) {
+		return nil, errInvalidOAuthState
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errInvalidOAuthState
+	}
+	state := &integrationState{}
+	if err := json.Unmarshal(payload, state); err != nil || state.Nonce == "" {
+		return nil, errInvalidOAuthState
+	}
+	if now.Unix() > state.ExpiresAt {
+		return nil, errInvalidOAuthState
+	}
+	return state, nil
+}
+
+func integrationNonceKey(nonce string) string {
+	return "oauth:integration-nonce:" + nonce
+}
+
+// newIntegrationState returns the signed state for userID connecting agentID
+func (h *IntegrationHandler) newIntegrationState(agentID, userID uuid.UUID) (string, error) {
+	nonce, err := newOAuthState()
+	if err != nil {
+		return "", err
+	}
+	return encodeIntegrationState(h.cfg.JWTSecret, &integrationState{
+		AgentID:   agentID,
+		UserID:    userID,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(oauthStateTTL).Unix(),
+	})
+}
+
+// verifyIntegrationState returns the agent a connection callback is for,
+// refusing states that are forged, expired, already used or started by
+// another user
+func (h *IntegrationHandler) verifyIntegrationState(ctx context.Context, value string, userID uuid.UUID) (uuid.UUID, error) {
+	state, err := decodeIntegrationState(h.cfg.JWTSecret, value, time.Now())
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if state.UserID != userID {
+		return uuid.Nil, errInvalidOAuthState
+	}
+	first, err := h.redis.SetNX(ctx, integrationNonceKey(state.Nonce), 1, oauthStateTTL).Result()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !first {
+		return uuid.Nil, errInvalidOAuthState
+	}
+	return state.AgentID, nil
+}
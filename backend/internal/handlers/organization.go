@@ -2,27 +2,34 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 
 	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/feature"
+	"github.com/vibber/backend/internal/models"
 	"github.com/vibber/backend/internal/repository"
 	"github.com/vibber/backend/pkg/response"
 )
 
 type OrganizationHandler struct {
-	repos *repository.Repositories
-	redis *redis.Client
-	cfg   *config.Config
+	repos    *repository.Repositories
+	redis    *redis.Client
+	cfg      *config.Config
+	features *feature.Store
 }
 
 func NewOrganizationHandler(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *OrganizationHandler {
 	return &OrganizationHandler{
-		repos: repos,
-		redis: redis,
-		cfg:   cfg,
+		repos:    repos,
+		redis:    redis,
+		cfg:      cfg,
+		features: feature.NewStore(repos, redis, cfg),
 	}
 }
 
@@ -36,16 +43,17 @@ func (h *OrganizationHandler) Get(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get member count
-	members, _ := h.repos.User.ListByOrgID(r.Context(), orgID)
+	_, memberCount, _ := h.repos.User.ListByOrgID(r.Context(), orgID, models.PaginationParams{Page: 1, PageSize: 1})
 
 	response.JSON(w, http.StatusOK, map[string]interface{}{
 		"organization": org,
-		"memberCount":  len(members),
+		"memberCount":  memberCount,
 	})
 }
 
 func (h *OrganizationHandler) Update(w http.ResponseWriter, r *http.Request) {
 	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
 	userRole := r.Context().Value("userRole").(string)
 
 	// Only admins can update organization
@@ -71,6 +79,7 @@ func (h *OrganizationHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.Name != "" {
 		org.Name = req.Name
 	}
+	org.UpdatedBy = &userID
 
 	if err := h.repos.Organization.Update(r.Context(), org); err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to update organization")
@@ -80,18 +89,81 @@ func (h *OrganizationHandler) Update(w http.ResponseWriter, r *http.Request) {
 	response.JSON(w, http.StatusOK, org)
 }
 
+// Patch updates the name and the provided settings fields (admin only).
+// Unknown fields are rejected rather than ignored.
+func (h *OrganizationHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.UpdateOrganizationRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	org, err := h.repos.Organization.GetByID(r.Context(), orgID)
+	if err != nil {
+		respondLookupError(w, err, "Organization not found")
+		return
+	}
+	oldValue, _ := json.Marshal(map[string]interface{}{"name": org.Name, "settings": org.Settings})
+
+	req.Apply(org)
+	org.UpdatedBy = &userID
+	if err := h.repos.Organization.Update(r.Context(), org); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to update organization")
+		return
+	}
+
+	oldValueStr := string(oldValue)
+	newValue, _ := json.Marshal(map[string]interface{}{"name": org.Name, "settings": org.Settings})
+	newValueStr := string(newValue)
+	resourceType := "organization"
+	writeAudit(r, h.repos, &models.AuditLog{
+		OrgID:        &orgID,
+		UserID:       &userID,
+		Action:       "organization.updated",
+		ResourceType: &resourceType,
+		ResourceID:   &orgID,
+		OldValue:     &oldValueStr,
+		NewValue:     &newValueStr,
+	})
+
+	response.JSON(w, http.StatusOK, org)
+}
+
 func (h *OrganizationHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
 	orgID := r.Context().Value("orgID").(uuid.UUID)
 
-	members, err := h.repos.User.ListByOrgID(r.Context(), orgID)
+	params, ok := parsePagination(w, r, h.cfg)
+	if !ok {
+		return
+	}
+
+	members, total, err := h.repos.User.ListByOrgID(r.Context(), orgID, params)
 	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "Failed to fetch members")
 		return
 	}
 
-	response.JSON(w, http.StatusOK, members)
+	response.Paginated(w, members, params.Page, params.PageSize, total)
 }
 
+// memberRoles are the roles a membership can hold
+var memberRoles = map[string]bool{"admin": true, "member": true, "viewer": true}
+
 func (h *OrganizationHandler) InviteMember(w http.ResponseWriter, r *http.Request) {
 	orgID := r.Context().Value("orgID").(uuid.UUID)
 	userRole := r.Context().Value("userRole").(string)
@@ -111,10 +183,30 @@ func (h *OrganizationHandler) InviteMember(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Check if user already exists
-	existing, _ := h.repos.User.GetByEmail(r.Context(), req.Email)
+	if req.Role == "" {
+		req.Role = "member"
+	}
+	if !memberRoles[req.Role] {
+		response.Error(w, http.StatusBadRequest, "Role must be admin, member or viewer")
+		return
+	}
+
+	// Existing users are never added to an organization without accepting;
+	// until invitations can be accepted in-app they are refused
+	existing, err := h.repos.User.GetByEmail(r.Context(), req.Email)
+	if err != nil && !isNotFound(err) {
+		response.Error(w, http.StatusInternalServerError, "Failed to invite member")
+		return
+	}
 	if existing != nil {
-		response.Error(w, http.StatusConflict, "User already exists")
+		if _, err := h.repos.Membership.Get(r.Context(), existing.ID, orgID); err == nil {
+			response.Error(w, http.StatusConflict, "User is already a member")
+			return
+		} else if !isNotFound(err) {
+			response.Error(w, http.StatusInternalServerError, "Failed to invite member")
+			return
+		}
+		response.Error(w, http.StatusConflict, "A user with this email already exists")
 		return
 	}
 
@@ -126,3 +218,319 @@ func (h *OrganizationHandler) InviteMember(w http.ResponseWriter, r *http.Reques
 		"orgId":   orgID,
 	})
 }
+
+// RotateAgentToken issues a new service token for the organization's agent
+// workers, invalidating the previous one. The token is only returned once.
+func (h *OrganizationHandler) RotateAgentToken(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	token, hash, err := models.GenerateAgentToken()
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	if err := h.repos.Organization.SetAgentTokenHash(r.Context(), orgID, hash, userID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to rotate agent token")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{
+		"token":   token,
+		"message": "Store this token now, it will not be shown again",
+	})
+}
+
+// GetRetention returns the organization's data retention policy (admin only)
+func (h *OrganizationHandler) GetRetention(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	policy, err := h.repos.Organization.GetRetentionPolicy(r.Context(), orgID)
+	if err != nil {
+		respondLookupError(w, err, "Organization not found")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, h.withEffectiveRetention(policy))
+}
+
+// UpdateRetention replaces the organization's retention policy (admin only).
+// A null retentionDays reverts to the plan default; legalHold must be given
+// explicitly so a hold is never lifted by omission.
+func (h *OrganizationHandler) UpdateRetention(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.UpdateRetentionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.LegalHold == nil {
+		response.Error(w, http.StatusBadRequest, "legalHold is required")
+		return
+	}
+	if req.RetentionDays != nil && (*req.RetentionDays < 1 || *req.RetentionDays > maxRetentionDays) {
+		response.Error(w, http.StatusBadRequest, fmt.Sprintf("retentionDays must be between 1 and %d", maxRetentionDays))
+		return
+	}
+
+	policy, err := h.repos.Organization.GetRetentionPolicy(r.Context(), orgID)
+	if err != nil {
+		respondLookupError(w, err, "Organization not found")
+		return
+	}
+
+	if err := h.repos.Organization.UpdateRetentionPolicy(r.Context(), orgID, req.RetentionDays, *req.LegalHold, userID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to update retention policy")
+		return
+	}
+
+	if policy.LegalHold != *req.LegalHold {
+		log.Info().
+			Str("org_id", orgID.String()).
+			Str("user_id", userID.String()).
+			Bool("legal_hold", *req.LegalHold).
+			Msg("Organization legal hold changed")
+	}
+
+	policy.RetentionDays = req.RetentionDays
+	policy.LegalHold = *req.LegalHold
+
+	response.JSON(w, http.StatusOK, h.withEffectiveRetention(policy))
+}
+
+// GetAgentDefaults returns the settings template applied to new agents (admin only)
+func (h *OrganizationHandler) GetAgentDefaults(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	defaults, err := h.repos.Organization.GetAgentDefaults(r.Context(), orgID)
+	if err != nil {
+		respondLookupError(w, err, "Organization not found")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, defaults)
+}
+
+// UpdateAgentDefaults replaces the settings template applied to new agents
+// (admin only). Existing agents are not changed.
+func (h *OrganizationHandler) UpdateAgentDefaults(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var defaults models.AgentDefaults
+	if err := json.NewDecoder(r.Body).Decode(&defaults); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := defaults.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.repos.Organization.UpdateAgentDefaults(r.Context(), orgID, &defaults, userID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to update agent defaults")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, defaults)
+}
+
+// UpdateAgentSettings applies a partial settings patch to the organization's
+// agents matched by the filter, or to all of them, in one transaction (admin
+// only). Requested agents outside the organization are reported as failures.
+func (h *OrganizationHandler) UpdateAgentSettings(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.BulkAgentSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := req.Settings.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	agents, err := h.repos.Agent.ListByOrgID(r.Context(), orgID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch agents")
+		return
+	}
+
+	selected, failures := req.Filter.SelectAgents(agents)
+	result := models.BulkAgentSettingsResult{AgentIDs: []uuid.UUID{}, Failures: failures}
+	for _, agent := range selected {
+		req.Settings.Apply(agent)
+		agent.UpdatedBy = &userID
+		result.AgentIDs = append(result.AgentIDs, agent.ID)
+	}
+
+	if len(selected) > 0 {
+		if err := h.repos.Agent.UpdateSettings(r.Context(), selected); err != nil {
+			response.Error(w, http.StatusInternalServerError, "Failed to update agent settings")
+			return
+		}
+	}
+	result.Updated = len(selected)
+
+	newValue, _ := json.Marshal(map[string]interface{}{
+		"filter":   req.Filter,
+		"settings": req.Settings,
+		"agentIds": result.AgentIDs,
+	})
+	newValueStr := string(newValue)
+	resourceType := "organization"
+	writeAudit(r, h.repos, &models.AuditLog{
+		OrgID:        &orgID,
+		UserID:       &userID,
+		Action:       "agents.bulk_update_settings",
+		ResourceType: &resourceType,
+		ResourceID:   &orgID,
+		NewValue:     &newValueStr,
+	})
+
+	log.Info().
+		Str("org_id", orgID.String()).
+		Str("user_id", userID.String()).
+		Int("agents", result.Updated).
+		Int("failures", len(result.Failures)).
+		Msg("Bulk agent settings update applied")
+
+	response.JSON(w, http.StatusOK, result)
+}
+
+// GetFeatures returns the value of every feature flag for the organization
+func (h *OrganizationHandler) GetFeatures(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+
+	flags, err := h.features.Flags(r.Context(), orgID)
+	if err != nil {
+		respondLookupError(w, err, "Organization not found")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, flags)
+}
+
+// maxRetentionDays caps organization overrides at ten years
+const maxRetentionDays = 3650
+
+func (h *OrganizationHandler) withEffectiveRetention(policy *models.RetentionPolicy) *models.RetentionPolicy {
+	policy.PlanDefaultDays = h.cfg.RetentionDays()[policy.Plan]
+	policy.EffectiveDays = policy.PlanDefaultDays
+	if policy.RetentionDays != nil {
+		policy.EffectiveDays = *policy.RetentionDays
+	}
+	return policy
+}
+
+// PauseAllAgents pauses every active agent in the organization (admin only).
+// While paused, webhook events are not queued for any of its agents.
+func (h *OrganizationHandler) PauseAllAgents(w http.ResponseWriter, r *http.Request) {
+	h.setAgentsPaused(w, r, true)
+}
+
+// ResumeAllAgents lifts an organization pause, reactivating only the agents
+// that were active when it was paused (admin only)
+func (h *OrganizationHandler) ResumeAllAgents(w http.ResponseWriter, r *http.Request) {
+	h.setAgentsPaused(w, r, false)
+}
+
+func (h *OrganizationHandler) setAgentsPaused(w http.ResponseWriter, r *http.Request, pause bool) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var (
+		agentIDs []uuid.UUID
+		err      error
+		action   = "agents.resume_all"
+	)
+	if pause {
+		agentIDs, err = h.repos.Organization.PauseAgents(r.Context(), orgID, userID)
+		action = "agents.pause_all"
+	} else {
+		agentIDs, err = h.repos.Organization.ResumeAgents(r.Context(), orgID)
+	}
+	switch {
+	case errors.Is(err, repository.ErrAgentsAlreadyPaused):
+		response.Error(w, http.StatusConflict, "Agents are already paused")
+		return
+	case errors.Is(err, repository.ErrAgentsNotPaused):
+		response.Error(w, http.StatusConflict, "Agents are not paused")
+		return
+	case err != nil:
+		respondLookupError(w, err, "Organization not found")
+		return
+	}
+
+	result := models.AgentPauseResult{Paused: pause, AgentIDs: agentIDs}
+	newValue, _ := json.Marshal(result)
+	newValueStr := string(newValue)
+	resourceType := "organization"
+	writeAudit(r, h.repos, &models.AuditLog{
+		OrgID:        &orgID,
+		UserID:       &userID,
+		Action:       action,
+		ResourceType: &resourceType,
+		ResourceID:   &orgID,
+		NewValue:     &newValueStr,
+	})
+
+	log.Info().
+		Str("org_id", orgID.String()).
+		Str("user_id", userID.String()).
+		Bool("paused", pause).
+		Int("agents", len(agentIDs)).
+		Msg("Organization agents pause changed")
+
+	response.JSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/repository"
+	"github.com/vibber/backend/pkg/response"
+)
+
+// ownershipError describes why an agent ownership check failed and how to respond
+type ownershipError struct {
+	status  int
+	message string
+}
+
+func (e *ownershipError) Error() string {
+	return e.message
+}
+
+// Resources belonging to another user are reported exactly like resources
+// that don't exist, with 404, so IDs can't be probed across users or
+// organizations. 403 is kept for role checks such as admin-only endpoints.
+var errAgentNotFound = &ownershipError{status: http.StatusNotFound, message: "Agent not found"}
+
+// requireAgentOwnership fetches the agent and verifies it belongs to the user
+func requireAgentOwnership(ctx context.Context, repos *repository.Repositories, agentID, userID uuid.UUID) (*models.Agent, error) {
+	agent, err := repos.Agent.GetByID(ctx, agentID)
+	if isNotFound(err) {
+		return nil, errAgentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if agent.UserID != userID {
+		return nil, errAgentNotFound
+	}
+
+	return agent, nil
+}
+
+// respondOwnershipError writes the response matching an ownership check failure
+func respondOwnershipError(w http.ResponseWriter, err error) {
+	if oe, ok := err.(*ownershipError); ok {
+		response.Error(w, oe.status, oe.message)
+		return
+	}
+	response.Error(w, http.StatusInternalServerError, "Failed to verify ownership")
+}
+
+// respondResourceOwnershipError is respondOwnershipError for a resource
+// reached through its agent, such as an interaction or integration. The
+// resource is reported as not found rather than its agent.
+func respondResourceOwnershipError(w http.ResponseWriter, err error, notFoundMessage string) {
+	if _, ok := err.(*ownershipError); ok {
+		response.Error(w, http.StatusNotFound, notFoundMessage)
+		return
+	}
+	respondOwnershipError(w, err)
+}
+
+// RequireAgentOwnership middleware validates the {agentID} URL parameter belongs
+// to the requesting user and stores the agent in the request context
+func RequireAgentOwnership(repos *repository.Repositories) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			agentID, err := uuid.Parse(chi.URLParam(r, "agentID"))
+			if err != nil {
+				response.Error(w, http.StatusBadRequest, "Invalid agent ID")
+				return
+			}
+
+			userID := r.Context().Value("userID").(uuid.UUID)
+
+			agent, err := requireAgentOwnership(r.Context(), repos, agentID, userID)
+			if err != nil {
+				respondOwnershipError(w, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "agent", agent)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// agentFromContext returns the agent loaded by RequireAgentOwnership
+func agentFromContext(ctx context.Context) *models.Agent {
+	agent, _ := ctx.Value("agent").(*models.Agent)
+	return agent
+}
+
+// checkOrgAgent checks an agent a rule or window is scoped to, if any,
+// belongs to the organization. Returns the HTTP status and error message.
+func checkOrgAgent(ctx context.Context, repos *repository.Repositories, orgID uuid.UUID, agentID *uuid.UUID) (int, string) {
+	if agentID == nil {
+		return http.StatusOK, ""
+	}
+	agents, err := repos.Agent.ListByOrgID(ctx, orgID)
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to fetch agents"
+	}
+	for _, agent := range agents {
+		if agent.ID == *agentID {
+			return http.StatusOK, ""
+		}
+	}
+	return http.StatusBadRequest, "Agent is not in the organization"
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/pkg/response"
+)
+
+// parsePagination reads the page and page_size query parameters, defaulting
+// to the first page of cfg.DefaultPageSize items and capping page_size at
+// cfg.MaxPageSize. It responds with 400 and returns false when either is not
+// a positive integer.
+func parsePagination(w http.ResponseWriter, r *http.Request, cfg *config.Config) (models.PaginationParams, bool) {
+	page, ok := positiveParam(w, r, "page", 1)
+	if !ok {
+		return models.PaginationParams{}, false
+	}
+	pageSize, ok := parsePageSize(w, r, "page_size", cfg)
+	if !ok {
+		return models.PaginationParams{}, false
+	}
+	return models.PaginationParams{Page: page, PageSize: pageSize}, true
+}
+
+// parsePageSize reads a page size parameter (page_size, or limit on cursor
+// paginated endpoints) with the same default and cap as parsePagination
+func parsePageSize(w http.ResponseWriter, r *http.Request, name string, cfg *config.Config) (int, bool) {
+	size, ok := positiveParam(w, r, name, cfg.DefaultPageSize)
+	if !ok {
+		return 0, false
+	}
+	if size > cfg.MaxPageSize {
+		size = cfg.MaxPageSize
+	}
+	return size, true
+}
+
+func positiveParam(w http.ResponseWriter, r *http.Request, name string, defaultValue int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return defaultValue, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		response.Error(w, http.StatusBadRequest, name+" must be a positive integer")
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// refreshTokenFamilies tracks the current refresh token of each session. The
+// refresh tokens a session is issued form a family: every refresh replaces
+// the current token with a new one, and an earlier token presented again
+// must have leaked, so the whole family is revoked.
+type refreshTokenFamilies struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+func newRefreshTokenFamilies(redis *redis.Client, ttl time.Duration) *refreshTokenFamilies {
+	return &refreshTokenFamilies{
+		redis: redis,
+		ttl:   ttl,
+	}
+}
+
+func refreshFamilyKey(userID, sessionID uuid.UUID) string {
+	return fmt.Sprintf("refresh:%s:%s", userID, sessionID)
+}
+
+// Start records jti as the family's current token
+func (f *refreshTokenFamilies) Start(ctx context.Context, userID, sessionID uuid.UUID, jti string) error {
+	return f.redis.Set(ctx, refreshFamilyKey(userID, sessionID), jti, f.ttl).Err()
+}
+
+// Rotate makes next the family's current token in exchange for presented,
+// reporting false when presented was not the current token. A family that
+// is not tracked, because its tokens predate rotation or Redis lost it,
+// starts over with next.
+func (f *refreshTokenFamilies) Rotate(ctx context.Context, userID, sessionID uuid.UUID, presented, next string) (bool, error) {
+	previous, err := f.redis.SetArgs(ctx, refreshFamilyKey(userID, sessionID), next, redis.SetArgs{TTL: f.ttl, Get: true}).Result()
+	if errors.Is(err, redis.Nil) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return previous == presented, nil
+}
+
+// Revoke forgets the family, so none of its tokens rotate anymore
+func (f *refreshTokenFamilies) Revoke(ctx context.Context, userID, sessionID uuid.UUID) error {
+	return f.redis.Del(ctx, refreshFamilyKey(userID, sessionID)).Err()
+}
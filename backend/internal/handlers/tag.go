@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/repository"
+	"github.com/vibber/backend/pkg/response"
+)
+
+// TagHandler manages the organization's interaction tag vocabulary
+type TagHandler struct {
+	repos *repository.Repositories
+	redis *redis.Client
+	cfg   *config.Config
+}
+
+func NewTagHandler(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *TagHandler {
+	return &TagHandler{
+		repos: repos,
+		redis: redis,
+		cfg:   cfg,
+	}
+}
+
+// List returns the organization's tags with how many interactions carry each
+func (h *TagHandler) List(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+
+	tags, err := h.repos.Tag.ListByOrgID(r.Context(), orgID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to fetch tags")
+		return
+	}
+	if tags == nil {
+		tags = []*models.Tag{}
+	}
+
+	response.JSON(w, http.StatusOK, tags)
+}
+
+// Create adds a tag to the organization's vocabulary (admin only)
+func (h *TagHandler) Create(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userID := r.Context().Value("userID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tag := &models.Tag{
+		ID:          uuid.New(),
+		OrgID:       orgID,
+		Name:        req.Name,
+		Color:       req.Color,
+		Description: req.Description,
+		CreatedBy:   &userID,
+	}
+	if err := h.repos.Tag.Create(r.Context(), tag); err != nil {
+		respondTagError(w, err, "Failed to create tag")
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, tag)
+}
+
+// Update renames or restyles a tag (admin only). Interactions keep it.
+func (h *TagHandler) Update(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	tag, ok := orgTag(w, r, h.repos, orgID)
+	if !ok {
+		return
+	}
+
+	var req models.TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tag.Name = req.Name
+	tag.Color = req.Color
+	tag.Description = req.Description
+	if err := h.repos.Tag.Update(r.Context(), tag); err != nil {
+		respondTagError(w, err, "Failed to update tag")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, tag)
+}
+
+// Delete removes a tag and every application of it (admin only)
+func (h *TagHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	orgID := r.Context().Value("orgID").(uuid.UUID)
+	userRole := r.Context().Value("userRole").(string)
+
+	if userRole != "admin" {
+		response.Error(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	tag, ok := orgTag(w, r, h.repos, orgID)
+	if !ok {
+		return
+	}
+
+	if err := h.repos.Tag.Delete(r.Context(), tag.ID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to delete tag")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "Tag deleted"})
+}
+
+// orgTag loads the tag named in the URL, responding with 404 when it does
+// not exist or belongs to another organization
+func orgTag(w http.ResponseWriter, r *http.Request, repos *repository.Repositories, orgID uuid.UUID) (*models.Tag, bool) {
+	tagID, err := uuid.Parse(chi.URLParam(r, "tagID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid tag ID")
+		return nil, false
+	}
+
+	tag, err := repos.Tag.GetByID(r.Context(), tagID)
+	if err == nil && tag.OrgID != orgID {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		respondLookupError(w, err, "Tag not found")
+		return nil, false
+	}
+	return tag, true
+}
+
+// respondTagError answers a failed tag write, with 409 for a taken name
+func respondTagError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, repository.ErrTagExists) {
+		response.Error(w, http.StatusConflict, "A tag with this name already exists")
+		return
+	}
+	response.Error(w, http.StatusInternalServerError, message)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/vibber/backend/internal/models"
+)
+
+// revokeToken revokes the integration's OAuth grant at the provider, with
+// the organization's app credentials, so its token stops working once the
+// integration is gone
+func (h *IntegrationHandler) revokeToken(ctx context.Context, orgID uuid.UUID, integration *models.Integration) error {
+	if integration.AccessToken == "" {
+		return nil
+	}
+	clientID, clientSecret, endpoints, err := h.providerApp(ctx, orgID, integration.Provider)
+	if err != nil {
+		return err
+	}
+
+	switch integration.Provider {
+	case "slack":
+		return h.revokeSlackToken(ctx, endpoints, integration.AccessToken)
+	case "github":
+		return h.revokeGitHubToken(ctx, endpoints, clientID, clientSecret, integration.AccessToken)
+	case "jira", "confluence":
+		// Revoking the refresh token ends the whole grant
+		token, hint := integration.AccessToken, "access_token"
+		if integration.RefreshToken != nil && *integration.RefreshToken != "" {
+			token, hint = *integration.RefreshToken, "refresh_token"
+		}
+		return h.revokeAtlassianToken(ctx, endpoints, clientID, clientSecret, token, hint)
+	default:
+		return nil
+	}
+}
+
+// revokeSlackToken calls auth.revoke with the token itself. Slack answers
+// 200 and reports failures in the body.
+func (h *IntegrationHandler) revokeSlackToken(ctx context.Context, endpoints models.ProviderEndpoints, token string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoints.APIBaseURL+"/auth.revoke", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := h.providerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid slack response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	// A token Slack already revoked needs nothing more
+	if !result.OK && result.Error != "invalid_auth" && result.Error != "token_revoked" {
+		return fmt.Errorf("slack auth.revoke failed: %s", result.Error)
+	}
+	return nil
+}
+
+// revokeGitHubToken deletes the OAuth app's token, authenticating as the app
+func (h *IntegrationHandler) revokeGitHubToken(ctx context.Context, endpoints models.ProviderEndpoints, clientID, clientSecret, token string) error {
+	body, _ := json.Marshal(map[string]string{"access_token": token})
+	req, err := http.NewRequestWithContext(ctx, "DELETE", endpoints.APIBaseURL+"/applications/"+url.PathEscape(clientID)+"/token", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(clientID, clientSecret)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.providerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// 404 is a token GitHub no longer knows, e.g. one the user revoked
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("github token revocation returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// revokeAtlassianToken posts an OAuth token revocation (RFC 7009) next to
+// the token endpoint
+func (h *IntegrationHandler) revokeAtlassianToken(ctx context.Context, endpoints models.ProviderEndpoints, clientID, clientSecret, token, hint string) error {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {hint},
+		"client_id":       {clientID},
+		"client_secret":   {clientSecret},
+	}
+	revokeURL := strings.TrimSuffix(endpoints.TokenURL, "/token") + "/revoke"
+	req, err := http.NewRequestWithContext(ctx, "POST", revokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := h.providerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("atlassian token revocation returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/pkg/response"
+)
+
+const (
+	trainingImportTTL     = 24 * time.Hour
+	trainingImportTimeout = 30 * time.Minute
+)
+
+func trainingImportKey(jobID uuid.UUID) string {
+	return fmt.Sprintf("training:import:%s", jobID)
+}
+
+// inFlightLimiter caps how many operations each user has running at once.
+// It is per process, like the temp files the limited uploads are spooled to.
+type inFlightLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight map[uuid.UUID]int
+}
+
+func newInFlightLimiter(limit int) *inFlightLimiter {
+	return &inFlightLimiter{
+		limit:    limit,
+		inFlight: make(map[uuid.UUID]int),
+	}
+}
+
+// Acquire takes one of the user's slots, returning false when all are in use
+func (l *inFlightLimiter) Acquire(userID uuid.UUID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[userID] >= l.limit {
+		return false
+	}
+	l.inFlight[userID]++
+	return true
+}
+
+// Release gives back a slot taken by Acquire
+func (l *inFlightLimiter) Release(userID uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[userID] <= 1 {
+		delete(l.inFlight, userID)
+		return
+	}
+	l.inFlight[userID]--
+}
+
+// RunTrainingImports processes queued training imports until ctx is
+// cancelled, finishing those already queued before returning
+func (h *AgentHandler) RunTrainingImports(ctx context.Context) {
+	h.imports.Run(ctx)
+}
+
+// UploadTraining imports training samples from an NDJSON or CSV file sent as
+// the "file" part of a multipart form. The file is streamed to disk rather
+// than buffered in memory, then parsed and inserted in batches on the import
+// worker pool; progress is served by TrainingImportStatus. Each user may have
+// TrainingImportsPerUser uploads spooling or importing at once.
+func (h *AgentHandler) UploadTraining(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+	userID := r.Context().Value("userID").(uuid.UUID)
+
+	if !h.importsPerUser.Acquire(userID) {
+		response.Error(w, http.StatusTooManyRequests, "Too many training imports in progress")
+		return
+	}
+	// The slot passes to the import job once it is queued
+	queued := false
+	defer func() {
+		if !queued {
+			h.importsPerUser.Release(userID)
+		}
+	}()
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.cfg.TrainingUploadMaxMB)<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Expected a multipart form upload")
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			response.Error(w, http.StatusBadRequest, "file is required")
+			return
+		}
+		if err != nil {
+			h.respondUploadError(w, err)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		format := models.TrainingFormatFor(r.URL.Query().Get("format"), part.FileName())
+		if format == "" {
+			response.Error(w, http.StatusBadRequest, "Unsupported file format, expected ndjson or csv")
+			return
+		}
+
+		job := &models.TrainingImportJob{
+			ID:        uuid.New(),
+			AgentID:   agent.ID,
+			Status:    models.TrainingImportProcessing,
+			Format:    format,
+			Errors:    []models.TrainingRecordFail{},
+			CreatedAt: time.Now(),
+		}
+
+		file, err := os.CreateTemp("", "vibber-training-*")
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to create training upload file")
+			response.Error(w, http.StatusInternalServerError, "Failed to store upload")
+			return
+		}
+		job.Bytes, err = io.Copy(file, part)
+		file.Close()
+		if err != nil {
+			os.Remove(file.Name())
+			h.respondUploadError(w, err)
+			return
+		}
+
+		if err := h.saveTrainingImport(r.Context(), job); err != nil {
+			os.Remove(file.Name())
+			log.Error().Err(err).Msg("Failed to save training import")
+			response.Error(w, http.StatusInternalServerError, "Failed to start import")
+			return
+		}
+
+		path := file.Name()
+		queued = h.imports.Submit(func(ctx context.Context) {
+			defer h.importsPerUser.Release(userID)
+			h.runTrainingImport(ctx, job, path)
+		})
+		if !queued {
+			os.Remove(path)
+			h.redis.Del(r.Context(), trainingImportKey(job.ID))
+			response.Error(w, http.StatusServiceUnavailable, "Training import queue is full, try again later")
+			return
+		}
+
+		response.JSON(w, http.StatusAccepted, map[string]interface{}{
+			"jobId":  job.ID,
+			"format": job.Format,
+			"bytes":  job.Bytes,
+		})
+		return
+	}
+}
+
+func (h *AgentHandler) respondUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		response.Error(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload exceeds %d MB", h.cfg.TrainingUploadMaxMB))
+		return
+	}
+	response.Error(w, http.StatusBadRequest, "Failed to read upload")
+}
+
+// TrainingImportStatus reports the progress of a training data import
+func (h *AgentHandler) TrainingImportStatus(w http.ResponseWriter, r *http.Request) {
+	agent := agentFromContext(r.Context())
+
+	jobID, err := uuid.Parse(chi.URLParam(r, "jobID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	data, err := h.redis.Get(r.Context(), trainingImportKey(jobID)).Bytes()
+	if err != nil {
+		response.Error(w, http.StatusNotFound, "Import not found")
+		return
+	}
+	var job models.TrainingImportJob
+	if err := json.Unmarshal(data, &job); err != nil || job.AgentID != agent.ID {
+		response.Error(w, http.StatusNotFound, "Import not found")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, job)
+}
+
+func (h *AgentHandler) saveTrainingImport(ctx context.Context, job *models.TrainingImportJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return h.redis.Set(ctx, trainingImportKey(job.ID), data, trainingImportTTL).Err()
+}
+
+// runTrainingImport parses the spooled upload and inserts its samples in
+// batches, saving the job's progress after each batch. Malformed and invalid
+// records are counted and skipped; a failed insert fails the job.
+func (h *AgentHandler) runTrainingImport(ctx context.Context, job *models.TrainingImportJob, path string) {
+	defer os.Remove(path)
+
+	logger := log.With().Str("job_id", job.ID.String()).Str("agent_id", job.AgentID.String()).Logger()
+
+	finish := func(status string, err error) {
+		now := time.Now()
+		job.Status = status
+		job.CompletedAt = &now
+		if err != nil {
+			job.Error = err.Error()
+			logger.Error().Err(err).Msg("Training import failed")
+		}
+		// Saved even when the timeout cancelled the import
+		if err := h.saveTrainingImport(context.WithoutCancel(ctx), job); err != nil {
+			logger.Error().Err(err).Msg("Failed to save training import")
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		finish(models.TrainingImportFailed, err)
+		return
+	}
+	defer file.Close()
+
+	records, err := models.NewTrainingRecordReader(file, job.Format)
+	if err != nil {
+		finish(models.TrainingImportFailed, err)
+		return
+	}
+
+	source := "import:" + job.ID.String()
+	batch := make([]*models.TrainingSample, 0, h.cfg.TrainingImportBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := h.repos.Training.CreateBatch(ctx, batch); err != nil {
+			return err
+		}
+		job.Inserted += len(batch)
+		batch = batch[:0]
+		if err := h.saveTrainingImport(ctx, job); err != nil {
+			logger.Warn().Err(err).Msg("Failed to save training import progress")
+		}
+		return nil
+	}
+
+	for {
+		rec, line, err := records.Next()
+		if err == io.EOF {
+			break
+		}
+		var recordErr *models.TrainingRecordError
+		if errors.As(err, &recordErr) {
+			job.Processed++
+			job.Reject(recordErr.Line, recordErr.Err)
+			continue
+		}
+		if err != nil {
+			finish(models.TrainingImportFailed, err)
+			return
+		}
+
+		job.Processed++
+		sample, err := rec.Sample(job.AgentID, source, h.cfg.TrainingMaxInputChars, h.cfg.TrainingMaxOutputChars)
+		if err != nil {
+			job.Reject(line, err)
+			continue
+		}
+		batch = append(batch, sample)
+		if len(batch) >= h.cfg.TrainingImportBatchSize {
+			if err := flush(); err != nil {
+				finish(models.TrainingImportFailed, err)
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		finish(models.TrainingImportFailed, err)
+		return
+	}
+
+	logger.Info().Int("inserted", job.Inserted).Int("rejected", job.Rejected).Msg("Training import completed")
+	finish(models.TrainingImportCompleted, nil)
+}
@@ -1,28 +1,44 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"hash"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 
 	"github.com/vibber/backend/internal/config"
 	"github.com/vibber/backend/internal/models"
 	"github.com/vibber/backend/internal/repository"
+	"github.com/vibber/backend/internal/worker"
 	"github.com/vibber/backend/pkg/response"
 )
 
+// webhookJobTimeout caps processing one buffered event. Shutdown waits for
+// events in flight, so this also bounds how long it can take.
+const webhookJobTimeout = 30 * time.Second
+
 type WebhookHandler struct {
 	repos *repository.Repositories
 	redis *redis.Client
 	cfg   *config.Config
+	queue *worker.Queue
+
+	slackMAC  *hmacPool
+	githubMAC *hmacPool
 }
 
 func NewWebhookHandler(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *WebhookHandler {
@@ -30,20 +46,322 @@ func NewWebhookHandler(repos *repository.Repositories, redis *redis.Client, cfg
 		repos: repos,
 		redis: redis,
 		cfg:   cfg,
+		queue: worker.NewQueue(cfg.WebhookBufferSize, cfg.WebhookWorkers, webhookJobTimeout),
+
+		slackMAC:  newHMACPool(cfg.SlackClientSecret),
+		githubMAC: newHMACPool(cfg.GitHubClientSecret),
+	}
+}
+
+// Run processes buffered webhook events until ctx is cancelled
+func (h *WebhookHandler) Run(ctx context.Context) {
+	h.queue.Run(ctx)
+}
+
+// BufferStats reports webhook buffer depth for monitoring
+func (h *WebhookHandler) BufferStats(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, http.StatusOK, h.queue.Stats())
+}
+
+// Webhook event outcomes counted by recordEvent
+const (
+	webhookReceived = "received"
+	webhookQueued   = "queued"
+	webhookFiltered = "filtered"
+	webhookSkipped  = "skipped"
+	webhookInvalid  = "invalid"
+	webhookDropped  = "dropped"
+	webhookUnrouted = "unrouted"
+)
+
+const webhookMetricsTTL = 90 * 24 * time.Hour
+
+// webhookMetricsKey is the Redis hash holding one UTC day of webhook counters
+func webhookMetricsKey(day time.Time) string {
+	return "webhooks:metrics:" + day.UTC().Format("2006-01-02")
+}
+
+// webhookEventTypes are the event types counted by name. Event types come
+// from the request, unauthenticated for Jira, so any others are counted
+// together to keep the metrics hash bounded.
+var webhookEventTypes = map[string]map[string]bool{
+	"slack": {
+		"message": true, "app_mention": true,
+		"channel_left": true, "group_left": true, "member_joined_channel": true,
+	},
+	"github": {
+		"pull_request": true, "pull_request_review": true, "issue_comment": true, "issues": true,
+		"push": true, "ping": true,
+	},
+	"jira": {
+		"jira:issue_created": true, "jira:issue_updated": true, "jira:issue_deleted": true,
+		"comment_created": true, "comment_updated": true, "comment_deleted": true,
+	},
+}
+
+// webhookEventLabel is the name eventType is counted under
+func webhookEventLabel(provider, eventType string) string {
+	switch {
+	case webhookEventTypes[provider][eventType]:
+		return eventType
+	case eventType == "" || eventType == "unknown":
+		return "unknown"
+	default:
+		return "other"
+	}
+}
+
+// recordEvent increments the daily counter for a provider, event type and
+// outcome. Counting is best effort and never fails the webhook.
+func (h *WebhookHandler) recordEvent(ctx context.Context, provider, eventType, outcome string) {
+	key := webhookMetricsKey(time.Now())
+	pipe := h.redis.Pipeline()
+	pipe.HIncrBy(ctx, key, provider+"|"+webhookEventLabel(provider, eventType)+"|"+outcome, 1)
+	pipe.Expire(ctx, key, webhookMetricsTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("provider", provider).Msg("Failed to record webhook metrics")
 	}
 }
 
+// filtered acks an event the agents don't act on
+func (h *WebhookHandler) filtered(w http.ResponseWriter, r *http.Request, provider, eventType string) {
+	h.recordEvent(r.Context(), provider, eventType, webhookFiltered)
+	w.WriteHeader(http.StatusOK)
+}
+
+// invalid rejects a payload that is valid JSON but missing or mistyping a
+// field the handlers need. The 400 tells the provider it was received but
+// cannot be parsed.
+func (h *WebhookHandler) invalid(w http.ResponseWriter, r *http.Request, provider, eventType string, err error) {
+	if eventType == "" {
+		eventType = "unknown"
+	}
+	h.recordEvent(r.Context(), provider, eventType, webhookInvalid)
+	log.Warn().Err(err).Str("provider", provider).Str("event", eventType).Msg("Unparseable webhook payload")
+	response.Error(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+}
+
+// Reasons an event is acknowledged and recorded without being processed
+const (
+	skipSelf           = "self"            // Sent by the agent's own bot user; never processed
+	skipBot            = "bot"             // Sent by another bot or app, skipped when WEBHOOK_SKIP_BOTS is set
+	skipMessageEdited  = "message_edited"  // An edit of a message already seen
+	skipMessageDeleted = "message_deleted" // A deleted message
+	skipChannelNotice  = "channel_notice"  // Joins, leaves, topic and name changes
+	skipIgnoredAction  = "ignored_action"  // An action the agents do not review
+)
+
+// skipReason classifies events the agents acknowledge without acting on and
+// returns why, or "" when the event should be processed. Events from bots
+// are skipped only if skipBots is set; the agent's own messages are caught
+// per integration by isOwnEvent. For Slack, payload is the inner event.
+func skipReason(provider, eventType string, payload map[string]interface{}, skipBots bool) string {
+	if skipBots && isBotEvent(provider, payload) {
+		return skipBot
+	}
+	switch provider {
+	case "slack":
+		switch subtype, _ := payload["subtype"].(string); subtype {
+		case "message_changed":
+			return skipMessageEdited
+		case "message_deleted":
+			return skipMessageDeleted
+		case "channel_join", "channel_leave", "channel_topic", "channel_purpose", "channel_name",
+			"group_join", "group_leave", "group_topic", "group_purpose", "group_name":
+			return skipChannelNotice
+		}
+	case "github":
+		if eventType == "pull_request" {
+			switch payload["action"] {
+			case "opened", "synchronize", "ready_for_review":
+			default:
+				return skipIgnoredAction
+			}
+		}
+	}
+	return ""
+}
+
+// isBotEvent reports whether an event was sent by a bot or app account
+func isBotEvent(provider string, payload map[string]interface{}) bool {
+	switch provider {
+	case "slack":
+		botID, _ := payload["bot_id"].(string)
+		subtype, _ := payload["subtype"].(string)
+		return botID != "" || subtype == "bot_message"
+	case "github":
+		sender, _ := payload["sender"].(map[string]interface{})
+		return sender["type"] == "Bot"
+	case "jira":
+		author, _ := payload["user"].(map[string]interface{})
+		if comment, ok := payload["comment"].(map[string]interface{}); ok {
+			author, _ = comment["author"].(map[string]interface{})
+		}
+		return author != nil && author["accountType"] == "app"
+	}
+	return false
+}
+
+// eventRoute identifies the agents an event is for: those subscribed to the
+// workspace it came from or, for events posted to an integration's secret
+// URL, those of that integration
+type eventRoute struct {
+	provider    string
+	eventType   string              // As counted by recordEvent
+	workspace   string              // External ID of the workspace or account, matched against integrations
+	integration *models.Integration // Integration whose route token the event was posted with
+}
+
+// skippedEvent is a webhook event recorded as a skipped interaction
+type skippedEvent struct {
+	route           eventRoute
+	interactionType string
+	reason          string
+	payload         map[string]interface{}
+}
+
+// skip acks an event the agents should not act on. It is recorded as a
+// skipped interaction for each agent connected to the workspace so users can
+// see what was ignored and why, and is never published for processing.
+func (h *WebhookHandler) skip(w http.ResponseWriter, r *http.Request, e skippedEvent) {
+	h.recordEvent(r.Context(), e.route.provider, e.route.eventType, webhookSkipped)
+	// Recording is best effort; a full buffer must not make the provider retry
+	if !h.queue.Submit(func(ctx context.Context) { h.recordSkipped(ctx, e) }) {
+		log.Warn().Str("provider", e.route.provider).Str("reason", e.reason).Msg("Webhook buffer full, not recording skipped event")
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// recordSkipped stores a skipped interaction for every agent subscribed to
+// the event's workspace. Events that cannot be matched to an integration
+// are only counted.
+func (h *WebhookHandler) recordSkipped(ctx context.Context, e skippedEvent) {
+	subs, err := h.routeSubscribers(ctx, e.route)
+	if err != nil {
+		log.Error().Err(err).Str("provider", e.route.provider).Str("workspace", e.route.workspace).Msg("Failed to load integrations for skipped event")
+		return
+	}
+
+	for _, sub := range subs {
+		reason := e.reason
+		if reason == skipBot && sub.integration.IsOwnEvent(e.payload) {
+			reason = skipSelf
+		}
+		h.recordSkippedFor(ctx, sub, e, reason)
+	}
+}
+
+// recordSkippedFor stores a skipped interaction for one subscribed agent
+func (h *WebhookHandler) recordSkippedFor(ctx context.Context, sub eventSubscription, e skippedEvent, reason string) {
+	inputData, _ := json.Marshal(e.payload)
+	now := time.Now()
+	interaction := &models.Interaction{
+		ID:              uuid.New(),
+		AgentID:         sub.agentID,
+		IntegrationID:   sub.integration.ID,
+		Provider:        e.route.provider,
+		InteractionType: e.interactionType,
+		InputData:       string(inputData),
+		Status:          "skipped",
+		SkipReason:      &reason,
+		CompletedAt:     &now,
+	}
+	if err := h.repos.Interaction.Create(ctx, interaction); err != nil {
+		log.Error().Err(err).Str("agent_id", sub.agentID.String()).Msg("Failed to record skipped interaction")
+		return
+	}
+	invalidateAgentAnalytics(ctx, h.redis, sub.agentID)
+}
+
+// githubAccount returns the login of the account owning the event's repository
+func githubAccount(payload map[string]interface{}) string {
+	repo, _ := payload["repository"].(map[string]interface{})
+	owner, _ := repo["owner"].(map[string]interface{})
+	login, _ := owner["login"].(string)
+	return login
+}
+
+// jiraSite returns the site a Jira event came from, matched against the
+// integrations' Atlassian metadata: the cloud ID when the event links to its
+// resources through api.atlassian.com, else the site URL, e.g.
+// https://acme.atlassian.net. It returns "" when the event has no links.
+func jiraSite(payload map[string]interface{}) string {
+	for _, field := range []string{"issue", "comment", "user"} {
+		resource, _ := payload[field].(map[string]interface{})
+		self, _ := resource["self"].(string)
+		link, err := url.Parse(self)
+		if err != nil || link.Host == "" {
+			continue
+		}
+		if link.Host == "api.atlassian.com" {
+			// https://api.atlassian.com/ex/jira/{cloudId}/rest/api/...
+			parts := strings.Split(strings.TrimPrefix(link.Path, "/"), "/")
+			if len(parts) > 2 && parts[0] == "ex" && parts[1] == "jira" && parts[2] != "" {
+				return parts[2]
+			}
+			continue
+		}
+		// Data Center sites may be served under a context path
+		site, _, _ := strings.Cut(link.Path, "/rest/")
+		return link.Scheme + "://" + link.Host + site
+	}
+	return ""
+}
+
+// enqueue hands an event to the worker pool so the provider gets a fast ack.
+// Events from a workspace no integration is connected to are acked and
+// counted as unrouted without taking a place in the buffer. A full buffer is
+// answered with 429 so the provider retries later.
+func (h *WebhookHandler) enqueue(w http.ResponseWriter, r *http.Request, route eventRoute, job worker.Job) {
+	if !h.routable(r.Context(), route) {
+		h.recordEvent(r.Context(), route.provider, route.eventType, webhookUnrouted)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !h.queue.Submit(job) {
+		h.recordEvent(r.Context(), route.provider, route.eventType, webhookDropped)
+		stats := h.queue.Stats()
+		log.Warn().Str("provider", route.provider).Int("depth", stats.Depth).Int64("dropped", stats.Dropped).Msg("Webhook buffer full, rejecting event")
+		w.Header().Set("Retry-After", "5")
+		response.Error(w, http.StatusTooManyRequests, "Webhook buffer full")
+		return
+	}
+
+	h.recordEvent(r.Context(), route.provider, route.eventType, webhookQueued)
+	w.WriteHeader(http.StatusOK)
+}
+
+// routable reports whether the event's route can reach an agent: it was
+// posted to an integration's secret URL, or an integration is connected to
+// its workspace. Events are assumed routable when that cannot be checked;
+// the worker drops them if no agent turns out to be subscribed.
+func (h *WebhookHandler) routable(ctx context.Context, route eventRoute) bool {
+	if route.integration != nil {
+		return true
+	}
+	if route.workspace == "" {
+		return false
+	}
+	_, err := h.repos.Integration.GetByExternalID(ctx, route.provider, route.workspace)
+	if err != nil && !isNotFound(err) {
+		log.Warn().Err(err).Str("provider", route.provider).Str("workspace", route.workspace).Msg("Failed to look up integration for event")
+		return true
+	}
+	return err == nil
+}
+
 // Slack webhook handler
 func (h *WebhookHandler) Slack(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	// Verify Slack signature while the body is read
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	body, expected, err := h.slackMAC.readAndSign(r.Body, "v0:"+timestamp+":", "v0=")
 	if err != nil {
 		response.Error(w, http.StatusBadRequest, "Failed to read request body")
 		return
 	}
-	r.Body = io.NopCloser(bytes.NewBuffer(body))
 
-	// Verify Slack signature
-	if !h.verifySlackSignature(r, body) {
+	if !hmac.Equal([]byte(r.Header.Get("X-Slack-Signature")), expected) {
 		response.Error(w, http.StatusUnauthorized, "Invalid signature")
 		return
 	}
@@ -54,25 +372,52 @@ func (h *WebhookHandler) Slack(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.slackEvent(w, r, payload, nil)
+}
+
+// slackEvent handles an authenticated Slack Events API payload, posted with
+// the route token of via if it is set
+func (h *WebhookHandler) slackEvent(w http.ResponseWriter, r *http.Request, payload map[string]interface{}, via *models.Integration) {
+	envelope, err := models.ParseSlackEnvelope(payload)
+	if err != nil {
+		eventType, _ := payload["type"].(string)
+		h.invalid(w, r, "slack", eventType, err)
+		return
+	}
+
 	// Handle URL verification challenge
-	if payload["type"] == "url_verification" {
+	if envelope.Type == "url_verification" {
 		response.JSON(w, http.StatusOK, map[string]string{
-			"challenge": payload["challenge"].(string),
+			"challenge": envelope.Challenge,
 		})
 		return
 	}
 
 	// Handle event callback
-	if payload["type"] == "event_callback" {
-		event := payload["event"].(map[string]interface{})
-		eventType := event["type"].(string)
+	if envelope.Type == "event_callback" {
+		event, eventType, teamID := envelope.Event, envelope.EventType, envelope.TeamID
+		h.recordEvent(r.Context(), "slack", eventType, webhookReceived)
+		route := eventRoute{provider: "slack", eventType: eventType, workspace: teamID, integration: via}
 
 		switch eventType {
 		case "message":
-			h.handleSlackMessage(r.Context(), event)
+			if reason := skipReason("slack", eventType, event, h.cfg.WebhookSkipBots); reason != "" {
+				h.skip(w, r, skippedEvent{route: route, interactionType: "message", reason: reason, payload: event})
+				return
+			}
+			h.enqueue(w, r, route, func(ctx context.Context) { h.handleSlackMessage(ctx, route, event) })
 		case "app_mention":
-			h.handleSlackMention(r.Context(), event)
+			if reason := skipReason("slack", eventType, event, h.cfg.WebhookSkipBots); reason != "" {
+				h.skip(w, r, skippedEvent{route: route, interactionType: "mention", reason: reason, payload: event})
+				return
+			}
+			h.enqueue(w, r, route, func(ctx context.Context) { h.handleSlackMention(ctx, route, event) })
+		case "channel_left", "group_left", "member_joined_channel":
+			h.enqueue(w, r, route, func(ctx context.Context) { h.handleSlackMembership(ctx, teamID, eventType, event) })
+		default:
+			h.filtered(w, r, "slack", eventType)
 		}
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -80,39 +425,100 @@ func (h *WebhookHandler) Slack(w http.ResponseWriter, r *http.Request) {
 
 // GitHub webhook handler
 func (h *WebhookHandler) GitHub(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	// Sign with the global secret while the body is read, for deliveries no
+	// organization's secret applies to
+	body, globalExpected, err := h.githubMAC.readAndSign(r.Body, "", "sha256=")
 	if err != nil {
 		response.Error(w, http.StatusBadRequest, "Failed to read request body")
 		return
 	}
 
-	// Verify GitHub signature
-	signature := r.Header.Get("X-Hub-Signature-256")
-	if !h.verifyGitHubSignature(body, signature) {
+	var payload map[string]interface{}
+	jsonErr := json.Unmarshal(body, &payload)
+
+	valid, err := h.verifyGitHubSignature(r.Context(), body, r.Header.Get("X-Hub-Signature-256"), githubAccount(payload), globalExpected)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load GitHub webhook secrets")
+		response.Error(w, http.StatusInternalServerError, "Failed to verify signature")
+		return
+	}
+	if !valid {
 		response.Error(w, http.StatusUnauthorized, "Invalid signature")
 		return
 	}
 
+	if jsonErr != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	h.githubEvent(w, r, payload, nil)
+}
+
+// verifyGitHubSignature checks a delivery's signature against the webhook
+// secrets of the organizations connected to the account that owns the
+// repository. Only when no organization with a webhook secret is connected
+// is the global secret's signature, globalExpected, accepted.
+func (h *WebhookHandler) verifyGitHubSignature(ctx context.Context, body []byte, signature, account string, globalExpected []byte) (bool, error) {
+	if signature == "" {
+		return false, nil
+	}
+
+	var secrets []string
+	if account != "" {
+		var err error
+		if secrets, err = h.repos.Credential.ListWebhookSecrets(ctx, "github", account); err != nil {
+			return false, err
+		}
+	}
+	if len(secrets) == 0 {
+		return hmac.Equal([]byte(signature), globalExpected), nil
+	}
+
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if hmac.Equal([]byte(signature), []byte("sha256="+hex.EncodeToString(mac.Sum(nil)))) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// githubEvent handles an authenticated GitHub webhook payload, posted with
+// the route token of via if it is set
+func (h *WebhookHandler) githubEvent(w http.ResponseWriter, r *http.Request, payload map[string]interface{}, via *models.Integration) {
 	eventType := r.Header.Get("X-GitHub-Event")
+	h.recordEvent(r.Context(), "github", eventType, webhookReceived)
 
-	var payload map[string]interface{}
-	if err := json.Unmarshal(body, &payload); err != nil {
-		response.Error(w, http.StatusBadRequest, "Invalid JSON")
+	if err := models.CheckGitHubPayload(eventType, payload); err != nil {
+		h.invalid(w, r, "github", eventType, err)
 		return
 	}
 
+	var handle func(context.Context, eventRoute, map[string]interface{})
+	var interactionType string
 	switch eventType {
 	case "pull_request":
-		h.handleGitHubPR(r.Context(), payload)
+		handle, interactionType = h.handleGitHubPR, "pull_request"
 	case "pull_request_review":
-		h.handleGitHubPRReview(r.Context(), payload)
+		handle, interactionType = h.handleGitHubPRReview, "pr_review"
 	case "issue_comment":
-		h.handleGitHubComment(r.Context(), payload)
+		handle, interactionType = h.handleGitHubComment, "comment"
 	case "issues":
-		h.handleGitHubIssue(r.Context(), payload)
+		handle, interactionType = h.handleGitHubIssue, "issue"
+	default:
+		h.filtered(w, r, "github", eventType)
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	route := eventRoute{provider: "github", eventType: eventType, workspace: githubAccount(payload), integration: via}
+	if reason := skipReason("github", eventType, payload, h.cfg.WebhookSkipBots); reason != "" {
+		h.skip(w, r, skippedEvent{route: route, interactionType: interactionType, reason: reason, payload: payload})
+		return
+	}
+
+	h.enqueue(w, r, route, func(ctx context.Context) { handle(ctx, route, payload) })
 }
 
 // Jira webhook handler
@@ -129,47 +535,141 @@ func (h *WebhookHandler) Jira(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	webhookEvent := payload["webhookEvent"].(string)
+	h.jiraEvent(w, r, payload, nil)
+}
 
+// jiraEvent handles a Jira webhook payload, posted with the route token of
+// via if it is set
+func (h *WebhookHandler) jiraEvent(w http.ResponseWriter, r *http.Request, payload map[string]interface{}, via *models.Integration) {
+	webhookEvent, err := models.ParseJiraEvent(payload)
+	if err != nil {
+		eventType, _ := payload["webhookEvent"].(string)
+		h.invalid(w, r, "jira", eventType, err)
+		return
+	}
+
+	h.recordEvent(r.Context(), "jira", webhookEvent, webhookReceived)
+
+	var handle func(context.Context, eventRoute, map[string]interface{})
+	var interactionType string
 	switch webhookEvent {
 	case "jira:issue_created":
-		h.handleJiraIssueCreated(r.Context(), payload)
+		handle, interactionType = h.handleJiraIssueCreated, "issue_created"
 	case "jira:issue_updated":
-		h.handleJiraIssueUpdated(r.Context(), payload)
+		handle, interactionType = h.handleJiraIssueUpdated, "issue_updated"
 	case "comment_created":
-		h.handleJiraComment(r.Context(), payload)
+		handle, interactionType = h.handleJiraComment, "comment"
+	default:
+		h.filtered(w, r, "jira", webhookEvent)
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// Jira events are unsigned, so the site a payload names can't be trusted
+	// to pick agents. Only events posted to an integration's secret URL are
+	// routed, to that integration's agents; others are counted as unrouted.
+	route := eventRoute{provider: "jira", eventType: webhookEvent, integration: via}
+	if reason := skipReason("jira", webhookEvent, payload, h.cfg.WebhookSkipBots); reason != "" {
+		h.skip(w, r, skippedEvent{route: route, interactionType: interactionType, reason: reason, payload: payload})
+		return
+	}
+
+	h.enqueue(w, r, route, func(ctx context.Context) { handle(ctx, route, payload) })
+}
+
+// Routed handles events posted to an integration's secret webhook URL, for
+// providers that can't sign requests. The route token stands in for the
+// signature and identifies the integration, whose agents receive the event.
+// Events naming a workspace must come from the integration's own.
+func (h *WebhookHandler) Routed(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	hash := models.HashAgentToken(chi.URLParam(r, "routeToken"))
+
+	integration, err := h.repos.Integration.GetByRouteTokenHash(r.Context(), hash)
+	if err != nil && !isNotFound(err) {
+		response.Error(w, http.StatusInternalServerError, "Failed to verify webhook token")
+		return
+	}
+	if err != nil || integration.RouteTokenHash == nil ||
+		subtle.ConstantTimeCompare([]byte(*integration.RouteTokenHash), []byte(hash)) != 1 ||
+		integration.Provider != provider {
+		response.Error(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	var workspace string
+	switch provider {
+	case "slack":
+		workspace, _ = payload["team_id"].(string)
+	case "github":
+		workspace = githubAccount(payload)
+	case "jira":
+		workspace = jiraSite(payload)
+	}
+	if workspace != "" && !integration.InWorkspace(workspace) {
+		log.Warn().Str("integration_id", integration.ID.String()).Str("provider", provider).Str("workspace", workspace).Msg("Webhook token used for another workspace")
+		response.Error(w, http.StatusForbidden, "Event is not from the integration's workspace")
+		return
+	}
+
+	switch provider {
+	case "slack":
+		h.slackEvent(w, r, payload, integration)
+	case "github":
+		h.githubEvent(w, r, payload, integration)
+	case "jira":
+		h.jiraEvent(w, r, payload, integration)
+	}
 }
 
 // Signature verification helpers
-func (h *WebhookHandler) verifySlackSignature(r *http.Request, body []byte) bool {
-	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
-	signature := r.Header.Get("X-Slack-Signature")
 
-	baseString := "v0:" + timestamp + ":" + string(body)
-	mac := hmac.New(sha256.New, []byte(h.cfg.SlackClientSecret))
-	mac.Write([]byte(baseString))
-	expectedSignature := "v0=" + hex.EncodeToString(mac.Sum(nil))
+// hmacPool reuses HMAC-SHA256 hashers keyed with one secret, so verifying a
+// webhook does not allocate a new hasher per request
+type hmacPool struct {
+	pool sync.Pool
+}
 
-	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+func newHMACPool(secret string) *hmacPool {
+	key := []byte(secret)
+	return &hmacPool{pool: sync.Pool{
+		New: func() interface{} { return hmac.New(sha256.New, key) },
+	}}
 }
 
-func (h *WebhookHandler) verifyGitHubSignature(body []byte, signature string) bool {
-	if signature == "" {
-		return false
-	}
+// readAndSign reads body in full, streaming it into a pooled HMAC after
+// prefix. It returns the body and the expected signature, scheme followed by
+// the hex-encoded MAC, for comparison with hmac.Equal.
+func (p *hmacPool) readAndSign(body io.Reader, prefix, scheme string) ([]byte, []byte, error) {
+	mac := p.pool.Get().(hash.Hash)
+	mac.Reset()
+	defer p.pool.Put(mac)
 
-	mac := hmac.New(sha256.New, []byte(h.cfg.GitHubClientSecret))
-	mac.Write(body)
-	expectedSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	io.WriteString(mac, prefix)
+	data, err := io.ReadAll(io.TeeReader(body, mac))
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+	var sum [sha256.Size]byte
+	digest := mac.Sum(sum[:0])
+	expected := make([]byte, len(scheme)+hex.EncodedLen(len(digest)))
+	copy(expected, scheme)
+	hex.Encode(expected[len(scheme):], digest)
+	return data, expected, nil
 }
 
-// Event handlers - these would queue events for the AI agent to process
-func (h *WebhookHandler) handleSlackMessage(ctx context.Context, event map[string]interface{}) {
+func (h *WebhookHandler) handleSlackMessage(ctx context.Context, route eventRoute, event map[string]interface{}) {
 	// Create interaction record
 	interaction := &models.Interaction{
 		ID:              uuid.New(),
@@ -182,10 +682,10 @@ func (h *WebhookHandler) handleSlackMessage(ctx context.Context, event map[strin
 	interaction.InputData = string(inputData)
 
 	// Queue for AI agent processing
-	h.queueForProcessing(ctx, interaction)
+	h.queueForProcessing(ctx, interaction, route, event)
 }
 
-func (h *WebhookHandler) handleSlackMention(ctx context.Context, event map[string]interface{}) {
+func (h *WebhookHandler) handleSlackMention(ctx context.Context, route eventRoute, event map[string]interface{}) {
 	interaction := &models.Interaction{
 		ID:              uuid.New(),
 		Provider:        "slack",
@@ -196,15 +696,58 @@ func (h *WebhookHandler) handleSlackMention(ctx context.Context, event map[strin
 	inputData, _ := json.Marshal(event)
 	interaction.InputData = string(inputData)
 
-	h.queueForProcessing(ctx, interaction)
+	h.queueForProcessing(ctx, interaction, route, event)
 }
 
-func (h *WebhookHandler) handleGitHubPR(ctx context.Context, payload map[string]interface{}) {
-	action := payload["action"].(string)
-	if action != "opened" && action != "synchronize" && action != "ready_for_review" {
+// handleSlackMembership keeps the allowed channels of every integration in
+// the workspace in step with the bot's channel membership: channels it was
+// removed from are disabled and channels it joined are enabled
+func (h *WebhookHandler) handleSlackMembership(ctx context.Context, teamID, eventType string, event map[string]interface{}) {
+	channel, _ := event["channel"].(string)
+	if teamID == "" || channel == "" {
+		return
+	}
+
+	integrations, err := h.repos.Integration.ListByExternalID(ctx, "slack", teamID)
+	if err != nil {
+		log.Error().Err(err).Str("team_id", teamID).Msg("Failed to load Slack integrations")
 		return
 	}
 
+	for _, integration := range integrations {
+		meta, err := integration.SlackMetadata()
+		if err != nil {
+			log.Warn().Err(err).Str("integration_id", integration.ID.String()).Msg("Skipping Slack integration with invalid metadata")
+			continue
+		}
+
+		var changed bool
+		if eventType == "member_joined_channel" {
+			// Other members joining says nothing about the bot
+			if user, _ := event["user"].(string); user == "" || user != meta.BotUserID {
+				continue
+			}
+			changed = meta.JoinChannel(channel)
+		} else {
+			changed = meta.LeaveChannel(channel)
+		}
+		if !changed {
+			continue
+		}
+
+		if err := integration.SetMetadata(meta); err != nil {
+			log.Error().Err(err).Str("integration_id", integration.ID.String()).Msg("Failed to encode Slack metadata")
+			continue
+		}
+		if err := h.repos.Integration.UpdateMetadata(ctx, integration); err != nil {
+			log.Error().Err(err).Str("integration_id", integration.ID.String()).Msg("Failed to update Slack channels")
+			continue
+		}
+		log.Info().Str("integration_id", integration.ID.String()).Str("channel", channel).Str("event", eventType).Msg("Updated Slack allowed channels")
+	}
+}
+
+func (h *WebhookHandler) handleGitHubPR(ctx context.Context, route eventRoute, payload map[string]interface{}) {
 	interaction := &models.Interaction{
 		ID:              uuid.New(),
 		Provider:        "github",
@@ -215,10 +758,10 @@ func (h *WebhookHandler) handleGitHubPR(ctx context.Context, payload map[string]
 	inputData, _ := json.Marshal(payload)
 	interaction.InputData = string(inputData)
 
-	h.queueForProcessing(ctx, interaction)
+	h.queueForProcessing(ctx, interaction, route, payload)
 }
 
-func (h *WebhookHandler) handleGitHubPRReview(ctx context.Context, payload map[string]interface{}) {
+func (h *WebhookHandler) handleGitHubPRReview(ctx context.Context, route eventRoute, payload map[string]interface{}) {
 	interaction := &models.Interaction{
 		ID:              uuid.New(),
 		Provider:        "github",
@@ -229,10 +772,10 @@ func (h *WebhookHandler) handleGitHubPRReview(ctx context.Context, payload map[s
 	inputData, _ := json.Marshal(payload)
 	interaction.InputData = string(inputData)
 
-	h.queueForProcessing(ctx, interaction)
+	h.queueForProcessing(ctx, interaction, route, payload)
 }
 
-func (h *WebhookHandler) handleGitHubComment(ctx context.Context, payload map[string]interface{}) {
+func (h *WebhookHandler) handleGitHubComment(ctx context.Context, route eventRoute, payload map[string]interface{}) {
 	interaction := &models.Interaction{
 		ID:              uuid.New(),
 		Provider:        "github",
@@ -243,10 +786,10 @@ func (h *WebhookHandler) handleGitHubComment(ctx context.Context, payload map[st
 	inputData, _ := json.Marshal(payload)
 	interaction.InputData = string(inputData)
 
-	h.queueForProcessing(ctx, interaction)
+	h.queueForProcessing(ctx, interaction, route, payload)
 }
 
-func (h *WebhookHandler) handleGitHubIssue(ctx context.Context, payload map[string]interface{}) {
+func (h *WebhookHandler) handleGitHubIssue(ctx context.Context, route eventRoute, payload map[string]interface{}) {
 	interaction := &models.Interaction{
 		ID:              uuid.New(),
 		Provider:        "github",
@@ -257,10 +800,10 @@ func (h *WebhookHandler) handleGitHubIssue(ctx context.Context, payload map[stri
 	inputData, _ := json.Marshal(payload)
 	interaction.InputData = string(inputData)
 
-	h.queueForProcessing(ctx, interaction)
+	h.queueForProcessing(ctx, interaction, route, payload)
 }
 
-func (h *WebhookHandler) handleJiraIssueCreated(ctx context.Context, payload map[string]interface{}) {
+func (h *WebhookHandler) handleJiraIssueCreated(ctx context.Context, route eventRoute, payload map[string]interface{}) {
 	interaction := &models.Interaction{
 		ID:              uuid.New(),
 		Provider:        "jira",
@@ -271,10 +814,10 @@ func (h *WebhookHandler) handleJiraIssueCreated(ctx context.Context, payload map
 	inputData, _ := json.Marshal(payload)
 	interaction.InputData = string(inputData)
 
-	h.queueForProcessing(ctx, interaction)
+	h.queueForProcessing(ctx, interaction, route, payload)
 }
 
-func (h *WebhookHandler) handleJiraIssueUpdated(ctx context.Context, payload map[string]interface{}) {
+func (h *WebhookHandler) handleJiraIssueUpdated(ctx context.Context, route eventRoute, payload map[string]interface{}) {
 	interaction := &models.Interaction{
 		ID:              uuid.New(),
 		Provider:        "jira",
@@ -285,10 +828,10 @@ func (h *WebhookHandler) handleJiraIssueUpdated(ctx context.Context, payload map
 	inputData, _ := json.Marshal(payload)
 	interaction.InputData = string(inputData)
 
-	h.queueForProcessing(ctx, interaction)
+	h.queueForProcessing(ctx, interaction, route, payload)
 }
 
-func (h *WebhookHandler) handleJiraComment(ctx context.Context, payload map[string]interface{}) {
+func (h *WebhookHandler) handleJiraComment(ctx context.Context, route eventRoute, payload map[string]interface{}) {
 	interaction := &models.Interaction{
 		ID:              uuid.New(),
 		Provider:        "jira",
@@ -299,12 +842,188 @@ func (h *WebhookHandler) handleJiraComment(ctx context.Context, payload map[stri
 	inputData, _ := json.Marshal(payload)
 	interaction.InputData = string(inputData)
 
-	h.queueForProcessing(ctx, interaction)
+	h.queueForProcessing(ctx, interaction, route, payload)
+}
+
+// queueForProcessing stores and publishes an interaction for every agent
+// subscribed to the event's route, linked to the agent and the integration
+// it arrived through. Events no agent is subscribed to are counted as
+// unrouted and dropped: an interaction of no agent is never processed.
+func (h *WebhookHandler) queueForProcessing(ctx context.Context, interaction *models.Interaction, route eventRoute, payload map[string]interface{}) {
+	subs, err := h.routeSubscribers(ctx, route)
+	if err != nil {
+		log.Error().Err(err).Str("provider", route.provider).Str("workspace", route.workspace).Msg("Failed to load integrations for event")
+		return
+	}
+	if len(subs) == 0 {
+		h.recordEvent(ctx, route.provider, route.eventType, webhookUnrouted)
+		log.Info().Str("provider", route.provider).Str("workspace", route.workspace).Str("event", route.eventType).Msg("No agent subscribed to event, dropping it")
+		return
+	}
+
+	digest := sha256.Sum256([]byte(interaction.InputData))
+	eventHash := hex.EncodeToString(digest[:])
+	for i, sub := range subs {
+		// Nothing is queued for agents whose organization has paused them all
+		paused, err := h.repos.Agent.IsOrgPaused(ctx, sub.agentID)
+		if err != nil {
+			log.Error().Err(err).Str("agent_id", sub.agentID.String()).Msg("Failed to check organization pause")
+			continue
+		}
+		if paused {
+			log.Info().Str("agent_id", sub.agentID.String()).Str("provider", interaction.Provider).Msg("Organization agents paused, skipping event")
+			continue
+		}
+
+		// An agent never reacts to its own messages, which would loop
+		if sub.integration.IsOwnEvent(payload) {
+			h.recordSkippedFor(ctx, sub, skippedEvent{
+				route:           route,
+				interactionType: interaction.InteractionType,
+				payload:         payload,
+			}, skipSelf)
+			continue
+		}
+
+		// Providers redeliver events they think were lost; each agent acts on
+		// an event once
+		claimed, err := h.redis.SetNX(ctx, webhookDeliveryKey(sub.agentID, eventHash), "1", webhookDeliveryTTL).Result()
+		if err != nil {
+			log.Warn().Err(err).Str("agent_id", sub.agentID.String()).Msg("Failed to claim webhook delivery")
+		} else if !claimed {
+			log.Info().Str("agent_id", sub.agentID.String()).Str("provider", interaction.Provider).Msg("Event already delivered to agent, skipping")
+			continue
+		}
+
+		routed := *interaction
+		if i > 0 {
+			routed.ID = uuid.New()
+		}
+		routed.AgentID = sub.agentID
+		routed.IntegrationID = sub.integration.ID
+		if h.deferForMaintenance(ctx, &routed) {
+			continue
+		}
+
+		// Stored first, so the interaction exists when the agent reports on it
+		if err := h.repos.Interaction.Create(ctx, &routed); err != nil {
+			log.Error().Err(err).Str("agent_id", sub.agentID.String()).Msg("Failed to store interaction")
+			// Let a redelivery of the event try again
+			h.redis.Del(ctx, webhookDeliveryKey(sub.agentID, eventHash))
+			continue
+		}
+		invalidateAgentAnalytics(ctx, h.redis, sub.agentID)
+		h.publish(ctx, &routed)
+	}
+}
+
+// deferForMaintenance stores the interaction as deferred when a maintenance
+// window is in progress for its agent, reporting whether it did. The
+// maintenance releaser queues or drops it once the window ends. Events are
+// processed as usual when the windows cannot be checked.
+func (h *WebhookHandler) deferForMaintenance(ctx context.Context, interaction *models.Interaction) bool {
+	windows, err := h.repos.Maintenance.ListForAgent(ctx, interaction.AgentID)
+	if err != nil {
+		log.Error().Err(err).Str("agent_id", interaction.AgentID.String()).Msg("Failed to check maintenance windows")
+		return false
+	}
+	active := models.ActiveMaintenanceWindow(windows, time.Now())
+	if active == nil {
+		return false
+	}
+
+	deferred := *interaction
+	deferred.Status = "deferred"
+	deferred.DeferredBy = &active.Window.ID
+	if err := h.repos.Interaction.Create(ctx, &deferred); err != nil {
+		log.Error().Err(err).Str("agent_id", interaction.AgentID.String()).Msg("Failed to defer interaction")
+		return false
+	}
+	invalidateAgentAnalytics(ctx, h.redis, interaction.AgentID)
+	log.Info().Str("agent_id", interaction.AgentID.String()).Str("window_id", active.Window.ID.String()).Msg("Maintenance window active, deferring event")
+	return true
 }
 
-func (h *WebhookHandler) queueForProcessing(ctx context.Context, interaction *models.Interaction) {
+func (h *WebhookHandler) publish(ctx context.Context, interaction *models.Interaction) {
 	// Publish to message queue for AI agent to process
 	// In production, this would use RabbitMQ or similar
 	message, _ := json.Marshal(interaction)
 	h.redis.Publish(ctx, "agent:interactions", message)
 }
+
+const webhookDeliveryTTL = time.Hour
+
+func webhookDeliveryKey(agentID uuid.UUID, eventHash string) string {
+	return "webhooks:delivered:" + agentID.String() + ":" + eventHash
+}
+
+// eventSubscription is an agent receiving a workspace's events through one
+// of its integrations
+type eventSubscription struct {
+	agentID     uuid.UUID
+	integration *models.Integration
+}
+
+// routeSubscribers returns the agents subscribed to the event's route: those
+// of the integration it was posted to, else those of the workspace. Events
+// whose workspace is unknown have none.
+func (h *WebhookHandler) routeSubscribers(ctx context.Context, route eventRoute) ([]eventSubscription, error) {
+	if route.integration != nil {
+		return h.integrationSubscribers(ctx, route.integration)
+	}
+	if route.workspace == "" {
+		return nil, nil
+	}
+	return h.subscribers(ctx, route.provider, route.workspace)
+}
+
+// integrationSubscribers returns the agents subscribed to one integration,
+// none if it is disabled
+func (h *WebhookHandler) integrationSubscribers(ctx context.Context, integration *models.Integration) ([]eventSubscription, error) {
+	if !integration.Enabled {
+		return nil, nil
+	}
+	agentIDs, err := h.repos.Integration.ListAgentIDs(ctx, integration.ID)
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]eventSubscription, 0, len(agentIDs))
+	for _, agentID := range agentIDs {
+		subs = append(subs, eventSubscription{agentID: agentID, integration: integration})
+	}
+	return subs, nil
+}
+
+// subscribers returns every agent subscribed to an enabled integration
+// connected to the workspace. An agent reached through several integrations
+// is listed once, through the integration it owns if there is one, so one
+// event never produces two conflicting actions from the same agent.
+func (h *WebhookHandler) subscribers(ctx context.Context, provider, workspace string) ([]eventSubscription, error) {
+	integrations, err := h.repos.Integration.ListByExternalID(ctx, provider, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []eventSubscription
+	seen := make(map[uuid.UUID]int)
+	for _, integration := range integrations {
+		if !integration.Enabled {
+			continue
+		}
+		agentIDs, err := h.repos.Integration.ListAgentIDs(ctx, integration.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, agentID := range agentIDs {
+			if i, ok := seen[agentID]; ok {
+				if integration.AgentID == agentID {
+					subs[i].integration = integration
+				}
+				continue
+			}
+			seen[agentID] = len(subs)
+			subs = append(subs, eventSubscription{agentID: agentID, integration: integration})
+		}
+	}
+	return subs, nil
+}
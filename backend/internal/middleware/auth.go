@@ -2,16 +2,21 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/repository"
 	"github.com/vibber/backend/pkg/response"
 )
 
-// JWTAuth middleware validates JWT tokens
-func JWTAuth(secret string) func(http.Handler) http.Handler {
+// JWTAuth middleware validates JWT tokens, rejecting access tokens that were
+// logged out
+func JWTAuth(secret string, blacklist *TokenBlacklist) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -46,30 +51,152 @@ func JWTAuth(secret string) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Extract user information from claims
-			userID, err := uuid.Parse(claims["sub"].(string))
+			// Tokens issued before jti was added can't be revoked; they expire
+			// within the access token lifetime
+			jti, _ := claims["jti"].(string)
+			if jti != "" {
+				revoked, err := blacklist.Revoked(r.Context(), jti)
+				if err != nil {
+					log.Warn().Err(err).Bool("fail_open", !revoked).Msg("Failed to check token blacklist")
+					if revoked {
+						response.Error(w, http.StatusServiceUnavailable, "Unable to verify token")
+						return
+					}
+				} else if revoked {
+					response.Error(w, http.StatusUnauthorized, "Token has been revoked")
+					return
+				}
+			}
+
+			// Extract user information from claims. A validly signed token can
+			// still lack claims, so every one is checked before use.
+			sub, _ := claims["sub"].(string)
+			userID, err := uuid.Parse(sub)
 			if err != nil {
 				response.Error(w, http.StatusUnauthorized, "Invalid user ID in token")
 				return
 			}
 
-			orgID, err := uuid.Parse(claims["orgId"].(string))
+			orgClaim, _ := claims["orgId"].(string)
+			orgID, err := uuid.Parse(orgClaim)
 			if err != nil {
 				response.Error(w, http.StatusUnauthorized, "Invalid organization ID in token")
 				return
 			}
 
+			email, emailOK := claims["email"].(string)
+			role, roleOK := claims["role"].(string)
+			if !emailOK || !roleOK {
+				response.Error(w, http.StatusUnauthorized, "Invalid token claims")
+				return
+			}
+
 			// Add user info to context
 			ctx := context.WithValue(r.Context(), "userID", userID)
 			ctx = context.WithValue(ctx, "orgID", orgID)
-			ctx = context.WithValue(ctx, "userEmail", claims["email"].(string))
-			ctx = context.WithValue(ctx, "userRole", claims["role"].(string))
+			ctx = context.WithValue(ctx, "userEmail", email)
+			ctx = context.WithValue(ctx, "userRole", role)
+			if jti != "" {
+				ctx = context.WithValue(ctx, "tokenID", jti)
+			}
+			if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+				ctx = context.WithValue(ctx, "tokenExpiresAt", exp.Time)
+			}
+			// Tokens issued since sessions were introduced name the session
+			if sid, ok := claims["sid"].(string); ok {
+				if sessionID, err := uuid.Parse(sid); err == nil {
+					ctx = context.WithValue(ctx, "sessionID", sessionID)
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireOrgMembership middleware ensures the user still belongs to the
+// organization carried in the token, and uses the membership role for the
+// request. The role may be cached for up to the cache's TTL.
+func RequireOrgMembership(roles *RoleCache) func(http.Handler) http.Handler {
+	return withRole(roles, roles.ttl)
+}
+
+// ServiceKeyAuth middleware authenticates internal service-to-service calls
+// using the X-Service-Key header
+func ServiceKeyAuth(key string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Service-Key")), []byte(key)) != 1 {
+				response.Error(w, http.StatusUnauthorized, "Invalid service key")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ServiceKeyOrPlatformAdmin accepts either the X-Service-Key or a bearer
+// token belonging to a platform admin
+func ServiceKeyOrPlatformAdmin(key, jwtSecret string, blacklist *TokenBlacklist, adminIDs []uuid.UUID) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		admin := JWTAuth(jwtSecret, blacklist)(RequirePlatformAdmin(adminIDs)(next))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token := r.Header.Get("X-Service-Key"); token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			admin.ServeHTTP(w, r)
+		})
+	}
+}
 
+// AgentTokenAuth accepts either the global service key or an organization's
+// agent token. Requests made with an agent token carry the token's org as
+// "serviceOrgID" so handlers can keep them to that organization.
+func AgentTokenAuth(key string, orgs repository.OrganizationRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get("X-Service-Key")
+			if token == "" {
+				response.Error(w, http.StatusUnauthorized, "Invalid service key")
+				return
+			}
+
+			if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			org, err := orgs.GetByAgentTokenHash(r.Context(), models.HashAgentToken(token))
+			if err != nil {
+				response.Error(w, http.StatusUnauthorized, "Invalid service key")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "serviceOrgID", org.ID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// RequirePlatformAdmin restricts a route to the configured platform operators,
+// identified by user ID. Organization admins are not platform admins.
+func RequirePlatformAdmin(adminIDs []uuid.UUID) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value("userID").(uuid.UUID)
+			for _, admin := range adminIDs {
+				if ok && userID == admin {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			response.Error(w, http.StatusForbidden, "Platform admin access required")
+		})
+	}
+}
+
 // RequireRole middleware checks if user has required role
 func RequireRole(roles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenBlacklist records access tokens revoked before they expire, by their
+// jti. Entries expire with the token, so the blacklist only ever holds tokens
+// that would otherwise still be accepted.
+type TokenBlacklist struct {
+	redis    *redis.Client
+	failOpen bool
+}
+
+func NewTokenBlacklist(redis *redis.Client, failOpen bool) *TokenBlacklist {
+	return &TokenBlacklist{
+		redis:    redis,
+		failOpen: failOpen,
+	}
+}
+
+func blacklistKey(jti string) string {
+	return "token_blacklist:" + jti
+}
+
+// Revoke blacklists the token until it expires. Already expired tokens are
+// not recorded.
+func (b *TokenBlacklist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return b.redis.Set(ctx, blacklistKey(jti), 1, ttl).Err()
+}
+
+// Revoked reports whether the token was revoked. When Redis can't be asked
+// it returns the error along with the configured fallback: not revoked when
+// failing open, revoked when failing closed.
+func (b *TokenBlacklist) Revoked(ctx context.Context, jti string) (bool, error) {
+	n, err := b.redis.Exists(ctx, blacklistKey(jti)).Result()
+	if err != nil {
+		return !b.failOpen, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/repository"
+)
+
+// QueryBudget counts the database queries each request runs and logs a
+// warning for requests that run more than budget, which usually means a
+// query inside a loop. The budget is soft: the request is not interrupted.
+// A budget of 0 only counts. Must run after middleware.RequestID.
+func QueryBudget(budget int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			stats := &repository.QueryStats{RequestID: middleware.GetReqID(r.Context())}
+			next.ServeHTTP(w, r.WithContext(repository.WithQueryStats(r.Context(), stats)))
+
+			if budget > 0 && stats.Queries() > budget {
+				log.Warn().
+					Str("request_id", stats.RequestID).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Int("queries", stats.Queries()).
+					Int("budget", budget).
+					Msg("Request exceeded query budget")
+			}
+		})
+	}
+}
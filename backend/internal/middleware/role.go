@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vibber/backend/internal/repository"
+	"github.com/vibber/backend/pkg/response"
+)
+
+// RoleCache reads members' organization roles from Postgres through a
+// short-lived Redis cache, so most requests don't pay for a membership query
+// while role changes still take effect well before the token expires
+type RoleCache struct {
+	memberships repository.MembershipRepository
+	redis       *redis.Client
+	ttl         time.Duration
+}
+
+func NewRoleCache(memberships repository.MembershipRepository, redis *redis.Client, ttl time.Duration) *RoleCache {
+	return &RoleCache{
+		memberships: memberships,
+		redis:       redis,
+		ttl:         ttl,
+	}
+}
+
+// cachedRole is a role and when it was read from Postgres
+type cachedRole struct {
+	Role      string `json:"role"`
+	CheckedAt int64  `json:"checkedAt"` // Unix seconds
+}
+
+func roleCacheKey(userID, orgID uuid.UUID) string {
+	return fmt.Sprintf("roles:%s:%s", orgID, userID)
+}
+
+// Role returns the user's role in the organization, reading it from Postgres
+// when the cached role is older than maxAge. A maxAge of 0 always reads
+// Postgres. Missing memberships are not cached.
+func (c *RoleCache) Role(ctx context.Context, userID, orgID uuid.UUID, maxAge time.Duration) (string, error) {
+	key := roleCacheKey(userID, orgID)
+	if maxAge > 0 && c.ttl > 0 {
+		var cached cachedRole
+		if data, err := c.redis.Get(ctx, key).Bytes(); err == nil && json.Unmarshal(data, &cached) == nil &&
+			time.Since(time.Unix(cached.CheckedAt, 0)) <= maxAge {
+			return cached.Role, nil
+		}
+	}
+
+	membership, err := c.memberships.Get(ctx, userID, orgID)
+	if err != nil {
+		return "", err
+	}
+	if c.ttl > 0 {
+		if data, err := json.Marshal(cachedRole{Role: membership.Role, CheckedAt: time.Now().Unix()}); err == nil {
+			c.redis.Set(ctx, key, data, c.ttl)
+		}
+	}
+	return membership.Role, nil
+}
+
+// withRole resolves the requester's role no older than maxAge and stores it
+// as the request's userRole, rejecting users no longer in the organization
+func withRole(roles *RoleCache, maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := r.Context().Value("userID").(uuid.UUID)
+			orgID := r.Context().Value("orgID").(uuid.UUID)
+
+			role, err := roles.Role(r.Context(), userID, orgID, maxAge)
+			if errors.Is(err, repository.ErrNotFound) {
+				response.Error(w, http.StatusForbidden, "Not a member of this organization")
+				return
+			}
+			if err != nil {
+				response.Error(w, http.StatusInternalServerError, "Failed to check organization membership")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "userRole", role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireFreshRole re-resolves the requester's role for a sensitive route,
+// allowing a cached role at most maxAge old; 0 reads it from Postgres. Use it
+// after RequireOrgMembership on admin-gated destructive endpoints, so a
+// demoted admin loses access immediately rather than when the cache expires.
+func RequireFreshRole(roles *RoleCache, maxAge time.Duration) func(http.Handler) http.Handler {
+	return withRole(roles, maxAge)
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vibber/backend/pkg/response"
+)
+
+// APIVersions lists the API versions clients may request with the
+// Accept-Version header
+var APIVersions = []string{"v1", "v2"}
+
+// RouteDeprecation flags an endpoint as deprecated
+type RouteDeprecation struct {
+	Method    string
+	Pattern   string    // Full chi route pattern, e.g. /api/v1/interactions
+	Since     time.Time // Sent as the Deprecation header
+	Sunset    time.Time // Sent as the Sunset header; zero omits it
+	Successor string    // Linked with rel="successor-version"; empty omits it
+}
+
+// DeprecatedRoutes is the registry of deprecated endpoints
+var DeprecatedRoutes = []RouteDeprecation{
+	{
+		Method:    http.MethodGet,
+		Pattern:   "/api/v1/interactions",
+		Since:     time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+		Sunset:    time.Date(2027, 4, 16, 0, 0, 0, 0, time.UTC),
+		Successor: "/api/v2/interactions",
+	},
+}
+
+// AcceptVersion routes /api/<version>/... requests to the version named in
+// the Accept-Version header when routes has a matching endpoint, and falls
+// back to the version in the path otherwise. The version served is reported
+// in the API-Version response header. Must run before routing.
+func AcceptVersion(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			current, rest, ok := splitVersionedPath(r.URL.Path)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Version")
+			served := current
+
+			requested := strings.ToLower(strings.TrimSpace(r.Header.Get("Accept-Version")))
+			if requested != "" && requested != current {
+				if !isAPIVersion(requested) {
+					response.Error(w, http.StatusBadRequest, "Unsupported Accept-Version, expected one of: "+strings.Join(APIVersions, ", "))
+					return
+				}
+				target := "/api/" + requested + rest
+				if routes.Match(chi.NewRouteContext(), r.Method, target) {
+					r.URL.Path = target
+					r.URL.RawPath = ""
+					served = requested
+				}
+			}
+
+			w.Header().Set("API-Version", served)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Deprecations stamps Deprecation, Sunset and successor Link headers on
+// requests for endpoints in registry. Must run before routing, after
+// AcceptVersion.
+func Deprecations(routes chi.Routes, registry []RouteDeprecation) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rctx := chi.NewRouteContext()
+			if routes.Match(rctx, r.Method, r.URL.Path) {
+				if d, ok := findDeprecation(registry, r.Method, rctx.RoutePattern()); ok {
+					setDeprecationHeaders(w.Header(), d)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func findDeprecation(registry []RouteDeprecation, method, pattern string) (RouteDeprecation, bool) {
+	for _, d := range registry {
+		if d.Method == method && d.Pattern == pattern {
+			return d, true
+		}
+	}
+	return RouteDeprecation{}, false
+}
+
+// setDeprecationHeaders writes the RFC 9745 Deprecation and RFC 8594 Sunset
+// headers
+func setDeprecationHeaders(h http.Header, d RouteDeprecation) {
+	h.Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+	if !d.Sunset.IsZero() {
+		h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Successor != "" {
+		h.Add("Link", "<"+d.Successor+`>; rel="successor-version"`)
+	}
+}
+
+// splitVersionedPath splits /api/v1/agents into "v1" and "/agents"
+func splitVersionedPath(path string) (version, rest string, ok bool) {
+	trimmed, found := strings.CutPrefix(path, "/api/")
+	if !found {
+		return "", "", false
+	}
+	version, rest, _ = strings.Cut(trimmed, "/")
+	if !isAPIVersion(version) {
+		return "", "", false
+	}
+	return version, "/" + rest, true
+}
+
+func isAPIVersion(v string) bool {
+	for _, known := range APIVersions {
+		if v == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// AIQuota is the AI service's rate limit state for an organization, as
+// reported by the headers of its last response. Nil fields were not reported.
+type AIQuota struct {
+	Limit     *int       `json:"limit"`
+	Remaining *int       `json:"remaining"`
+	ResetAt   *time.Time `json:"resetAt"`
+}
+
+// Exhausted reports whether the quota is used up and not yet reset
+func (q *AIQuota) Exhausted(now time.Time) bool {
+	if q == nil || q.Remaining == nil || *q.Remaining > 0 {
+		return false
+	}
+	return q.ResetAt == nil || q.ResetAt.After(now)
+}
+
+// RetryAfter returns how long until the quota resets, rounded up to a whole
+// second, or 0 if the reset time is unknown or past
+func (q *AIQuota) RetryAfter(now time.Time) time.Duration {
+	if q == nil || q.ResetAt == nil || !q.ResetAt.After(now) {
+		return 0
+	}
+	wait := q.ResetAt.Sub(now)
+	if rem := wait % time.Second; rem != 0 {
+		wait += time.Second - rem
+	}
+	return wait
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InteractionCursor marks the last interaction of a page in a list ordered
+// by creation time, newest first. The ID breaks ties between rows created
+// in the same instant.
+type InteractionCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Encode returns the opaque cursor string handed to clients
+func (c InteractionCursor) Encode() string {
+	return encodeCursor(c.CreatedAt, c.ID)
+}
+
+// DecodeInteractionCursor parses a cursor produced by Encode
+func DecodeInteractionCursor(s string) (*InteractionCursor, error) {
+	t, id, err := decodeCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	return &InteractionCursor{CreatedAt: t, ID: id}, nil
+}
+
+// EscalationCursor marks the last escalation of a page in a list ordered by
+// resolution time, oldest first
+type EscalationCursor struct {
+	ResolvedAt time.Time
+	ID         uuid.UUID
+}
+
+// Encode returns the opaque cursor string handed to clients
+func (c EscalationCursor) Encode() string {
+	return encodeCursor(c.ResolvedAt, c.ID)
+}
+
+// DecodeEscalationCursor parses a cursor produced by Encode
+func DecodeEscalationCursor(s string) (*EscalationCursor, error) {
+	t, id, err := decodeCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	return &EscalationCursor{ResolvedAt: t, ID: id}, nil
+}
+
+func encodeCursor(t time.Time, id uuid.UUID) string {
+	raw := t.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (time.Time, uuid.UUID, error) {
+	invalid := fmt.Errorf("invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	ts, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	return t, id, nil
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// Layers an effective agent setting can come from, lowest precedence first
+const (
+	ConfigSourceBuiltin      = "builtin"      // Vibber's default
+	ConfigSourceOrganization = "organization" // The organization's agent defaults
+	ConfigSourceAgent        = "agent"        // Set on the agent
+	ConfigSourceOverride     = "override"     // The agent's per-provider override
+	ConfigSourceIntegration  = "integration"  // Set on the provider integration
+)
+
+// Built-in agent settings used when neither the organization nor the agent
+// sets a value
+const (
+	DefaultConfidenceThreshold = 70
+	DefaultAutoMode            = false
+)
+
+// EffectiveValue is a resolved setting and the layer that set it
+type EffectiveValue struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// EffectiveProviderConfig is what applies to interactions from one provider
+type EffectiveProviderConfig struct {
+	Connected           bool           `json:"connected"`
+	ConfidenceThreshold EffectiveValue `json:"confidenceThreshold"`
+	Passive             EffectiveValue `json:"passive"`
+}
+
+// EffectiveAgentConfig is the configuration the processing pipeline runs an
+// agent with, merged from built-in defaults, organization defaults, the agent
+// and its integrations
+type EffectiveAgentConfig struct {
+	AgentID             uuid.UUID                           `json:"agentId"`
+	Status              EffectiveValue                      `json:"status"`
+	ConfidenceThreshold EffectiveValue                      `json:"confidenceThreshold"`
+	AutoMode            EffectiveValue                      `json:"autoMode"`
+	WorkingHours        EffectiveValue                      `json:"workingHours"`
+	AuditSampleRate     EffectiveValue                      `json:"auditSampleRate"`
+	Providers           map[string]*EffectiveProviderConfig `json:"providers"`
+}
+
+// ResolveAgentConfig merges the configuration layers for agent. Organization
+// defaults are copied onto agents when they are created, so a stored value is
+// attributed to the lowest layer that would have produced it: an agent value
+// equal to the organization default is reported as organization. orgPaused
+// overrides the agent's status.
+func ResolveAgentConfig(agent *Agent, defaults *AgentDefaults, integrations []*Integration, orgPaused bool) *EffectiveAgentConfig {
+	if defaults == nil {
+		defaults = &AgentDefaults{}
+	}
+
+	cfg := &EffectiveAgentConfig{
+		AgentID:   agent.ID,
+		Status:    EffectiveValue{Value: agent.Status, Source: ConfigSourceAgent},
+		Providers: map[string]*EffectiveProviderConfig{},
+	}
+	if orgPaused {
+		cfg.Status = EffectiveValue{Value: "paused", Source: ConfigSourceOrganization}
+	}
+
+	thresholdSource := ConfigSourceAgent
+	switch {
+	case defaults.ConfidenceThreshold != nil && *defaults.ConfidenceThreshold == agent.ConfidenceThreshold:
+		thresholdSource = ConfigSourceOrganization
+	case defaults.ConfidenceThreshold == nil && agent.ConfidenceThreshold == DefaultConfidenceThreshold:
+		thresholdSource = ConfigSourceBuiltin
+	}
+	cfg.ConfidenceThreshold = EffectiveValue{Value: agent.ConfidenceThreshold, Source: thresholdSource}
+
+	autoSource := ConfigSourceAgent
+	switch {
+	case defaults.AutoMode != nil && *defaults.AutoMode == agent.AutoMode:
+		autoSource = ConfigSourceOrganization
+	case defaults.AutoMode == nil && agent.AutoMode == DefaultAutoMode:
+		autoSource = ConfigSourceBuiltin
+	}
+	cfg.AutoMode = EffectiveValue{Value: agent.AutoMode, Source: autoSource}
+
+	cfg.WorkingHours = EffectiveValue{Value: nil, Source: ConfigSourceBuiltin}
+	if agent.WorkingHours != nil {
+		source := ConfigSourceAgent
+		if len(defaults.WorkingHours) > 0 && jsonEqual([]byte(*agent.WorkingHours), defaults.WorkingHours) {
+			source = ConfigSourceOrganization
+		}
+		cfg.WorkingHours = EffectiveValue{Value: json.RawMessage(*agent.WorkingHours), Source: source}
+	}
+
+	cfg.AuditSampleRate = EffectiveValue{Value: agent.AuditSampleRate, Source: ConfigSourceBuiltin}
+	if agent.AuditSampleRate != 0 {
+		cfg.AuditSampleRate.Source = ConfigSourceAgent
+	}
+
+	// Every provider the agent is connected to or has an override for
+	connected := map[string]*Integration{}
+	for _, integration := range integrations {
+		connected[integration.Provider] = integration
+	}
+	var providers []string
+	for provider := range connected {
+		providers = append(providers, provider)
+	}
+	for provider := range agent.ProviderThresholds {
+		if _, ok := connected[provider]; !ok {
+			providers = append(providers, provider)
+		}
+	}
+	sort.Strings(providers)
+
+	for _, provider := range providers {
+		pc := &EffectiveProviderConfig{
+			ConfidenceThreshold: cfg.ConfidenceThreshold,
+			Passive:             EffectiveValue{Value: false, Source: ConfigSourceBuiltin},
+		}
+		if threshold, ok := agent.ProviderThresholds[provider]; ok {
+			source := ConfigSourceOverride
+			if orgThreshold, ok := defaults.ProviderThresholds[provider]; ok && orgThreshold == threshold {
+				source = ConfigSourceOrganization
+			}
+			pc.ConfidenceThreshold = EffectiveValue{Value: threshold, Source: source}
+		}
+		if integration, ok := connected[provider]; ok {
+			pc.Connected = true
+			if integration.Passive {
+				pc.Passive = EffectiveValue{Value: true, Source: ConfigSourceIntegration}
+			}
+		}
+		cfg.Providers[provider] = pc
+	}
+
+	return cfg
+}
+
+// jsonEqual compares two JSON documents ignoring insignificant whitespace
+func jsonEqual(a, b []byte) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return false
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ProviderEndpoints are the OAuth and API URLs used to talk to a provider
+type ProviderEndpoints struct {
+	AuthorizeURL string `json:"authorizeUrl"`
+	TokenURL     string `json:"tokenUrl"`
+	APIBaseURL   string `json:"apiBaseUrl"`
+	IsCloud      bool   `json:"isCloud"`
+}
+
+// defaultEndpoints are the public cloud endpoints used when an organization
+// has not configured its own instance
+var defaultEndpoints = map[string]ProviderEndpoints{
+	"slack": {
+		AuthorizeURL: "https://slack.com/oauth/v2/authorize",
+		TokenURL:     "https://slack.com/api/oauth.v2.access",
+		APIBaseURL:   "https://slack.com/api",
+		IsCloud:      true,
+	},
+	"github": {
+		AuthorizeURL: "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		APIBaseURL:   "https://api.github.com",
+		IsCloud:      true,
+	},
+	"jira": {
+		AuthorizeURL: "https://auth.atlassian.com/authorize",
+		TokenURL:     "https://auth.atlassian.com/oauth/token",
+		APIBaseURL:   "https://api.atlassian.com",
+		IsCloud:      true,
+	},
+	"confluence": {
+		AuthorizeURL: "https://auth.atlassian.com/authorize",
+		TokenURL:     "https://auth.atlassian.com/oauth/token",
+		APIBaseURL:   "https://api.atlassian.com",
+		IsCloud:      true,
+	},
+}
+
+// ResolveProviderEndpoints returns the endpoints for a provider, pointing at
+// the organization's own instance when its credential config names one
+// (GitHub Enterprise Server, Jira/Confluence Data Center). config is the raw
+// OrganizationCredential.Config and may be nil.
+func ResolveProviderEndpoints(provider string, config *string) (ProviderEndpoints, error) {
+	endpoints, ok := defaultEndpoints[provider]
+	if !ok {
+		return ProviderEndpoints{}, fmt.Errorf("unsupported provider: %s", provider)
+	}
+	if config == nil || *config == "" {
+		return endpoints, nil
+	}
+
+	switch provider {
+	case "github":
+		var cfg GitHubCredentialConfig
+		if err := decodeProviderJSON(config, &cfg, false); err != nil {
+			return ProviderEndpoints{}, fmt.Errorf("invalid github config: %w", err)
+		}
+		if cfg.EnterpriseURL == "" {
+			return endpoints, nil
+		}
+		base, err := normalizeBaseURL(cfg.EnterpriseURL)
+		if err != nil {
+			return ProviderEndpoints{}, fmt.Errorf("invalid enterpriseUrl: %w", err)
+		}
+		return ProviderEndpoints{
+			AuthorizeURL: base + "/login/oauth/authorize",
+			TokenURL:     base + "/login/oauth/access_token",
+			APIBaseURL:   base + "/api/v3",
+		}, nil
+
+	case "jira", "confluence":
+		var cfg JiraCredentialConfig
+		if err := decodeProviderJSON(config, &cfg, false); err != nil {
+			return ProviderEndpoints{}, fmt.Errorf("invalid %s config: %w", provider, err)
+		}
+		// Atlassian Cloud sites still authorize through auth.atlassian.com
+		if cfg.SiteURL == "" || cfg.IsCloud {
+			return endpoints, nil
+		}
+		base, err := normalizeBaseURL(cfg.SiteURL)
+		if err != nil {
+			return ProviderEndpoints{}, fmt.Errorf("invalid siteUrl: %w", err)
+		}
+		apiPath := "/rest/api/2"
+		if provider == "confluence" {
+			apiPath = "/rest/api"
+		}
+		return ProviderEndpoints{
+			AuthorizeURL: base + "/rest/oauth2/latest/authorize",
+			TokenURL:     base + "/rest/oauth2/latest/token",
+			APIBaseURL:   base + apiPath,
+		}, nil
+	}
+
+	return endpoints, nil
+}
+
+// ValidateProviderConfig checks a credential config decodes into the
+// provider's config type without unknown fields, and that any instance URLs
+// are valid. Providers without a typed config (e.g. elastic) only need a JSON
+// object.
+func ValidateProviderConfig(provider string, config *string) error {
+	if err := decodeProviderJSON(config, credentialConfigFor(provider), true); err != nil {
+		return fmt.Errorf("invalid %s config: %w", provider, err)
+	}
+	if _, ok := defaultEndpoints[provider]; !ok {
+		return nil
+	}
+	_, err := ResolveProviderEndpoints(provider, config)
+	return err
+}
+
+// normalizeBaseURL checks a configured instance URL is an absolute https URL
+// and strips any trailing slash
+func normalizeBaseURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("must be an absolute https URL")
+	}
+	return strings.TrimRight(u.Scheme+"://"+u.Host+u.Path, "/"), nil
+}
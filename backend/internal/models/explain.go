@@ -0,0 +1,98 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Where an InteractionExplanation's reasoning came from
+const (
+	ExplanationSourceAIService = "ai_service" // Includes the AI service's own decision trace
+	ExplanationSourceStored    = "stored"     // Assembled from stored data only
+)
+
+// Names of the checks an explanation reports
+const (
+	DecisionCheckConfidence = "confidence_threshold"
+	DecisionCheckAutoMode   = "auto_mode"
+)
+
+// InteractionExplanation describes why an agent handled an interaction the
+// way it did. Thresholds and modes are the agent's current settings, which
+// may have changed since the interaction was processed.
+type InteractionExplanation struct {
+	InteractionID        uuid.UUID        `json:"interactionId"`
+	AgentID              uuid.UUID        `json:"agentId"`
+	Source               string           `json:"source"`
+	Status               string           `json:"status"`
+	Escalated            bool             `json:"escalated"`
+	ConfidenceScore      *int             `json:"confidenceScore"`
+	Threshold            int              `json:"threshold"`
+	ThresholdScope       string           `json:"thresholdScope"` // provider when a per-provider override applies, agent otherwise
+	ConsideredEscalation bool             `json:"consideredEscalation"`
+	Checks               []DecisionCheck  `json:"checks"`
+	Reasoning            *string          `json:"reasoning"`
+	MatchedSamples       []*MatchedSample `json:"matchedSamples"`
+	GeneratedAt          time.Time        `json:"generatedAt"`
+}
+
+// DecisionCheck is one rule evaluated in deciding an interaction
+type DecisionCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// MatchedSample is a training sample the agent drew on for an interaction
+type MatchedSample struct {
+	*TrainingSample
+	Similarity *float64 `json:"similarity"`
+}
+
+// ExplainInteraction assembles the parts of an explanation that follow from
+// stored data: the confidence against the applicable threshold and the
+// agent's mode
+func ExplainInteraction(interaction *Interaction, agent *Agent, now time.Time) *InteractionExplanation {
+	explanation := &InteractionExplanation{
+		InteractionID:   interaction.ID,
+		AgentID:         agent.ID,
+		Source:          ExplanationSourceStored,
+		Status:          interaction.Status,
+		Escalated:       interaction.Escalated,
+		ConfidenceScore: interaction.ConfidenceScore,
+		Threshold:       agent.ThresholdFor(interaction.Provider),
+		ThresholdScope:  "agent",
+		MatchedSamples:  []*MatchedSample{},
+		GeneratedAt:     now,
+	}
+	if _, ok := agent.ProviderThresholds[interaction.Provider]; ok {
+		explanation.ThresholdScope = "provider"
+	}
+
+	confidence := DecisionCheck{Name: DecisionCheckConfidence}
+	if interaction.ConfidenceScore == nil {
+		confidence.Detail = "No confidence was recorded"
+	} else {
+		confidence.Passed = *interaction.ConfidenceScore >= explanation.Threshold
+		comparison := "below"
+		if confidence.Passed {
+			comparison = "at or above"
+		}
+		confidence.Detail = fmt.Sprintf("Confidence %d%% is %s the %s threshold of %d%%",
+			*interaction.ConfidenceScore, comparison, explanation.ThresholdScope, explanation.Threshold)
+	}
+
+	autoMode := DecisionCheck{Name: DecisionCheckAutoMode, Passed: agent.AutoMode}
+	if agent.AutoMode {
+		autoMode.Detail = "The agent acts on its own when confident"
+	} else {
+		autoMode.Detail = "The agent proposes actions for approval"
+	}
+
+	explanation.Checks = []DecisionCheck{confidence, autoMode}
+	explanation.ConsideredEscalation = interaction.Escalated ||
+		(interaction.ConfidenceScore != nil && !confidence.Passed)
+	return explanation
+}
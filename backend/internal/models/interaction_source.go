@@ -0,0 +1,97 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// InteractionSource describes where an interaction came from in terms a
+// reviewer recognizes: the workspace and the channel, repository or issue
+type InteractionSource struct {
+	IntegrationID *uuid.UUID `json:"integrationId"`
+	Provider      string     `json:"provider"`
+	Workspace     string     `json:"workspace,omitempty"` // Slack team, GitHub account or Atlassian site
+	Location      string     `json:"location,omitempty"`  // #channel, owner/repo#42 or PROJ-123
+	Label         string     `json:"label"`               // e.g. "#C0123 in Acme", "acme/api#42"
+	Deleted       bool       `json:"deleted"`             // The integration has since been removed
+}
+
+// DeletedInteractionSource is the placeholder for interactions whose
+// integration no longer exists
+func DeletedInteractionSource(provider string) *InteractionSource {
+	return &InteractionSource{
+		Provider: provider,
+		Label:    fmt.Sprintf("Deleted %s integration", provider),
+		Deleted:  true,
+	}
+}
+
+// ResolveInteractionSource combines the integration's workspace metadata with
+// the channel, repository or issue named in the interaction's input. Missing
+// or malformed data leaves the matching part empty rather than failing.
+func ResolveInteractionSource(interaction *Interaction, integration *Integration) *InteractionSource {
+	source := &InteractionSource{
+		IntegrationID: &integration.ID,
+		Provider:      integration.Provider,
+	}
+
+	var input map[string]interface{}
+	json.Unmarshal([]byte(interaction.InputData), &input)
+
+	switch integration.Provider {
+	case "slack":
+		if meta, err := integration.SlackMetadata(); err == nil {
+			source.Workspace = meta.TeamName
+			if source.Workspace == "" {
+				source.Workspace = meta.TeamID
+			}
+		}
+		if channel := stringField(input, "channel"); channel != "" {
+			source.Location = "#" + channel
+		}
+	case "github":
+		if meta, err := integration.GitHubMetadata(); err == nil {
+			source.Workspace = meta.Login
+		}
+		repo := stringField(objectField(input, "repository"), "full_name")
+		number := objectField(input, "pull_request")["number"]
+		if number == nil {
+			number = objectField(input, "issue")["number"]
+		}
+		switch n, ok := number.(float64); {
+		case repo != "" && ok:
+			source.Location = fmt.Sprintf("%s#%d", repo, int64(n))
+		case repo != "":
+			source.Location = repo
+		}
+	case "jira", "confluence":
+		if meta, err := integration.AtlassianMetadata(); err == nil {
+			source.Workspace = meta.SiteURL
+		}
+		source.Location = stringField(objectField(input, "issue"), "key")
+	}
+
+	switch {
+	case source.Location != "" && source.Workspace != "":
+		source.Label = source.Location + " in " + source.Workspace
+	case source.Location != "":
+		source.Label = source.Location
+	case source.Workspace != "":
+		source.Label = source.Workspace
+	default:
+		source.Label = integration.Provider
+	}
+	return source
+}
+
+func objectField(m map[string]interface{}, key string) map[string]interface{} {
+	v, _ := m[key].(map[string]interface{})
+	return v
+}
+
+func stringField(m map[string]interface{}, key string) string {
+	v, _ := m[key].(string)
+	return v
+}
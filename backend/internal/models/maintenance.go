@@ -0,0 +1,169 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Maintenance window recurrences
+const (
+	RecurrenceNone   = "none"
+	RecurrenceDaily  = "daily"
+	RecurrenceWeekly = "weekly"
+)
+
+// What happens to events deferred by a maintenance window once it ends
+const (
+	MaintenanceRelease = "release" // Queue them for processing
+	MaintenanceDrop    = "drop"    // Record them as skipped
+)
+
+// MaintenanceSkipReason is recorded on deferred events dropped when their
+// window ended
+const MaintenanceSkipReason = "maintenance"
+
+// MaintenanceWindow is a period during which webhook events for an agent, or
+// for every agent in the organization, are deferred instead of processed.
+// Recurring windows repeat at the same wall-clock time in Timezone.
+type MaintenanceWindow struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	OrgID      uuid.UUID  `json:"orgId" db:"org_id"`
+	AgentID    *uuid.UUID `json:"agentId" db:"agent_id"` // Nil applies to every agent in the organization
+	Name       string     `json:"name" db:"name"`
+	StartsAt   time.Time  `json:"startsAt" db:"starts_at"` // First occurrence
+	EndsAt     time.Time  `json:"endsAt" db:"ends_at"`
+	Timezone   string     `json:"timezone" db:"timezone"`
+	Recurrence string     `json:"recurrence" db:"recurrence"` // none, daily or weekly
+	OnEnd      string     `json:"onEnd" db:"on_end"`          // release or drop
+	CreatedBy  *uuid.UUID `json:"createdBy" db:"created_by"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// Occurrence returns the occurrence of the window in progress at now, if any
+func (w *MaintenanceWindow) Occurrence(now time.Time) (start, end time.Time, ok bool) {
+	length := w.EndsAt.Sub(w.StartsAt)
+	if w.Recurrence == RecurrenceNone || w.Recurrence == "" {
+		return w.StartsAt, w.EndsAt, !now.Before(w.StartsAt) && now.Before(w.EndsAt)
+	}
+
+	days := 1
+	if w.Recurrence == RecurrenceWeekly {
+		days = 7
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	// Occurrences keep their wall-clock start across DST changes, so the
+	// estimate can be off by one either way
+	first := w.StartsAt.In(loc)
+	k := int(now.Sub(first) / (time.Duration(days) * 24 * time.Hour))
+	for _, n := range []int{k - 1, k, k + 1} {
+		if n < 0 {
+			continue
+		}
+		start = first.AddDate(0, 0, n*days)
+		end = start.Add(length)
+		if !now.Before(start) && now.Before(end) {
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// ActiveAt reports whether the window is in progress at now
+func (w *MaintenanceWindow) ActiveAt(now time.Time) bool {
+	_, _, ok := w.Occurrence(now)
+	return ok
+}
+
+// ActiveMaintenance is a maintenance window occurrence in progress
+type ActiveMaintenance struct {
+	Window   *MaintenanceWindow `json:"window"`
+	StartsAt time.Time          `json:"startsAt"`
+	EndsAt   time.Time          `json:"endsAt"`
+}
+
+// ActiveMaintenanceWindow returns the window in progress at now that ends
+// last, or nil when none is
+func ActiveMaintenanceWindow(windows []*MaintenanceWindow, now time.Time) *ActiveMaintenance {
+	var active *ActiveMaintenance
+	for _, w := range windows {
+		start, end, ok := w.Occurrence(now)
+		if ok && (active == nil || end.After(active.EndsAt)) {
+			active = &ActiveMaintenance{Window: w, StartsAt: start, EndsAt: end}
+		}
+	}
+	return active
+}
+
+// MaintenanceWindowRequest creates or replaces a maintenance window
+type MaintenanceWindowRequest struct {
+	AgentID    *uuid.UUID `json:"agentId"`
+	Name       string     `json:"name"`
+	StartsAt   time.Time  `json:"startsAt"`
+	EndsAt     time.Time  `json:"endsAt"`
+	Timezone   string     `json:"timezone"`
+	Recurrence string     `json:"recurrence"`
+	OnEnd      string     `json:"onEnd"`
+}
+
+// Validate checks the window and fills in defaults: UTC, no recurrence and
+// releasing deferred events
+func (r *MaintenanceWindowRequest) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > 255 {
+		return fmt.Errorf("name must be between 1 and 255 characters")
+	}
+	if r.StartsAt.IsZero() || !r.EndsAt.After(r.StartsAt) {
+		return fmt.Errorf("endsAt must be after startsAt")
+	}
+
+	if r.Timezone == "" {
+		r.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		return fmt.Errorf("timezone must be an IANA time zone")
+	}
+
+	length := r.EndsAt.Sub(r.StartsAt)
+	switch r.Recurrence {
+	case "":
+		r.Recurrence = RecurrenceNone
+	case RecurrenceNone:
+	case RecurrenceDaily:
+		if length >= 24*time.Hour {
+			return fmt.Errorf("a daily window must be shorter than a day")
+		}
+	case RecurrenceWeekly:
+		if length >= 7*24*time.Hour {
+			return fmt.Errorf("a weekly window must be shorter than a week")
+		}
+	default:
+		return fmt.Errorf("recurrence must be none, daily or weekly")
+	}
+
+	switch r.OnEnd {
+	case "":
+		r.OnEnd = MaintenanceRelease
+	case MaintenanceRelease, MaintenanceDrop:
+	default:
+		return fmt.Errorf("onEnd must be release or drop")
+	}
+	return nil
+}
+
+// Apply copies the request onto w
+func (r *MaintenanceWindowRequest) Apply(w *MaintenanceWindow) {
+	w.AgentID = r.AgentID
+	w.Name = r.Name
+	w.StartsAt = r.StartsAt
+	w.EndsAt = r.EndsAt
+	w.Timezone = r.Timezone
+	w.Recurrence = r.Recurrence
+	w.OnEnd = r.OnEnd
+}
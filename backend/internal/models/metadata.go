@@ -0,0 +1,276 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SlackMeta is the provider data stored on a Slack integration
+type SlackMeta struct {
+	TeamID    string `json:"teamId"`
+	TeamName  string `json:"teamName,omitempty"`
+	BotUserID string `json:"botUserId,omitempty"`
+	AppID     string `json:"appId,omitempty"`
+
+	// AllowedChannels are the channels the bot is a member of and may act in,
+	// kept current from channel lifecycle events. Nil means channels are not
+	// tracked yet and every channel is allowed.
+	AllowedChannels []string `json:"allowedChannels"`
+}
+
+// ChannelAllowed reports whether the agent may act in channel
+func (m *SlackMeta) ChannelAllowed(channel string) bool {
+	if m.AllowedChannels == nil {
+		return true
+	}
+	for _, c := range m.AllowedChannels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinChannel allows channel, reporting whether the list changed
+func (m *SlackMeta) JoinChannel(channel string) bool {
+	for _, c := range m.AllowedChannels {
+		if c == channel {
+			return false
+		}
+	}
+	m.AllowedChannels = append(m.AllowedChannels, channel)
+	return true
+}
+
+// LeaveChannel disallows channel, reporting whether anything changed. Leaving
+// a channel while channels are untracked starts tracking with an empty list.
+func (m *SlackMeta) LeaveChannel(channel string) bool {
+	if m.AllowedChannels == nil {
+		m.AllowedChannels = []string{}
+		return true
+	}
+	for i, c := range m.AllowedChannels {
+		if c == channel {
+			m.AllowedChannels = append(m.AllowedChannels[:i], m.AllowedChannels[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// GitHubMeta is the provider data stored on a GitHub integration
+type GitHubMeta struct {
+	Login          string `json:"login"`
+	InstallationID int64  `json:"installationId,omitempty"`
+	AccountType    string `json:"accountType,omitempty"` // User, Organization
+	BotLogin       string `json:"botLogin,omitempty"`    // Login the agent's GitHub App acts as, e.g. vibber[bot]
+}
+
+// AtlassianMeta is the provider data stored on a Jira or Confluence integration
+type AtlassianMeta struct {
+	CloudID string `json:"cloudId,omitempty"` // Empty for Data Center
+	SiteURL string `json:"siteUrl"`
+}
+
+// SlackMetadata decodes the integration's metadata. It returns an empty
+// SlackMeta when no metadata is stored.
+func (i *Integration) SlackMetadata() (*SlackMeta, error) {
+	meta := &SlackMeta{}
+	if err := i.decodeMetadata("slack", meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// GitHubMetadata decodes the integration's metadata. It returns an empty
+// GitHubMeta when no metadata is stored.
+func (i *Integration) GitHubMetadata() (*GitHubMeta, error) {
+	meta := &GitHubMeta{}
+	if err := i.decodeMetadata("github", meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// IsOwnEvent reports whether an event was sent by the integration's own bot
+// user, i.e. it is the agent's own reply. For Slack, payload is the inner
+// event. Integrations without a known bot identity match nothing.
+func (i *Integration) IsOwnEvent(payload map[string]interface{}) bool {
+	switch i.Provider {
+	case "slack":
+		meta, err := i.SlackMetadata()
+		if err != nil {
+			return false
+		}
+		if user, _ := payload["user"].(string); meta.BotUserID != "" && user == meta.BotUserID {
+			return true
+		}
+		appID, _ := payload["app_id"].(string)
+		if profile, ok := payload["bot_profile"].(map[string]interface{}); ok && appID == "" {
+			appID, _ = profile["app_id"].(string)
+		}
+		return meta.AppID != "" && appID == meta.AppID
+	case "github":
+		meta, err := i.GitHubMetadata()
+		if err != nil {
+			return false
+		}
+		sender, _ := payload["sender"].(map[string]interface{})
+		login, _ := sender["login"].(string)
+		return meta.BotLogin != "" && strings.EqualFold(login, meta.BotLogin)
+	}
+	return false
+}
+
+// InWorkspace reports whether the integration is connected to an external
+// workspace, matching it as IntegrationRepository.ListByExternalID does
+func (i *Integration) InWorkspace(workspace string) bool {
+	if i.ExternalID != nil && *i.ExternalID == workspace {
+		return true
+	}
+	switch i.Provider {
+	case "slack":
+		meta, err := i.SlackMetadata()
+		return err == nil && meta.TeamID != "" && meta.TeamID == workspace
+	case "jira", "confluence":
+		meta, err := i.AtlassianMetadata()
+		return err == nil && workspace != "" &&
+			(meta.CloudID == workspace || strings.TrimRight(meta.SiteURL, "/") == workspace)
+	}
+	return false
+}
+
+// AtlassianMetadata decodes a Jira or Confluence integration's metadata. It
+// returns an empty AtlassianMeta when no metadata is stored.
+func (i *Integration) AtlassianMetadata() (*AtlassianMeta, error) {
+	if i.Provider != "jira" && i.Provider != "confluence" {
+		return nil, fmt.Errorf("%s integration has no atlassian metadata", i.Provider)
+	}
+	meta := &AtlassianMeta{}
+	if err := decodeProviderJSON(i.Metadata, meta, false); err != nil {
+		return nil, fmt.Errorf("invalid %s metadata: %w", i.Provider, err)
+	}
+	return meta, nil
+}
+
+// SetMetadata stores meta as the integration's metadata JSON
+func (i *Integration) SetMetadata(meta interface{}) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	metadata := string(data)
+	i.Metadata = &metadata
+	return nil
+}
+
+func (i *Integration) decodeMetadata(provider string, v interface{}) error {
+	if i.Provider != provider {
+		return fmt.Errorf("%s integration has no %s metadata", i.Provider, provider)
+	}
+	if err := decodeProviderJSON(i.Metadata, v, false); err != nil {
+		return fmt.Errorf("invalid %s metadata: %w", provider, err)
+	}
+	return nil
+}
+
+// SlackConfig decodes the credential's config. It returns an empty config
+// when none is stored.
+func (c *OrganizationCredential) SlackConfig() (*SlackCredentialConfig, error) {
+	cfg := &SlackCredentialConfig{}
+	if err := c.decodeConfig("slack", cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// GitHubConfig decodes the credential's config. It returns an empty config
+// when none is stored.
+func (c *OrganizationCredential) GitHubConfig() (*GitHubCredentialConfig, error) {
+	cfg := &GitHubCredentialConfig{}
+	if err := c.decodeConfig("github", cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// JiraConfig decodes the credential's config. Confluence credentials share
+// the Jira shape. It returns an empty config when none is stored.
+func (c *OrganizationCredential) JiraConfig() (*JiraCredentialConfig, error) {
+	if c.Provider != "jira" && c.Provider != "confluence" {
+		return nil, fmt.Errorf("%s credential has no jira config", c.Provider)
+	}
+	cfg := &JiraCredentialConfig{}
+	if err := decodeProviderJSON(c.Config, cfg, false); err != nil {
+		return nil, fmt.Errorf("invalid %s config: %w", c.Provider, err)
+	}
+	return cfg, nil
+}
+
+func (c *OrganizationCredential) decodeConfig(provider string, v interface{}) error {
+	if c.Provider != provider {
+		return fmt.Errorf("%s credential has no %s config", c.Provider, provider)
+	}
+	if err := decodeProviderJSON(c.Config, v, false); err != nil {
+		return fmt.Errorf("invalid %s config: %w", provider, err)
+	}
+	return nil
+}
+
+// ValidateIntegrationMetadata checks that metadata decodes into the
+// provider's metadata type without unknown fields. Providers without a typed
+// shape only need a JSON object.
+func ValidateIntegrationMetadata(provider string, metadata *string) error {
+	var v interface{}
+	switch provider {
+	case "slack":
+		v = &SlackMeta{}
+	case "github":
+		v = &GitHubMeta{}
+	case "jira", "confluence":
+		v = &AtlassianMeta{}
+	default:
+		v = &map[string]interface{}{}
+	}
+	if err := decodeProviderJSON(metadata, v, true); err != nil {
+		return fmt.Errorf("invalid %s metadata: %w", provider, err)
+	}
+	return nil
+}
+
+// credentialConfigFor returns an empty typed config for provider, or a
+// generic object for providers without one
+func credentialConfigFor(provider string) interface{} {
+	switch provider {
+	case "slack":
+		return &SlackCredentialConfig{}
+	case "github":
+		return &GitHubCredentialConfig{}
+	case "jira", "confluence":
+		return &JiraCredentialConfig{}
+	default:
+		return &map[string]interface{}{}
+	}
+}
+
+// decodeProviderJSON unmarshals a stored JSON object into v. A nil or empty
+// raw value leaves v untouched. strict rejects fields v does not declare,
+// which catches misspelled keys when config is written.
+func decodeProviderJSON(raw *string, v interface{}, strict bool) error {
+	if raw == nil || *raw == "" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(*raw)))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after JSON object")
+	}
+	return nil
+}
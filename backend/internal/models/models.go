@@ -1,19 +1,303 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// UseUTC makes UTC the process's local time zone. Times from time.Now() and
+// those scanned from Postgres are in the local zone, so with it every
+// timestamp the API returns is RFC3339 with Z. It is called once at startup.
+func UseUTC() {
+	time.Local = time.UTC
+}
+
 // Organization represents a company/team using Vibber
 type Organization struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	Slug      string    `json:"slug" db:"slug"`
-	Plan      string    `json:"plan" db:"plan"`
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	ID        uuid.UUID            `json:"id" db:"id"`
+	Name      string               `json:"name" db:"name"`
+	Slug      string               `json:"slug" db:"slug"`
+	Plan      string               `json:"plan" db:"plan"`
+	Settings  OrganizationSettings `json:"settings" db:"settings"`
+	CreatedBy *uuid.UUID           `json:"createdBy" db:"created_by"`
+	UpdatedBy *uuid.UUID           `json:"updatedBy" db:"updated_by"` // Last user to change the organization or its policies
+	CreatedAt time.Time            `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time            `json:"updatedAt" db:"updated_at"`
+}
+
+// RetentionPolicy controls how long an organization's interactions and
+// resolved escalations are kept
+type RetentionPolicy struct {
+	Plan            string `json:"plan"`
+	RetentionDays   *int   `json:"retentionDays"` // Override; nil uses the plan default
+	PlanDefaultDays int    `json:"planDefaultDays"`
+	EffectiveDays   int    `json:"effectiveDays"`
+	LegalHold       bool   `json:"legalHold"`
+}
+
+type UpdateRetentionRequest struct {
+	RetentionDays *int  `json:"retentionDays"`
+	LegalHold     *bool `json:"legalHold"`
+}
+
+// PurgeResult counts rows removed by a retention purge
+type PurgeResult struct {
+	Interactions int64 `json:"interactions"`
+	Escalations  int64 `json:"escalations"`
+}
+
+// OrphanCounts counts rows whose agent, interaction or integration no
+// longer exists, by table
+type OrphanCounts struct {
+	Integrations       int64 `json:"integrations"`
+	SharedIntegrations int64 `json:"sharedIntegrations"`
+	Interactions       int64 `json:"interactions"`
+	Escalations        int64 `json:"escalations"`
+	Replays            int64 `json:"replays"`
+	TrainingSamples    int64 `json:"trainingSamples"`
+	KnowledgeBase      int64 `json:"knowledgeBase"`
+	RoutingRules       int64 `json:"routingRules"`
+	PriorityRules      int64 `json:"priorityRules"`
+	MaintenanceWindows int64 `json:"maintenanceWindows"`
+}
+
+// Total is the number of orphaned rows across every table
+func (c *OrphanCounts) Total() int64 {
+	return c.Integrations + c.SharedIntegrations + c.Interactions + c.Escalations +
+		c.Replays + c.TrainingSamples + c.KnowledgeBase + c.RoutingRules + c.PriorityRules +
+		c.MaintenanceWindows
+}
+
+// AgentDefaults is an organization's template for new agents. Nil fields
+// fall back to the built-in defaults.
+type AgentDefaults struct {
+	ConfidenceThreshold *int            `json:"confidenceThreshold"`
+	ProviderThresholds  map[string]int  `json:"providerThresholds"` // Escalation thresholds per provider
+	AutoMode            *bool           `json:"autoMode"`
+	WorkingHours        json.RawMessage `json:"workingHours,omitempty"`
+}
+
+// ValidateThresholds checks a confidence threshold (when set) and every
+// per-provider override are between 0 and 100
+func ValidateThresholds(threshold *int, providerThresholds map[string]int) error {
+	if threshold != nil && (*threshold < 0 || *threshold > 100) {
+		return fmt.Errorf("confidenceThreshold must be between 0 and 100")
+	}
+	for provider, t := range providerThresholds {
+		if t < 0 || t > 100 {
+			return fmt.Errorf("providerThresholds.%s must be between 0 and 100", provider)
+		}
+	}
+	return nil
+}
+
+// Validate checks thresholds are percentages and working hours are JSON
+func (d *AgentDefaults) Validate() error {
+	if err := ValidateThresholds(d.ConfidenceThreshold, d.ProviderThresholds); err != nil {
+		return err
+	}
+	if len(d.WorkingHours) > 0 && !json.Valid(d.WorkingHours) {
+		return fmt.Errorf("workingHours must be valid JSON")
+	}
+	return nil
+}
+
+// NewAgent builds an agent from a create request, filling omitted fields
+// from the defaults and then from the built-in defaults (threshold 70,
+// auto mode off)
+func (d *AgentDefaults) NewAgent(userID uuid.UUID, req *CreateAgentRequest) *Agent {
+	agent := &Agent{
+		ID:                  uuid.New(),
+		UserID:              userID,
+		Name:                req.Name,
+		Status:              "training",
+		ConfidenceThreshold: DefaultConfidenceThreshold,
+		ProviderThresholds:  map[string]int{},
+	}
+	if req.Description != "" {
+		agent.Description = &req.Description
+	}
+
+	switch {
+	case req.ConfidenceThreshold != nil:
+		agent.ConfidenceThreshold = *req.ConfidenceThreshold
+	case d.ConfidenceThreshold != nil:
+		agent.ConfidenceThreshold = *d.ConfidenceThreshold
+	}
+
+	switch {
+	case req.ProviderThresholds != nil:
+		agent.ProviderThresholds = req.ProviderThresholds
+	case d.ProviderThresholds != nil:
+		for provider, threshold := range d.ProviderThresholds {
+			agent.ProviderThresholds[provider] = threshold
+		}
+	}
+
+	switch {
+	case req.AutoMode != nil:
+		agent.AutoMode = *req.AutoMode
+	case d.AutoMode != nil:
+		agent.AutoMode = *d.AutoMode
+	}
+
+	switch {
+	case req.WorkingHours != nil:
+		agent.WorkingHours = req.WorkingHours
+	case len(d.WorkingHours) > 0 && string(d.WorkingHours) != "null":
+		hours := string(d.WorkingHours)
+		agent.WorkingHours = &hours
+	}
+
+	return agent
+}
+
+// AgentSettingsPatch is a partial settings update applied to many agents.
+// Omitted fields are left unchanged; providerThresholds are merged into each
+// agent's overrides.
+type AgentSettingsPatch struct {
+	ConfidenceThreshold *int           `json:"confidenceThreshold"`
+	ProviderThresholds  map[string]int `json:"providerThresholds"`
+	AutoMode            *bool          `json:"autoMode"`
+	WorkingHours        *string        `json:"workingHours"`
+	AuditSampleRate     *float64       `json:"auditSampleRate"`
+}
+
+// Validate checks the patch changes something and every value is in range
+func (p *AgentSettingsPatch) Validate() error {
+	if p.ConfidenceThreshold == nil && len(p.ProviderThresholds) == 0 && p.AutoMode == nil && p.WorkingHours == nil && p.AuditSampleRate == nil {
+		return fmt.Errorf("settings must change at least one field")
+	}
+	if err := ValidateThresholds(p.ConfidenceThreshold, p.ProviderThresholds); err != nil {
+		return err
+	}
+	if p.WorkingHours != nil && *p.WorkingHours != "" && !json.Valid([]byte(*p.WorkingHours)) {
+		return fmt.Errorf("workingHours must be valid JSON")
+	}
+	if p.AuditSampleRate != nil && (*p.AuditSampleRate < 0 || *p.AuditSampleRate > 1) {
+		return fmt.Errorf("auditSampleRate must be a number between 0 and 1")
+	}
+	return nil
+}
+
+// Apply writes the patch onto agent. An empty workingHours clears them.
+func (p *AgentSettingsPatch) Apply(agent *Agent) {
+	if p.ConfidenceThreshold != nil {
+		agent.ConfidenceThreshold = *p.ConfidenceThreshold
+	}
+	if len(p.ProviderThresholds) > 0 {
+		thresholds := make(map[string]int, len(agent.ProviderThresholds)+len(p.ProviderThresholds))
+		for provider, threshold := range agent.ProviderThresholds {
+			thresholds[provider] = threshold
+		}
+		for provider, threshold := range p.ProviderThresholds {
+			thresholds[provider] = threshold
+		}
+		agent.ProviderThresholds = thresholds
+	}
+	if p.AutoMode != nil {
+		agent.AutoMode = *p.AutoMode
+	}
+	if p.WorkingHours != nil {
+		if *p.WorkingHours == "" {
+			agent.WorkingHours = nil
+		} else {
+			hours := *p.WorkingHours
+			agent.WorkingHours = &hours
+		}
+	}
+	if p.AuditSampleRate != nil {
+		agent.AuditSampleRate = *p.AuditSampleRate
+	}
+}
+
+// AgentSelector picks the agents a bulk change applies to. Empty fields
+// match every agent.
+type AgentSelector struct {
+	AgentIDs []uuid.UUID `json:"agentIds"`
+	Status   string      `json:"status"`
+}
+
+// BulkAgentSettingsRequest applies settings to the organization's agents
+// matched by filter
+type BulkAgentSettingsRequest struct {
+	Filter   AgentSelector      `json:"filter"`
+	Settings AgentSettingsPatch `json:"settings"`
+}
+
+// BulkAgentFailure is an agent a bulk change could not be applied to
+type BulkAgentFailure struct {
+	AgentID uuid.UUID `json:"agentId"`
+	Error   string    `json:"error"`
+}
+
+// BulkAgentSettingsResult reports the outcome of a bulk settings update
+type BulkAgentSettingsResult struct {
+	Updated  int                `json:"updated"`
+	AgentIDs []uuid.UUID        `json:"agentIds"`
+	Failures []BulkAgentFailure `json:"failures"`
+}
+
+// SelectAgents returns the agents matching the selector. Requested agent IDs
+// that are not among agents are reported as failures.
+func (s *AgentSelector) SelectAgents(agents []*Agent) ([]*Agent, []BulkAgentFailure) {
+	byID := make(map[uuid.UUID]*Agent, len(agents))
+	for _, agent := range agents {
+		byID[agent.ID] = agent
+	}
+
+	candidates := agents
+	failures := []BulkAgentFailure{}
+	if len(s.AgentIDs) > 0 {
+		candidates = nil
+		seen := map[uuid.UUID]bool{}
+		for _, id := range s.AgentIDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			agent, ok := byID[id]
+			if !ok {
+				failures = append(failures, BulkAgentFailure{AgentID: id, Error: "Agent not found in organization"})
+				continue
+			}
+			candidates = append(candidates, agent)
+		}
+	}
+
+	var selected []*Agent
+	for _, agent := range candidates {
+		if s.Status == "" || agent.Status == s.Status {
+			selected = append(selected, agent)
+		}
+	}
+	return selected, failures
+}
+
+// AgentPauseResult reports the agents changed by an organization-wide pause
+// or resume
+type AgentPauseResult struct {
+	Paused   bool        `json:"paused"`
+	AgentIDs []uuid.UUID `json:"agentIds"`
+}
+
+// AuditLog records an administrative action
+type AuditLog struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	OrgID        *uuid.UUID `json:"orgId" db:"org_id"`
+	UserID       *uuid.UUID `json:"userId" db:"user_id"`
+	AgentID      *uuid.UUID `json:"agentId" db:"agent_id"`
+	Action       string     `json:"action" db:"action"`
+	ResourceType *string    `json:"resourceType" db:"resource_type"`
+	ResourceID   *uuid.UUID `json:"resourceId" db:"resource_id"`
+	OldValue     *string    `json:"oldValue" db:"old_value"` // JSON
+	NewValue     *string    `json:"newValue" db:"new_value"` // JSON
+	IPAddress    *string    `json:"ipAddress" db:"ip_address"`
+	UserAgent    *string    `json:"userAgent" db:"user_agent"`
+	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`
 }
 
 // User represents a user in the system
@@ -30,46 +314,83 @@ type User struct {
 	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`
 	UpdatedAt    time.Time  `json:"updatedAt" db:"updated_at"`
 	LastLoginAt  *time.Time `json:"lastLoginAt" db:"last_login_at"`
+	TokenEpoch   int        `json:"-" db:"token_epoch"` // Refresh tokens from earlier epochs are rejected
+}
+
+// Membership links a user to an organization with a per-organization role
+type Membership struct {
+	UserID    uuid.UUID `json:"userId" db:"user_id"`
+	OrgID     uuid.UUID `json:"orgId" db:"org_id"`
+	OrgName   string    `json:"orgName" db:"org_name"`
+	OrgSlug   string    `json:"orgSlug" db:"org_slug"`
+	Role      string    `json:"role" db:"role"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
 }
 
 // Agent represents an AI clone of a user
 type Agent struct {
-	ID                  uuid.UUID `json:"id" db:"id"`
-	UserID              uuid.UUID `json:"userId" db:"user_id"`
-	Name                string    `json:"name" db:"name"`
-	Description         *string   `json:"description" db:"description"`
-	AvatarURL           *string   `json:"avatarUrl" db:"avatar_url"`
-	Status              string    `json:"status" db:"status"` // training, active, paused, error
-	ConfidenceThreshold int       `json:"confidenceThreshold" db:"confidence_threshold"`
-	AutoMode            bool      `json:"autoMode" db:"auto_mode"`
-	WorkingHours        *string   `json:"workingHours" db:"working_hours"` // JSON string
-	CreatedAt           time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt           time.Time `json:"updatedAt" db:"updated_at"`
+	ID                  uuid.UUID      `json:"id" db:"id"`
+	UserID              uuid.UUID      `json:"userId" db:"user_id"`
+	OrgID               uuid.UUID      `json:"orgId" db:"org_id"` // Organization the agent was created in
+	Name                string         `json:"name" db:"name"`
+	Description         *string        `json:"description" db:"description"`
+	AvatarURL           *string        `json:"avatarUrl" db:"avatar_url"`
+	Status              string         `json:"status" db:"status"` // training, active, paused, error
+	ConfidenceThreshold int            `json:"confidenceThreshold" db:"confidence_threshold"`
+	ProviderThresholds  map[string]int `json:"providerThresholds" db:"provider_thresholds"` // Per-provider overrides of ConfidenceThreshold
+	AutoMode            bool           `json:"autoMode" db:"auto_mode"`
+	WorkingHours        *string        `json:"workingHours" db:"working_hours"`        // JSON string
+	AuditSampleRate     float64        `json:"auditSampleRate" db:"audit_sample_rate"` // Fraction (0-1) of autonomous interactions escalated for audit
+	Model               *string        `json:"model" db:"model"`                       // AI model, nil for the AI service's default
+	CreatedBy           *uuid.UUID     `json:"createdBy" db:"created_by"`
+	UpdatedBy           *uuid.UUID     `json:"updatedBy" db:"updated_by"` // Last user to change the agent or its settings
+	CreatedAt           time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt           time.Time      `json:"updatedAt" db:"updated_at"`
+}
+
+// SampledForAudit reports whether an autonomously completed interaction
+// should be queued for audit review, given roll drawn uniformly from [0, 1)
+func (a *Agent) SampledForAudit(roll float64) bool {
+	return roll < a.AuditSampleRate
+}
+
+// ThresholdFor returns the confidence threshold that applies to a provider
+func (a *Agent) ThresholdFor(provider string) int {
+	if threshold, ok := a.ProviderThresholds[provider]; ok {
+		return threshold
+	}
+	return a.ConfidenceThreshold
 }
 
 // AgentStatus represents the current status of an agent
 type AgentStatus struct {
-	Status             string    `json:"status"`
-	IsActive           bool      `json:"isActive"`
-	LastActivity       time.Time `json:"lastActivity"`
-	TodayInteractions  int       `json:"todayInteractions"`
-	PendingEscalations int       `json:"pendingEscalations"`
-	ConfidenceScore    float64   `json:"confidenceScore"`
+	Status             string             `json:"status"`
+	IsActive           bool               `json:"isActive"`
+	LastActivity       time.Time          `json:"lastActivity"`
+	TodayInteractions  int                `json:"todayInteractions"`
+	PendingEscalations int                `json:"pendingEscalations"`
+	ConfidenceScore    float64            `json:"confidenceScore"`
+	InMaintenance      bool               `json:"inMaintenance"` // Webhook events are being deferred
+	Maintenance        *ActiveMaintenance `json:"maintenance,omitempty"`
 }
 
 // Integration represents a connected service
+
 type Integration struct {
-	ID           uuid.UUID  `json:"id" db:"id"`
-	AgentID      uuid.UUID  `json:"agentId" db:"agent_id"`
-	Provider     string     `json:"provider" db:"provider"` // slack, github, jira, confluence, elastic
-	AccessToken  string     `json:"-" db:"access_token"`
-	RefreshToken *string    `json:"-" db:"refresh_token"`
-	Scopes       []string   `json:"scopes" db:"scopes"`
-	Status       string     `json:"status" db:"status"` // active, expired, error
-	ExternalID   *string    `json:"externalId" db:"external_id"`
-	Metadata     *string    `json:"metadata" db:"metadata"` // JSON string for provider-specific data
-	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`
-	ExpiresAt    *time.Time `json:"expiresAt" db:"expires_at"`
+	ID             uuid.UUID  `json:"id" db:"id"`
+	AgentID        uuid.UUID  `json:"agentId" db:"agent_id"`
+	Provider       string     `json:"provider" db:"provider"` // slack, github, jira, confluence, elastic
+	AccessToken    string     `json:"-" db:"access_token"`
+	RefreshToken   *string    `json:"-" db:"refresh_token"`
+	Scopes         []string   `json:"scopes" db:"scopes"`
+	Status         string     `json:"status" db:"status"` // active, expired, error
+	ExternalID     *string    `json:"externalId" db:"external_id"`
+	Metadata       *string    `json:"metadata" db:"metadata"`  // JSON string for provider-specific data
+	Passive        bool       `json:"passive" db:"passive"`    // React only, never post messages
+	Enabled        bool       `json:"enabled" db:"enabled"`    // Disabled integrations stay connected but events are ignored
+	RouteTokenHash *string    `json:"-" db:"route_token_hash"` // Authorizes events posted to the integration's webhook URL
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	ExpiresAt      *time.Time `json:"expiresAt" db:"expires_at"`
 }
 
 // Interaction represents a single agent interaction
@@ -82,14 +403,127 @@ type Interaction struct {
 	InputData       string     `json:"inputData" db:"input_data"`             // JSON
 	OutputData      *string    `json:"outputData" db:"output_data"`           // JSON
 	ConfidenceScore *int       `json:"confidenceScore" db:"confidence_score"`
-	Status          string     `json:"status" db:"status"` // pending, completed, escalated, failed
+	Status          string     `json:"status" db:"status"` // pending, completed, escalated, failed, skipped, deferred
 	Escalated       bool       `json:"escalated" db:"escalated"`
 	HumanFeedback   *string    `json:"humanFeedback" db:"human_feedback"` // approved, rejected, corrected
 	ProcessingTime  *int       `json:"processingTime" db:"processing_time"`
+	ErrorMessage    *string    `json:"errorMessage" db:"error_message"`
+	SkipReason      *string    `json:"skipReason" db:"skip_reason"`           // Why a skipped interaction was not processed
+	CorrectedOutput *string    `json:"correctedOutput" db:"corrected_output"` // Human correction, original kept in OutputData
+	CorrectedBy     *uuid.UUID `json:"correctedBy" db:"corrected_by"`
+	CorrectedAt     *time.Time `json:"correctedAt" db:"corrected_at"`
+	DeferredBy      *uuid.UUID `json:"deferredBy" db:"deferred_window_id"` // Maintenance window holding back a deferred interaction
 	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
 	CompletedAt     *time.Time `json:"completedAt" db:"completed_at"`
 }
 
+// InteractionReplay is the hypothetical result of re-running an interaction
+// through the AI service in shadow mode
+type InteractionReplay struct {
+	ID              uuid.UUID `json:"id" db:"id"`
+	RunID           uuid.UUID `json:"runId" db:"run_id"`
+	AgentID         uuid.UUID `json:"agentId" db:"agent_id"`
+	InteractionID   uuid.UUID `json:"interactionId" db:"interaction_id"`
+	Status          string    `json:"status" db:"status"` // completed, escalated, error
+	Action          *string   `json:"action" db:"action"` // suggested, escalate
+	OutputData      *string   `json:"outputData" db:"output_data"`
+	ConfidenceScore *int      `json:"confidenceScore" db:"confidence_score"`
+	ErrorMessage    *string   `json:"errorMessage" db:"error_message"`
+	CreatedAt       time.Time `json:"createdAt" db:"created_at"`
+}
+
+// ReplayRequest selects past interactions to replay, either by ID or by date range
+type ReplayRequest struct {
+	InteractionIDs []uuid.UUID `json:"interactionIds"`
+	From           *time.Time  `json:"from"`
+	To             *time.Time  `json:"to"`
+}
+
+// ReplayComparison pairs an interaction's original result with its replay
+type ReplayComparison struct {
+	InteractionID      uuid.UUID `json:"interactionId"`
+	Provider           string    `json:"provider"`
+	InteractionType    string    `json:"interactionType"`
+	OriginalOutput     *string   `json:"originalOutput"`
+	OriginalConfidence *int      `json:"originalConfidence"`
+	OriginalEscalated  bool      `json:"originalEscalated"`
+	HumanFeedback      *string   `json:"humanFeedback"`
+	CorrectedOutput    *string   `json:"correctedOutput"`
+	ReplayStatus       string    `json:"replayStatus"`
+	ReplayOutput       *string   `json:"replayOutput"`
+	ReplayConfidence   *int      `json:"replayConfidence"`
+	ReplayError        *string   `json:"replayError"`
+	ConfidenceDelta    *int      `json:"confidenceDelta"`
+	DecisionChanged    bool      `json:"decisionChanged"` // Escalated in one run but not the other
+}
+
+// ReplayReport summarizes a replay run
+type ReplayReport struct {
+	RunID                 uuid.UUID           `json:"runId"`
+	Replayed              int                 `json:"replayed"`
+	Failed                int                 `json:"failed"`
+	DecisionChanges       int                 `json:"decisionChanges"`
+	AvgOriginalConfidence float64             `json:"avgOriginalConfidence"`
+	AvgReplayConfidence   float64             `json:"avgReplayConfidence"`
+	Comparisons           []*ReplayComparison `json:"comparisons"`
+}
+
+// BuildReplayReport fills in per-comparison deltas and the run totals.
+// Confidence averages only cover interactions scored in both runs.
+func BuildReplayReport(runID uuid.UUID, comparisons []*ReplayComparison) *ReplayReport {
+	report := &ReplayReport{RunID: runID, Comparisons: comparisons}
+	if report.Comparisons == nil {
+		report.Comparisons = []*ReplayComparison{}
+	}
+
+	var originalSum, replaySum, scored int
+	for _, c := range comparisons {
+		if c.ReplayStatus == "error" {
+			report.Failed++
+			continue
+		}
+		report.Replayed++
+
+		c.DecisionChanged = c.OriginalEscalated != (c.ReplayStatus == "escalated")
+		if c.DecisionChanged {
+			report.DecisionChanges++
+		}
+
+		if c.OriginalConfidence != nil && c.ReplayConfidence != nil {
+			delta := *c.ReplayConfidence - *c.OriginalConfidence
+			c.ConfidenceDelta = &delta
+			originalSum += *c.OriginalConfidence
+			replaySum += *c.ReplayConfidence
+			scored++
+		}
+	}
+
+	if scored > 0 {
+		report.AvgOriginalConfidence = float64(originalSum) / float64(scored)
+		report.AvgReplayConfidence = float64(replaySum) / float64(scored)
+	}
+	return report
+}
+
+// InteractionTypes lists the interaction types produced by the webhook handlers
+var InteractionTypes = []string{
+	"message", "mention", "pull_request", "pr_review", "comment", "issue", "issue_created", "issue_updated",
+}
+
+// IsValidInteractionType reports whether t is a known interaction type
+func IsValidInteractionType(t string) bool {
+	for _, known := range InteractionTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// EscalationTagAudit marks escalations raised by random audit sampling rather
+// than low confidence
+const EscalationTagAudit = "audit"
+
 // Escalation represents an interaction that needs human attention
 type Escalation struct {
 	ID            uuid.UUID  `json:"id" db:"id"`
@@ -98,37 +532,227 @@ type Escalation struct {
 	Reason        string     `json:"reason" db:"reason"`
 	Priority      string     `json:"priority" db:"priority"` // low, medium, high, urgent
 	Status        string     `json:"status" db:"status"`     // pending, resolved, dismissed
-	Context       *string    `json:"context" db:"context"`   // JSON with additional context
+	Tag           *string    `json:"tag" db:"tag"`           // audit; nil for low-confidence escalations
+	AssignedTo    *uuid.UUID `json:"assignedTo" db:"assigned_to"`
+	Context       *string    `json:"context" db:"context"` // JSON with additional context
 	Resolution    *string    `json:"resolution" db:"resolution"`
 	ResolvedBy    *uuid.UUID `json:"resolvedBy" db:"resolved_by"`
 	ResolvedAt    *time.Time `json:"resolvedAt" db:"resolved_at"`
 	CreatedAt     time.Time  `json:"createdAt" db:"created_at"`
 }
 
+// ResolvedWith reports whether the escalation is already resolved with
+// resolution, i.e. a repeat of the request that resolved it
+func (e *Escalation) ResolvedWith(resolution string) bool {
+	return e.Status == "resolved" && e.Resolution != nil && *e.Resolution == resolution
+}
+
+// EscalationRoutingRule assigns new escalations matching an agent, provider
+// and interaction type to a reviewer. Nil fields match anything.
+type EscalationRoutingRule struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	OrgID           uuid.UUID  `json:"orgId" db:"org_id"`
+	AgentID         *uuid.UUID `json:"agentId" db:"agent_id"`
+	Provider        *string    `json:"provider" db:"provider"`
+	InteractionType *string    `json:"interactionType" db:"interaction_type"`
+	AssigneeID      uuid.UUID  `json:"assigneeId" db:"assignee_id"`
+	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// Matches reports whether the rule applies to an escalation
+func (r *EscalationRoutingRule) Matches(agentID uuid.UUID, provider, interactionType string) bool {
+	return (r.AgentID == nil || *r.AgentID == agentID) &&
+		(r.Provider == nil || *r.Provider == provider) &&
+		(r.InteractionType == nil || *r.InteractionType == interactionType)
+}
+
+// specificity ranks rules so an agent-specific rule beats an organization
+// wide one, then a provider match beats an interaction type match
+func (r *EscalationRoutingRule) specificity() int {
+	score := 0
+	if r.AgentID != nil {
+		score += 4
+	}
+	if r.Provider != nil {
+		score += 2
+	}
+	if r.InteractionType != nil {
+		score++
+	}
+	return score
+}
+
+// MatchRoutingRule returns the most specific rule matching an escalation, the
+// earliest listed on ties, or nil when none match
+func MatchRoutingRule(rules []*EscalationRoutingRule, agentID uuid.UUID, provider, interactionType string) *EscalationRoutingRule {
+	var best *EscalationRoutingRule
+	for _, rule := range rules {
+		if !rule.Matches(agentID, provider, interactionType) {
+			continue
+		}
+		if best == nil || rule.specificity() > best.specificity() {
+			best = rule
+		}
+	}
+	return best
+}
+
+// RoutingRuleRequest creates or replaces an escalation routing rule
+type RoutingRuleRequest struct {
+	AgentID         *uuid.UUID `json:"agentId"`
+	Provider        *string    `json:"provider"`
+	InteractionType *string    `json:"interactionType"`
+	AssigneeID      uuid.UUID  `json:"assigneeId"`
+}
+
+// Validate checks the request names an assignee and known interaction type
+func (r *RoutingRuleRequest) Validate() error {
+	if r.AssigneeID == uuid.Nil {
+		return fmt.Errorf("assigneeId is required")
+	}
+	if r.Provider != nil && *r.Provider == "" {
+		return fmt.Errorf("provider must not be empty")
+	}
+	if r.InteractionType != nil && !IsValidInteractionType(*r.InteractionType) {
+		return fmt.Errorf("invalid interactionType: %s", *r.InteractionType)
+	}
+	return nil
+}
+
+// EscalationExport is a single escalation joined with its interaction and resolver for offline review
+type EscalationExport struct {
+	Escalation        *Escalation  `json:"escalation"`
+	Interaction       *Interaction `json:"interaction"`
+	AgentName         string       `json:"agentName"`
+	ResolvedByName    *string      `json:"resolvedByName"`
+	ResolutionSeconds *int64       `json:"resolutionSeconds"` // Time from creation to resolution
+}
+
+// EscalationListItem is an escalation in the review queue, with the
+// interaction that raised it and its agent's name
+type EscalationListItem struct {
+	Escalation  *Escalation  `json:"escalation"`
+	Interaction *Interaction `json:"interaction"`
+	AgentName   string       `json:"agentName"`
+}
+
+// EscalationFilter narrows the escalation list. Empty fields match anything.
+type EscalationFilter struct {
+	AgentID  *uuid.UUID
+	Priority string
+	Status   string
+	Tag      string
+}
+
+// EscalationExportFilter narrows an escalation export
+type EscalationExportFilter struct {
+	From   *time.Time
+	To     *time.Time
+	Status string
+	Tag    string
+}
+
+// ResolvedEscalationSample is a resolved escalation with the interaction
+// that raised it, shaped as a supervised training example: what the agent
+// saw and proposed, why it escalated and what the human decided
+type ResolvedEscalationSample struct {
+	EscalationID      uuid.UUID `json:"escalationId"`
+	InteractionID     uuid.UUID `json:"interactionId"`
+	AgentID           uuid.UUID `json:"agentId"`
+	Provider          string    `json:"provider"`
+	InteractionType   string    `json:"interactionType"`
+	InputData         string    `json:"inputData"`
+	AgentOutput       *string   `json:"agentOutput"`
+	ConfidenceScore   *int      `json:"confidenceScore"`
+	EscalationReason  string    `json:"escalationReason"`
+	Priority          string    `json:"priority"`
+	Tag               *string   `json:"tag"`
+	Resolution        string    `json:"resolution"`
+	HumanFeedback     *string   `json:"humanFeedback"`
+	CorrectedOutput   *string   `json:"correctedOutput"`
+	ResolvedAt        time.Time `json:"resolvedAt"`
+	ResolutionSeconds int64     `json:"resolutionSeconds"`
+}
+
+// Redact strips secrets and personal data from the sample's free-form fields
+func (s *ResolvedEscalationSample) Redact() {
+	s.InputData = RedactForTraining(s.InputData)
+	for _, field := range []*string{s.AgentOutput, s.CorrectedOutput, &s.Resolution} {
+		if field != nil {
+			*field = RedactForTraining(*field)
+		}
+	}
+}
+
 // TrainingSample represents a sample used to train an agent's personality
 type TrainingSample struct {
-	ID         uuid.UUID  `json:"id" db:"id"`
-	AgentID    uuid.UUID  `json:"agentId" db:"agent_id"`
-	Provider   *string    `json:"provider" db:"provider"`
-	SampleType string     `json:"sampleType" db:"sample_type"` // message, response, style, domain
-	InputText  string     `json:"inputText" db:"input_text"`
-	OutputText *string    `json:"outputText" db:"output_text"`
-	Embedding  []float32  `json:"-" db:"embedding"`
-	IsPositive bool       `json:"isPositive" db:"is_positive"`
-	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+	ID         uuid.UUID `json:"id" db:"id"`
+	AgentID    uuid.UUID `json:"agentId" db:"agent_id"`
+	Provider   *string   `json:"provider" db:"provider"`
+	SampleType string    `json:"sampleType" db:"sample_type"` // see TrainingSampleTypes
+	InputText  string    `json:"inputText" db:"input_text"`
+	OutputText *string   `json:"outputText" db:"output_text"`
+	Embedding  []float32 `json:"-" db:"embedding"`
+	IsPositive bool      `json:"isPositive" db:"is_positive"`
+	Source     *string   `json:"source" db:"source"` // Where the sample came from, e.g. feedback or import:<job>
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
 }
 
 // Analytics structures
 
 type OverviewMetrics struct {
-	TotalInteractions    int     `json:"totalInteractions"`
-	TodayInteractions    int     `json:"todayInteractions"`
-	AutonomousRate       float64 `json:"autonomousRate"`
-	PendingEscalations   int     `json:"pendingEscalations"`
-	AvgConfidenceScore   float64 `json:"avgConfidenceScore"`
-	AvgProcessingTime    float64 `json:"avgProcessingTime"`
-	InteractionsByType   map[string]int `json:"interactionsByType"`
-	InteractionsByStatus map[string]int `json:"interactionsByStatus"`
+	TotalInteractions     int            `json:"totalInteractions"` // Skipped interactions are left out
+	TodayInteractions     int            `json:"todayInteractions"`
+	EscalatedInteractions int            `json:"escalatedInteractions"` // Escalated among TotalInteractions
+	AutonomousRate        float64        `json:"autonomousRate"`
+	PendingEscalations    int            `json:"pendingEscalations"`
+	AvgConfidenceScore    float64        `json:"avgConfidenceScore"`
+	AvgProcessingTime     float64        `json:"avgProcessingTime"`
+	InteractionsByType    map[string]int `json:"interactionsByType"`
+	InteractionsByStatus  map[string]int `json:"interactionsByStatus"`
+}
+
+// Totals returns the raw counts the autonomous rate is computed from
+func (m *OverviewMetrics) Totals() InteractionTotals {
+	return InteractionTotals{Total: m.TotalInteractions, Escalated: m.EscalatedInteractions}
+}
+
+// InteractionTotals are raw interaction counts across several agents, so
+// rates over all of them are computed from whole numbers
+type InteractionTotals struct {
+	Total     int `json:"total"` // Processed interactions; skipped ones are left out
+	Escalated int `json:"escalated"`
+}
+
+// AutonomousRate is the percentage of interactions handled without
+// escalation, 0 when there are none
+func (t InteractionTotals) AutonomousRate() float64 {
+	if t.Total == 0 {
+		return 0
+	}
+	return float64(t.Total-t.Escalated) / float64(t.Total) * 100
+}
+
+// OrgOverviewMetrics summarizes every agent in an organization
+type OrgOverviewMetrics struct {
+	TotalInteractions  int            `json:"totalInteractions"`
+	TodayInteractions  int            `json:"todayInteractions"`
+	AutonomousRate     float64        `json:"autonomousRate"`
+	PendingEscalations int            `json:"pendingEscalations"`
+	AvgConfidenceScore float64        `json:"avgConfidenceScore"`
+	AgentCount         int            `json:"agentCount"`
+	TopAgents          []*AgentVolume `json:"topAgents"` // Busiest agents first
+}
+
+// AgentVolume is one agent's share of an organization's interactions
+type AgentVolume struct {
+	AgentID            uuid.UUID `json:"agentId"`
+	AgentName          string    `json:"agentName"`
+	OwnerName          string    `json:"ownerName"`
+	TotalInteractions  int       `json:"totalInteractions"`
+	TodayInteractions  int       `json:"todayInteractions"`
+	AutonomousRate     float64   `json:"autonomousRate"`
+	AvgConfidenceScore float64   `json:"avgConfidenceScore"`
 }
 
 type TrendData struct {
@@ -138,6 +762,145 @@ type TrendData struct {
 	Confidence   float64 `json:"confidence"`
 }
 
+// WebhookEventCounts tallies inbound webhook events by outcome. Filtered
+// events are valid but not ones an agent acts on; skipped events were
+// recorded as skipped interactions without processing; invalid events were
+// rejected because their payload could not be parsed; dropped events were
+// rejected because the ingestion buffer was full; unrouted events came from a
+// workspace no agent is subscribed to and were discarded.
+type WebhookEventCounts struct {
+	Received int64 `json:"received"`
+	Queued   int64 `json:"queued"`
+	Filtered int64 `json:"filtered"`
+	Skipped  int64 `json:"skipped"`
+	Invalid  int64 `json:"invalid"`
+	Dropped  int64 `json:"dropped"`
+	Unrouted int64 `json:"unrouted"`
+}
+
+// WebhookProviderMetrics are a provider's webhook counts, in total and per event type
+type WebhookProviderMetrics struct {
+	Provider string `json:"provider"`
+	WebhookEventCounts
+	EventTypes map[string]*WebhookEventCounts `json:"eventTypes"`
+}
+
+// FeedbackSummary aggregates human review of an agent's interactions
+type FeedbackSummary struct {
+	From         time.Time        `json:"from"`
+	To           time.Time        `json:"to"`
+	Approved     int              `json:"approved"`
+	Rejected     int              `json:"rejected"`
+	Corrected    int              `json:"corrected"`
+	ApprovalRate float64          `json:"approvalRate"`
+	Trend        []*FeedbackTrend `json:"trend"`
+}
+
+type FeedbackTrend struct {
+	Date         string  `json:"date"`
+	Approved     int     `json:"approved"`
+	Rejected     int     `json:"rejected"`
+	Corrected    int     `json:"corrected"`
+	ApprovalRate float64 `json:"approvalRate"`
+}
+
+// ApprovalRate returns the percentage of reviewed interactions that were approved
+func ApprovalRate(approved, rejected, corrected int) float64 {
+	total := approved + rejected + corrected
+	if total == 0 {
+		return 0
+	}
+	return float64(approved) / float64(total) * 100
+}
+
+// CalibrationBucket compares the confidence an agent reported with how often
+// humans approved its interactions in one confidence range
+type CalibrationBucket struct {
+	MinConfidence int     `json:"minConfidence"`
+	MaxConfidence int     `json:"maxConfidence"` // Inclusive
+	AvgConfidence float64 `json:"avgConfidence"`
+	Approved      int     `json:"approved"`
+	Rejected      int     `json:"rejected"`
+	Corrected     int     `json:"corrected"`
+	Reviewed      int     `json:"reviewed"`
+	ApprovalRate  float64 `json:"approvalRate"`
+	Gap           float64 `json:"gap"` // approvalRate - avgConfidence; negative is overconfident
+}
+
+// CalibrationReport is an agent's confidence calibration curve
+type CalibrationReport struct {
+	From                time.Time            `json:"from"`
+	To                  time.Time            `json:"to"`
+	BucketSize          int                  `json:"bucketSize"`
+	ConfidenceThreshold int                  `json:"confidenceThreshold"`
+	Reviewed            int                  `json:"reviewed"`
+	CalibrationError    float64              `json:"calibrationError"` // Reviewed-weighted mean |gap|
+	Assessment          string               `json:"assessment"`       // overconfident, underconfident, calibrated, insufficient_data
+	Buckets             []*CalibrationBucket `json:"buckets"`
+}
+
+// Calibration assessment thresholds: the weighted mean gap (in points) past
+// which an agent is called over- or underconfident, and the reviews needed
+// before judging at all
+const (
+	calibrationTolerance  = 5.0
+	calibrationMinReviews = 20
+)
+
+// BuildCalibrationReport lays the non-empty buckets from the database onto
+// the full 0-100 range and scores how well confidence matches approval.
+// bucketSize must divide 100.
+func BuildCalibrationReport(counted []*CalibrationBucket, bucketSize int) *CalibrationReport {
+	report := &CalibrationReport{BucketSize: bucketSize}
+
+	byMin := make(map[int]*CalibrationBucket, len(counted))
+	for _, b := range counted {
+		byMin[b.MinConfidence] = b
+	}
+
+	var weightedGap, weightedAbsGap float64
+	for min := 0; min < 100; min += bucketSize {
+		b, ok := byMin[min]
+		if !ok {
+			b = &CalibrationBucket{MinConfidence: min}
+		}
+		b.MaxConfidence = min + bucketSize - 1
+		if b.MaxConfidence == 99 {
+			b.MaxConfidence = 100
+		}
+		b.Reviewed = b.Approved + b.Rejected + b.Corrected
+		if b.Reviewed > 0 {
+			b.ApprovalRate = ApprovalRate(b.Approved, b.Rejected, b.Corrected)
+			b.Gap = b.ApprovalRate - b.AvgConfidence
+			weightedGap += b.Gap * float64(b.Reviewed)
+			if b.Gap < 0 {
+				weightedAbsGap -= b.Gap * float64(b.Reviewed)
+			} else {
+				weightedAbsGap += b.Gap * float64(b.Reviewed)
+			}
+		}
+		report.Reviewed += b.Reviewed
+		report.Buckets = append(report.Buckets, b)
+	}
+
+	report.Assessment = "insufficient_data"
+	if report.Reviewed > 0 {
+		report.CalibrationError = weightedAbsGap / float64(report.Reviewed)
+	}
+	if report.Reviewed >= calibrationMinReviews {
+		meanGap := weightedGap / float64(report.Reviewed)
+		switch {
+		case meanGap < -calibrationTolerance:
+			report.Assessment = "overconfident"
+		case meanGap > calibrationTolerance:
+			report.Assessment = "underconfident"
+		default:
+			report.Assessment = "calibrated"
+		}
+	}
+	return report
+}
+
 type PerformanceMetrics struct {
 	Provider          string  `json:"provider"`
 	TotalInteractions int     `json:"totalInteractions"`
@@ -160,6 +923,7 @@ type OrganizationCredential struct {
 	IsActive      bool       `json:"isActive" db:"is_active"`
 	VerifiedAt    *time.Time `json:"verifiedAt" db:"verified_at"`
 	CreatedBy     *uuid.UUID `json:"createdBy" db:"created_by"`
+	UpdatedBy     *uuid.UUID `json:"updatedBy" db:"updated_by"`
 	CreatedAt     time.Time  `json:"createdAt" db:"created_at"`
 	UpdatedAt     time.Time  `json:"updatedAt" db:"updated_at"`
 }
@@ -178,8 +942,8 @@ type GitHubCredentialConfig struct {
 }
 
 type JiraCredentialConfig struct {
-	SiteURL      string   `json:"siteUrl"` // e.g., https://your-domain.atlassian.net
-	IsCloud      bool     `json:"isCloud"`
+	SiteURL         string   `json:"siteUrl"` // e.g., https://your-domain.atlassian.net
+	IsCloud         bool     `json:"isCloud"`
 	AllowedProjects []string `json:"allowedProjects,omitempty"`
 }
 
@@ -188,6 +952,7 @@ type JiraCredentialConfig struct {
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8"`
+	DeviceID string `json:"deviceId"` // Used when the X-Device-ID header is absent
 }
 
 type RegisterRequest struct {
@@ -195,6 +960,7 @@ type RegisterRequest struct {
 	Password     string `json:"password" validate:"required,min=8"`
 	Name         string `json:"name" validate:"required"`
 	Organization string `json:"organization" validate:"required"`
+	CaptchaToken string `json:"captchaToken"` // Required when hCaptcha is configured
 }
 
 type AuthResponse struct {
@@ -204,18 +970,73 @@ type AuthResponse struct {
 	ExpiresIn    int    `json:"expiresIn"`
 }
 
+// Reasons an introspected token is not active
+const (
+	TokenMalformed         = "malformed"
+	TokenInvalidSignature  = "invalid_signature"
+	TokenExpired           = "expired"
+	TokenInvalid           = "invalid"
+	TokenMembershipRevoked = "membership_revoked"
+)
+
+// TokenIntrospection describes a Vibber token: whether it is currently
+// accepted and, when its signature checks out, its claims
+type TokenIntrospection struct {
+	Active    bool   `json:"active"`
+	Reason    string `json:"reason,omitempty"`    // Why the token is not active
+	TokenType string `json:"tokenType,omitempty"` // access or refresh
+	Sub       string `json:"sub,omitempty"`
+	OrgID     string `json:"orgId,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+}
+
+// CreateAgentRequest fields left out fall back to the organization's
+// AgentDefaults and then to the built-in defaults
 type CreateAgentRequest struct {
-	Name                string `json:"name" validate:"required"`
-	Description         string `json:"description"`
-	ConfidenceThreshold int    `json:"confidenceThreshold"`
+	Name                string         `json:"name" validate:"required"`
+	Description         string         `json:"description"`
+	ConfidenceThreshold *int           `json:"confidenceThreshold"`
+	ProviderThresholds  map[string]int `json:"providerThresholds"`
+	AutoMode            *bool          `json:"autoMode"`
+	WorkingHours        *string        `json:"workingHours"`
 }
 
 type UpdateAgentRequest struct {
-	Name                *string `json:"name"`
-	Description         *string `json:"description"`
-	ConfidenceThreshold *int    `json:"confidenceThreshold"`
-	AutoMode            *bool   `json:"autoMode"`
-	WorkingHours        *string `json:"workingHours"`
+	Name                *string        `json:"name"`
+	Description         *string        `json:"description"`
+	ConfidenceThreshold *int           `json:"confidenceThreshold"`
+	ProviderThresholds  map[string]int `json:"providerThresholds"`
+	AutoMode            *bool          `json:"autoMode"`
+	WorkingHours        *string        `json:"workingHours"`
+}
+
+// ReplaceAgentRequest is the full agent representation accepted by PUT. Name,
+// confidenceThreshold and autoMode are required; the nullable fields are
+// reset when omitted.
+type ReplaceAgentRequest struct {
+	Name                string         `json:"name"`
+	Description         *string        `json:"description"`
+	ConfidenceThreshold *int           `json:"confidenceThreshold"`
+	ProviderThresholds  map[string]int `json:"providerThresholds"`
+	AutoMode            *bool          `json:"autoMode"`
+	WorkingHours        *string        `json:"workingHours"`
+}
+
+// RecordInteractionRequest is sent by the AI service when it has processed an interaction
+type RecordInteractionRequest struct {
+	ID              *uuid.UUID      `json:"id,omitempty"` // Existing interaction to complete, if any
+	AgentID         uuid.UUID       `json:"agentId"`
+	IntegrationID   uuid.UUID       `json:"integrationId"`
+	Provider        string          `json:"provider"`
+	InteractionType string          `json:"interactionType"`
+	InputData       json.RawMessage `json:"inputData"`
+	OutputData      json.RawMessage `json:"outputData,omitempty"`
+	ConfidenceScore *int            `json:"confidenceScore"`
+	Status          string          `json:"status,omitempty"` // Defaults to completed
+	ProcessingTime  *int            `json:"processingTime,omitempty"`
 }
 
 type FeedbackRequest struct {
@@ -224,6 +1045,23 @@ type FeedbackRequest struct {
 	Notes      string `json:"notes,omitempty"`
 }
 
+// InteractionFilter narrows interaction listings; empty fields match everything
+type InteractionFilter struct {
+	AgentID  *uuid.UUID
+	Provider string
+	Status   string
+	TagID    *uuid.UUID
+}
+
+// OrgInteraction is an interaction listed across an organization, with the
+// agent and the user who owns it
+type OrgInteraction struct {
+	*Interaction
+	AgentName string    `json:"agentName"`
+	OwnerID   uuid.UUID `json:"ownerId"`
+	OwnerName string    `json:"ownerName"`
+}
+
 type PaginationParams struct {
 	Page     int    `json:"page"`
 	PageSize int    `json:"pageSize"`
@@ -268,10 +1106,73 @@ type CredentialResponse struct {
 	Config     *string    `json:"config"`
 	IsActive   bool       `json:"isActive"`
 	VerifiedAt *time.Time `json:"verifiedAt"`
+	CreatedBy  *uuid.UUID `json:"createdBy"`
+	UpdatedBy  *uuid.UUID `json:"updatedBy"`
 	CreatedAt  time.Time  `json:"createdAt"`
 	UpdatedAt  time.Time  `json:"updatedAt"`
 }
 
+// CredentialVerification is the outcome of verifying one provider's
+// credentials in a bulk verification
+type CredentialVerification struct {
+	Verified          bool       `json:"verified"`
+	VerifiedAt        *time.Time `json:"verifiedAt"`
+	Error             string     `json:"error,omitempty"`
+	RetryAfterSeconds int        `json:"retryAfterSeconds,omitempty"` // Set when the provider's rate limit deferred the check
+}
+
+// IntegrationResponse is a secret-free integration shape that is the same no
+// matter which repository method loaded the integration
+
+type IntegrationResponse struct {
+	ID            uuid.UUID  `json:"id"`
+	AgentID       uuid.UUID  `json:"agentId"`
+	Provider      string     `json:"provider"`
+	Scopes        []string   `json:"scopes"`
+	Status        string     `json:"status"`
+	ExternalID    *string    `json:"externalId"`
+	Metadata      *string    `json:"metadata"`
+	Passive       bool       `json:"passive"`
+	Enabled       bool       `json:"enabled"`
+	RouteTokenSet bool       `json:"routeTokenSet"` // Events may be posted to a secret webhook URL
+	CreatedAt     time.Time  `json:"createdAt"`
+	ExpiresAt     *time.Time `json:"expiresAt"`
+}
+
+// IntegrationStatusResponse adds token health details to an integration
+type IntegrationStatusResponse struct {
+	IntegrationResponse
+	MissingScopes []string                 `json:"missingScopes"`
+	ScopeGrants   []*IntegrationScopeGrant `json:"scopeGrants"` // Scopes added since connecting, oldest first
+	RateLimit     *RateLimitState          `json:"rateLimit"`
+}
+
+// IntegrationScopeGrant records scopes added to an integration after it was
+// connected
+type IntegrationScopeGrant struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	IntegrationID uuid.UUID  `json:"integrationId" db:"integration_id"`
+	Scopes        []string   `json:"scopes" db:"scopes"`
+	GrantedBy     *uuid.UUID `json:"grantedBy" db:"granted_by"`
+	CreatedAt     time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// PendingScopeUpgrade is held between sending the user to the provider and
+// the OAuth callback, keyed by the state parameter
+type PendingScopeUpgrade struct {
+	IntegrationID uuid.UUID `json:"integrationId"`
+	UserID        uuid.UUID `json:"userId"`
+	Scopes        []string  `json:"scopes"` // Every scope asked for, existing and new
+}
+
+// RateLimitState is the provider API token bucket for an integration
+type RateLimitState struct {
+	Capacity        int        `json:"capacity"`
+	Tokens          float64    `json:"tokens"`
+	RefillPerSecond float64    `json:"refillPerSecond"`
+	BlockedUntil    *time.Time `json:"blockedUntil"` // Set while backing off after a provider 429
+}
+
 // CredentialForAgent is passed to the AI agent with full credentials
 type CredentialForAgent struct {
 	Provider      string  `json:"provider"`
@@ -1,6 +1,11 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -170,3 +175,1177 @@ func TestAgentStatusModel(t *testing.T) {
 		t.Errorf("TodayInteractions mismatch: got %v want %v", status.TodayInteractions, 10)
 	}
 }
+
+func TestIsValidInteractionType(t *testing.T) {
+	for _, valid := range []string{"message", "pr_review", "issue_updated"} {
+		if !IsValidInteractionType(valid) {
+			t.Errorf("expected %q to be valid", valid)
+		}
+	}
+
+	for _, invalid := range []string{"", "unknown", "PR_REVIEW"} {
+		if IsValidInteractionType(invalid) {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestAgentThresholdFor(t *testing.T) {
+	agent := &Agent{
+		ConfidenceThreshold: 70,
+		ProviderThresholds:  map[string]int{"github": 85},
+	}
+
+	if got := agent.ThresholdFor("github"); got != 85 {
+		t.Errorf("github threshold: got %v want %v", got, 85)
+	}
+
+	if got := agent.ThresholdFor("slack"); got != 70 {
+		t.Errorf("slack threshold: got %v want %v", got, 70)
+	}
+}
+
+func TestMissingScopes(t *testing.T) {
+	required := RequiredScopes("slack", "message")
+	if len(required) != 2 {
+		t.Fatalf("unexpected slack message scopes: %v", required)
+	}
+
+	missing := MissingScopes([]string{"channels:history", "users:read"}, required)
+	if len(missing) != 1 || missing[0] != "chat:write" {
+		t.Errorf("MissingScopes: got %v want [chat:write]", missing)
+	}
+
+	if missing := MissingScopes(required, required); len(missing) != 0 {
+		t.Errorf("expected no missing scopes, got %v", missing)
+	}
+
+	if all := RequiredScopes("jira", ""); len(all) != 2 {
+		t.Errorf("RequiredScopes(jira, \"\"): got %v", all)
+	}
+}
+
+func TestScopeUpgrade(t *testing.T) {
+	union := UnionScopes([]string{"repo", "read:org"}, []string{"workflow", "repo"})
+	if len(union) != 3 || union[2] != "workflow" {
+		t.Errorf("UnionScopes: got %v", union)
+	}
+
+	if !SupportsIncrementalAuth("github") || SupportsIncrementalAuth("jira") {
+		t.Error("unexpected incremental auth support")
+	}
+
+	if err := (&ScopeUpgradeRequest{Scopes: []string{"admin:repo_hook", "workflow"}}).Validate(); err != nil {
+		t.Errorf("valid scopes rejected: %v", err)
+	}
+	for _, scopes := range [][]string{nil, {"repo,workflow"}, {"repo&state=x"}} {
+		if err := (&ScopeUpgradeRequest{Scopes: scopes}).Validate(); err == nil {
+			t.Errorf("scopes %q should be rejected", scopes)
+		}
+	}
+}
+
+func TestApprovalRate(t *testing.T) {
+	if got := ApprovalRate(0, 0, 0); got != 0 {
+		t.Errorf("ApprovalRate with no feedback = %v, want 0", got)
+	}
+	if got := ApprovalRate(3, 1, 0); got != 75 {
+		t.Errorf("ApprovalRate(3, 1, 0) = %v, want 75", got)
+	}
+}
+
+func TestResolveProviderEndpoints(t *testing.T) {
+	endpoints, err := ResolveProviderEndpoints("github", nil)
+	if err != nil || endpoints.AuthorizeURL != "https://github.com/login/oauth/authorize" {
+		t.Errorf("expected public github endpoints, got %+v (%v)", endpoints, err)
+	}
+
+	config := `{"enterpriseUrl":"https://ghe.example.com/"}`
+	endpoints, err = ResolveProviderEndpoints("github", &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoints.AuthorizeURL != "https://ghe.example.com/login/oauth/authorize" || endpoints.APIBaseURL != "https://ghe.example.com/api/v3" {
+		t.Errorf("unexpected enterprise endpoints: %+v", endpoints)
+	}
+
+	config = `{"siteUrl":"https://jira.example.com","isCloud":false}`
+	endpoints, err = ResolveProviderEndpoints("jira", &config)
+	if err != nil || endpoints.TokenURL != "https://jira.example.com/rest/oauth2/latest/token" || endpoints.IsCloud {
+		t.Errorf("unexpected data center endpoints: %+v (%v)", endpoints, err)
+	}
+
+	config = `{"enterpriseUrl":"http://ghe.example.com"}`
+	if _, err := ResolveProviderEndpoints("github", &config); err == nil {
+		t.Error("expected non-https enterprise URL to be rejected")
+	}
+}
+
+func TestGenerateAgentToken(t *testing.T) {
+	token, hash, err := GenerateAgentToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != HashAgentToken(token) {
+		t.Error("returned hash does not match the token")
+	}
+	if hash == token || len(hash) != 64 {
+		t.Errorf("unexpected hash %q", hash)
+	}
+
+	other, _, _ := GenerateAgentToken()
+	if other == token {
+		t.Error("expected distinct tokens")
+	}
+}
+
+func TestBuildReplayReport(t *testing.T) {
+	intPtr := func(n int) *int { return &n }
+
+	comparisons := []*ReplayComparison{
+		{OriginalConfidence: intPtr(60), OriginalEscalated: true, ReplayStatus: "completed", ReplayConfidence: intPtr(80)},
+		{OriginalConfidence: intPtr(90), ReplayStatus: "completed", ReplayConfidence: intPtr(70)},
+		{OriginalConfidence: intPtr(50), ReplayStatus: "error"},
+	}
+
+	report := BuildReplayReport(uuid.New(), comparisons)
+	if report.Replayed != 2 || report.Failed != 1 {
+		t.Errorf("replayed/failed = %d/%d, want 2/1", report.Replayed, report.Failed)
+	}
+	if report.DecisionChanges != 1 || !comparisons[0].DecisionChanged || comparisons[1].DecisionChanged {
+		t.Errorf("unexpected decision changes: %d", report.DecisionChanges)
+	}
+	if comparisons[0].ConfidenceDelta == nil || *comparisons[0].ConfidenceDelta != 20 {
+		t.Errorf("unexpected confidence delta: %v", comparisons[0].ConfidenceDelta)
+	}
+	if report.AvgOriginalConfidence != 75 || report.AvgReplayConfidence != 75 {
+		t.Errorf("unexpected averages: %v/%v", report.AvgOriginalConfidence, report.AvgReplayConfidence)
+	}
+}
+
+// Times are built the way the app gets them, from time.Now() and from Unix
+// seconds in the local zone as pgx scans them, without converting to UTC
+func TestTimestampsSerializeAsRFC3339UTC(t *testing.T) {
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.FixedZone("CET", 60*60)
+	UseUTC()
+
+	rfc3339UTC := regexp.MustCompile(`^"\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?Z"$`)
+	// 2026-03-29 00:30 in Berlin
+	scanned := time.Unix(1774740600, 0)
+	now := time.Now()
+
+	interaction := Interaction{
+		ID:          uuid.New(),
+		CreatedAt:   scanned,
+		CompletedAt: &now,
+	}
+
+	data, err := json.Marshal(interaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"createdAt", "completedAt"} {
+		if !rfc3339UTC.Match(fields[name]) {
+			t.Errorf("%s = %s, want RFC3339 with Z", name, fields[name])
+		}
+	}
+
+	// The UTC date can differ from the local one, which is what trend grouping uses
+	if got := string(fields["createdAt"]); got != `"2026-03-28T23:30:00Z"` {
+		t.Errorf("createdAt = %s, want the UTC instant", got)
+	}
+
+	var parsed Interaction
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.CreatedAt.Equal(scanned) || parsed.CreatedAt.Location() != time.UTC {
+		t.Errorf("round trip lost the instant or zone: %v", parsed.CreatedAt)
+	}
+}
+
+func TestTrainingSampleSanitize(t *testing.T) {
+	output := "  fixed\x00 reply\r\n"
+	sample := &TrainingSample{
+		SampleType: "correction",
+		InputText:  "hello\x1b[31m\tworld\x07",
+		OutputText: &output,
+	}
+	if err := sample.Sanitize(100, 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sample.InputText != "hello[31m\tworld" {
+		t.Errorf("InputText = %q", sample.InputText)
+	}
+	if *sample.OutputText != "fixed reply" {
+		t.Errorf("OutputText = %q", *sample.OutputText)
+	}
+
+	tests := []struct {
+		name   string
+		sample TrainingSample
+	}{
+		{"unknown type", TrainingSample{SampleType: "summary", InputText: "hi"}},
+		{"empty input", TrainingSample{SampleType: "message", InputText: " \x00\x01 "}},
+		{"input too long", TrainingSample{SampleType: "message", InputText: "héllo wörld"}},
+	}
+	for _, tt := range tests {
+		if err := tt.sample.Sanitize(10, 10); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+
+	// Limits count characters, not bytes
+	if _, err := CheckTrainingText("text", "héllo", 5); err != nil {
+		t.Errorf("unexpected error for 5 characters: %v", err)
+	}
+}
+
+func TestProviderMetadataAccessors(t *testing.T) {
+	metadata := `{"teamId":"T123","teamName":"Acme"}`
+	integration := &Integration{Provider: "slack", Metadata: &metadata}
+
+	meta, err := integration.SlackMetadata()
+	if err != nil || meta.TeamID != "T123" || meta.TeamName != "Acme" {
+		t.Errorf("SlackMetadata() = %+v, %v", meta, err)
+	}
+	if _, err := integration.GitHubMetadata(); err == nil {
+		t.Error("expected error reading github metadata from a slack integration")
+	}
+
+	empty := &Integration{Provider: "github"}
+	if meta, err := empty.GitHubMetadata(); err != nil || meta.Login != "" {
+		t.Errorf("GitHubMetadata() with no metadata = %+v, %v", meta, err)
+	}
+
+	config := `{"siteUrl":"https://acme.atlassian.net","isCloud":true}`
+	credential := &OrganizationCredential{Provider: "confluence", Config: &config}
+	if cfg, err := credential.JiraConfig(); err != nil || !cfg.IsCloud {
+		t.Errorf("JiraConfig() = %+v, %v", cfg, err)
+	}
+}
+
+func TestValidateProviderJSON(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{"valid slack config", ValidateProviderConfig("slack", str(`{"workspaceId":"T1"}`)), false},
+		{"misspelled slack key", ValidateProviderConfig("slack", str(`{"workspace_id":"T1"}`)), true},
+		{"wrong type", ValidateProviderConfig("github", str(`{"allowedOrgs":"acme"}`)), true},
+		{"not json", ValidateProviderConfig("jira", str(`siteUrl=x`)), true},
+		{"untyped provider object", ValidateProviderConfig("elastic", str(`{"index":"docs"}`)), false},
+		{"untyped provider array", ValidateProviderConfig("elastic", str(`["docs"]`)), true},
+		{"nil config", ValidateProviderConfig("github", nil), false},
+		{"valid metadata", ValidateIntegrationMetadata("github", str(`{"login":"octo","installationId":42}`)), false},
+		{"unknown metadata field", ValidateIntegrationMetadata("jira", str(`{"cloud_id":"abc"}`)), true},
+		{"trailing data", ValidateIntegrationMetadata("slack", str(`{"teamId":"T1"} {}`)), true},
+	}
+	for _, tt := range tests {
+		if (tt.err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, tt.err, tt.wantErr)
+		}
+	}
+}
+
+func TestInteractionCursorRoundTrip(t *testing.T) {
+	cursor := InteractionCursor{
+		CreatedAt: time.Date(2026, 10, 16, 9, 30, 0, 123456000, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	decoded, err := DecodeInteractionCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("decoded %+v, want %+v", decoded, cursor)
+	}
+
+	for _, bad := range []string{"", "not-base64!", "bm8tc2VwYXJhdG9y"} {
+		if _, err := DecodeInteractionCursor(bad); err == nil {
+			t.Errorf("expected error decoding %q", bad)
+		}
+	}
+}
+
+func TestPassiveScopes(t *testing.T) {
+	granted := []string{"channels:history", "channels:read", "reactions:write", "users:read"}
+	if extra := NonPassiveScopes("slack", granted); len(extra) != 0 {
+		t.Errorf("expected no non-passive scopes, got %v", extra)
+	}
+	if extra := NonPassiveScopes("slack", append(granted, "chat:write")); len(extra) != 1 || extra[0] != "chat:write" {
+		t.Errorf("expected chat:write to be flagged, got %v", extra)
+	}
+
+	integration := &Integration{Provider: "slack", Scopes: granted, Passive: true}
+	if missing := MissingScopes(integration.Scopes, RequiredScopesFor(integration, "message")); len(missing) != 0 {
+		t.Errorf("passive integration should not need chat:write, missing %v", missing)
+	}
+
+	integration.Passive = false
+	if missing := MissingScopes(integration.Scopes, RequiredScopesFor(integration, "message")); len(missing) != 1 || missing[0] != "chat:write" {
+		t.Errorf("regular integration should need chat:write, missing %v", missing)
+	}
+
+	if SupportsPassive("github") {
+		t.Error("github does not support passive mode")
+	}
+}
+
+func TestBuildCalibrationReport(t *testing.T) {
+	counted := []*CalibrationBucket{
+		{MinConfidence: 60, AvgConfidence: 65, Approved: 5, Rejected: 5},
+		{MinConfidence: 90, AvgConfidence: 95, Approved: 6, Rejected: 2, Corrected: 2},
+	}
+
+	report := BuildCalibrationReport(counted, 10)
+
+	if len(report.Buckets) != 10 {
+		t.Fatalf("expected 10 buckets, got %d", len(report.Buckets))
+	}
+	if top := report.Buckets[9]; top.MinConfidence != 90 || top.MaxConfidence != 100 || top.ApprovalRate != 60 || top.Gap != -35 {
+		t.Errorf("unexpected top bucket: %+v", top)
+	}
+	if empty := report.Buckets[0]; empty.Reviewed != 0 || empty.MaxConfidence != 9 {
+		t.Errorf("unexpected empty bucket: %+v", empty)
+	}
+	if report.Reviewed != 20 {
+		t.Errorf("Reviewed = %d, want 20", report.Reviewed)
+	}
+	// Gaps of -15 and -35, each over 10 reviews
+	if report.CalibrationError != 25 {
+		t.Errorf("CalibrationError = %v, want 25", report.CalibrationError)
+	}
+	if report.Assessment != "overconfident" {
+		t.Errorf("Assessment = %q, want overconfident", report.Assessment)
+	}
+
+	if sparse := BuildCalibrationReport(counted[:1], 10); sparse.Assessment != "insufficient_data" {
+		t.Errorf("Assessment = %q, want insufficient_data", sparse.Assessment)
+	}
+}
+
+func TestAgentDefaultsNewAgent(t *testing.T) {
+	threshold, autoMode := 85, true
+	defaults := &AgentDefaults{
+		ConfidenceThreshold: &threshold,
+		ProviderThresholds:  map[string]int{"github": 90},
+		AutoMode:            &autoMode,
+		WorkingHours:        json.RawMessage(`{"start":"09:00","end":"17:00"}`),
+	}
+	userID := uuid.New()
+
+	agent := defaults.NewAgent(userID, &CreateAgentRequest{Name: "Inherits"})
+	if agent.ConfidenceThreshold != 85 || !agent.AutoMode || agent.ProviderThresholds["github"] != 90 {
+		t.Errorf("agent did not inherit defaults: %+v", agent)
+	}
+	if agent.WorkingHours == nil || *agent.WorkingHours != `{"start":"09:00","end":"17:00"}` {
+		t.Errorf("WorkingHours = %v", agent.WorkingHours)
+	}
+
+	// Request values win, including explicit zero values
+	zero, off := 0, false
+	agent = defaults.NewAgent(userID, &CreateAgentRequest{Name: "Overrides", ConfidenceThreshold: &zero, AutoMode: &off, ProviderThresholds: map[string]int{}})
+	if agent.ConfidenceThreshold != 0 || agent.AutoMode || len(agent.ProviderThresholds) != 0 {
+		t.Errorf("request did not override defaults: %+v", agent)
+	}
+
+	agent = (&AgentDefaults{}).NewAgent(userID, &CreateAgentRequest{Name: "Built-in"})
+	if agent.ConfidenceThreshold != 70 || agent.AutoMode || agent.WorkingHours != nil {
+		t.Errorf("expected built-in defaults: %+v", agent)
+	}
+
+	bad := 101
+	if err := (&AgentDefaults{ConfidenceThreshold: &bad}).Validate(); err == nil {
+		t.Error("expected error for threshold above 100")
+	}
+	if err := (&AgentDefaults{WorkingHours: json.RawMessage(`{`)}).Validate(); err == nil {
+		t.Error("expected error for invalid working hours")
+	}
+}
+
+func TestAgentSampledForAudit(t *testing.T) {
+	tests := []struct {
+		rate float64
+		roll float64
+		want bool
+	}{
+		{0, 0, false},
+		{0, 0.5, false},
+		{0.1, 0.05, true},
+		{0.1, 0.1, false},
+		{0.1, 0.9, false},
+		{1, 0, true},
+		{1, 0.999, true},
+	}
+
+	for _, tt := range tests {
+		agent := &Agent{AuditSampleRate: tt.rate}
+		if got := agent.SampledForAudit(tt.roll); got != tt.want {
+			t.Errorf("rate %v roll %v: got %v want %v", tt.rate, tt.roll, got, tt.want)
+		}
+	}
+}
+
+func TestSlackMetaChannels(t *testing.T) {
+	meta := &SlackMeta{TeamID: "T1"}
+	if !meta.ChannelAllowed("C1") {
+		t.Error("untracked channels should be allowed")
+	}
+
+	// Being removed starts tracking, so only joined channels remain allowed
+	if !meta.LeaveChannel("C1") {
+		t.Error("leaving while untracked should change the metadata")
+	}
+	if meta.ChannelAllowed("C1") || meta.ChannelAllowed("C2") {
+		t.Error("no channels should be allowed after leaving")
+	}
+
+	if !meta.JoinChannel("C2") || meta.JoinChannel("C2") {
+		t.Error("joining should only change the metadata once")
+	}
+	if !meta.ChannelAllowed("C2") {
+		t.Error("joined channel should be allowed")
+	}
+	if meta.LeaveChannel("C3") {
+		t.Error("leaving an unknown channel should not change the metadata")
+	}
+
+	integration := &Integration{Provider: "slack"}
+	if err := integration.SetMetadata(meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateIntegrationMetadata("slack", integration.Metadata); err != nil {
+		t.Fatalf("stored metadata should validate: %v", err)
+	}
+	decoded, err := integration.SlackMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.AllowedChannels) != 1 || decoded.AllowedChannels[0] != "C2" {
+		t.Errorf("allowed channels: got %v want [C2]", decoded.AllowedChannels)
+	}
+}
+
+func TestEscalationResolvedWith(t *testing.T) {
+	approved := "approved"
+	tests := []struct {
+		name       string
+		escalation Escalation
+		resolution string
+		want       bool
+	}{
+		{"pending", Escalation{Status: "pending"}, "approved", false},
+		{"same resolution", Escalation{Status: "resolved", Resolution: &approved}, "approved", true},
+		{"different resolution", Escalation{Status: "resolved", Resolution: &approved}, "rejected: wrong", false},
+		{"dismissed", Escalation{Status: "dismissed", Resolution: &approved}, "approved", false},
+		{"no resolution", Escalation{Status: "resolved"}, "", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.escalation.ResolvedWith(tt.resolution); got != tt.want {
+			t.Errorf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveAgentConfig(t *testing.T) {
+	orgThreshold := 80
+	orgAuto := true
+	defaults := &AgentDefaults{
+		ConfidenceThreshold: &orgThreshold,
+		AutoMode:            &orgAuto,
+		ProviderThresholds:  map[string]int{"github": 90},
+		WorkingHours:        json.RawMessage(`{"start": "09:00"}`),
+	}
+	hours := `{"start":"09:00"}`
+	agent := &Agent{
+		ID:                  uuid.New(),
+		Status:              "active",
+		ConfidenceThreshold: 80,
+		ProviderThresholds:  map[string]int{"github": 90, "jira": 60},
+		AutoMode:            false,
+		WorkingHours:        &hours,
+	}
+	integrations := []*Integration{{Provider: "slack", Passive: true}, {Provider: "github"}}
+
+	cfg := ResolveAgentConfig(agent, defaults, integrations, false)
+
+	checks := []struct {
+		name   string
+		got    EffectiveValue
+		value  interface{}
+		source string
+	}{
+		{"status", cfg.Status, "active", ConfigSourceAgent},
+		{"threshold", cfg.ConfidenceThreshold, 80, ConfigSourceOrganization},
+		{"autoMode", cfg.AutoMode, false, ConfigSourceAgent},
+		{"auditSampleRate", cfg.AuditSampleRate, 0.0, ConfigSourceBuiltin},
+		{"slack threshold", cfg.Providers["slack"].ConfidenceThreshold, 80, ConfigSourceOrganization},
+		{"slack passive", cfg.Providers["slack"].Passive, true, ConfigSourceIntegration},
+		{"github threshold", cfg.Providers["github"].ConfidenceThreshold, 90, ConfigSourceOrganization},
+		{"jira threshold", cfg.Providers["jira"].ConfidenceThreshold, 60, ConfigSourceOverride},
+		{"jira passive", cfg.Providers["jira"].Passive, false, ConfigSourceBuiltin},
+	}
+	for _, c := range checks {
+		if c.got.Value != c.value || c.got.Source != c.source {
+			t.Errorf("%s: got %v from %s, want %v from %s", c.name, c.got.Value, c.got.Source, c.value, c.source)
+		}
+	}
+
+	if cfg.WorkingHours.Source != ConfigSourceOrganization {
+		t.Errorf("working hours source: got %s want %s", cfg.WorkingHours.Source, ConfigSourceOrganization)
+	}
+	if cfg.Providers["jira"].Connected || !cfg.Providers["github"].Connected {
+		t.Error("only providers with an integration should be connected")
+	}
+
+	// Without organization defaults the built-in values apply
+	cfg = ResolveAgentConfig(&Agent{Status: "active", ConfidenceThreshold: 70}, nil, nil, true)
+	if cfg.ConfidenceThreshold.Source != ConfigSourceBuiltin || cfg.AutoMode.Source != ConfigSourceBuiltin {
+		t.Errorf("expected built-in sources, got %+v", cfg)
+	}
+	if cfg.Status.Value != "paused" || cfg.Status.Source != ConfigSourceOrganization {
+		t.Errorf("organization pause should override status, got %+v", cfg.Status)
+	}
+}
+
+func TestMatchRoutingRule(t *testing.T) {
+	agentID := uuid.New()
+	otherAgent := uuid.New()
+	github := "github"
+	jira := "jira"
+	comment := "comment"
+
+	catchAll := &EscalationRoutingRule{AssigneeID: uuid.New()}
+	engineers := &EscalationRoutingRule{Provider: &github, AssigneeID: uuid.New()}
+	pms := &EscalationRoutingRule{Provider: &jira, AssigneeID: uuid.New()}
+	comments := &EscalationRoutingRule{InteractionType: &comment, AssigneeID: uuid.New()}
+	githubComments := &EscalationRoutingRule{Provider: &github, InteractionType: &comment, AssigneeID: uuid.New()}
+	agentRule := &EscalationRoutingRule{AgentID: &agentID, AssigneeID: uuid.New()}
+	rules := []*EscalationRoutingRule{catchAll, engineers, pms, comments, githubComments}
+
+	tests := []struct {
+		name            string
+		rules           []*EscalationRoutingRule
+		agentID         uuid.UUID
+		provider        string
+		interactionType string
+		want            *EscalationRoutingRule
+	}{
+		{"provider", rules, agentID, "github", "pull_request", engineers},
+		{"provider and type", rules, agentID, "github", "comment", githubComments},
+		{"provider beats type", rules, agentID, "jira", "comment", pms},
+		{"type", rules, agentID, "slack", "comment", comments},
+		{"catch-all", rules, agentID, "slack", "message", catchAll},
+		{"agent rule", append(rules, agentRule), agentID, "github", "comment", agentRule},
+		{"other agent", append(rules, agentRule), otherAgent, "slack", "message", catchAll},
+		{"no match", []*EscalationRoutingRule{pms}, agentID, "github", "issue", nil},
+		{"earliest on ties", []*EscalationRoutingRule{engineers, {Provider: &github}}, agentID, "github", "issue", engineers},
+	}
+
+	for _, tt := range tests {
+		if got := MatchRoutingRule(tt.rules, tt.agentID, tt.provider, tt.interactionType); got != tt.want {
+			t.Errorf("%s: got %+v want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveInteractionSource(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name        string
+		integration *Integration
+		input       string
+		want        string
+	}{
+		{
+			"slack channel in workspace",
+			&Integration{Provider: "slack", Metadata: strPtr(`{"teamId":"T1","teamName":"Acme"}`)},
+			`{"channel":"C0123","text":"hi"}`,
+			"#C0123 in Acme",
+		},
+		{
+			"slack without team name",
+			&Integration{Provider: "slack", Metadata: strPtr(`{"teamId":"T1"}`)},
+			`{"text":"hi"}`,
+			"T1",
+		},
+		{
+			"github pull request",
+			&Integration{Provider: "github", Metadata: strPtr(`{"login":"acme"}`)},
+			`{"repository":{"full_name":"acme/api"},"pull_request":{"number":42}}`,
+			"acme/api#42 in acme",
+		},
+		{
+			"github issue without metadata",
+			&Integration{Provider: "github"},
+			`{"repository":{"full_name":"acme/api"},"issue":{"number":7}}`,
+			"acme/api#7",
+		},
+		{
+			"jira issue",
+			&Integration{Provider: "jira", Metadata: strPtr(`{"siteUrl":"https://acme.atlassian.net"}`)},
+			`{"issue":{"key":"PROJ-123"}}`,
+			"PROJ-123 in https://acme.atlassian.net",
+		},
+		{
+			"malformed input",
+			&Integration{Provider: "github", Metadata: strPtr(`not json`)},
+			`not json`,
+			"github",
+		},
+	}
+
+	for _, tt := range tests {
+		tt.integration.ID = uuid.New()
+		got := ResolveInteractionSource(&Interaction{InputData: tt.input}, tt.integration)
+		if got.Label != tt.want || got.Deleted || got.IntegrationID == nil || *got.IntegrationID != tt.integration.ID {
+			t.Errorf("%s: got %+v, want label %q", tt.name, got, tt.want)
+		}
+	}
+
+	deleted := DeletedInteractionSource("slack")
+	if !deleted.Deleted || deleted.IntegrationID != nil || deleted.Label != "Deleted slack integration" {
+		t.Errorf("unexpected placeholder %+v", deleted)
+	}
+}
+
+func TestBulkAgentSettings(t *testing.T) {
+	threshold := 55
+	rate := 0.2
+	badRate := 1.5
+	empty := ""
+
+	patch := AgentSettingsPatch{ConfidenceThreshold: &threshold, ProviderThresholds: map[string]int{"jira": 40}, AuditSampleRate: &rate, WorkingHours: &empty}
+	if err := patch.Validate(); err != nil {
+		t.Fatalf("valid patch rejected: %v", err)
+	}
+	if err := (&AgentSettingsPatch{}).Validate(); err == nil {
+		t.Error("empty patch should be rejected")
+	}
+	if err := (&AgentSettingsPatch{AuditSampleRate: &badRate}).Validate(); err == nil {
+		t.Error("out of range audit sample rate should be rejected")
+	}
+
+	hours := `{"start":"09:00"}`
+	active := &Agent{ID: uuid.New(), Status: "active", ConfidenceThreshold: 80, ProviderThresholds: map[string]int{"github": 90}, WorkingHours: &hours}
+	paused := &Agent{ID: uuid.New(), Status: "paused", ConfidenceThreshold: 70}
+	agents := []*Agent{active, paused}
+
+	patch.Apply(active)
+	if active.ConfidenceThreshold != 55 || active.AuditSampleRate != 0.2 || active.WorkingHours != nil {
+		t.Errorf("patch not applied: %+v", active)
+	}
+	if active.ProviderThresholds["github"] != 90 || active.ProviderThresholds["jira"] != 40 {
+		t.Errorf("provider thresholds should be merged, got %v", active.ProviderThresholds)
+	}
+
+	selected, failures := (&AgentSelector{}).SelectAgents(agents)
+	if len(selected) != 2 || len(failures) != 0 {
+		t.Errorf("empty filter: got %d agents, %d failures", len(selected), len(failures))
+	}
+
+	selected, _ = (&AgentSelector{Status: "paused"}).SelectAgents(agents)
+	if len(selected) != 1 || selected[0] != paused {
+		t.Errorf("status filter: got %v", selected)
+	}
+
+	missing := uuid.New()
+	selected, failures = (&AgentSelector{AgentIDs: []uuid.UUID{active.ID, missing, active.ID}}).SelectAgents(agents)
+	if len(selected) != 1 || selected[0] != active {
+		t.Errorf("id filter: got %v", selected)
+	}
+	if len(failures) != 1 || failures[0].AgentID != missing {
+		t.Errorf("expected missing agent failure, got %+v", failures)
+	}
+}
+
+func TestTrainingRecordReader(t *testing.T) {
+	read := func(input, format string) (records []*TrainingImportRecord, bad []int) {
+		t.Helper()
+		reader, err := NewTrainingRecordReader(strings.NewReader(input), format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for {
+			rec, _, err := reader.Next()
+			if err == io.EOF {
+				return records, bad
+			}
+			var recordErr *TrainingRecordError
+			if errors.As(err, &recordErr) {
+				bad = append(bad, recordErr.Line)
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			records = append(records, rec)
+		}
+	}
+
+	ndjson := `{"sampleType":"message","inputText":"hi","outputText":"hello"}
+
+not json
+{"sampleType":"response","inputText":"diff","isPositive":false}
+`
+	records, bad := read(ndjson, TrainingFormatNDJSON)
+	if len(records) != 2 || len(bad) != 1 || bad[0] != 3 {
+		t.Fatalf("ndjson: got %d records, bad lines %v", len(records), bad)
+	}
+	if records[1].IsPositive == nil || *records[1].IsPositive {
+		t.Errorf("ndjson: isPositive not read: %+v", records[1])
+	}
+
+	csvInput := "sampleType,inputText,outputText,isPositive\n" +
+		"message,\"multi\nline\",reply,true\n" +
+		"message,text,,maybe\n" +
+		"response,diff,,\n"
+	records, bad = read(csvInput, TrainingFormatCSV)
+	if len(records) != 2 || len(bad) != 1 || bad[0] != 4 {
+		t.Fatalf("csv: got %d records, bad lines %v", len(records), bad)
+	}
+	if records[0].InputText != "multi\nline" || records[0].OutputText == nil || *records[0].OutputText != "reply" {
+		t.Errorf("csv: got %+v", records[0])
+	}
+	if records[1].OutputText != nil || records[1].IsPositive != nil {
+		t.Errorf("csv: empty columns should be unset, got %+v", records[1])
+	}
+
+	if _, err := NewTrainingRecordReader(strings.NewReader("inputText\nx\n"), TrainingFormatCSV); err == nil {
+		t.Error("csv without sampleType column should be rejected")
+	}
+
+	sample, err := records[1].Sample(uuid.New(), "import:test", 100, 100)
+	if err != nil || !sample.IsPositive || *sample.Source != "import:test" {
+		t.Errorf("sample: %+v, %v", sample, err)
+	}
+	if _, err := (&TrainingImportRecord{SampleType: "bogus", InputText: "x"}).Sample(uuid.New(), "import:test", 100, 100); err == nil {
+		t.Error("invalid sample type should be rejected")
+	}
+
+	if TrainingFormatFor("", "data.jsonl") != TrainingFormatNDJSON || TrainingFormatFor("CSV", "data.txt") != TrainingFormatCSV || TrainingFormatFor("", "data.txt") != "" {
+		t.Error("unexpected format detection")
+	}
+}
+
+func TestWebhookPayloadSchemas(t *testing.T) {
+	parse := func(body string) map[string]interface{} {
+		t.Helper()
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &payload); err != nil {
+			t.Fatal(err)
+		}
+		return payload
+	}
+
+	slack := []struct {
+		body string
+		ok   bool
+	}{
+		{`{"type":"url_verification","challenge":"abc"}`, true},
+		{`{"type":"event_callback","team_id":"T1","event":{"type":"message","channel":"C1","text":"hi","new_field":[1]}}`, true},
+		{`{"type":"app_rate_limited"}`, true}, // Unknown envelopes pass through
+		{`{}`, false},
+		{`{"type":42}`, false},
+		{`{"type":"url_verification"}`, false},
+		{`{"type":"url_verification","challenge":{"x":1}}`, false},
+		{`{"type":"event_callback"}`, false},
+		{`{"type":"event_callback","event":"message"}`, false},
+		{`{"type":"event_callback","event":{}}`, false},
+		{`{"type":"event_callback","event":{"type":["message"]}}`, false},
+		{`{"type":"event_callback","team_id":7,"event":{"type":"message"}}`, false},
+		{`{"type":"event_callback","event":{"type":"message","channel":{"id":"C1"}}}`, false},
+		{`{"type":"event_callback","event":{"type":"channel_left"}}`, false},
+	}
+	for _, tt := range slack {
+		envelope, err := ParseSlackEnvelope(parse(tt.body))
+		if (err == nil) != tt.ok {
+			t.Errorf("slack %s: got error %v", tt.body, err)
+		}
+		if err == nil && envelope.Type == "event_callback" && envelope.EventType != "message" {
+			t.Errorf("slack %s: event type %q", tt.body, envelope.EventType)
+		}
+	}
+
+	github := []struct {
+		eventType, body string
+		ok              bool
+	}{
+		{"pull_request", `{"action":"opened","repository":{"owner":{"login":"acme"}},"pull_request":{"number":1}}`, true},
+		{"push", `{"ref":5}`, true}, // Unhandled events are not checked
+		{"pull_request", `{"repository":{},"pull_request":{}}`, false},
+		{"pull_request", `{"action":"opened","pull_request":{}}`, false},
+		{"pull_request", `{"action":"opened","repository":"acme/api","pull_request":{}}`, false},
+		{"pull_request", `{"action":"opened","repository":{"owner":"acme"},"pull_request":{}}`, false},
+		{"pull_request", `{"action":"opened","repository":{},"sender":"bot","pull_request":{}}`, false},
+		{"issue_comment", `{"action":"created","repository":{},"issue":{}}`, false},
+	}
+	for _, tt := range github {
+		if err := CheckGitHubPayload(tt.eventType, parse(tt.body)); (err == nil) != tt.ok {
+			t.Errorf("github %s %s: got error %v", tt.eventType, tt.body, err)
+		}
+	}
+
+	jira := []struct {
+		body string
+		ok   bool
+	}{
+		{`{"webhookEvent":"jira:issue_created","issue":{"key":"PROJ-1"}}`, true},
+		{`{"webhookEvent":"worklog_created"}`, true},
+		{`{}`, false},
+		{`{"webhookEvent":null}`, false},
+		{`{"webhookEvent":1}`, false},
+		{`{"webhookEvent":"comment_created","comment":"text"}`, false},
+	}
+	for _, tt := range jira {
+		if _, err := ParseJiraEvent(parse(tt.body)); (err == nil) != tt.ok {
+			t.Errorf("jira %s: got error %v", tt.body, err)
+		}
+	}
+}
+
+func TestSignupPolicy(t *testing.T) {
+	policy := &SignupPolicy{
+		Blocked:    []string{"spam.example"},
+		Disposable: []string{"mailinator.com"},
+	}
+	tests := []struct {
+		email, want string
+	}{
+		{"ada@example.com", ""},
+		{"ada@Example.COM", ""},
+		{"ada", SignupEmailInvalid},
+		{"@example.com", SignupEmailInvalid},
+		{"ada@localhost", SignupEmailInvalid},
+		{"ada@spam.example", SignupDomainBlocked},
+		{"ada@mx.spam.example", SignupDomainBlocked},
+		{"ada@notspam.example", ""},
+		{"ada@MAILINATOR.com", SignupDisposableEmail},
+	}
+	for _, tt := range tests {
+		if got := policy.Check(tt.email); got != tt.want {
+			t.Errorf("Check(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+
+	policy.Allowed = []string{"acme.com"}
+	if got := policy.Check("ada@eng.acme.com"); got != "" {
+		t.Errorf("allowed subdomain rejected: %q", got)
+	}
+	if got := policy.Check("ada@example.com"); got != SignupDomainNotAllowed {
+		t.Errorf("unlisted domain = %q, want %q", got, SignupDomainNotAllowed)
+	}
+}
+
+func TestIntegrationIsOwnEvent(t *testing.T) {
+	slackMeta := `{"teamId":"T1","botUserId":"UBOT","appId":"A1"}`
+	slack := &Integration{Provider: "slack", Metadata: &slackMeta}
+	githubMeta := `{"login":"acme","botLogin":"vibber[bot]"}`
+	github := &Integration{Provider: "github", Metadata: &githubMeta}
+	bare := &Integration{Provider: "slack"}
+
+	tests := []struct {
+		name        string
+		integration *Integration
+		payload     string
+		want        bool
+	}{
+		{"slack own user", slack, `{"user":"UBOT","bot_id":"B1"}`, true},
+		{"slack own app", slack, `{"bot_id":"B1","app_id":"A1"}`, true},
+		{"slack own bot profile", slack, `{"bot_id":"B1","bot_profile":{"app_id":"A1"}}`, true},
+		{"slack other bot", slack, `{"bot_id":"B2","app_id":"A2"}`, false},
+		{"slack human", slack, `{"user":"U1"}`, false},
+		{"slack unknown identity", bare, `{"user":""}`, false},
+		{"github own app", github, `{"sender":{"login":"Vibber[bot]","type":"Bot"}}`, true},
+		{"github owner account", github, `{"sender":{"login":"acme","type":"User"}}`, false},
+	}
+	for _, tt := range tests {
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.payload), &payload); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := tt.integration.IsOwnEvent(payload); got != tt.want {
+			t.Errorf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRedactForTraining(t *testing.T) {
+	in := `{"text":"ping ada@example.com","user":{"email":"ada@example.com","name":"Ada"},"access_token":"xoxb-1","items":[{"api_key":"k"}]}`
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(RedactForTraining(in)), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["text"] != "ping [redacted]" {
+		t.Errorf("text = %v", got["text"])
+	}
+	user := got["user"].(map[string]interface{})
+	if user["email"] != "[redacted]" || user["name"] != "Ada" {
+		t.Errorf("user = %v", user)
+	}
+	if got["access_token"] != "[redacted]" {
+		t.Errorf("access_token = %v", got["access_token"])
+	}
+	if item := got["items"].([]interface{})[0].(map[string]interface{}); item["api_key"] != "[redacted]" {
+		t.Errorf("items = %v", got["items"])
+	}
+
+	if plain := RedactForTraining("mail bob@example.org please"); plain != "mail [redacted] please" {
+		t.Errorf("plain text = %q", plain)
+	}
+}
+
+func TestUpdateOrganizationRequest(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	for _, req := range []UpdateOrganizationRequest{
+		{},
+		{Name: str("  ")},
+		{Settings: &OrganizationSettings{BillingEmail: str("not an email")}},
+		{Settings: &OrganizationSettings{BillingEmail: str("Billing <billing@example.com>")}},
+		{Settings: &OrganizationSettings{Timezone: str("Mars/Olympus_Mons")}},
+	} {
+		if err := req.Validate(); err == nil {
+			t.Errorf("%+v: expected a validation error", req)
+		}
+	}
+
+	digest := true
+	org := &Organization{Name: "Acme", Settings: OrganizationSettings{
+		BillingEmail: str("old@example.com"),
+		Timezone:     str("UTC"),
+	}}
+	req := UpdateOrganizationRequest{Settings: &OrganizationSettings{
+		BillingEmail: str(""),
+		WeeklyDigest: &digest,
+	}}
+	if err := req.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	req.Apply(org)
+	if org.Name != "Acme" || org.Settings.BillingEmail != nil || org.Settings.Timezone == nil || *org.Settings.Timezone != "UTC" || org.Settings.WeeklyDigest == nil || !*org.Settings.WeeklyDigest {
+		t.Errorf("settings-only patch: got %+v", org)
+	}
+
+	req = UpdateOrganizationRequest{Name: str(" Acme Corp ")}
+	if err := req.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	req.Apply(org)
+	if org.Name != "Acme Corp" || org.Settings.Timezone == nil {
+		t.Errorf("name-only patch: got %+v", org)
+	}
+}
+
+func TestTrainingBreakdownAndPersona(t *testing.T) {
+	b := NewTrainingBreakdown()
+	b.Add("response", "slack", "interaction:1234", true, 3)
+	b.Add("response", "slack", "import:job", true, 5)
+	b.Add("negative", "", "", false, 2)
+
+	if b.Total != 10 || b.Positive != 8 || b.Negative != 2 {
+		t.Errorf("totals: got %+v", b)
+	}
+	if b.ByType["response"] != 8 || b.ByProvider["slack"] != 8 || b.ByProvider["none"] != 2 {
+		t.Errorf("type/provider: got %v %v", b.ByType, b.ByProvider)
+	}
+	if b.BySource["interaction"] != 3 || b.BySource["import"] != 5 || b.BySource["none"] != 2 {
+		t.Errorf("source: got %v", b.BySource)
+	}
+
+	description := "Answers infrastructure questions."
+	agent := &Agent{Name: "Ada", Description: &description, ConfidenceThreshold: 80, ProviderThresholds: map[string]int{"github": 90}}
+	prompt := ReconstructPersonaPrompt(agent, b)
+	for _, want := range []string{"You are Ada", description, "10 training samples", "slack (8)", "at least 80%", "github 90%", "for approval"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestComputeEscalationPriority(t *testing.T) {
+	agentID, otherAgent := uuid.New(), uuid.New()
+	github, keyword, minGap := "github", "Outage", 20
+	rules := []*EscalationPriorityRule{
+		{ID: uuid.New(), Provider: &github, Weight: 10},
+		{ID: uuid.New(), Keyword: &keyword, Weight: 30},
+		{ID: uuid.New(), MinGap: &minGap, Weight: 5},
+		{ID: uuid.New(), AgentID: &otherAgent, Weight: 50},
+	}
+
+	// Without rules the gap alone decides
+	for _, tt := range []struct {
+		confidence int
+		want       string
+	}{
+		{65, "low"},
+		{60, "medium"},
+		{40, "high"},
+		{10, "urgent"},
+	} {
+		if got := ComputeEscalationPriority(tt.confidence, 70, agentID, "slack", "", nil); got.Priority != tt.want || len(got.Factors) != 1 {
+			t.Errorf("no rules, confidence %d: got %+v want %s", tt.confidence, got, tt.want)
+		}
+	}
+
+	got := ComputeEscalationPriority(60, 70, agentID, "github", `{"text":"Prod OUTAGE in eu-west"}`, rules)
+	if got.Score != 50 || got.Priority != "urgent" {
+		t.Errorf("got score %d priority %s, want 50 urgent", got.Score, got.Priority)
+	}
+	if len(got.Factors) != 3 || got.Factors[0].Factor != PriorityFactorConfidenceGap || *got.Factors[2].RuleID != rules[1].ID {
+		t.Errorf("factors: got %+v", got.Factors)
+	}
+
+	got = ComputeEscalationPriority(40, 70, agentID, "slack", "", rules)
+	if got.Score != 35 || got.Priority != "high" {
+		t.Errorf("min gap: got score %d priority %s, want 35 high", got.Score, got.Priority)
+	}
+
+	if err := (&PriorityRuleRequest{Weight: 0}).Validate(); err == nil {
+		t.Error("a zero weight should be rejected")
+	}
+}
+
+func TestMaintenanceWindowActiveAt(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data unavailable")
+	}
+	// 02:00-04:00 Berlin time, starting the Friday before DST begins
+	start := time.Date(2024, 3, 29, 2, 0, 0, 0, berlin)
+	window := &MaintenanceWindow{
+		StartsAt:   start,
+		EndsAt:     start.Add(2 * time.Hour),
+		Timezone:   "Europe/Berlin",
+		Recurrence: RecurrenceNone,
+	}
+
+	if !window.ActiveAt(start.Add(time.Hour)) || window.ActiveAt(start.Add(2*time.Hour)) || window.ActiveAt(start.Add(-time.Minute)) {
+		t.Error("one-off window: wrong active state around its bounds")
+	}
+	if window.ActiveAt(start.AddDate(0, 0, 1).Add(time.Hour)) {
+		t.Error("one-off window should not recur")
+	}
+
+	window.Recurrence = RecurrenceDaily
+	// After the switch to summer time the window still opens at 02:00 local
+	afterDST := time.Date(2024, 4, 2, 2, 30, 0, 0, berlin)
+	if !window.ActiveAt(afterDST) {
+		t.Error("daily window should keep its wall-clock time across DST")
+	}
+	if window.ActiveAt(time.Date(2024, 4, 2, 4, 30, 0, 0, berlin)) {
+		t.Error("daily window should close at 04:00 local")
+	}
+	if window.ActiveAt(start.Add(-23 * time.Hour)) {
+		t.Error("no occurrence before the first")
+	}
+
+	window.Recurrence = RecurrenceWeekly
+	if !window.ActiveAt(time.Date(2024, 4, 12, 3, 0, 0, 0, berlin)) || window.ActiveAt(afterDST) {
+		t.Error("weekly window: wrong active state")
+	}
+
+	active := ActiveMaintenanceWindow([]*MaintenanceWindow{window}, time.Date(2024, 4, 5, 2, 15, 0, 0, berlin))
+	if active == nil || !active.EndsAt.Equal(time.Date(2024, 4, 5, 4, 0, 0, 0, berlin)) {
+		t.Errorf("active occurrence: got %+v", active)
+	}
+
+	req := &MaintenanceWindowRequest{Name: "nightly", StartsAt: start, EndsAt: start.Add(25 * time.Hour), Recurrence: RecurrenceDaily}
+	if err := req.Validate(); err == nil {
+		t.Error("a daily window longer than a day should be rejected")
+	}
+	req.EndsAt = start.Add(time.Hour)
+	if err := req.Validate(); err != nil || req.Timezone != "UTC" || req.OnEnd != MaintenanceRelease {
+		t.Errorf("defaults: got %+v, %v", req, err)
+	}
+}
+
+func TestTagRequestValidate(t *testing.T) {
+	req := &TagRequest{Name: "  Good   Example "}
+	if err := req.Validate(); err != nil || req.Name != "good example" {
+		t.Errorf("got %q, %v; want normalized name", req.Name, err)
+	}
+
+	color := "#FF8800"
+	if err := (&TagRequest{Name: "spam", Color: &color}).Validate(); err != nil {
+		t.Errorf("valid color rejected: %v", err)
+	}
+
+	bad := "orange"
+	for _, req := range []*TagRequest{
+		{Name: "   "},
+		{Name: strings.Repeat("x", 51)},
+		{Name: "spam", Color: &bad},
+	} {
+		if err := req.Validate(); err == nil {
+			t.Errorf("%+v should be rejected", req)
+		}
+	}
+}
+
+func TestSessionMatchesDevice(t *testing.T) {
+	const ua = "Mozilla/5.0 (iPhone)"
+	session := NewSession(uuid.New(), ua, "phone-1", time.Now().Add(time.Hour))
+
+	if !session.MatchesDevice(ua, "phone-1") {
+		t.Error("same device should match")
+	}
+	if session.MatchesDevice(ua, "laptop-1") || session.MatchesDevice(ua, "") {
+		t.Error("another device ID should not match")
+	}
+	if session.MatchesDevice("Mozilla/5.0 (Macintosh)", "phone-1") {
+		t.Error("another user agent should not match")
+	}
+	if DeviceFingerprint("ab", "c") == DeviceFingerprint("a", "bc") {
+		t.Error("fingerprints of different pairs should differ")
+	}
+
+	// Sessions started without a device ID are bound by user agent alone
+	anonymous := NewSession(uuid.New(), ua, "", time.Now().Add(time.Hour))
+	if !anonymous.MatchesDevice(ua, "phone-1") || anonymous.MatchesDevice("curl/8.0", "") {
+		t.Error("user agent binding: wrong match")
+	}
+
+	now := time.Now()
+	session.RevokedAt = &now
+	if session.Active(now) || !anonymous.Active(now) || anonymous.Active(now.Add(2*time.Hour)) {
+		t.Error("wrong active state")
+	}
+}
+
+func TestExplainInteraction(t *testing.T) {
+	agent := &Agent{ID: uuid.New(), ConfidenceThreshold: 80, ProviderThresholds: map[string]int{"github": 90}, AutoMode: true}
+	confidence := 85
+	interaction := &Interaction{ID: uuid.New(), Provider: "slack", Status: "completed", ConfidenceScore: &confidence}
+
+	got := ExplainInteraction(interaction, agent, time.Now())
+	if got.Threshold != 80 || got.ThresholdScope != "agent" || !got.Checks[0].Passed || got.ConsideredEscalation {
+		t.Errorf("slack: got %+v", got)
+	}
+
+	interaction.Provider = "github"
+	got = ExplainInteraction(interaction, agent, time.Now())
+	if got.Threshold != 90 || got.ThresholdScope != "provider" || got.Checks[0].Passed || !got.ConsideredEscalation {
+		t.Errorf("github override: got %+v", got)
+	}
+
+	interaction.ConfidenceScore = nil
+	got = ExplainInteraction(interaction, agent, time.Now())
+	if got.Checks[0].Passed || got.ConsideredEscalation {
+		t.Errorf("no confidence: got %+v", got)
+	}
+}
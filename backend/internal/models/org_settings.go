@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// OrganizationSettings are an organization's preferences, stored in the
+// organizations.settings column. Nil fields are unset.
+type OrganizationSettings struct {
+	BillingEmail *string `json:"billingEmail,omitempty"` // Receives invoices and plan notices
+	Timezone     *string `json:"timezone,omitempty"`     // IANA name used for reports and digests
+	WeeklyDigest *bool   `json:"weeklyDigest,omitempty"` // Email admins a weekly agent summary
+}
+
+// UpdateOrganizationRequest is a partial update: omitted fields are left
+// unchanged, and an empty string clears a settings field
+type UpdateOrganizationRequest struct {
+	Name     *string               `json:"name"`
+	Settings *OrganizationSettings `json:"settings"`
+}
+
+// Validate checks the provided fields
+func (req *UpdateOrganizationRequest) Validate() error {
+	if req.Name == nil && req.Settings == nil {
+		return fmt.Errorf("no fields to update")
+	}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return fmt.Errorf("name must not be empty")
+		}
+		if len(name) > 255 {
+			return fmt.Errorf("name must be at most 255 characters")
+		}
+	}
+	if s := req.Settings; s != nil {
+		if s.BillingEmail != nil && *s.BillingEmail != "" {
+			if addr, err := mail.ParseAddress(*s.BillingEmail); err != nil || addr.Address != *s.BillingEmail {
+				return fmt.Errorf("settings.billingEmail must be an email address")
+			}
+		}
+		if s.Timezone != nil && *s.Timezone != "" {
+			if _, err := time.LoadLocation(*s.Timezone); err != nil {
+				return fmt.Errorf("settings.timezone must be an IANA time zone")
+			}
+		}
+	}
+	return nil
+}
+
+// Apply copies the provided fields onto org
+func (req *UpdateOrganizationRequest) Apply(org *Organization) {
+	if req.Name != nil {
+		org.Name = strings.TrimSpace(*req.Name)
+	}
+	if s := req.Settings; s != nil {
+		if s.BillingEmail != nil {
+			org.Settings.BillingEmail = emptyToNil(*s.BillingEmail)
+		}
+		if s.Timezone != nil {
+			org.Settings.Timezone = emptyToNil(*s.Timezone)
+		}
+		if s.WeeklyDigest != nil {
+			org.Settings.WeeklyDigest = s.WeeklyDigest
+		}
+	}
+}
+
+func emptyToNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
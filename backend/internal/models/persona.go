@@ -0,0 +1,116 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Where an AgentPersona's prompt came from
+const (
+	PersonaSourceAIService     = "ai_service"    // Assembled by the AI service
+	PersonaSourceReconstructed = "reconstructed" // Rebuilt from stored settings when the AI service could not be asked
+)
+
+// AgentPersona is a read-only view of the persona an agent acts with
+type AgentPersona struct {
+	AgentID      uuid.UUID          `json:"agentId"`
+	Source       string             `json:"source"`
+	SystemPrompt string             `json:"systemPrompt"`
+	Training     *TrainingBreakdown `json:"training"`
+	GeneratedAt  time.Time          `json:"generatedAt"`
+}
+
+// TrainingBreakdown counts an agent's training samples
+type TrainingBreakdown struct {
+	Total      int            `json:"total"`
+	Positive   int            `json:"positive"`
+	Negative   int            `json:"negative"`
+	ByType     map[string]int `json:"byType"`
+	ByProvider map[string]int `json:"byProvider"` // Samples without a provider are counted under "none"
+	BySource   map[string]int `json:"bySource"`   // Source kind, e.g. feedback, import or interaction
+}
+
+func NewTrainingBreakdown() *TrainingBreakdown {
+	return &TrainingBreakdown{
+		ByType:     map[string]int{},
+		ByProvider: map[string]int{},
+		BySource:   map[string]int{},
+	}
+}
+
+// Add counts n samples. source is cut at the first colon, so
+// "import:<job>" counts as "import".
+func (b *TrainingBreakdown) Add(sampleType, provider, source string, positive bool, n int) {
+	if provider == "" {
+		provider = "none"
+	}
+	if kind, _, _ := strings.Cut(source, ":"); kind != "" {
+		source = kind
+	} else {
+		source = "none"
+	}
+
+	b.Total += n
+	if positive {
+		b.Positive += n
+	} else {
+		b.Negative += n
+	}
+	b.ByType[sampleType] += n
+	b.ByProvider[provider] += n
+	b.BySource[source] += n
+}
+
+// ReconstructPersonaPrompt describes the persona the processing pipeline
+// gives an agent from its stored settings and training, for when the AI
+// service's own prompt is unavailable
+func ReconstructPersonaPrompt(agent *Agent, training *TrainingBreakdown) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "You are %s, an AI clone acting on behalf of your owner.", agent.Name)
+	if agent.Description != nil && *agent.Description != "" {
+		fmt.Fprintf(&b, " %s", strings.TrimSpace(*agent.Description))
+	}
+
+	b.WriteString("\n\nMatch your owner's tone, vocabulary and judgement")
+	if training.Total > 0 {
+		fmt.Fprintf(&b, ", learned from %d training samples (%d positive, %d negative)", training.Total, training.Positive, training.Negative)
+		if providers := sortedCounts(training.ByProvider, "%s (%d)"); len(providers) > 0 {
+			fmt.Fprintf(&b, " across %s", strings.Join(providers, ", "))
+		}
+	}
+	b.WriteString(".")
+
+	fmt.Fprintf(&b, "\n\nAct on your own only when your confidence is at least %d%%", agent.ConfidenceThreshold)
+	if overrides := sortedCounts(agent.ProviderThresholds, "%s %d%%"); len(overrides) > 0 {
+		fmt.Fprintf(&b, " (per provider: %s)", strings.Join(overrides, ", "))
+	}
+	b.WriteString("; otherwise escalate to your owner.")
+	if !agent.AutoMode {
+		b.WriteString(" Propose actions for approval instead of taking them.")
+	}
+	return b.String()
+}
+
+// sortedCounts formats each key and value of m with format, largest value first
+func sortedCounts(m map[string]int, format string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = fmt.Sprintf(format, k, m[k])
+	}
+	return out
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EscalationPriorityRule adds Weight to the priority score of new
+// escalations it matches. Nil criteria match anything.
+type EscalationPriorityRule struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	OrgID     uuid.UUID  `json:"orgId" db:"org_id"`
+	AgentID   *uuid.UUID `json:"agentId" db:"agent_id"`
+	Provider  *string    `json:"provider" db:"provider"`
+	Keyword   *string    `json:"keyword" db:"keyword"` // Case-insensitive match in the interaction input
+	MinGap    *int       `json:"minGap" db:"min_gap"`  // Confidence points below the threshold
+	Weight    int        `json:"weight" db:"weight"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// Matches reports whether the rule applies to an escalation. input is
+// expected in lower case.
+func (r *EscalationPriorityRule) Matches(agentID uuid.UUID, provider, input string, gap int) bool {
+	return (r.AgentID == nil || *r.AgentID == agentID) &&
+		(r.Provider == nil || *r.Provider == provider) &&
+		(r.Keyword == nil || strings.Contains(input, strings.ToLower(*r.Keyword))) &&
+		(r.MinGap == nil || gap >= *r.MinGap)
+}
+
+// PriorityRuleRequest creates or replaces an escalation priority rule
+type PriorityRuleRequest struct {
+	AgentID  *uuid.UUID `json:"agentId"`
+	Provider *string    `json:"provider"`
+	Keyword  *string    `json:"keyword"`
+	MinGap   *int       `json:"minGap"`
+	Weight   int        `json:"weight"`
+}
+
+// Validate checks the weight and criteria are in range
+func (r *PriorityRuleRequest) Validate() error {
+	if r.Weight == 0 || r.Weight < -100 || r.Weight > 100 {
+		return fmt.Errorf("weight must be between -100 and 100 and not 0")
+	}
+	if r.Provider != nil && *r.Provider == "" {
+		return fmt.Errorf("provider must not be empty")
+	}
+	if r.Keyword != nil && (strings.TrimSpace(*r.Keyword) == "" || len(*r.Keyword) > 100) {
+		return fmt.Errorf("keyword must be between 1 and 100 characters")
+	}
+	if r.MinGap != nil && (*r.MinGap < 0 || *r.MinGap > 100) {
+		return fmt.Errorf("minGap must be between 0 and 100")
+	}
+	return nil
+}
+
+// Priority factors recorded in an escalation's context
+const (
+	PriorityFactorConfidenceGap = "confidence_gap"
+	PriorityFactorRule          = "rule"
+)
+
+// PriorityFactor is one contribution to an escalation's priority score
+type PriorityFactor struct {
+	Factor string     `json:"factor"`
+	RuleID *uuid.UUID `json:"ruleId,omitempty"`
+	Points int        `json:"points"`
+	Detail string     `json:"detail"`
+}
+
+// PriorityResult is a computed escalation priority and how it was reached
+type PriorityResult struct {
+	Priority string           `json:"priority"`
+	Score    int              `json:"score"`
+	Factors  []PriorityFactor `json:"factors"`
+}
+
+// ComputeEscalationPriority scores a low-confidence escalation: the points
+// confidence fell below the threshold, plus the weight of every matching
+// rule. The score maps to a priority by priorityForScore.
+func ComputeEscalationPriority(confidence, threshold int, agentID uuid.UUID, provider, input string, rules []*EscalationPriorityRule) *PriorityResult {
+	gap := threshold - confidence
+	result := &PriorityResult{
+		Score: gap,
+		Factors: []PriorityFactor{{
+			Factor: PriorityFactorConfidenceGap,
+			Points: gap,
+			Detail: fmt.Sprintf("Confidence %d below threshold %d", confidence, threshold),
+		}},
+	}
+
+	input = strings.ToLower(input)
+	for _, rule := range rules {
+		if !rule.Matches(agentID, provider, input, gap) {
+			continue
+		}
+		result.Score += rule.Weight
+		result.Factors = append(result.Factors, PriorityFactor{
+			Factor: PriorityFactorRule,
+			RuleID: &rule.ID,
+			Points: rule.Weight,
+			Detail: rule.describe(),
+		})
+	}
+	result.Priority = priorityForScore(result.Score)
+	return result
+}
+
+// priorityForScore maps a priority score, starting from the confidence gap,
+// to a priority
+func priorityForScore(score int) string {
+	switch {
+	case score >= 40:
+		return "urgent"
+	case score >= 25:
+		return "high"
+	case score >= 10:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// describe lists the rule's criteria
+func (r *EscalationPriorityRule) describe() string {
+	var criteria []string
+	if r.AgentID != nil {
+		criteria = append(criteria, "agent "+r.AgentID.String())
+	}
+	if r.Provider != nil {
+		criteria = append(criteria, "provider "+*r.Provider)
+	}
+	if r.Keyword != nil {
+		criteria = append(criteria, fmt.Sprintf("keyword %q", *r.Keyword))
+	}
+	if r.MinGap != nil {
+		criteria = append(criteria, fmt.Sprintf("gap at least %d", *r.MinGap))
+	}
+	if len(criteria) == 0 {
+		return "every escalation"
+	}
+	return strings.Join(criteria, ", ")
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// trainingRedactedKeys flag JSON object keys whose values are withheld from
+// training exports: credentials and personal contact details
+var trainingRedactedKeys = []string{"token", "secret", "password", "api_key", "apikey", "credential", "authorization", "email", "phone"}
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+const redacted = "[redacted]"
+
+// RedactForTraining strips secrets and personal data from interaction data
+// before it leaves for model training. In JSON, values under flagged keys
+// are replaced; email addresses are masked everywhere, including free text.
+func RedactForTraining(s string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return emailPattern.ReplaceAllString(s, redacted)
+	}
+	data, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return redacted
+	}
+	return string(data)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if redactedKey(key) {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactValue(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+		return v
+	case string:
+		return emailPattern.ReplaceAllString(v, redacted)
+	}
+	return v
+}
+
+func redactedKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, flagged := range trainingRedactedKeys {
+		if strings.Contains(key, flagged) {
+			return true
+		}
+	}
+	return false
+}
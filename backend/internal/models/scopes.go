@@ -0,0 +1,144 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// requiredScopes lists the OAuth scopes an integration needs, per provider and
+// interaction type, before the agent can act on that interaction
+var requiredScopes = map[string]map[string][]string{
+	"slack": {
+		"message": {"channels:history", "chat:write"},
+		"mention": {"channels:history", "chat:write"},
+	},
+	"github": {
+		"pull_request": {"repo"},
+		"pr_review":    {"repo"},
+		"comment":      {"repo"},
+		"issue":        {"repo"},
+	},
+	"jira": {
+		"issue_created": {"read:jira-work", "write:jira-work"},
+		"issue_updated": {"read:jira-work", "write:jira-work"},
+		"comment":       {"read:jira-work", "write:jira-work"},
+	},
+}
+
+// passiveRequiredScopes replaces requiredScopes for passive integrations,
+// which react to messages instead of replying
+var passiveRequiredScopes = map[string]map[string][]string{
+	"slack": {
+		"message": {"channels:history", "reactions:write"},
+		"mention": {"channels:history", "reactions:write"},
+	},
+}
+
+// passiveScopes lists every scope a passive integration may hold. None of
+// them allow posting messages.
+var passiveScopes = map[string][]string{
+	"slack": {"channels:history", "channels:read", "groups:history", "im:history", "reactions:read", "reactions:write", "team:read", "users:read"},
+}
+
+// SupportsPassive reports whether a provider can run in passive mode
+func SupportsPassive(provider string) bool {
+	_, ok := passiveScopes[provider]
+	return ok
+}
+
+// PassiveScopes returns the scopes a passive integration may hold
+func PassiveScopes(provider string) []string {
+	return passiveScopes[provider]
+}
+
+// NonPassiveScopes returns the granted scopes a passive integration must
+// not hold, such as chat:write
+func NonPassiveScopes(provider string, granted []string) []string {
+	return MissingScopes(passiveScopes[provider], granted)
+}
+
+// RequiredScopes returns the scopes needed for an interaction type. An empty
+// interactionType returns every scope the provider needs for any interaction.
+func RequiredScopes(provider, interactionType string) []string {
+	return scopesFor(requiredScopes[provider], interactionType)
+}
+
+// RequiredScopesFor returns the scopes an integration needs for an
+// interaction type, taking passive mode into account
+func RequiredScopesFor(integration *Integration, interactionType string) []string {
+	if integration.Passive && SupportsPassive(integration.Provider) {
+		return scopesFor(passiveRequiredScopes[integration.Provider], interactionType)
+	}
+	return RequiredScopes(integration.Provider, interactionType)
+}
+
+func scopesFor(byType map[string][]string, interactionType string) []string {
+	if interactionType != "" {
+		return byType[interactionType]
+	}
+
+	seen := make(map[string]bool)
+	scopes := make([]string, 0)
+	for _, t := range InteractionTypes {
+		for _, scope := range byType[t] {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+// MissingScopes returns the required scopes that were not granted
+func MissingScopes(granted, required []string) []string {
+	have := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		have[scope] = true
+	}
+
+	missing := make([]string, 0)
+	for _, scope := range required {
+		if !have[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// incrementalAuthProviders let an integration gain scopes by sending the user
+// through the authorize flow again, keeping the integration and its history
+var incrementalAuthProviders = map[string]bool{
+	"github": true,
+}
+
+// SupportsIncrementalAuth reports whether a provider's integrations can have
+// scopes added without reconnecting
+func SupportsIncrementalAuth(provider string) bool {
+	return incrementalAuthProviders[provider]
+}
+
+// UnionScopes returns granted followed by the requested scopes not already in it
+func UnionScopes(granted, requested []string) []string {
+	union := append([]string{}, granted...)
+	return append(union, MissingScopes(granted, requested)...)
+}
+
+var scopeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_.:-]*$`)
+
+// ScopeUpgradeRequest asks for scopes to be added to an integration
+type ScopeUpgradeRequest struct {
+	Scopes []string `json:"scopes"`
+}
+
+func (r *ScopeUpgradeRequest) Validate() error {
+	if len(r.Scopes) == 0 {
+		return fmt.Errorf("scopes is required")
+	}
+	for _, scope := range r.Scopes {
+		if !scopeNamePattern.MatchString(scope) {
+			return fmt.Errorf("invalid scope: %q", scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeviceIDHeader carries the client's device ID on login and refresh
+const DeviceIDHeader = "X-Device-ID"
+
+// Bounds on what a client's request is recorded with
+const (
+	maxDeviceIDLength  = 128
+	maxUserAgentLength = 512 // Only bounds what is stored for display
+)
+
+// Session is a login on one device. Refresh tokens are bound to a session
+// and only honored from the device that started it.
+type Session struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"-" db:"user_id"`
+	DeviceID    string     `json:"deviceId" db:"device_id"`
+	Fingerprint string     `json:"-" db:"fingerprint"`
+	UserAgent   string     `json:"userAgent" db:"user_agent"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	LastUsedAt  time.Time  `json:"lastUsedAt" db:"last_used_at"`
+	ExpiresAt   time.Time  `json:"expiresAt" db:"expires_at"`
+	RevokedAt   *time.Time `json:"-" db:"revoked_at"`
+	Current     bool       `json:"current"` // Set when listing, for the requester's own session
+}
+
+// NewSession starts a session for the device identified by userAgent and
+// deviceID, expiring at expiresAt
+func NewSession(userID uuid.UUID, userAgent, deviceID string, expiresAt time.Time) *Session {
+	session := &Session{
+		ID:          uuid.New(),
+		UserID:      userID,
+		DeviceID:    deviceID,
+		Fingerprint: DeviceFingerprint(userAgent, deviceID),
+		UserAgent:   userAgent,
+		ExpiresAt:   expiresAt,
+	}
+	if len(session.UserAgent) > maxUserAgentLength {
+		session.UserAgent = session.UserAgent[:maxUserAgentLength]
+	}
+	return session
+}
+
+// MatchesDevice reports whether a request with userAgent and deviceID comes
+// from the device that started the session. Sessions started without a
+// device ID are bound by user agent alone.
+func (s *Session) MatchesDevice(userAgent, deviceID string) bool {
+	if s.DeviceID == "" {
+		deviceID = ""
+	}
+	return subtle.ConstantTimeCompare([]byte(DeviceFingerprint(userAgent, deviceID)), []byte(s.Fingerprint)) == 1
+}
+
+// Active reports whether refresh tokens bound to the session are honored at t
+func (s *Session) Active(t time.Time) bool {
+	return s.RevokedAt == nil && t.Before(s.ExpiresAt)
+}
+
+// ValidateDeviceID checks a client-provided device ID. Clients that send
+// none are bound by their user agent alone.
+func ValidateDeviceID(deviceID string) error {
+	if len(deviceID) > maxDeviceIDLength {
+		return fmt.Errorf("device ID must be at most %d characters", maxDeviceIDLength)
+	}
+	return nil
+}
+
+// DeviceFingerprint identifies the device a session belongs to by its user
+// agent and device ID. The two are length-prefixed so no pair of values can
+// collide with another.
+func DeviceFingerprint(userAgent, deviceID string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s%d:%s", len(userAgent), userAgent, len(deviceID), deviceID)))
+	return hex.EncodeToString(sum[:])
+}
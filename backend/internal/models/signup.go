@@ -0,0 +1,53 @@
+package models
+
+import "strings"
+
+// Reasons SignupPolicy.Check rejects an email
+const (
+	SignupEmailInvalid     = "email_invalid"
+	SignupDomainNotAllowed = "domain_not_allowed"
+	SignupDomainBlocked    = "domain_blocked"
+	SignupDisposableEmail  = "disposable_email"
+)
+
+// SignupPolicy decides which email domains may register. A domain matches a
+// listed domain equal to it or to one of its parents, so "example.com" also
+// covers "mail.example.com". An empty Allowed list allows every domain not
+// otherwise rejected.
+type SignupPolicy struct {
+	Allowed    []string
+	Blocked    []string
+	Disposable []string
+}
+
+// Check returns why email may not register, or "" if it may
+func (p *SignupPolicy) Check(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return SignupEmailInvalid
+	}
+	domain := strings.TrimSuffix(strings.ToLower(email[at+1:]), ".")
+	if !strings.Contains(domain, ".") {
+		return SignupEmailInvalid
+	}
+
+	switch {
+	case len(p.Allowed) > 0 && !domainListed(domain, p.Allowed):
+		return SignupDomainNotAllowed
+	case domainListed(domain, p.Blocked):
+		return SignupDomainBlocked
+	case domainListed(domain, p.Disposable):
+		return SignupDisposableEmail
+	}
+	return ""
+}
+
+func domainListed(domain string, list []string) bool {
+	for _, listed := range list {
+		listed = strings.ToLower(strings.TrimPrefix(listed, "@"))
+		if domain == listed || strings.HasSuffix(domain, "."+listed) {
+			return true
+		}
+	}
+	return false
+}
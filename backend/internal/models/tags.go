@@ -0,0 +1,66 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tag is a label from an organization's managed vocabulary that reviewers
+// apply to interactions, e.g. "spam" or "good example"
+type Tag struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	OrgID            uuid.UUID  `json:"orgId" db:"org_id"`
+	Name             string     `json:"name" db:"name"`
+	Color            *string    `json:"color" db:"color"`
+	Description      *string    `json:"description" db:"description"`
+	CreatedBy        *uuid.UUID `json:"createdBy" db:"created_by"`
+	CreatedAt        time.Time  `json:"createdAt" db:"created_at"`
+	InteractionCount *int       `json:"interactionCount,omitempty"` // Set when listing the organization's tags
+}
+
+// InteractionTag is a tag applied to an interaction
+type InteractionTag struct {
+	*Tag
+	TaggedBy *uuid.UUID `json:"taggedBy"`
+	TaggedAt time.Time  `json:"taggedAt"`
+}
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// NormalizeTagName lower-cases a tag name and collapses its whitespace, so
+// "Good  Example" and "good example" are the same tag
+func NormalizeTagName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// TagRequest creates or replaces a tag
+type TagRequest struct {
+	Name        string  `json:"name"`
+	Color       *string `json:"color"`
+	Description *string `json:"description"`
+}
+
+// Validate checks the tag and normalizes its name
+func (r *TagRequest) Validate() error {
+	r.Name = NormalizeTagName(r.Name)
+	if r.Name == "" || len(r.Name) > 50 {
+		return fmt.Errorf("name must be between 1 and 50 characters")
+	}
+	if r.Color != nil && !tagColorPattern.MatchString(*r.Color) {
+		return fmt.Errorf("color must be a hex color such as #ff8800")
+	}
+	if r.Description != nil && len(*r.Description) > 500 {
+		return fmt.Errorf("description must be at most 500 characters")
+	}
+	return nil
+}
+
+// ApplyTagRequest is a tag to add to an interaction, by ID or name
+type ApplyTagRequest struct {
+	TagID *uuid.UUID `json:"tagId"`
+	Name  string     `json:"name"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Token prefixes make tokens recognizable in logs and secret scanners
+const (
+	agentTokenPrefix        = "vbr_agent_"
+	webhookRouteTokenPrefix = "vbr_whk_"
+)
+
+// GenerateAgentToken returns a new random org agent token and the hash to store
+func GenerateAgentToken() (token, hash string, err error) {
+	return generateToken(agentTokenPrefix)
+}
+
+// GenerateWebhookRouteToken returns a new random integration webhook URL
+// token and the hash to store
+func GenerateWebhookRouteToken() (token, hash string, err error) {
+	return generateToken(webhookRouteTokenPrefix)
+}
+
+func generateToken(prefix string) (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = prefix + hex.EncodeToString(b)
+	return token, HashAgentToken(token), nil
+}
+
+// HashAgentToken hashes an agent or webhook route token for storage and
+// lookup. Tokens carry 256 bits of entropy, so an unsalted SHA-256 is
+// sufficient.
+func HashAgentToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
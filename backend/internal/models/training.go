@@ -0,0 +1,302 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// TrainingSampleTypes lists the sample types accepted by the training_samples table
+var TrainingSampleTypes = []string{
+	"message", "response", "style", "domain", "correction", "negative",
+}
+
+// IsValidSampleType reports whether t is a known training sample type
+func IsValidSampleType(t string) bool {
+	for _, known := range TrainingSampleTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// SanitizeTrainingText strips control characters (other than newlines and
+// tabs) and invalid UTF-8 from s and trims surrounding whitespace
+func SanitizeTrainingText(s string) string {
+	s = strings.ToValidUTF8(s, "")
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// CheckTrainingText sanitizes text and ensures it is non-empty and at most
+// maxChars characters. field names the value in the returned error.
+func CheckTrainingText(field, text string, maxChars int) (string, error) {
+	clean := SanitizeTrainingText(text)
+	if clean == "" {
+		return "", fmt.Errorf("%s must not be empty", field)
+	}
+	if n := utf8.RuneCountInString(clean); n > maxChars {
+		return "", fmt.Errorf("%s is %d characters, the limit is %d", field, n, maxChars)
+	}
+	return clean, nil
+}
+
+// Sanitize validates the sample type and cleans the sample's input and
+// output text in place, enforcing the configured length limits
+func (s *TrainingSample) Sanitize(maxInputChars, maxOutputChars int) error {
+	if !IsValidSampleType(s.SampleType) {
+		return fmt.Errorf("invalid sample type: %s", s.SampleType)
+	}
+
+	input, err := CheckTrainingText("inputText", s.InputText, maxInputChars)
+	if err != nil {
+		return err
+	}
+	s.InputText = input
+
+	if s.OutputText != nil {
+		output, err := CheckTrainingText("outputText", *s.OutputText, maxOutputChars)
+		if err != nil {
+			return err
+		}
+		s.OutputText = &output
+	}
+	return nil
+}
+
+// Training data file formats accepted by the import endpoint
+const (
+	TrainingFormatNDJSON = "ndjson"
+	TrainingFormatCSV    = "csv"
+)
+
+// TrainingFormatFor picks the file format from an explicit format name or,
+// failing that, the file name's extension. It returns "" when neither names
+// a known format.
+func TrainingFormatFor(format, filename string) string {
+	switch strings.ToLower(format) {
+	case TrainingFormatNDJSON, "jsonl":
+		return TrainingFormatNDJSON
+	case TrainingFormatCSV:
+		return TrainingFormatCSV
+	case "":
+	default:
+		return ""
+	}
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".ndjson", ".jsonl":
+		return TrainingFormatNDJSON
+	case ".csv":
+		return TrainingFormatCSV
+	}
+	return ""
+}
+
+// TrainingImportRecord is one sample in an imported file. CSV files carry
+// the same fields as header columns.
+type TrainingImportRecord struct {
+	SampleType string  `json:"sampleType"`
+	InputText  string  `json:"inputText"`
+	OutputText *string `json:"outputText"`
+	Provider   *string `json:"provider"`
+	IsPositive *bool   `json:"isPositive"` // Defaults to true
+}
+
+// Sample builds a sanitized training sample for agentID from the record
+func (rec *TrainingImportRecord) Sample(agentID uuid.UUID, source string, maxInputChars, maxOutputChars int) (*TrainingSample, error) {
+	sample := &TrainingSample{
+		ID:         uuid.New(),
+		AgentID:    agentID,
+		Provider:   rec.Provider,
+		SampleType: rec.SampleType,
+		InputText:  rec.InputText,
+		OutputText: rec.OutputText,
+		IsPositive: rec.IsPositive == nil || *rec.IsPositive,
+		Source:     &source,
+	}
+	if err := sample.Sanitize(maxInputChars, maxOutputChars); err != nil {
+		return nil, err
+	}
+	return sample, nil
+}
+
+// maxTrainingLineBytes bounds a single NDJSON line, so a file without
+// newlines cannot be read into memory whole
+const maxTrainingLineBytes = 4 << 20
+
+// TrainingRecordReader reads import records one at a time from an NDJSON or
+// CSV stream
+type TrainingRecordReader struct {
+	lines   *bufio.Scanner
+	csv     *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+// NewTrainingRecordReader starts reading r in format. CSV input must begin
+// with a header row naming at least the sampleType and inputText columns.
+func NewTrainingRecordReader(r io.Reader, format string) (*TrainingRecordReader, error) {
+	switch format {
+	case TrainingFormatNDJSON:
+		lines := bufio.NewScanner(r)
+		lines.Buffer(make([]byte, 64*1024), maxTrainingLineBytes)
+		return &TrainingRecordReader{lines: lines}, nil
+
+	case TrainingFormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.ReuseRecord = true
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		columns := map[string]int{}
+		for i, name := range header {
+			columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+		}
+		for _, required := range []string{"sampleType", "inputText"} {
+			if _, ok := columns[required]; !ok {
+				return nil, fmt.Errorf("CSV header is missing the %s column", required)
+			}
+		}
+		return &TrainingRecordReader{csv: reader, columns: columns, line: 1}, nil
+	}
+	return nil, fmt.Errorf("unsupported training data format: %s", format)
+}
+
+// TrainingRecordError is a record that could not be parsed. Reading can
+// continue after it.
+type TrainingRecordError struct {
+	Line int
+	Err  error
+}
+
+func (e *TrainingRecordError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Next returns the next record and its line number. It returns io.EOF at the
+// end of input, a *TrainingRecordError for a malformed record, and any other
+// error when the stream cannot be read further.
+func (t *TrainingRecordReader) Next() (*TrainingImportRecord, int, error) {
+	if t.csv != nil {
+		return t.nextCSV()
+	}
+
+	for t.lines.Scan() {
+		t.line++
+		line := bytes.TrimSpace(t.lines.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		rec := &TrainingImportRecord{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			return nil, t.line, &TrainingRecordError{Line: t.line, Err: fmt.Errorf("invalid JSON: %w", err)}
+		}
+		return rec, t.line, nil
+	}
+	if err := t.lines.Err(); err != nil {
+		return nil, t.line, err
+	}
+	return nil, t.line, io.EOF
+}
+
+func (t *TrainingRecordReader) nextCSV() (*TrainingImportRecord, int, error) {
+	row, err := t.csv.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			t.line = parseErr.Line
+			return nil, t.line, &TrainingRecordError{Line: parseErr.Line, Err: parseErr.Err}
+		}
+		return nil, t.line, err
+	}
+	t.line, _ = t.csv.FieldPos(0)
+
+	field := func(name string) (string, bool) {
+		i, ok := t.columns[name]
+		if !ok || i >= len(row) || row[i] == "" {
+			return "", false
+		}
+		return row[i], true
+	}
+
+	rec := &TrainingImportRecord{}
+	rec.SampleType, _ = field("sampleType")
+	rec.InputText, _ = field("inputText")
+	if output, ok := field("outputText"); ok {
+		rec.OutputText = &output
+	}
+	if provider, ok := field("provider"); ok {
+		rec.Provider = &provider
+	}
+	if positive, ok := field("isPositive"); ok {
+		value, err := strconv.ParseBool(positive)
+		if err != nil {
+			return nil, t.line, &TrainingRecordError{Line: t.line, Err: fmt.Errorf("isPositive must be true or false")}
+		}
+		rec.IsPositive = &value
+	}
+	return rec, t.line, nil
+}
+
+// Training import job states
+const (
+	TrainingImportProcessing = "processing"
+	TrainingImportCompleted  = "completed"
+	TrainingImportFailed     = "failed"
+)
+
+// maxTrainingImportErrors caps the rejected records kept on a job
+const maxTrainingImportErrors = 50
+
+// TrainingImportJob tracks a training data file being imported
+type TrainingImportJob struct {
+	ID          uuid.UUID            `json:"id"`
+	AgentID     uuid.UUID            `json:"agentId"`
+	Status      string               `json:"status"`
+	Format      string               `json:"format"`
+	Bytes       int64                `json:"bytes"`
+	Processed   int                  `json:"processed"` // Records read so far
+	Inserted    int                  `json:"inserted"`
+	Rejected    int                  `json:"rejected"`
+	Errors      []TrainingRecordFail `json:"errors"` // The first rejected records
+	Error       string               `json:"error,omitempty"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	CompletedAt *time.Time           `json:"completedAt"`
+}
+
+// TrainingRecordFail is a rejected record in an import
+type TrainingRecordFail struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Reject counts a rejected record, keeping the first few reasons
+func (j *TrainingImportJob) Reject(line int, err error) {
+	j.Rejected++
+	if len(j.Errors) < maxTrainingImportErrors {
+		j.Errors = append(j.Errors, TrainingRecordFail{Line: line, Error: err.Error()})
+	}
+}
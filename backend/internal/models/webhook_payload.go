@@ -0,0 +1,181 @@
+package models
+
+import "fmt"
+
+// Webhook payload schemas. Each provider's parser checks only the fields the
+// handlers rely on, with checked type assertions. Unknown fields and unknown
+// event types are accepted so providers can add to their payloads without
+// breaking ingestion; a missing or mistyped field the handlers need is a
+// WebhookPayloadError.
+
+// WebhookPayloadError is a webhook body that is valid JSON but not an event
+// that can be parsed
+type WebhookPayloadError struct {
+	Field  string
+	Reason string
+}
+
+func (e *WebhookPayloadError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Reason)
+}
+
+// requireString returns m[key] if it is a non-empty string
+func requireString(m map[string]interface{}, path, key string) (string, error) {
+	switch v := m[key].(type) {
+	case string:
+		if v != "" {
+			return v, nil
+		}
+	case nil:
+	default:
+		return "", &WebhookPayloadError{Field: path + key, Reason: "must be a string"}
+	}
+	return "", &WebhookPayloadError{Field: path + key, Reason: "is required"}
+}
+
+// requireObject returns m[key] if it is a JSON object
+func requireObject(m map[string]interface{}, path, key string) (map[string]interface{}, error) {
+	switch v := m[key].(type) {
+	case map[string]interface{}:
+		return v, nil
+	case nil:
+		return nil, &WebhookPayloadError{Field: path + key, Reason: "is required"}
+	default:
+		return nil, &WebhookPayloadError{Field: path + key, Reason: "must be an object"}
+	}
+}
+
+// optionalString returns m[key] if it is a string and "" if it is absent
+func optionalString(m map[string]interface{}, path, key string) (string, error) {
+	switch v := m[key].(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	default:
+		return "", &WebhookPayloadError{Field: path + key, Reason: "must be a string"}
+	}
+}
+
+// SlackEnvelope is the outer payload of a Slack Events API request
+type SlackEnvelope struct {
+	Type      string
+	Challenge string                 // Set for url_verification
+	TeamID    string                 // Set for event_callback, may be empty
+	Event     map[string]interface{} // Set for event_callback
+	EventType string                 // Set for event_callback
+}
+
+// ParseSlackEnvelope checks a Slack Events API payload. Envelope types other
+// than url_verification and event_callback are returned unchecked.
+func ParseSlackEnvelope(payload map[string]interface{}) (*SlackEnvelope, error) {
+	envelope := &SlackEnvelope{}
+	var err error
+	if envelope.Type, err = requireString(payload, "", "type"); err != nil {
+		return nil, err
+	}
+
+	switch envelope.Type {
+	case "url_verification":
+		if envelope.Challenge, err = requireString(payload, "", "challenge"); err != nil {
+			return nil, err
+		}
+	case "event_callback":
+		if envelope.TeamID, err = optionalString(payload, "", "team_id"); err != nil {
+			return nil, err
+		}
+		if envelope.Event, err = requireObject(payload, "", "event"); err != nil {
+			return nil, err
+		}
+		if envelope.EventType, err = requireString(envelope.Event, "event.", "type"); err != nil {
+			return nil, err
+		}
+		if err := checkSlackEvent(envelope.EventType, envelope.Event); err != nil {
+			return nil, err
+		}
+	}
+	return envelope, nil
+}
+
+// checkSlackEvent checks the fields read from the events the handlers act on
+func checkSlackEvent(eventType string, event map[string]interface{}) error {
+	switch eventType {
+	case "message", "app_mention":
+		for _, key := range []string{"channel", "user", "text", "subtype", "bot_id"} {
+			if _, err := optionalString(event, "event.", key); err != nil {
+				return err
+			}
+		}
+	case "channel_left", "group_left", "member_joined_channel":
+		if _, err := requireString(event, "event.", "channel"); err != nil {
+			return err
+		}
+		if _, err := optionalString(event, "event.", "user"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// githubEventObjects are the objects each handled GitHub event must carry
+var githubEventObjects = map[string][]string{
+	"pull_request":        {"pull_request"},
+	"pull_request_review": {"pull_request", "review"},
+	"issue_comment":       {"issue", "comment"},
+	"issues":              {"issue"},
+}
+
+// CheckGitHubPayload checks a payload for a handled GitHub event type. Other
+// event types are accepted unchecked.
+func CheckGitHubPayload(eventType string, payload map[string]interface{}) error {
+	objects, ok := githubEventObjects[eventType]
+	if !ok {
+		return nil
+	}
+
+	if _, err := requireString(payload, "", "action"); err != nil {
+		return err
+	}
+	repo, err := requireObject(payload, "", "repository")
+	if err != nil {
+		return err
+	}
+	if owner, ok := repo["owner"]; ok && owner != nil {
+		if _, isObject := owner.(map[string]interface{}); !isObject {
+			return &WebhookPayloadError{Field: "repository.owner", Reason: "must be an object"}
+		}
+	}
+	if sender, ok := payload["sender"]; ok && sender != nil {
+		if _, isObject := sender.(map[string]interface{}); !isObject {
+			return &WebhookPayloadError{Field: "sender", Reason: "must be an object"}
+		}
+	}
+	for _, key := range objects {
+		if _, err := requireObject(payload, "", key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jiraEventObjects are the objects each handled Jira event must carry
+var jiraEventObjects = map[string][]string{
+	"jira:issue_created": {"issue"},
+	"jira:issue_updated": {"issue"},
+	"comment_created":    {"comment"},
+}
+
+// ParseJiraEvent returns a Jira payload's webhookEvent, checking the payload
+// of handled events. Other events are accepted unchecked.
+func ParseJiraEvent(payload map[string]interface{}) (string, error) {
+	webhookEvent, err := requireString(payload, "", "webhookEvent")
+	if err != nil {
+		return "", err
+	}
+	for _, key := range jiraEventObjects[webhookEvent] {
+		if _, err := requireObject(payload, "", key); err != nil {
+			return "", err
+		}
+	}
+	return webhookEvent, nil
+}
@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/models"
+)
+
+// Limit is a token bucket refilled at PerMinute tokens per minute, holding at
+// most Burst tokens
+type Limit struct {
+	PerMinute int
+	Burst     int
+}
+
+func (l Limit) refillPerSecond() float64 {
+	return float64(l.PerMinute) / 60
+}
+
+// Limiter is a Redis-backed token bucket per provider integration, consulted
+// by the AI service before each provider API call so bursts across many
+// integrations stay under provider quotas
+type Limiter struct {
+	redis  *redis.Client
+	limits map[string]Limit
+}
+
+func NewLimiter(redis *redis.Client, cfg *config.Config) *Limiter {
+	return &Limiter{
+		redis: redis,
+		limits: map[string]Limit{
+			"slack":      {PerMinute: cfg.RateLimitSlackPerMinute, Burst: cfg.RateLimitSlackBurst},
+			"github":     {PerMinute: cfg.RateLimitGitHubPerMinute, Burst: cfg.RateLimitGitHubBurst},
+			"jira":       {PerMinute: cfg.RateLimitJiraPerMinute, Burst: cfg.RateLimitJiraBurst},
+			"confluence": {PerMinute: cfg.RateLimitJiraPerMinute, Burst: cfg.RateLimitJiraBurst},
+		},
+	}
+}
+
+// takeScript refills the bucket for the time elapsed since it was last used
+// and takes one token if available. It returns {allowed, waitMs, tokens}.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1]) or capacity
+local ts = tonumber(data[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) / 1000 * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate * 1000) + 1000)
+return {allowed, wait, tostring(tokens)}
+`)
+
+func bucketKey(provider string, integrationID uuid.UUID) string {
+	return fmt.Sprintf("ratelimit:%s:%s", provider, integrationID)
+}
+
+func blockKey(provider string, integrationID uuid.UUID) string {
+	return bucketKey(provider, integrationID) + ":blocked"
+}
+
+// Take consumes a token for a call to provider on behalf of an integration.
+// When no token is available, or the provider recently answered 429, it
+// returns false and how long to wait before retrying.
+func (l *Limiter) Take(ctx context.Context, provider string, integrationID uuid.UUID) (bool, time.Duration, error) {
+	limit, ok := l.limits[provider]
+	if !ok {
+		return true, 0, nil
+	}
+
+	blocked, err := l.redis.PTTL(ctx, blockKey(provider, integrationID)).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	if blocked > 0 {
+		return false, blocked, nil
+	}
+
+	res, err := takeScript.Run(ctx, l.redis, []string{bucketKey(provider, integrationID)},
+		limit.Burst, limit.refillPerSecond(), time.Now().UnixMilli()).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+
+	allowed, _ := res[0].(int64)
+	waitMs, _ := res[1].(int64)
+	return allowed == 1, time.Duration(waitMs) * time.Millisecond, nil
+}
+
+// Backoff blocks calls for an integration after the provider answered 429,
+// honouring its Retry-After
+func (l *Limiter) Backoff(ctx context.Context, provider string, integrationID uuid.UUID, retryAfter time.Duration) error {
+	if retryAfter <= 0 {
+		retryAfter = time.Second
+	}
+	return l.redis.Set(ctx, blockKey(provider, integrationID), "1", retryAfter).Err()
+}
+
+// State reports the bucket for an integration without consuming a token
+func (l *Limiter) State(ctx context.Context, provider string, integrationID uuid.UUID) (*models.RateLimitState, error) {
+	limit, ok := l.limits[provider]
+	if !ok {
+		return nil, nil
+	}
+
+	state := &models.RateLimitState{
+		Capacity:        limit.Burst,
+		Tokens:          float64(limit.Burst),
+		RefillPerSecond: limit.refillPerSecond(),
+	}
+
+	data, err := l.redis.HMGet(ctx, bucketKey(provider, integrationID), "tokens", "ts").Result()
+	if err != nil {
+		return nil, err
+	}
+	if tokensStr, ok := data[0].(string); ok {
+		tokens, _ := strconv.ParseFloat(tokensStr, 64)
+		if tsStr, ok := data[1].(string); ok {
+			ts, _ := strconv.ParseInt(tsStr, 10, 64)
+			elapsed := time.Since(time.UnixMilli(ts)).Seconds()
+			if elapsed > 0 {
+				tokens += elapsed * state.RefillPerSecond
+			}
+		}
+		if tokens > float64(limit.Burst) {
+			tokens = float64(limit.Burst)
+		}
+		state.Tokens = tokens
+	}
+
+	blocked, err := l.redis.PTTL(ctx, blockKey(provider, integrationID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if blocked > 0 {
+		until := time.Now().Add(blocked).UTC()
+		state.BlockedUntil = &until
+	}
+
+	return state, nil
+}
@@ -2,15 +2,102 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 
+	"github.com/vibber/backend/internal/crypto"
 	"github.com/vibber/backend/internal/models"
 )
 
+// ErrNotFound is returned by single-row lookups that match nothing. It wraps
+// pgx.ErrNoRows, so errors.Is works with either.
+var ErrNotFound = fmt.Errorf("not found: %w", pgx.ErrNoRows)
+
+// Returned by PauseAgents and ResumeAgents when the organization is already
+// in the requested state
+var (
+	ErrAgentsAlreadyPaused = errors.New("agents already paused")
+	ErrAgentsNotPaused     = errors.New("agents not paused")
+)
+
+// ErrEmailTaken is returned when creating a user whose email is already
+// registered
+var ErrEmailTaken = errors.New("email already registered")
+
+// ErrAlreadyPromoted is returned when creating a training sample from an
+// interaction that already has one
+var ErrAlreadyPromoted = errors.New("interaction already promoted to training")
+
+// ErrTagExists is returned when creating or renaming a tag to a name the
+// organization already uses
+var ErrTagExists = errors.New("tag already exists")
+
+// notFound maps pgx.ErrNoRows to ErrNotFound and passes other errors through
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err violates the named unique constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
+
+// sealSecret encrypts a secret for storage
+func sealSecret(k *crypto.Keyring, value string) (string, error) {
+	return k.Encrypt([]byte(value))
+}
+
+// openSecret decrypts a stored secret. Secrets stored before encryption was
+// enabled are returned as they are and encrypted when next written.
+func openSecret(k *crypto.Keyring, value string) (string, error) {
+	if !crypto.IsEncrypted(value) {
+		return value, nil
+	}
+	plaintext, err := k.Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func sealOptionalSecret(k *crypto.Keyring, value *string) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	sealed, err := sealSecret(k, *value)
+	return &sealed, err
+}
+
+func openOptionalSecret(k *crypto.Keyring, value *string) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	opened, err := openSecret(k, *value)
+	return &opened, err
+}
+
+// userEmailError maps a violation of the users email constraint to
+// ErrEmailTaken and passes other errors through
+func userEmailError(err error) error {
+	if isUniqueViolation(err, "users_email_key") {
+		return ErrEmailTaken
+	}
+	return err
+}
+
 // Repositories holds all repository instances
 type Repositories struct {
 	User         UserRepository
@@ -21,28 +108,62 @@ type Repositories struct {
 	Escalation   EscalationRepository
 	Training     TrainingRepository
 	Credential   CredentialRepository
+	Membership   MembershipRepository
+	Replay       ReplayRepository
+	Audit        AuditRepository
+	RoutingRule  RoutingRuleRepository
+	PriorityRule PriorityRuleRepository
+	Maintenance  MaintenanceWindowRepository
+	Tag          TagRepository
+	Session      SessionRepository
 }
 
-// NewRepositories creates a new repositories instance
-func NewRepositories(db *pgxpool.Pool) *Repositories {
+// NewRepositories creates a new repositories instance. Aggregate analytics
+// queries and the escalation export run on replica when one is given and on
+// db otherwise. A replica may lag the primary by a few seconds, so only
+// methods that tolerate slightly stale data read from it: nothing that backs
+// a read-after-write, an ownership check or a lookup by ID. Integration
+// tokens and OAuth client secrets are encrypted with keyring.
+func NewRepositories(db, replica *pgxpool.Pool, keyring *crypto.Keyring) *Repositories {
+	if replica == nil {
+		replica = db
+	}
 	return &Repositories{
 		User:         &userRepository{db: db},
 		Organization: &organizationRepository{db: db},
 		Agent:        &agentRepository{db: db},
-		Integration:  &integrationRepository{db: db},
-		Interaction:  &interactionRepository{db: db},
-		Escalation:   &escalationRepository{db: db},
+		Integration:  &integrationRepository{db: db, secrets: keyring},
+		Interaction:  &interactionRepository{db: db, replica: replica},
+		Escalation:   &escalationRepository{db: db, replica: replica},
 		Training:     &trainingRepository{db: db},
-		Credential:   &credentialRepository{db: db},
+		Credential:   &credentialRepository{db: db, secrets: keyring},
+		Membership:   &membershipRepository{db: db},
+		Replay:       &replayRepository{db: db},
+		Audit:        &auditRepository{db: db},
+		RoutingRule:  &routingRuleRepository{db: db},
+		PriorityRule: &priorityRuleRepository{db: db},
+		Maintenance:  &maintenanceWindowRepository{db: db},
+		Tag:          &tagRepository{db: db},
+		Session:      &sessionRepository{db: db},
 	}
 }
 
-// NewPostgresDB creates a new PostgreSQL connection pool
-func NewPostgresDB(connString string) (*pgxpool.Pool, error) {
+// NewPostgresDB creates a new PostgreSQL connection pool. A positive
+// statementTimeout makes the server cancel any query running longer than it;
+// a non-nil tracer sees every query.
+func NewPostgresDB(connString string, statementTimeout time.Duration, tracer pgx.QueryTracer) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(connString)
 	if err != nil {
 		return nil, err
 	}
+	config.ConnConfig.Tracer = tracer
+
+	// All timestamps are UTC, including NOW() and DATE() grouping in queries
+	config.ConnConfig.RuntimeParams["timezone"] = "UTC"
+
+	if statementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(statementTimeout.Milliseconds(), 10)
+	}
 
 	config.MaxConns = 25
 	config.MinConns = 5
@@ -82,11 +203,16 @@ func NewRedisClient(connString string) (*redis.Client, error) {
 // UserRepository interface
 type UserRepository interface {
 	Create(ctx context.Context, user *models.User) error
+	CreateWithOrganization(ctx context.Context, org *models.Organization, user *models.User) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetByProvider(ctx context.Context, provider, providerID string) (*models.User, error)
+	LinkProvider(ctx context.Context, id uuid.UUID, provider, providerID string) error
 	Update(ctx context.Context, user *models.User) error
 	UpdateLastLogin(ctx context.Context, id uuid.UUID) error
-	ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.User, error)
+	UpdatePasswordHash(ctx context.Context, id uuid.UUID, passwordHash string) error
+	BumpTokenEpoch(ctx context.Context, id uuid.UUID) error
+	ListByOrgID(ctx context.Context, orgID uuid.UUID, params models.PaginationParams) ([]*models.User, int, error)
 }
 
 // OrganizationRepository interface
@@ -95,6 +221,17 @@ type OrganizationRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Organization, error)
 	GetBySlug(ctx context.Context, slug string) (*models.Organization, error)
 	Update(ctx context.Context, org *models.Organization) error
+	SetAgentTokenHash(ctx context.Context, id uuid.UUID, hash string, updatedBy uuid.UUID) error
+	GetByAgentTokenHash(ctx context.Context, hash string) (*models.Organization, error)
+	GetRetentionPolicy(ctx context.Context, id uuid.UUID) (*models.RetentionPolicy, error)
+	UpdateRetentionPolicy(ctx context.Context, id uuid.UUID, retentionDays *int, legalHold bool, updatedBy uuid.UUID) error
+	PurgeExpired(ctx context.Context, planDefaults map[string]int) (*models.PurgeResult, error)
+	GetAgentDefaults(ctx context.Context, id uuid.UUID) (*models.AgentDefaults, error)
+	UpdateAgentDefaults(ctx context.Context, id uuid.UUID, defaults *models.AgentDefaults, updatedBy uuid.UUID) error
+	GetFeatureFlags(ctx context.Context, id uuid.UUID) (map[string]bool, error)
+	SetFeatureFlag(ctx context.Context, id uuid.UUID, flag string, enabled *bool) error
+	PauseAgents(ctx context.Context, id, pausedBy uuid.UUID) ([]uuid.UUID, error)
+	ResumeAgents(ctx context.Context, id uuid.UUID) ([]uuid.UUID, error)
 }
 
 // AgentRepository interface
@@ -102,8 +239,13 @@ type AgentRepository interface {
 	Create(ctx context.Context, agent *models.Agent) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Agent, error)
 	ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Agent, error)
+	ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.Agent, error)
 	Update(ctx context.Context, agent *models.Agent) error
+	UpdateSettings(ctx context.Context, agents []*models.Agent) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	IsOrgPaused(ctx context.Context, id uuid.UUID) (bool, error)
+	CountOrphans(ctx context.Context) (*models.OrphanCounts, error)
+	PurgeOrphans(ctx context.Context) (*models.OrphanCounts, error)
 }
 
 // IntegrationRepository interface
@@ -112,7 +254,21 @@ type IntegrationRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Integration, error)
 	GetByAgentAndProvider(ctx context.Context, agentID uuid.UUID, provider string) (*models.Integration, error)
 	ListByAgentID(ctx context.Context, agentID uuid.UUID) ([]*models.Integration, error)
+	ListByExternalID(ctx context.Context, provider, externalID string) ([]*models.Integration, error)
+	GetByExternalID(ctx context.Context, provider, externalID string) (*models.Integration, error)
+	ListExpiring(ctx context.Context, before time.Time, limit int) ([]*models.Integration, error)
+	OrgID(ctx context.Context, integrationID uuid.UUID) (uuid.UUID, error)
 	Update(ctx context.Context, integration *models.Integration) error
+	UpdateMetadata(ctx context.Context, integration *models.Integration) error
+	SetPassive(ctx context.Context, id uuid.UUID, passive bool) error
+	SetEnabled(ctx context.Context, id uuid.UUID, enabled bool) error
+	SetRouteTokenHash(ctx context.Context, id uuid.UUID, hash *string) error
+	GetByRouteTokenHash(ctx context.Context, hash string) (*models.Integration, error)
+	AttachAgent(ctx context.Context, integrationID, agentID uuid.UUID) error
+	DetachAgent(ctx context.Context, integrationID, agentID uuid.UUID) error
+	ListAgentIDs(ctx context.Context, integrationID uuid.UUID) ([]uuid.UUID, error)
+	UpgradeScopes(ctx context.Context, integration *models.Integration, grant *models.IntegrationScopeGrant) error
+	ListScopeGrants(ctx context.Context, integrationID uuid.UUID) ([]*models.IntegrationScopeGrant, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
@@ -121,25 +277,51 @@ type InteractionRepository interface {
 	Create(ctx context.Context, interaction *models.Interaction) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Interaction, error)
 	ListByAgentID(ctx context.Context, agentID uuid.UUID, params models.PaginationParams) ([]*models.Interaction, int, error)
+	ListByOrgID(ctx context.Context, orgID uuid.UUID, filter models.InteractionFilter, params models.PaginationParams) ([]*models.OrgInteraction, int, error)
+	ListByAgentIDsAfter(ctx context.Context, agentIDs []uuid.UUID, filter models.InteractionFilter, after *models.InteractionCursor, limit int) ([]*models.Interaction, error)
+	ListByAgentInRange(ctx context.Context, agentID uuid.UUID, from, to time.Time, limit int) ([]*models.Interaction, error)
 	Update(ctx context.Context, interaction *models.Interaction) error
+	// Record saves a processed interaction, creating it if needed, together
+	// with its escalation (nil for none)
+	Record(ctx context.Context, interaction *models.Interaction, escalation *models.Escalation) error
 	CountToday(ctx context.Context, agentID uuid.UUID) (int, error)
-	GetOverviewMetrics(ctx context.Context, agentID uuid.UUID) (*models.OverviewMetrics, error)
-	GetTrends(ctx context.Context, agentID uuid.UUID, days int) ([]*models.TrendData, error)
+	FailStale(ctx context.Context, olderThan time.Duration, reason string) ([]*models.Interaction, error)
+	ListUnescalatedFailures(ctx context.Context, reason string, within time.Duration, limit int) ([]*models.Interaction, error)
+	ListDeferred(ctx context.Context, limit int) ([]*models.Interaction, error)
+	EndDeferral(ctx context.Context, id uuid.UUID, release bool) (bool, error)
+
+	// Analytics; these read from the replica and may lag recent writes
+	GetOverviewMetrics(ctx context.Context, agentID uuid.UUID, interactionType string) (*models.OverviewMetrics, error)
+	GetOrgOverviewMetrics(ctx context.Context, orgID uuid.UUID, topAgents int) (*models.OrgOverviewMetrics, error)
+	GetTrends(ctx context.Context, agentID uuid.UUID, days int, interactionType string) ([]*models.TrendData, error)
+	GetFeedbackSummary(ctx context.Context, agentID uuid.UUID, from, to time.Time) (*models.FeedbackSummary, error)
+	GetCalibration(ctx context.Context, agentID uuid.UUID, from, to time.Time, bucketSize int) ([]*models.CalibrationBucket, error)
 }
 
 // EscalationRepository interface
 type EscalationRepository interface {
 	Create(ctx context.Context, escalation *models.Escalation) error
+	// Escalate creates the escalation and flags its interaction escalated
+	Escalate(ctx context.Context, escalation *models.Escalation) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Escalation, error)
-	ListPending(ctx context.Context, agentID uuid.UUID) ([]*models.Escalation, error)
+	GetByInteractionID(ctx context.Context, interactionID uuid.UUID) (*models.Escalation, error)
+	ListEscalationsWithInteractions(ctx context.Context, userID uuid.UUID, filter models.EscalationFilter, params models.PaginationParams) ([]*models.EscalationListItem, int, error)
 	Update(ctx context.Context, escalation *models.Escalation) error
+	ResolvePending(ctx context.Context, escalation *models.Escalation) (bool, error)
 	CountPending(ctx context.Context, agentID uuid.UUID) (int, error)
+	// StreamForExport reads from the replica and may lag recent writes
+	StreamForExport(ctx context.Context, agentIDs []uuid.UUID, filter models.EscalationExportFilter, fn func(*models.EscalationExport) error) error
+	// ListResolvedAfter reads from the replica and may lag recent writes
+	ListResolvedAfter(ctx context.Context, since *time.Time, after *models.EscalationCursor, includeByDefault bool, limit int) ([]*models.ResolvedEscalationSample, error)
 }
 
 // TrainingRepository interface
 type TrainingRepository interface {
 	Create(ctx context.Context, sample *models.TrainingSample) error
+	CreateBatch(ctx context.Context, samples []*models.TrainingSample) error
 	ListByAgentID(ctx context.Context, agentID uuid.UUID) ([]*models.TrainingSample, error)
+	ListByIDs(ctx context.Context, agentID uuid.UUID, ids []uuid.UUID) ([]*models.TrainingSample, error)
+	CountByAgentID(ctx context.Context, agentID uuid.UUID) (*models.TrainingBreakdown, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
@@ -152,6 +334,78 @@ type CredentialRepository interface {
 	Update(ctx context.Context, cred *models.OrganizationCredential) error
 	Delete(ctx context.Context, id uuid.UUID) error
 	MarkVerified(ctx context.Context, id uuid.UUID) error
+	ListWebhookSecrets(ctx context.Context, provider, workspace string) ([]string, error)
+}
+
+// ReplayRepository interface
+type ReplayRepository interface {
+	Create(ctx context.Context, replay *models.InteractionReplay) error
+	ListComparisons(ctx context.Context, agentID, runID uuid.UUID) ([]*models.ReplayComparison, error)
+}
+
+// AuditRepository interface
+type AuditRepository interface {
+	Create(ctx context.Context, entry *models.AuditLog) error
+}
+
+// RoutingRuleRepository interface
+type RoutingRuleRepository interface {
+	Create(ctx context.Context, rule *models.EscalationRoutingRule) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.EscalationRoutingRule, error)
+	ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.EscalationRoutingRule, error)
+	Update(ctx context.Context, rule *models.EscalationRoutingRule) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	Assignee(ctx context.Context, agentID uuid.UUID, provider, interactionType string) (uuid.UUID, error)
+}
+
+// PriorityRuleRepository interface
+type PriorityRuleRepository interface {
+	Create(ctx context.Context, rule *models.EscalationPriorityRule) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.EscalationPriorityRule, error)
+	ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.EscalationPriorityRule, error)
+	ListForAgent(ctx context.Context, agentID uuid.UUID) ([]*models.EscalationPriorityRule, error)
+	Update(ctx context.Context, rule *models.EscalationPriorityRule) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// MaintenanceWindowRepository interface
+type MaintenanceWindowRepository interface {
+	Create(ctx context.Context, window *models.MaintenanceWindow) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.MaintenanceWindow, error)
+	ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.MaintenanceWindow, error)
+	ListForAgent(ctx context.Context, agentID uuid.UUID) ([]*models.MaintenanceWindow, error)
+	Update(ctx context.Context, window *models.MaintenanceWindow) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// TagRepository interface
+type TagRepository interface {
+	Create(ctx context.Context, tag *models.Tag) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Tag, error)
+	GetByName(ctx context.Context, orgID uuid.UUID, name string) (*models.Tag, error)
+	ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.Tag, error)
+	Update(ctx context.Context, tag *models.Tag) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	AddToInteraction(ctx context.Context, interactionID, tagID, userID uuid.UUID) (bool, error)
+	RemoveFromInteraction(ctx context.Context, interactionID, tagID uuid.UUID) (bool, error)
+	ListForInteraction(ctx context.Context, interactionID, orgID uuid.UUID) ([]*models.InteractionTag, error)
+	FilterTagged(ctx context.Context, tagID uuid.UUID, interactionIDs []uuid.UUID) (map[uuid.UUID]bool, error)
+}
+
+// SessionRepository manages the per-device sessions refresh tokens are bound to
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Session, error)
+	ListActiveByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Session, error)
+	Touch(ctx context.Context, id uuid.UUID) error
+	Revoke(ctx context.Context, id, userID uuid.UUID) (bool, error)
+}
+
+// MembershipRepository interface
+type MembershipRepository interface {
+	Create(ctx context.Context, membership *models.Membership) error
+	Get(ctx context.Context, userID, orgID uuid.UUID) (*models.Membership, error)
+	ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Membership, error)
 }
 
 // Implementation stubs - these would be fully implemented in production
@@ -165,25 +419,97 @@ func (r *userRepository) Create(ctx context.Context, user *models.User) error {
 		INSERT INTO users (id, org_id, email, name, password_hash, avatar_url, role, provider, provider_id, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
 	`, user.ID, user.OrgID, user.Email, user.Name, user.PasswordHash, user.AvatarURL, user.Role, user.Provider, user.ProviderID)
-	return err
+	return userEmailError(err)
+}
+
+// CreateWithOrganization creates a new organization, its first user and the
+// user's membership in one transaction, so nothing is left behind when the
+// email is already registered
+func (r *userRepository) CreateWithOrganization(ctx context.Context, org *models.Organization, user *models.User) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO organizations (id, name, slug, plan, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+	`, org.ID, org.Name, org.Slug, org.Plan); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO users (id, org_id, email, name, password_hash, avatar_url, role, provider, provider_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
+	`, user.ID, user.OrgID, user.Email, user.Name, user.PasswordHash, user.AvatarURL, user.Role, user.Provider, user.ProviderID); err != nil {
+		return userEmailError(err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO memberships (user_id, org_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`, user.ID, org.ID, user.Role); err != nil {
+		return err
+	}
+
+	// The organization is attributed to its first user once the user exists
+	if _, err := tx.Exec(ctx, `
+		UPDATE organizations SET created_by = $2, updated_by = $2 WHERE id = $1
+	`, org.ID, user.ID); err != nil {
+		return err
+	}
+	org.CreatedBy = &user.ID
+	org.UpdatedBy = &user.ID
+
+	return tx.Commit(ctx)
 }
 
 func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	user := &models.User{}
 	err := r.db.QueryRow(ctx, `
-		SELECT id, org_id, email, name, password_hash, avatar_url, role, provider, provider_id, created_at, updated_at, last_login_at
+		SELECT id, org_id, email, name, password_hash, avatar_url, role, provider, provider_id, created_at, updated_at, last_login_at, token_epoch
 		FROM users WHERE id = $1
-	`, id).Scan(&user.ID, &user.OrgID, &user.Email, &user.Name, &user.PasswordHash, &user.AvatarURL, &user.Role, &user.Provider, &user.ProviderID, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt)
-	return user, err
+	`, id).Scan(&user.ID, &user.OrgID, &user.Email, &user.Name, &user.PasswordHash, &user.AvatarURL, &user.Role, &user.Provider, &user.ProviderID, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt, &user.TokenEpoch)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return user, nil
 }
 
 func (r *userRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	user := &models.User{}
 	err := r.db.QueryRow(ctx, `
-		SELECT id, org_id, email, name, password_hash, avatar_url, role, provider, provider_id, created_at, updated_at, last_login_at
+		SELECT id, org_id, email, name, password_hash, avatar_url, role, provider, provider_id, created_at, updated_at, last_login_at, token_epoch
 		FROM users WHERE email = $1
-	`, email).Scan(&user.ID, &user.OrgID, &user.Email, &user.Name, &user.PasswordHash, &user.AvatarURL, &user.Role, &user.Provider, &user.ProviderID, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt)
-	return user, err
+	`, email).Scan(&user.ID, &user.OrgID, &user.Email, &user.Name, &user.PasswordHash, &user.AvatarURL, &user.Role, &user.Provider, &user.ProviderID, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt, &user.TokenEpoch)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return user, nil
+}
+
+// GetByProvider returns the user who signs in with the identity provider
+// account
+func (r *userRepository) GetByProvider(ctx context.Context, provider, providerID string) (*models.User, error) {
+	user := &models.User{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, org_id, email, name, password_hash, avatar_url, role, provider, provider_id, created_at, updated_at, last_login_at, token_epoch
+		FROM users WHERE provider = $1 AND provider_id = $2
+	`, provider, providerID).Scan(&user.ID, &user.OrgID, &user.Email, &user.Name, &user.PasswordHash, &user.AvatarURL, &user.Role, &user.Provider, &user.ProviderID, &user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt, &user.TokenEpoch)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return user, nil
+}
+
+// LinkProvider lets the user sign in with an identity provider account in
+// addition to any password they have
+func (r *userRepository) LinkProvider(ctx context.Context, id uuid.UUID, provider, providerID string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE users SET provider = $2, provider_id = $3, updated_at = NOW() WHERE id = $1
+	`, id, provider, providerID)
+	return err
 }
 
 func (r *userRepository) Update(ctx context.Context, user *models.User) error {
@@ -199,13 +525,46 @@ func (r *userRepository) UpdateLastLogin(ctx context.Context, id uuid.UUID) erro
 	return err
 }
 
-func (r *userRepository) ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.User, error) {
+func (r *userRepository) UpdatePasswordHash(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	_, err := r.db.Exec(ctx, `UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`, id, passwordHash)
+	return err
+}
+
+// BumpTokenEpoch invalidates every refresh token issued to the user and
+// revokes their sessions
+func (r *userRepository) BumpTokenEpoch(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET token_epoch = token_epoch + 1, updated_at = NOW() WHERE id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE refresh_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL
+	`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListByOrgID returns one page of the organization's members, oldest first,
+// and the total member count
+func (r *userRepository) ListByOrgID(ctx context.Context, orgID uuid.UUID, params models.PaginationParams) ([]*models.User, int, error) {
+	offset := (params.Page - 1) * params.PageSize
+
 	rows, err := r.db.Query(ctx, `
-		SELECT id, org_id, email, name, avatar_url, role, created_at, updated_at
-		FROM users WHERE org_id = $1
-	`, orgID)
+		SELECT u.id, u.org_id, u.email, u.name, u.avatar_url, m.role, u.created_at, u.updated_at
+		FROM users u JOIN memberships m ON m.user_id = u.id
+		WHERE m.org_id = $1
+		ORDER BY m.created_at, u.id
+		LIMIT $2 OFFSET $3
+	`, orgID, params.PageSize, offset)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
@@ -213,11 +572,21 @@ func (r *userRepository) ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*m
 	for rows.Next() {
 		user := &models.User{}
 		if err := rows.Scan(&user.ID, &user.OrgID, &user.Email, &user.Name, &user.AvatarURL, &user.Role, &user.CreatedAt, &user.UpdatedAt); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		users = append(users, user)
 	}
-	return users, nil
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM memberships WHERE org_id = $1
+	`, orgID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
 }
 
 type organizationRepository struct {
@@ -226,447 +595,2461 @@ type organizationRepository struct {
 
 func (r *organizationRepository) Create(ctx context.Context, org *models.Organization) error {
 	_, err := r.db.Exec(ctx, `
-		INSERT INTO organizations (id, name, slug, plan, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, NOW(), NOW())
-	`, org.ID, org.Name, org.Slug, org.Plan)
+		INSERT INTO organizations (id, name, slug, plan, created_by, updated_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+	`, org.ID, org.Name, org.Slug, org.Plan, org.CreatedBy, org.UpdatedBy)
 	return err
 }
 
 func (r *organizationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
 	org := &models.Organization{}
 	err := r.db.QueryRow(ctx, `
-		SELECT id, name, slug, plan, created_at, updated_at FROM organizations WHERE id = $1
-	`, id).Scan(&org.ID, &org.Name, &org.Slug, &org.Plan, &org.CreatedAt, &org.UpdatedAt)
-	return org, err
+		SELECT id, name, slug, plan, COALESCE(settings, '{}'), created_by, updated_by, created_at, updated_at FROM organizations WHERE id = $1
+	`, id).Scan(&org.ID, &org.Name, &org.Slug, &org.Plan, &org.Settings, &org.CreatedBy, &org.UpdatedBy, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return org, nil
 }
 
 func (r *organizationRepository) GetBySlug(ctx context.Context, slug string) (*models.Organization, error) {
 	org := &models.Organization{}
 	err := r.db.QueryRow(ctx, `
-		SELECT id, name, slug, plan, created_at, updated_at FROM organizations WHERE slug = $1
-	`, slug).Scan(&org.ID, &org.Name, &org.Slug, &org.Plan, &org.CreatedAt, &org.UpdatedAt)
-	return org, err
+		SELECT id, name, slug, plan, COALESCE(settings, '{}'), created_by, updated_by, created_at, updated_at FROM organizations WHERE slug = $1
+	`, slug).Scan(&org.ID, &org.Name, &org.Slug, &org.Plan, &org.Settings, &org.CreatedBy, &org.UpdatedBy, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return org, nil
 }
 
 func (r *organizationRepository) Update(ctx context.Context, org *models.Organization) error {
 	_, err := r.db.Exec(ctx, `
-		UPDATE organizations SET name = $2, plan = $3, updated_at = NOW() WHERE id = $1
-	`, org.ID, org.Name, org.Plan)
+		UPDATE organizations SET name = $2, plan = $3, settings = $4, updated_by = $5, updated_at = NOW() WHERE id = $1
+	`, org.ID, org.Name, org.Plan, org.Settings, org.UpdatedBy)
 	return err
 }
 
-type agentRepository struct {
-	db *pgxpool.Pool
-}
-
-func (r *agentRepository) Create(ctx context.Context, agent *models.Agent) error {
+func (r *organizationRepository) SetAgentTokenHash(ctx context.Context, id uuid.UUID, hash string, updatedBy uuid.UUID) error {
 	_, err := r.db.Exec(ctx, `
-		INSERT INTO agents (id, user_id, name, description, avatar_url, status, confidence_threshold, auto_mode, working_hours, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
-	`, agent.ID, agent.UserID, agent.Name, agent.Description, agent.AvatarURL, agent.Status, agent.ConfidenceThreshold, agent.AutoMode, agent.WorkingHours)
+		UPDATE organizations SET agent_token_hash = $2, agent_token_rotated_at = NOW(), updated_by = $3, updated_at = NOW() WHERE id = $1
+	`, id, hash, updatedBy)
 	return err
 }
 
-func (r *agentRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Agent, error) {
-	agent := &models.Agent{}
+func (r *organizationRepository) GetByAgentTokenHash(ctx context.Context, hash string) (*models.Organization, error) {
+	org := &models.Organization{}
 	err := r.db.QueryRow(ctx, `
-		SELECT id, user_id, name, description, avatar_url, status, confidence_threshold, auto_mode, working_hours, created_at, updated_at
-		FROM agents WHERE id = $1
-	`, id).Scan(&agent.ID, &agent.UserID, &agent.Name, &agent.Description, &agent.AvatarURL, &agent.Status, &agent.ConfidenceThreshold, &agent.AutoMode, &agent.WorkingHours, &agent.CreatedAt, &agent.UpdatedAt)
-	return agent, err
-}
-
-func (r *agentRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Agent, error) {
-	rows, err := r.db.Query(ctx, `
-		SELECT id, user_id, name, description, avatar_url, status, confidence_threshold, auto_mode, working_hours, created_at, updated_at
-		FROM agents WHERE user_id = $1 ORDER BY created_at DESC
-	`, userID)
+		SELECT id, name, slug, plan, COALESCE(settings, '{}'), created_by, updated_by, created_at, updated_at FROM organizations WHERE agent_token_hash = $1
+	`, hash).Scan(&org.ID, &org.Name, &org.Slug, &org.Plan, &org.Settings, &org.CreatedBy, &org.UpdatedBy, &org.CreatedAt, &org.UpdatedAt)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
-	defer rows.Close()
+	return org, nil
+}
 
-	var agents []*models.Agent
-	for rows.Next() {
-		agent := &models.Agent{}
-		if err := rows.Scan(&agent.ID, &agent.UserID, &agent.Name, &agent.Description, &agent.AvatarURL, &agent.Status, &agent.ConfidenceThreshold, &agent.AutoMode, &agent.WorkingHours, &agent.CreatedAt, &agent.UpdatedAt); err != nil {
-			return nil, err
-		}
-		agents = append(agents, agent)
+func (r *organizationRepository) GetRetentionPolicy(ctx context.Context, id uuid.UUID) (*models.RetentionPolicy, error) {
+	policy := &models.RetentionPolicy{}
+	err := r.db.QueryRow(ctx, `
+		SELECT plan, retention_days, COALESCE(legal_hold, false) FROM organizations WHERE id = $1
+	`, id).Scan(&policy.Plan, &policy.RetentionDays, &policy.LegalHold)
+	if err != nil {
+		return nil, notFound(err)
 	}
-	return agents, nil
+	return policy, nil
 }
 
-func (r *agentRepository) Update(ctx context.Context, agent *models.Agent) error {
+func (r *organizationRepository) UpdateRetentionPolicy(ctx context.Context, id uuid.UUID, retentionDays *int, legalHold bool, updatedBy uuid.UUID) error {
 	_, err := r.db.Exec(ctx, `
-		UPDATE agents SET name = $2, description = $3, avatar_url = $4, status = $5, confidence_threshold = $6, auto_mode = $7, working_hours = $8, updated_at = NOW()
-		WHERE id = $1
-	`, agent.ID, agent.Name, agent.Description, agent.AvatarURL, agent.Status, agent.ConfidenceThreshold, agent.AutoMode, agent.WorkingHours)
-	return err
-}
-
-func (r *agentRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.Exec(ctx, `DELETE FROM agents WHERE id = $1`, id)
+		UPDATE organizations SET retention_days = $2, legal_hold = $3, updated_by = $4, updated_at = NOW() WHERE id = $1
+	`, id, retentionDays, legalHold, updatedBy)
 	return err
 }
 
-type integrationRepository struct {
-	db *pgxpool.Pool
+func (r *organizationRepository) GetAgentDefaults(ctx context.Context, id uuid.UUID) (*models.AgentDefaults, error) {
+	defaults := &models.AgentDefaults{}
+	err := r.db.QueryRow(ctx, `
+		SELECT COALESCE(agent_defaults, '{}') FROM organizations WHERE id = $1
+	`, id).Scan(defaults)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return defaults, nil
 }
 
-func (r *integrationRepository) Create(ctx context.Context, i *models.Integration) error {
+func (r *organizationRepository) UpdateAgentDefaults(ctx context.Context, id uuid.UUID, defaults *models.AgentDefaults, updatedBy uuid.UUID) error {
 	_, err := r.db.Exec(ctx, `
-		INSERT INTO integrations (id, agent_id, provider, access_token, refresh_token, scopes, status, external_id, metadata, created_at, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), $10)
-	`, i.ID, i.AgentID, i.Provider, i.AccessToken, i.RefreshToken, i.Scopes, i.Status, i.ExternalID, i.Metadata, i.ExpiresAt)
+		UPDATE organizations SET agent_defaults = $2, updated_by = $3, updated_at = NOW() WHERE id = $1
+	`, id, defaults, updatedBy)
 	return err
 }
 
-func (r *integrationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Integration, error) {
-	i := &models.Integration{}
-	err := r.db.QueryRow(ctx, `
-		SELECT id, agent_id, provider, access_token, refresh_token, scopes, status, external_id, metadata, created_at, expires_at
-		FROM integrations WHERE id = $1
-	`, id).Scan(&i.ID, &i.AgentID, &i.Provider, &i.AccessToken, &i.RefreshToken, &i.Scopes, &i.Status, &i.ExternalID, &i.Metadata, &i.CreatedAt, &i.ExpiresAt)
-	return i, err
-}
-
-func (r *integrationRepository) GetByAgentAndProvider(ctx context.Context, agentID uuid.UUID, provider string) (*models.Integration, error) {
-	i := &models.Integration{}
-	err := r.db.QueryRow(ctx, `
-		SELECT id, agent_id, provider, access_token, refresh_token, scopes, status, external_id, metadata, created_at, expires_at
-		FROM integrations WHERE agent_id = $1 AND provider = $2
-	`, agentID, provider).Scan(&i.ID, &i.AgentID, &i.Provider, &i.AccessToken, &i.RefreshToken, &i.Scopes, &i.Status, &i.ExternalID, &i.Metadata, &i.CreatedAt, &i.ExpiresAt)
-	return i, err
-}
+// PurgeExpired deletes resolved escalations and interactions older than each
+// organization's retention window. Agents belong to their owner's home
+// organization. Organizations on legal hold are skipped, and interactions
+// with a pending escalation are kept until it is resolved.
+func (r *organizationRepository) PurgeExpired(ctx context.Context, planDefaults map[string]int) (*models.PurgeResult, error) {
+	defaults, err := json.Marshal(planDefaults)
+	if err != nil {
+		return nil, err
+	}
 
-func (r *integrationRepository) ListByAgentID(ctx context.Context, agentID uuid.UUID) ([]*models.Integration, error) {
-	rows, err := r.db.Query(ctx, `
-		SELECT id, agent_id, provider, scopes, status, external_id, metadata, created_at, expires_at
-		FROM integrations WHERE agent_id = $1
-	`, agentID)
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	defer tx.Rollback(ctx)
+
+	const expiredAgents = `
+		WITH windows AS (
+			SELECT id, COALESCE(retention_days, ($1::jsonb ->> plan)::int) AS days
+			FROM organizations
+			WHERE NOT COALESCE(legal_hold, false)
+		)
+		SELECT a.id, NOW() - INTERVAL '1 day' * w.days AS cutoff
+		FROM agents a
+		JOIN windows w ON w.id = a.org_id
+		WHERE w.days IS NOT NULL`
+
+	result := &models.PurgeResult{}
+
+	tag, err := tx.Exec(ctx, `
+		WITH expired AS (`+expiredAgents+`)
+		DELETE FROM escalations e USING expired x
+		WHERE e.agent_id = x.id AND e.status <> 'pending' AND e.created_at < x.cutoff
+	`, defaults)
+	if err != nil {
+		return nil, err
+	}
+	result.Escalations = tag.RowsAffected()
+
+	tag, err = tx.Exec(ctx, `
+		WITH expired AS (`+expiredAgents+`)
+		DELETE FROM interactions i USING expired x
+		WHERE i.agent_id = x.id AND i.created_at < x.cutoff
+			AND NOT EXISTS (SELECT 1 FROM escalations e WHERE e.interaction_id = i.id AND e.status = 'pending')
+	`, defaults)
+	if err != nil {
+		return nil, err
+	}
+	result.Interactions = tag.RowsAffected()
 
-	var integrations []*models.Integration
-	for rows.Next() {
-		i := &models.Integration{}
-		if err := rows.Scan(&i.ID, &i.AgentID, &i.Provider, &i.Scopes, &i.Status, &i.ExternalID, &i.Metadata, &i.CreatedAt, &i.ExpiresAt); err != nil {
-			return nil, err
-		}
-		integrations = append(integrations, i)
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
 	}
-	return integrations, nil
+	return result, nil
 }
 
-func (r *integrationRepository) Update(ctx context.Context, i *models.Integration) error {
-	_, err := r.db.Exec(ctx, `
-		UPDATE integrations SET access_token = $2, refresh_token = $3, status = $4, expires_at = $5
-		WHERE id = $1
-	`, i.ID, i.AccessToken, i.RefreshToken, i.Status, i.ExpiresAt)
-	return err
-}
+// orgAgents selects the agents of organization $1
+const orgAgents = `SELECT id FROM agents WHERE org_id = $1`
 
-func (r *integrationRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.Exec(ctx, `DELETE FROM integrations WHERE id = $1`, id)
-	return err
+// GetFeatureFlags returns the flags explicitly set for the organization
+func (r *organizationRepository) GetFeatureFlags(ctx context.Context, id uuid.UUID) (map[string]bool, error) {
+	flags := map[string]bool{}
+	err := r.db.QueryRow(ctx, `
+		SELECT COALESCE(feature_flags, '{}') FROM organizations WHERE id = $1
+	`, id).Scan(&flags)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return flags, nil
 }
 
-type interactionRepository struct {
-	db *pgxpool.Pool
+// SetFeatureFlag sets a flag for the organization; nil removes it so the
+// built-in default applies again
+func (r *organizationRepository) SetFeatureFlag(ctx context.Context, id uuid.UUID, flag string, enabled *bool) error {
+	var tag pgconn.CommandTag
+	var err error
+	if enabled == nil {
+		tag, err = r.db.Exec(ctx, `
+			UPDATE organizations SET feature_flags = COALESCE(feature_flags, '{}') - $2::text, updated_at = NOW()
+			WHERE id = $1
+		`, id, flag)
+	} else {
+		tag, err = r.db.Exec(ctx, `
+			UPDATE organizations SET feature_flags = COALESCE(feature_flags, '{}') || jsonb_build_object($2::text, $3::boolean), updated_at = NOW()
+			WHERE id = $1
+		`, id, flag, *enabled)
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
-func (r *interactionRepository) Create(ctx context.Context, i *models.Interaction) error {
-	_, err := r.db.Exec(ctx, `
-		INSERT INTO interactions (id, agent_id, integration_id, provider, interaction_type, input_data, output_data, confidence_score, status, escalated, human_feedback, processing_time, created_at, completed_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW(), $13)
-	`, i.ID, i.AgentID, i.IntegrationID, i.Provider, i.InteractionType, i.InputData, i.OutputData, i.ConfidenceScore, i.Status, i.Escalated, i.HumanFeedback, i.ProcessingTime, i.CompletedAt)
-	return err
-}
+// PauseAgents marks the organization paused and pauses its active agents,
+// flagging them so ResumeAgents restores only those. It returns the IDs of
+// the agents it paused.
+func (r *organizationRepository) PauseAgents(ctx context.Context, id, pausedBy uuid.UUID) ([]uuid.UUID, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
 
-func (r *interactionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Interaction, error) {
-	i := &models.Interaction{}
-	err := r.db.QueryRow(ctx, `
-		SELECT id, agent_id, integration_id, provider, interaction_type, input_data, output_data, confidence_score, status, escalated, human_feedback, processing_time, created_at, completed_at
-		FROM interactions WHERE id = $1
-	`, id).Scan(&i.ID, &i.AgentID, &i.IntegrationID, &i.Provider, &i.InteractionType, &i.InputData, &i.OutputData, &i.ConfidenceScore, &i.Status, &i.Escalated, &i.HumanFeedback, &i.ProcessingTime, &i.CreatedAt, &i.CompletedAt)
-	return i, err
+	tag, err := tx.Exec(ctx, `
+		UPDATE organizations SET agents_paused_at = NOW(), agents_paused_by = $2, updated_at = NOW()
+		WHERE id = $1 AND agents_paused_at IS NULL
+	`, id, pausedBy)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, r.pauseStateError(ctx, tx, id, ErrAgentsAlreadyPaused)
+	}
+
+	ids, err := collectIDs(tx.Query(ctx, `
+		UPDATE agents SET status = 'paused', paused_by_org = true, updated_at = NOW()
+		WHERE status = 'active' AND id IN (`+orgAgents+`)
+		RETURNING id
+	`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ids, nil
 }
 
-func (r *interactionRepository) ListByAgentID(ctx context.Context, agentID uuid.UUID, params models.PaginationParams) ([]*models.Interaction, int, error) {
-	offset := (params.Page - 1) * params.PageSize
+// ResumeAgents clears the organization pause and reactivates the agents
+// PauseAgents paused that are still paused. It returns their IDs.
+func (r *organizationRepository) ResumeAgents(ctx context.Context, id uuid.UUID) ([]uuid.UUID, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
 
-	rows, err := r.db.Query(ctx, `
-		SELECT id, agent_id, integration_id, provider, interaction_type, input_data, output_data, confidence_score, status, escalated, human_feedback, processing_time, created_at, completed_at
-		FROM interactions WHERE agent_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
-	`, agentID, params.PageSize, offset)
+	tag, err := tx.Exec(ctx, `
+		UPDATE organizations SET agents_paused_at = NULL, agents_paused_by = NULL, updated_at = NOW()
+		WHERE id = $1 AND agents_paused_at IS NOT NULL
+	`, id)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, r.pauseStateError(ctx, tx, id, ErrAgentsNotPaused)
 	}
-	defer rows.Close()
 
-	var interactions []*models.Interaction
-	for rows.Next() {
-		i := &models.Interaction{}
-		if err := rows.Scan(&i.ID, &i.AgentID, &i.IntegrationID, &i.Provider, &i.InteractionType, &i.InputData, &i.OutputData, &i.ConfidenceScore, &i.Status, &i.Escalated, &i.HumanFeedback, &i.ProcessingTime, &i.CreatedAt, &i.CompletedAt); err != nil {
-			return nil, 0, err
-		}
-		interactions = append(interactions, i)
+	ids, err := collectIDs(tx.Query(ctx, `
+		UPDATE agents SET status = 'active', updated_at = NOW()
+		WHERE paused_by_org AND status = 'paused' AND id IN (`+orgAgents+`)
+		RETURNING id
+	`, id))
+	if err != nil {
+		return nil, err
 	}
 
-	var total int
-	r.db.QueryRow(ctx, `SELECT COUNT(*) FROM interactions WHERE agent_id = $1`, agentID).Scan(&total)
+	// Agents changed by hand while paused keep their new status
+	if _, err := tx.Exec(ctx, `
+		UPDATE agents SET paused_by_org = false WHERE paused_by_org AND id IN (`+orgAgents+`)
+	`, id); err != nil {
+		return nil, err
+	}
 
-	return interactions, total, nil
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ids, nil
 }
 
-func (r *interactionRepository) Update(ctx context.Context, i *models.Interaction) error {
+// pauseStateError distinguishes a missing organization from one already in
+// the requested pause state
+func (r *organizationRepository) pauseStateError(ctx context.Context, tx pgx.Tx, id uuid.UUID, stateErr error) error {
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM organizations WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return stateErr
+}
+
+// collectIDs reads a single UUID column from every row
+func collectIDs(rows pgx.Rows, err error) ([]uuid.UUID, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+type agentRepository struct {
+	db *pgxpool.Pool
+}
+
+func (r *agentRepository) Create(ctx context.Context, agent *models.Agent) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO agents (id, user_id, org_id, name, description, avatar_url, status, confidence_threshold, provider_thresholds, auto_mode, working_hours, audit_sample_rate, model, created_by, updated_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NOW(), NOW())
+	`, agent.ID, agent.UserID, agent.OrgID, agent.Name, agent.Description, agent.AvatarURL, agent.Status, agent.ConfidenceThreshold, agent.ProviderThresholds, agent.AutoMode, agent.WorkingHours, agent.AuditSampleRate, agent.Model, agent.CreatedBy, agent.UpdatedBy)
+	return err
+}
+
+func (r *agentRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Agent, error) {
+	agent := &models.Agent{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, user_id, org_id, name, description, avatar_url, status, confidence_threshold, provider_thresholds, auto_mode, working_hours, COALESCE(audit_sample_rate, 0), model, created_by, updated_by, created_at, updated_at
+		FROM agents WHERE id = $1
+	`, id).Scan(&agent.ID, &agent.UserID, &agent.OrgID, &agent.Name, &agent.Description, &agent.AvatarURL, &agent.Status, &agent.ConfidenceThreshold, &agent.ProviderThresholds, &agent.AutoMode, &agent.WorkingHours, &agent.AuditSampleRate, &agent.Model, &agent.CreatedBy, &agent.UpdatedBy, &agent.CreatedAt, &agent.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return agent, nil
+}
+
+func (r *agentRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Agent, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, user_id, org_id, name, description, avatar_url, status, confidence_threshold, provider_thresholds, auto_mode, working_hours, COALESCE(audit_sample_rate, 0), model, created_by, updated_by, created_at, updated_at
+		FROM agents WHERE user_id = $1 ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var agents []*models.Agent
+	for rows.Next() {
+		agent := &models.Agent{}
+		if err := rows.Scan(&agent.ID, &agent.UserID, &agent.OrgID, &agent.Name, &agent.Description, &agent.AvatarURL, &agent.Status, &agent.ConfidenceThreshold, &agent.ProviderThresholds, &agent.AutoMode, &agent.WorkingHours, &agent.AuditSampleRate, &agent.Model, &agent.CreatedBy, &agent.UpdatedBy, &agent.CreatedAt, &agent.UpdatedAt); err != nil {
+			return nil, err
+		}
+		agents = append(agents, agent)
+	}
+	return agents, nil
+}
+
+// ListByOrgID returns the agents of the organization
+func (r *agentRepository) ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.Agent, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT a.id, a.user_id, a.org_id, a.name, a.description, a.avatar_url, a.status, a.confidence_threshold, a.provider_thresholds, a.auto_mode, a.working_hours, COALESCE(a.audit_sample_rate, 0), a.model, a.created_by, a.updated_by, a.created_at, a.updated_at
+		FROM agents a
+		WHERE a.org_id = $1 ORDER BY a.created_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var agents []*models.Agent
+	for rows.Next() {
+		agent := &models.Agent{}
+		if err := rows.Scan(&agent.ID, &agent.UserID, &agent.OrgID, &agent.Name, &agent.Description, &agent.AvatarURL, &agent.Status, &agent.ConfidenceThreshold, &agent.ProviderThresholds, &agent.AutoMode, &agent.WorkingHours, &agent.AuditSampleRate, &agent.Model, &agent.CreatedBy, &agent.UpdatedBy, &agent.CreatedAt, &agent.UpdatedAt); err != nil {
+			return nil, err
+		}
+		agents = append(agents, agent)
+	}
+	return agents, nil
+}
+
+func (r *agentRepository) Update(ctx context.Context, agent *models.Agent) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE agents SET name = $2, description = $3, avatar_url = $4, status = $5, confidence_threshold = $6, provider_thresholds = $7, auto_mode = $8, working_hours = $9, audit_sample_rate = $10, model = $11, updated_by = $12, updated_at = NOW()
+		WHERE id = $1
+	`, agent.ID, agent.Name, agent.Description, agent.AvatarURL, agent.Status, agent.ConfidenceThreshold, agent.ProviderThresholds, agent.AutoMode, agent.WorkingHours, agent.AuditSampleRate, agent.Model, agent.UpdatedBy)
+	return err
+}
+
+// UpdateSettings stores the escalation and scheduling settings of every agent
+// in one transaction, so a bulk change is applied to all of them or none.
+// Other fields are left untouched.
+func (r *agentRepository) UpdateSettings(ctx context.Context, agents []*models.Agent) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, agent := range agents {
+		if _, err := tx.Exec(ctx, `
+			UPDATE agents SET confidence_threshold = $2, provider_thresholds = $3, auto_mode = $4, working_hours = $5, audit_sample_rate = $6, updated_by = $7, updated_at = NOW()
+			WHERE id = $1
+		`, agent.ID, agent.ConfidenceThreshold, agent.ProviderThresholds, agent.AutoMode, agent.WorkingHours, agent.AuditSampleRate, agent.UpdatedBy); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// agentDependents are the tables with rows belonging to an agent, children
+// first. The schema cascades agent deletes to all of them; Delete removes
+// them explicitly too so a database missing a constraint is not left with
+// orphans.
+var agentDependents = []string{
+	"escalations",
+	"interaction_replays",
+	"interactions",
+	"training_samples",
+	"knowledge_base",
+	"escalation_routing_rules",
+	"escalation_priority_rules",
+	"maintenance_windows",
+	"agent_integrations",
+	"integrations",
+}
+
+// Delete removes the agent and every row belonging to it in one transaction
+func (r *agentRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range agentDependents {
+		if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE agent_id = $1`, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM agents WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// orphanChecks select the orphaned rows of each table, ordered so purging a
+// parent before its children also catches children orphaned by that purge
+var orphanChecks = []struct {
+	table string
+	where string
+	count func(*models.OrphanCounts) *int64
+}{
+	{"interactions", `NOT EXISTS (SELECT 1 FROM agents a WHERE a.id = t.agent_id)`,
+		func(c *models.OrphanCounts) *int64 { return &c.Interactions }},
+	{"integrations", `NOT EXISTS (SELECT 1 FROM agents a WHERE a.id = t.agent_id)`,
+		func(c *models.OrphanCounts) *int64 { return &c.Integrations }},
+	{"escalations", `NOT EXISTS (SELECT 1 FROM agents a WHERE a.id = t.agent_id)
+		OR NOT EXISTS (SELECT 1 FROM interactions i WHERE i.id = t.interaction_id)`,
+		func(c *models.OrphanCounts) *int64 { return &c.Escalations }},
+	{"interaction_replays", `NOT EXISTS (SELECT 1 FROM agents a WHERE a.id = t.agent_id)
+		OR NOT EXISTS (SELECT 1 FROM interactions i WHERE i.id = t.interaction_id)`,
+		func(c *models.OrphanCounts) *int64 { return &c.Replays }},
+	{"training_samples", `NOT EXISTS (SELECT 1 FROM agents a WHERE a.id = t.agent_id)`,
+		func(c *models.OrphanCounts) *int64 { return &c.TrainingSamples }},
+	{"knowledge_base", `NOT EXISTS (SELECT 1 FROM agents a WHERE a.id = t.agent_id)`,
+		func(c *models.OrphanCounts) *int64 { return &c.KnowledgeBase }},
+	{"escalation_routing_rules", `t.agent_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM agents a WHERE a.id = t.agent_id)`,
+		func(c *models.OrphanCounts) *int64 { return &c.RoutingRules }},
+	{"escalation_priority_rules", `t.agent_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM agents a WHERE a.id = t.agent_id)`,
+		func(c *models.OrphanCounts) *int64 { return &c.PriorityRules }},
+	{"maintenance_windows", `t.agent_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM agents a WHERE a.id = t.agent_id)`,
+		func(c *models.OrphanCounts) *int64 { return &c.MaintenanceWindows }},
+	{"agent_integrations", `NOT EXISTS (SELECT 1 FROM agents a WHERE a.id = t.agent_id)
+		OR NOT EXISTS (SELECT 1 FROM integrations i WHERE i.id = t.integration_id)`,
+		func(c *models.OrphanCounts) *int64 { return &c.SharedIntegrations }},
+}
+
+// CountOrphans counts rows left pointing at a deleted agent, interaction or
+// integration
+func (r *agentRepository) CountOrphans(ctx context.Context) (*models.OrphanCounts, error) {
+	counts := &models.OrphanCounts{}
+	for _, check := range orphanChecks {
+		if err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM `+check.table+` t WHERE `+check.where).Scan(check.count(counts)); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// PurgeOrphans deletes the rows CountOrphans counts in one transaction and
+// returns how many were deleted
+func (r *agentRepository) PurgeOrphans(ctx context.Context) (*models.OrphanCounts, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	counts := &models.OrphanCounts{}
+	for _, check := range orphanChecks {
+		tag, err := tx.Exec(ctx, `DELETE FROM `+check.table+` t WHERE `+check.where)
+		if err != nil {
+			return nil, err
+		}
+		*check.count(counts) = tag.RowsAffected()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// IsOrgPaused reports whether the agent's organization has paused all of its
+// agents
+func (r *agentRepository) IsOrgPaused(ctx context.Context, id uuid.UUID) (bool, error) {
+	var paused bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM agents a
+			JOIN organizations o ON o.id = a.org_id
+			WHERE a.id = $1 AND o.agents_paused_at IS NOT NULL
+		)
+	`, id).Scan(&paused)
+	return paused, err
+}
+
+type integrationRepository struct {
+	db      *pgxpool.Pool
+	secrets *crypto.Keyring
+}
+
+// sealTokens returns the integration's tokens encrypted for storage
+func (r *integrationRepository) sealTokens(i *models.Integration) (string, *string, error) {
+	accessToken, err := sealSecret(r.secrets, i.AccessToken)
+	if err != nil {
+		return "", nil, err
+	}
+	refreshToken, err := sealOptionalSecret(r.secrets, i.RefreshToken)
+	if err != nil {
+		return "", nil, err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// openTokens decrypts the tokens of an integration read from storage
+func (r *integrationRepository) openTokens(i *models.Integration) error {
+	var err error
+	if i.AccessToken, err = openSecret(r.secrets, i.AccessToken); err != nil {
+		return err
+	}
+	i.RefreshToken, err = openOptionalSecret(r.secrets, i.RefreshToken)
+	return err
+}
+
+func (r *integrationRepository) Create(ctx context.Context, i *models.Integration) error {
+	if err := models.ValidateIntegrationMetadata(i.Provider, i.Metadata); err != nil {
+		return err
+	}
+	accessToken, refreshToken, err := r.sealTokens(i)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(ctx, `
+		INSERT INTO integrations (id, agent_id, provider, access_token, refresh_token, scopes, status, external_id, metadata, passive, enabled, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), $12)
+	`, i.ID, i.AgentID, i.Provider, accessToken, refreshToken, i.Scopes, i.Status, i.ExternalID, i.Metadata, i.Passive, i.Enabled, i.ExpiresAt)
+	return err
+}
+
+func (r *integrationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Integration, error) {
+	i := &models.Integration{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, agent_id, provider, access_token, refresh_token, scopes, status, external_id, metadata, COALESCE(passive, false), enabled, route_token_hash, created_at, expires_at
+		FROM integrations WHERE id = $1
+	`, id).Scan(&i.ID, &i.AgentID, &i.Provider, &i.AccessToken, &i.RefreshToken, &i.Scopes, &i.Status, &i.ExternalID, &i.Metadata, &i.Passive, &i.Enabled, &i.RouteTokenHash, &i.CreatedAt, &i.ExpiresAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if err := r.openTokens(i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func (r *integrationRepository) GetByAgentAndProvider(ctx context.Context, agentID uuid.UUID, provider string) (*models.Integration, error) {
+	i := &models.Integration{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, agent_id, provider, access_token, refresh_token, scopes, status, external_id, metadata, COALESCE(passive, false), enabled, route_token_hash, created_at, expires_at
+		FROM integrations
+		WHERE provider = $2 AND (agent_id = $1 OR id IN (SELECT integration_id FROM agent_integrations WHERE agent_id = $1))
+		ORDER BY agent_id = $1 DESC
+		LIMIT 1
+	`, agentID, provider).Scan(&i.ID, &i.AgentID, &i.Provider, &i.AccessToken, &i.RefreshToken, &i.Scopes, &i.Status, &i.ExternalID, &i.Metadata, &i.Passive, &i.Enabled, &i.RouteTokenHash, &i.CreatedAt, &i.ExpiresAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if err := r.openTokens(i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// ListByAgentID returns the integrations the agent owns and those it is
+// attached to
+func (r *integrationRepository) ListByAgentID(ctx context.Context, agentID uuid.UUID) ([]*models.Integration, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, agent_id, provider, scopes, status, external_id, metadata, COALESCE(passive, false), enabled, route_token_hash, created_at, expires_at
+		FROM integrations
+		WHERE agent_id = $1 OR id IN (SELECT integration_id FROM agent_integrations WHERE agent_id = $1)
+	`, agentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var integrations []*models.Integration
+	for rows.Next() {
+		i := &models.Integration{}
+		if err := rows.Scan(&i.ID, &i.AgentID, &i.Provider, &i.Scopes, &i.Status, &i.ExternalID, &i.Metadata, &i.Passive, &i.Enabled, &i.RouteTokenHash, &i.CreatedAt, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		integrations = append(integrations, i)
+	}
+	return integrations, nil
+}
+
+// integrationInWorkspace matches the integrations i of provider $1 connected
+// to external workspace $2: by external ID, or by the Slack team or the
+// Atlassian cloud ID or site URL in their metadata. Integration.InWorkspace
+// matches the same way.
+const integrationInWorkspace = `i.provider = $1 AND (i.external_id = $2 OR i.metadata->>'teamId' = $2
+	OR i.metadata->>'cloudId' = $2 OR RTRIM(i.metadata->>'siteUrl', '/') = $2)`
+
+// ListByExternalID returns every integration connected to an external
+// workspace, e.g. all agents installed in one Slack team or Jira site
+func (r *integrationRepository) ListByExternalID(ctx context.Context, provider, externalID string) ([]*models.Integration, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, agent_id, provider, scopes, status, external_id, metadata, COALESCE(passive, false), enabled, route_token_hash, created_at, expires_at
+		FROM integrations i
+		WHERE `+integrationInWorkspace+`
+	`, provider, externalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var integrations []*models.Integration
+	for rows.Next() {
+		i := &models.Integration{}
+		if err := rows.Scan(&i.ID, &i.AgentID, &i.Provider, &i.Scopes, &i.Status, &i.ExternalID, &i.Metadata, &i.Passive, &i.Enabled, &i.RouteTokenHash, &i.CreatedAt, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		integrations = append(integrations, i)
+	}
+	return integrations, rows.Err()
+}
+
+// GetByExternalID returns the integration connected to an external
+// workspace, such as a Slack team, GitHub account or Jira site. When several
+// agents connected to the workspace it returns the first connected;
+// ListByExternalID returns them all.
+func (r *integrationRepository) GetByExternalID(ctx context.Context, provider, externalID string) (*models.Integration, error) {
+	i := &models.Integration{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, agent_id, provider, scopes, status, external_id, metadata, COALESCE(passive, false), enabled, route_token_hash, created_at, expires_at
+		FROM integrations i
+		WHERE `+integrationInWorkspace+`
+		ORDER BY i.created_at, i.id
+		LIMIT 1
+	`, provider, externalID).Scan(&i.ID, &i.AgentID, &i.Provider, &i.Scopes, &i.Status, &i.ExternalID, &i.Metadata, &i.Passive, &i.Enabled, &i.RouteTokenHash, &i.CreatedAt, &i.ExpiresAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return i, nil
+}
+
+// ListExpiring returns refreshable integrations whose token expires before
+// the given time, soonest first. Integrations whose refresh already failed
+// for good are left for the user to reconnect.
+func (r *integrationRepository) ListExpiring(ctx context.Context, before time.Time, limit int) ([]*models.Integration, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, agent_id, provider, access_token, refresh_token, scopes, status, external_id, metadata, COALESCE(passive, false), enabled, route_token_hash, created_at, expires_at
+		FROM integrations
+		WHERE refresh_token IS NOT NULL AND expires_at < $1 AND status NOT IN ('expired', 'revoked')
+		ORDER BY expires_at
+		LIMIT $2
+	`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var integrations []*models.Integration
+	for rows.Next() {
+		i := &models.Integration{}
+		if err := rows.Scan(&i.ID, &i.AgentID, &i.Provider, &i.AccessToken, &i.RefreshToken, &i.Scopes, &i.Status, &i.ExternalID, &i.Metadata, &i.Passive, &i.Enabled, &i.RouteTokenHash, &i.CreatedAt, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if err := r.openTokens(i); err != nil {
+			return nil, err
+		}
+		integrations = append(integrations, i)
+	}
+	return integrations, rows.Err()
+}
+
+// OrgID returns the organization whose OAuth app an integration belongs to,
+// that of its owning agent
+func (r *integrationRepository) OrgID(ctx context.Context, integrationID uuid.UUID) (uuid.UUID, error) {
+	var orgID uuid.UUID
+	err := r.db.QueryRow(ctx, `
+		SELECT a.org_id
+		FROM integrations i
+		JOIN agents a ON a.id = i.agent_id
+		WHERE i.id = $1
+	`, integrationID).Scan(&orgID)
+	if err != nil {
+		return uuid.Nil, notFound(err)
+	}
+	return orgID, nil
+}
+
+func (r *integrationRepository) Update(ctx context.Context, i *models.Integration) error {
+	accessToken, refreshToken, err := r.sealTokens(i)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(ctx, `
+		UPDATE integrations SET access_token = $2, refresh_token = $3, status = $4, expires_at = $5
+		WHERE id = $1
+	`, i.ID, accessToken, refreshToken, i.Status, i.ExpiresAt)
+	return err
+}
+
+// UpgradeScopes stores the integration's new token and scopes and records
+// the scopes the grant added
+func (r *integrationRepository) UpgradeScopes(ctx context.Context, i *models.Integration, grant *models.IntegrationScopeGrant) error {
+	accessToken, err := sealSecret(r.secrets, i.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE integrations SET access_token = $2, scopes = $3, status = $4, expires_at = $5
+		WHERE id = $1
+	`, i.ID, accessToken, i.Scopes, i.Status, i.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO integration_scope_grants (id, integration_id, scopes, granted_by, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+	`, grant.ID, grant.IntegrationID, grant.Scopes, grant.GrantedBy)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *integrationRepository) ListScopeGrants(ctx context.Context, integrationID uuid.UUID) ([]*models.IntegrationScopeGrant, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, integration_id, scopes, granted_by, created_at
+		FROM integration_scope_grants WHERE integration_id = $1 ORDER BY created_at
+	`, integrationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []*models.IntegrationScopeGrant{}
+	for rows.Next() {
+		g := &models.IntegrationScopeGrant{}
+		if err := rows.Scan(&g.ID, &g.IntegrationID, &g.Scopes, &g.GrantedBy, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
+
+// UpdateMetadata validates and stores the integration's metadata
+func (r *integrationRepository) UpdateMetadata(ctx context.Context, i *models.Integration) error {
+	if err := models.ValidateIntegrationMetadata(i.Provider, i.Metadata); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(ctx, `UPDATE integrations SET metadata = $2 WHERE id = $1`, i.ID, i.Metadata)
+	return err
+}
+
+func (r *integrationRepository) SetPassive(ctx context.Context, id uuid.UUID, passive bool) error {
+	_, err := r.db.Exec(ctx, `UPDATE integrations SET passive = $2 WHERE id = $1`, id, passive)
+	return err
+}
+
+func (r *integrationRepository) SetEnabled(ctx context.Context, id uuid.UUID, enabled bool) error {
+	_, err := r.db.Exec(ctx, `UPDATE integrations SET enabled = $2 WHERE id = $1`, id, enabled)
+	return err
+}
+
+// SetRouteTokenHash sets the hash of the integration's webhook route token,
+// or removes the token when hash is nil
+func (r *integrationRepository) SetRouteTokenHash(ctx context.Context, id uuid.UUID, hash *string) error {
+	_, err := r.db.Exec(ctx, `UPDATE integrations SET route_token_hash = $2 WHERE id = $1`, id, hash)
+	return err
+}
+
+// GetByRouteTokenHash returns the integration whose webhook route token has
+// the given hash
+func (r *integrationRepository) GetByRouteTokenHash(ctx context.Context, hash string) (*models.Integration, error) {
+	i := &models.Integration{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, agent_id, provider, scopes, status, external_id, metadata, COALESCE(passive, false), enabled, route_token_hash, created_at, expires_at
+		FROM integrations WHERE route_token_hash = $1
+	`, hash).Scan(&i.ID, &i.AgentID, &i.Provider, &i.Scopes, &i.Status, &i.ExternalID, &i.Metadata, &i.Passive, &i.Enabled, &i.RouteTokenHash, &i.CreatedAt, &i.ExpiresAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return i, nil
+}
+
+// AttachAgent subscribes an agent to an integration it does not own.
+// Attaching an agent twice is a no-op.
+func (r *integrationRepository) AttachAgent(ctx context.Context, integrationID, agentID uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO agent_integrations (agent_id, integration_id, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT DO NOTHING
+	`, agentID, integrationID)
+	return err
+}
+
+func (r *integrationRepository) DetachAgent(ctx context.Context, integrationID, agentID uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, `
+		DELETE FROM agent_integrations WHERE agent_id = $1 AND integration_id = $2
+	`, agentID, integrationID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListAgentIDs returns the agents receiving an integration's events: its
+// owner first, then the attached agents in the order they were attached
+func (r *integrationRepository) ListAgentIDs(ctx context.Context, integrationID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT agent_id FROM (
+			SELECT agent_id, 0 AS attached, created_at FROM integrations WHERE id = $1
+			UNION ALL
+			SELECT agent_id, 1 AS attached, created_at FROM agent_integrations WHERE integration_id = $1
+		) subscribers
+		ORDER BY attached, created_at
+	`, integrationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var agentIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		agentIDs = append(agentIDs, id)
+	}
+	return agentIDs, rows.Err()
+}
+
+func (r *integrationRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM integrations WHERE id = $1`, id)
+	return err
+}
+
+type interactionRepository struct {
+	db      *pgxpool.Pool
+	replica *pgxpool.Pool // Read replica for analytics; may lag db
+}
+
+func (r *interactionRepository) Create(ctx context.Context, i *models.Interaction) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO interactions (id, agent_id, integration_id, provider, interaction_type, input_data, output_data, confidence_score, status, escalated, human_feedback, processing_time, skip_reason, deferred_window_id, created_at, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NOW(), $15)
+	`, i.ID, i.AgentID, i.IntegrationID, i.Provider, i.InteractionType, i.InputData, i.OutputData, i.ConfidenceScore, i.Status, i.Escalated, i.HumanFeedback, i.ProcessingTime, i.SkipReason, i.DeferredBy, i.CompletedAt)
+	return err
+}
+
+func (r *interactionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Interaction, error) {
+	i := &models.Interaction{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, agent_id, integration_id, provider, interaction_type, input_data, output_data, confidence_score, status, escalated, human_feedback, processing_time, error_message, skip_reason, corrected_output, corrected_by, corrected_at, created_at, completed_at
+		FROM interactions WHERE id = $1
+	`, id).Scan(&i.ID, &i.AgentID, &i.IntegrationID, &i.Provider, &i.InteractionType, &i.InputData, &i.OutputData, &i.ConfidenceScore, &i.Status, &i.Escalated, &i.HumanFeedback, &i.ProcessingTime, &i.ErrorMessage, &i.SkipReason, &i.CorrectedOutput, &i.CorrectedBy, &i.CorrectedAt, &i.CreatedAt, &i.CompletedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return i, nil
+}
+
+func (r *interactionRepository) ListByAgentID(ctx context.Context, agentID uuid.UUID, params models.PaginationParams) ([]*models.Interaction, int, error) {
+	offset := (params.Page - 1) * params.PageSize
+
+	rows, err := r.db.Query(ctx, `
+		SELECT id, agent_id, integration_id, provider, interaction_type, input_data, output_data, confidence_score, status, escalated, human_feedback, processing_time, error_message, skip_reason, corrected_output, corrected_by, corrected_at, created_at, completed_at
+		FROM interactions WHERE agent_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`, agentID, params.PageSize, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var interactions []*models.Interaction
+	for rows.Next() {
+		i := &models.Interaction{}
+		if err := rows.Scan(&i.ID, &i.AgentID, &i.IntegrationID, &i.Provider, &i.InteractionType, &i.InputData, &i.OutputData, &i.ConfidenceScore, &i.Status, &i.Escalated, &i.HumanFeedback, &i.ProcessingTime, &i.ErrorMessage, &i.SkipReason, &i.CorrectedOutput, &i.CorrectedBy, &i.CorrectedAt, &i.CreatedAt, &i.CompletedAt); err != nil {
+			return nil, 0, err
+		}
+		interactions = append(interactions, i)
+	}
+
+	var total int
+	if err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM interactions WHERE agent_id = $1`, agentID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	return interactions, total, nil
+}
+
+// ListByAgentIDsAfter returns up to limit interactions of the given agents,
+// newest first, starting after the cursor (or from the newest when nil)
+func (r *interactionRepository) ListByAgentIDsAfter(ctx context.Context, agentIDs []uuid.UUID, filter models.InteractionFilter, after *models.InteractionCursor, limit int) ([]*models.Interaction, error) {
+	var afterTime *time.Time
+	afterID := uuid.Nil
+	if after != nil {
+		afterTime = &after.CreatedAt
+		afterID = after.ID
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT id, agent_id, integration_id, provider, interaction_type, input_data, output_data, confidence_score, status, escalated, human_feedback, processing_time, error_message, skip_reason, corrected_output, corrected_by, corrected_at, created_at, completed_at
+		FROM interactions
+		WHERE agent_id = ANY($1)
+			AND ($2 = '' OR provider = $2)
+			AND ($3 = '' OR status = $3)
+			AND ($4::timestamptz IS NULL OR (created_at, id) < ($4, $5))
+			AND ($7::uuid IS NULL OR EXISTS (SELECT 1 FROM interaction_tags it WHERE it.interaction_id = interactions.id AND it.tag_id = $7))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $6
+	`, agentIDs, filter.Provider, filter.Status, afterTime, afterID, limit, filter.TagID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var interactions []*models.Interaction
+	for rows.Next() {
+		i := &models.Interaction{}
+		if err := rows.Scan(&i.ID, &i.AgentID, &i.IntegrationID, &i.Provider, &i.InteractionType, &i.InputData, &i.OutputData, &i.ConfidenceScore, &i.Status, &i.Escalated, &i.HumanFeedback, &i.ProcessingTime, &i.ErrorMessage, &i.SkipReason, &i.CorrectedOutput, &i.CorrectedBy, &i.CorrectedAt, &i.CreatedAt, &i.CompletedAt); err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, i)
+	}
+	return interactions, rows.Err()
+}
+
+func (r *interactionRepository) ListByOrgID(ctx context.Context, orgID uuid.UUID, filter models.InteractionFilter, params models.PaginationParams) ([]*models.OrgInteraction, int, error) {
+	offset := (params.Page - 1) * params.PageSize
+
+	rows, err := r.db.Query(ctx, `
+		SELECT i.id, i.agent_id, i.integration_id, i.provider, i.interaction_type, i.input_data, i.output_data, i.confidence_score, i.status, i.escalated, i.human_feedback, i.processing_time, i.error_message, i.skip_reason, i.corrected_output, i.corrected_by, i.corrected_at, i.created_at, i.completed_at,
+			a.name, u.id, u.name
+		FROM interactions i
+		JOIN agents a ON a.id = i.agent_id
+		JOIN users u ON u.id = a.user_id
+		WHERE a.org_id = $1
+			AND ($2::uuid IS NULL OR i.agent_id = $2)
+			AND ($3 = '' OR i.provider = $3)
+			AND ($4 = '' OR i.status = $4)
+			AND ($7::uuid IS NULL OR EXISTS (SELECT 1 FROM interaction_tags it WHERE it.interaction_id = i.id AND it.tag_id = $7))
+		ORDER BY i.created_at DESC
+		LIMIT $5 OFFSET $6
+	`, orgID, filter.AgentID, filter.Provider, filter.Status, params.PageSize, offset, filter.TagID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var interactions []*models.OrgInteraction
+	for rows.Next() {
+		i := &models.Interaction{}
+		oi := &models.OrgInteraction{Interaction: i}
+		if err := rows.Scan(&i.ID, &i.AgentID, &i.IntegrationID, &i.Provider, &i.InteractionType, &i.InputData, &i.OutputData, &i.ConfidenceScore, &i.Status, &i.Escalated, &i.HumanFeedback, &i.ProcessingTime, &i.ErrorMessage, &i.SkipReason, &i.CorrectedOutput, &i.CorrectedBy, &i.CorrectedAt, &i.CreatedAt, &i.CompletedAt,
+			&oi.AgentName, &oi.OwnerID, &oi.OwnerName); err != nil {
+			return nil, 0, err
+		}
+		interactions = append(interactions, oi)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM interactions i
+		JOIN agents a ON a.id = i.agent_id
+		WHERE a.org_id = $1
+			AND ($2::uuid IS NULL OR i.agent_id = $2)
+			AND ($3 = '' OR i.provider = $3)
+			AND ($4 = '' OR i.status = $4)
+			AND ($5::uuid IS NULL OR EXISTS (SELECT 1 FROM interaction_tags it WHERE it.interaction_id = i.id AND it.tag_id = $5))
+	`, orgID, filter.AgentID, filter.Provider, filter.Status, filter.TagID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	return interactions, total, nil
+}
+
+func (r *interactionRepository) ListByAgentInRange(ctx context.Context, agentID uuid.UUID, from, to time.Time, limit int) ([]*models.Interaction, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, agent_id, integration_id, provider, interaction_type, input_data, output_data, confidence_score, status, escalated, human_feedback, processing_time, error_message, skip_reason, corrected_output, corrected_by, corrected_at, created_at, completed_at
+		FROM interactions WHERE agent_id = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at DESC
+		LIMIT $4
+	`, agentID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var interactions []*models.Interaction
+	for rows.Next() {
+		i := &models.Interaction{}
+		if err := rows.Scan(&i.ID, &i.AgentID, &i.IntegrationID, &i.Provider, &i.InteractionType, &i.InputData, &i.OutputData, &i.ConfidenceScore, &i.Status, &i.Escalated, &i.HumanFeedback, &i.ProcessingTime, &i.ErrorMessage, &i.SkipReason, &i.CorrectedOutput, &i.CorrectedBy, &i.CorrectedAt, &i.CreatedAt, &i.CompletedAt); err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, i)
+	}
+	return interactions, rows.Err()
+}
+
+func (r *interactionRepository) Update(ctx context.Context, i *models.Interaction) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE interactions SET output_data = $2, confidence_score = $3, status = $4, escalated = $5, human_feedback = $6, processing_time = $7, completed_at = $8,
+			corrected_output = $9, corrected_by = $10, corrected_at = $11, error_message = $12
+		WHERE id = $1
+	`, i.ID, i.OutputData, i.ConfidenceScore, i.Status, i.Escalated, i.HumanFeedback, i.ProcessingTime, i.CompletedAt, i.CorrectedOutput, i.CorrectedBy, i.CorrectedAt, i.ErrorMessage)
+	return err
+}
+
+// Record upserts the interaction and inserts its escalation in one
+// transaction, so an interaction is never left escalated without one
+func (r *interactionRepository) Record(ctx context.Context, i *models.Interaction, e *models.Escalation) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO interactions (id, agent_id, integration_id, provider, interaction_type, input_data, output_data, confidence_score, status, escalated, processing_time, created_at, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), $12)
+		ON CONFLICT (id) DO UPDATE SET output_data = EXCLUDED.output_data, confidence_score = EXCLUDED.confidence_score, status = EXCLUDED.status,
+			escalated = EXCLUDED.escalated, processing_time = EXCLUDED.processing_time, completed_at = EXCLUDED.completed_at
+	`, i.ID, i.AgentID, i.IntegrationID, i.Provider, i.InteractionType, i.InputData, i.OutputData, i.ConfidenceScore, i.Status, i.Escalated, i.ProcessingTime, i.CompletedAt); err != nil {
+		return err
+	}
+	if e != nil {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO escalations (id, interaction_id, agent_id, reason, priority, status, tag, assigned_to, context, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+		`, e.ID, e.InteractionID, e.AgentID, e.Reason, e.Priority, e.Status, e.Tag, e.AssignedTo, e.Context); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *interactionRepository) CountToday(ctx context.Context, agentID uuid.UUID) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM interactions WHERE agent_id = $1 AND status <> 'skipped' AND created_at >= CURRENT_DATE
+	`, agentID).Scan(&count)
+	return count, err
+}
+
+// GetOverviewMetrics computes metrics for an agent, optionally scoped to one
+// interaction type (an empty interactionType includes all types)
+func (r *interactionRepository) GetOverviewMetrics(ctx context.Context, agentID uuid.UUID, interactionType string) (*models.OverviewMetrics, error) {
+	metrics := &models.OverviewMetrics{
+		InteractionsByType:   make(map[string]int),
+		InteractionsByStatus: make(map[string]int),
+	}
+
+	// Total, today and escalated counts. Skipped events were never processed
+	// and only show up in the status breakdown. The averages cover every
+	// interaction.
+	err := r.replica.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE status <> 'skipped'),
+			COUNT(*) FILTER (WHERE status <> 'skipped' AND created_at >= CURRENT_DATE),
+			COUNT(*) FILTER (WHERE status <> 'skipped' AND escalated = true),
+			COALESCE(AVG(confidence_score), 0),
+			COALESCE(AVG(processing_time), 0)
+		FROM interactions
+		WHERE agent_id = $1 AND ($2 = '' OR interaction_type = $2)
+	`, agentID, interactionType).Scan(&metrics.TotalInteractions, &metrics.TodayInteractions, &metrics.EscalatedInteractions, &metrics.AvgConfidenceScore, &metrics.AvgProcessingTime)
+	if err != nil {
+		return nil, fmt.Errorf("counting interactions: %w", err)
+	}
+	metrics.AutonomousRate = metrics.Totals().AutonomousRate()
+
+	// Pending escalations
+	err = r.replica.QueryRow(ctx, `
+		SELECT COUNT(*) FROM escalations e JOIN interactions i ON i.id = e.interaction_id
+		WHERE e.agent_id = $1 AND e.status = 'pending' AND ($2 = '' OR i.interaction_type = $2)
+	`, agentID, interactionType).Scan(&metrics.PendingEscalations)
+	if err != nil {
+		return nil, fmt.Errorf("counting pending escalations: %w", err)
+	}
+
+	// Breakdowns by status and type
+	if err := r.countGrouped(ctx, metrics.InteractionsByStatus, `
+		SELECT status, COUNT(*) FROM interactions
+		WHERE agent_id = $1 AND ($2 = '' OR interaction_type = $2)
+		GROUP BY status
+	`, agentID, interactionType); err != nil {
+		return nil, fmt.Errorf("counting interactions by status: %w", err)
+	}
+	if err := r.countGrouped(ctx, metrics.InteractionsByType, `
+		SELECT interaction_type, COUNT(*) FROM interactions
+		WHERE agent_id = $1 AND ($2 = '' OR interaction_type = $2)
+		GROUP BY interaction_type
+	`, agentID, interactionType); err != nil {
+		return nil, fmt.Errorf("counting interactions by type: %w", err)
+	}
+
+	return metrics, nil
+}
+
+// countGrouped runs a "SELECT key, COUNT(*) ... GROUP BY key" query into counts
+func (r *interactionRepository) countGrouped(ctx context.Context, counts map[string]int, query string, args ...interface{}) error {
+	rows, err := r.replica.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var count int
+		if err := rows.Scan(&key, &count); err != nil {
+			return err
+		}
+		counts[key] = count
+	}
+	return rows.Err()
+}
+
+// GetOrgOverviewMetrics computes overview metrics across every agent in an
+// organization, along with the topAgents agents with the most interactions
+func (r *interactionRepository) GetOrgOverviewMetrics(ctx context.Context, orgID uuid.UUID, topAgents int) (*models.OrgOverviewMetrics, error) {
+	metrics := &models.OrgOverviewMetrics{TopAgents: []*models.AgentVolume{}}
+
+	var escalatedCount int
+	err := r.replica.QueryRow(ctx, `
+		SELECT
+			COUNT(DISTINCT a.id),
+			COUNT(i.id) FILTER (WHERE i.status <> 'skipped'),
+			COUNT(i.id) FILTER (WHERE i.status <> 'skipped' AND i.created_at >= CURRENT_DATE),
+			COUNT(i.id) FILTER (WHERE i.status <> 'skipped' AND i.escalated),
+			COALESCE(AVG(i.confidence_score), 0)
+		FROM agents a
+		LEFT JOIN interactions i ON i.agent_id = a.id
+		WHERE a.org_id = $1
+	`, orgID).Scan(&metrics.AgentCount, &metrics.TotalInteractions, &metrics.TodayInteractions, &escalatedCount, &metrics.AvgConfidenceScore)
+	if err != nil {
+		return nil, err
+	}
+	metrics.AutonomousRate = models.InteractionTotals{Total: metrics.TotalInteractions, Escalated: escalatedCount}.AutonomousRate()
+
+	err = r.replica.QueryRow(ctx, `
+		SELECT COUNT(*) FROM escalations e
+		JOIN agents a ON a.id = e.agent_id
+		WHERE a.org_id = $1 AND e.status = 'pending'
+	`, orgID).Scan(&metrics.PendingEscalations)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.replica.Query(ctx, `
+		SELECT a.id, a.name, u.name,
+			COUNT(i.id) FILTER (WHERE i.status <> 'skipped') AS total,
+			COUNT(i.id) FILTER (WHERE i.status <> 'skipped' AND i.created_at >= CURRENT_DATE),
+			COUNT(i.id) FILTER (WHERE i.status <> 'skipped' AND i.escalated),
+			COALESCE(AVG(i.confidence_score), 0)
+		FROM agents a
+		JOIN users u ON u.id = a.user_id
+		JOIN interactions i ON i.agent_id = a.id
+		WHERE a.org_id = $1
+		GROUP BY a.id, a.name, u.name
+		ORDER BY total DESC, a.name
+		LIMIT $2
+	`, orgID, topAgents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v := &models.AgentVolume{}
+		var escalated int
+		if err := rows.Scan(&v.AgentID, &v.AgentName, &v.OwnerName, &v.TotalInteractions, &v.TodayInteractions, &escalated, &v.AvgConfidenceScore); err != nil {
+			return nil, err
+		}
+		v.AutonomousRate = models.InteractionTotals{Total: v.TotalInteractions, Escalated: escalated}.AutonomousRate()
+		metrics.TopAgents = append(metrics.TopAgents, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+func (r *interactionRepository) GetTrends(ctx context.Context, agentID uuid.UUID, days int, interactionType string) ([]*models.TrendData, error) {
+	rows, err := r.replica.Query(ctx, `
+		SELECT
+			DATE(created_at) as date,
+			COUNT(*) as interactions,
+			SUM(CASE WHEN escalated THEN 1 ELSE 0 END) as escalations,
+			COALESCE(AVG(confidence_score), 0) as confidence
+		FROM interactions
+		WHERE agent_id = $1 AND created_at >= NOW() - INTERVAL '1 day' * $2
+			AND ($3 = '' OR interaction_type = $3) AND status <> 'skipped'
+		GROUP BY DATE(created_at)
+		ORDER BY date
+	`, agentID, days, interactionType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trends []*models.TrendData
+	for rows.Next() {
+		t := &models.TrendData{}
+		if err := rows.Scan(&t.Date, &t.Interactions, &t.Escalations, &t.Confidence); err != nil {
+			return nil, err
+		}
+		trends = append(trends, t)
+	}
+	return trends, nil
+}
+
+func (r *interactionRepository) GetFeedbackSummary(ctx context.Context, agentID uuid.UUID, from, to time.Time) (*models.FeedbackSummary, error) {
+	rows, err := r.replica.Query(ctx, `
+		SELECT
+			TO_CHAR(DATE(created_at), 'YYYY-MM-DD') as date,
+			COUNT(*) FILTER (WHERE human_feedback = 'approved') as approved,
+			COUNT(*) FILTER (WHERE human_feedback = 'rejected') as rejected,
+			COUNT(*) FILTER (WHERE human_feedback = 'corrected') as corrected
+		FROM interactions
+		WHERE agent_id = $1 AND created_at >= $2 AND created_at < $3
+			AND human_feedback IS NOT NULL
+		GROUP BY DATE(created_at)
+		ORDER BY DATE(created_at)
+	`, agentID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := &models.FeedbackSummary{From: from, To: to, Trend: []*models.FeedbackTrend{}}
+	for rows.Next() {
+		t := &models.FeedbackTrend{}
+		if err := rows.Scan(&t.Date, &t.Approved, &t.Rejected, &t.Corrected); err != nil {
+			return nil, err
+		}
+		t.ApprovalRate = models.ApprovalRate(t.Approved, t.Rejected, t.Corrected)
+		summary.Approved += t.Approved
+		summary.Rejected += t.Rejected
+		summary.Corrected += t.Corrected
+		summary.Trend = append(summary.Trend, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	summary.ApprovalRate = models.ApprovalRate(summary.Approved, summary.Rejected, summary.Corrected)
+	return summary, nil
+}
+
+// GetCalibration groups reviewed interactions with a confidence score into
+// bucketSize-wide confidence ranges and counts the feedback in each. A score
+// of 100 falls into the top bucket. Empty buckets are omitted.
+func (r *interactionRepository) GetCalibration(ctx context.Context, agentID uuid.UUID, from, to time.Time, bucketSize int) ([]*models.CalibrationBucket, error) {
+	rows, err := r.replica.Query(ctx, `
+		SELECT
+			LEAST(confidence_score / $4, 100 / $4 - 1) * $4 as bucket,
+			AVG(confidence_score) as avg_confidence,
+			COUNT(*) FILTER (WHERE human_feedback = 'approved') as approved,
+			COUNT(*) FILTER (WHERE human_feedback = 'rejected') as rejected,
+			COUNT(*) FILTER (WHERE human_feedback = 'corrected') as corrected
+		FROM interactions
+		WHERE agent_id = $1 AND created_at >= $2 AND created_at < $3
+			AND human_feedback IS NOT NULL AND confidence_score IS NOT NULL
+		GROUP BY bucket
+		ORDER BY bucket
+	`, agentID, from, to, bucketSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []*models.CalibrationBucket
+	for rows.Next() {
+		b := &models.CalibrationBucket{}
+		if err := rows.Scan(&b.MinConfidence, &b.AvgConfidence, &b.Approved, &b.Rejected, &b.Corrected); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
+
+// FailStale marks interactions stuck in pending/processing longer than olderThan as failed
+// and returns the interactions that were transitioned
+func (r *interactionRepository) FailStale(ctx context.Context, olderThan time.Duration, reason string) ([]*models.Interaction, error) {
+	rows, err := r.db.Query(ctx, `
+		UPDATE interactions
+		SET status = 'failed', error_message = $2, completed_at = NOW()
+		WHERE status IN ('pending', 'processing') AND created_at < NOW() - $1 * INTERVAL '1 second'
+		RETURNING id, agent_id, provider, interaction_type, status, created_at
+	`, olderThan.Seconds(), reason)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var interactions []*models.Interaction
+	for rows.Next() {
+		i := &models.Interaction{}
+		if err := rows.Scan(&i.ID, &i.AgentID, &i.Provider, &i.InteractionType, &i.Status, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		i.ErrorMessage = &reason
+		interactions = append(interactions, i)
+	}
+	return interactions, rows.Err()
+}
+
+// ListUnescalatedFailures returns interactions failed for reason within the
+// last within that have no escalation, oldest first
+func (r *interactionRepository) ListUnescalatedFailures(ctx context.Context, reason string, within time.Duration, limit int) ([]*models.Interaction, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT i.id, i.agent_id, i.provider, i.interaction_type, i.status, i.error_message, i.created_at
+		FROM interactions i
+		WHERE i.status = 'failed' AND i.error_message = $1 AND NOT i.escalated
+			AND i.completed_at >= NOW() - $2 * INTERVAL '1 second'
+			AND NOT EXISTS (SELECT 1 FROM escalations e WHERE e.interaction_id = i.id)
+		ORDER BY i.completed_at
+		LIMIT $3
+	`, reason, within.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var interactions []*models.Interaction
+	for rows.Next() {
+		i := &models.Interaction{}
+		if err := rows.Scan(&i.ID, &i.AgentID, &i.Provider, &i.InteractionType, &i.Status, &i.ErrorMessage, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, i)
+	}
+	return interactions, rows.Err()
+}
+
+// ListDeferred returns the oldest interactions deferred by a maintenance window
+func (r *interactionRepository) ListDeferred(ctx context.Context, limit int) ([]*models.Interaction, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, agent_id, integration_id, provider, interaction_type, input_data, status, deferred_window_id, created_at
+		FROM interactions WHERE status = 'deferred'
+		ORDER BY created_at
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var interactions []*models.Interaction
+	for rows.Next() {
+		i := &models.Interaction{}
+		if err := rows.Scan(&i.ID, &i.AgentID, &i.IntegrationID, &i.Provider, &i.InteractionType, &i.InputData, &i.Status, &i.DeferredBy, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, i)
+	}
+	return interactions, rows.Err()
+}
+
+// EndDeferral moves a deferred interaction back to pending, or to skipped
+// when release is false, reporting whether it was still deferred. Released
+// interactions count as created now, so the stale sweep times them from
+// their release.
+func (r *interactionRepository) EndDeferral(ctx context.Context, id uuid.UUID, release bool) (bool, error) {
+	query := `
+		UPDATE interactions SET status = 'pending', created_at = NOW()
+		WHERE id = $1 AND status = 'deferred'
+	`
+	args := []interface{}{id}
+	if !release {
+		query = `
+			UPDATE interactions SET status = 'skipped', skip_reason = $2, completed_at = NOW()
+			WHERE id = $1 AND status = 'deferred'
+		`
+		args = append(args, models.MaintenanceSkipReason)
+	}
+
+	tag, err := r.db.Exec(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+type escalationRepository struct {
+	db      *pgxpool.Pool
+	replica *pgxpool.Pool // Read replica for exports; may lag db
+}
+
+func (r *escalationRepository) Create(ctx context.Context, e *models.Escalation) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO escalations (id, interaction_id, agent_id, reason, priority, status, tag, assigned_to, context, resolution, resolved_by, resolved_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW())
+	`, e.ID, e.InteractionID, e.AgentID, e.Reason, e.Priority, e.Status, e.Tag, e.AssignedTo, e.Context, e.Resolution, e.ResolvedBy, e.ResolvedAt)
+	return err
+}
+
+// Escalate creates the escalation and marks its interaction escalated in one
+// transaction, so the interaction and its escalation never disagree
+func (r *escalationRepository) Escalate(ctx context.Context, e *models.Escalation) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO escalations (id, interaction_id, agent_id, reason, priority, status, tag, assigned_to, context, resolution, resolved_by, resolved_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW())
+	`, e.ID, e.InteractionID, e.AgentID, e.Reason, e.Priority, e.Status, e.Tag, e.AssignedTo, e.Context, e.Resolution, e.ResolvedBy, e.ResolvedAt); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE interactions SET escalated = true WHERE id = $1`, e.InteractionID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *escalationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Escalation, error) {
+	e := &models.Escalation{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, interaction_id, agent_id, reason, priority, status, tag, assigned_to, context, resolution, resolved_by, resolved_at, created_at
+		FROM escalations WHERE id = $1
+	`, id).Scan(&e.ID, &e.InteractionID, &e.AgentID, &e.Reason, &e.Priority, &e.Status, &e.Tag, &e.AssignedTo, &e.Context, &e.Resolution, &e.ResolvedBy, &e.ResolvedAt, &e.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return e, nil
+}
+
+// GetByInteractionID returns the interaction's latest escalation, or nil
+// when it was never escalated
+func (r *escalationRepository) GetByInteractionID(ctx context.Context, interactionID uuid.UUID) (*models.Escalation, error) {
+	e := &models.Escalation{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, interaction_id, agent_id, reason, priority, status, tag, assigned_to, context, resolution, resolved_by, resolved_at, created_at
+		FROM escalations WHERE interaction_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, interactionID).Scan(&e.ID, &e.InteractionID, &e.AgentID, &e.Reason, &e.Priority, &e.Status, &e.Tag, &e.AssignedTo, &e.Context, &e.Resolution, &e.ResolvedBy, &e.ResolvedAt, &e.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// escalationListFrom selects a user's escalations with their interactions
+// and agents, filtered by agent, priority, status and tag ($1-$5). The list
+// and its count share it so the total always matches the pages.
+const escalationListFrom = `
+		FROM escalations e
+		JOIN interactions i ON i.id = e.interaction_id
+		JOIN agents a ON a.id = e.agent_id
+		WHERE a.user_id = $1
+			AND ($2::UUID IS NULL OR e.agent_id = $2)
+			AND ($3 = '' OR e.priority = $3)
+			AND ($4 = '' OR e.status = $4)
+			AND ($5 = '' OR e.tag = $5)`
+
+// ListEscalationsWithInteractions returns a page of the escalations of the
+// user's agents matching filter, each with its interaction and agent name,
+// most urgent first, and how many match in total
+func (r *escalationRepository) ListEscalationsWithInteractions(ctx context.Context, userID uuid.UUID, filter models.EscalationFilter, params models.PaginationParams) ([]*models.EscalationListItem, int, error) {
+	offset := (params.Page - 1) * params.PageSize
+
+	rows, err := r.db.Query(ctx, `
+		SELECT e.id, e.interaction_id, e.agent_id, e.reason, e.priority, e.status, e.tag, e.assigned_to, e.context, e.resolution, e.resolved_by, e.resolved_at, e.created_at,
+			i.id, i.agent_id, i.integration_id, i.provider, i.interaction_type, i.input_data, i.output_data, i.confidence_score, i.status, i.escalated, i.human_feedback, i.processing_time, i.error_message, i.skip_reason, i.corrected_output, i.corrected_by, i.corrected_at, i.created_at, i.completed_at,
+			a.name
+		`+escalationListFrom+`
+		ORDER BY
+			CASE e.priority
+				WHEN 'urgent' THEN 1
+				WHEN 'high' THEN 2
+				WHEN 'medium' THEN 3
+				ELSE 4
+			END,
+			e.created_at DESC, e.id
+		LIMIT $6 OFFSET $7
+	`, userID, filter.AgentID, filter.Priority, filter.Status, filter.Tag, params.PageSize, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var items []*models.EscalationListItem
+	for rows.Next() {
+		e := &models.Escalation{}
+		i := &models.Interaction{}
+		item := &models.EscalationListItem{Escalation: e, Interaction: i}
+		if err := rows.Scan(&e.ID, &e.InteractionID, &e.AgentID, &e.Reason, &e.Priority, &e.Status, &e.Tag, &e.AssignedTo, &e.Context, &e.Resolution, &e.ResolvedBy, &e.ResolvedAt, &e.CreatedAt,
+			&i.ID, &i.AgentID, &i.IntegrationID, &i.Provider, &i.InteractionType, &i.InputData, &i.OutputData, &i.ConfidenceScore, &i.Status, &i.Escalated, &i.HumanFeedback, &i.ProcessingTime, &i.ErrorMessage, &i.SkipReason, &i.CorrectedOutput, &i.CorrectedBy, &i.CorrectedAt, &i.CreatedAt, &i.CompletedAt,
+			&item.AgentName); err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) `+escalationListFrom+`
+	`, userID, filter.AgentID, filter.Priority, filter.Status, filter.Tag).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (r *escalationRepository) Update(ctx context.Context, e *models.Escalation) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE escalations SET status = $2, resolution = $3, resolved_by = $4, resolved_at = $5
+		WHERE id = $1
+	`, e.ID, e.Status, e.Resolution, e.ResolvedBy, e.ResolvedAt)
+	return err
+}
+
+// ResolvePending stores the escalation's resolution only if it is still
+// pending, reporting whether it did. Concurrent resolutions of the same
+// escalation therefore transition it once.
+func (r *escalationRepository) ResolvePending(ctx context.Context, e *models.Escalation) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE escalations SET status = $2, resolution = $3, resolved_by = $4, resolved_at = $5
+		WHERE id = $1 AND status = 'pending'
+	`, e.ID, e.Status, e.Resolution, e.ResolvedBy, e.ResolvedAt)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *escalationRepository) CountPending(ctx context.Context, agentID uuid.UUID) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM escalations WHERE agent_id = $1 AND status = 'pending'
+	`, agentID).Scan(&count)
+	return count, err
+}
+
+// StreamForExport walks escalations joined with their interaction and resolver,
+// calling fn for each row so large exports never need to be held in memory
+func (r *escalationRepository) StreamForExport(ctx context.Context, agentIDs []uuid.UUID, filter models.EscalationExportFilter, fn func(*models.EscalationExport) error) error {
+	rows, err := r.replica.Query(ctx, `
+		SELECT e.id, e.interaction_id, e.agent_id, e.reason, e.priority, e.status, e.tag, e.assigned_to, e.context, e.resolution, e.resolved_by, e.resolved_at, e.created_at,
+			i.id, i.agent_id, i.integration_id, i.provider, i.interaction_type, i.input_data, i.output_data, i.confidence_score, i.status, i.escalated, i.human_feedback, i.processing_time, i.error_message, i.skip_reason, i.corrected_output, i.corrected_by, i.corrected_at, i.created_at, i.completed_at,
+			a.name, u.name,
+			CASE WHEN e.resolved_at IS NOT NULL THEN EXTRACT(EPOCH FROM (e.resolved_at - e.created_at))::BIGINT END
+		FROM escalations e
+		JOIN interactions i ON i.id = e.interaction_id
+		JOIN agents a ON a.id = e.agent_id
+		LEFT JOIN users u ON u.id = e.resolved_by
+		WHERE e.agent_id = ANY($1)
+			AND ($2::TIMESTAMPTZ IS NULL OR e.created_at >= $2)
+			AND ($3::TIMESTAMPTZ IS NULL OR e.created_at < $3)
+			AND ($4 = '' OR e.status = $4)
+			AND ($5 = '' OR e.tag = $5)
+		ORDER BY e.created_at
+	`, agentIDs, filter.From, filter.To, filter.Status, filter.Tag)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &models.Escalation{}
+		i := &models.Interaction{}
+		row := &models.EscalationExport{Escalation: e, Interaction: i}
+		if err := rows.Scan(&e.ID, &e.InteractionID, &e.AgentID, &e.Reason, &e.Priority, &e.Status, &e.Tag, &e.AssignedTo, &e.Context, &e.Resolution, &e.ResolvedBy, &e.ResolvedAt, &e.CreatedAt,
+			&i.ID, &i.AgentID, &i.IntegrationID, &i.Provider, &i.InteractionType, &i.InputData, &i.OutputData, &i.ConfidenceScore, &i.Status, &i.Escalated, &i.HumanFeedback, &i.ProcessingTime, &i.ErrorMessage, &i.SkipReason, &i.CorrectedOutput, &i.CorrectedBy, &i.CorrectedAt, &i.CreatedAt, &i.CompletedAt,
+			&row.AgentName, &row.ResolvedByName, &row.ResolutionSeconds); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ListResolvedAfter returns up to limit resolved escalations with their
+// interactions, oldest resolution first, starting after the cursor. Agents
+// of organizations that turned the training_export flag off are excluded;
+// includeByDefault applies to organizations that have not set it. Values are
+// returned as stored; callers redact them.
+func (r *escalationRepository) ListResolvedAfter(ctx context.Context, since *time.Time, after *models.EscalationCursor, includeByDefault bool, limit int) ([]*models.ResolvedEscalationSample, error) {
+	var afterTime *time.Time
+	afterID := uuid.Nil
+	if after != nil {
+		afterTime = &after.ResolvedAt
+		afterID = after.ID
+	}
+
+	rows, err := r.replica.Query(ctx, `
+		SELECT e.id, i.id, e.agent_id, i.provider, i.interaction_type, i.input_data, i.output_data, i.confidence_score,
+			e.reason, e.priority, e.tag, e.resolution, i.human_feedback, i.corrected_output, e.resolved_at,
+			EXTRACT(EPOCH FROM (e.resolved_at - e.created_at))::BIGINT
+		FROM escalations e
+		JOIN interactions i ON i.id = e.interaction_id
+		JOIN agents a ON a.id = e.agent_id
+		JOIN organizations o ON o.id = a.org_id
+		WHERE e.status = 'resolved' AND e.resolution IS NOT NULL AND e.resolved_at IS NOT NULL
+			AND COALESCE((o.feature_flags->>'training_export')::boolean, $1)
+			AND ($2::timestamptz IS NULL OR e.resolved_at >= $2)
+			AND ($3::timestamptz IS NULL OR (e.resolved_at, e.id) > ($3, $4))
+		ORDER BY e.resolved_at, e.id
+		LIMIT $5
+	`, includeByDefault, since, afterTime, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []*models.ResolvedEscalationSample
+	for rows.Next() {
+		s := &models.ResolvedEscalationSample{}
+		if err := rows.Scan(&s.EscalationID, &s.InteractionID, &s.AgentID, &s.Provider, &s.InteractionType, &s.InputData, &s.AgentOutput, &s.ConfidenceScore,
+			&s.EscalationReason, &s.Priority, &s.Tag, &s.Resolution, &s.HumanFeedback, &s.CorrectedOutput, &s.ResolvedAt, &s.ResolutionSeconds); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
+
+type trainingRepository struct {
+	db *pgxpool.Pool
+}
+
+func (r *trainingRepository) Create(ctx context.Context, s *models.TrainingSample) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO training_samples (id, agent_id, provider, sample_type, input_text, output_text, embedding, is_positive, source, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+	`, s.ID, s.AgentID, s.Provider, s.SampleType, s.InputText, s.OutputText, s.Embedding, s.IsPositive, s.Source)
+	if isUniqueViolation(err, "idx_training_samples_promoted") {
+		return ErrAlreadyPromoted
+	}
+	return err
+}
+
+// CreateBatch inserts samples with a single COPY, so a batch is stored in
+// full or not at all. Embeddings are computed later by the AI service.
+func (r *trainingRepository) CreateBatch(ctx context.Context, samples []*models.TrainingSample) error {
+	rows := make([][]interface{}, len(samples))
+	for i, s := range samples {
+		rows[i] = []interface{}{s.ID, s.AgentID, s.Provider, s.SampleType, s.InputText, s.OutputText, s.IsPositive, s.Source}
+	}
+	_, err := r.db.CopyFrom(ctx,
+		pgx.Identifier{"training_samples"},
+		[]string{"id", "agent_id", "provider", "sample_type", "input_text", "output_text", "is_positive", "source"},
+		pgx.CopyFromRows(rows),
+	)
+	return err
+}
+
+func (r *trainingRepository) ListByAgentID(ctx context.Context, agentID uuid.UUID) ([]*models.TrainingSample, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, agent_id, provider, sample_type, input_text, output_text, is_positive, source, created_at
+		FROM training_samples WHERE agent_id = $1
+	`, agentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []*models.TrainingSample
+	for rows.Next() {
+		s := &models.TrainingSample{}
+		if err := rows.Scan(&s.ID, &s.AgentID, &s.Provider, &s.SampleType, &s.InputText, &s.OutputText, &s.IsPositive, &s.Source, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// ListByIDs returns those of the samples that belong to the agent
+func (r *trainingRepository) ListByIDs(ctx context.Context, agentID uuid.UUID, ids []uuid.UUID) ([]*models.TrainingSample, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, agent_id, provider, sample_type, input_text, output_text, is_positive, source, created_at
+		FROM training_samples WHERE agent_id = $1 AND id = ANY($2)
+	`, agentID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []*models.TrainingSample
+	for rows.Next() {
+		s := &models.TrainingSample{}
+		if err := rows.Scan(&s.ID, &s.AgentID, &s.Provider, &s.SampleType, &s.InputText, &s.OutputText, &s.IsPositive, &s.Source, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
+
+// CountByAgentID breaks down the agent's training samples by type, provider
+// and source
+func (r *trainingRepository) CountByAgentID(ctx context.Context, agentID uuid.UUID) (*models.TrainingBreakdown, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT sample_type, COALESCE(provider, ''), COALESCE(source, ''), COALESCE(is_positive, true), COUNT(*)
+		FROM training_samples WHERE agent_id = $1
+		GROUP BY 1, 2, 3, 4
+	`, agentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := models.NewTrainingBreakdown()
+	for rows.Next() {
+		var sampleType, provider, source string
+		var positive bool
+		var n int
+		if err := rows.Scan(&sampleType, &provider, &source, &positive, &n); err != nil {
+			return nil, err
+		}
+		breakdown.Add(sampleType, provider, source, positive, n)
+	}
+	return breakdown, rows.Err()
+}
+
+func (r *trainingRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM training_samples WHERE id = $1`, id)
+	return err
+}
+
+type credentialRepository struct {
+	db      *pgxpool.Pool
+	secrets *crypto.Keyring
+}
+
+func (r *credentialRepository) Create(ctx context.Context, cred *models.OrganizationCredential) error {
+	clientSecret, err := sealSecret(r.secrets, cred.ClientSecret)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(ctx, `
+		INSERT INTO organization_credentials (id, org_id, provider, client_id, client_secret, webhook_secret, signing_secret, config, is_active, created_by, updated_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), NOW())
+	`, cred.ID, cred.OrgID, cred.Provider, cred.ClientID, clientSecret, cred.WebhookSecret, cred.SigningSecret, cred.Config, cred.IsActive, cred.CreatedBy, cred.UpdatedBy)
+	return err
+}
+
+func (r *credentialRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.OrganizationCredential, error) {
+	cred := &models.OrganizationCredential{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, org_id, provider, client_id, client_secret, webhook_secret, signing_secret, config, is_active, verified_at, created_by, updated_by, created_at, updated_at
+		FROM organization_credentials WHERE id = $1
+	`, id).Scan(&cred.ID, &cred.OrgID, &cred.Provider, &cred.ClientID, &cred.ClientSecret, &cred.WebhookSecret, &cred.SigningSecret, &cred.Config, &cred.IsActive, &cred.VerifiedAt, &cred.CreatedBy, &cred.UpdatedBy, &cred.CreatedAt, &cred.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if cred.ClientSecret, err = openSecret(r.secrets, cred.ClientSecret); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+func (r *credentialRepository) GetByOrgAndProvider(ctx context.Context, orgID uuid.UUID, provider string) (*models.OrganizationCredential, error) {
+	cred := &models.OrganizationCredential{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, org_id, provider, client_id, client_secret, webhook_secret, signing_secret, config, is_active, verified_at, created_by, updated_by, created_at, updated_at
+		FROM organization_credentials WHERE org_id = $1 AND provider = $2
+	`, orgID, provider).Scan(&cred.ID, &cred.OrgID, &cred.Provider, &cred.ClientID, &cred.ClientSecret, &cred.WebhookSecret, &cred.SigningSecret, &cred.Config, &cred.IsActive, &cred.VerifiedAt, &cred.CreatedBy, &cred.UpdatedBy, &cred.CreatedAt, &cred.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if cred.ClientSecret, err = openSecret(r.secrets, cred.ClientSecret); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+func (r *credentialRepository) ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.OrganizationCredential, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, org_id, provider, client_id, client_secret, webhook_secret, signing_secret, config, is_active, verified_at, created_by, updated_by, created_at, updated_at
+		FROM organization_credentials WHERE org_id = $1
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []*models.OrganizationCredential
+	for rows.Next() {
+		cred := &models.OrganizationCredential{}
+		if err := rows.Scan(&cred.ID, &cred.OrgID, &cred.Provider, &cred.ClientID, &cred.ClientSecret, &cred.WebhookSecret, &cred.SigningSecret, &cred.Config, &cred.IsActive, &cred.VerifiedAt, &cred.CreatedBy, &cred.UpdatedBy, &cred.CreatedAt, &cred.UpdatedAt); err != nil {
+			return nil, err
+		}
+		var err error
+		if cred.ClientSecret, err = openSecret(r.secrets, cred.ClientSecret); err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, cred)
+	}
+	return credentials, nil
+}
+
+func (r *credentialRepository) Update(ctx context.Context, cred *models.OrganizationCredential) error {
+	clientSecret, err := sealSecret(r.secrets, cred.ClientSecret)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(ctx, `
+		UPDATE organization_credentials
+		SET client_id = $2, client_secret = $3, webhook_secret = $4, signing_secret = $5, config = $6, is_active = $7, verified_at = $8, updated_by = $9, updated_at = NOW()
+		WHERE id = $1
+	`, cred.ID, cred.ClientID, clientSecret, cred.WebhookSecret, cred.SigningSecret, cred.Config, cred.IsActive, cred.VerifiedAt, cred.UpdatedBy)
+	return err
+}
+
+func (r *credentialRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM organization_credentials WHERE id = $1`, id)
+	return err
+}
+
+// ListWebhookSecrets returns the webhook secrets of the active provider
+// credentials of every organization with an agent connected to the external
+// workspace, e.g. a GitHub account
+func (r *credentialRepository) ListWebhookSecrets(ctx context.Context, provider, workspace string) ([]string, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT DISTINCT c.webhook_secret
+		FROM integrations i
+		JOIN agents a ON a.id = i.agent_id
+		JOIN organization_credentials c ON c.org_id = a.org_id AND c.provider = i.provider
+		WHERE `+integrationInWorkspace+`
+			AND c.is_active AND COALESCE(c.webhook_secret, '') <> ''
+	`, provider, workspace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var secrets []string
+	for rows.Next() {
+		var secret string
+		if err := rows.Scan(&secret); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, rows.Err()
+}
+
+func (r *credentialRepository) MarkVerified(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `UPDATE organization_credentials SET verified_at = NOW(), updated_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+type membershipRepository struct {
+	db *pgxpool.Pool
+}
+
+func (r *membershipRepository) Create(ctx context.Context, m *models.Membership) error {
 	_, err := r.db.Exec(ctx, `
-		UPDATE interactions SET output_data = $2, confidence_score = $3, status = $4, escalated = $5, human_feedback = $6, processing_time = $7, completed_at = $8
-		WHERE id = $1
-	`, i.ID, i.OutputData, i.ConfidenceScore, i.Status, i.Escalated, i.HumanFeedback, i.ProcessingTime, i.CompletedAt)
+		INSERT INTO memberships (user_id, org_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id, org_id) DO UPDATE SET role = EXCLUDED.role
+	`, m.UserID, m.OrgID, m.Role)
 	return err
 }
 
-func (r *interactionRepository) CountToday(ctx context.Context, agentID uuid.UUID) (int, error) {
-	var count int
+func (r *membershipRepository) Get(ctx context.Context, userID, orgID uuid.UUID) (*models.Membership, error) {
+	m := &models.Membership{}
 	err := r.db.QueryRow(ctx, `
-		SELECT COUNT(*) FROM interactions WHERE agent_id = $1 AND created_at >= CURRENT_DATE
-	`, agentID).Scan(&count)
-	return count, err
+		SELECT m.user_id, m.org_id, o.name, o.slug, m.role, m.created_at
+		FROM memberships m JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = $1 AND m.org_id = $2
+	`, userID, orgID).Scan(&m.UserID, &m.OrgID, &m.OrgName, &m.OrgSlug, &m.Role, &m.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return m, nil
 }
 
-func (r *interactionRepository) GetOverviewMetrics(ctx context.Context, agentID uuid.UUID) (*models.OverviewMetrics, error) {
-	metrics := &models.OverviewMetrics{
-		InteractionsByType:   make(map[string]int),
-		InteractionsByStatus: make(map[string]int),
+func (r *membershipRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Membership, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT m.user_id, m.org_id, o.name, o.slug, m.role, m.created_at
+		FROM memberships m JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = $1
+		ORDER BY o.name
+	`, userID)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Total and today counts
-	r.db.QueryRow(ctx, `SELECT COUNT(*) FROM interactions WHERE agent_id = $1`, agentID).Scan(&metrics.TotalInteractions)
-	r.db.QueryRow(ctx, `SELECT COUNT(*) FROM interactions WHERE agent_id = $1 AND created_at >= CURRENT_DATE`, agentID).Scan(&metrics.TodayInteractions)
-
-	// Autonomous rate
-	var escalatedCount int
-	r.db.QueryRow(ctx, `SELECT COUNT(*) FROM interactions WHERE agent_id = $1 AND escalated = true`, agentID).Scan(&escalatedCount)
-	if metrics.TotalInteractions > 0 {
-		metrics.AutonomousRate = float64(metrics.TotalInteractions-escalatedCount) / float64(metrics.TotalInteractions) * 100
+	var memberships []*models.Membership
+	for rows.Next() {
+		m := &models.Membership{}
+		if err := rows.Scan(&m.UserID, &m.OrgID, &m.OrgName, &m.OrgSlug, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
 	}
+	return memberships, nil
+}
 
-	// Pending escalations
-	r.db.QueryRow(ctx, `SELECT COUNT(*) FROM escalations WHERE agent_id = $1 AND status = 'pending'`, agentID).Scan(&metrics.PendingEscalations)
-
-	// Average confidence
-	r.db.QueryRow(ctx, `SELECT COALESCE(AVG(confidence_score), 0) FROM interactions WHERE agent_id = $1`, agentID).Scan(&metrics.AvgConfidenceScore)
-
-	// Average processing time
-	r.db.QueryRow(ctx, `SELECT COALESCE(AVG(processing_time), 0) FROM interactions WHERE agent_id = $1`, agentID).Scan(&metrics.AvgProcessingTime)
+type replayRepository struct {
+	db *pgxpool.Pool
+}
 
-	return metrics, nil
+func (r *replayRepository) Create(ctx context.Context, replay *models.InteractionReplay) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO interaction_replays (id, run_id, agent_id, interaction_id, status, action, output_data, confidence_score, error_message, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+	`, replay.ID, replay.RunID, replay.AgentID, replay.InteractionID, replay.Status, replay.Action, replay.OutputData, replay.ConfidenceScore, replay.ErrorMessage)
+	return err
 }
 
-func (r *interactionRepository) GetTrends(ctx context.Context, agentID uuid.UUID, days int) ([]*models.TrendData, error) {
+func (r *replayRepository) ListComparisons(ctx context.Context, agentID, runID uuid.UUID) ([]*models.ReplayComparison, error) {
 	rows, err := r.db.Query(ctx, `
-		SELECT
-			DATE(created_at) as date,
-			COUNT(*) as interactions,
-			SUM(CASE WHEN escalated THEN 1 ELSE 0 END) as escalations,
-			COALESCE(AVG(confidence_score), 0) as confidence
-		FROM interactions
-		WHERE agent_id = $1 AND created_at >= NOW() - INTERVAL '1 day' * $2
-		GROUP BY DATE(created_at)
-		ORDER BY date
-	`, agentID, days)
+		SELECT i.id, i.provider, i.interaction_type, i.output_data, i.confidence_score, i.escalated, i.human_feedback, i.corrected_output,
+			rp.status, rp.output_data, rp.confidence_score, rp.error_message
+		FROM interaction_replays rp
+		JOIN interactions i ON i.id = rp.interaction_id
+		WHERE rp.agent_id = $1 AND rp.run_id = $2
+		ORDER BY i.created_at DESC
+	`, agentID, runID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var trends []*models.TrendData
+	var comparisons []*models.ReplayComparison
 	for rows.Next() {
-		t := &models.TrendData{}
-		if err := rows.Scan(&t.Date, &t.Interactions, &t.Escalations, &t.Confidence); err != nil {
+		c := &models.ReplayComparison{}
+		if err := rows.Scan(&c.InteractionID, &c.Provider, &c.InteractionType, &c.OriginalOutput, &c.OriginalConfidence, &c.OriginalEscalated, &c.HumanFeedback, &c.CorrectedOutput,
+			&c.ReplayStatus, &c.ReplayOutput, &c.ReplayConfidence, &c.ReplayError); err != nil {
 			return nil, err
 		}
-		trends = append(trends, t)
+		comparisons = append(comparisons, c)
 	}
-	return trends, nil
+	return comparisons, rows.Err()
 }
 
-type escalationRepository struct {
+type auditRepository struct {
 	db *pgxpool.Pool
 }
 
-func (r *escalationRepository) Create(ctx context.Context, e *models.Escalation) error {
+func (r *auditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
 	_, err := r.db.Exec(ctx, `
-		INSERT INTO escalations (id, interaction_id, agent_id, reason, priority, status, context, resolution, resolved_by, resolved_at, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
-	`, e.ID, e.InteractionID, e.AgentID, e.Reason, e.Priority, e.Status, e.Context, e.Resolution, e.ResolvedBy, e.ResolvedAt)
+		INSERT INTO audit_logs (id, org_id, user_id, agent_id, action, resource_type, resource_id, old_value, new_value, ip_address, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::text::inet, $11, NOW())
+	`, entry.ID, entry.OrgID, entry.UserID, entry.AgentID, entry.Action, entry.ResourceType, entry.ResourceID, entry.OldValue, entry.NewValue, entry.IPAddress, entry.UserAgent)
 	return err
 }
 
-func (r *escalationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Escalation, error) {
-	e := &models.Escalation{}
+type routingRuleRepository struct {
+	db *pgxpool.Pool
+}
+
+func (r *routingRuleRepository) Create(ctx context.Context, rule *models.EscalationRoutingRule) error {
+	return r.db.QueryRow(ctx, `
+		INSERT INTO escalation_routing_rules (id, org_id, agent_id, provider, interaction_type, assignee_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING created_at
+	`, rule.ID, rule.OrgID, rule.AgentID, rule.Provider, rule.InteractionType, rule.AssigneeID).Scan(&rule.CreatedAt)
+}
+
+func (r *routingRuleRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.EscalationRoutingRule, error) {
+	rule := &models.EscalationRoutingRule{}
 	err := r.db.QueryRow(ctx, `
-		SELECT id, interaction_id, agent_id, reason, priority, status, context, resolution, resolved_by, resolved_at, created_at
-		FROM escalations WHERE id = $1
-	`, id).Scan(&e.ID, &e.InteractionID, &e.AgentID, &e.Reason, &e.Priority, &e.Status, &e.Context, &e.Resolution, &e.ResolvedBy, &e.ResolvedAt, &e.CreatedAt)
-	return e, err
+		SELECT id, org_id, agent_id, provider, interaction_type, assignee_id, created_at
+		FROM escalation_routing_rules WHERE id = $1
+	`, id).Scan(&rule.ID, &rule.OrgID, &rule.AgentID, &rule.Provider, &rule.InteractionType, &rule.AssigneeID, &rule.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return rule, nil
 }
 
-func (r *escalationRepository) ListPending(ctx context.Context, agentID uuid.UUID) ([]*models.Escalation, error) {
-	rows, err := r.db.Query(ctx, `
-		SELECT id, interaction_id, agent_id, reason, priority, status, context, resolution, resolved_by, resolved_at, created_at
-		FROM escalations WHERE agent_id = $1 AND status = 'pending'
-		ORDER BY
-			CASE priority
-				WHEN 'urgent' THEN 1
-				WHEN 'high' THEN 2
-				WHEN 'medium' THEN 3
-				ELSE 4
-			END,
-			created_at DESC
+func (r *routingRuleRepository) ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.EscalationRoutingRule, error) {
+	return r.list(ctx, `
+		SELECT id, org_id, agent_id, provider, interaction_type, assignee_id, created_at
+		FROM escalation_routing_rules WHERE org_id = $1
+		ORDER BY created_at
+	`, orgID)
+}
+
+func (r *routingRuleRepository) Update(ctx context.Context, rule *models.EscalationRoutingRule) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE escalation_routing_rules SET agent_id = $2, provider = $3, interaction_type = $4, assignee_id = $5
+		WHERE id = $1
+	`, rule.ID, rule.AgentID, rule.Provider, rule.InteractionType, rule.AssigneeID)
+	return err
+}
+
+func (r *routingRuleRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM escalation_routing_rules WHERE id = $1`, id)
+	return err
+}
+
+// Assignee picks the reviewer for a new escalation from the routing rules of
+// the agent owner's organizations, falling back to the agent owner
+func (r *routingRuleRepository) Assignee(ctx context.Context, agentID uuid.UUID, provider, interactionType string) (uuid.UUID, error) {
+	rules, err := r.list(ctx, `
+		SELECT rr.id, rr.org_id, rr.agent_id, rr.provider, rr.interaction_type, rr.assignee_id, rr.created_at
+		FROM escalation_routing_rules rr
+		JOIN memberships m ON m.org_id = rr.org_id
+		JOIN agents a ON a.user_id = m.user_id
+		WHERE a.id = $1 AND (rr.agent_id IS NULL OR rr.agent_id = $1)
+		ORDER BY rr.created_at
 	`, agentID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if rule := models.MatchRoutingRule(rules, agentID, provider, interactionType); rule != nil {
+		return rule.AssigneeID, nil
+	}
+
+	var owner uuid.UUID
+	err = r.db.QueryRow(ctx, `SELECT user_id FROM agents WHERE id = $1`, agentID).Scan(&owner)
+	if err != nil {
+		return uuid.Nil, notFound(err)
+	}
+	return owner, nil
+}
+
+func (r *routingRuleRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.EscalationRoutingRule, error) {
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var escalations []*models.Escalation
+	var rules []*models.EscalationRoutingRule
 	for rows.Next() {
-		e := &models.Escalation{}
-		if err := rows.Scan(&e.ID, &e.InteractionID, &e.AgentID, &e.Reason, &e.Priority, &e.Status, &e.Context, &e.Resolution, &e.ResolvedBy, &e.ResolvedAt, &e.CreatedAt); err != nil {
+		rule := &models.EscalationRoutingRule{}
+		if err := rows.Scan(&rule.ID, &rule.OrgID, &rule.AgentID, &rule.Provider, &rule.InteractionType, &rule.AssigneeID, &rule.CreatedAt); err != nil {
 			return nil, err
 		}
-		escalations = append(escalations, e)
+		rules = append(rules, rule)
 	}
-	return escalations, nil
+	return rules, rows.Err()
 }
 
-func (r *escalationRepository) Update(ctx context.Context, e *models.Escalation) error {
-	_, err := r.db.Exec(ctx, `
-		UPDATE escalations SET status = $2, resolution = $3, resolved_by = $4, resolved_at = $5
-		WHERE id = $1
-	`, e.ID, e.Status, e.Resolution, e.ResolvedBy, e.ResolvedAt)
-	return err
+type priorityRuleRepository struct {
+	db *pgxpool.Pool
 }
 
-func (r *escalationRepository) CountPending(ctx context.Context, agentID uuid.UUID) (int, error) {
-	var count int
+func (r *priorityRuleRepository) Create(ctx context.Context, rule *models.EscalationPriorityRule) error {
+	return r.db.QueryRow(ctx, `
+		INSERT INTO escalation_priority_rules (id, org_id, agent_id, provider, keyword, min_gap, weight, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		RETURNING created_at
+	`, rule.ID, rule.OrgID, rule.AgentID, rule.Provider, rule.Keyword, rule.MinGap, rule.Weight).Scan(&rule.CreatedAt)
+}
+
+func (r *priorityRuleRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.EscalationPriorityRule, error) {
+	rule := &models.EscalationPriorityRule{}
 	err := r.db.QueryRow(ctx, `
-		SELECT COUNT(*) FROM escalations WHERE agent_id = $1 AND status = 'pending'
-	`, agentID).Scan(&count)
-	return count, err
+		SELECT id, org_id, agent_id, provider, keyword, min_gap, weight, created_at
+		FROM escalation_priority_rules WHERE id = $1
+	`, id).Scan(&rule.ID, &rule.OrgID, &rule.AgentID, &rule.Provider, &rule.Keyword, &rule.MinGap, &rule.Weight, &rule.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return rule, nil
 }
 
-type trainingRepository struct {
-	db *pgxpool.Pool
+func (r *priorityRuleRepository) ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.EscalationPriorityRule, error) {
+	return r.list(ctx, `
+		SELECT id, org_id, agent_id, provider, keyword, min_gap, weight, created_at
+		FROM escalation_priority_rules WHERE org_id = $1
+		ORDER BY created_at
+	`, orgID)
 }
 
-func (r *trainingRepository) Create(ctx context.Context, s *models.TrainingSample) error {
+// ListForAgent returns the priority rules of the agent owner's organizations
+// that apply to the agent
+func (r *priorityRuleRepository) ListForAgent(ctx context.Context, agentID uuid.UUID) ([]*models.EscalationPriorityRule, error) {
+	return r.list(ctx, `
+		SELECT pr.id, pr.org_id, pr.agent_id, pr.provider, pr.keyword, pr.min_gap, pr.weight, pr.created_at
+		FROM escalation_priority_rules pr
+		JOIN memberships m ON m.org_id = pr.org_id
+		JOIN agents a ON a.user_id = m.user_id
+		WHERE a.id = $1 AND (pr.agent_id IS NULL OR pr.agent_id = $1)
+		ORDER BY pr.created_at
+	`, agentID)
+}
+
+func (r *priorityRuleRepository) Update(ctx context.Context, rule *models.EscalationPriorityRule) error {
 	_, err := r.db.Exec(ctx, `
-		INSERT INTO training_samples (id, agent_id, provider, sample_type, input_text, output_text, embedding, is_positive, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
-	`, s.ID, s.AgentID, s.Provider, s.SampleType, s.InputText, s.OutputText, s.Embedding, s.IsPositive)
+		UPDATE escalation_priority_rules SET agent_id = $2, provider = $3, keyword = $4, min_gap = $5, weight = $6
+		WHERE id = $1
+	`, rule.ID, rule.AgentID, rule.Provider, rule.Keyword, rule.MinGap, rule.Weight)
 	return err
 }
 
-func (r *trainingRepository) ListByAgentID(ctx context.Context, agentID uuid.UUID) ([]*models.TrainingSample, error) {
-	rows, err := r.db.Query(ctx, `
-		SELECT id, agent_id, provider, sample_type, input_text, output_text, is_positive, created_at
-		FROM training_samples WHERE agent_id = $1
-	`, agentID)
+func (r *priorityRuleRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM escalation_priority_rules WHERE id = $1`, id)
+	return err
+}
+
+func (r *priorityRuleRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.EscalationPriorityRule, error) {
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var samples []*models.TrainingSample
+	var rules []*models.EscalationPriorityRule
 	for rows.Next() {
-		s := &models.TrainingSample{}
-		if err := rows.Scan(&s.ID, &s.AgentID, &s.Provider, &s.SampleType, &s.InputText, &s.OutputText, &s.IsPositive, &s.CreatedAt); err != nil {
+		rule := &models.EscalationPriorityRule{}
+		if err := rows.Scan(&rule.ID, &rule.OrgID, &rule.AgentID, &rule.Provider, &rule.Keyword, &rule.MinGap, &rule.Weight, &rule.CreatedAt); err != nil {
 			return nil, err
 		}
-		samples = append(samples, s)
+		rules = append(rules, rule)
 	}
-	return samples, nil
+	return rules, rows.Err()
 }
 
-func (r *trainingRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.Exec(ctx, `DELETE FROM training_samples WHERE id = $1`, id)
-	return err
+type maintenanceWindowRepository struct {
+	db *pgxpool.Pool
 }
 
-type credentialRepository struct {
-	db *pgxpool.Pool
+func (r *maintenanceWindowRepository) Create(ctx context.Context, w *models.MaintenanceWindow) error {
+	return r.db.QueryRow(ctx, `
+		INSERT INTO maintenance_windows (id, org_id, agent_id, name, starts_at, ends_at, timezone, recurrence, on_end, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
+		RETURNING created_at
+	`, w.ID, w.OrgID, w.AgentID, w.Name, w.StartsAt, w.EndsAt, w.Timezone, w.Recurrence, w.OnEnd, w.CreatedBy).Scan(&w.CreatedAt)
 }
 
-func (r *credentialRepository) Create(ctx context.Context, cred *models.OrganizationCredential) error {
+func (r *maintenanceWindowRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.MaintenanceWindow, error) {
+	w := &models.MaintenanceWindow{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, org_id, agent_id, name, starts_at, ends_at, timezone, recurrence, on_end, created_by, created_at
+		FROM maintenance_windows WHERE id = $1
+	`, id).Scan(&w.ID, &w.OrgID, &w.AgentID, &w.Name, &w.StartsAt, &w.EndsAt, &w.Timezone, &w.Recurrence, &w.OnEnd, &w.CreatedBy, &w.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return w, nil
+}
+
+func (r *maintenanceWindowRepository) ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.MaintenanceWindow, error) {
+	return r.list(ctx, `
+		SELECT id, org_id, agent_id, name, starts_at, ends_at, timezone, recurrence, on_end, created_by, created_at
+		FROM maintenance_windows WHERE org_id = $1
+		ORDER BY starts_at
+	`, orgID)
+}
+
+// ListForAgent returns the maintenance windows of the agent owner's
+// organizations that apply to the agent
+func (r *maintenanceWindowRepository) ListForAgent(ctx context.Context, agentID uuid.UUID) ([]*models.MaintenanceWindow, error) {
+	return r.list(ctx, `
+		SELECT mw.id, mw.org_id, mw.agent_id, mw.name, mw.starts_at, mw.ends_at, mw.timezone, mw.recurrence, mw.on_end, mw.created_by, mw.created_at
+		FROM maintenance_windows mw
+		JOIN memberships m ON m.org_id = mw.org_id
+		JOIN agents a ON a.user_id = m.user_id
+		WHERE a.id = $1 AND (mw.agent_id IS NULL OR mw.agent_id = $1)
+		ORDER BY mw.starts_at
+	`, agentID)
+}
+
+func (r *maintenanceWindowRepository) Update(ctx context.Context, w *models.MaintenanceWindow) error {
 	_, err := r.db.Exec(ctx, `
-		INSERT INTO organization_credentials (id, org_id, provider, client_id, client_secret, webhook_secret, signing_secret, config, is_active, created_by, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW())
-	`, cred.ID, cred.OrgID, cred.Provider, cred.ClientID, cred.ClientSecret, cred.WebhookSecret, cred.SigningSecret, cred.Config, cred.IsActive, cred.CreatedBy)
+		UPDATE maintenance_windows SET agent_id = $2, name = $3, starts_at = $4, ends_at = $5, timezone = $6, recurrence = $7, on_end = $8
+		WHERE id = $1
+	`, w.ID, w.AgentID, w.Name, w.StartsAt, w.EndsAt, w.Timezone, w.Recurrence, w.OnEnd)
 	return err
 }
 
-func (r *credentialRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.OrganizationCredential, error) {
-	cred := &models.OrganizationCredential{}
-	err := r.db.QueryRow(ctx, `
-		SELECT id, org_id, provider, client_id, client_secret, webhook_secret, signing_secret, config, is_active, verified_at, created_by, created_at, updated_at
-		FROM organization_credentials WHERE id = $1
-	`, id).Scan(&cred.ID, &cred.OrgID, &cred.Provider, &cred.ClientID, &cred.ClientSecret, &cred.WebhookSecret, &cred.SigningSecret, &cred.Config, &cred.IsActive, &cred.VerifiedAt, &cred.CreatedBy, &cred.CreatedAt, &cred.UpdatedAt)
-	return cred, err
+func (r *maintenanceWindowRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM maintenance_windows WHERE id = $1`, id)
+	return err
 }
 
-func (r *credentialRepository) GetByOrgAndProvider(ctx context.Context, orgID uuid.UUID, provider string) (*models.OrganizationCredential, error) {
-	cred := &models.OrganizationCredential{}
+func (r *maintenanceWindowRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.MaintenanceWindow, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var windows []*models.MaintenanceWindow
+	for rows.Next() {
+		w := &models.MaintenanceWindow{}
+		if err := rows.Scan(&w.ID, &w.OrgID, &w.AgentID, &w.Name, &w.StartsAt, &w.EndsAt, &w.Timezone, &w.Recurrence, &w.OnEnd, &w.CreatedBy, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+type tagRepository struct {
+	db *pgxpool.Pool
+}
+
+func (r *tagRepository) Create(ctx context.Context, tag *models.Tag) error {
 	err := r.db.QueryRow(ctx, `
-		SELECT id, org_id, provider, client_id, client_secret, webhook_secret, signing_secret, config, is_active, verified_at, created_by, created_at, updated_at
-		FROM organization_credentials WHERE org_id = $1 AND provider = $2
-	`, orgID, provider).Scan(&cred.ID, &cred.OrgID, &cred.Provider, &cred.ClientID, &cred.ClientSecret, &cred.WebhookSecret, &cred.SigningSecret, &cred.Config, &cred.IsActive, &cred.VerifiedAt, &cred.CreatedBy, &cred.CreatedAt, &cred.UpdatedAt)
-	return cred, err
+		INSERT INTO tags (id, org_id, name, color, description, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING created_at
+	`, tag.ID, tag.OrgID, tag.Name, tag.Color, tag.Description, tag.CreatedBy).Scan(&tag.CreatedAt)
+	return tagNameError(err)
 }
 
-func (r *credentialRepository) ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.OrganizationCredential, error) {
+func (r *tagRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Tag, error) {
+	return r.get(ctx, `
+		SELECT id, org_id, name, color, description, created_by, created_at
+		FROM tags WHERE id = $1
+	`, id)
+}
+
+func (r *tagRepository) GetByName(ctx context.Context, orgID uuid.UUID, name string) (*models.Tag, error) {
+	return r.get(ctx, `
+		SELECT id, org_id, name, color, description, created_by, created_at
+		FROM tags WHERE org_id = $1 AND name = $2
+	`, orgID, name)
+}
+
+func (r *tagRepository) get(ctx context.Context, query string, args ...interface{}) (*models.Tag, error) {
+	t := &models.Tag{}
+	err := r.db.QueryRow(ctx, query, args...).Scan(&t.ID, &t.OrgID, &t.Name, &t.Color, &t.Description, &t.CreatedBy, &t.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return t, nil
+}
+
+// ListByOrgID returns the organization's tags by name, with how many
+// interactions carry each
+func (r *tagRepository) ListByOrgID(ctx context.Context, orgID uuid.UUID) ([]*models.Tag, error) {
 	rows, err := r.db.Query(ctx, `
-		SELECT id, org_id, provider, client_id, client_secret, webhook_secret, signing_secret, config, is_active, verified_at, created_by, created_at, updated_at
-		FROM organization_credentials WHERE org_id = $1
+		SELECT t.id, t.org_id, t.name, t.color, t.description, t.created_by, t.created_at,
+			(SELECT COUNT(*) FROM interaction_tags it WHERE it.tag_id = t.id)
+		FROM tags t WHERE t.org_id = $1
+		ORDER BY t.name
 	`, orgID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var credentials []*models.OrganizationCredential
+	var tags []*models.Tag
 	for rows.Next() {
-		cred := &models.OrganizationCredential{}
-		if err := rows.Scan(&cred.ID, &cred.OrgID, &cred.Provider, &cred.ClientID, &cred.ClientSecret, &cred.WebhookSecret, &cred.SigningSecret, &cred.Config, &cred.IsActive, &cred.VerifiedAt, &cred.CreatedBy, &cred.CreatedAt, &cred.UpdatedAt); err != nil {
+		t := &models.Tag{}
+		var count int
+		if err := rows.Scan(&t.ID, &t.OrgID, &t.Name, &t.Color, &t.Description, &t.CreatedBy, &t.CreatedAt, &count); err != nil {
 			return nil, err
 		}
-		credentials = append(credentials, cred)
+		t.InteractionCount = &count
+		tags = append(tags, t)
 	}
-	return credentials, nil
+	return tags, rows.Err()
 }
 
-func (r *credentialRepository) Update(ctx context.Context, cred *models.OrganizationCredential) error {
+func (r *tagRepository) Update(ctx context.Context, tag *models.Tag) error {
 	_, err := r.db.Exec(ctx, `
-		UPDATE organization_credentials
-		SET client_id = $2, client_secret = $3, webhook_secret = $4, signing_secret = $5, config = $6, is_active = $7, verified_at = $8, updated_at = NOW()
+		UPDATE tags SET name = $2, color = $3, description = $4
 		WHERE id = $1
-	`, cred.ID, cred.ClientID, cred.ClientSecret, cred.WebhookSecret, cred.SigningSecret, cred.Config, cred.IsActive, cred.VerifiedAt)
+	`, tag.ID, tag.Name, tag.Color, tag.Description)
+	return tagNameError(err)
+}
+
+// tagNameError maps a violation of the per-organization tag name constraint
+// to ErrTagExists and passes other errors through
+func tagNameError(err error) error {
+	if isUniqueViolation(err, "tags_org_id_name_key") {
+		return ErrTagExists
+	}
 	return err
 }
 
-func (r *credentialRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.Exec(ctx, `DELETE FROM organization_credentials WHERE id = $1`, id)
+func (r *tagRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM tags WHERE id = $1`, id)
 	return err
 }
 
-func (r *credentialRepository) MarkVerified(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.Exec(ctx, `UPDATE organization_credentials SET verified_at = NOW(), updated_at = NOW() WHERE id = $1`, id)
+// AddToInteraction tags an interaction, reporting whether it was not
+// already tagged
+func (r *tagRepository) AddToInteraction(ctx context.Context, interactionID, tagID, userID uuid.UUID) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		INSERT INTO interaction_tags (interaction_id, tag_id, tagged_by, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (interaction_id, tag_id) DO NOTHING
+	`, interactionID, tagID, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RemoveFromInteraction untags an interaction, reporting whether it was tagged
+func (r *tagRepository) RemoveFromInteraction(ctx context.Context, interactionID, tagID uuid.UUID) (bool, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM interaction_tags WHERE interaction_id = $1 AND tag_id = $2`, interactionID, tagID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ListForInteraction returns the organization's tags applied to the
+// interaction, by name
+func (r *tagRepository) ListForInteraction(ctx context.Context, interactionID, orgID uuid.UUID) ([]*models.InteractionTag, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT t.id, t.org_id, t.name, t.color, t.description, t.created_by, t.created_at, it.tagged_by, it.created_at
+		FROM interaction_tags it
+		JOIN tags t ON t.id = it.tag_id
+		WHERE it.interaction_id = $1 AND t.org_id = $2
+		ORDER BY t.name
+	`, interactionID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []*models.InteractionTag
+	for rows.Next() {
+		it := &models.InteractionTag{Tag: &models.Tag{}}
+		if err := rows.Scan(&it.ID, &it.OrgID, &it.Name, &it.Color, &it.Description, &it.CreatedBy, &it.CreatedAt, &it.TaggedBy, &it.TaggedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, it)
+	}
+	return tags, rows.Err()
+}
+
+// FilterTagged returns which of the interactions carry the tag
+func (r *tagRepository) FilterTagged(ctx context.Context, tagID uuid.UUID, interactionIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT interaction_id FROM interaction_tags
+		WHERE tag_id = $1 AND interaction_id = ANY($2)
+	`, tagID, interactionIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tagged := make(map[uuid.UUID]bool)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		tagged[id] = true
+	}
+	return tagged, rows.Err()
+}
+
+type sessionRepository struct {
+	db *pgxpool.Pool
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *models.Session) error {
+	return r.db.QueryRow(ctx, `
+		INSERT INTO refresh_sessions (id, user_id, device_id, fingerprint, user_agent, created_at, last_used_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), $6)
+		RETURNING created_at, last_used_at
+	`, session.ID, session.UserID, session.DeviceID, session.Fingerprint, session.UserAgent, session.ExpiresAt).Scan(&session.CreatedAt, &session.LastUsedAt)
+}
+
+func (r *sessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	s := &models.Session{}
+	err := r.db.QueryRow(ctx, `
+		SELECT id, user_id, device_id, fingerprint, user_agent, created_at, last_used_at, expires_at, revoked_at
+		FROM refresh_sessions WHERE id = $1
+	`, id).Scan(&s.ID, &s.UserID, &s.DeviceID, &s.Fingerprint, &s.UserAgent, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return s, nil
+}
+
+// ListActiveByUserID returns the user's unrevoked, unexpired sessions, most
+// recently used first
+func (r *sessionRepository) ListActiveByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Session, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, user_id, device_id, fingerprint, user_agent, created_at, last_used_at, expires_at, revoked_at
+		FROM refresh_sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		s := &models.Session{}
+		if err := rows.Scan(&s.ID, &s.UserID, &s.DeviceID, &s.Fingerprint, &s.UserAgent, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// Touch records that the session was just used to refresh
+func (r *sessionRepository) Touch(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, `UPDATE refresh_sessions SET last_used_at = NOW() WHERE id = $1`, id)
 	return err
 }
+
+// Revoke ends one of the user's sessions. Reports false when the user has no
+// such active session.
+func (r *sessionRepository) Revoke(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE refresh_sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
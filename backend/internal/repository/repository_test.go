@@ -0,0 +1,447 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/vibber/backend/internal/crypto"
+	"github.com/vibber/backend/internal/models"
+)
+
+// testDB connects to the Postgres named by TEST_DATABASE_URL, such as the
+// docker-compose database, and applies the migrations to a fresh schema that
+// is dropped when the test ends. Tests using it are skipped without one.
+func testDB(t *testing.T) (*Repositories, *pgxpool.Pool) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(admin.Close)
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+	})
+
+	// Extensions already installed in public stay visible
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = schema + ",public"
+	config.ConnConfig.RuntimeParams["timezone"] = "UTC"
+	db, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	files, err := filepath.Glob("../../migrations/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(ctx, string(migration)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(file), err)
+		}
+	}
+
+	keyring, err := crypto.NewKeyring(1, map[int][]byte{1: []byte("0123456789abcdef0123456789abcdef")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRepositories(db, nil, keyring), db
+}
+
+// exec runs fixture SQL, failing the test on error
+func exec(t *testing.T, db *pgxpool.Pool, sql string, args ...interface{}) {
+	t.Helper()
+	if _, err := db.Exec(context.Background(), sql, args...); err != nil {
+		t.Fatalf("%s: %v", strings.TrimSpace(sql), err)
+	}
+}
+
+// createOrg inserts an organization
+func createOrg(t *testing.T, db *pgxpool.Pool) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	exec(t, db, `INSERT INTO organizations (id, name, slug) VALUES ($1, $2, $2)`, id, "org-"+id.String())
+	return id
+}
+
+// createUser inserts a user whose home organization is orgID, with a
+// membership of role in it
+func createUser(t *testing.T, db *pgxpool.Pool, orgID uuid.UUID, role string) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	exec(t, db, `INSERT INTO users (id, org_id, email, name, role) VALUES ($1, $2, $3, 'Test', $4)`, id, orgID, id.String()+"@example.com", role)
+	exec(t, db, `INSERT INTO memberships (user_id, org_id, role) VALUES ($1, $2, $3)`, id, orgID, role)
+	return id
+}
+
+// createAgent inserts an active agent of orgID owned by userID
+func createAgent(t *testing.T, db *pgxpool.Pool, orgID, userID uuid.UUID) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	exec(t, db, `INSERT INTO agents (id, user_id, org_id, name, status) VALUES ($1, $2, $3, 'Agent', 'active')`, id, userID, orgID)
+	return id
+}
+
+// createInteraction inserts an interaction of the agent
+func createInteraction(t *testing.T, db *pgxpool.Pool, agentID uuid.UUID, interactionType, status string, escalated bool) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	exec(t, db, `
+		INSERT INTO interactions (id, agent_id, provider, interaction_type, input_data, status, escalated)
+		VALUES ($1, $2, 'slack', $3, '{}', $4, $5)
+	`, id, agentID, interactionType, status, escalated)
+	return id
+}
+
+// createIntegration inserts an enabled integration of the agent connected to
+// workspace externalID, with metadata
+func createIntegration(t *testing.T, db *pgxpool.Pool, agentID uuid.UUID, provider, externalID, metadata string) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	exec(t, db, `
+		INSERT INTO integrations (id, agent_id, provider, access_token, external_id, metadata)
+		VALUES ($1, $2, $3, 'token', NULLIF($4, ''), $5)
+	`, id, agentID, provider, externalID, metadata)
+	return id
+}
+
+// createEscalation inserts an escalation of the interaction
+func createEscalation(t *testing.T, db *pgxpool.Pool, agentID, interactionID uuid.UUID, priority, status string) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	exec(t, db, `
+		INSERT INTO escalations (id, interaction_id, agent_id, reason, priority, status)
+		VALUES ($1, $2, $3, 'low confidence', $4, $5)
+	`, id, interactionID, agentID, priority, status)
+	return id
+}
+
+func TestGetOverviewMetrics(t *testing.T) {
+	repos, db := testDB(t)
+	ctx := context.Background()
+
+	orgID := createOrg(t, db)
+	agentID := createAgent(t, db, orgID, createUser(t, db, orgID, "admin"))
+	createInteraction(t, db, agentID, "message", "completed", false)
+	createInteraction(t, db, agentID, "message", "completed", false)
+	createInteraction(t, db, agentID, "message", "escalated", true)
+	createInteraction(t, db, agentID, "mention", "escalated", true)
+	createInteraction(t, db, agentID, "message", "skipped", false)
+	// Another agent's interactions are not counted
+	createInteraction(t, db, createAgent(t, db, orgID, createUser(t, db, orgID, "member")), "message", "escalated", true)
+
+	metrics, err := repos.Interaction.GetOverviewMetrics(ctx, agentID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Skipped interactions only show up in the status breakdown
+	if metrics.TotalInteractions != 4 || metrics.EscalatedInteractions != 2 || metrics.AutonomousRate != 50 {
+		t.Errorf("got %d total, %d escalated, %v%% autonomous; want 4, 2, 50%%", metrics.TotalInteractions, metrics.EscalatedInteractions, metrics.AutonomousRate)
+	}
+	if metrics.TodayInteractions != 4 {
+		t.Errorf("got %d today, want 4", metrics.TodayInteractions)
+	}
+	if metrics.InteractionsByStatus["skipped"] != 1 || metrics.InteractionsByStatus["completed"] != 2 {
+		t.Errorf("unexpected status breakdown %v", metrics.InteractionsByStatus)
+	}
+
+	metrics, err = repos.Interaction.GetOverviewMetrics(ctx, agentID, "message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.TotalInteractions != 3 || metrics.EscalatedInteractions != 1 {
+		t.Errorf("messages: got %d total, %d escalated; want 3, 1", metrics.TotalInteractions, metrics.EscalatedInteractions)
+	}
+
+	// A failed query is an error rather than a zero in otherwise complete metrics
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if metrics, err := repos.Interaction.GetOverviewMetrics(cancelled, agentID, ""); err == nil {
+		t.Errorf("got metrics %+v from failed queries", metrics)
+	}
+}
+
+func TestListEscalationsWithInteractions(t *testing.T) {
+	repos, db := testDB(t)
+	ctx := context.Background()
+
+	orgID := createOrg(t, db)
+	userID := createUser(t, db, orgID, "admin")
+	agentID := createAgent(t, db, orgID, userID)
+	escalate := func(agentID uuid.UUID, priority, status string) uuid.UUID {
+		return createEscalation(t, db, agentID, createInteraction(t, db, agentID, "message", "escalated", true), priority, status)
+	}
+	urgent := escalate(agentID, "urgent", "pending")
+	high := escalate(agentID, "high", "pending")
+	escalate(agentID, "low", "pending")
+	escalate(agentID, "high", "resolved")
+	// Another user's escalations are never listed
+	escalate(createAgent(t, db, orgID, createUser(t, db, orgID, "member")), "urgent", "pending")
+
+	items, total, err := repos.Escalation.ListEscalationsWithInteractions(ctx, userID, models.EscalationFilter{Status: "pending"}, models.PaginationParams{Page: 1, PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(items) != 2 {
+		t.Fatalf("got %d of %d pending escalations, want 2 of 3", len(items), total)
+	}
+	// Most urgent first
+	if items[0].Escalation.ID != urgent || items[1].Escalation.ID != high {
+		t.Errorf("got %s, %s first; want urgent then high", items[0].Escalation.Priority, items[1].Escalation.Priority)
+	}
+	for _, item := range items {
+		if item.Interaction == nil || item.Interaction.ID != item.Escalation.InteractionID || item.AgentName != "Agent" {
+			t.Errorf("escalation %s not joined to its interaction and agent: %+v", item.Escalation.ID, item)
+		}
+	}
+
+	items, total, err = repos.Escalation.ListEscalationsWithInteractions(ctx, userID, models.EscalationFilter{Status: "pending"}, models.PaginationParams{Page: 2, PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(items) != 1 || items[0].Escalation.Priority != "low" {
+		t.Errorf("second page: got %d of %d escalations, want the low one of 3", len(items), total)
+	}
+
+	items, total, err = repos.Escalation.ListEscalationsWithInteractions(ctx, userID, models.EscalationFilter{AgentID: &agentID, Priority: "high"}, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(items) != 2 {
+		t.Errorf("high: got %d of %d escalations, want 2 of 2", len(items), total)
+	}
+}
+
+func TestOrgAgentsAreScopedToTheirOrganization(t *testing.T) {
+	repos, db := testDB(t)
+	ctx := context.Background()
+
+	// The user is a member of both organizations and has an agent in each
+	orgA, orgB := createOrg(t, db), createOrg(t, db)
+	userID := createUser(t, db, orgA, "admin")
+	exec(t, db, `INSERT INTO memberships (user_id, org_id, role) VALUES ($1, $2, 'admin')`, userID, orgB)
+	agentA, agentB := createAgent(t, db, orgA, userID), createAgent(t, db, orgB, userID)
+
+	agents, err := repos.Agent.ListByOrgID(ctx, orgB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].ID != agentB || agents[0].OrgID != orgB {
+		t.Errorf("got %d agents of org B, want only agent B", len(agents))
+	}
+
+	paused, err := repos.Organization.PauseAgents(ctx, orgB, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paused) != 1 || paused[0] != agentB {
+		t.Errorf("pausing org B paused %v, want only agent B", paused)
+	}
+	for agentID, want := range map[uuid.UUID]bool{agentA: false, agentB: true} {
+		orgPaused, err := repos.Agent.IsOrgPaused(ctx, agentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		agent, err := repos.Agent.GetByID(ctx, agentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if orgPaused != want || (agent.Status == "paused") != want {
+			t.Errorf("agent %s: org paused %v, status %s; want paused %v", agentID, orgPaused, agent.Status, want)
+		}
+	}
+
+	resumed, err := repos.Organization.ResumeAgents(ctx, orgB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed) != 1 || resumed[0] != agentB {
+		t.Errorf("resuming org B resumed %v, want only agent B", resumed)
+	}
+}
+
+func TestListInteractionsByOrgID(t *testing.T) {
+	repos, db := testDB(t)
+	ctx := context.Background()
+
+	// The owner is a member of both organizations, with an agent in each
+	orgA, orgB := createOrg(t, db), createOrg(t, db)
+	ownerID := createUser(t, db, orgA, "member")
+	exec(t, db, `INSERT INTO memberships (user_id, org_id, role) VALUES ($1, $2, 'member')`, ownerID, orgB)
+	agentA, agentB := createAgent(t, db, orgA, ownerID), createAgent(t, db, orgA, createUser(t, db, orgA, "admin"))
+	createInteraction(t, db, agentA, "message", "completed", false)
+	createInteraction(t, db, agentA, "message", "escalated", true)
+	createInteraction(t, db, agentB, "message", "completed", false)
+	createInteraction(t, db, createAgent(t, db, orgB, ownerID), "message", "completed", false)
+
+	interactions, total, err := repos.Interaction.ListByOrgID(ctx, orgA, models.InteractionFilter{}, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(interactions) != 3 {
+		t.Fatalf("got %d of %d interactions of org A, want 3 of 3", len(interactions), total)
+	}
+	for _, i := range interactions {
+		if i.AgentID != agentA && i.AgentID != agentB {
+			t.Errorf("listed interaction %s of another organization's agent", i.ID)
+		}
+		if i.AgentID == agentA && (i.OwnerID != ownerID || i.OwnerName != "Test") {
+			t.Errorf("interaction %s owned by %s %q, want %s", i.ID, i.OwnerID, i.OwnerName, ownerID)
+		}
+	}
+
+	interactions, total, err = repos.Interaction.ListByOrgID(ctx, orgA, models.InteractionFilter{AgentID: &agentA, Status: "escalated"}, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(interactions) != 1 || !interactions[0].Escalated {
+		t.Errorf("filtered: got %d of %d interactions, want the escalated one", len(interactions), total)
+	}
+
+	interactions, total, err = repos.Interaction.ListByOrgID(ctx, orgB, models.InteractionFilter{}, models.PaginationParams{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(interactions) != 1 {
+		t.Errorf("got %d of %d interactions of org B, want 1 of 1", len(interactions), total)
+	}
+}
+
+func TestGetIntegrationByExternalID(t *testing.T) {
+	repos, db := testDB(t)
+	ctx := context.Background()
+
+	orgID := createOrg(t, db)
+	userID := createUser(t, db, orgID, "admin")
+	agentA, agentB := createAgent(t, db, orgID, userID), createAgent(t, db, orgID, userID)
+	first := createIntegration(t, db, agentA, "slack", "T123", `{}`)
+	exec(t, db, `UPDATE integrations SET created_at = NOW() - INTERVAL '1 day' WHERE id = $1`, first)
+	createIntegration(t, db, agentB, "slack", "T123", `{}`)
+	byTeam := createIntegration(t, db, agentA, "github", "", `{"teamId": "acme"}`)
+	jira := createIntegration(t, db, agentA, "jira", "", `{"cloudId": "c0ffee", "siteUrl": "https://acme.atlassian.net/"}`)
+
+	for _, tt := range []struct {
+		provider, externalID string
+		want                 uuid.UUID
+	}{
+		{"slack", "T123", first},
+		{"github", "acme", byTeam},
+		{"jira", "c0ffee", jira},
+		{"jira", "https://acme.atlassian.net", jira},
+	} {
+		integration, err := repos.Integration.GetByExternalID(ctx, tt.provider, tt.externalID)
+		if err != nil {
+			t.Errorf("%s %s: %v", tt.provider, tt.externalID, err)
+			continue
+		}
+		if integration.ID != tt.want || integration.Provider != tt.provider {
+			t.Errorf("%s %s: got %s integration %s, want %s", tt.provider, tt.externalID, integration.Provider, integration.ID, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ provider, externalID string }{
+		{"slack", "T999"},
+		{"github", "T123"},
+		{"jira", ""},
+	} {
+		if _, err := repos.Integration.GetByExternalID(ctx, tt.provider, tt.externalID); err != ErrNotFound {
+			t.Errorf("%s %q: got %v, want ErrNotFound", tt.provider, tt.externalID, err)
+		}
+	}
+}
+
+func TestRecordInteraction(t *testing.T) {
+	repos, db := testDB(t)
+	ctx := context.Background()
+
+	orgID := createOrg(t, db)
+	agentID := createAgent(t, db, orgID, createUser(t, db, orgID, "admin"))
+	interaction, err := repos.Interaction.GetByID(ctx, createInteraction(t, db, agentID, "message", "pending", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Completing a queued interaction saves it with its escalation
+	confidence := 40
+	interaction.ConfidenceScore = &confidence
+	interaction.Status = "escalated"
+	interaction.Escalated = true
+	escalation := &models.Escalation{ID: uuid.New(), InteractionID: interaction.ID, AgentID: agentID, Reason: "low confidence", Priority: "high", Status: "pending"}
+	if err := repos.Interaction.Record(ctx, interaction, escalation); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := repos.Interaction.GetByID(ctx, interaction.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != "escalated" || !saved.Escalated || saved.ConfidenceScore == nil || *saved.ConfidenceScore != 40 {
+		t.Errorf("interaction saved as %+v", saved)
+	}
+	if got, err := repos.Escalation.GetByInteractionID(ctx, interaction.ID); err != nil || got == nil || got.ID != escalation.ID {
+		t.Errorf("got escalation %v (%v), want %s", got, err, escalation.ID)
+	}
+
+	// An escalation that can't be saved leaves the interaction untouched
+	interaction.Status = "completed"
+	interaction.Escalated = false
+	if err := repos.Interaction.Record(ctx, interaction, escalation); err == nil {
+		t.Fatal("recorded a duplicate escalation")
+	}
+	if saved, _ := repos.Interaction.GetByID(ctx, interaction.ID); saved.Status != "escalated" {
+		t.Errorf("interaction changed to %q by a failed record", saved.Status)
+	}
+}
+
+func TestListUnescalatedFailures(t *testing.T) {
+	repos, db := testDB(t)
+	ctx := context.Background()
+
+	orgID := createOrg(t, db)
+	agentID := createAgent(t, db, orgID, createUser(t, db, orgID, "admin"))
+	failed := func(reason string, age time.Duration) uuid.UUID {
+		id := createInteraction(t, db, agentID, "message", "failed", false)
+		exec(t, db, `UPDATE interactions SET error_message = $2, completed_at = NOW() - $3 * INTERVAL '1 second' WHERE id = $1`, id, reason, age.Seconds())
+		return id
+	}
+	unescalated := failed("timeout", time.Minute)
+	escalated := failed("timeout", time.Minute)
+	createEscalation(t, db, agentID, escalated, "medium", "pending")
+	failed("timeout", 48*time.Hour)
+	failed("ai service error", time.Minute)
+
+	interactions, err := repos.Interaction.ListUnescalatedFailures(ctx, "timeout", 24*time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(interactions) != 1 || interactions[0].ID != unescalated {
+		t.Errorf("got %d interactions, want only %s", len(interactions), unescalated)
+	}
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// QueryTracer logs queries slower than a threshold and counts the queries
+// run for each request that carries QueryStats
+type QueryTracer struct {
+	slow time.Duration // 0 disables slow query logging
+}
+
+func NewQueryTracer(slow time.Duration) *QueryTracer {
+	return &QueryTracer{slow: slow}
+}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql   string
+	start time.Time
+}
+
+func (t *QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if stats := QueryStatsFrom(ctx); stats != nil {
+		stats.queries.Add(1)
+	}
+	if t.slow <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, queryStartKey{}, &queryStart{sql: data.SQL, start: time.Now()})
+}
+
+func (t *QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	qs, ok := ctx.Value(queryStartKey{}).(*queryStart)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(qs.start)
+	if elapsed < t.slow {
+		return
+	}
+
+	// Only the statement is logged; argument values may hold user data
+	event := log.Warn().Dur("duration", elapsed).Str("sql", strings.Join(strings.Fields(qs.sql), " "))
+	if stats := QueryStatsFrom(ctx); stats != nil {
+		event = event.Str("request_id", stats.RequestID)
+	}
+	if data.Err != nil {
+		event = event.Err(data.Err)
+	}
+	event.Msg("Slow query")
+}
+
+// QueryStats counts the queries run on behalf of one request
+type QueryStats struct {
+	RequestID string
+	queries   atomic.Int64
+}
+
+// Queries returns the number of queries run so far
+func (s *QueryStats) Queries() int {
+	return int(s.queries.Load())
+}
+
+type queryStatsKey struct{}
+
+// WithQueryStats attaches stats to ctx; queries run with the returned context
+// are counted in it
+func WithQueryStats(ctx context.Context, stats *QueryStats) context.Context {
+	return context.WithValue(ctx, queryStatsKey{}, stats)
+}
+
+// QueryStatsFrom returns the stats attached to ctx, or nil
+func QueryStatsFrom(ctx context.Context) *QueryStats {
+	stats, _ := ctx.Value(queryStatsKey{}).(*QueryStats)
+	return stats
+}
@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/analytics"
+	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/repository"
+)
+
+// releaseBatchSize bounds how many deferred interactions one pass handles
+const releaseBatchSize = 500
+
+// MaintenanceReleaser ends the deferral of webhook events held back by a
+// maintenance window once the window is over, queueing them for processing
+// or dropping them as the window says
+type MaintenanceReleaser struct {
+	repos *repository.Repositories
+	redis *redis.Client
+	cfg   *config.Config
+}
+
+func NewMaintenanceReleaser(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *MaintenanceReleaser {
+	return &MaintenanceReleaser{
+		repos: repos,
+		redis: redis,
+		cfg:   cfg,
+	}
+}
+
+// Run releases on every sweep interval until ctx is cancelled, reporting
+// each pass to hb
+func (m *MaintenanceReleaser) Run(ctx context.Context, hb *Heartbeat) {
+	ticker := time.NewTicker(time.Duration(m.cfg.SweepIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hb.Ran(m.Release(ctx))
+		}
+	}
+}
+
+// Release runs a single pass, bounded by the sweep interval. Events whose
+// window was deleted are released. Only a failure to list deferred events is
+// returned; failures for individual events are logged and retried next pass.
+func (m *MaintenanceReleaser) Release(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(m.cfg.SweepIntervalSeconds)*time.Second)
+	defer cancel()
+
+	deferred, err := m.repos.Interaction.ListDeferred(ctx, releaseBatchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list deferred interactions")
+		return err
+	}
+
+	now := time.Now()
+	windows := make(map[uuid.UUID]*models.MaintenanceWindow)
+	var released, dropped int
+	var changed []uuid.UUID
+	for _, interaction := range deferred {
+		release := true
+		if interaction.DeferredBy != nil {
+			window, ok := windows[*interaction.DeferredBy]
+			if !ok {
+				window, err = m.repos.Maintenance.GetByID(ctx, *interaction.DeferredBy)
+				if err != nil && !errors.Is(err, repository.ErrNotFound) {
+					log.Error().Err(err).Str("window_id", interaction.DeferredBy.String()).Msg("Failed to load maintenance window")
+					continue
+				}
+				windows[*interaction.DeferredBy] = window
+			}
+			if window != nil {
+				if window.ActiveAt(now) {
+					continue
+				}
+				release = window.OnEnd != models.MaintenanceDrop
+			}
+		}
+
+		ended, err := m.repos.Interaction.EndDeferral(ctx, interaction.ID, release)
+		if err != nil {
+			log.Error().Err(err).Str("interaction_id", interaction.ID.String()).Msg("Failed to end deferral")
+			continue
+		}
+		if !ended {
+			continue
+		}
+		changed = append(changed, interaction.AgentID)
+		if !release {
+			dropped++
+			continue
+		}
+
+		interaction.Status = "pending"
+		interaction.DeferredBy = nil
+		message, _ := json.Marshal(interaction)
+		if err := m.redis.Publish(ctx, "agent:interactions", message).Err(); err != nil {
+			log.Error().Err(err).Str("interaction_id", interaction.ID.String()).Msg("Failed to queue released interaction")
+		}
+		released++
+	}
+
+	if released > 0 || dropped > 0 {
+		log.Info().Int("released", released).Int("dropped", dropped).Msg("Ended maintenance deferrals")
+	}
+	if err := analytics.Invalidate(ctx, m.redis, changed...); err != nil {
+		log.Warn().Err(err).Msg("Failed to invalidate cached analytics")
+	}
+	return nil
+}
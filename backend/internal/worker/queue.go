@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Job is a unit of work run by a Queue worker
+type Job func(ctx context.Context)
+
+// QueueStats is a point-in-time view of a Queue
+type QueueStats struct {
+	Depth     int   `json:"depth"`
+	Capacity  int   `json:"capacity"`
+	Workers   int   `json:"workers"`
+	Processed int64 `json:"processed"`
+	Failed    int64 `json:"failed"` // Jobs that panicked
+	Dropped   int64 `json:"dropped"`
+}
+
+// Queue is a bounded job buffer drained by a fixed pool of workers. Submit
+// never blocks, so callers can shed load instead of piling up goroutines.
+// Each job runs to completion or its timeout, even across shutdown.
+type Queue struct {
+	jobs      chan Job
+	workers   int
+	timeout   time.Duration
+	processed atomic.Int64
+	failed    atomic.Int64
+	dropped   atomic.Int64
+}
+
+func NewQueue(size, workers int, timeout time.Duration) *Queue {
+	return &Queue{
+		jobs:    make(chan Job, size),
+		workers: workers,
+		timeout: timeout,
+	}
+}
+
+// Submit buffers a job, returning false if the buffer is full
+func (q *Queue) Submit(job Job) bool {
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		q.dropped.Add(1)
+		return false
+	}
+}
+
+// Run starts the workers and blocks until ctx is cancelled. Jobs still
+// buffered at that point are drained before Run returns.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			q.drain(ctx)
+			return
+		case job := <-q.jobs:
+			q.run(ctx, job)
+		}
+	}
+}
+
+func (q *Queue) drain(ctx context.Context) {
+	for {
+		select {
+		case job := <-q.jobs:
+			q.run(ctx, job)
+		default:
+			return
+		}
+	}
+}
+
+// run runs one job, recovering a panic so a bad job can't take the process
+// down with it. Cancelling ctx stops the workers taking new jobs but not the
+// job in hand, which only its timeout cuts short.
+func (q *Queue) run(ctx context.Context, job Job) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), q.timeout)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			q.failed.Add(1)
+			log.Error().Interface("panic", p).Bytes("stack", debug.Stack()).Msg("Queued job panicked")
+		}
+	}()
+	job(ctx)
+	q.processed.Add(1)
+}
+
+// Stats reports the current buffer depth and lifetime counters
+func (q *Queue) Stats() QueueStats {
+	return QueueStats{
+		Depth:     len(q.jobs),
+		Capacity:  cap(q.jobs),
+		Workers:   q.workers,
+		Processed: q.processed.Load(),
+		Failed:    q.failed.Load(),
+		Dropped:   q.dropped.Load(),
+	}
+}
@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Worker health states reported by Registry
+const (
+	WorkerStarting  = "starting"  // Registered, first run not yet due
+	WorkerHealthy   = "healthy"   // Ran within its expected interval
+	WorkerUnhealthy = "unhealthy" // Overdue: stuck or no longer running
+)
+
+// overdueFactor is how many intervals a worker may go without running before
+// it is unhealthy. A pass may take up to one interval, so a worker running on
+// schedule can be almost two intervals between completions.
+const overdueFactor = 2
+
+// WorkerStatus is a point-in-time view of one periodic worker
+type WorkerStatus struct {
+	Name            string     `json:"name"`
+	Status          string     `json:"status"`
+	IntervalSeconds int        `json:"intervalSeconds"`
+	StartedAt       time.Time  `json:"startedAt"`
+	LastRunAt       *time.Time `json:"lastRunAt"`
+	LastError       *string    `json:"lastError"` // From the most recent run, nil if it succeeded
+	Runs            int64      `json:"runs"`
+	Failures        int64      `json:"failures"`
+}
+
+// Registry tracks when each periodic background worker last ran, so workers
+// that stopped running show up in health checks instead of failing silently
+type Registry struct {
+	mu      sync.Mutex
+	workers map[string]*Heartbeat
+}
+
+func NewRegistry() *Registry {
+	return &Registry{workers: make(map[string]*Heartbeat)}
+}
+
+// Register adds a worker expected to run every interval and returns the
+// heartbeat it reports its runs to
+func (r *Registry) Register(name string, interval time.Duration) *Heartbeat {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hb := &Heartbeat{status: WorkerStatus{
+		Name:            name,
+		IntervalSeconds: int(interval / time.Second),
+		StartedAt:       time.Now(),
+	}, interval: interval}
+	r.workers[name] = hb
+	return hb
+}
+
+// Statuses returns every registered worker's status, ordered by name
+func (r *Registry) Statuses() []WorkerStatus {
+	r.mu.Lock()
+	heartbeats := make([]*Heartbeat, 0, len(r.workers))
+	for _, hb := range r.workers {
+		heartbeats = append(heartbeats, hb)
+	}
+	r.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]WorkerStatus, 0, len(heartbeats))
+	for _, hb := range heartbeats {
+		statuses = append(statuses, hb.snapshot(now))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Healthy reports whether no registered worker is overdue
+func (r *Registry) Healthy() bool {
+	for _, s := range r.Statuses() {
+		if s.Status == WorkerUnhealthy {
+			return false
+		}
+	}
+	return true
+}
+
+// Heartbeat records a worker's runs. A nil Heartbeat ignores them, so
+// workers can run without a registry.
+type Heartbeat struct {
+	mu       sync.Mutex
+	status   WorkerStatus
+	interval time.Duration
+}
+
+// Ran records a completed run and its error, if any
+func (h *Heartbeat) Ran(err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.status.LastRunAt = &now
+	h.status.Runs++
+	h.status.LastError = nil
+	if err != nil {
+		msg := err.Error()
+		h.status.LastError = &msg
+		h.status.Failures++
+	}
+}
+
+func (h *Heartbeat) snapshot(now time.Time) WorkerStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.status
+	since := s.StartedAt
+	if s.LastRunAt != nil {
+		since = *s.LastRunAt
+	}
+	switch {
+	case now.Sub(since) > overdueFactor*h.interval:
+		s.Status = WorkerUnhealthy
+	case s.LastRunAt == nil:
+		s.Status = WorkerStarting
+	default:
+		s.Status = WorkerHealthy
+	}
+	return s
+}
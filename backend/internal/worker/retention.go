@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/analytics"
+	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/repository"
+)
+
+// RetentionPurger deletes interactions and resolved escalations that are
+// older than their organization's retention window. Archiving to object
+// storage before deletion is not implemented yet.
+type RetentionPurger struct {
+	repos *repository.Repositories
+	redis *redis.Client
+	cfg   *config.Config
+}
+
+func NewRetentionPurger(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *RetentionPurger {
+	return &RetentionPurger{
+		repos: repos,
+		redis: redis,
+		cfg:   cfg,
+	}
+}
+
+// Run purges on every interval until ctx is cancelled, reporting each pass
+// to hb
+func (p *RetentionPurger) Run(ctx context.Context, hb *Heartbeat) {
+	ticker := time.NewTicker(time.Duration(p.cfg.RetentionPurgeIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hb.Ran(p.Purge(ctx))
+		}
+	}
+}
+
+// Purge runs a single pass
+func (p *RetentionPurger) Purge(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(p.cfg.RetentionPurgeIntervalMinutes)*time.Minute)
+	defer cancel()
+
+	result, err := p.repos.Organization.PurgeExpired(ctx, p.cfg.RetentionDays())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to purge expired data")
+		return err
+	}
+
+	if result.Interactions > 0 || result.Escalations > 0 {
+		log.Info().
+			Int64("interactions", result.Interactions).
+			Int64("escalations", result.Escalations).
+			Msg("Purged data past retention")
+		if err := analytics.InvalidateAll(ctx, p.redis); err != nil {
+			log.Warn().Err(err).Msg("Failed to invalidate cached analytics")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/vibber/backend/internal/analytics"
+	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/repository"
+)
+
+// TimeoutReason is recorded on interactions the sweeper fails
+const TimeoutReason = "timeout"
+
+const (
+	// escalationRetryWindow bounds how long after timing out an interaction
+	// is still escalated, so enabling escalation doesn't escalate old ones
+	escalationRetryWindow  = 24 * time.Hour
+	maxEscalationsPerSweep = 500
+)
+
+// InteractionSweeper fails interactions the AI service never completed, so
+// zombie interactions don't skew autonomous rate and processing time metrics
+type InteractionSweeper struct {
+	repos *repository.Repositories
+	redis *redis.Client
+	cfg   *config.Config
+}
+
+func NewInteractionSweeper(repos *repository.Repositories, redis *redis.Client, cfg *config.Config) *InteractionSweeper {
+	return &InteractionSweeper{
+		repos: repos,
+		redis: redis,
+		cfg:   cfg,
+	}
+}
+
+// Run sweeps on every interval until ctx is cancelled, reporting each pass
+// to hb
+func (s *InteractionSweeper) Run(ctx context.Context, hb *Heartbeat) {
+	ticker := time.NewTicker(time.Duration(s.cfg.SweepIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hb.Ran(s.Sweep(ctx))
+		}
+	}
+}
+
+// Sweep runs a single pass, bounded by the sweep interval so a slow pass
+// never overlaps the next one. Only a failure to sweep is returned; failures
+// to escalate individual interactions are logged.
+func (s *InteractionSweeper) Sweep(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.SweepIntervalSeconds)*time.Second)
+	defer cancel()
+
+	timeout := time.Duration(s.cfg.InteractionTimeoutMinutes) * time.Minute
+
+	stale, err := s.repos.Interaction.FailStale(ctx, timeout, TimeoutReason)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to sweep stale interactions")
+		return err
+	}
+	if len(stale) > 0 {
+		log.Info().Int("count", len(stale)).Msg("Marked stale interactions as failed")
+	}
+
+	// Escalations are created separately from failing the interactions, so
+	// each pass escalates every recent timeout still without one, including
+	// those a previous pass failed to escalate
+	var unescalated []*models.Interaction
+	if s.cfg.InteractionTimeoutEscalate {
+		unescalated, err = s.repos.Interaction.ListUnescalatedFailures(ctx, TimeoutReason, escalationRetryWindow, maxEscalationsPerSweep)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to list timed out interactions to escalate")
+		}
+	}
+
+	// Cached analytics are invalidated once the escalations below exist too
+	agentIDs := make([]uuid.UUID, 0, len(stale)+len(unescalated))
+	for _, interaction := range append(stale, unescalated...) {
+		agentIDs = append(agentIDs, interaction.AgentID)
+	}
+	defer func() {
+		if err := analytics.Invalidate(context.WithoutCancel(ctx), s.redis, agentIDs...); err != nil {
+			log.Warn().Err(err).Msg("Failed to invalidate cached analytics")
+		}
+	}()
+
+	for _, interaction := range unescalated {
+		escalation := &models.Escalation{
+			ID:            uuid.New(),
+			InteractionID: interaction.ID,
+			AgentID:       interaction.AgentID,
+			Reason:        "Processing timed out",
+			Priority:      "medium",
+			Status:        "pending",
+		}
+		assignee, err := s.repos.RoutingRule.Assignee(ctx, interaction.AgentID, interaction.Provider, interaction.InteractionType)
+		switch {
+		case err == nil:
+			escalation.AssignedTo = &assignee
+		case !errors.Is(err, repository.ErrNotFound):
+			log.Warn().Err(err).Str("interaction_id", interaction.ID.String()).Msg("Failed to route escalation, leaving it unassigned")
+		}
+		if err := s.repos.Escalation.Escalate(ctx, escalation); err != nil {
+			log.Error().Err(err).Str("interaction_id", interaction.ID.String()).Msg("Failed to escalate timed out interaction, will retry")
+		}
+	}
+	return nil
+}
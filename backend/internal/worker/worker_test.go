@@ -0,0 +1,257 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/vibber/backend/internal/config"
+	"github.com/vibber/backend/internal/models"
+	"github.com/vibber/backend/internal/repository"
+)
+
+// unreachableRedis returns a client whose commands all fail, for workers
+// that only touch Redis on a best-effort basis
+func unreachableRedis() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		MaxRetries: -1,
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, errors.New("redis down")
+		},
+	})
+}
+
+// fakeStaleInteractionRepo fails its stale interactions on the first sweep.
+// Failed interactions stay unescalated until escalations has one for them.
+type fakeStaleInteractionRepo struct {
+	repository.InteractionRepository
+	stale       []*models.Interaction
+	failed      []*models.Interaction
+	escalations *fakeEscalateRepo
+}
+
+func (f *fakeStaleInteractionRepo) FailStale(ctx context.Context, olderThan time.Duration, reason string) ([]*models.Interaction, error) {
+	stale := f.stale
+	f.failed = append(f.failed, stale...)
+	f.stale = nil
+	return stale, nil
+}
+
+func (f *fakeStaleInteractionRepo) ListUnescalatedFailures(ctx context.Context, reason string, within time.Duration, limit int) ([]*models.Interaction, error) {
+	var unescalated []*models.Interaction
+	for _, interaction := range f.failed {
+		if !f.escalations.has(interaction.ID) {
+			unescalated = append(unescalated, interaction)
+		}
+	}
+	return unescalated, nil
+}
+
+type fakeEscalateRepo struct {
+	repository.EscalationRepository
+	escalated []*models.Escalation
+	failing   map[uuid.UUID]bool
+}
+
+func (f *fakeEscalateRepo) Escalate(ctx context.Context, e *models.Escalation) error {
+	if f.failing[e.InteractionID] {
+		return errors.New("connection reset")
+	}
+	f.escalated = append(f.escalated, e)
+	return nil
+}
+
+func (f *fakeEscalateRepo) has(interactionID uuid.UUID) bool {
+	for _, e := range f.escalated {
+		if e.InteractionID == interactionID {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeRoutingRuleRepo struct {
+	repository.RoutingRuleRepository
+}
+
+func (f *fakeRoutingRuleRepo) Assignee(ctx context.Context, agentID uuid.UUID, provider, interactionType string) (uuid.UUID, error) {
+	return uuid.Nil, repository.ErrNotFound
+}
+
+func TestSweepEscalatesTimedOutInteractions(t *testing.T) {
+	stale := []*models.Interaction{
+		{ID: uuid.New(), AgentID: uuid.New(), Provider: "slack"},
+		{ID: uuid.New(), AgentID: uuid.New(), Provider: "github"},
+	}
+	escalations := &fakeEscalateRepo{}
+	sweeper := NewInteractionSweeper(&repository.Repositories{
+		Interaction: &fakeStaleInteractionRepo{stale: stale, escalations: escalations},
+		Escalation:  escalations,
+		RoutingRule: &fakeRoutingRuleRepo{},
+	}, unreachableRedis(), &config.Config{InteractionTimeoutMinutes: 30, InteractionTimeoutEscalate: true, SweepIntervalSeconds: 60})
+
+	if err := sweeper.Sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(escalations.escalated) != len(stale) {
+		t.Fatalf("got %d escalations, want %d", len(escalations.escalated), len(stale))
+	}
+	for i, e := range escalations.escalated {
+		if e.InteractionID != stale[i].ID || e.AgentID != stale[i].AgentID {
+			t.Errorf("escalation %d is for interaction %s, want %s", i, e.InteractionID, stale[i].ID)
+		}
+	}
+
+	// Later sweeps don't escalate them again
+	if err := sweeper.Sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(escalations.escalated) != len(stale) {
+		t.Errorf("got %d escalations after another sweep, want %d", len(escalations.escalated), len(stale))
+	}
+}
+
+// An interaction failed without its escalation is escalated by a later sweep
+func TestSweepRetriesFailedEscalations(t *testing.T) {
+	stale := []*models.Interaction{{ID: uuid.New(), AgentID: uuid.New(), Provider: "slack"}}
+	escalations := &fakeEscalateRepo{failing: map[uuid.UUID]bool{stale[0].ID: true}}
+	sweeper := NewInteractionSweeper(&repository.Repositories{
+		Interaction: &fakeStaleInteractionRepo{stale: stale, escalations: escalations},
+		Escalation:  escalations,
+		RoutingRule: &fakeRoutingRuleRepo{},
+	}, unreachableRedis(), &config.Config{InteractionTimeoutMinutes: 30, InteractionTimeoutEscalate: true, SweepIntervalSeconds: 60})
+
+	if err := sweeper.Sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(escalations.escalated) != 0 {
+		t.Fatalf("got %d escalations from a failing repository", len(escalations.escalated))
+	}
+
+	escalations.failing = nil
+	if err := sweeper.Sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(escalations.escalated) != 1 || escalations.escalated[0].InteractionID != stale[0].ID {
+		t.Errorf("got escalations %v, want one for %s", escalations.escalated, stale[0].ID)
+	}
+}
+
+func TestQueueSubmitFull(t *testing.T) {
+	q := NewQueue(2, 1, time.Minute)
+	noop := func(ctx context.Context) {}
+
+	if !q.Submit(noop) || !q.Submit(noop) {
+		t.Fatal("submit into a buffer with room should succeed")
+	}
+	if q.Submit(noop) {
+		t.Error("submit into a full buffer should fail")
+	}
+
+	stats := q.Stats()
+	if stats.Depth != 2 || stats.Capacity != 2 || stats.Workers != 1 || stats.Dropped != 1 {
+		t.Errorf("got %+v, want depth 2, capacity 2, 1 worker, 1 dropped", stats)
+	}
+}
+
+func TestQueueDrainsOnCancel(t *testing.T) {
+	q := NewQueue(10, 2, time.Minute)
+	var ran atomic.Int64
+	for i := 0; i < 5; i++ {
+		q.Submit(func(ctx context.Context) {
+			if ctx.Err() != nil {
+				t.Error("drained jobs should run with a live context")
+			}
+			ran.Add(1)
+		})
+	}
+
+	// Cancelled before Run starts, so every job is run by the drain
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.Run(ctx)
+
+	if ran.Load() != 5 {
+		t.Errorf("ran %d jobs, want 5", ran.Load())
+	}
+	if stats := q.Stats(); stats.Depth != 0 || stats.Processed != 5 {
+		t.Errorf("got %+v, want depth 0 and 5 processed", stats)
+	}
+}
+
+// A job already running at shutdown keeps its context, and Run waits for it
+func TestQueueFinishesInFlightJobsOnCancel(t *testing.T) {
+	q := NewQueue(10, 1, time.Minute)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var finished atomic.Bool
+	q.Submit(func(ctx context.Context) {
+		close(started)
+		<-release
+		if ctx.Err() != nil {
+			t.Error("in-flight job was cancelled by shutdown")
+		}
+		finished.Store(true)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+		t.Fatal("Run returned before the in-flight job finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	if !finished.Load() {
+		t.Error("in-flight job did not finish")
+	}
+}
+
+func TestQueueJobTimeout(t *testing.T) {
+	q := NewQueue(10, 1, 10*time.Millisecond)
+	var timedOut atomic.Bool
+	q.Submit(func(ctx context.Context) {
+		<-ctx.Done()
+		timedOut.Store(errors.Is(ctx.Err(), context.DeadlineExceeded))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.Run(ctx)
+
+	if !timedOut.Load() {
+		t.Error("job ran past its timeout")
+	}
+}
+
+func TestQueueRecoversPanics(t *testing.T) {
+	q := NewQueue(10, 1, time.Minute)
+	var ran atomic.Int64
+	q.Submit(func(ctx context.Context) { panic("boom") })
+	q.Submit(func(ctx context.Context) { ran.Add(1) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.Run(ctx)
+
+	if ran.Load() != 1 {
+		t.Error("a panicking job should not stop the jobs after it")
+	}
+	if stats := q.Stats(); stats.Processed != 1 || stats.Failed != 1 {
+		t.Errorf("got %+v, want 1 processed and 1 failed", stats)
+	}
+}
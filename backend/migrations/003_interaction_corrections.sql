@@ -0,0 +1,13 @@
+-- Vibber Database Schema
+-- Version: 003
+-- Description: Preserve original agent output when a human correction is applied
+
+-- The original output stays in output_data; the human correction is stored alongside it
+-- so reviewers can compare the two.
+ALTER TABLE interactions ADD COLUMN IF NOT EXISTS corrected_output TEXT;
+ALTER TABLE interactions ADD COLUMN IF NOT EXISTS corrected_by UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE interactions ADD COLUMN IF NOT EXISTS corrected_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN interactions.corrected_output IS 'Human-provided correction of the agent output (original kept in output_data)';
+COMMENT ON COLUMN interactions.corrected_by IS 'User who applied the correction';
+COMMENT ON COLUMN interactions.corrected_at IS 'When the correction was applied';
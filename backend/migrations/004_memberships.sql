@@ -0,0 +1,22 @@
+-- Vibber Database Schema
+-- Version: 004
+-- Description: Allow users to belong to multiple organizations
+
+-- Memberships link users to organizations with a per-organization role.
+-- users.org_id remains the user's primary (home) organization.
+CREATE TABLE memberships (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    role VARCHAR(50) DEFAULT 'member' CHECK (role IN ('admin', 'member', 'viewer')),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (user_id, org_id)
+);
+
+CREATE INDEX idx_memberships_org_id ON memberships(org_id);
+
+-- Backfill memberships for existing users' primary organizations
+INSERT INTO memberships (user_id, org_id, role, created_at)
+SELECT id, org_id, role, created_at FROM users
+ON CONFLICT (user_id, org_id) DO NOTHING;
+
+COMMENT ON TABLE memberships IS 'User to organization membership with per-organization role. The active organization is carried in the JWT orgId claim.';
@@ -0,0 +1,9 @@
+-- Vibber Database Schema
+-- Version: 005
+-- Description: Per-provider confidence threshold overrides for agents
+
+-- Maps provider to a confidence threshold that replaces confidence_threshold
+-- for interactions from that provider, e.g. {"github": 85, "slack": 60}
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS provider_thresholds JSONB DEFAULT '{}';
+
+COMMENT ON COLUMN agents.provider_thresholds IS 'Per-provider overrides of confidence_threshold';
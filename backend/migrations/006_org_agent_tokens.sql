@@ -0,0 +1,12 @@
+-- Vibber Database Schema
+-- Version: 006
+-- Description: Per-organization service tokens for dedicated agent workers
+
+-- Only the SHA-256 hash of the token is stored; the token itself is shown
+-- once when it is rotated
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS agent_token_hash VARCHAR(64);
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS agent_token_rotated_at TIMESTAMP WITH TIME ZONE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organizations_agent_token_hash ON organizations(agent_token_hash);
+
+COMMENT ON COLUMN organizations.agent_token_hash IS 'SHA-256 hex of the org agent token accepted by internal endpoints';
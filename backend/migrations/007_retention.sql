@@ -0,0 +1,11 @@
+-- Vibber Database Schema
+-- Version: 007
+-- Description: Per-organization data retention policy and legal hold
+
+-- NULL retention_days uses the default for the organization's plan
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS retention_days INTEGER CHECK (retention_days > 0);
+-- While set, nothing in the organization is purged
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS legal_hold BOOLEAN DEFAULT false;
+
+COMMENT ON COLUMN organizations.retention_days IS 'Days to keep interactions and resolved escalations; NULL uses the plan default';
+COMMENT ON COLUMN organizations.legal_hold IS 'Suspends retention purges for the organization';
@@ -0,0 +1,21 @@
+-- Vibber Database Schema
+-- Version: 008
+-- Description: Shadow replays of past interactions for regression testing
+
+-- Each row is the hypothetical result of re-running one interaction through
+-- the AI service in shadow mode (no actions executed). Rows from one replay
+-- request share a run_id.
+CREATE TABLE IF NOT EXISTS interaction_replays (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    run_id UUID NOT NULL,
+    agent_id UUID NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    interaction_id UUID NOT NULL REFERENCES interactions(id) ON DELETE CASCADE,
+    status VARCHAR(50) NOT NULL CHECK (status IN ('completed', 'escalated', 'error')),
+    action VARCHAR(50),
+    output_data JSONB,
+    confidence_score INTEGER CHECK (confidence_score >= 0 AND confidence_score <= 100),
+    error_message TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_interaction_replays_run ON interaction_replays(agent_id, run_id);
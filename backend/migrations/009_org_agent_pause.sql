@@ -0,0 +1,13 @@
+-- Vibber Database Schema
+-- Version: 009
+-- Description: Organization-wide pause of all agents
+
+-- While set, webhook events are not queued for any of the organization's agents
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS agents_paused_at TIMESTAMPTZ;
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS agents_paused_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Marks agents paused by the organization pause so resume only restores those
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS paused_by_org BOOLEAN DEFAULT false;
+
+COMMENT ON COLUMN organizations.agents_paused_at IS 'When an admin paused all agents; NULL when not paused';
+COMMENT ON COLUMN agents.paused_by_org IS 'Agent was active when the organization paused all agents';
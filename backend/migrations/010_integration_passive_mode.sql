@@ -0,0 +1,8 @@
+-- Vibber Database Schema
+-- Version: 010
+-- Description: Passive (reaction-only) mode for integrations
+
+-- Passive integrations only react; message posts are escalated instead of sent
+ALTER TABLE integrations ADD COLUMN IF NOT EXISTS passive BOOLEAN DEFAULT false;
+
+COMMENT ON COLUMN integrations.passive IS 'Agent may only react through this integration, never post messages';
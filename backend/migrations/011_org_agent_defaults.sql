@@ -0,0 +1,10 @@
+-- Vibber Database Schema
+-- Version: 011
+-- Description: Organization-level defaults for new agents
+
+-- Template applied to agents created in the organization when the request
+-- omits a field, e.g. {"confidenceThreshold": 80, "autoMode": false,
+-- "providerThresholds": {"github": 90}, "workingHours": {...}}
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS agent_defaults JSONB DEFAULT '{}';
+
+COMMENT ON COLUMN organizations.agent_defaults IS 'Default settings for new agents in the organization';
@@ -0,0 +1,15 @@
+-- Vibber Database Schema
+-- Version: 012
+-- Description: Random audit sampling of autonomous interactions
+
+-- Fraction (0-1) of autonomously completed interactions queued for human review
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS audit_sample_rate DOUBLE PRECISION DEFAULT 0
+    CHECK (audit_sample_rate >= 0 AND audit_sample_rate <= 1);
+
+-- Tag distinguishing escalations raised for other reasons than low confidence, e.g. 'audit'
+ALTER TABLE escalations ADD COLUMN IF NOT EXISTS tag VARCHAR(50);
+
+CREATE INDEX IF NOT EXISTS idx_escalations_agent_tag ON escalations(agent_id, tag) WHERE tag IS NOT NULL;
+
+COMMENT ON COLUMN agents.audit_sample_rate IS 'Fraction of autonomous interactions escalated for audit review';
+COMMENT ON COLUMN escalations.tag IS 'Why the escalation was raised when not low confidence, e.g. audit';
@@ -0,0 +1,24 @@
+-- Vibber Database Schema
+-- Version: 013
+-- Description: Escalation assignment and routing rules
+
+-- Reviewer responsible for the escalation; set from routing rules on creation
+ALTER TABLE escalations ADD COLUMN IF NOT EXISTS assigned_to UUID REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_escalations_assigned_to ON escalations(assigned_to) WHERE status = 'pending';
+
+-- Rules mapping provider and/or interaction type to a reviewer. The most
+-- specific matching rule wins; with none the agent owner is assigned.
+CREATE TABLE IF NOT EXISTS escalation_routing_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    agent_id UUID REFERENCES agents(id) ON DELETE CASCADE, -- NULL applies to every agent in the organization
+    provider VARCHAR(50), -- NULL matches any provider
+    interaction_type VARCHAR(50), -- NULL matches any interaction type
+    assignee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_escalation_routing_rules_org_id ON escalation_routing_rules(org_id);
+
+COMMENT ON TABLE escalation_routing_rules IS 'Assigns new escalations to reviewers by agent, provider and interaction type';
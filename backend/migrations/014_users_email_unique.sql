@@ -0,0 +1,12 @@
+-- Vibber Database Schema
+-- Version: 014
+-- Description: Guarantee the users email unique constraint
+
+-- Registration relies on users_email_key to reject concurrent signups with
+-- the same email; add it where the schema predates the inline UNIQUE
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_email_key') THEN
+        ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+    END IF;
+END $$;
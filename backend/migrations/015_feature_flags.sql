@@ -0,0 +1,9 @@
+-- Vibber Database Schema
+-- Version: 015
+-- Description: Per-organization feature flags
+
+-- Flags explicitly set for the organization, e.g. {"cost_tracking": true};
+-- flags not listed use the built-in default
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS feature_flags JSONB DEFAULT '{}';
+
+COMMENT ON COLUMN organizations.feature_flags IS 'Feature flag overrides for the organization';
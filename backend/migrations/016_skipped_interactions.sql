@@ -0,0 +1,12 @@
+-- Vibber Database Schema
+-- Version: 016
+-- Description: Interactions acknowledged without processing
+
+-- Webhook events such as bot echoes and edits are recorded as skipped instead of processed
+ALTER TABLE interactions DROP CONSTRAINT IF EXISTS interactions_status_check;
+ALTER TABLE interactions ADD CONSTRAINT interactions_status_check
+    CHECK (status IN ('pending', 'processing', 'completed', 'escalated', 'failed', 'skipped'));
+
+ALTER TABLE interactions ADD COLUMN IF NOT EXISTS skip_reason VARCHAR(50);
+
+COMMENT ON COLUMN interactions.skip_reason IS 'Why a skipped interaction was not processed, e.g. bot or message_edited';
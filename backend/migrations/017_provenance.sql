@@ -0,0 +1,19 @@
+-- Vibber Database Schema
+-- Version: 017
+-- Description: Who created and last updated agents, organizations and credentials
+
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS created_by UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS updated_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS created_by UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS updated_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE organization_credentials ADD COLUMN IF NOT EXISTS updated_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Agents so far were only ever created by their owner
+UPDATE agents SET created_by = user_id WHERE created_by IS NULL;
+UPDATE organization_credentials SET updated_by = created_by WHERE updated_by IS NULL;
+
+COMMENT ON COLUMN agents.updated_by IS 'User who last changed the agent or its settings';
+COMMENT ON COLUMN organizations.updated_by IS 'User who last changed the organization or its policies';
+COMMENT ON COLUMN organization_credentials.updated_by IS 'User who last changed the credential';
@@ -0,0 +1,13 @@
+-- Vibber Database Schema
+-- Version: 018
+-- Description: Scopes added to integrations after they were connected
+
+CREATE TABLE IF NOT EXISTS integration_scope_grants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    integration_id UUID NOT NULL REFERENCES integrations(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL, -- Only the scopes this grant added
+    granted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_integration_scope_grants_integration_id ON integration_scope_grants(integration_id, created_at);
@@ -0,0 +1,8 @@
+-- Vibber Database Schema
+-- Version: 019
+-- Description: Enable/disable toggle for integrations
+
+-- Disabled integrations stay connected but their events are not processed
+ALTER TABLE integrations ADD COLUMN IF NOT EXISTS enabled BOOLEAN NOT NULL DEFAULT true;
+
+COMMENT ON COLUMN integrations.enabled IS 'Agent acts on events through this integration; false keeps the token but ignores events';
@@ -0,0 +1,15 @@
+-- Vibber Database Schema
+-- Version: 020
+-- Description: Integrations shared by several agents
+
+-- Agents subscribed to an integration besides the one that owns it
+-- (integrations.agent_id). Webhook events are fanned out to the owner and
+-- every subscriber.
+CREATE TABLE IF NOT EXISTS agent_integrations (
+    agent_id UUID NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    integration_id UUID NOT NULL REFERENCES integrations(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (agent_id, integration_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_integrations_integration_id ON agent_integrations(integration_id);
@@ -0,0 +1,8 @@
+-- Vibber Database Schema
+-- Version: 021
+-- Description: Interactions promoted to training samples
+
+-- An interaction is promoted at most once; promoted samples carry the
+-- source 'interaction:<id>'
+CREATE UNIQUE INDEX IF NOT EXISTS idx_training_samples_promoted
+    ON training_samples(agent_id, source) WHERE source LIKE 'interaction:%';
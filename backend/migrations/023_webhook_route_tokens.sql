@@ -0,0 +1,11 @@
+-- Vibber Database Schema
+-- Version: 023
+-- Description: Secret webhook URLs for providers that cannot sign requests
+
+-- SHA-256 of the integration's webhook route token. Events posted to
+-- /webhooks/{provider}/{token} are authorized by the token instead of a
+-- signature header.
+ALTER TABLE integrations ADD COLUMN IF NOT EXISTS route_token_hash VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_integrations_route_token_hash
+    ON integrations(route_token_hash) WHERE route_token_hash IS NOT NULL;
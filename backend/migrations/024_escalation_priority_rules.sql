@@ -0,0 +1,21 @@
+-- Vibber Database Schema
+-- Version: 024
+-- Description: Configurable escalation priority rules
+
+-- Each matching rule adds its weight to an escalation's priority score, which
+-- starts at how far confidence fell below the threshold. Set criteria must
+-- all match; NULL criteria match anything.
+CREATE TABLE IF NOT EXISTS escalation_priority_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    agent_id UUID REFERENCES agents(id) ON DELETE CASCADE, -- NULL applies to every agent in the organization
+    provider VARCHAR(50), -- NULL matches any provider
+    keyword VARCHAR(100), -- Case-insensitive match in the interaction input, NULL matches any
+    min_gap INTEGER CHECK (min_gap BETWEEN 0 AND 100), -- Confidence gap below threshold, NULL matches any
+    weight INTEGER NOT NULL CHECK (weight BETWEEN -100 AND 100),
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_escalation_priority_rules_org_id ON escalation_priority_rules(org_id);
+
+COMMENT ON TABLE escalation_priority_rules IS 'Adjusts the priority of new escalations by agent, provider, keyword and confidence gap';
@@ -0,0 +1,33 @@
+-- Vibber Database Schema
+-- Version: 025
+-- Description: Maintenance windows deferring webhook events
+
+-- Webhook events arriving during a window are stored as deferred and
+-- released or dropped once it ends. Recurring windows repeat at the same
+-- wall-clock time in their time zone.
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    agent_id UUID REFERENCES agents(id) ON DELETE CASCADE, -- NULL applies to every agent in the organization
+    name VARCHAR(255) NOT NULL,
+    starts_at TIMESTAMPTZ NOT NULL, -- First occurrence
+    ends_at TIMESTAMPTZ NOT NULL CHECK (ends_at > starts_at),
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    recurrence VARCHAR(20) NOT NULL DEFAULT 'none' CHECK (recurrence IN ('none', 'daily', 'weekly')),
+    on_end VARCHAR(20) NOT NULL DEFAULT 'release' CHECK (on_end IN ('release', 'drop')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_windows_org_id ON maintenance_windows(org_id);
+
+ALTER TABLE interactions DROP CONSTRAINT IF EXISTS interactions_status_check;
+ALTER TABLE interactions ADD CONSTRAINT interactions_status_check
+    CHECK (status IN ('pending', 'processing', 'completed', 'escalated', 'failed', 'skipped', 'deferred'));
+
+ALTER TABLE interactions ADD COLUMN IF NOT EXISTS deferred_window_id UUID REFERENCES maintenance_windows(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_interactions_deferred ON interactions(created_at) WHERE status = 'deferred';
+
+COMMENT ON TABLE maintenance_windows IS 'Periods during which webhook events are deferred instead of processed';
+COMMENT ON COLUMN interactions.deferred_window_id IS 'Maintenance window that deferred the event, NULL once the window is deleted';
@@ -0,0 +1,29 @@
+-- Vibber Database Schema
+-- Version: 026
+-- Description: Organization tag vocabulary for annotating interactions
+
+-- Admins manage each organization's tags; reviewers apply them to
+-- interactions for filtering and reporting
+CREATE TABLE IF NOT EXISTS tags (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL, -- Lower case, unique within the organization
+    color VARCHAR(7), -- Hex color for display, e.g. #ff8800
+    description TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (org_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS interaction_tags (
+    interaction_id UUID NOT NULL REFERENCES interactions(id) ON DELETE CASCADE,
+    tag_id UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    tagged_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (interaction_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_interaction_tags_tag_id ON interaction_tags(tag_id);
+
+COMMENT ON TABLE tags IS 'Organization-managed labels reviewers apply to interactions';
+COMMENT ON TABLE interaction_tags IS 'Tags applied to interactions';
@@ -0,0 +1,9 @@
+-- Vibber Database Schema
+-- Version: 027
+-- Description: Per-agent AI model selection
+
+-- NULL uses the AI service's default model. Which models an agent may use
+-- depends on its organization's plan and is checked by the API.
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS model VARCHAR(100);
+
+COMMENT ON COLUMN agents.model IS 'AI model the agent processes interactions with, NULL for the default';
@@ -0,0 +1,28 @@
+-- Vibber Database Schema
+-- Version: 028
+-- Description: Device-bound refresh sessions and per-user token epochs
+
+-- Every login starts a session for the device it came from. Refresh tokens
+-- name their session and are only honored from the same device while the
+-- session is not revoked.
+CREATE TABLE IF NOT EXISTS refresh_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id VARCHAR(128) NOT NULL DEFAULT '', -- Client-provided, empty when the client sent none
+    fingerprint VARCHAR(64) NOT NULL, -- SHA-256 of the user agent and device ID
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_sessions_user_active
+    ON refresh_sessions(user_id, last_used_at DESC) WHERE revoked_at IS NULL;
+
+-- Refresh tokens carry the epoch they were issued in; bumping it invalidates
+-- every refresh token the user holds ("log out everywhere")
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_epoch INTEGER NOT NULL DEFAULT 0;
+
+COMMENT ON TABLE refresh_sessions IS 'Per-device login sessions that refresh tokens are bound to';
+COMMENT ON COLUMN users.token_epoch IS 'Incremented to invalidate all of the user''s refresh tokens';
@@ -0,0 +1,11 @@
+-- Vibber Database Schema
+-- Version: 029
+-- Description: Index integrations by provider workspace for webhook routing
+
+-- Webhooks are routed to every integration connected to the workspace they
+-- came from, matched on external_id or, for Slack, the team ID in metadata
+CREATE INDEX IF NOT EXISTS idx_integrations_provider_external_id
+    ON integrations(provider, external_id);
+
+CREATE INDEX IF NOT EXISTS idx_integrations_provider_team_id
+    ON integrations(provider, (metadata->>'teamId'));
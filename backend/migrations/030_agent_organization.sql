@@ -0,0 +1,18 @@
+-- Vibber Database Schema
+-- Version: 030
+-- Description: Agents belong to the organization they were created in
+
+-- Agents used to be attributed to every organization their owner is a member
+-- of, so a user in two organizations had their agents listed, paused and
+-- billed in both. Existing agents go to their owner's primary organization.
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS org_id UUID REFERENCES organizations(id) ON DELETE CASCADE;
+
+UPDATE agents a SET org_id = u.org_id
+FROM users u
+WHERE u.id = a.user_id AND a.org_id IS NULL;
+
+ALTER TABLE agents ALTER COLUMN org_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_agents_org_id ON agents(org_id);
+
+COMMENT ON COLUMN agents.org_id IS 'Organization the agent was created in';
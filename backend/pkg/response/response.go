@@ -42,3 +42,17 @@ func Paginated(w http.ResponseWriter, data interface{}, page, pageSize, total in
 		"totalPages": totalPages,
 	})
 }
+
+// CursorPaginated sends a page of a cursor-paginated list. An empty
+// nextCursor means there are no more items.
+func CursorPaginated(w http.ResponseWriter, data interface{}, nextCursor string) {
+	var next interface{}
+	if nextCursor != "" {
+		next = nextCursor
+	}
+
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"data":       data,
+		"nextCursor": next,
+	})
+}
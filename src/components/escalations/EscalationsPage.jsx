@@ -193,7 +193,7 @@ export default function EscalationsPage() {
     queryKey: ['escalations'],
     queryFn: async () => {
       const response = await escalationsApi.list();
-      return response.data;
+      return response.data.data;
     },
   });
 
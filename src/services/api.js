@@ -3,6 +3,19 @@ import { useAuthStore } from '../store/authStore';
 
 const API_BASE_URL = process.env.REACT_APP_API_URL || 'http://localhost:8080/api/v1';
 
+// Refresh tokens only work from the device they were issued to, so each
+// browser keeps a stable device ID
+const DEVICE_ID_KEY = 'vibber-device-id';
+
+const getDeviceId = () => {
+  let deviceId = localStorage.getItem(DEVICE_ID_KEY);
+  if (!deviceId) {
+    deviceId = crypto.randomUUID();
+    localStorage.setItem(DEVICE_ID_KEY, deviceId);
+  }
+  return deviceId;
+};
+
 const api = axios.create({
   baseURL: API_BASE_URL,
   headers: {
@@ -17,6 +30,7 @@ api.interceptors.request.use(
     if (token) {
       config.headers.Authorization = `Bearer ${token}`;
     }
+    config.headers['X-Device-ID'] = getDeviceId();
     return config;
   },
   (error) => Promise.reject(error)
@@ -35,10 +49,13 @@ api.interceptors.response.use(
         const refreshToken = useAuthStore.getState().refreshToken;
         const response = await axios.post(`${API_BASE_URL}/auth/refresh`, {
           refreshToken,
+        }, {
+          headers: { 'X-Device-ID': getDeviceId() },
         });
 
-        const { accessToken } = response.data;
-        useAuthStore.getState().updateTokens({ accessToken });
+        // Refresh tokens are single use; keep the rotated one
+        const { accessToken, refreshToken: rotatedRefreshToken } = response.data;
+        useAuthStore.getState().updateTokens({ accessToken, refreshToken: rotatedRefreshToken });
 
         originalRequest.headers.Authorization = `Bearer ${accessToken}`;
         return api(originalRequest);
@@ -64,6 +81,15 @@ export const authApi = {
   logout: () =>
     api.post('/auth/logout'),
 
+  logoutAll: () =>
+    api.post('/auth/logout-all'),
+
+  listSessions: () =>
+    api.get('/auth/sessions'),
+
+  revokeSession: (sessionId) =>
+    api.delete(`/auth/sessions/${sessionId}`),
+
   me: () =>
     api.get('/auth/me'),
 };
@@ -80,7 +106,7 @@ export const agentsApi = {
     api.post('/agents', data),
 
   update: (id, data) =>
-    api.put(`/agents/${id}`, data),
+    api.patch(`/agents/${id}`, data),
 
   delete: (id) =>
     api.delete(`/agents/${id}`),